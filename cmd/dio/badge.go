@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/badge"
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/history"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/reporter"
+)
+
+// --- badge command ---
+
+func newBadgeCmd() *cobra.Command {
+	var (
+		outputFormat string
+		outputFile   string
+		report       string
+		historyDir   string
+		label        string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "badge [Dockerfile|image]",
+		Short: "Render the score and policy status of the latest run as a README badge",
+		Long: `Renders the score and policy status of the latest recorded run of a
+Dockerfile or image (of any target without one) as an SVG badge, or as the
+JSON of a shields.io endpoint badge with --format json. With --report, the
+badge reflects a report.json instead, such as one committed to the
+repository.
+
+dio serve serves the same badge at /badge?target=...`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target := ""
+			if len(args) == 1 {
+				target = args[0]
+			}
+			if target != "" && report != "" {
+				return fmt.Errorf("pass a target or --report, not both")
+			}
+			return runBadge(target, report, historyDir, label, outputFormat, outputFile)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "format", "f", "svg", "Output format: svg, json (shields.io endpoint)")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Write the badge to a file instead of stdout")
+	cmd.Flags().StringVar(&report, "report", "", "Render the badge of a report.json instead of the run history")
+	cmd.Flags().StringVar(&historyDir, "history", "", "History directory (default: history.dir, or ~/.dio/history)")
+	cmd.Flags().StringVar(&label, "label", badge.DefaultLabel, "Left-hand text of the badge")
+	return cmd
+}
+
+func runBadge(target, report, historyDir, label, format, outputFile string) error {
+	if err := checkFormat(format, "svg", "json"); err != nil {
+		return err
+	}
+
+	result, err := badgeResult(target, report, historyDir)
+	if err != nil {
+		return err
+	}
+	b := badge.Unknown()
+	if result != nil {
+		b = badge.For(result)
+	}
+	b.Label = label
+
+	data := b.SVG()
+	if format == "json" {
+		if data, err = json.MarshalIndent(b.Endpoint(), "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+	if outputFile == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(outputFile, data, 0o644)
+}
+
+// badgeResult loads the result a badge reflects: the report, or the
+// latest recorded run of target. It returns nil when nothing was recorded
+// yet, so the badge shows as unknown rather than failing the build.
+func badgeResult(target, report, historyDir string) (*models.PipelineResult, error) {
+	if report != "" {
+		result, err := reporter.LoadResult(report)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			return nil, fmt.Errorf("report %s not found", report)
+		}
+		return result, nil
+	}
+
+	store := &history.Store{Dir: historyDir}
+	if store.Dir == "" {
+		cfg, err := config.LoadOrDefault(configFile)
+		if err != nil {
+			return nil, err
+		}
+		if store, err = historyStore(cfg); err != nil {
+			return nil, err
+		}
+	}
+	run, err := store.Latest(target)
+	if err != nil || run == nil {
+		return nil, err
+	}
+	return store.Load(run.ID)
+}
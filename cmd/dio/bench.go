@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/bench"
+	"github.com/maxlar/docker-image-optimizer/internal/builder"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/scanner"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// --- bench command ---
+
+func newBenchCmd() *cobra.Command {
+	var (
+		contextDir string
+		sortBy     string
+		format     string
+		skipScan   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "bench [Dockerfile] [Dockerfile...]",
+		Short: "Build several Dockerfiles and rank them by size, CVEs, layers and build time",
+		Long: `Builds each candidate Dockerfile twice, first with --no-cache for the cold
+build time and then again with the cache warm, scans the images and prints a
+ranked comparison table. Use it to evaluate several optimization approaches
+for the same application, e.g.
+
+  dio bench Dockerfile Dockerfile.optimized Dockerfile.alt
+
+The first Dockerfile is the baseline that size changes are reported against.
+Each Dockerfile is built in its own directory unless --context is given.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBench(args, contextDir, sortBy, format, skipScan)
+		},
+	}
+
+	cmd.Flags().StringVar(&contextDir, "context", "", "Build context for every Dockerfile (default: each Dockerfile's directory)")
+	cmd.Flags().StringVar(&sortBy, "sort", bench.SortSize, "Rank by: size, cves, build, layers")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text, json, markdown")
+	cmd.Flags().BoolVar(&skipScan, "skip-scan", false, "Skip security scanning (CVE columns stay empty)")
+	return cmd
+}
+
+func runBench(dockerfiles []string, contextDir, sortBy, format string, skipScan bool) error {
+	if err := checkFormat(format, "text", "json", "markdown"); err != nil {
+		return err
+	}
+	retryPol, err := retryPolicy()
+	if err != nil {
+		return err
+	}
+	b, err := builder.New()
+	if err != nil {
+		return err
+	}
+	b.SetRetry(retryPol)
+	opts := bench.Options{ContextDir: contextDir, Sort: sortBy}
+	if !skipScan {
+		sc, err := scanner.New()
+		if err != nil {
+			return fmt.Errorf("%w\nInstall trivy or grype, or pass --skip-scan", err)
+		}
+		sc.SetRetry(retryPol)
+		opts.Scan = sc.Scan
+	}
+
+	bold := color.New(color.Bold)
+	if format == "text" {
+		bold.Printf("🏁 Benchmarking %d Dockerfiles...\n\n", len(dockerfiles))
+		opts.OnResult = func(r bench.Result) {
+			if r.Error != "" {
+				color.New(color.FgYellow).Printf("  %s: ⚠ %s\n", r.Dockerfile, r.Error)
+				return
+			}
+			fmt.Printf("  %s: %s, built in %.1fs cold / %.1fs warm\n", r.Dockerfile, docker.HumanSize(r.Size), r.ColdBuild, r.WarmBuild)
+		}
+	}
+
+	build := func(dockerfile, contextDir, tag string, cold bool) (*models.ImageMetrics, error) {
+		if cold {
+			return b.BuildCold(dockerfile, contextDir, tag)
+		}
+		return b.BuildOptimized(dockerfile, contextDir, tag)
+	}
+	report, err := bench.Run(dockerfiles, build, opts)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		return printJSON(report)
+	case "markdown":
+		fmt.Print(report.Markdown())
+		return nil
+	}
+
+	fmt.Println()
+	bold.Printf("🏆 Ranking by %s:\n", report.Sort)
+	fmt.Printf("  %-3s %-32s %10s %9s %7s %8s %8s  %s\n", "#", "DOCKERFILE", "SIZE", "CHANGE", "LAYERS", "COLD", "WARM", "CVES (C/H/M/L)")
+	for _, r := range report.Results {
+		if r.Error != "" {
+			color.New(color.FgYellow).Printf("  %-3d %-32s ⚠ not built or scanned\n", r.Rank, r.Dockerfile)
+			continue
+		}
+		change := "—"
+		if pct, ok := report.SizeChange(r); ok && r.Dockerfile != report.Baseline {
+			change = fmt.Sprintf("%+.1f%%", pct)
+		}
+		cves := "—"
+		if r.Scanned {
+			cves = fmt.Sprintf("%d/%d/%d/%d", r.Critical, r.High, r.Medium, r.Low)
+		}
+		fmt.Printf("  %-3d %-32s %10s %9s %7d %7.1fs %7.1fs  %s\n",
+			r.Rank, r.Dockerfile, docker.HumanSize(r.Size), change, r.Layers, r.ColdBuild, r.WarmBuild, cves)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/git"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- dio run --changed ---
+
+// runChanged runs the pipeline with run on each Dockerfile under root
+// whose file or build context a branch changed since base. The reports of
+// each Dockerfile go to its own directory of outputDir, named after its
+// path. It exits with 1 when a pipeline fails.
+func runChanged(root, base, outputDir string, strict bool, run func(dockerfilePath, outputDir string) (*models.PipelineResult, error)) error {
+	bold := color.New(color.Bold)
+	dockerfiles, err := changedDockerfiles(root, base, outputDir)
+	if err != nil {
+		return err
+	}
+	if len(dockerfiles) == 0 {
+		fmt.Printf("No Dockerfile or build context changed since %s\n", base)
+		return nil
+	}
+	bold.Printf("%d Dockerfile(s) changed since %s:\n", len(dockerfiles), base)
+	for _, path := range dockerfiles {
+		fmt.Printf("  %s\n", path)
+	}
+	fmt.Println()
+
+	failed := 0
+	for _, path := range dockerfiles {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			rel = filepath.Base(path)
+		}
+		result, err := run(path, filepath.Join(outputDir, rel))
+		switch {
+		case err != nil:
+			color.New(color.FgRed).Printf("❌ %s: %v\n", path, err)
+			failed++
+		case pipelineFailed(result, strict):
+			failed++
+		}
+		fmt.Println()
+	}
+	if failed > 0 {
+		color.New(color.FgRed).Printf("❌ %d of %d changed Dockerfile(s) failed\n", failed, len(dockerfiles))
+		exit(1)
+	}
+	color.New(color.FgGreen).Printf("✅ All %d changed Dockerfile(s) passed\n", len(dockerfiles))
+	return nil
+}
+
+// changedDockerfiles returns the Dockerfiles under root that are affected
+// by the changes since base: the Dockerfile itself changed, or a file of
+// its build context that .dockerignore doesn't exclude. The build context
+// is the one of the Bake or Compose file building the Dockerfile, or its
+// directory. Files in outputDir, where reports are written, don't count.
+func changedDockerfiles(root, base, outputDir string) ([]string, error) {
+	changed, err := git.Changed(root, base)
+	if err != nil {
+		return nil, err
+	}
+	reports := resolve(outputDir)
+	dockerfiles, err := findDockerfiles(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var affected []string
+	for _, path := range dockerfiles {
+		abs := resolve(path)
+		contextDir := filepath.Dir(abs)
+		if spec, err := loadBuildSpec(path, "", ""); err == nil && spec != nil {
+			contextDir = resolve(spec.Context)
+		}
+		for _, file := range changed {
+			if within(reports, file) {
+				continue
+			}
+			if file == abs {
+				affected = append(affected, path)
+				break
+			}
+			if !within(contextDir, file) {
+				continue
+			}
+			rel, err := filepath.Rel(contextDir, file)
+			if err == nil && !analyzer.DockerignoreExcludes(contextDir, rel) {
+				affected = append(affected, path)
+				break
+			}
+		}
+	}
+	return affected, nil
+}
+
+// findDockerfiles returns the Dockerfiles and Containerfiles under root,
+// leaving out hidden directories, node_modules and the optimized copies
+// dio writes.
+func findDockerfiles(root string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isDockerfileName(name) && filepath.Base(optimizedPath(path)) != name {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// isDockerfileName reports whether a file name is a Dockerfile's:
+// Dockerfile, Dockerfile.prod, app.Dockerfile, or the same with
+// Containerfile.
+func isDockerfileName(name string) bool {
+	name = strings.ToLower(name)
+	for _, base := range []string{"dockerfile", "containerfile"} {
+		if name == base || strings.HasPrefix(name, base+".") || strings.HasSuffix(name, "."+base) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the absolute path of path with symlinks resolved, as
+// git reports paths, as far as it exists.
+func resolve(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	return path
+}
+
+// within reports whether path is dir or inside it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
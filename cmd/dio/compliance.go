@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/compliance"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/reporter"
+)
+
+// --- compliance command ---
+
+func newComplianceCmd() *cobra.Command {
+	var (
+		outputFormat string
+		report       string
+		target       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "compliance [Dockerfile]",
+		Short: "Map findings to CIS Docker Benchmark and NIST SP 800-190 controls",
+		Long: `Checks the controls of the CIS Docker Benchmark (section 4, container
+images and build files) and NIST SP 800-190 (image countermeasures) that dio
+can assess, and reports which pass, fail or don't apply.
+
+With a Dockerfile, the controls are checked against its analysis. With
+--report, they are checked against a report.json written by dio run, which
+adds the scan and inspection of the built image. --format json exports the
+result for GRC tooling.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 1) == (report != "") {
+				return fmt.Errorf("pass a Dockerfile or --report, not both")
+			}
+			var path string
+			if len(args) == 1 {
+				var err error
+				if path, err = analyzer.FindDockerfile(args[0]); err != nil {
+					return err
+				}
+			}
+			return runCompliance(path, report, target, outputFormat)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format: text, json, markdown")
+	cmd.Flags().StringVar(&report, "report", "", "Check a report.json written by dio run instead of a Dockerfile")
+	cmd.Flags().StringVar(&target, "target", "", "Stage to treat as the final one, like docker build --target (default: the last stage)")
+	return cmd
+}
+
+func runCompliance(dockerfilePath, report, target, format string) error {
+	if err := checkFormat(format, "text", "json", "markdown"); err != nil {
+		return err
+	}
+
+	var result *models.PipelineResult
+	if report != "" {
+		var err error
+		if result, err = reporter.LoadResult(report); err != nil {
+			return err
+		}
+		if result == nil {
+			return fmt.Errorf("report %s not found", report)
+		}
+	} else {
+		a, err := newAnalyzer()
+		if err != nil {
+			return err
+		}
+		a.SetTarget(target)
+		analysis, err := a.Analyze(dockerfilePath)
+		if err != nil {
+			return fmt.Errorf("analysis failed: %w", err)
+		}
+		result = &models.PipelineResult{Timestamp: time.Now(), Dockerfile: dockerfilePath, Analysis: analysis}
+	}
+	c := compliance.Evaluate(result)
+
+	subjectLabel, subject := "Dockerfile", result.Dockerfile
+	if result.Image != "" {
+		subjectLabel, subject = "Image", result.Image
+	}
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	case "markdown":
+		fmt.Print(reporter.ComplianceMarkdown(subjectLabel, subject, c))
+		return nil
+	}
+
+	bold := color.New(color.Bold)
+	green := color.New(color.FgGreen)
+	red := color.New(color.FgRed)
+	dim := color.New(color.Faint)
+
+	bold.Printf("🛡️  Compliance of %s: %d passed, %d failed, %d not applicable\n", subject, c.Passed, c.Failed, c.NotApplicable)
+	framework := ""
+	for _, control := range c.Controls {
+		if control.Framework != framework {
+			framework = control.Framework
+			fmt.Println()
+			bold.Println(compliance.FrameworkNames[framework])
+		}
+		switch control.Status {
+		case models.ControlPass:
+			green.Printf("  ✅ %-6s %s\n", control.ID, control.Title)
+		case models.ControlFail:
+			red.Printf("  ❌ %-6s %s\n", control.ID, control.Title)
+			for _, finding := range control.Findings {
+				fmt.Printf("            %s\n", finding)
+			}
+		default:
+			dim.Printf("  ➖ %-6s %s (%s)\n", control.ID, control.Title, strings.Join(control.Findings, "; "))
+		}
+	}
+	return nil
+}
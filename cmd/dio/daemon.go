@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/daemon"
+	"github.com/maxlar/docker-image-optimizer/internal/fleet"
+	"github.com/maxlar/docker-image-optimizer/internal/history"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- daemon command ---
+
+func newDaemonCmd() *cobra.Command {
+	var (
+		targetsFile  string
+		scheduleExpr string
+		runNow       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Re-run pipelines and fleet scans on a schedule and report regressions",
+		Long: `Runs as a long-lived service: every target in the targets file is re-evaluated
+on its cron schedule (minute hour day-of-month month day-of-week), either
+through the full pipeline (dockerfile targets) or as a fleet scan (fleet
+targets). Results are recorded in the run history, and a target whose policy
+starts failing, gains critical/high CVEs, loses score or grows by more than
+10% since its previous run is reported to the notify webhook.
+
+On SIGINT or SIGTERM the daemon finishes the target it is running and exits.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDaemon(targetsFile, scheduleExpr, runNow)
+		},
+	}
+
+	cmd.Flags().StringVar(&targetsFile, "targets", "targets.yaml", "Targets file listing the Dockerfiles and fleet patterns to evaluate")
+	cmd.Flags().StringVar(&scheduleExpr, "schedule", "", `Cron expression for targets without their own schedule, e.g. "0 3 * * *" (overrides schedule in the targets file)`)
+	cmd.Flags().BoolVar(&runNow, "run-now", false, "Evaluate every target once at startup before waiting for the schedule")
+	return cmd
+}
+
+func runDaemon(targetsFile, scheduleExpr string, runNow bool) error {
+	targets, err := daemon.Load(targetsFile, scheduleExpr)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.LoadOrDefault(configFile)
+	if err != nil {
+		return err
+	}
+	if cfg.History.Enabled != nil && !*cfg.History.Enabled {
+		return fmt.Errorf("dio daemon compares runs through the run history, which is disabled by history.enabled: false")
+	}
+	store, err := historyStore(cfg)
+	if err != nil {
+		return err
+	}
+	notifier := &daemon.Notifier{Webhook: targets.Notify.Webhook}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// A second signal exits right away
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	color.New(color.Bold).Printf("⏰ DIO daemon: %d target(s), history: %s\n", len(targets.Targets), store.Dir)
+	if runNow {
+		for i := range targets.Targets {
+			if ctx.Err() != nil {
+				break
+			}
+			runTarget(&targets.Targets[i], store, notifier)
+		}
+	}
+
+	for {
+		due, next := targets.Due(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("no target is ever scheduled")
+		}
+		names := make([]string, len(due))
+		for i, t := range due {
+			names[i] = t.Name
+		}
+		daemonLog("Next run at %s: %s", next.Format(time.RFC3339), strings.Join(names, ", "))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			daemonLog("Stopping")
+			return nil
+		case <-timer.C:
+		}
+		for _, t := range due {
+			if ctx.Err() != nil {
+				break
+			}
+			runTarget(t, store, notifier)
+		}
+	}
+}
+
+// daemonLog prints a timestamped line, as the daemon's output usually ends
+// up in a service log.
+func daemonLog(format string, args ...interface{}) {
+	fmt.Printf("%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+// runTarget evaluates a target and reports regressions. Errors are logged
+// rather than returned so one broken target doesn't stop the daemon.
+func runTarget(t *daemon.Target, store *history.Store, notifier *daemon.Notifier) {
+	daemonLog("Running %s", t.Name)
+	var err error
+	if t.Fleet != "" {
+		err = runFleetTarget(t, store, notifier)
+	} else {
+		err = runPipelineTarget(t, store, notifier)
+	}
+	if err != nil {
+		color.New(color.FgRed).Printf("%s ❌ %s: %v\n", time.Now().Format(time.RFC3339), t.Name, err)
+		return
+	}
+	daemonLog("Finished %s", t.Name)
+}
+
+func runPipelineTarget(t *daemon.Target, store *history.Store, notifier *daemon.Notifier) error {
+	// executePipeline records the run in the history store
+	result, err := executePipeline(t.Dockerfile, pipelineOptions{
+		Mode:       t.Mode,
+		PolicyFile: t.Policy,
+		Profile:    t.Profile,
+		OutputDir:  t.Output,
+		SkipScan:   t.SkipScan,
+		SkipBuild:  t.SkipBuild,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	run := history.Summarize(history.ID(result), result)
+	checkRegression(t.Name, &run, result, store, notifier)
+	return nil
+}
+
+func runFleetTarget(t *daemon.Target, store *history.Store, notifier *daemon.Notifier) error {
+	p, err := fleet.ParsePattern(t.Fleet)
+	if err != nil {
+		return err
+	}
+	client, err := registryClient("", "")
+	if err != nil {
+		return err
+	}
+	images, err := fleet.Enumerate(client, p)
+	if err != nil {
+		return err
+	}
+	eval, err := imageEvaluator(t.Policy, t.Profile, t.SkipScan, false)
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu      sync.Mutex
+		results []*models.PipelineResult
+	)
+	report, err := fleet.Scan(t.Fleet, images, func(image string) (*models.PipelineResult, error) {
+		result, err := eval(image)
+		if err == nil {
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}
+		return result, err
+	}, fleet.Options{
+		Concurrency: t.Concurrency,
+		Dir:         filepath.Join(t.Output, "images"),
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeFleetReport(report, t.Output); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		run, err := store.Save(result)
+		if err != nil {
+			return err
+		}
+		checkRegression(t.Name, run, result, store, notifier)
+	}
+	failed, errors := report.Counts()
+	daemonLog("%s: %d image(s), %d failing policy, %d not evaluated", t.Name, len(report.Images), failed, errors)
+	return nil
+}
+
+// checkRegression compares a run with the previous run of the same
+// Dockerfile or image and sends a notification if it regressed.
+func checkRegression(target string, run *history.Run, result *models.PipelineResult, store *history.Store, notifier *daemon.Notifier) {
+	prev, err := store.Previous(run)
+	if err != nil || prev == nil {
+		return
+	}
+	prevResult, err := store.Load(prev.ID)
+	if err != nil {
+		return
+	}
+	n := daemon.NewNotification(target, history.Compare(prev.ID, prevResult, run.ID, result))
+	if n == nil {
+		return
+	}
+	color.New(color.FgYellow).Printf("%s ⚠ %s\n", time.Now().Format(time.RFC3339), n.Text)
+	if err := notifier.Notify(n); err != nil {
+		color.New(color.FgRed).Printf("%s ❌ %v\n", time.Now().Format(time.RFC3339), err)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/explain"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/optimizer"
+	"github.com/maxlar/docker-image-optimizer/internal/reporter"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// maxExplainedLayers is how many of the largest layers explain lists.
+const maxExplainedLayers = 5
+
+// --- explain command ---
+
+func newExplainCmd() *cobra.Command {
+	var (
+		base       string
+		input      string
+		format     string
+		outputFile string
+		noPull     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "explain [image]",
+		Short: "Reconstruct an image's Dockerfile from its history and analyze it",
+		Long: `Rebuilds an approximate Dockerfile from the history and config of an image
+whose Dockerfile is lost or third-party, runs the analyzer and the optimizer on
+it and reports what could be improved, with the size of each layer.
+
+The history doesn't name the base image: the entries up to its last CMD or
+ENTRYPOINT are taken to be the base image's. Name it with --base to split the
+history exactly and analyze the FROM line too.
+
+With --input, the image is read from a docker save tarball or an OCI image
+layout instead of the daemon.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			image, err := imageInput(args, input)
+			if err != nil {
+				return err
+			}
+			return runExplain(image, base, format, outputFile, !noPull)
+		},
+	}
+
+	cmd.Flags().StringVar(&base, "base", "", "Base image the image was built FROM")
+	cmd.Flags().StringVar(&input, "input", "", "Read the image from docker-archive:<file> or oci:<dir> instead of the daemon")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text, json, markdown")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Write the reconstructed Dockerfile to this file")
+	cmd.Flags().BoolVar(&noPull, "no-pull", false, "Fail instead of pulling images that are not present locally")
+	return cmd
+}
+
+func runExplain(image, base, format, outputFile string, pull bool) error {
+	if err := checkFormat(format, "text", "json", "markdown"); err != nil {
+		return err
+	}
+	// Archives are read without a daemon
+	client, clientErr := docker.NewClient()
+	history := func(ref string) ([]models.HistoryEntry, error) {
+		if archive, ok := docker.ParseArchive(ref); ok {
+			return archive.History()
+		}
+		if clientErr != nil {
+			return nil, clientErr
+		}
+		if !client.ImageExists(ref) {
+			if !pull {
+				return nil, fmt.Errorf("image %s not found locally (pulling disabled by --no-pull)", ref)
+			}
+			if err := client.Pull(ref); err != nil {
+				return nil, err
+			}
+		}
+		return client.History(ref)
+	}
+
+	entries, err := history(image)
+	if err != nil {
+		return err
+	}
+	var baseHistory []models.HistoryEntry
+	if base != "" {
+		if baseHistory, err = history(base); err != nil {
+			return err
+		}
+	}
+	result := explain.Reconstruct(image, entries, base, baseHistory)
+
+	a, err := newAnalyzer()
+	if err != nil {
+		return err
+	}
+	opt, err := newOptimizer(optimizer.ModeSuggest)
+	if err != nil {
+		return err
+	}
+	var runtime *models.RuntimeConfig
+	if archive, ok := docker.ParseArchive(image); ok {
+		runtime, err = archive.RuntimeConfig()
+	} else {
+		runtime, err = client.RuntimeConfig(image)
+	}
+	if err != nil {
+		color.New(color.FgYellow).Fprintf(os.Stderr, "⚠️  Cannot read the image config: %v\n", err)
+	}
+	if err := explain.Analyze(result, a, opt, runtime); err != nil {
+		return fmt.Errorf("analysis failed: %w", err)
+	}
+
+	if outputFile != "" {
+		if err := os.WriteFile(outputFile, []byte(result.Dockerfile), 0o644); err != nil {
+			return fmt.Errorf("failed to write Dockerfile: %w", err)
+		}
+	}
+
+	switch format {
+	case "json":
+		return printJSON(result)
+	case "markdown":
+		fmt.Print(reporter.ExplainMarkdown(result))
+		return nil
+	}
+
+	bold := color.New(color.Bold)
+	green := color.New(color.FgGreen)
+	bold.Printf("🔎 Reconstructed Dockerfile of %s:\n\n", image)
+	fmt.Println(result.Dockerfile)
+	if base == "" && result.BaseEntries > 0 {
+		fmt.Printf("Base image: %d history entries, %s\n\n", result.BaseEntries, docker.HumanSize(result.BaseSize))
+	}
+
+	layers := append([]models.ExplainedLayer(nil), result.Layers...)
+	sort.SliceStable(layers, func(i, j int) bool { return layers[i].Size > layers[j].Size })
+	if len(layers) > maxExplainedLayers {
+		layers = layers[:maxExplainedLayers]
+	}
+	if len(layers) > 0 {
+		bold.Println("Largest layers:")
+		for _, l := range layers {
+			fmt.Printf("  %8s  line %-3d %s\n", docker.HumanSize(l.Size), l.Line, shortInstruction(l.Instruction))
+		}
+		fmt.Println()
+	}
+
+	analysis := result.Analysis
+	bold.Printf("Score: %d/100\n\n", analysis.Score)
+	if len(analysis.Issues) == 0 {
+		green.Println("✅ No issues found!")
+	} else {
+		bold.Printf("Found %d issue(s):\n\n", len(analysis.Issues))
+		for _, issue := range analysis.Issues {
+			fmt.Printf("  [%s] %s (%s)\n", issue.Severity, issue.Title, issue.ID)
+			if issue.Line > 0 {
+				fmt.Printf("         Line: %d\n", issue.Line)
+			}
+			fmt.Printf("         %s\n", issue.Description)
+			if issue.Suggestion != "" {
+				green.Printf("         💡 %s\n", issue.Suggestion)
+			}
+			fmt.Println()
+		}
+	}
+	if opts := result.Optimizations.Optimizations; len(opts) > 0 {
+		bold.Printf("Optimization opportunities (%d):\n\n", len(opts))
+		for _, o := range opts {
+			fmt.Printf("  💡 [P%d] %s\n", o.Priority, o.Title)
+			fmt.Printf("     %s\n", o.Description)
+			printImpact(o)
+		}
+	}
+	if outputFile != "" {
+		green.Printf("✅ Reconstructed Dockerfile written to: %s\n", outputFile)
+	}
+	return nil
+}
+
+// shortInstruction cuts an instruction to one line of the layer list.
+func shortInstruction(inst string) string {
+	if len(inst) > 80 {
+		return inst[:77] + "..."
+	}
+	return inst
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/fleet"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/registry"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// --- fleet command ---
+
+func newFleetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fleet",
+		Short: "Evaluate every image in a registry namespace",
+	}
+
+	var (
+		policyFile  string
+		profile     string
+		outputDir   string
+		concurrency int
+		resume      bool
+		skipScan    bool
+		keepImages  bool
+		username    string
+		passStdin   bool
+	)
+	scanCmd := &cobra.Command{
+		Use:   "scan [registry/namespace/*[:tag]]",
+		Short: "Inspect, scan and policy-check all matching images and rank them by risk and size",
+		Long: `Lists the repositories and tags matching the pattern through the registry API
+(e.g. registry.corp/team/* for the latest tag of every repository under team/,
+or registry.corp/team/*:v* for all v-tags), evaluates each image like
+dio policy image and writes a fleet report ranking images by risk and size.
+
+Registry credentials are taken from --username/--password-stdin, then
+DIO_REGISTRY_USER and DIO_REGISTRY_PASSWORD, then the docker config and its
+credential helpers; ECR, GCR/Artifact Registry and ACR tokens are obtained
+with the aws, gcloud or az CLI. Per-image results are kept in the output directory, so an interrupted scan
+can be continued with --resume.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, err := readPasswordStdin(username, passStdin)
+			if err != nil {
+				return err
+			}
+			return runFleetScan(args[0], policyFile, profile, outputDir, concurrency, resume, skipScan, keepImages, username, password)
+		},
+	}
+	scanCmd.Flags().StringVarP(&policyFile, "policy", "p", "", "Path, https:// URL, or oci:// reference of the policy YAML file")
+	scanCmd.Flags().StringVar(&profile, "profile", "", "Policy profile to apply (e.g., dev, staging, prod)")
+	scanCmd.Flags().StringVarP(&outputDir, "output", "o", "fleet-reports", "Output directory for the fleet report and per-image results")
+	scanCmd.Flags().IntVarP(&concurrency, "concurrency", "c", 4, "Number of images evaluated at once")
+	scanCmd.Flags().BoolVar(&resume, "resume", false, "Reuse per-image results from an interrupted scan in the output directory")
+	scanCmd.Flags().BoolVar(&skipScan, "skip-scan", false, "Skip security scanning (CVE rules are not evaluated)")
+	scanCmd.Flags().BoolVar(&keepImages, "keep-images", false, "Keep pulled images instead of removing them after evaluation")
+	scanCmd.Flags().StringVarP(&username, "username", "u", "", "Registry username (overrides DIO_REGISTRY_USER and the docker config)")
+	scanCmd.Flags().BoolVar(&passStdin, "password-stdin", false, "Read the registry password or token from stdin")
+	cmd.AddCommand(scanCmd)
+
+	return cmd
+}
+
+func runFleetScan(pattern, policyFile, profile, outputDir string, concurrency int, resume, skipScan, keepImages bool, username, password string) error {
+	bold := color.New(color.Bold)
+	green := color.New(color.FgGreen)
+	red := color.New(color.FgRed)
+	yellow := color.New(color.FgYellow)
+
+	p, err := fleet.ParsePattern(pattern)
+	if err != nil {
+		return err
+	}
+	client, err := registryClient(username, password)
+	if err != nil {
+		return err
+	}
+	eval, err := imageEvaluator(policyFile, profile, skipScan, keepImages)
+	if err != nil {
+		return err
+	}
+
+	bold.Println("🚢 Fleet scan:", p)
+	images, err := fleet.Enumerate(client, p)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  %d image(s) found\n\n", len(images))
+	if len(images) == 0 {
+		return nil
+	}
+
+	done := 0
+	report, err := fleet.Scan(pattern, images, eval, fleet.Options{
+		Concurrency: concurrency,
+		Dir:         filepath.Join(outputDir, "images"),
+		Resume:      resume,
+		OnEntry: func(e fleet.Entry) {
+			done++
+			prefix := fmt.Sprintf("  [%d/%d] %s", done, len(images), e.Image)
+			switch {
+			case e.Error != "":
+				yellow.Printf("%s: ⚠ %s\n", prefix, e.Error)
+			case e.Resumed:
+				fmt.Printf("%s: risk %d (from previous scan)\n", prefix, e.Risk)
+			case e.PolicyPassed:
+				green.Printf("%s: risk %d ✅\n", prefix, e.Risk)
+			default:
+				red.Printf("%s: risk %d ❌\n", prefix, e.Risk)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFleetReport(report, outputDir); err != nil {
+		return err
+	}
+
+	failed, errors := report.Counts()
+	fmt.Println()
+	bold.Println("🏆 Riskiest images:")
+	for i, e := range report.Images {
+		if i == 5 || e.Error != "" {
+			break
+		}
+		fmt.Printf("  %d. %s — risk %d, %s, %d critical / %d high\n",
+			i+1, e.Image, e.Risk, docker.HumanSize(e.Size), e.Critical, e.High)
+	}
+	fmt.Printf("\n  Reports written to: %s/\n", outputDir)
+	fmt.Printf("  %d image(s), %d failing policy, %d not evaluated\n", len(report.Images), failed, errors)
+	return nil
+}
+
+// writeFleetReport writes fleet-report.json and fleet-report.md.
+func writeFleetReport(report *fleet.Report, outputDir string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "fleet-report.json"), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write fleet report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "fleet-report.md"), []byte(report.Markdown()), 0o644); err != nil {
+		return fmt.Errorf("failed to write fleet report: %w", err)
+	}
+	return nil
+}
+
+// registryClient returns a registry client authenticated with the given
+// username and password, or DIO_REGISTRY_USER and DIO_REGISTRY_PASSWORD,
+// and otherwise with credentials from the keychain, using the registry
+// and retry settings of .dio.yaml.
+func registryClient(username, password string) (*registry.Client, error) {
+	cfg, err := config.LoadOrDefault(configFile)
+	if err != nil {
+		return nil, err
+	}
+	retryPol, err := retryPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if username == "" {
+		username, password = os.Getenv("DIO_REGISTRY_USER"), os.Getenv("DIO_REGISTRY_PASSWORD")
+	}
+	return &registry.Client{
+		Username: username,
+		Password: password,
+		Keychain: registry.DefaultKeychain(cfg.Registry.DockerConfig),
+		TLS:      registryTLS(cfg.Registry),
+		Retry:    retryPol,
+	}, nil
+}
+
+// registryTLS converts the TLS settings of the registry section of .dio.yaml.
+func registryTLS(cfg config.RegistryConfig) registry.TLSOptions {
+	return registry.TLSOptions{CAFile: cfg.CAFile, CertsDir: cfg.CertsDir, Insecure: cfg.Insecure}
+}
+
+// readPasswordStdin reads a password piped to --password-stdin, like
+// docker login does.
+func readPasswordStdin(username string, passwordStdin bool) (string, error) {
+	if !passwordStdin {
+		return "", nil
+	}
+	if username == "" {
+		return "", fmt.Errorf("--password-stdin requires --username")
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password from stdin: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// imageEvaluator returns the fleet evaluator: evaluateImage against the
+// policy, removing images it pulled unless keepImages is set.
+func imageEvaluator(policyFile, profile string, skipScan, keepImages bool) (fleet.Evaluator, error) {
+	config, err := loadPolicy(policyFile, profile)
+	if err != nil {
+		return nil, err
+	}
+	dockerClient, err := docker.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// Images are evaluated concurrently, so per-image progress is dropped
+	// in favor of one line per completed image
+	quiet := func(string, ...interface{}) {}
+	return func(image string) (*models.PipelineResult, error) {
+		present := dockerClient.ImageExists(image)
+		result, err := evaluateImage(image, config, true, skipScan, quiet, quiet)
+		if !present && !keepImages {
+			_ = dockerClient.RemoveImage(image)
+		}
+		return result, err
+	}, nil
+}
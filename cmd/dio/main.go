@@ -5,9 +5,12 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,11 +19,22 @@ import (
 
 	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
 	"github.com/maxlar/docker-image-optimizer/internal/builder"
+	"github.com/maxlar/docker-image-optimizer/internal/buildspec"
+	"github.com/maxlar/docker-image-optimizer/internal/compliance"
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/cost"
+	"github.com/maxlar/docker-image-optimizer/internal/footprint"
+	"github.com/maxlar/docker-image-optimizer/internal/git"
 	"github.com/maxlar/docker-image-optimizer/internal/models"
 	"github.com/maxlar/docker-image-optimizer/internal/optimizer"
 	"github.com/maxlar/docker-image-optimizer/internal/policy"
+	"github.com/maxlar/docker-image-optimizer/internal/progress"
+	"github.com/maxlar/docker-image-optimizer/internal/registry"
 	"github.com/maxlar/docker-image-optimizer/internal/reporter"
+	"github.com/maxlar/docker-image-optimizer/internal/retry"
 	"github.com/maxlar/docker-image-optimizer/internal/scanner"
+	"github.com/maxlar/docker-image-optimizer/internal/slim"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
 )
 
 var (
@@ -28,86 +42,362 @@ var (
 	commit  = "dev"
 )
 
+var (
+	// configFile is the path to the .dio.yaml configuration, set by the --config flag.
+	configFile string
+	// ruleset overrides the analyzer ruleset from the config file.
+	ruleset string
+	// noAnalysisCache disables the on-disk analysis cache.
+	noAnalysisCache bool
+	// verbose shows details such as hadolint merge decisions and retries.
+	verbose bool
+	// threshold overrides the severity threshold from the config file.
+	threshold string
+)
+
 func main() {
 	root := &cobra.Command{
 		Use:     "dio",
 		Short:   "Docker Image Optimizer — lint, scan, optimize, enforce",
 		Long:    `DIO is an automated pipeline that analyzes Docker images, suggests optimizations, reduces image sizes, and enforces security best practices.`,
 		Version: fmt.Sprintf("%s (%s)", version, commit),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return startProfiling()
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			printUpdateNotice(cmd)
+		},
 	}
 
+	root.PersistentFlags().StringVar(&configFile, "config", "", "Path to DIO config file (default: ./.dio.yaml if present)")
+	root.PersistentFlags().StringVar(&ruleset, "ruleset", "", "Analyzer ruleset: default or extended (adds native hadolint checks)")
+	root.PersistentFlags().BoolVar(&noAnalysisCache, "no-analysis-cache", false, "Re-analyze Dockerfiles instead of reusing cached results")
+	root.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show details such as hadolint merge/dedup decisions, artifacts copied between stages and retried commands")
+	root.PersistentFlags().StringVar(&pprofDir, "pprof", "", "Write CPU and heap profiles of DIO itself (cpu.pprof, heap.pprof) to this directory, for go tool pprof")
+	root.PersistentFlags().StringVar(&threshold, "threshold", "", "Lowest severity that counts toward the score, dio scan failures and policy CVE rules: critical, high, medium, low or info")
+
 	root.AddCommand(
 		newAnalyzeCmd(),
 		newOptimizeCmd(),
 		newScanCmd(),
+		newExplainCmd(),
 		newPolicyCmd(),
 		newRunCmd(),
+		newRulesCmd(),
+		newComplianceCmd(),
+		newBadgeCmd(),
+		newTicketsCmd(),
+		newUpdateCmd(),
+		newSelfUpdateCmd(),
+		newServeCmd(),
+		newFleetCmd(),
+		newDaemonCmd(),
+		newSlimCmd(),
+		newBenchCmd(),
+		newStrategyCmd(),
+		newValidateCmd(),
 	)
 
 	if err := root.Execute(); err != nil {
-		os.Exit(1)
+		exit(1)
+	}
+	stopProfiling()
+}
+
+// newOptimizer creates an optimizer with the strategies enabled in the DIO
+// config file.
+func newOptimizer(mode optimizer.Mode) (*optimizer.Optimizer, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return optimizer.NewWithConfig(mode, cfg)
+}
+
+// optimizedPath returns where the optimized copy of a Dockerfile is
+// written: Dockerfile.optimized, or Containerfile.optimized next to a
+// Containerfile.
+func optimizedPath(dockerfilePath string) string {
+	name := "Dockerfile.optimized"
+	if analyzer.IsContainerfile(dockerfilePath) {
+		name = "Containerfile.optimized"
+	}
+	return filepath.Join(filepath.Dir(dockerfilePath), name)
+}
+
+// loadConfig loads the DIO config file, with the ruleset and threshold
+// overridden by --ruleset and --threshold.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.LoadOrDefault(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if ruleset != "" {
+		cfg.Analyzer.Ruleset = ruleset
+	}
+	if threshold != "" {
+		cfg.Threshold = threshold
+	}
+	return cfg, nil
+}
+
+// newAnalyzer creates an analyzer configured from the DIO config file.
+func newAnalyzer() (*analyzer.Analyzer, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	a, err := analyzer.NewWithConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !noAnalysisCache && (cfg.Analyzer.Cache == nil || *cfg.Analyzer.Cache) {
+		dir := cfg.Analyzer.CacheDir
+		if dir == "" {
+			// Without a home directory, analyze without caching
+			dir, _ = analyzer.DefaultCacheDir()
+		}
+		if dir != "" {
+			a.SetCache(&analyzer.Cache{Dir: dir})
+		}
+	}
+	return a, nil
+}
+
+// severityThreshold returns the severity threshold of the DIO config file,
+// overridden by --threshold. It is empty when neither sets one.
+func severityThreshold() (models.Severity, error) {
+	cfg, err := config.LoadOrDefault(configFile)
+	if err != nil {
+		return "", err
+	}
+	value := cfg.Threshold
+	if threshold != "" {
+		value = threshold
+	}
+	if value == "" {
+		return "", nil
+	}
+	sev, err := models.ParseSeverity(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid threshold: %w", err)
+	}
+	return sev, nil
+}
+
+// parseSeverities validates the severities of --severity and normalizes
+// their case.
+func parseSeverities(values []string) ([]string, error) {
+	severities := make([]string, 0, len(values))
+	for _, v := range values {
+		sev, err := models.ParseSeverity(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --severity: %w", err)
+		}
+		severities = append(severities, string(sev))
+	}
+	return severities, nil
+}
+
+// retryPolicy returns the retry settings of the DIO config file. With
+// --verbose, each retry is logged to stderr.
+func retryPolicy() (retry.Policy, error) {
+	cfg, err := config.LoadOrDefault(configFile)
+	if err != nil {
+		return retry.Policy{}, err
+	}
+	policy := retry.Default()
+	if cfg.Retry.Attempts > 0 {
+		policy.Attempts = cfg.Retry.Attempts
+	}
+	if cfg.Retry.Delay != "" {
+		if policy.Delay, err = time.ParseDuration(cfg.Retry.Delay); err != nil {
+			return retry.Policy{}, fmt.Errorf("invalid retry.delay %q: %w", cfg.Retry.Delay, err)
+		}
+	}
+	if cfg.Retry.MaxDelay != "" {
+		if policy.MaxDelay, err = time.ParseDuration(cfg.Retry.MaxDelay); err != nil {
+			return retry.Policy{}, fmt.Errorf("invalid retry.max_delay %q: %w", cfg.Retry.MaxDelay, err)
+		}
+	}
+	if verbose {
+		policy.Log = func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, "  ↻ "+format+"\n", args...)
+		}
 	}
+	return policy, nil
 }
 
 // --- analyze command ---
 
 func newAnalyzeCmd() *cobra.Command {
-	var outputFormat string
+	var (
+		outputFormat string
+		filter       analyzer.IssueFilter
+		buildArgs    []string
+		target       string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "analyze [Dockerfile]",
 		Short: "Analyze a Dockerfile for issues and best practices",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			dockerfilePath := args[0]
-			return runAnalyze(dockerfilePath, outputFormat)
+			dockerfilePath, err := analyzer.FindDockerfile(args[0])
+			if err != nil {
+				return err
+			}
+			if filter.Threshold, err = severityThreshold(); err != nil {
+				return err
+			}
+			if filter.Severities, err = parseSeverities(filter.Severities); err != nil {
+				return err
+			}
+			return runAnalyze(dockerfilePath, outputFormat, verbose, filter, parseBuildArgs(buildArgs), target)
 		},
 	}
 
-	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format: text, json, markdown")
+	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format: text, json, markdown, csv")
+	cmd.Flags().StringSliceVar(&filter.Severities, "severity", nil, "Only show issues with these severities (e.g., high,critical)")
+	// --severity predates --threshold; it keeps working as an exact filter
+	_ = cmd.Flags().MarkDeprecated("severity", "use --threshold to show and score issues at or above a severity")
+	cmd.Flags().StringSliceVar(&filter.Categories, "category", nil, "Only show issues in these categories (e.g., security)")
+	cmd.Flags().StringSliceVar(&filter.RuleIDs, "rule", nil, "Only show issues from these rules (e.g., DIO001,DIO006)")
+	cmd.Flags().IntVar(&filter.MaxIssues, "max-issues", 0, "Show at most N issues (0 = unlimited)")
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "Build argument used to resolve ARGs in FROM (KEY=VALUE, repeatable)")
+	cmd.Flags().StringVar(&target, "target", "", "Stage to treat as the final one, like docker build --target (default: the last stage)")
 	return cmd
 }
 
-func runAnalyze(dockerfilePath, format string) error {
+// parseBuildArgs converts KEY=VALUE flags into a map. Like docker build, a
+// bare KEY takes its value from the environment and is skipped if unset.
+func parseBuildArgs(values []string) map[string]string {
+	args := make(map[string]string)
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok {
+			if value, ok = os.LookupEnv(key); !ok {
+				continue
+			}
+		}
+		args[key] = value
+	}
+	return args
+}
+
+func runAnalyze(dockerfilePath, format string, verbose bool, filter analyzer.IssueFilter, buildArgs map[string]string, target string) error {
 	bold := color.New(color.Bold)
 	green := color.New(color.FgGreen)
 	yellow := color.New(color.FgYellow)
 	red := color.New(color.FgRed)
 
-	bold.Println("🔍 Analyzing Dockerfile:", dockerfilePath)
-	fmt.Println()
+	if err := checkFormat(format, "text", "json", "markdown", "csv"); err != nil {
+		return err
+	}
+	if format == "text" {
+		bold.Println("🔍 Analyzing Dockerfile:", dockerfilePath)
+		fmt.Println()
+	}
 
-	a := analyzer.New()
+	a, err := newAnalyzer()
+	if err != nil {
+		return err
+	}
+	a.SetBuildArgs(buildArgs)
+	a.SetTarget(target)
 	result, err := a.Analyze(dockerfilePath)
 	if err != nil {
 		return fmt.Errorf("analysis failed: %w", err)
 	}
 
-	if format == "json" {
+	// Mark the issues that dio optimize --mode autofix would fix
+	opt, err := newOptimizer(optimizer.ModeSuggest)
+	if err != nil {
+		return err
+	}
+	opt.SetBuildArgs(buildArgs)
+	opt.SetTarget(target)
+	optResult, err := opt.OptimizeAnalyzed(dockerfilePath, result)
+	if err != nil {
+		return fmt.Errorf("optimization failed: %w", err)
+	}
+	optimizer.LinkIssues(result, optResult.Optimizations)
+
+	// Filters only affect what is shown; the score still reflects all issues
+	// at or above the threshold.
+	totalIssues := len(result.Issues)
+	shown, filteredOut := filter.Apply(result.Issues)
+
+	switch format {
+	case "json":
+		filtered := *result
+		filtered.Issues = shown
+		filtered.FilteredOut = filteredOut
 		rep := reporter.New(".")
 		output, err := rep.Generate(&models.PipelineResult{
 			Timestamp:  time.Now(),
 			Dockerfile: dockerfilePath,
-			Analysis:   result,
+			Analysis:   &filtered,
 		}, reporter.FormatJSON)
 		if err != nil {
 			return err
 		}
 		fmt.Println(output)
 		return nil
+	case "markdown":
+		filtered := *result
+		filtered.Issues = shown
+		fmt.Print(reporter.AnalysisMarkdown(&filtered))
+		return nil
+	case "csv":
+		filtered := *result
+		filtered.Issues = shown
+		output, err := reporter.AnalysisCSV(&filtered)
+		if err != nil {
+			return err
+		}
+		fmt.Print(output)
+		return nil
 	}
 
 	// Text output
-	bold.Printf("Score: %d/100\n\n", result.Score)
+	bold.Printf("Score: %d/100\n", result.Score)
+	if result.ImageKind != "" && len(result.ImageKindReasons) > 0 {
+		fmt.Printf("Image kind: %s (detected: %s)\n", result.ImageKind, strings.Join(result.ImageKindReasons, ", "))
+	} else if result.ImageKind != "" {
+		fmt.Printf("Image kind: %s\n", result.ImageKind)
+	}
+	fmt.Println()
+
+	if verbose {
+		printMergeDecisions("Hadolint", result.HadolintDecisions)
+		if len(result.BuildCheckDecisions) > 0 {
+			printMergeDecisions("Build check", result.BuildCheckDecisions)
+		}
+		if len(result.TrivyDecisions) > 0 {
+			printMergeDecisions("Trivy", result.TrivyDecisions)
+		}
+		printArtifacts(result.Artifacts)
+	}
 
-	if len(result.Issues) == 0 {
+	if totalIssues == 0 {
 		green.Println("✅ No issues found!")
 		return nil
 	}
 
-	bold.Printf("Found %d issue(s):\n\n", len(result.Issues))
+	if len(shown) == 0 {
+		green.Printf("✅ No matching issues (%d filtered out)\n", filteredOut)
+		return nil
+	}
+
+	if filteredOut > 0 {
+		bold.Printf("Found %d issue(s), showing %d (%d filtered out):\n\n", totalIssues, len(shown), filteredOut)
+	} else {
+		bold.Printf("Found %d issue(s):\n\n", totalIssues)
+	}
 
-	for _, issue := range result.Issues {
+	for _, issue := range shown {
 		var c *color.Color
 		switch issue.Severity {
 		case models.SeverityCritical:
@@ -122,26 +412,116 @@ func runAnalyze(dockerfilePath, format string) error {
 			c = color.New(color.FgWhite)
 		}
 
-		c.Printf("  [%s] %s (%s)\n", issue.Severity, issue.Title, issue.ID)
-		if issue.Line > 0 {
+		sev := string(issue.Severity)
+		if issue.DefaultSeverity != "" {
+			sev += ", was " + string(issue.DefaultSeverity)
+		}
+		c.Printf("  [%s] %s (%s)\n", sev, issue.Title, issue.ID)
+		if issue.Line > 0 && len(result.Stages) > 1 {
+			fmt.Printf("         Line: %d (stage: %s)\n", issue.Line, issue.Stage)
+		} else if issue.Line > 0 {
 			fmt.Printf("         Line: %d\n", issue.Line)
 		}
 		fmt.Printf("         %s\n", issue.Description)
 		if issue.Suggestion != "" {
 			green.Printf("         💡 %s\n", issue.Suggestion)
 		}
+		if issue.FixedByOptimization != "" {
+			fmt.Printf("         🔧 Autofix: %s\n", issue.FixedByOptimization)
+		}
 		fmt.Println()
 	}
 
 	return nil
 }
 
+// checkFormat validates an --format value against the formats a command
+// supports.
+func checkFormat(format string, supported ...string) error {
+	for _, f := range supported {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported format %q (use %s)", format, strings.Join(supported, ", "))
+}
+
+// imageInput returns the image a command reads: its image argument, or the
+// archive named by --input, docker-archive:<file> or oci:<dir>.
+func imageInput(args []string, input string) (string, error) {
+	switch {
+	case input == "" && len(args) == 1:
+		return args[0], nil
+	case input == "":
+		return "", fmt.Errorf("requires an image or --input")
+	case len(args) > 0:
+		return "", fmt.Errorf("give either an image or --input, not both")
+	}
+	if _, ok := docker.ParseArchive(input); !ok {
+		return "", fmt.Errorf("invalid --input %q (use docker-archive:<file> or oci:<dir>)", input)
+	}
+	return input, nil
+}
+
+// printJSON prints a value as indented JSON.
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// printMergeDecisions lists which findings of an external source, hadolint,
+// docker build --check or trivy, were kept or dropped as duplicates of
+// other rules.
+func printMergeDecisions(source string, decisions []models.HadolintDecision) {
+	if len(decisions) == 0 {
+		fmt.Printf("%s: no findings merged\n", source)
+		fmt.Println()
+		return
+	}
+
+	color.New(color.Bold).Printf("%s merge decisions:\n", source)
+	for _, d := range decisions {
+		status := "kept"
+		if !d.Kept {
+			status = "dropped"
+		}
+		fmt.Printf("  %-7s %s (line %d): %s\n", status, d.Code, d.Line, d.Reason)
+	}
+	fmt.Println()
+}
+
+// printArtifacts lists the COPY --from copies between build stages and
+// whether they reach the final image.
+func printArtifacts(artifacts []models.StageArtifact) {
+	if len(artifacts) == 0 {
+		return
+	}
+	color.New(color.Bold).Println("Artifacts copied between stages:")
+	for _, a := range artifacts {
+		status := "final"
+		if !a.ReachesFinal {
+			status = "unused"
+		}
+		fmt.Printf("  %-6s %s → %s (line %d): %s → %s\n", status, a.From, a.To, a.Line, strings.Join(a.Sources, " "), a.Dest)
+	}
+	fmt.Println()
+}
+
 // --- optimize command ---
 
 func newOptimizeCmd() *cobra.Command {
 	var (
-		mode       string
-		outputFile string
+		mode         string
+		outputFile   string
+		outputFormat string
+		buildArgs    []string
+		target       string
+		writeIgnore  bool
+		buildCheck   bool
 	)
 
 	cmd := &cobra.Command{
@@ -149,33 +529,79 @@ func newOptimizeCmd() *cobra.Command {
 		Short: "Optimize a Dockerfile for size, speed, and security",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runOptimize(args[0], mode, outputFile)
+			dockerfilePath, err := analyzer.FindDockerfile(args[0])
+			if err != nil {
+				return err
+			}
+			return runOptimize(dockerfilePath, mode, outputFile, outputFormat, parseBuildArgs(buildArgs), target, writeIgnore, buildCheck)
 		},
 	}
 
 	cmd.Flags().StringVarP(&mode, "mode", "m", "suggest", "Mode: suggest or autofix")
 	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file for optimized Dockerfile (autofix mode)")
+	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format: text, json, markdown")
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "Build argument used to resolve ARGs in FROM (KEY=VALUE, repeatable)")
+	cmd.Flags().StringVar(&target, "target", "", "Stage to treat as the final one, like docker build --target (default: the last stage)")
+	cmd.Flags().BoolVar(&writeIgnore, "write-dockerignore", false, "In autofix mode, generate a .dockerignore next to the Dockerfile if there is none")
+	cmd.Flags().BoolVar(&buildCheck, "check", false, "In autofix mode, also reject fixes that fail docker build --check")
 	return cmd
 }
 
-func runOptimize(dockerfilePath, mode, outputFile string) error {
+func runOptimize(dockerfilePath, mode, outputFile, format string, buildArgs map[string]string, target string, writeDockerignore, buildCheck bool) error {
 	bold := color.New(color.Bold)
 	green := color.New(color.FgGreen)
 
-	bold.Println("⚡ Optimizing Dockerfile:", dockerfilePath)
-	fmt.Println()
+	if err := checkFormat(format, "text", "json", "markdown"); err != nil {
+		return err
+	}
+	if format == "text" {
+		bold.Println("⚡ Optimizing Dockerfile:", dockerfilePath)
+		fmt.Println()
+	}
 
 	optMode := optimizer.ModeSuggest
 	if mode == "autofix" {
 		optMode = optimizer.ModeAutoFix
 	}
 
-	opt := optimizer.New(optMode)
+	opt, err := newOptimizer(optMode)
+	if err != nil {
+		return err
+	}
+	opt.SetBuildArgs(buildArgs)
+	opt.SetTarget(target)
+	opt.SetWriteDockerignore(writeDockerignore)
+	if buildCheck && optMode == optimizer.ModeAutoFix {
+		check, err := dockerBuildCheck(dockerfilePath)
+		if err != nil {
+			return err
+		}
+		opt.SetBuildCheck(check)
+	}
 	result, err := opt.Optimize(dockerfilePath)
 	if err != nil {
 		return fmt.Errorf("optimization failed: %w", err)
 	}
 
+	if optMode == optimizer.ModeAutoFix && result.OptimizedDockerfile != result.OriginalDockerfile {
+		if outputFile == "" {
+			outputFile = optimizedPath(dockerfilePath)
+		}
+		if err := opt.WriteOptimized(result, outputFile); err != nil {
+			return fmt.Errorf("failed to write optimized Dockerfile: %w", err)
+		}
+	} else {
+		outputFile = ""
+	}
+
+	switch format {
+	case "json":
+		return printJSON(result)
+	case "markdown":
+		fmt.Print(reporter.OptimizationMarkdown(dockerfilePath, result))
+		return nil
+	}
+
 	if len(result.Optimizations) == 0 {
 		green.Println("✅ No optimizations needed!")
 		return nil
@@ -190,112 +616,345 @@ func runOptimize(dockerfilePath, mode, outputFile string) error {
 		}
 		fmt.Printf("  %s [P%d] %s\n", status, o.Priority, o.Title)
 		fmt.Printf("     %s\n", o.Description)
-		fmt.Printf("     Impact: %s\n\n", o.Impact)
-	}
-
-	if optMode == optimizer.ModeAutoFix && result.OptimizedDockerfile != result.OriginalDockerfile {
-		if outputFile == "" {
-			dir := filepath.Dir(dockerfilePath)
-			outputFile = filepath.Join(dir, "Dockerfile.optimized")
+		if len(o.RelatedIssueIDs) > 0 {
+			fmt.Printf("     Fixes: %s\n", strings.Join(o.RelatedIssueIDs, ", "))
 		}
-
-		if err := opt.WriteOptimized(result, outputFile); err != nil {
-			return fmt.Errorf("failed to write optimized Dockerfile: %w", err)
+		if o.Rejected != "" {
+			color.New(color.FgYellow).Printf("     ⚠️  Not applied, the fix produced an invalid Dockerfile: %s\n", o.Rejected)
 		}
+		printImpact(o)
+	}
+
+	if outputFile != "" {
 		green.Printf("✅ Optimized Dockerfile written to: %s\n", outputFile)
 		fmt.Printf("   Estimated reduction: %s\n", result.EstimatedReduction)
 	}
+	if result.Dockerignore != "" {
+		green.Printf("✅ %s written to: %s\n", filepath.Base(result.Dockerignore), result.Dockerignore)
+	}
 
 	return nil
 }
 
+// dockerBuildCheck returns a check running docker build --check in the
+// directory of the Dockerfile. It fails when docker can't run the checks
+// or the Dockerfile already fails them, as no fix could pass them then.
+func dockerBuildCheck(dockerfilePath string) (func(string) error, error) {
+	client, err := docker.NewClient()
+	if err != nil {
+		return nil, fmt.Errorf("--check: %w", err)
+	}
+	content, err := os.ReadFile(dockerfilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Dockerfile: %w", err)
+	}
+	dir := filepath.Dir(dockerfilePath)
+	if err := client.BuildCheck(string(content), dir); err != nil {
+		return nil, fmt.Errorf("--check: %s fails docker build --check: %w", dockerfilePath, err)
+	}
+	return func(dockerfile string) error {
+		if err := client.BuildCheck(dockerfile, dir); err != nil {
+			return fmt.Errorf("docker build --check: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// printImpact prints the impact of an optimization and how likely it is
+// to build unchanged, warning about those that often don't.
+func printImpact(o models.Optimization) {
+	fmt.Printf("     Impact: %s\n", o.Impact)
+	if o.Confidence == models.ConfidenceLow {
+		color.New(color.FgYellow).Println("     ⚠️  Low confidence: this change often breaks the build, review and test it")
+	} else if o.Confidence != "" {
+		fmt.Printf("     Confidence: %s\n", o.Confidence)
+	}
+	fmt.Println()
+}
+
 // --- scan command ---
 
 func newScanCmd() *cobra.Command {
-	var scannerType string
+	var (
+		scannerType  string
+		outputFormat string
+		input        string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "scan [image]",
 		Short: "Scan a Docker image for security vulnerabilities",
-		Args:  cobra.ExactArgs(1),
+		Long: `Scans an image with trivy or grype. With a severity threshold, from
+--threshold or threshold in .dio.yaml, the vulnerabilities at or above it
+are listed and the command exits with status 1 when there are any.
+Without one, critical and high vulnerabilities are listed and the exit
+status doesn't depend on the findings.
+
+With --input, the image is read from a docker save tarball
+(docker-archive:app.tar) or an OCI image layout (oci:./image-dir), without
+a daemon or registry.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runScan(args[0], scannerType)
+			imageRef, err := imageInput(args, input)
+			if err != nil {
+				return err
+			}
+			return runScan(imageRef, scannerType, outputFormat)
 		},
 	}
 
 	cmd.Flags().StringVarP(&scannerType, "scanner", "s", "auto", "Scanner: trivy, grype, or auto")
+	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format: text, json, markdown, csv")
+	cmd.Flags().StringVar(&input, "input", "", "Read the image from docker-archive:<file> or oci:<dir> instead of the daemon")
 	return cmd
 }
 
-func runScan(imageRef, scannerType string) error {
+func runScan(imageRef, scannerType, format string) error {
+	bold := color.New(color.Bold)
+
+	if err := checkFormat(format, "text", "json", "markdown", "csv"); err != nil {
+		return err
+	}
+	threshold, err := severityThreshold()
+	if err != nil {
+		return err
+	}
+	if format == "text" {
+		bold.Println("🔒 Scanning image:", imageRef)
+		fmt.Println()
+	}
+
+	var sc *scanner.Scanner
+	if scannerType == "auto" {
+		sc, err = scanner.New()
+	} else {
+		sc, err = scanner.NewWithScanner(scanner.ScannerType(scannerType))
+	}
+	if err != nil {
+		return fmt.Errorf("%w\nInstall trivy: https://aquasecurity.github.io/trivy/\nInstall grype: https://github.com/anchore/grype", err)
+	}
+	retryPol, err := retryPolicy()
+	if err != nil {
+		return err
+	}
+	sc.SetRetry(retryPol)
+
+	result, err := sc.Scan(imageRef)
+	if err != nil {
+		return fmt.Errorf("scan failed: %w", err)
+	}
+
+	// Count what fails the scan before printing, so that every format
+	// gets the same exit status
+	failed := 0
+	if threshold != "" {
+		for _, v := range result.Vulnerabilities {
+			if v.Severity.AtLeast(threshold) {
+				failed++
+			}
+		}
+	}
+
+	switch format {
+	case "json":
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	case "markdown":
+		fmt.Print(reporter.ScanMarkdown(result))
+	case "csv":
+		output, err := reporter.ScanCSV(result)
+		if err != nil {
+			return err
+		}
+		fmt.Print(output)
+	default:
+		printScanText(result, threshold)
+		if failed > 0 {
+			fmt.Println()
+			color.New(color.FgRed).Printf("❌ %d vulnerabilities at or above the %s threshold\n", failed, threshold)
+		}
+	}
+
+	if failed > 0 {
+		exit(1)
+	}
+	return nil
+}
+
+// printScanText prints the vulnerability counts and lists the
+// vulnerabilities at or above the threshold, or the critical and high ones
+// without a threshold.
+func printScanText(result *models.ScanResult, threshold models.Severity) {
 	bold := color.New(color.Bold)
 	red := color.New(color.FgRed)
 	yellow := color.New(color.FgYellow)
 	green := color.New(color.FgGreen)
 
-	bold.Println("🔒 Scanning image:", imageRef)
-	fmt.Println()
-
-	// Import scanner package dynamically to avoid the import if not used
-	// For now, just show that the scan would happen
-	_ = red
-	_ = yellow
-	_ = green
-
-	fmt.Println("Security scanning requires trivy or grype to be installed.")
-	fmt.Println("Install trivy: https://aquasecurity.github.io/trivy/")
-	fmt.Println("Install grype: https://github.com/anchore/grype")
+	bold.Printf("Scanner: %s\n\n", result.Scanner)
+	red.Printf("  Critical: %d\n", result.CriticalCount)
+	color.New(color.FgHiRed).Printf("  High:     %d\n", result.HighCount)
+	yellow.Printf("  Medium:   %d\n", result.MediumCount)
+	color.New(color.FgCyan).Printf("  Low:      %d\n", result.LowCount)
 	fmt.Println()
-	fmt.Printf("To scan manually:\n")
-	fmt.Printf("  trivy image %s\n", imageRef)
-	fmt.Printf("  grype %s\n", imageRef)
 
-	return nil
+	if len(result.Vulnerabilities) == 0 {
+		green.Println("✅ No vulnerabilities found!")
+		return
+	}
+	if threshold == "" {
+		threshold = models.SeverityHigh
+	}
+	for _, v := range result.Vulnerabilities {
+		if !v.Severity.AtLeast(threshold) {
+			continue
+		}
+		fixed := "no fix"
+		if v.FixedVersion != "" {
+			fixed = "fixed in " + v.FixedVersion
+		}
+		fmt.Printf("  [%s] %s %s@%s (%s)\n", v.Severity, v.ID, v.Package, v.Version, fixed)
+	}
 }
 
 // --- policy command ---
 
 func newPolicyCmd() *cobra.Command {
-	var policyFile string
+	var (
+		policyFile     string
+		profile        string
+		overrideReason string
+		target         string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "policy [Dockerfile]",
 		Short: "Check a Dockerfile against policy rules",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runPolicy(args[0], policyFile)
+			dockerfilePath, err := analyzer.FindDockerfile(args[0])
+			if err != nil {
+				return err
+			}
+			return runPolicy(dockerfilePath, policyFile, profile, overrideReason, target)
 		},
 	}
+	cmd.Flags().StringVar(&target, "target", "", "Stage to treat as the final one, like docker build --target (default: the last stage)")
 
-	cmd.Flags().StringVarP(&policyFile, "policy", "p", "", "Path to policy YAML file")
-	return cmd
-}
+	cmd.PersistentFlags().StringVarP(&policyFile, "policy", "p", "", "Path, https:// URL, or oci:// reference of the policy YAML file")
+	cmd.PersistentFlags().StringVar(&profile, "profile", "", "Policy profile to apply (e.g., dev, staging, prod)")
+	cmd.PersistentFlags().StringVar(&overrideReason, "override-reason", "", "Break-glass: pass despite failed deny rules, recording this reason in the report")
 
-func runPolicy(dockerfilePath, policyFile string) error {
-	bold := color.New(color.Bold)
+	var (
+		noPull   bool
+		skipScan bool
+		input    string
+	)
+	imageCmd := &cobra.Command{
+		Use:   "image [image-ref]",
+		Short: "Check an existing image (local, from a registry, or an archive) against policy rules",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			imageRef, err := imageInput(args, input)
+			if err != nil {
+				return err
+			}
+			return runPolicyImage(imageRef, policyFile, profile, overrideReason, !noPull, skipScan)
+		},
+	}
+	imageCmd.Flags().BoolVar(&noPull, "no-pull", false, "Don't pull the image if it isn't available locally")
+	imageCmd.Flags().StringVar(&input, "input", "", "Read the image from docker-archive:<file> or oci:<dir> instead of the daemon")
+	imageCmd.Flags().BoolVar(&skipScan, "skip-scan", false, "Skip security scanning (CVE rules are not evaluated)")
+	cmd.AddCommand(imageCmd)
 
-	bold.Println("📋 Evaluating policy for:", dockerfilePath)
-	fmt.Println()
+	return cmd
+}
 
-	// Load policy
-	var config *policy.Config
-	if policyFile != "" {
-		var err error
-		config, err = policy.LoadConfig(policyFile)
+// loadPolicy loads the policy file with the given profile, or the default
+// policy when no file is given. A policy without a threshold of its own
+// takes the one from .dio.yaml; --threshold overrides both.
+func loadPolicy(policyFile, profile string) (*policy.Config, error) {
+	policyConfig, err := loadPolicyFile(policyFile, profile)
+	if err != nil {
+		return nil, err
+	}
+	if threshold != "" || policyConfig.Threshold == "" {
+		sev, err := severityThreshold()
 		if err != nil {
-			return fmt.Errorf("failed to load policy: %w", err)
+			return nil, err
+		}
+		if sev != "" {
+			policyConfig.Threshold = string(sev)
 		}
-	} else {
-		config = policy.DefaultConfig()
 	}
+	return policyConfig, nil
+}
 
-	// Run analysis
-	a := analyzer.New()
-	analysis, err := a.Analyze(dockerfilePath)
+func loadPolicyFile(policyFile, profile string) (*policy.Config, error) {
+	if policyFile == "" {
+		if profile != "" {
+			return nil, fmt.Errorf("--profile requires --policy")
+		}
+		return policy.DefaultConfig(), nil
+	}
+	opts, err := policyOptions()
 	if err != nil {
-		return err
+		return nil, err
 	}
-
+	policyConfig, err := policy.LoadConfigWithOptions(policyFile, profile, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy: %w", err)
+	}
+	return policyConfig, nil
+}
+
+// policyOptions returns how policies are fetched and verified, from the
+// DIO config file. Warnings, such as deprecated keys, are printed.
+func policyOptions() (policy.RemoteOptions, error) {
+	cfg, err := config.LoadOrDefault(configFile)
+	if err != nil {
+		return policy.RemoteOptions{}, err
+	}
+	opts := policy.RemoteOptions{
+		CacheDir:  cfg.Policy.CacheDir,
+		Keychain:  registry.DefaultKeychain(cfg.Registry.DockerConfig),
+		TLS:       registryTLS(cfg.Registry),
+		AllowHTTP: cfg.Policy.AllowHTTP,
+		Warn: func(msg string) {
+			color.New(color.FgYellow).Println("  ⚠", msg)
+		},
+	}
+	if cfg.Policy.PublicKey != "" {
+		if opts.PublicKey, err = policy.LoadPublicKey(cfg.Policy.PublicKey); err != nil {
+			return policy.RemoteOptions{}, err
+		}
+	}
+	return opts, nil
+}
+
+func runPolicy(dockerfilePath, policyFile, profile, overrideReason, target string) error {
+	bold := color.New(color.Bold)
+
+	bold.Println("📋 Evaluating policy for:", dockerfilePath)
+	fmt.Println()
+
+	// Load policy
+	config, err := loadPolicy(policyFile, profile)
+	if err != nil {
+		return err
+	}
+
+	// Run analysis
+	a, err := newAnalyzer()
+	if err != nil {
+		return err
+	}
+	a.SetTarget(target)
+	analysis, err := a.Analyze(dockerfilePath)
+	if err != nil {
+		return err
+	}
+
 	result := &models.PipelineResult{
 		Timestamp:  time.Now(),
 		Dockerfile: dockerfilePath,
@@ -305,156 +964,1084 @@ func runPolicy(dockerfilePath, policyFile string) error {
 	// Evaluate policy
 	enforcer := policy.NewEnforcer(config)
 	policyResult := enforcer.Evaluate(result)
+	if overrideReason != "" {
+		if err := enforcer.ApplyOverride(policyResult, overrideReason); err != nil {
+			return fmt.Errorf("override rejected: %w", err)
+		}
+	}
 
 	fmt.Println(policy.FormatPolicyStatus(policyResult))
 
 	if !policyResult.Passed {
-		os.Exit(1)
+		exit(1)
 	}
 
 	return nil
 }
 
+// runPolicyImage evaluates size, layer, CVE, tag and user rules against an
+// already built image instead of a Dockerfile.
+func runPolicyImage(imageRef, policyFile, profile, overrideReason string, pull, skipScan bool) error {
+	bold := color.New(color.Bold)
+
+	bold.Println("📋 Evaluating policy for image:", imageRef)
+	fmt.Println()
+
+	config, err := loadPolicy(policyFile, profile)
+	if err != nil {
+		return err
+	}
+
+	info := func(format string, args ...interface{}) {
+		fmt.Printf("  "+format+"\n", args...)
+	}
+	warn := func(format string, args ...interface{}) {
+		fmt.Printf("  ⚠ "+format+"\n", args...)
+	}
+	result, err := evaluateImage(imageRef, config, pull, skipScan, info, warn)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+
+	policyResult := result.Policy
+	if overrideReason != "" {
+		if err := policy.NewEnforcer(config).ApplyOverride(policyResult, overrideReason); err != nil {
+			return fmt.Errorf("override rejected: %w", err)
+		}
+	}
+
+	fmt.Println(policy.FormatPolicyStatus(policyResult))
+
+	if !policyResult.Passed {
+		exit(1)
+	}
+
+	return nil
+}
+
+// evaluateImage pulls (if allowed and needed), inspects and scans an image,
+// or an archive named docker-archive:<file> or oci:<dir>, and evaluates the
+// policy against it. Progress is reported through info
+// and warn.
+func evaluateImage(imageRef string, config *policy.Config, pull, skipScan bool, info, warn func(format string, args ...interface{})) (*models.PipelineResult, error) {
+	retryPol, err := retryPolicy()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		metrics    *models.ImageMetrics
+		compressed func() (int64, error)
+	)
+	if archive, ok := docker.ParseArchive(imageRef); ok {
+		if metrics, err = archive.Inspect(); err != nil {
+			return nil, err
+		}
+		compressed = archive.CompressedSize
+	} else {
+		dockerClient, err := docker.NewClient()
+		if err != nil {
+			return nil, err
+		}
+		dockerClient.SetRetry(retryPol)
+		if !dockerClient.ImageExists(imageRef) {
+			if !pull {
+				return nil, fmt.Errorf("image %s not found locally (pulling disabled by --no-pull)", imageRef)
+			}
+			info("Pulling %s...", imageRef)
+			if err := dockerClient.Pull(imageRef); err != nil {
+				return nil, err
+			}
+		}
+		if metrics, err = dockerClient.Inspect(imageRef); err != nil {
+			return nil, err
+		}
+		compressed = func() (int64, error) { return dockerClient.CompressedSize(imageRef) }
+	}
+	info("Size: %s, Layers: %d", metrics.SizeHuman, metrics.Layers)
+	if config.MaxCompressedSize != "" {
+		if size, err := compressed(); err != nil {
+			warn("Cannot determine compressed size: %v", err)
+		} else {
+			metrics.CompressedSize = size
+			info("Compressed size: %s", docker.HumanSize(size))
+		}
+	}
+
+	result := &models.PipelineResult{
+		Timestamp:     time.Now(),
+		Image:         imageRef,
+		BaselineImage: metrics,
+	}
+
+	if !skipScan {
+		sc, err := scanner.New()
+		if sc != nil {
+			sc.SetRetry(retryPol)
+		}
+		if err != nil {
+			warn("Cannot scan: %v", err)
+			addStepError(result, "scan", err, "Cannot scan: %v", err)
+		} else if scanRes, err := sc.Scan(imageRef); err != nil {
+			warn("Scan failed: %v", err)
+			addStepError(result, "scan", err, "Scan failed: %v", err)
+		} else {
+			result.ScanResult = scanRes
+			info("CVEs: %d critical, %d high, %d medium, %d low",
+				scanRes.CriticalCount, scanRes.HighCount, scanRes.MediumCount, scanRes.LowCount)
+		}
+		if sc != nil && config.LicenseRules() {
+			if sbom, err := sc.SBOM(imageRef); err != nil {
+				warn("SBOM generation failed: %v", err)
+				addStepError(result, "sbom", err, "SBOM generation failed: %v", err)
+			} else {
+				result.SBOM = sbom
+				info("SBOM: %d packages", len(sbom.Packages))
+			}
+		}
+	}
+
+	result.Policy = policy.NewEnforcer(config).Evaluate(result)
+	return result, nil
+}
+
 // --- run command (full pipeline) ---
 
 func newRunCmd() *cobra.Command {
 	var (
-		mode       string
-		policyFile string
-		outputDir  string
-		skipScan   bool
-		skipBuild  bool
+		mode           string
+		policyFile     string
+		outputDir      string
+		previousReport string
+		skipScan       bool
+		skipBuild      bool
+		buildTarget    string
+		scanCopyFrom   bool
+		slimImage      bool
+		squash         bool
+		writeIgnore    bool
+		profile        string
+		overrideReason string
+		progressFormat string
+		push           string
+		pushIfBetter   bool
+		buildConfig    string
+		buildName      string
+		buildArgs      []string
+		target         string
+		sourceDate     string
+		strict         bool
+		changed        bool
+		base           string
 	)
 
 	cmd := &cobra.Command{
-		Use:   "run [Dockerfile]",
+		Use:   "run [Dockerfile | --changed [dir]]",
 		Short: "Run the full DIO pipeline: analyze → optimize → scan → policy → report",
-		Args:  cobra.ExactArgs(1),
+		Long: `Run the full DIO pipeline on a Dockerfile: analyze → optimize → build →
+scan → policy → report.
+
+With --changed, run it on each Dockerfile under the directory (default: the
+current one) whose file or build context the branch changed since --base,
+committed or not. Each Dockerfile's reports go to its own directory of
+--output.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if changed {
+				return cobra.MaximumNArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runPipeline(args[0], mode, policyFile, outputDir, skipScan, skipBuild)
+			if err := checkFormat(progressFormat, "text", "json"); err != nil {
+				return err
+			}
+			if err := checkFormat(buildTarget, "all", "optimized-only"); err != nil {
+				return err
+			}
+			if buildTarget == "optimized-only" && mode != "autofix" {
+				return fmt.Errorf("--build-target optimized-only requires --mode autofix")
+			}
+			opts := pipelineOptions{
+				Mode:              mode,
+				PolicyFile:        policyFile,
+				Profile:           profile,
+				OutputDir:         outputDir,
+				PreviousReport:    previousReport,
+				OverrideReason:    overrideReason,
+				SkipScan:          skipScan,
+				SkipBuild:         skipBuild,
+				OptimizedOnly:     buildTarget == "optimized-only",
+				ScanCopyFrom:      scanCopyFrom,
+				Slim:              slimImage,
+				Squash:            squash,
+				WriteDockerignore: writeIgnore,
+				Push:              push,
+				PushIfBetter:      pushIfBetter,
+				Build:             buildSettings{ConfigFile: buildConfig, Name: buildName, Args: parseBuildArgs(buildArgs), Target: target, SourceDateEpoch: sourceDate},
+				Strict:            strict,
+			}
+			if changed {
+				if push != "" || previousReport != "" {
+					return fmt.Errorf("--changed can't be combined with --push or --previous-report")
+				}
+				root := "."
+				if len(args) == 1 {
+					root = args[0]
+				}
+				return runChanged(root, base, outputDir, strict, func(dockerfilePath, outputDir string) (*models.PipelineResult, error) {
+					var events *progress.Stream
+					if progressFormat == "json" {
+						events = progress.New(os.Stderr, pipelineSteps)
+					}
+					opts := opts
+					opts.OutputDir = outputDir
+					return executePipeline(dockerfilePath, opts, events)
+				})
+			}
+			var events *progress.Stream
+			if progressFormat == "json" {
+				events = progress.New(os.Stderr, pipelineSteps)
+			}
+			dockerfilePath, err := analyzer.FindDockerfile(args[0])
+			if err != nil {
+				return err
+			}
+			return runPipeline(dockerfilePath, opts, events)
 		},
 	}
 
 	cmd.Flags().StringVarP(&mode, "mode", "m", "suggest", "Mode: suggest or autofix")
-	cmd.Flags().StringVarP(&policyFile, "policy", "p", "", "Path to policy YAML file")
+	cmd.Flags().StringVarP(&policyFile, "policy", "p", "", "Path, https:// URL, or oci:// reference of the policy YAML file")
+	cmd.Flags().StringVar(&profile, "profile", "", "Policy profile to apply (e.g., dev, staging, prod)")
 	cmd.Flags().StringVarP(&outputDir, "output", "o", "reports", "Output directory for reports")
+	cmd.Flags().StringVar(&previousReport, "previous-report", "", "JSON report of the previous run for max_size_growth (default: report.json in the output directory)")
 	cmd.Flags().BoolVar(&skipScan, "skip-scan", false, "Skip security scanning")
 	cmd.Flags().BoolVar(&skipBuild, "skip-build", false, "Skip image building")
+	cmd.Flags().StringVar(&buildTarget, "build-target", "all", "Images to build: all, or optimized-only to skip the baseline build and estimate it from registry base image sizes")
+	cmd.Flags().BoolVar(&scanCopyFrom, "scan-copy-from", false, "Also scan external images referenced by COPY --from")
+	cmd.Flags().BoolVar(&slimImage, "slim", false, "Minify the final image with mint (docker-slim) and evaluate the policy against the minified image")
+	cmd.Flags().BoolVar(&squash, "squash", false, "Squash the final image into one layer when it exceeds the squash thresholds in .dio.yaml")
+	cmd.Flags().BoolVar(&writeIgnore, "write-dockerignore", false, "With --mode autofix, generate a .dockerignore next to the Dockerfile if there is none")
+	cmd.Flags().StringVar(&overrideReason, "override-reason", "", "Break-glass: pass despite failed deny rules, recording this reason in the report")
+	cmd.Flags().StringVar(&progressFormat, "progress", "text", "Progress output: text, or json for NDJSON events on stderr")
+	cmd.Flags().StringVar(&push, "push", "", "Tag the final image as this reference (e.g. registry/app:tag) and push it, with provenance labels")
+	cmd.Flags().BoolVar(&pushIfBetter, "push-if-better", false, "With --push, push only when the policy passes and the final image is smaller than the baseline")
+	cmd.Flags().StringVar(&buildConfig, "build-config", "", "Bake or Compose file to take build args, target stage, platform and context from (default: found next to the Dockerfile or above it; none to skip)")
+	cmd.Flags().StringVar(&buildName, "build-config-name", "", "Bake target or Compose service in the build config (default: the first one building the Dockerfile)")
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "Build argument (KEY=VALUE, repeatable); overrides the build config")
+	cmd.Flags().StringVar(&target, "target", "", "Stage to analyze as the final one and build, like docker build --target; overrides the build config (default: the last stage)")
+	cmd.Flags().BoolVar(&changed, "changed", false, "Run on the Dockerfiles whose file or build context changed since --base (git), instead of one Dockerfile")
+	cmd.Flags().StringVar(&base, "base", "origin/main", "With --changed, the branch or commit the changes are compared with")
+	cmd.Flags().StringVar(&sourceDate, "source-date-epoch", "", "Date the builds with SOURCE_DATE_EPOCH: a Unix timestamp, or git for the last commit; overrides reproducible.source_date_epoch in .dio.yaml")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail when a step failed or was skipped for lack of a tool (docker, trivy/grype, mint), not only on policy violations")
 	return cmd
 }
 
-func runPipeline(dockerfilePath, mode, policyFile, outputDir string, skipScan, skipBuild bool) error {
+// buildSettings are the dio run flags choosing how images are built.
+type buildSettings struct {
+	ConfigFile string            // --build-config
+	Name       string            // --build-config-name
+	Args       map[string]string // --build-arg
+	Target     string            // --target
+	// SourceDateEpoch is --source-date-epoch.
+	SourceDateEpoch string
+}
+
+// loadBuildSpec returns how the Bake or Compose file builds the
+// Dockerfile. Without a file, the files next to the Dockerfile and above it
+// are searched; "none" turns the search off.
+func loadBuildSpec(dockerfilePath, file, name string) (*buildspec.Spec, error) {
+	var spec *buildspec.Spec
+	var err error
+	switch file {
+	case "none":
+		return nil, nil
+	case "":
+		spec, err = buildspec.Find(dockerfilePath, name)
+	default:
+		var specs []buildspec.Spec
+		if specs, err = buildspec.Load(file); err == nil {
+			spec, err = buildspec.Select(specs, dockerfilePath, name)
+		}
+		if err == nil && spec == nil && name == "" {
+			return nil, fmt.Errorf("no target or service in %s builds %s", file, dockerfilePath)
+		}
+	}
+	if err == nil && spec == nil && name != "" {
+		return nil, fmt.Errorf("no target or service %s builds %s", name, dockerfilePath)
+	}
+	return spec, err
+}
+
+// describeBuildSpec summarizes the build settings taken from a Spec.
+func describeBuildSpec(spec *buildspec.Spec) string {
+	var parts []string
+	if spec.Target != "" {
+		parts = append(parts, "target stage "+spec.Target)
+	}
+	if p := spec.Platform(); p != "" {
+		parts = append(parts, "platform "+p)
+	}
+	if len(spec.Args) > 0 {
+		parts = append(parts, "build args "+strings.Join(spec.ArgNames(), ", "))
+	}
+	desc := fmt.Sprintf("%s in %s", spec.Name, filepath.Base(spec.Source))
+	if len(parts) > 0 {
+		desc += " (" + strings.Join(parts, "; ") + ")"
+	}
+	return desc
+}
+
+// pipelineSteps is the number of progress steps in dio run: analyze,
+// optimize, build, scan, policy and report.
+const pipelineSteps = 6
+
+// slimStage minifies img and records the result, making the minified
+// image the pipeline's final image.
+func slimStage(result *models.PipelineResult, img *models.ImageMetrics, tag string, cfg config.SlimConfig) error {
+	sl, err := slim.New()
+	if err != nil {
+		return err
+	}
+	client, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+	slimmed, err := sl.Minify(client, img.ImageName, tag, slimOptions(cfg))
+	if err != nil {
+		return err
+	}
+	result.Slim = slimmed
+	return nil
+}
+
+// squashImage runs the squash step on img with the thresholds from
+// .dio.yaml, defaulting to 20 layers and 20MB wasted.
+// measureStripDocs measures the directories the strip-docs strategy
+// empties in the baseline and optimized images.
+func measureStripDocs(b *builder.Builder, baseline, optimized *models.ImageMetrics) (*models.StripDocsResult, error) {
+	result := &models.StripDocsResult{Dirs: optimizer.StrippedDirs}
+	var err error
+	if result.BaselineBytes, err = b.DirsSize(baseline, optimizer.StrippedDirs); err != nil {
+		return nil, err
+	}
+	if result.OptimizedBytes, err = b.DirsSize(optimized, optimizer.StrippedDirs); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sourceDateEpoch returns the SOURCE_DATE_EPOCH of the builds: the
+// --source-date-epoch flag, or the reproducible section of .dio.yaml. "git"
+// stands for the time of the last commit.
+func sourceDateEpoch(dockerfilePath, flag string, cfg config.ReproducibleConfig) (string, error) {
+	epoch := cfg.SourceDateEpoch
+	if flag != "" {
+		epoch = flag
+	}
+	switch epoch {
+	case "":
+		return "", nil
+	case "git":
+		return git.CommitTime(dockerfilePath)
+	}
+	if _, err := strconv.ParseInt(epoch, 10, 64); err != nil {
+		return "", fmt.Errorf("%q is neither a Unix timestamp nor git", epoch)
+	}
+	return epoch, nil
+}
+
+// attestOptions returns the attestations dio run generates: those of the
+// attestations section of .dio.yaml, and those the policy requires, with
+// max provenance unless the section sets a mode.
+func attestOptions(cfg config.AttestationsConfig, pol *policy.Config) docker.AttestOptions {
+	opts := docker.AttestOptions{Provenance: cfg.Provenance, SBOM: cfg.SBOM || pol.RequireSBOMAttestation}
+	if opts.Provenance == "" && pol.RequireProvenance {
+		opts.Provenance = "max"
+	}
+	return opts
+}
+
+// layerDuplicates finds the layers of img that store files of earlier
+// layers again, and the lines of the Dockerfile content that created them.
+func layerDuplicates(b *builder.Builder, img *models.ImageMetrics, content string, buildArgs map[string]string, target string) ([]models.LayerDuplication, error) {
+	dups, err := b.LayerDuplicates(img)
+	if err != nil {
+		return nil, err
+	}
+	pdf := analyzer.ParseDockerfile(strings.Split(content, "\n"), buildArgs)
+	pdf.Target = target
+	for i := range dups {
+		dups[i].Line = pdf.InstructionLine(dups[i].CreatedBy)
+		dups[i].SourceLine = pdf.InstructionLine(dups[i].SourceCreatedBy)
+	}
+	return dups, nil
+}
+
+func squashImage(b *builder.Builder, img *models.ImageMetrics, tag string, cfg config.SquashConfig) (*models.SquashResult, error) {
+	maxLayers := cfg.MaxLayers
+	if maxLayers == 0 {
+		maxLayers = 20
+	}
+	maxWasted := int64(20 * 1024 * 1024)
+	if cfg.MaxWasted != "" {
+		size, err := docker.ParseImageSize(cfg.MaxWasted)
+		if err != nil {
+			return nil, fmt.Errorf("squash.max_wasted: %w", err)
+		}
+		maxWasted = size
+	}
+	return b.Squash(img, tag, maxLayers, maxWasted)
+}
+
+// costRates converts the cost section of .dio.yaml.
+func costRates(cfg config.CostConfig) cost.Rates {
+	return cost.Rates{
+		StoragePerGB: cfg.StoragePerGB,
+		EgressPerGB:  cfg.EgressPerGB,
+		PullsPerDay:  cfg.PullsPerDay,
+		Currency:     cfg.Currency,
+	}
+}
+
+// carbonCoefficients converts the carbon section of .dio.yaml, which
+// shares the pull rate of the cost section unless it sets its own.
+func carbonCoefficients(cfg *config.Config) footprint.Coefficients {
+	pulls := cfg.Carbon.PullsPerDay
+	if pulls == 0 {
+		pulls = cfg.Cost.PullsPerDay
+	}
+	return footprint.Coefficients{
+		PullsPerDay:      pulls,
+		TransferKWhPerGB: cfg.Carbon.TransferKWhPerGB,
+		StorageKWhPerGB:  cfg.Carbon.StorageKWhPerGB,
+		GridIntensity:    cfg.Carbon.GridIntensity,
+	}
+}
+
+// labelPolicy adds the DIO labels, now including the policy result, to the
+// final image.
+func labelPolicy(result *models.PipelineResult, img *models.ImageMetrics) error {
+	b, err := builder.New()
+	if err != nil {
+		return err
+	}
+	return b.Label(img, builder.Labels(version, result, img != result.BaselineImage))
+}
+
+// pushImage pushes the final image to ref with provenance labels. With
+// ifBetter it is only pushed when the policy passed and the image is
+// smaller than the baseline.
+func pushImage(result *models.PipelineResult, ref string, ifBetter bool) *models.PushResult {
+	img := result.FinalImage()
+	if img == nil {
+		return &models.PushResult{Ref: ref, Error: "no image was built"}
+	}
+	res := &models.PushResult{Source: img.ImageName, Ref: ref}
+	if ifBetter {
+		switch base := result.BaselineImage; {
+		case !result.Policy.Passed:
+			res.Reason = "policy checks failed"
+			return res
+		case base == nil:
+			res.Reason = "there is no baseline image to compare with"
+			return res
+		case img == base:
+			res.Reason = "no optimized image was built"
+			return res
+		case img.Size >= base.Size:
+			res.Reason = fmt.Sprintf("%s is not smaller than the baseline (%s)", img.SizeHuman, base.SizeHuman)
+			return res
+		}
+	}
+
+	b, err := builder.New()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	pushed, err := b.Push(img, ref, builder.Labels(version, result, img != result.BaselineImage))
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	return pushed
+}
+
+// hasStage reports whether the analyzed Dockerfile has a stage with the
+// given name.
+func hasStage(analysis *models.AnalysisResult, name string) bool {
+	for _, stage := range analysis.Stages {
+		if strings.EqualFold(stage.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// pipelineOptions are the dio run flags the pipeline runs with. Empty
+// options skip nothing and run it in suggest mode.
+type pipelineOptions struct {
+	Mode           string // --mode: suggest or autofix
+	PolicyFile     string // --policy
+	Profile        string // --profile
+	OutputDir      string // --output
+	PreviousReport string // --previous-report
+	OverrideReason string // --override-reason
+	SkipScan       bool   // --skip-scan
+	SkipBuild      bool   // --skip-build
+	// OptimizedOnly is --build-target optimized-only: the baseline image
+	// is estimated instead of built.
+	OptimizedOnly     bool
+	ScanCopyFrom      bool   // --scan-copy-from
+	Slim              bool   // --slim
+	Squash            bool   // --squash
+	WriteDockerignore bool   // --write-dockerignore
+	Push              string // --push
+	PushIfBetter      bool   // --push-if-better
+	Build             buildSettings
+	// Strict is --strict: runPipeline fails when a step failed or was
+	// skipped, not only on policy violations.
+	Strict bool
+}
+
+// runPipeline runs the pipeline and exits with 1 when it fails.
+func runPipeline(dockerfilePath string, opts pipelineOptions, events *progress.Stream) error {
+	result, err := executePipeline(dockerfilePath, opts, events)
+	if err != nil {
+		return err
+	}
+	if pipelineFailed(result, opts.Strict) {
+		exit(1)
+	}
+	return nil
+}
+
+// pipelineFailed reports whether dio run fails for a result: the policy
+// failed, the push failed or, with strict, a step failed or was skipped.
+func pipelineFailed(result *models.PipelineResult, strict bool) bool {
+	return !result.Policy.Passed || (result.Push != nil && result.Push.Error != "") || (strict && len(result.Errors) > 0)
+}
+
+// addStepError records an error of a pipeline step in the result, as
+// skipped when the environment lacks the tool the step needs and as
+// failed otherwise, with the build or image that failed.
+func addStepError(result *models.PipelineResult, step string, err error, format string, args ...interface{}) {
+	stepErr := models.StepError{Step: step, Kind: models.StepFailed, Message: fmt.Sprintf(format, args...)}
+	if errors.Is(err, docker.ErrNotFound) || errors.Is(err, docker.ErrNoAttestations) || errors.Is(err, scanner.ErrNotFound) || errors.Is(err, slim.ErrNotFound) {
+		stepErr.Kind = models.StepSkipped
+	}
+	var buildErr *builder.BuildError
+	var scanErr *scanner.ScanError
+	switch {
+	case errors.As(err, &buildErr):
+		stepErr.Target = buildErr.Build
+	case errors.As(err, &scanErr):
+		stepErr.Target = scanErr.Image
+	}
+	result.Errors = append(result.Errors, stepErr)
+}
+
+// stepErrorSummary lists the steps with errors, e.g. "build failed, scan
+// skipped".
+func stepErrorSummary(errs []models.StepError) string {
+	var parts []string
+	seen := make(map[models.StepError]bool)
+	for _, e := range errs {
+		key := models.StepError{Step: e.Step, Kind: e.Kind}
+		if !seen[key] {
+			seen[key] = true
+			parts = append(parts, e.Step+" "+e.Kind)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// executePipeline runs the pipeline, writes the reports and records the
+// run. A failed policy is not an error: it is reported in the result, like
+// the steps that were skipped or failed. Errors that stop the pipeline are
+// returned; loading the policy or applying an override fails with a
+// *policy.PolicyError.
+func executePipeline(dockerfilePath string, opts pipelineOptions, events *progress.Stream) (*models.PipelineResult, error) {
 	bold := color.New(color.Bold)
 	green := color.New(color.FgGreen)
 	red := color.New(color.FgRed)
 
+	// info and warn print sub-step output and mirror it to the progress stream
+	info := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		fmt.Println("  " + msg)
+		events.Log(progress.LevelInfo, msg)
+	}
+	warn := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		fmt.Println("  ⚠ " + msg)
+		events.Log(progress.LevelWarn, msg)
+	}
+
 	bold.Println("🐳 Docker Image Optimizer — Full Pipeline")
 	bold.Println("==========================================")
 	fmt.Println()
+	events.Start(dockerfilePath)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, events.Fail(err)
+	}
+	squashCfg := cfg.Squash
+	squashCfg.Enabled = squashCfg.Enabled || opts.Squash
+	slimCfg := cfg.Slim
+	slimCfg.Enabled = slimCfg.Enabled || opts.Slim
+	rates := costRates(cfg.Cost)
+	retryPol, err := retryPolicy()
+	if err != nil {
+		return nil, events.Fail(err)
+	}
+	if retryPol.Log != nil {
+		// Retries are part of the step output with --verbose
+		retryPol.Log = info
+	}
+	// Load the policy up front: size budgets decide which stages to build
+	config, err := loadPolicy(opts.PolicyFile, opts.Profile)
+	if err != nil {
+		return nil, events.Fail(err)
+	}
+
+	// Build like the team's Bake or Compose file does
+	spec, err := loadBuildSpec(dockerfilePath, opts.Build.ConfigFile, opts.Build.Name)
+	if err != nil {
+		if opts.Build.ConfigFile != "" || opts.Build.Name != "" {
+			return nil, events.Fail(err)
+		}
+		warn("Ignoring the build config: %v", err)
+	}
+	contextDir := filepath.Dir(dockerfilePath)
+	buildArgs, target := opts.Build.Args, opts.Build.Target
+	if spec != nil {
+		contextDir = spec.Context
+		if target == "" {
+			target = spec.Target
+		}
+		buildArgs = make(map[string]string)
+		for k, v := range spec.Args {
+			buildArgs[k] = v
+		}
+		for k, v := range opts.Build.Args {
+			buildArgs[k] = v
+		}
+		info("Build config: %s", describeBuildSpec(spec))
+		fmt.Println()
+	}
 
 	result := &models.PipelineResult{
 		Timestamp:  time.Now(),
 		Dockerfile: dockerfilePath,
+		Git:        git.Detect(dockerfilePath),
+	}
+	// stepError warns about an error of a step and records it in the result
+	stepError := func(step string, err error, format string, args ...interface{}) {
+		warn(format, args...)
+		addStepError(result, step, err, format, args...)
+	}
+	// timed records how long a step took since start
+	timed := func(step string, start time.Time) {
+		result.Timings = append(result.Timings, models.StepTiming{Step: step, Seconds: time.Since(start).Seconds()})
 	}
 
 	// Step 1: Analyze
 	bold.Println("Step 1/5: 🔍 Analyzing Dockerfile...")
-	a := analyzer.New()
+	events.StartStep("analyze", "Analyzing Dockerfile")
+	start := time.Now()
+	a, err := newAnalyzer()
+	if err != nil {
+		return nil, events.Fail(err)
+	}
+	a.SetBuildArgs(buildArgs)
+	a.SetTarget(target)
 	analysis, err := a.Analyze(dockerfilePath)
 	if err != nil {
-		return fmt.Errorf("analysis failed: %w", err)
+		return nil, events.Fail(fmt.Errorf("analysis failed: %w", err))
 	}
 	result.Analysis = analysis
-	fmt.Printf("  Score: %d/100, Issues: %d\n\n", analysis.Score, len(analysis.Issues))
+	info("Score: %d/100, Issues: %d", analysis.Score, len(analysis.Issues))
+	timed("analyze", start)
+	events.FinishStep()
+	fmt.Println()
 
 	// Step 2: Optimize
 	bold.Println("Step 2/5: ⚡ Optimizing...")
+	events.StartStep("optimize", "Optimizing")
+	start = time.Now()
 	optMode := optimizer.ModeSuggest
-	if mode == "autofix" {
+	if opts.Mode == "autofix" {
 		optMode = optimizer.ModeAutoFix
 	}
 
-	opt := optimizer.New(optMode)
-	optResult, err := opt.Optimize(dockerfilePath)
+	opt, err := optimizer.NewWithConfig(optMode, cfg)
 	if err != nil {
-		return fmt.Errorf("optimization failed: %w", err)
+		return nil, events.Fail(err)
+	}
+	opt.SetBuildArgs(buildArgs)
+	opt.SetTarget(target)
+	opt.SetWriteDockerignore(opts.WriteDockerignore)
+	optResult, err := opt.OptimizeAnalyzed(dockerfilePath, analysis)
+	if err != nil {
+		return nil, events.Fail(fmt.Errorf("optimization failed: %w", err))
 	}
 	result.Optimization = optResult
-	fmt.Printf("  Optimizations: %d\n", len(optResult.Optimizations))
+	optimizer.LinkIssues(analysis, optResult.Optimizations)
+	info("Optimizations: %d", len(optResult.Optimizations))
+	if optResult.Dockerignore != "" {
+		// The builds below already use it
+		info("Written: %s", optResult.Dockerignore)
+	}
 
 	if optMode == optimizer.ModeAutoFix && optResult.OptimizedDockerfile != optResult.OriginalDockerfile {
-		dir := filepath.Dir(dockerfilePath)
-		optPath := filepath.Join(dir, "Dockerfile.optimized")
+		optPath := optimizedPath(dockerfilePath)
 		if err := opt.WriteOptimized(optResult, optPath); err != nil {
-			fmt.Printf("  ⚠ Failed to write optimized Dockerfile: %v\n", err)
+			stepError("optimize", err, "Failed to write optimized Dockerfile: %v", err)
 		} else {
-			fmt.Printf("  Written: %s\n", optPath)
+			info("Written: %s", optPath)
+			// Re-analyze to show that autofix improved the score
+			if optAnalysis, err := a.Analyze(optPath); err != nil {
+				stepError("optimize", err, "Failed to analyze optimized Dockerfile: %v", err)
+			} else {
+				result.OptimizedAnalysis = optAnalysis
+				result.AnalysisDiff = analyzer.Compare(analysis, optAnalysis)
+				info("Score after autofix: %d/100 (%+d), %d issue(s) resolved, %d new",
+					optAnalysis.Score, optAnalysis.Score-analysis.Score,
+					len(result.AnalysisDiff.ResolvedIssues), len(result.AnalysisDiff.NewIssues))
+			}
 		}
 	}
+	timed("optimize", start)
+	events.FinishStep()
 	fmt.Println()
 
 	// Step 3: Build
-	if !skipBuild {
+	if !opts.SkipBuild {
 		bold.Println("Step 3/5: 🏗️  Building images...")
+		events.StartStep("build", "Building images")
 		b, err := builder.New()
 		if err != nil {
-			fmt.Printf("  ⚠ Cannot build: %v\n\n", err)
+			stepError("build", err, "Cannot build: %v", err)
 		} else {
+			b.SetRetry(retryPol)
+			b.SetBuildArgs(buildArgs)
+			b.SetTarget(target)
+			if spec != nil {
+				b.SetPlatform(spec.Platform())
+			}
+			if epoch, err := sourceDateEpoch(dockerfilePath, opts.Build.SourceDateEpoch, cfg.Reproducible); err != nil {
+				warn("Cannot date the builds: %v", err)
+			} else if epoch != "" {
+				b.SetSourceDateEpoch(epoch, cfg.Reproducible.RewriteTimestamps)
+				info("SOURCE_DATE_EPOCH: %s", epoch)
+			}
 			// Derive an image tag from the Dockerfile path
 			baseName := strings.TrimSuffix(filepath.Base(dockerfilePath), filepath.Ext(dockerfilePath))
 			baseTag := fmt.Sprintf("dio-%s:baseline", strings.ToLower(baseName))
 
-			baseline, err := b.BuildBaseline(dockerfilePath, baseTag)
-			if err != nil {
-				fmt.Printf("  ⚠ Baseline build failed: %v\n", err)
-			} else {
-				result.BaselineImage = baseline
-				fmt.Printf("  Baseline: %s (%s, %d layers, built in %.1fs)\n",
-					baseline.ImageName, baseline.SizeHuman, baseline.Layers, baseline.BuildTime)
+			// diagnose prints the likely causes of the last build's failure
+			diagnose := func() {
+				logs := b.Logs()
+				for _, d := range logs[len(logs)-1].Diagnoses {
+					if d.Line > 0 {
+						warn("Line %d (%s): %s", d.Line, d.Instruction, d.Message)
+					} else {
+						warn("%s", d.Message)
+					}
+					info("  → %s", d.Hint)
+				}
 			}
 
 			// Build optimized image if autofix produced a different Dockerfile
-			if optMode == optimizer.ModeAutoFix && optResult.OptimizedDockerfile != optResult.OriginalDockerfile {
+			buildOptimized := optMode == optimizer.ModeAutoFix && optResult.OptimizedDockerfile != optResult.OriginalDockerfile
+			if opts.OptimizedOnly && buildOptimized {
+				info("Baseline: skipped (--build-target optimized-only)")
+			} else {
+				b.SetLabels(builder.Labels(version, result, false))
+				start := time.Now()
+				baseline, err := b.BuildBaseline(dockerfilePath, contextDir, baseTag)
+				timed("build baseline", start)
+				if err != nil {
+					stepError("build", err, "Baseline build failed: %v", err)
+					diagnose()
+				} else {
+					result.BaselineImage = baseline
+					info("Baseline: %s (%s, %d layers, built in %.1fs)",
+						baseline.ImageName, baseline.SizeHuman, baseline.Layers, baseline.BuildTime)
+				}
+			}
+
+			if buildOptimized {
 				optTag := fmt.Sprintf("dio-%s:optimized", strings.ToLower(baseName))
-				contextDir := filepath.Dir(dockerfilePath)
-				optPath := filepath.Join(contextDir, "Dockerfile.optimized")
+				optPath := optimizedPath(dockerfilePath)
 
+				b.SetLabels(builder.Labels(version, result, true))
+				start := time.Now()
 				optimized, err := b.BuildOptimized(optPath, contextDir, optTag)
+				timed("build optimized", start)
 				if err != nil {
-					fmt.Printf("  ⚠ Optimized build failed: %v\n", err)
+					stepError("build", err, "Optimized build failed: %v", err)
+					if result.BaselineImage != nil {
+						warn("The original Dockerfile builds, so the failure comes from the optimizations: review %s or rerun in suggest mode", filepath.Base(optPath))
+					}
+					diagnose()
 				} else {
 					result.OptimizedImage = optimized
-					fmt.Printf("  Optimized: %s (%s, %d layers, built in %.1fs)\n",
+					info("Optimized: %s (%s, %d layers, built in %.1fs)",
 						optimized.ImageName, optimized.SizeHuman, optimized.Layers, optimized.BuildTime)
 
-					// Generate comparison
+					// Generate comparison, or estimate it without a baseline
 					if result.BaselineImage != nil {
+						if rates.Enabled() || cfg.Carbon.Enabled {
+							// Registries store and serve the compressed layers
+							for _, img := range []*models.ImageMetrics{result.BaselineImage, optimized} {
+								if err := b.CompressedSize(img); err != nil {
+									warn("Cannot determine compressed size: %v", err)
+								}
+							}
+						}
 						result.Comparison = b.Compare(result.BaselineImage, optimized)
-						fmt.Printf("  Size reduction: %.1f%%\n", result.Comparison.SizePct)
+						info("Size reduction: %.1f%%", result.Comparison.SizePct)
+						if cfg.Strip.Enabled {
+							strip, err := measureStripDocs(b, result.BaselineImage, optimized)
+							if err != nil {
+								warn("Cannot measure the stripped docs: %v", err)
+							} else {
+								result.StripDocs = strip
+								info("Docs, man pages and translations: %s → %s (%s saved)",
+									docker.HumanSize(strip.BaselineBytes), docker.HumanSize(strip.OptimizedBytes), docker.HumanSize(strip.Saved()))
+							}
+						}
+					} else if opts.OptimizedOnly {
+						est, err := b.EstimateBaseline(analysis, result.OptimizedAnalysis, optimized)
+						if err != nil {
+							warn("Cannot estimate the baseline: %v", err)
+						} else {
+							result.BaselineEstimate = est
+							info("Estimated base image reduction: %s (%s) → %s (%s), registry sizes",
+								est.BaseImage, docker.HumanSize(est.BaseImageSize),
+								est.OptimizedBaseImage, docker.HumanSize(est.OptimizedBaseImageSize))
+						}
 					}
 				}
 			}
+
+			if diff, compressed, ok := result.SizeReduction(); ok {
+				result.CostImpact = cost.Estimate(diff, compressed, rates)
+				if cfg.Carbon.Enabled {
+					result.Footprint = footprint.Estimate(diff, compressed, carbonCoefficients(cfg))
+				}
+			}
+
+			// Build the stages that have a size budget
+			b.SetLabels(builder.Labels(version, result, false))
+			for _, stage := range config.StageBudgets() {
+				if !hasStage(analysis, stage) {
+					warn("Stage %s in stage_size_budgets not found in the Dockerfile", stage)
+					continue
+				}
+				stageTag := fmt.Sprintf("dio-%s:stage-%s", strings.ToLower(baseName), strings.ToLower(stage))
+				stageImg, err := b.BuildStage(dockerfilePath, contextDir, stage, stageTag)
+				if err != nil {
+					stepError("build", err, "%v", err)
+					diagnose()
+					continue
+				}
+				if result.StageImages == nil {
+					result.StageImages = make(map[string]*models.ImageMetrics)
+				}
+				result.StageImages[stage] = stageImg
+				info("Stage %s: %s (%d layers)", stage, stageImg.SizeHuman, stageImg.Layers)
+			}
+			result.Builds = b.Logs()
+
+			// Confirm how the compiled binaries are linked before anything
+			// runs the image
+			if img := result.FinalImage(); img != nil && len(analysis.Binaries) > 0 {
+				binaries, err := b.CheckBinaries(img, analysis.Binaries)
+				if err != nil {
+					warn("Cannot check binaries: %v", err)
+				}
+				result.Binaries = binaries
+				for _, bin := range binaries {
+					switch {
+					case bin.MissingInterpreter:
+						warn("%s is dynamically linked, but its loader %s is not in the image: it cannot start", bin.Path, bin.Interpreter)
+					case bin.Static:
+						info("%s: statically linked", bin.Path)
+					default:
+						info("%s: dynamically linked (%s)", bin.Path, strings.Join(bin.Libraries, ", "))
+					}
+				}
+			}
+
+			// A chown -R or chmod -R of copied files stores them twice; look
+			// for it in the image of the original Dockerfile, whose lines
+			// the user knows
+			img, content := result.BaselineImage, optResult.OriginalDockerfile
+			if img == nil {
+				img, content = result.OptimizedImage, optResult.OptimizedDockerfile
+			}
+			if img != nil {
+				dups, err := layerDuplicates(b, img, content, buildArgs, target)
+				if err != nil {
+					warn("Cannot look for duplicated layer data: %v", err)
+				}
+				result.LayerDuplicates = dups
+				for _, dup := range dups {
+					where, from := fmt.Sprintf("Layer %d", dup.Layer), "an earlier layer"
+					if dup.Line > 0 {
+						where = fmt.Sprintf("Line %d", dup.Line)
+					}
+					if dup.SourceLine > 0 {
+						from = fmt.Sprintf("line %d", dup.SourceLine)
+					}
+					warn("%s stores %d files (%s) of %s again: use COPY --chown or --chmod instead of changing them afterwards",
+						where, dup.Files, docker.HumanSize(dup.Bytes), from)
+				}
+			}
+
+			// Rebuild the final image twice without the cache to check that
+			// the builds are byte-identical
+			if config.RequireReproducible && (result.BaselineImage != nil || result.OptimizedImage != nil) {
+				path := dockerfilePath
+				if result.OptimizedImage != nil {
+					path = optimizedPath(dockerfilePath)
+				}
+				reproTag := fmt.Sprintf("dio-%s:reproducibility", strings.ToLower(baseName))
+				start := time.Now()
+				repro, err := b.CheckReproducible(path, contextDir, reproTag)
+				timed("reproducibility", start)
+				switch {
+				case err != nil:
+					stepError("build", err, "Reproducibility check failed: %v", err)
+				case repro.Reproducible:
+					info("Reproducible: both rebuilds are %s", repro.ImageIDs[0])
+				default:
+					warn("Not reproducible: the rebuilds differ in %d config field(s) and %d layer(s)", len(repro.ConfigFields), len(repro.Layers))
+				}
+				result.Reproducibility = repro
+			}
+
+			// Attest how the final image was built, before slim or squash
+			// rewrite it
+			if attest := attestOptions(cfg.Attestations, config); (attest.Provenance != "" || attest.SBOM) && (result.BaselineImage != nil || result.OptimizedImage != nil) {
+				path := dockerfilePath
+				if result.OptimizedImage != nil {
+					path = optimizedPath(dockerfilePath)
+				}
+				start := time.Now()
+				att, err := b.Attest(path, contextDir, filepath.Join(opts.OutputDir, "attestations"), attest)
+				timed("attestations", start)
+				if err != nil {
+					stepError("build", err, "Attestation failed: %v", err)
+				} else {
+					result.Attestations = att
+					if att.Provenance != "" {
+						info("Provenance: %s (%s)", att.Provenance, att.PredicateType)
+					}
+					for _, sbom := range att.SBOMs {
+						info("SBOM attestation: %s", sbom)
+					}
+				}
+			}
+
+			// Minify the final image; policy checks then apply to it
+			if img := result.FinalImage(); img != nil && slimCfg.Enabled {
+				minifiedTag := fmt.Sprintf("dio-%s:slim", strings.ToLower(baseName))
+				if err := slimStage(result, img, minifiedTag, slimCfg); err != nil {
+					stepError("slim", err, "Slim failed: %v", err)
+				} else {
+					info("Slim: %s (%s → %s, %d files removed)", result.Slim.Image.ImageName,
+						img.SizeHuman, result.Slim.Image.SizeHuman, result.Slim.RemovedFiles)
+				}
+			}
+
+			if img := result.FinalImage(); img != nil && config.MaxCompressedSize != "" {
+				if err := b.CompressedSize(img); err != nil {
+					warn("Cannot determine compressed size: %v", err)
+				} else {
+					info("Compressed size: %s", docker.HumanSize(img.CompressedSize))
+				}
+			}
+
+			if img := result.FinalImage(); img != nil && squashCfg.Enabled {
+				squashTag := fmt.Sprintf("dio-%s:squashed", strings.ToLower(baseName))
+				squashed, err := squashImage(b, img, squashTag, squashCfg)
+				switch {
+				case err != nil:
+					stepError("squash", err, "Squash failed: %v", err)
+				case squashed.Squashed:
+					info("Squashed: %s (%s → %s, %d → 1 layer) — %s", squashed.Image.ImageName,
+						img.SizeHuman, squashed.Image.SizeHuman, squashed.Layers, squashed.Reason)
+				default:
+					info("Not squashed: %s", squashed.Reason)
+				}
+				result.Squash = squashed
+			}
+
+			// Setuid and setgid files let a process in the container gain
+			// their owner's privileges
+			if img := result.FinalImage(); img != nil {
+				files, err := b.SetIDFiles(img)
+				if err != nil {
+					warn("Cannot list setuid and setgid files: %v", err)
+				}
+				result.SetIDFiles = files
+				if len(files) > 0 {
+					info("%d setuid/setgid files in %s", len(files), img.ImageName)
+				}
+			}
+
+			// Check what the image runs with, from its config, along with
+			// the findings of the Dockerfile it was built from
+			built := result.OptimizedImage
+			if built == nil {
+				built = result.BaselineImage
+			}
+			if final := result.FinalAnalysis(); built != nil {
+				runtime, err := b.RuntimeConfig(built)
+				if err == nil {
+					before := len(final.Issues)
+					err = a.CheckImage(final, runtime)
+					for _, issue := range final.Issues[before:] {
+						warn("Line %d: %s (%s)", issue.Line, issue.Title, issue.ID)
+					}
+				}
+				if err != nil {
+					warn("Cannot check the image config: %v", err)
+				}
+			}
 		}
+		events.FinishStep()
 	} else {
 		bold.Println("Step 3/5: 🏗️  Building images... (skipped)")
+		events.SkipStep("build", "Building images")
 	}
 	fmt.Println()
 
 	// Step 4: Security scan
-	if !skipScan {
+	if !opts.SkipScan {
 		bold.Println("Step 4/5: 🔒 Security scanning...")
+		events.StartStep("scan", "Security scanning")
+		start := time.Now()
 		sc, err := scanner.New()
 		if err != nil {
-			fmt.Printf("  ⚠ Cannot scan: %v\n", err)
+			stepError("scan", err, "Cannot scan: %v", err)
 		} else {
+			sc.SetRetry(retryPol)
+
 			// Scan baseline image
 			if result.BaselineImage != nil {
 				scanRes, err := sc.Scan(result.BaselineImage.ImageName)
 				if err != nil {
-					fmt.Printf("  ⚠ Baseline scan failed: %v\n", err)
+					stepError("scan", err, "Baseline scan failed: %v", err)
 				} else {
 					result.ScanResult = scanRes
-					fmt.Printf("  Baseline: %d critical, %d high, %d medium, %d low\n",
+					info("Baseline: %d critical, %d high, %d medium, %d low",
 						scanRes.CriticalCount, scanRes.HighCount, scanRes.MediumCount, scanRes.LowCount)
 				}
 			}
@@ -463,10 +2050,10 @@ func runPipeline(dockerfilePath, mode, policyFile, outputDir string, skipScan, s
 			if result.OptimizedImage != nil {
 				optScanRes, err := sc.Scan(result.OptimizedImage.ImageName)
 				if err != nil {
-					fmt.Printf("  ⚠ Optimized scan failed: %v\n", err)
+					stepError("scan", err, "Optimized scan failed: %v", err)
 				} else {
 					result.OptScanResult = optScanRes
-					fmt.Printf("  Optimized: %d critical, %d high, %d medium, %d low\n",
+					info("Optimized: %d critical, %d high, %d medium, %d low",
 						optScanRes.CriticalCount, optScanRes.HighCount, optScanRes.MediumCount, optScanRes.LowCount)
 				}
 
@@ -478,48 +2065,131 @@ func runPipeline(dockerfilePath, mode, policyFile, outputDir string, skipScan, s
 				}
 			}
 
-			if result.BaselineImage == nil && result.OptimizedImage == nil {
-				fmt.Println("  ⚠ No images to scan (build step was skipped)")
+			// Scan the minified image
+			if result.Slim != nil {
+				slimScanRes, err := sc.Scan(result.Slim.Image.ImageName)
+				if err != nil {
+					stepError("scan", err, "Slim scan failed: %v", err)
+				} else {
+					result.Slim.Scan = slimScanRes
+					info("Slim: %d critical, %d high, %d medium, %d low",
+						slimScanRes.CriticalCount, slimScanRes.HighCount, slimScanRes.MediumCount, slimScanRes.LowCount)
+				}
+			}
+
+			// Inventory packages for the license rules
+			if img := result.FinalImage(); img != nil && config.LicenseRules() {
+				sbom, err := sc.SBOM(img.ImageName)
+				if err != nil {
+					stepError("sbom", err, "SBOM generation failed: %v", err)
+				} else {
+					result.SBOM = sbom
+					info("SBOM: %d packages", len(sbom.Packages))
+				}
+			}
+
+			// Scan external images pulled in via COPY --from
+			if opts.ScanCopyFrom {
+				for _, ref := range analysis.ImageReferences {
+					if ref.Source != models.ImageSourceCopyFrom {
+						continue
+					}
+					extRes, err := sc.Scan(ref.Image)
+					if err != nil {
+						stepError("scan", err, "Scan of %s failed: %v", ref.Image, err)
+						continue
+					}
+					result.ExternalScanResults = append(result.ExternalScanResults, *extRes)
+					info("%s (COPY --from, line %d): %d critical, %d high, %d medium, %d low",
+						ref.Image, ref.Line, extRes.CriticalCount, extRes.HighCount, extRes.MediumCount, extRes.LowCount)
+				}
+			}
+
+			if result.BaselineImage == nil && result.OptimizedImage == nil && len(result.ExternalScanResults) == 0 {
+				warn("No images to scan (build step was skipped)")
 			}
 		}
+		timed("scan", start)
+		events.FinishStep()
 	} else {
 		bold.Println("Step 4/5: 🔒 Security scanning... (skipped)")
+		events.SkipStep("scan", "Security scanning")
 	}
 	fmt.Println()
 
 	// Step 5: Policy enforcement
 	bold.Println("Step 5/5: 📋 Policy enforcement...")
-	var config *policy.Config
-	if policyFile != "" {
-		config, err = policy.LoadConfig(policyFile)
-		if err != nil {
-			return fmt.Errorf("failed to load policy: %w", err)
-		}
-	} else {
-		config = policy.DefaultConfig()
+	events.StartStep("policy", "Policy enforcement")
+	start = time.Now()
+	if opts.PreviousReport == "" {
+		opts.PreviousReport = filepath.Join(opts.OutputDir, "report.json")
+	}
+	if prev, err := reporter.LoadResult(opts.PreviousReport); err != nil {
+		warn("Cannot read previous report: %v", err)
+	} else if prev != nil && prev.Dockerfile == result.Dockerfile {
+		result.PreviousImage = prev.FinalImage()
 	}
 
 	enforcer := policy.NewEnforcer(config)
 	policyResult := enforcer.Evaluate(result)
+	if opts.OverrideReason != "" {
+		if err := enforcer.ApplyOverride(policyResult, opts.OverrideReason); err != nil {
+			return nil, events.Fail(&policy.PolicyError{Path: opts.PolicyFile, Profile: opts.Profile, Err: fmt.Errorf("override rejected: %w", err)})
+		}
+	}
 	result.Policy = policyResult
+	result.Compliance = compliance.Evaluate(result)
 	fmt.Println(policy.FormatPolicyStatus(policyResult))
+	if img := result.FinalImage(); img != nil {
+		if err := labelPolicy(result, img); err != nil {
+			warn("Cannot label %s with the policy result: %v", img.ImageName, err)
+		}
+	}
+	if opts.Push != "" {
+		result.Push = pushImage(result, opts.Push, opts.PushIfBetter)
+		switch {
+		case result.Push.Pushed:
+			info("Pushed: %s", result.Push.Digest)
+		case result.Push.Error != "":
+			warn("Push failed: %s", result.Push.Error)
+		default:
+			info("Not pushed to %s: %s", opts.Push, result.Push.Reason)
+		}
+	}
+	timed("policy", start)
+	events.FinishStep()
 
 	// Generate reports
 	bold.Println("📝 Generating reports...")
-	rep := reporter.New(outputDir)
+	events.StartStep("report", "Generating reports")
+	rep := reporter.New(opts.OutputDir)
 	if err := rep.GenerateAll(result); err != nil {
-		return fmt.Errorf("report generation failed: %w", err)
+		return nil, events.Fail(fmt.Errorf("report generation failed: %w", err))
+	}
+	info("Reports written to: %s/", opts.OutputDir)
+	if run, err := recordRun(result); err != nil {
+		warn("Cannot record run history: %v", err)
+	} else if run != nil {
+		info("Recorded run %s (view with dio serve)", run.ID)
 	}
-	fmt.Printf("  Reports written to: %s/\n\n", outputDir)
+	events.FinishStep()
+	fmt.Println()
 
 	// Final summary
 	bold.Println("==========================================")
-	if policyResult.Passed {
+	if policyResult.Override != nil {
+		color.New(color.FgYellow).Println("⚠️  Pipeline completed — Policy checks overridden:", policyResult.Override.Reason)
+		events.Finish(progress.StatusOverridden, "Policy checks overridden: "+policyResult.Override.Reason)
+	} else if policyResult.Passed {
 		green.Println("✅ Pipeline completed — All checks passed")
+		events.Finish(progress.StatusPassed, "All checks passed")
 	} else {
 		red.Println("❌ Pipeline completed — Policy checks FAILED")
-		os.Exit(1)
+		events.Finish(progress.StatusFailed, "Policy checks failed")
+	}
+	if len(result.Errors) > 0 {
+		color.New(color.FgYellow).Printf("⚠️  Results are partial: %s\n", stepErrorSummary(result.Errors))
 	}
 
-	return nil
+	return result, nil
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/builder"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/scanner"
+	"github.com/maxlar/docker-image-optimizer/internal/slim"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+func TestExecutePipeline_Timings(t *testing.T) {
+	// Keep the analysis cache and run history out of the real home
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	if err := os.WriteFile(dockerfile, []byte("FROM node:20\nCOPY . /app\nRUN npm ci\nCMD [\"node\", \"/app/index.js\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := pipelineOptions{Mode: "suggest", OutputDir: filepath.Join(dir, "reports"), SkipScan: true, SkipBuild: true}
+	result, err := executePipeline(dockerfile, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var steps []string
+	for _, timing := range result.Timings {
+		steps = append(steps, timing.Step)
+		if timing.Seconds < 0 {
+			t.Errorf("step %s took %fs", timing.Step, timing.Seconds)
+		}
+	}
+	if want := []string{"analyze", "optimize", "policy"}; !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected the timings in step order %v, got %v", want, steps)
+	}
+}
+
+func TestPipelineFailed(t *testing.T) {
+	stepErrors := []models.StepError{{Step: "scan", Kind: models.StepFailed, Message: "Scan failed: boom"}}
+	tests := []struct {
+		name   string
+		result models.PipelineResult
+		strict bool
+		want   bool
+	}{
+		{"passed", models.PipelineResult{Policy: &models.PolicyResult{Passed: true}}, false, false},
+		{"policy failed", models.PipelineResult{Policy: &models.PolicyResult{Passed: false}}, false, true},
+		{"push failed", models.PipelineResult{Policy: &models.PolicyResult{Passed: true}, Push: &models.PushResult{Error: "denied"}}, false, true},
+		{"push succeeded", models.PipelineResult{Policy: &models.PolicyResult{Passed: true}, Push: &models.PushResult{}}, false, false},
+		{"step errors", models.PipelineResult{Policy: &models.PolicyResult{Passed: true}, Errors: stepErrors}, false, false},
+		{"step errors strict", models.PipelineResult{Policy: &models.PolicyResult{Passed: true}, Errors: stepErrors}, true, true},
+		{"strict without errors", models.PipelineResult{Policy: &models.PolicyResult{Passed: true}}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pipelineFailed(&tt.result, tt.strict); got != tt.want {
+				t.Errorf("pipelineFailed(strict=%v) = %v, want %v", tt.strict, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddStepError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantKind   string
+		wantTarget string
+	}{
+		{"docker missing", &builder.BuildError{Build: "baseline", Err: docker.ErrNotFound}, models.StepSkipped, "baseline"},
+		{"no attestations", fmt.Errorf("inspect: %w", docker.ErrNoAttestations), models.StepSkipped, ""},
+		{"scanner missing", &scanner.ScanError{Image: "app:latest", Err: scanner.ErrNotFound}, models.StepSkipped, "app:latest"},
+		{"slim missing", slim.ErrNotFound, models.StepSkipped, ""},
+		{"build failed", &builder.BuildError{Build: "optimized", Err: errors.New("exit status 1")}, models.StepFailed, "optimized"},
+		{"scan failed", &scanner.ScanError{Image: "app:dio", Err: errors.New("timeout")}, models.StepFailed, "app:dio"},
+		{"other", errors.New("boom"), models.StepFailed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &models.PipelineResult{}
+			addStepError(result, "build", tt.err, "Step failed: %v", tt.err)
+			if len(result.Errors) != 1 {
+				t.Fatalf("expected one step error, got %+v", result.Errors)
+			}
+			got := result.Errors[0]
+			if got.Kind != tt.wantKind || got.Target != tt.wantTarget || got.Step != "build" {
+				t.Errorf("got %+v, want kind %q and target %q", got, tt.wantKind, tt.wantTarget)
+			}
+			if !strings.HasPrefix(got.Message, "Step failed: ") {
+				t.Errorf("expected the formatted message, got %q", got.Message)
+			}
+		})
+	}
+}
+
+func TestPipelineResult_ErrorsJSON(t *testing.T) {
+	result := &models.PipelineResult{}
+	addStepError(result, "scan", &scanner.ScanError{Image: "app:dio", Err: scanner.ErrNotFound}, "Scan skipped: %v", scanner.ErrNotFound)
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Errors []map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Errors) != 1 || out.Errors[0]["step"] != "scan" || out.Errors[0]["kind"] != models.StepSkipped || out.Errors[0]["target"] != "app:dio" {
+		t.Errorf("expected the step error in the JSON result, got %s", data)
+	}
+}
+
+func TestPushImage_IfBetter(t *testing.T) {
+	baseline := &models.ImageMetrics{ImageName: "app:baseline", Size: 100, SizeHuman: "100B"}
+	bigger := &models.ImageMetrics{ImageName: "app:dio", Size: 120, SizeHuman: "120B"}
+	tests := []struct {
+		name   string
+		result models.PipelineResult
+		want   string
+	}{
+		{"policy failed", models.PipelineResult{Policy: &models.PolicyResult{}, BaselineImage: baseline, OptimizedImage: bigger}, "policy checks failed"},
+		{"no baseline", models.PipelineResult{Policy: &models.PolicyResult{Passed: true}, OptimizedImage: bigger}, "there is no baseline image to compare with"},
+		{"not optimized", models.PipelineResult{Policy: &models.PolicyResult{Passed: true}, BaselineImage: baseline}, "no optimized image was built"},
+		{"bigger", models.PipelineResult{Policy: &models.PolicyResult{Passed: true}, BaselineImage: baseline, OptimizedImage: bigger}, "120B is not smaller than the baseline (100B)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pushImage(&tt.result, "registry.corp/app:1.0", true)
+			if got.Pushed || got.Error != "" || got.Reason != tt.want {
+				t.Errorf("expected the push to be skipped because %s, got %+v", tt.want, got)
+			}
+			if pipelineFailed(&tt.result, false) != !tt.result.Policy.Passed {
+				t.Error("expected a skipped push not to fail the pipeline")
+			}
+		})
+	}
+}
+
+func TestPushImage_Error(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\n  push) echo \"denied: requested access to the resource is denied\" >&2; exit 1 ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	result := &models.PipelineResult{Policy: &models.PolicyResult{Passed: true}, OptimizedImage: &models.ImageMetrics{ImageName: "app:dio"}}
+	result.Push = pushImage(result, "registry.corp/app:1.0", false)
+	if result.Push.Pushed || !strings.HasPrefix(result.Push.Error, "push to registry.corp/app:1.0 failed: ") {
+		t.Errorf("expected the push error in the result, got %+v", result.Push)
+	}
+	if !pipelineFailed(result, false) {
+		t.Error("expected a failed push to fail the pipeline")
+	}
+
+	if res := pushImage(&models.PipelineResult{}, "registry.corp/app:1.0", false); res.Error != "no image was built" {
+		t.Errorf("expected an error without an image, got %+v", res)
+	}
+}
+
+func TestParseSeverities(t *testing.T) {
+	got, err := parseSeverities([]string{"High", " critical"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"high", "critical"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSeverities() = %v, want %v", got, want)
+	}
+	if _, err := parseSeverities([]string{"high", "hihg"}); err == nil || !strings.Contains(err.Error(), `unknown severity "hihg"`) {
+		t.Errorf("expected an unknown severity to be rejected, got %v", err)
+	}
+}
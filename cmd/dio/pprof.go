@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+)
+
+// --- --pprof: profiling DIO itself ---
+
+// pprofDir is where the CPU and heap profiles of the command are written,
+// set by the --pprof flag.
+var pprofDir string
+
+// cpuProfile is the open CPU profile while profiling.
+var cpuProfile *os.File
+
+// startProfiling starts writing a CPU profile to pprofDir/cpu.pprof.
+func startProfiling() error {
+	if pprofDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(pprofDir, 0o755); err != nil {
+		return fmt.Errorf("--pprof: %w", err)
+	}
+	f, err := os.Create(filepath.Join(pprofDir, "cpu.pprof"))
+	if err != nil {
+		return fmt.Errorf("--pprof: %w", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("--pprof: %w", err)
+	}
+	cpuProfile = f
+	return nil
+}
+
+// stopProfiling finishes the CPU profile and writes a heap profile to
+// pprofDir/heap.pprof. It does nothing when profiling didn't start.
+func stopProfiling() {
+	if cpuProfile == nil {
+		return
+	}
+	pprof.StopCPUProfile()
+	cpuProfile.Close()
+	cpuProfile = nil
+
+	f, err := os.Create(filepath.Join(pprofDir, "heap.pprof"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "--pprof: %v\n", err)
+		return
+	}
+	defer f.Close()
+	// Up-to-date statistics of live objects
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		fmt.Fprintf(os.Stderr, "--pprof: %v\n", err)
+	}
+}
+
+// exit exits with code once the profiles are written. Commands use it
+// instead of os.Exit.
+func exit(code int) {
+	stopProfiling()
+	os.Exit(code)
+}
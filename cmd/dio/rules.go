@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/compliance"
+)
+
+// --- rules command ---
+
+func newRulesCmd() *cobra.Command {
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:   "rules",
+		Short: "List all built-in analyzer rules",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRules(outputFormat)
+		},
+	}
+	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format: text, json, markdown")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "explain [rule-id]",
+		Short: "Explain a rule with rationale and examples",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRulesExplain(args[0])
+		},
+	})
+
+	return cmd
+}
+
+func runRules(format string) error {
+	docs := analyzer.RuleDocs()
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(docs, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	case "markdown":
+		fmt.Print(renderRulesMarkdown(docs))
+		return nil
+	}
+
+	bold := color.New(color.Bold)
+	bold.Printf("%-8s %-9s %-16s %-9s %-7s %s\n", "ID", "SEVERITY", "CATEGORY", "RULESET", "AUTOFIX", "TITLE")
+	for _, d := range docs {
+		autofix := "no"
+		if d.AutoFixable {
+			autofix = "yes"
+		}
+		fmt.Printf("%-8s %-9s %-16s %-9s %-7s %s\n", d.ID, d.Severity, d.Category, d.Ruleset, autofix, d.Title)
+	}
+	fmt.Println()
+	fmt.Println("Run 'dio rules explain <ID>' for rationale and examples.")
+	return nil
+}
+
+func runRulesExplain(id string) error {
+	doc, ok := analyzer.LookupRuleDoc(id)
+	if !ok {
+		return fmt.Errorf("unknown rule: %s", id)
+	}
+
+	bold := color.New(color.Bold)
+	red := color.New(color.FgRed)
+	green := color.New(color.FgGreen)
+
+	bold.Printf("%s — %s\n\n", doc.ID, doc.Title)
+	fmt.Printf("Severity:    %s\n", doc.Severity)
+	fmt.Printf("Category:    %s\n", doc.Category)
+	fmt.Printf("Ruleset:     %s\n", doc.Ruleset)
+	fmt.Printf("Scope:       %s\n", doc.Scope)
+	fmt.Printf("Auto-fix:    %t\n", doc.AutoFixable)
+	if controls := compliance.ControlsFor(doc.ID); len(controls) > 0 {
+		fmt.Printf("Controls:    %s\n", strings.Join(controls, ", "))
+	}
+	fmt.Printf("Docs:        %s\n\n", doc.URL)
+	fmt.Println(doc.Rationale)
+
+	if doc.Bad != "" {
+		fmt.Println()
+		red.Println("Bad:")
+		fmt.Println(indent(doc.Bad, "  "))
+	}
+	if doc.Good != "" {
+		fmt.Println()
+		green.Println("Good:")
+		fmt.Println(indent(doc.Good, "  "))
+	}
+	return nil
+}
+
+// renderRulesMarkdown renders the rule reference published as docs/rules.md.
+func renderRulesMarkdown(docs []analyzer.RuleDoc) string {
+	var sb strings.Builder
+	sb.WriteString("# DIO Rule Reference\n\n")
+	sb.WriteString("<!-- Generated by `dio rules --format markdown`. Do not edit by hand. -->\n\n")
+	sb.WriteString("| ID | Severity | Category | Ruleset | Auto-fix | Title |\n")
+	sb.WriteString("|----|----------|----------|---------|----------|-------|\n")
+	for _, d := range docs {
+		sb.WriteString(fmt.Sprintf("| [%s](%s) | %s | %s | %s | %t | %s |\n",
+			d.ID, d.URL, d.Severity, d.Category, d.Ruleset, d.AutoFixable, d.Title))
+	}
+	sb.WriteString("\n")
+
+	for _, d := range docs {
+		if d.Ruleset != analyzer.RulesetDefault {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("## %s\n\n", strings.ToLower(d.ID)))
+		sb.WriteString(fmt.Sprintf("**%s** — %s, %s, scope: %s\n\n", d.Title, d.Severity, d.Category, d.Scope))
+		if controls := compliance.ControlsFor(d.ID); len(controls) > 0 {
+			sb.WriteString(fmt.Sprintf("Controls: %s\n\n", strings.Join(controls, ", ")))
+		}
+		sb.WriteString(d.Rationale + "\n\n")
+		if d.Bad != "" {
+			sb.WriteString("Bad:\n\n```dockerfile\n" + d.Bad + "\n```\n\n")
+		}
+		if d.Good != "" {
+			sb.WriteString("Good:\n\n```dockerfile\n" + d.Good + "\n```\n\n")
+		}
+	}
+	return sb.String()
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = prefix + l
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/dashboard"
+	"github.com/maxlar/docker-image-optimizer/internal/history"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- serve command ---
+
+func newServeCmd() *cobra.Command {
+	var (
+		addr       string
+		historyDir string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the web dashboard of recorded runs",
+		Long: `Serves a dashboard of the runs recorded by dio run: recent runs, score, size
+and CVE trends per Dockerfile, run details and diffs between runs.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(addr, historyDir)
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", "127.0.0.1:8080", "Address to listen on")
+	cmd.Flags().StringVar(&historyDir, "history", "", "History directory (default: history.dir, or ~/.dio/history)")
+	return cmd
+}
+
+func runServe(addr, historyDir string) error {
+	store := &history.Store{Dir: historyDir}
+	if store.Dir == "" {
+		cfg, err := config.LoadOrDefault(configFile)
+		if err != nil {
+			return err
+		}
+		if store, err = historyStore(cfg); err != nil {
+			return err
+		}
+	}
+
+	color.New(color.Bold).Printf("📊 DIO dashboard on http://%s (history: %s)\n", addr, store.Dir)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           dashboard.Handler(store),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+// historyStore returns the run history configured in cfg.
+func historyStore(cfg *config.Config) (*history.Store, error) {
+	dir := cfg.History.Dir
+	if dir == "" {
+		var err error
+		if dir, err = history.DefaultDir(); err != nil {
+			return nil, err
+		}
+	}
+	return &history.Store{Dir: dir}, nil
+}
+
+// recordRun saves a pipeline result to the run history, unless recording
+// is turned off with history.enabled: false. It returns nil when not
+// recorded.
+func recordRun(result *models.PipelineResult) (*history.Run, error) {
+	cfg, err := config.LoadOrDefault(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.History.Enabled != nil && !*cfg.History.Enabled {
+		return nil, nil
+	}
+	store, err := historyStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return store.Save(result)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/reporter"
+	"github.com/maxlar/docker-image-optimizer/internal/slim"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// --- slim command ---
+
+func newSlimCmd() *cobra.Command {
+	var (
+		tag           string
+		format        string
+		httpProbe     bool
+		continueAfter string
+		includePaths  []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "slim [image]",
+		Short: "Minify an image to the files it uses at runtime (mint / docker-slim)",
+		Long: `Runs the image with mint (formerly docker-slim) instrumentation, records the
+files it actually uses and builds a minimal image with only those, then reports
+the size effect and the removed content by directory.
+
+Settings default to the slim section of .dio.yaml; flags override them.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadOrDefault(configFile)
+			if err != nil {
+				return err
+			}
+			opts := slimOptions(cfg.Slim)
+			if cmd.Flags().Changed("http-probe") {
+				opts.HTTPProbe = httpProbe
+			}
+			if continueAfter != "" {
+				opts.ContinueAfter = continueAfter
+			}
+			opts.IncludePaths = append(opts.IncludePaths, includePaths...)
+			return runSlim(args[0], tag, format, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&tag, "tag", "t", "", "Tag of the minified image (default: the image's tag with a -slim suffix)")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text, json, markdown")
+	cmd.Flags().BoolVar(&httpProbe, "http-probe", false, "Exercise exposed ports with HTTP requests while observing the image")
+	cmd.Flags().StringVar(&continueAfter, "continue-after", "", "When to stop observing: probe, exec, container.exit or a number of seconds")
+	cmd.Flags().StringSliceVar(&includePaths, "include-path", nil, "Path to keep even if unused (repeatable)")
+	return cmd
+}
+
+// slimOptions converts the slim section of .dio.yaml.
+func slimOptions(cfg config.SlimConfig) slim.Options {
+	return slim.Options{
+		HTTPProbe:     cfg.HTTPProbe,
+		ContinueAfter: cfg.ContinueAfter,
+		IncludePaths:  append([]string(nil), cfg.IncludePaths...),
+	}
+}
+
+// slimTag derives the minified image's tag: app:1.2 becomes app:1.2-slim.
+func slimTag(image string) string {
+	repo, tag := image, "latest"
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo = repo[:i]
+	} else if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo, tag = repo[:i], repo[i+1:]
+	}
+	return repo + ":" + tag + "-slim"
+}
+
+func runSlim(image, tag, format string, opts slim.Options) error {
+	if err := checkFormat(format, "text", "json", "markdown"); err != nil {
+		return err
+	}
+	if tag == "" {
+		tag = slimTag(image)
+	}
+	sl, err := slim.New()
+	if err != nil {
+		return err
+	}
+	client, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	bold := color.New(color.Bold)
+	if format == "text" {
+		bold.Printf("🪶 Minifying %s with %s...\n\n", image, sl.Tool())
+	}
+	result, err := sl.Minify(client, image, tag, opts)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		return printJSON(result)
+	case "markdown":
+		fmt.Print(reporter.SlimMarkdown(result))
+		return nil
+	}
+
+	original := result.Image.Size - result.SizeDiff
+	pct := float64(0)
+	if original > 0 {
+		pct = float64(-result.SizeDiff) / float64(original) * 100
+	}
+	fmt.Printf("  Original: %s\n", docker.HumanSize(original))
+	color.New(color.FgGreen).Printf("  Minified: %s — %s (-%.1f%%)\n", result.Image.ImageName, result.Image.SizeHuman, pct)
+	fmt.Printf("  Removed:  %d files, %s\n", result.RemovedFiles, docker.HumanSize(result.RemovedBytes))
+	if len(result.Removed) > 0 {
+		fmt.Println()
+		bold.Println("Largest removed directories:")
+		for _, p := range result.Removed {
+			fmt.Printf("  %-40s %6d files  %s\n", p.Path, p.Files, docker.HumanSize(p.Bytes))
+		}
+	}
+	return nil
+}
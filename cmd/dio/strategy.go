@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/builder"
+	"github.com/maxlar/docker-image-optimizer/internal/strategytest"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// --- strategy command ---
+
+func newStrategyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "strategy",
+		Short: "Work on optimizer strategies",
+	}
+
+	var (
+		strategies []string
+		noBuiltin  bool
+		format     string
+		keepImages bool
+	)
+	testCmd := &cobra.Command{
+		Use:   "test [fixture...]",
+		Short: "Build fixture Dockerfiles before and after each strategy and report broken builds",
+		Long: `Runs each optimizer strategy alone, in autofix mode, against a corpus of
+fixture Dockerfiles: the built-in node, python, go and static site fixtures
+plus any given Dockerfiles or directories holding a Dockerfile. Each fixture
+is copied to a temporary build context and built unchanged, then once per
+strategy that changes it. A strategy whose Dockerfile no longer builds is
+reported as broken, with the diagnosed cause of the failure.
+
+Use it while developing a strategy:
+
+  dio strategy test --strategy multi-stage-build ./fixtures/*
+
+The command exits with status 1 when a strategy broke a fixture.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStrategyTest(args, strategies, noBuiltin, format, keepImages)
+		},
+	}
+	testCmd.Flags().StringSliceVarP(&strategies, "strategy", "s", nil, "Only test these strategies (default: all)")
+	testCmd.Flags().BoolVar(&noBuiltin, "no-builtin", false, "Only test the given fixtures, not the built-in ones")
+	testCmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text, json, markdown")
+	testCmd.Flags().BoolVar(&keepImages, "keep-images", false, "Keep the built images instead of removing them")
+	cmd.AddCommand(testCmd)
+
+	return cmd
+}
+
+func runStrategyTest(paths, strategies []string, noBuiltin bool, format string, keepImages bool) error {
+	if err := checkFormat(format, "text", "json", "markdown"); err != nil {
+		return err
+	}
+	var fixtures []strategytest.Fixture
+	if !noBuiltin {
+		fixtures = strategytest.Builtin()
+	}
+	for _, p := range paths {
+		f, err := strategytest.Load(p)
+		if err != nil {
+			return err
+		}
+		fixtures = append(fixtures, f)
+	}
+	if len(fixtures) == 0 {
+		return fmt.Errorf("no fixtures: pass Dockerfiles or directories, or drop --no-builtin")
+	}
+
+	retryPol, err := retryPolicy()
+	if err != nil {
+		return err
+	}
+	b, err := builder.New()
+	if err != nil {
+		return err
+	}
+	b.SetRetry(retryPol)
+
+	bold := color.New(color.Bold)
+	green := color.New(color.FgGreen)
+	red := color.New(color.FgRed)
+	opts := strategytest.Options{Strategies: strategies}
+	if format == "text" {
+		bold.Printf("🧪 Testing strategies on %d fixtures...\n\n", len(fixtures))
+		opts.OnResult = func(fixture string, r strategytest.Result) {
+			switch r.Status {
+			case strategytest.StatusPassed:
+				green.Printf("  ✅ %s on %s: %s\n", r.Strategy, fixture, docker.HumanSize(r.Size))
+			case strategytest.StatusBroken:
+				red.Printf("  ❌ %s on %s\n", r.Strategy, fixture)
+				for _, d := range r.Diagnoses {
+					fmt.Printf("     %s\n     → %s\n", d.Message, d.Hint)
+				}
+			default:
+				fmt.Printf("  —  %s on %s: not applicable\n", r.Strategy, fixture)
+			}
+		}
+	}
+
+	report, err := strategytest.Run(fixtures, b.BuildOptimized, opts)
+	if err != nil {
+		return err
+	}
+	if !keepImages {
+		b.Cleanup(report.Images()...)
+	}
+
+	switch format {
+	case "json":
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	case "markdown":
+		fmt.Print(report.Markdown())
+	default:
+		fmt.Println()
+		for _, f := range report.Fixtures {
+			if f.Error != "" {
+				color.New(color.FgYellow).Printf("⚠ Fixture %s doesn't build unchanged; its strategies were not tested\n", f.Name)
+			}
+		}
+		if broken := report.Broken(); len(broken) > 0 {
+			red.Printf("❌ Broken builds from: %s\n", strings.Join(broken, ", "))
+		} else {
+			green.Println("✅ No strategy broke a fixture")
+		}
+	}
+
+	if len(report.Broken()) > 0 {
+		exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/reporter"
+	"github.com/maxlar/docker-image-optimizer/internal/tickets"
+)
+
+// --- tickets command ---
+
+func newTicketsCmd() *cobra.Command {
+	var (
+		provider string
+		dryRun   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "tickets [report.json]",
+		Short: "Create or update Jira/GitHub issues for policy failures and critical CVEs",
+		Long: `Exports the findings of a JSON report (default: reports/report.json) to the
+issue tracker configured under tickets: in .dio.yaml. Findings that already
+have an open ticket update it instead of filing a duplicate.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reportPath := filepath.Join("reports", "report.json")
+			if len(args) > 0 {
+				reportPath = args[0]
+			}
+			return runTickets(reportPath, provider, dryRun)
+		},
+	}
+
+	cmd.Flags().StringVar(&provider, "provider", "", "Issue tracker: github or jira (overrides tickets.provider)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the findings that would be exported without contacting the tracker")
+	return cmd
+}
+
+func runTickets(reportPath, provider string, dryRun bool) error {
+	bold := color.New(color.Bold)
+
+	result, err := reporter.LoadResult(reportPath)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("report %s not found", reportPath)
+	}
+
+	cfg, err := config.LoadOrDefault(configFile)
+	if err != nil {
+		return err
+	}
+	tc := cfg.Tickets
+	if provider != "" {
+		tc.Provider = provider
+	}
+	if len(tc.Labels) == 0 {
+		tc.Labels = []string{"dio"}
+	}
+
+	// tickets.min_severity takes precedence over the threshold in .dio.yaml,
+	// but not over --threshold
+	minSeverity := models.Severity(tc.MinSeverity)
+	if threshold != "" || minSeverity == "" {
+		sev, err := severityThreshold()
+		if err != nil {
+			return err
+		}
+		if sev != "" {
+			minSeverity = sev
+		}
+	}
+	findings := tickets.Findings(result, tickets.Options{MinSeverity: minSeverity})
+	bold.Printf("🎫 %d finding(s) in %s\n\n", len(findings), reportPath)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	if dryRun {
+		for _, f := range findings {
+			fmt.Printf("  [%s] %s (%s)\n", f.Severity, f.Title, f.Fingerprint)
+		}
+		return nil
+	}
+
+	tracker, err := newTracker(tc)
+	if err != nil {
+		return err
+	}
+	summary, err := tickets.Export(tracker, findings)
+	if summary != nil {
+		for _, id := range summary.Created {
+			fmt.Printf("  + created %s\n", id)
+		}
+		for _, id := range summary.Updated {
+			fmt.Printf("  ~ updated %s\n", id)
+		}
+	}
+	return err
+}
+
+// newTracker creates the issue tracker client from the tickets config.
+func newTracker(tc config.TicketsConfig) (tickets.Tracker, error) {
+	switch tc.Provider {
+	case "github":
+		if tc.GitHub.Repo == "" {
+			return nil, fmt.Errorf("tickets.github.repo is required")
+		}
+		return &tickets.GitHub{
+			Repo:   tc.GitHub.Repo,
+			APIURL: tc.GitHub.APIURL,
+			Token:  os.Getenv(envOr(tc.GitHub.TokenEnv, "GITHUB_TOKEN")),
+			Labels: tc.Labels,
+		}, nil
+	case "jira":
+		if tc.Jira.URL == "" || tc.Jira.Project == "" {
+			return nil, fmt.Errorf("tickets.jira.url and tickets.jira.project are required")
+		}
+		return &tickets.Jira{
+			URL:       tc.Jira.URL,
+			Project:   tc.Jira.Project,
+			IssueType: tc.Jira.IssueType,
+			User:      os.Getenv(envOr(tc.Jira.UserEnv, "JIRA_USER")),
+			Token:     os.Getenv(envOr(tc.Jira.TokenEnv, "JIRA_TOKEN")),
+			Labels:    tc.Labels,
+		}, nil
+	case "":
+		return nil, fmt.Errorf("no issue tracker configured (set tickets.provider in %s or pass --provider)", config.DefaultFileName)
+	}
+	return nil, fmt.Errorf("unsupported issue tracker %q (use github or jira)", tc.Provider)
+}
+
+func envOr(name, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+	return name
+}
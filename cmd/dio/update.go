@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/update"
+)
+
+// --- self-update command ---
+
+func newSelfUpdateCmd() *cobra.Command {
+	var check bool
+
+	cmd := &cobra.Command{
+		Use:   "self-update",
+		Short: "Update dio to the latest GitHub release",
+		Long: `Downloads the latest release binary for this platform, verifies it against
+the release's checksums.txt and replaces the running executable.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSelfUpdate(check)
+		},
+	}
+
+	cmd.Flags().BoolVar(&check, "check", false, "Only report whether a newer version is available")
+	return cmd
+}
+
+func runSelfUpdate(check bool) error {
+	green := color.New(color.FgGreen)
+
+	client := &update.Client{}
+	rel, err := client.Latest()
+	if err != nil {
+		return err
+	}
+	if !update.Newer(rel.Version, version) {
+		green.Printf("✅ dio %s is up to date\n", version)
+		return nil
+	}
+
+	fmt.Printf("⬆️  dio %s is available (current: %s)\n", rel.Version, version)
+	if rel.URL != "" {
+		fmt.Printf("   %s\n", rel.URL)
+	}
+	if check {
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot locate the running executable: %w", err)
+	}
+	if err := client.Apply(rel, exe); err != nil {
+		return err
+	}
+	green.Printf("✅ Updated %s to %s\n", exe, rel.Version)
+	return nil
+}
+
+// printUpdateNotice prints a notice to stderr when updates.notify is set in
+// the config and a newer release exists. It never fails the command.
+func printUpdateNotice(cmd *cobra.Command) {
+	if cmd.Name() == "self-update" {
+		return
+	}
+	cfg, err := config.LoadOrDefault(configFile)
+	if err != nil || !cfg.Updates.Notify {
+		return
+	}
+	statePath, err := update.DefaultStatePath()
+	if err != nil {
+		return
+	}
+	client := &update.Client{}
+	if notice := client.Notice(version, statePath); notice != "" {
+		fmt.Fprintln(os.Stderr)
+		color.New(color.FgYellow).Fprintln(os.Stderr, "💡 "+notice)
+	}
+}
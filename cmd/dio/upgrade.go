@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/git"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/pullrequest"
+	"github.com/maxlar/docker-image-optimizer/internal/scanner"
+	"github.com/maxlar/docker-image-optimizer/internal/upgrade"
+)
+
+// --- update command ---
+
+func newUpdateCmd() *cobra.Command {
+	var (
+		level    string
+		dryRun   bool
+		pr       bool
+		provider string
+		skipScan bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "update [Dockerfile]",
+		Short: "Bump base image tags to their newest patch or minor versions",
+		Long: `Looks up the tags of each base image of a Dockerfile in its registry and
+rewrites the FROM instructions to the newest patch or minor version with the
+same variant, e.g. node:20.11-alpine to node:20.12-alpine. Major versions are
+never proposed.
+
+With --pr, the change is pushed to a branch of its own instead, and a pull
+request is opened on the forge configured under pull_requests: in .dio.yaml,
+listing how the vulnerability counts of the images change.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dockerfilePath, err := analyzer.FindDockerfile(args[0])
+			if err != nil {
+				return err
+			}
+			return runUpdate(dockerfilePath, level, dryRun, pr, provider, skipScan)
+		},
+	}
+
+	cmd.Flags().StringVar(&level, "level", upgrade.LevelMinor, "Newest update allowed: patch or minor")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the updates without rewriting the Dockerfile")
+	cmd.Flags().BoolVar(&pr, "pr", false, "Push the update to a new branch and open a pull request")
+	cmd.Flags().StringVar(&provider, "provider", "", "Forge: github or gitlab (overrides pull_requests.provider)")
+	cmd.Flags().BoolVar(&skipScan, "skip-scan", false, "Don't scan the images for the vulnerability delta of the pull request")
+	return cmd
+}
+
+func runUpdate(dockerfilePath, level string, dryRun, pr bool, provider string, skipScan bool) error {
+	bold := color.New(color.Bold)
+	warn := color.New(color.FgYellow)
+
+	if level != upgrade.LevelPatch && level != upgrade.LevelMinor {
+		return fmt.Errorf("invalid --level %q (use patch or minor)", level)
+	}
+	data, err := os.ReadFile(dockerfilePath)
+	if err != nil {
+		return err
+	}
+	content := string(data)
+	if updater := analyzer.DetectUpdater(dockerfilePath); updater != "" {
+		warn.Printf("⚠ %s already updates the base images of this repository; its pull requests may duplicate these updates\n\n", updater)
+	}
+
+	tags, err := registryClient("", "")
+	if err != nil {
+		return err
+	}
+	updates, err := upgrade.Find(content, tags, level)
+	if err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			warn.Printf("⚠ Cannot list tags of %s\n", line)
+		}
+	}
+	if len(updates) == 0 {
+		color.New(color.FgGreen).Printf("✅ The base images of %s are up to date\n", dockerfilePath)
+		return nil
+	}
+
+	bold.Printf("⬆️  %d base image update(s) for %s\n\n", len(updates), dockerfilePath)
+	for _, u := range updates {
+		fmt.Printf("  line %-4d %s → %s (%s)\n", u.Line, u.From, u.To, u.Level)
+	}
+	fmt.Println()
+	if dryRun {
+		return nil
+	}
+
+	updated := upgrade.Apply(content, updates)
+	if !pr {
+		if err := writeKeepingMode(dockerfilePath, updated); err != nil {
+			return err
+		}
+		color.New(color.FgGreen).Printf("✅ Updated %s\n", dockerfilePath)
+		return nil
+	}
+
+	cfg, err := config.LoadOrDefault(configFile)
+	if err != nil {
+		return err
+	}
+	pc := cfg.PullRequests
+	if provider != "" {
+		pc.Provider = provider
+	}
+	if len(pc.Labels) == 0 {
+		pc.Labels = []string{"dio", "dependencies"}
+	}
+	opener, err := newOpener(pc)
+	if err != nil {
+		return err
+	}
+	// The branch carries only dio's change: edits of the Dockerfile in the
+	// work tree would be committed along and leave it
+	if modified, err := git.Modified(dockerfilePath); err != nil {
+		return fmt.Errorf("--pr needs %s in a git work tree: %w", dockerfilePath, err)
+	} else if modified {
+		return fmt.Errorf("%s has uncommitted changes; commit or stash them first", dockerfilePath)
+	}
+	base := pc.BaseBranch
+	if base == "" {
+		if info := git.Detect(dockerfilePath); info != nil {
+			base = info.Branch
+		}
+		if base == "" {
+			return fmt.Errorf("cannot tell the branch to open the pull request against (set pull_requests.base_branch in %s)", config.DefaultFileName)
+		}
+	}
+
+	scans := make(map[string]*models.ScanResult)
+	if !skipScan {
+		sc, err := scanner.New()
+		if err != nil {
+			warn.Printf("⚠ Cannot scan, the pull request lists no vulnerability delta: %v\n", err)
+		} else {
+			for _, u := range updates {
+				for _, ref := range []string{u.From, u.To} {
+					if _, ok := scans[ref]; ok {
+						continue
+					}
+					fmt.Printf("🔍 Scanning %s...\n", ref)
+					res, err := sc.Scan(ref)
+					if err != nil {
+						warn.Printf("⚠ Scan of %s failed: %v\n", ref, err)
+					}
+					scans[ref] = res
+				}
+			}
+		}
+	}
+
+	path := filepath.ToSlash(dockerfilePath)
+	title := upgrade.Title(path, updates)
+	branch := updateBranch(path, updated)
+	if err := writeKeepingMode(dockerfilePath, updated); err != nil {
+		return err
+	}
+	remote := envOr(pc.Remote, "origin")
+	if err := git.PushBranch(filepath.Dir(dockerfilePath), remote, branch, title, filepath.Base(dockerfilePath)); err != nil {
+		return err
+	}
+	fmt.Printf("🚀 Pushed %s to %s\n", branch, remote)
+
+	url, err := opener.Open(pullrequest.Request{
+		Title:  title,
+		Body:   upgrade.Description(path, updates, scans),
+		Head:   branch,
+		Base:   base,
+		Labels: pc.Labels,
+	})
+	if err != nil {
+		return err
+	}
+	color.New(color.FgGreen).Printf("✅ Opened %s\n", url)
+	return nil
+}
+
+// newOpener creates the pull request client from the pull_requests config.
+func newOpener(pc config.PullRequestsConfig) (pullrequest.Opener, error) {
+	switch pc.Provider {
+	case "github":
+		if pc.GitHub.Repo == "" {
+			return nil, fmt.Errorf("pull_requests.github.repo is required")
+		}
+		return &pullrequest.GitHub{
+			Repo:   pc.GitHub.Repo,
+			APIURL: pc.GitHub.APIURL,
+			Token:  os.Getenv(envOr(pc.GitHub.TokenEnv, "GITHUB_TOKEN")),
+		}, nil
+	case "gitlab":
+		if pc.GitLab.Project == "" {
+			return nil, fmt.Errorf("pull_requests.gitlab.project is required")
+		}
+		return &pullrequest.GitLab{
+			Project: pc.GitLab.Project,
+			APIURL:  pc.GitLab.APIURL,
+			Token:   os.Getenv(envOr(pc.GitLab.TokenEnv, "GITLAB_TOKEN")),
+		}, nil
+	case "":
+		return nil, fmt.Errorf("no forge configured (set pull_requests.provider in %s or pass --provider)", config.DefaultFileName)
+	}
+	return nil, fmt.Errorf("unsupported forge %q (use github or gitlab)", pc.Provider)
+}
+
+var branchUnsafe = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// updateBranch names the branch of an update of the Dockerfile at path
+// after the path and the updated content, so the same update reuses its
+// branch name and a different one doesn't collide with it.
+func updateBranch(path, updated string) string {
+	slug := strings.Trim(branchUnsafe.ReplaceAllString(strings.ToLower(path), "-"), "-")
+	sum := sha256.Sum256([]byte(updated))
+	return fmt.Sprintf("dio/update-%s-%x", slug, sum[:4])
+}
+
+// writeKeepingMode overwrites the file at path, keeping its permissions.
+func writeKeepingMode(path, content string) error {
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	return os.WriteFile(path, []byte(content), mode)
+}
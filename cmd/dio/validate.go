@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/policy"
+	"github.com/maxlar/docker-image-optimizer/internal/schema"
+)
+
+// --- validate command ---
+
+// schemaURL is where the JSON Schemas in schemas/ are published.
+const schemaURL = "https://raw.githubusercontent.com/maxlar/docker-image-optimizer/main/schemas/"
+
+// fileKind is a kind of file dio validate checks.
+type fileKind struct {
+	Type   reflect.Type
+	Title  string
+	Schema string // file name in schemas/
+}
+
+var fileKinds = map[string]fileKind{
+	"config": {reflect.TypeOf(config.Config{}), "DIO configuration (.dio.yaml)", "dio.schema.json"},
+	"policy": {reflect.TypeOf(policy.File{}), "DIO policy", "policy.schema.json"},
+}
+
+func newValidateCmd() *cobra.Command {
+	var kind, schemaKind string
+
+	cmd := &cobra.Command{
+		Use:   "validate [file...]",
+		Short: "Check .dio.yaml and policy files for unknown keys and invalid values",
+		Long: `Check .dio.yaml and policy files for unknown keys, mistyped values and
+settings that don't parse, reporting each problem with its line and column.
+Files named .dio.yaml are checked as configuration, others as policies.
+Without files, the configuration in use is checked.
+
+With --schema, print the JSON Schema of a kind of file instead, for editors.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if schemaKind != "" {
+				return printSchema(schemaKind)
+			}
+			if kind != "" {
+				if _, ok := fileKinds[kind]; !ok {
+					return fmt.Errorf("unknown --kind %q (valid: config, policy)", kind)
+				}
+			}
+			if len(args) == 0 {
+				path := configFile
+				if path == "" {
+					path = config.DefaultFileName
+				}
+				if _, err := os.Stat(path); err != nil {
+					return fmt.Errorf("no file to validate: %w", err)
+				}
+				args, kind = []string{path}, "config"
+			}
+			return runValidate(args, kind)
+		},
+	}
+	cmd.Flags().StringVar(&kind, "kind", "", "Kind of the files: config or policy (default: from the file name)")
+	cmd.Flags().StringVar(&schemaKind, "schema", "", "Print the JSON Schema of config or policy files")
+	return cmd
+}
+
+func printSchema(kind string) error {
+	k, ok := fileKinds[kind]
+	if !ok {
+		return fmt.Errorf("unknown schema %q (valid: config, policy)", kind)
+	}
+	data, err := json.MarshalIndent(schema.Generate(k.Type, schemaURL+k.Schema, k.Title), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// fileKindOf picks the kind of a file from its name.
+func fileKindOf(path string) string {
+	name := filepath.Base(path)
+	if name == ".dio.yaml" || name == ".dio.yml" || strings.HasSuffix(name, ".dio.yaml") || strings.HasSuffix(name, ".dio.yml") {
+		return "config"
+	}
+	return "policy"
+}
+
+func runValidate(paths []string, kind string) error {
+	red := color.New(color.FgRed)
+	green := color.New(color.FgGreen)
+	failed := 0
+	for _, path := range paths {
+		k := kind
+		if k == "" {
+			k = fileKindOf(path)
+		}
+		problems, err := validateFile(path, k)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		if len(problems) == 0 {
+			green.Printf("✅ %s: valid %s file\n", path, k)
+			continue
+		}
+		failed++
+		red.Printf("❌ %s: %d problem(s) in %s file\n", path, len(problems), k)
+		for _, p := range problems {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	if failed > 0 {
+		exit(1)
+	}
+	return nil
+}
+
+// validateFile checks a file against the schema of its kind and loads it
+// like the commands using it would, a policy with each of its profiles and
+// the files it extends. Problems are returned as path:line:column:
+// messages; the error is for a file that can't be read, isn't YAML or
+// doesn't load.
+func validateFile(path, kind string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if kind == "config" {
+		errs, err := schema.Validate(data, fileKinds[kind].Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(errs) > 0 {
+			return positioned(path, errs), nil
+		}
+		cfg, err := config.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return nil, nil
+	}
+
+	// The policy loader rejects unknown keys itself, and accepts renamed
+	// ones with a notice
+	opts, err := policyOptions()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := policy.LoadConfigWithOptions(path, "", opts); err != nil {
+		var fileErr *policy.FileError
+		if errors.As(err, &fileErr) {
+			return positioned(fileErr.Path, fileErr.Problems), nil
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var file policy.File
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	profiles := make([]string, 0, len(file.Profiles))
+	for name := range file.Profiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	// Notices were printed by the first load
+	opts.Warn = nil
+	var problems []string
+	for _, profile := range profiles {
+		if _, err := policy.LoadConfigWithOptions(path, profile, opts); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: profile %s: %v", path, profile, err))
+		}
+	}
+	return problems, nil
+}
+
+// positioned formats schema problems of the file at path.
+func positioned(path string, errs []schema.Error) []string {
+	problems := make([]string, len(errs))
+	for i, e := range errs {
+		problems[i] = fmt.Sprintf("%s:%s", path, e.Error())
+	}
+	return problems
+}
@@ -11,22 +11,52 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/maxlar/docker-image-optimizer/internal/config"
 	"github.com/maxlar/docker-image-optimizer/internal/models"
 )
 
-// Analyzer performs static analysis on Dockerfiles.
+// Analyzer performs static analysis on Dockerfiles. Once configured, an
+// Analyzer is safe for concurrent use by multiple goroutines.
 type Analyzer struct {
 	rules       []Rule
 	useHadolint bool
+	hadolint    config.HadolintConfig
+	// hadolintSeverities is hadolint.severity_map, parsed
+	hadolintSeverities map[string]models.Severity
+	// useShellcheck checks the scripts of RUN instructions with shellcheck
+	useShellcheck bool
+	shellcheck    config.ShellcheckConfig
+	ruleOptions   map[string]map[string]interface{}
+	buildArgs     map[string]string
+	target        string
+	threshold     models.Severity
+	cache         *Cache
+	// updater is the analyzer.updater setting: a forced updater,
+	// UpdaterNone, or "" to detect it.
+	updater string
+	// image declares the image kind, or has it detected
+	image config.ImageConfig
+	// golden is the golden image catalog DIO035 holds final images to
+	golden []config.GoldenImage
+	// buildCheck runs docker build --check when enabled
+	buildCheck config.BuildCheckConfig
+	// trivy runs trivy config when enabled
+	trivy config.TrivyConfig
 }
 
 // New creates a new Analyzer with all built-in rules registered.
-// Hadolint integration is enabled automatically if the binary is found in PATH.
+// Hadolint and shellcheck integrations are enabled automatically if their
+// binaries are found in PATH.
 func New() *Analyzer {
 	a := &Analyzer{
-		useHadolint: isHadolintAvailable(),
+		useHadolint:   isHadolintAvailable(),
+		useShellcheck: isShellcheckAvailable(),
 	}
 	a.rules = DefaultRules()
 	return a
@@ -35,13 +65,158 @@ func New() *Analyzer {
 // NewWithOptions creates a new Analyzer with explicit configuration.
 func NewWithOptions(enableHadolint bool) *Analyzer {
 	a := &Analyzer{
-		useHadolint: enableHadolint && isHadolintAvailable(),
+		useHadolint:   enableHadolint && isHadolintAvailable(),
+		useShellcheck: isShellcheckAvailable(),
 	}
 	a.rules = DefaultRules()
 	return a
 }
 
-// Analyze reads a Dockerfile and runs all rules against it.
+// NewWithRules creates an Analyzer that runs only the given rules, without
+// hadolint. It is meant for testing rules in isolation.
+func NewWithRules(rules ...Rule) *Analyzer {
+	return &Analyzer{rules: rules}
+}
+
+// NewWithConfig creates a new Analyzer configured from a .dio.yaml file.
+// Hadolint and shellcheck are auto-detected unless explicitly enabled or
+// disabled.
+func NewWithConfig(cfg *config.Config) (*Analyzer, error) {
+	useHadolint := isHadolintAvailable()
+	if cfg.Hadolint.Enabled != nil {
+		useHadolint = *cfg.Hadolint.Enabled && useHadolint
+	}
+	useShellcheck := isShellcheckAvailable()
+	if cfg.Shellcheck.Enabled != nil {
+		useShellcheck = *cfg.Shellcheck.Enabled && useShellcheck
+	}
+	a := &Analyzer{
+		useHadolint:   useHadolint,
+		hadolint:      cfg.Hadolint,
+		useShellcheck: useShellcheck,
+		shellcheck:    cfg.Shellcheck,
+		buildCheck:    cfg.BuildCheck,
+		trivy:         cfg.Trivy,
+		ruleOptions:   cfg.Analyzer.RuleOptions,
+		updater:       cfg.Analyzer.Updater,
+	}
+	switch a.updater {
+	case "", "auto":
+		a.updater = ""
+	case UpdaterRenovate, UpdaterDependabot, UpdaterNone:
+	default:
+		return nil, fmt.Errorf("invalid analyzer.updater %q (use auto, renovate, dependabot or none)", a.updater)
+	}
+	severities, err := parseSeverityMap(cfg.Hadolint.SeverityMap)
+	if err != nil {
+		return nil, err
+	}
+	a.hadolintSeverities = severities
+	if err := validateImageConfig(cfg.Image); err != nil {
+		return nil, err
+	}
+	a.image = cfg.Image
+	a.golden = cfg.GoldenImages.Images
+	if cfg.Threshold != "" {
+		threshold, err := models.ParseSeverity(cfg.Threshold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid threshold: %w", err)
+		}
+		a.threshold = threshold
+	}
+	a.rules = DefaultRules()
+	switch cfg.Analyzer.Ruleset {
+	case "", RulesetDefault:
+	case RulesetExtended:
+		a.rules = append(a.rules, ExtendedRules()...)
+	default:
+		return nil, fmt.Errorf("invalid analyzer.ruleset %q (use %s or %s)", cfg.Analyzer.Ruleset, RulesetDefault, RulesetExtended)
+	}
+
+	rules := make(map[string]Rule, len(a.rules))
+	for _, rule := range a.rules {
+		rules[rule.ID()] = rule
+	}
+	ids := make([]string, 0, len(cfg.Analyzer.RuleOptions))
+	for id := range cfg.Analyzer.RuleOptions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		rule, ok := rules[id]
+		if !ok {
+			if isExtendedRule(id) {
+				return nil, fmt.Errorf("rule %s in analyzer.rule_options is only in the %s ruleset (set analyzer.ruleset: %s)", id, RulesetExtended, RulesetExtended)
+			}
+			return nil, fmt.Errorf("unknown rule %s in analyzer.rule_options", id)
+		}
+		options := cfg.Analyzer.RuleOptions[id]
+		configurable, ok := rule.(ConfigurableRule)
+		if !ok {
+			return nil, fmt.Errorf("rule %s does not accept options", rule.ID())
+		}
+		if err := configurable.Configure(options); err != nil {
+			return nil, fmt.Errorf("invalid options for rule %s: %w", rule.ID(), err)
+		}
+	}
+	return a, nil
+}
+
+// SetBuildArgs sets --build-arg values used to resolve ARG references in
+// FROM instructions. It must not be called while an analysis is running.
+func (a *Analyzer) SetBuildArgs(args map[string]string) {
+	a.buildArgs = args
+}
+
+// SetTarget makes the named stage the final one, like docker build
+// --target: final-stage rules evaluate it instead of the last stage. Empty
+// analyzes the last stage. It must not be called while an analysis is
+// running.
+func (a *Analyzer) SetTarget(stage string) {
+	a.target = stage
+}
+
+// SetImage sets the image section of .dio.yaml: the declared image kind,
+// or auto to detect it, and the severities of rules by kind. NewWithConfig
+// validates it. It must not be called while an analysis is running.
+func (a *Analyzer) SetImage(cfg config.ImageConfig) {
+	a.image = cfg
+}
+
+// SetGoldenImages sets the golden image catalog of .dio.yaml. With none,
+// DIO035 reports nothing. It must not be called while an analysis is
+// running.
+func (a *Analyzer) SetGoldenImages(images []config.GoldenImage) {
+	a.golden = images
+}
+
+// parse parses Dockerfile lines with the build args and target stage of
+// the analyzer.
+func (a *Analyzer) parse(lines []string) (*ParsedDockerfile, error) {
+	pdf := parseDockerfileWithArgs(lines, a.buildArgs)
+	if a.target != "" {
+		if pdf.StageIndex(a.target) < 0 {
+			return nil, fmt.Errorf("target stage %q not found", a.target)
+		}
+		pdf.Target = a.target
+	}
+	return pdf, nil
+}
+
+// SetThreshold sets the lowest severity that lowers the score. Issues
+// below it are still reported. An empty threshold scores every issue.
+func (a *Analyzer) SetThreshold(threshold models.Severity) {
+	a.threshold = threshold
+}
+
+// SetCache enables caching of Analyze results. A nil cache disables it.
+func (a *Analyzer) SetCache(c *Cache) {
+	a.cache = c
+}
+
+// Analyze reads a Dockerfile and runs all rules against it. With a cache
+// set, an unchanged Dockerfile analyzed with the same settings returns the
+// cached result instead.
 func (a *Analyzer) Analyze(dockerfilePath string) (*models.AnalysisResult, error) {
 	content, err := os.ReadFile(dockerfilePath)
 	if err != nil {
@@ -49,75 +224,231 @@ func (a *Analyzer) Analyze(dockerfilePath string) (*models.AnalysisResult, error
 	}
 
 	lines := strings.Split(string(content), "\n")
+	pdf, err := a.parse(lines)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dockerfilePath, err)
+	}
 	ctx := &AnalysisContext{
-		FilePath:   dockerfilePath,
-		Content:    string(content),
-		Lines:      lines,
-		ParsedFile: parseDockerfile(lines),
+		FilePath:     dockerfilePath,
+		Content:      string(content),
+		Lines:        lines,
+		ParsedFile:   pdf,
+		GoldenImages: a.golden,
 	}
 
-	// Check for .dockerignore
+	// Check for .dockerignore, or .containerignore
 	dir := filepath.Dir(dockerfilePath)
-	if _, err := os.Stat(filepath.Join(dir, ".dockerignore")); os.IsNotExist(err) {
+	ignoreFile := IgnoreFile(dir)
+	ctx.IgnoreFile = filepath.Base(ignoreFile)
+	if patterns, err := parseDockerignore(ignoreFile); os.IsNotExist(err) {
 		ctx.MissingDockerignore = true
+	} else if err == nil {
+		ctx.UncoveredContextDirs = uncoveredContextDirs(dir, patterns)
+	}
+	ctx.Updater = a.updater
+	if ctx.Updater == "" {
+		ctx.Updater = DetectUpdater(dockerfilePath)
+	}
+	if ctx.Updater == UpdaterNone {
+		ctx.Updater = ""
 	}
 
-	var issues []models.Issue
-	for _, rule := range a.rules {
-		ruleIssues := rule.Check(ctx)
-		issues = append(issues, ruleIssues...)
+	var cacheKey string
+	if a.cache != nil {
+		// A key we cannot compute just means the result isn't cached
+		if cacheKey, err = a.cacheKey(ctx); err == nil {
+			if cached := a.cache.Load(cacheKey); cached != nil {
+				return cached, nil
+			}
+		}
+	}
+
+	issues := a.runRules(ctx)
+
+	// Run shellcheck on the RUN scripts if available
+	shellchecked := false
+	if a.useShellcheck {
+		shellcheckIssues, err := runShellcheck(ctx.ParsedFile, lines, a.shellcheck)
+		if err == nil {
+			issues = append(issues, shellcheckIssues...)
+			shellchecked = true
+		}
+		// Like hadolint errors, shellcheck errors leave the built-in rules
 	}
 
 	// Run hadolint if available and merge results
+	var decisions []models.HadolintDecision
 	if a.useHadolint {
-		hadolintIssues, err := RunHadolint(dockerfilePath)
+		hadolintIssues, err := runHadolint(dockerfilePath, a.hadolint, a.hadolintSeverities)
 		if err == nil {
-			issues = mergeHadolintIssues(issues, hadolintIssues)
+			if shellchecked {
+				hadolintIssues = dropHadolintShellcheck(hadolintIssues)
+			}
+			issues, decisions = mergeHadolintIssuesWithDecisions(issues, hadolintIssues)
 		}
 		// Silently ignore hadolint errors — built-in rules still apply
 	}
 
-	score := calculateScore(issues)
+	// Run BuildKit's build checks if enabled, after hadolint so that its
+	// duplicates are dropped too
+	var checkDecisions []models.HadolintDecision
+	if a.buildCheck.Enabled {
+		checkIssues, err := runBuildCheck(dockerfilePath, a.buildCheck, a.buildArgs, a.target)
+		if err == nil {
+			issues, checkDecisions = mergeBuildCheckIssues(issues, checkIssues)
+		}
+		// Without docker or a builder, the other rules still apply
+	}
 
-	return &models.AnalysisResult{
-		Dockerfile: dockerfilePath,
-		Issues:     issues,
-		Score:      score,
-	}, nil
+	// Scan for misconfigurations with trivy if enabled
+	var trivyDecisions []models.HadolintDecision
+	if a.trivy.Enabled {
+		trivyIssues, err := runTrivyConfig(dockerfilePath, a.trivy)
+		if err == nil {
+			issues, trivyDecisions = mergeTrivyIssues(issues, trivyIssues)
+		}
+		// Without trivy, the other rules still apply
+	}
+
+	kind, reasons := imageKind(a.image, ctx.ParsedFile, dockerfilePath)
+	applyKindSeverities(issues, kindSeverities(a.image, kind))
+	attachDocsURLs(issues)
+	attachFingerprints(ctx.ParsedFile, ctx.FilePath, issues)
+	stages := attributeStages(ctx.ParsedFile, issues)
+	score := calculateScore(issues, a.threshold)
+	user, _ := ctx.ParsedFile.EffectiveUser()
+
+	result := &models.AnalysisResult{
+		Dockerfile:          dockerfilePath,
+		Issues:              issues,
+		Score:               score,
+		Stages:              stages,
+		ImageReferences:     ctx.ParsedFile.ImageReferences(),
+		HadolintDecisions:   decisions,
+		BuildCheckDecisions: checkDecisions,
+		TrivyDecisions:      trivyDecisions,
+		Windows:             ctx.ParsedFile.IsWindows(),
+		User:                user,
+		Target:              ctx.ParsedFile.Target,
+		Binaries:            ctx.ParsedFile.CompiledBinaries(),
+		Artifacts:           ctx.ParsedFile.Artifacts(),
+		Updater:             ctx.Updater,
+		ImageKind:           kind,
+		ImageKindReasons:    reasons,
+		Budget:              ParseBudget(lines),
+	}
+	if cacheKey != "" {
+		// Failing to write the cache only costs a re-analysis next time
+		_ = a.cache.Store(cacheKey, result)
+	}
+	return result, nil
 }
 
+// stdinPath names Dockerfile content analyzed without a file.
+const stdinPath = "<stdin>"
+
 // AnalyzeContent analyzes Dockerfile content from a string (no file needed).
 func (a *Analyzer) AnalyzeContent(content string) (*models.AnalysisResult, error) {
 	lines := strings.Split(content, "\n")
+	pdf, err := a.parse(lines)
+	if err != nil {
+		return nil, err
+	}
 	ctx := &AnalysisContext{
-		FilePath:   "<stdin>",
-		Content:    content,
-		Lines:      lines,
-		ParsedFile: parseDockerfile(lines),
+		FilePath:     stdinPath,
+		Content:      content,
+		Lines:        lines,
+		ParsedFile:   pdf,
+		GoldenImages: a.golden,
 	}
-
-	var issues []models.Issue
-	for _, rule := range a.rules {
-		ruleIssues := rule.Check(ctx)
-		issues = append(issues, ruleIssues...)
+	// There is no repository to detect an updater in
+	if a.updater != UpdaterNone {
+		ctx.Updater = a.updater
 	}
 
-	score := calculateScore(issues)
+	issues := a.runRules(ctx)
+
+	kind, reasons := imageKind(a.image, ctx.ParsedFile, "")
+	applyKindSeverities(issues, kindSeverities(a.image, kind))
+	attachDocsURLs(issues)
+	attachFingerprints(ctx.ParsedFile, ctx.FilePath, issues)
+	stages := attributeStages(ctx.ParsedFile, issues)
+	score := calculateScore(issues, a.threshold)
+	user, _ := ctx.ParsedFile.EffectiveUser()
 
 	return &models.AnalysisResult{
-		Dockerfile: "<stdin>",
-		Issues:     issues,
-		Score:      score,
+		Dockerfile:       stdinPath,
+		Issues:           issues,
+		Score:            score,
+		Stages:           stages,
+		ImageReferences:  ctx.ParsedFile.ImageReferences(),
+		Windows:          ctx.ParsedFile.IsWindows(),
+		User:             user,
+		Target:           ctx.ParsedFile.Target,
+		Binaries:         ctx.ParsedFile.CompiledBinaries(),
+		Artifacts:        ctx.ParsedFile.Artifacts(),
+		Updater:          ctx.Updater,
+		ImageKind:        kind,
+		ImageKindReasons: reasons,
+		Budget:           ParseBudget(lines),
 	}, nil
 }
 
-// AnalysisContext provides parsed Dockerfile information to rules.
+// runRules runs every registered rule against the context. Rules run
+// concurrently on up to GOMAXPROCS workers; each rule's issues are kept in
+// its own slot and concatenated in registration order, so the result is the
+// same as running the rules one after another.
+func (a *Analyzer) runRules(ctx *AnalysisContext) []models.Issue {
+	results := make([][]models.Issue, len(a.rules))
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(a.rules) {
+		workers = len(a.rules)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = a.rules[i].Check(ctx)
+			}
+		}()
+	}
+	for i := range a.rules {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var issues []models.Issue
+	for _, ruleIssues := range results {
+		issues = append(issues, ruleIssues...)
+	}
+	return dropOverlappingExtendedIssues(issues)
+}
+
+// AnalysisContext provides parsed Dockerfile information to rules. It is
+// shared by all rules while they run concurrently and must be treated as
+// read-only.
 type AnalysisContext struct {
-	FilePath            string
-	Content             string
-	Lines               []string
-	ParsedFile          *ParsedDockerfile
+	FilePath   string
+	Content    string
+	Lines      []string
+	ParsedFile *ParsedDockerfile
+	// IgnoreFile is the name of the context's ignore file: .dockerignore,
+	// or .containerignore when there is one.
+	IgnoreFile          string
 	MissingDockerignore bool
+	// UncoveredContextDirs lists heavy directories in the build context
+	// that an existing ignore file fails to exclude.
+	UncoveredContextDirs []ContextDir
+	// Updater is the dependency updater keeping the base images current,
+	// UpdaterRenovate or UpdaterDependabot, or "" when there is none.
+	Updater string
+	// GoldenImages is the golden image catalog of .dio.yaml.
+	GoldenImages []config.GoldenImage
 }
 
 // ParsedDockerfile holds a structured representation of a Dockerfile.
@@ -126,6 +457,33 @@ type ParsedDockerfile struct {
 	Instructions  []Instruction
 	BaseImages    []string
 	HasMultiStage bool
+	// CopyFromImages lists external images referenced by COPY --from
+	// (as opposed to references to build stages).
+	CopyFromImages []models.ImageReference
+	// Escape is the line continuation character, '\\' unless changed by
+	// an escape parser directive.
+	Escape byte
+	// Args holds the resolved values of ARGs declared before the first FROM.
+	Args map[string]string
+	// Target is the stage built with docker build --target, which is then
+	// the final stage. Empty builds the last stage.
+	Target string
+}
+
+// ImageReferences returns every external image the Dockerfile depends on:
+// FROM base images that aren't earlier stages, followed by COPY --from images.
+func (p *ParsedDockerfile) ImageReferences() []models.ImageReference {
+	var refs []models.ImageReference
+	for i, stage := range p.Stages {
+		if stage.BaseImage == "" || stage.BaseImage == "scratch" {
+			continue
+		}
+		if parent := p.StageIndex(stage.BaseImage); parent != -1 && parent < i {
+			continue
+		}
+		refs = append(refs, models.ImageReference{Image: stage.BaseImage, Line: stage.StartLine, Source: models.ImageSourceFrom})
+	}
+	return append(refs, p.CopyFromImages...)
 }
 
 // Stage represents a build stage in a Dockerfile.
@@ -134,6 +492,88 @@ type Stage struct {
 	BaseImage    string
 	Instructions []Instruction
 	StartLine    int
+	// Shell holds the arguments of the last SHELL instruction in the
+	// stage, or "" when the stage uses the default shell.
+	Shell string
+}
+
+// Label returns the stage name, or "stage N" for unnamed stages.
+func (s Stage) Label(index int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("stage %d", index)
+}
+
+// FinalStage returns the index of the stage that produces the image: the
+// target stage, or the last one.
+func (p *ParsedDockerfile) FinalStage() int {
+	if p.Target != "" {
+		if idx := p.StageIndex(p.Target); idx >= 0 {
+			return idx
+		}
+	}
+	return len(p.Stages) - 1
+}
+
+// StageIndexAt returns the index of the stage containing the given line,
+// or -1 if the line precedes the first FROM.
+func (p *ParsedDockerfile) StageIndexAt(line int) int {
+	idx := -1
+	for i, stage := range p.Stages {
+		if stage.StartLine <= line {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// StageIndex returns the index of the stage with the given name, or -1.
+func (p *ParsedDockerfile) StageIndex(name string) int {
+	for i, stage := range p.Stages {
+		if stage.Name != "" && strings.EqualFold(stage.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// StageChain returns the stage at idx followed by the earlier stages it
+// inherits from via FROM <stage>, so inherited settings like USER and
+// WORKDIR can be resolved. The closest stage comes first.
+func (p *ParsedDockerfile) StageChain(idx int) []Stage {
+	var chain []Stage
+	seen := make(map[int]bool)
+	for idx >= 0 && idx < len(p.Stages) && !seen[idx] {
+		seen[idx] = true
+		stage := p.Stages[idx]
+		chain = append(chain, stage)
+		parent := p.StageIndex(stage.BaseImage)
+		if parent >= idx {
+			break
+		}
+		idx = parent
+	}
+	return chain
+}
+
+// EffectiveUser returns the USER the image runs as and its line: the last
+// USER in the final stage, or in the stage it inherits from. USER in
+// unrelated builder stages doesn't count. It returns "" when no stage in the
+// chain sets a user, leaving the base image default.
+func (p *ParsedDockerfile) EffectiveUser() (string, int) {
+	for _, stage := range p.StageChain(p.FinalStage()) {
+		user, line := "", 0
+		for _, inst := range stage.Instructions {
+			if inst.Command == "USER" {
+				user, line = strings.TrimSpace(inst.Args), inst.Line
+			}
+		}
+		if user != "" {
+			return user, line
+		}
+	}
+	return "", 0
 }
 
 // Instruction represents a single Dockerfile instruction.
@@ -141,29 +581,90 @@ type Instruction struct {
 	Command string
 	Args    string
 	Line    int
+	EndLine int // last line, after continuations
 	Raw     string
+	// Flags are the flags of a RUN instruction, like --mount=type=cache,...;
+	// Args holds the command after them.
+	Flags []string
+	// Heredocs are the bodies of the heredocs of a RUN, COPY or ADD, such
+	// as RUN <<EOF. The body of a RUN heredoc is also part of Args, since
+	// it is the script the RUN runs.
+	Heredocs []string
+}
+
+// heredocRegex matches the start of a heredoc, such as <<EOF or <<-"EOF".
+var heredocRegex = regexp.MustCompile(`(?:^|\s)\d*<<(-?)(["']?)([A-Za-z_][\w.-]*)(["']?)`)
+
+// readHeredocs reads the bodies of the heredocs started in text, which
+// follow lines[next:], up to their terminators. It returns the bodies and
+// the index of the last line read, next-1 when there are none.
+func readHeredocs(text string, lines []string, next int) ([]string, int) {
+	var bodies []string
+	last := next - 1
+	for _, m := range heredocRegex.FindAllStringSubmatch(text, -1) {
+		if m[2] != m[4] {
+			continue
+		}
+		var body []string
+		for last+1 < len(lines) {
+			last++
+			line := lines[last]
+			if m[1] == "-" {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == m[3] {
+				break
+			}
+			body = append(body, line)
+		}
+		bodies = append(bodies, strings.Join(body, "\n"))
+	}
+	return bodies, last
+}
+
+// ParseDockerfile parses Dockerfile lines into stages and instructions,
+// resolving ARG references in FROM like the analyzer does. Strategies use
+// it to rewrite instructions spanning several lines.
+func ParseDockerfile(lines []string, buildArgs map[string]string) *ParsedDockerfile {
+	return parseDockerfileWithArgs(lines, buildArgs)
 }
 
 // parseDockerfile does a lightweight parse of Dockerfile instructions.
 func parseDockerfile(lines []string) *ParsedDockerfile {
-	pdf := &ParsedDockerfile{}
+	return parseDockerfileWithArgs(lines, nil)
+}
+
+// parseDockerfileWithArgs parses a Dockerfile, resolving ARG references in
+// FROM against the declared defaults and the given build args.
+func parseDockerfileWithArgs(lines []string, buildArgs map[string]string) *ParsedDockerfile {
+	pdf := &ParsedDockerfile{
+		Escape: EscapeChar(lines),
+		Args:   GlobalArgs(lines, buildArgs),
+	}
 	var currentStage *Stage
 	stageCount := 0
 
 	instructionRegex := regexp.MustCompile(`^(\w+)\s+(.*)`)
+	escape := string(pdf.Escape)
 
-	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
 
 		// Skip comments and empty lines
 		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
 			continue
 		}
 
-		// Handle line continuations
-		for strings.HasSuffix(trimmed, "\\") && i+1 < len(lines) {
+		// Handle line continuations. Like docker, drop comment and empty
+		// lines inside a continued instruction.
+		start := i
+		for strings.HasSuffix(trimmed, escape) && i+1 < len(lines) {
 			i++
-			trimmed = strings.TrimSuffix(trimmed, "\\") + " " + strings.TrimSpace(lines[i])
+			next := strings.TrimSpace(lines[i])
+			if next == "" || strings.HasPrefix(next, "#") {
+				continue
+			}
+			trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, escape)) + " " + next
 		}
 
 		matches := instructionRegex.FindStringSubmatch(trimmed)
@@ -174,9 +675,24 @@ func parseDockerfile(lines []string) *ParsedDockerfile {
 		inst := Instruction{
 			Command: strings.ToUpper(matches[1]),
 			Args:    matches[2],
-			Line:    i + 1,
+			Line:    start + 1,
+			EndLine: i + 1,
 			Raw:     trimmed,
 		}
+		if inst.Command == "RUN" {
+			inst.Flags, inst.Args = RunFlags(inst.Args)
+		}
+		if inst.Command == "RUN" || inst.Command == "COPY" || inst.Command == "ADD" {
+			if bodies, last := readHeredocs(trimmed, lines, i+1); len(bodies) > 0 {
+				inst.Heredocs = bodies
+				inst.Raw = strings.Join(append([]string{trimmed}, lines[i+1:last+1]...), "\n")
+				if inst.Command == "RUN" {
+					inst.Args += "\n" + strings.Join(bodies, "\n")
+				}
+				i = last
+				inst.EndLine = i + 1
+			}
+		}
 
 		pdf.Instructions = append(pdf.Instructions, inst)
 
@@ -186,17 +702,29 @@ func parseDockerfile(lines []string) *ParsedDockerfile {
 				pdf.Stages = append(pdf.Stages, *currentStage)
 			}
 
-			baseImage := parseBaseImage(inst.Args)
+			baseImage := parseBaseImage(ExpandArgs(inst.Args, pdf.Args))
 			pdf.BaseImages = append(pdf.BaseImages, baseImage)
 
 			stageName := parseStageName(inst.Args)
 			currentStage = &Stage{
 				Name:      stageName,
 				BaseImage: baseImage,
-				StartLine: i + 1,
+				StartLine: inst.Line,
 			}
 		}
 
+		if inst.Command == "SHELL" && currentStage != nil {
+			currentStage.Shell = inst.Args
+		}
+
+		if from := copyFromFlag(inst); from != "" && currentStage != nil && !isStageReference(pdf, *currentStage, from) {
+			pdf.CopyFromImages = append(pdf.CopyFromImages, models.ImageReference{
+				Image:  strings.ToLower(from),
+				Line:   inst.Line,
+				Source: models.ImageSourceCopyFrom,
+			})
+		}
+
 		if currentStage != nil {
 			currentStage.Instructions = append(currentStage.Instructions, inst)
 		}
@@ -211,11 +739,26 @@ func parseDockerfile(lines []string) *ParsedDockerfile {
 }
 
 func parseBaseImage(args string) string {
-	parts := strings.Fields(args)
-	if len(parts) == 0 {
-		return ""
+	for _, p := range strings.Fields(args) {
+		// Skip flags such as --platform=linux/amd64
+		if strings.HasPrefix(p, "--") {
+			continue
+		}
+		return strings.ToLower(p)
 	}
-	return strings.ToLower(parts[0])
+	return ""
+}
+
+// isStageReference reports whether a COPY --from value in the current stage
+// refers to an earlier build stage (by name or index) rather than an image.
+func isStageReference(pdf *ParsedDockerfile, current Stage, from string) bool {
+	if n, err := strconv.Atoi(from); err == nil {
+		return n >= 0 && n <= len(pdf.Stages)
+	}
+	if current.Name != "" && strings.EqualFold(current.Name, from) {
+		return true
+	}
+	return pdf.StageIndex(from) != -1
 }
 
 func parseStageName(args string) string {
@@ -228,9 +771,51 @@ func parseStageName(args string) string {
 	return ""
 }
 
-func calculateScore(issues []models.Issue) int {
+// attributeStages sets the Stage of every issue with a line number and
+// returns a per-stage summary of the findings.
+func attributeStages(pdf *ParsedDockerfile, issues []models.Issue) []models.StageResult {
+	if len(pdf.Stages) == 0 {
+		return nil
+	}
+
+	results := make([]models.StageResult, len(pdf.Stages))
+	for i, stage := range pdf.Stages {
+		results[i] = models.StageResult{
+			Name:      stage.Label(i),
+			BaseImage: stage.BaseImage,
+			StartLine: stage.StartLine,
+			Final:     i == pdf.FinalStage(),
+		}
+	}
+
+	for i := range issues {
+		if issues[i].Line <= 0 {
+			continue
+		}
+		idx := pdf.StageIndexAt(issues[i].Line)
+		if idx < 0 {
+			continue
+		}
+		issues[i].Stage = results[idx].Name
+		results[idx].Issues++
+	}
+	return results
+}
+
+// Score returns the score of issues with the analyzer's threshold, for
+// callers that drop issues from a result.
+func (a *Analyzer) Score(issues []models.Issue) int {
+	return calculateScore(issues, a.threshold)
+}
+
+// calculateScore deducts points from 100 for each issue at or above the
+// threshold, more for more severe issues.
+func calculateScore(issues []models.Issue, threshold models.Severity) int {
 	score := 100
 	for _, issue := range issues {
+		if !issue.Severity.AtLeast(threshold) {
+			continue
+		}
 		switch issue.Severity {
 		case models.SeverityCritical:
 			score -= 20
@@ -268,13 +853,20 @@ func isHadolintAvailable() bool {
 
 // RunHadolint invokes hadolint and parses its JSON output into DIO issues.
 func RunHadolint(dockerfilePath string) ([]models.Issue, error) {
+	return runHadolint(dockerfilePath, config.HadolintConfig{}, nil)
+}
+
+// runHadolint invokes hadolint with the given configuration passed through
+// as command-line flags, and the severities of its findings overridden by
+// severities.
+func runHadolint(dockerfilePath string, cfg config.HadolintConfig, severities map[string]models.Severity) ([]models.Issue, error) {
 	hadolintPath, err := exec.LookPath("hadolint")
 	if err != nil {
 		return nil, fmt.Errorf("hadolint not found: %w", err)
 	}
 
 	var stdout, stderr bytes.Buffer
-	cmd := exec.Command(hadolintPath, "--format", "json", "--no-fail", dockerfilePath)
+	cmd := exec.Command(hadolintPath, hadolintArgs(dockerfilePath, cfg)...)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
@@ -295,7 +887,7 @@ func RunHadolint(dockerfilePath string) ([]models.Issue, error) {
 	for _, r := range results {
 		issues = append(issues, models.Issue{
 			ID:          "HL-" + r.Code,
-			Severity:    mapHadolintLevel(r.Level),
+			Severity:    hadolintSeverity(r.Code, r.Level, severities),
 			Category:    "hadolint",
 			Title:       r.Code + ": " + truncate(r.Message, 80),
 			Description: r.Message,
@@ -307,6 +899,74 @@ func RunHadolint(dockerfilePath string) ([]models.Issue, error) {
 	return issues, nil
 }
 
+// hadolintArgs builds the hadolint command line, passing through a
+// .hadolint.yaml file, ignored rules, and trusted registries.
+func hadolintArgs(dockerfilePath string, cfg config.HadolintConfig) []string {
+	args := []string{"--format", "json", "--no-fail"}
+
+	if configPath := hadolintConfigPath(dockerfilePath, cfg); configPath != "" {
+		args = append(args, "--config", configPath)
+	}
+
+	for _, code := range cfg.Ignore {
+		args = append(args, "--ignore", code)
+	}
+	for _, registry := range cfg.TrustedRegistries {
+		args = append(args, "--trusted-registry", registry)
+	}
+
+	return append(args, dockerfilePath)
+}
+
+// hadolintConfigPath returns the hadolint config file to use: the configured
+// one, or a .hadolint.yaml next to the Dockerfile. It returns "" if none.
+func hadolintConfigPath(dockerfilePath string, cfg config.HadolintConfig) string {
+	if cfg.Config != "" {
+		return cfg.Config
+	}
+	dir := filepath.Dir(dockerfilePath)
+	for _, name := range []string{".hadolint.yaml", ".hadolint.yml"} {
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// hadolintSeverity resolves the DIO severity of a hadolint finding, applying
+// per-code overrides first, then per-level overrides, then the default mapping.
+func hadolintSeverity(code, level string, overrides map[string]models.Severity) models.Severity {
+	if sev, ok := overrides[code]; ok {
+		return sev
+	}
+	if sev, ok := overrides[strings.ToLower(level)]; ok {
+		return sev
+	}
+	return mapHadolintLevel(level)
+}
+
+// parseSeverityMap parses the severities of hadolint.severity_map.
+func parseSeverityMap(m map[string]string) (map[string]models.Severity, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	severities := make(map[string]models.Severity, len(m))
+	for _, key := range keys {
+		sev, err := models.ParseSeverity(m[key])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hadolint.severity_map.%s: %w", key, err)
+		}
+		severities[key] = sev
+	}
+	return severities, nil
+}
+
 // mapHadolintLevel converts hadolint severity levels to DIO severity.
 func mapHadolintLevel(level string) models.Severity {
 	switch strings.ToLower(level) {
@@ -323,45 +983,81 @@ func mapHadolintLevel(level string) models.Severity {
 	}
 }
 
+// hadolintToDIOCategory maps hadolint rules that duplicate built-in DIO rules
+// to the DIO issue category that covers them.
+var hadolintToDIOCategory = map[string]string{
+	"DL3007": "base-image",      // Using latest tag
+	"DL3008": "version-pinning", // Pin versions in apt-get
+	"DL3009": "cleanup",         // Delete apt-get lists
+	"DL3015": "apt-get",         // --no-install-recommends
+	"DL3025": "best-practice",   // Use JSON for CMD
+	"DL3020": "best-practice",   // Use COPY instead of ADD
+	"DL4006": "best-practice",   // Set pipefail before RUN with a pipe
+}
+
 // mergeHadolintIssues appends hadolint issues, skipping any that overlap with
 // existing DIO issues on the same line with equivalent meaning.
 func mergeHadolintIssues(dioIssues, hadolintIssues []models.Issue) []models.Issue {
+	merged, _ := mergeHadolintIssuesWithDecisions(dioIssues, hadolintIssues)
+	return merged
+}
+
+// mergeHadolintIssuesWithDecisions merges hadolint issues like
+// mergeHadolintIssues and also records why each finding was kept or dropped.
+func mergeHadolintIssuesWithDecisions(dioIssues, hadolintIssues []models.Issue) ([]models.Issue, []models.HadolintDecision) {
 	// Build a set of lines already flagged by built-in rules
 	coveredLines := make(map[int]map[string]bool)
+	coveredIDs := make(map[int]map[string]bool)
 	for _, issue := range dioIssues {
 		if issue.Line > 0 {
 			if coveredLines[issue.Line] == nil {
 				coveredLines[issue.Line] = make(map[string]bool)
+				coveredIDs[issue.Line] = make(map[string]bool)
 			}
 			coveredLines[issue.Line][issue.Category] = true
+			coveredIDs[issue.Line][issue.ID] = true
 		}
 	}
 
-	// Known overlaps: hadolint rules that duplicate built-in DIO rules
-	hadolintToDIOCategory := map[string]string{
-		"DL3007": "base-image",      // Using latest tag
-		"DL3008": "version-pinning", // Pin versions in apt-get
-		"DL3009": "cleanup",         // Delete apt-get lists
-		"DL3015": "apt-get",         // --no-install-recommends
-		"DL3025": "best-practice",   // Use JSON for CMD
-		"DL3020": "best-practice",   // Use COPY instead of ADD
-	}
-
+	var decisions []models.HadolintDecision
 	for _, hlIssue := range hadolintIssues {
 		// Extract the hadolint rule code from ID ("HL-DL3007" -> "DL3007")
 		code := strings.TrimPrefix(hlIssue.ID, "HL-")
 
+		// Skip if the extended ruleset already reported the same check
+		if coveredIDs[hlIssue.Line][code] {
+			decisions = append(decisions, models.HadolintDecision{
+				Code:   code,
+				Line:   hlIssue.Line,
+				Kept:   false,
+				Reason: "already reported by the native extended rule",
+			})
+			continue
+		}
+
 		// Skip if a built-in DIO rule already covers this line+category
 		if dioCategory, ok := hadolintToDIOCategory[code]; ok {
 			if cats, exists := coveredLines[hlIssue.Line]; exists && cats[dioCategory] {
+				decisions = append(decisions, models.HadolintDecision{
+					Code:   code,
+					Line:   hlIssue.Line,
+					Kept:   false,
+					Reason: fmt.Sprintf("duplicate of built-in %s finding on the same line", dioCategory),
+				})
 				continue
 			}
 		}
 
+		decisions = append(decisions, models.HadolintDecision{
+			Code:   code,
+			Line:   hlIssue.Line,
+			Kept:   true,
+			Reason: "no overlapping built-in finding",
+		})
 		dioIssues = append(dioIssues, hlIssue)
 	}
 
-	return dioIssues
+	return dioIssues, decisions
 }
 
 func truncate(s string, maxLen int) string {
@@ -1,9 +1,14 @@
 package analyzer
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/maxlar/docker-image-optimizer/internal/config"
 	"github.com/maxlar/docker-image-optimizer/internal/models"
 )
 
@@ -80,6 +85,55 @@ CMD ["index.js"]
 	}
 }
 
+func TestAnalyzeContent_Threshold(t *testing.T) {
+	content := "FROM ubuntu:latest\nRUN apt-get update && apt-get install curl\n"
+	a := NewWithRules(DefaultRules()...)
+	all, err := a.AnalyzeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.SetThreshold(models.SeverityHigh)
+	high, err := a.AnalyzeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(high.Issues) != len(all.Issues) {
+		t.Errorf("expected the threshold to keep every issue, got %d of %d", len(high.Issues), len(all.Issues))
+	}
+	if high.Score <= all.Score {
+		t.Errorf("expected issues below high not to lower the score, got %d with and %d without the threshold", high.Score, all.Score)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	before := &models.AnalysisResult{Score: 40, Issues: []models.Issue{
+		{ID: "DIO005", Line: 2},
+		{ID: "DIO005", Line: 3},
+		{ID: "DIO006", Line: 1},
+		{ID: "DIO009", Line: 2},
+	}}
+	after := &models.AnalysisResult{Score: 75, Issues: []models.Issue{
+		{ID: "DIO009", Line: 2},
+		{ID: "DIO010", Line: 4},
+	}}
+
+	diff := Compare(before, after)
+	if diff.ScoreBefore != 40 || diff.ScoreAfter != 75 {
+		t.Errorf("unexpected scores %d -> %d", diff.ScoreBefore, diff.ScoreAfter)
+	}
+	var resolved []string
+	for _, issue := range diff.ResolvedIssues {
+		resolved = append(resolved, issue.ID)
+	}
+	if strings.Join(resolved, ",") != "DIO005,DIO005,DIO006" {
+		t.Errorf("expected DIO005 twice and DIO006 resolved, got %v", resolved)
+	}
+	if len(diff.NewIssues) != 1 || diff.NewIssues[0].ID != "DIO010" {
+		t.Errorf("expected DIO010 to be new, got %+v", diff.NewIssues)
+	}
+}
+
 func TestAnalyzeContent_AptGetNoRecommends(t *testing.T) {
 	content := `FROM ubuntu:22.04
 RUN apt-get update && apt-get install curl
@@ -185,6 +239,469 @@ CMD ["index.js"]
 	}
 }
 
+func TestParseDockerfile_Continuations(t *testing.T) {
+	lines := strings.Split(`FROM debian:bookworm-slim
+RUN apt-get update && \
+    # refresh the index first
+    rm -rf /var/lib/apt/lists/*
+USER app
+`, "\n")
+
+	pdf := parseDockerfile(lines)
+
+	if len(pdf.Instructions) != 3 {
+		t.Fatalf("expected 3 instructions, got %d: %+v", len(pdf.Instructions), pdf.Instructions)
+	}
+	run := pdf.Instructions[1]
+	if run.Line != 2 {
+		t.Errorf("expected RUN to be reported at its first line, got %d", run.Line)
+	}
+	if strings.Contains(run.Args, "refresh") || !strings.Contains(run.Args, "rm -rf") {
+		t.Errorf("unexpected RUN args %q", run.Args)
+	}
+}
+
+func TestParseDockerfile_EscapeDirective(t *testing.T) {
+	lines := strings.Split("# escape=`\n"+
+		"FROM mcr.microsoft.com/windows/servercore:ltsc2022\n"+
+		"SHELL [\"powershell\", \"-Command\"]\n"+
+		"WORKDIR C:\\app\n"+
+		"RUN Invoke-WebRequest https://example.com/tool.zip -OutFile tool.zip | Out-Null; `\n"+
+		"    Expand-Archive tool.zip -DestinationPath C:\\tool\n", "\n")
+
+	pdf := parseDockerfile(lines)
+
+	if pdf.Escape != '`' {
+		t.Errorf("expected backtick escape, got %q", pdf.Escape)
+	}
+	if !pdf.IsWindows() {
+		t.Error("expected servercore base image to be detected as Windows")
+	}
+	if len(pdf.Instructions) != 4 {
+		t.Fatalf("expected 4 instructions, got %d", len(pdf.Instructions))
+	}
+	if got := pdf.Instructions[2].Args; got != `C:\app` {
+		t.Errorf("backslash must not continue the line under escape=`, got WORKDIR %q", got)
+	}
+	if !strings.Contains(pdf.Instructions[3].Args, "Expand-Archive") {
+		t.Errorf("expected backtick continuation to be joined, got %q", pdf.Instructions[3].Args)
+	}
+	if pdf.Stages[0].Shell == "" {
+		t.Error("expected SHELL to be recorded on the stage")
+	}
+}
+
+func TestParseDockerfile_Heredocs(t *testing.T) {
+	lines := strings.Split(`FROM debian:bookworm-slim
+RUN <<EOF
+set -e
+apt-get update
+EOF
+COPY <<-"CONF" /etc/app.conf
+	listen 8080
+	CONF
+USER app`, "\n")
+
+	pdf := parseDockerfile(lines)
+
+	if len(pdf.Instructions) != 4 {
+		t.Fatalf("expected 4 instructions, got %d: %+v", len(pdf.Instructions), pdf.Instructions)
+	}
+	run, cp := pdf.Instructions[1], pdf.Instructions[2]
+	if run.EndLine != 5 || !strings.Contains(run.Args, "apt-get update") || len(run.Heredocs) != 1 {
+		t.Errorf("expected the heredoc to be the script of the RUN, got %+v", run)
+	}
+	if cp.EndLine != 8 || cp.Heredocs[0] != "listen 8080" || strings.Contains(cp.Args, "listen") {
+		t.Errorf("expected the COPY heredoc to be read with tabs stripped, got %+v", cp)
+	}
+}
+
+func TestParseFrontend(t *testing.T) {
+	tests := []struct {
+		syntax  string
+		version string
+		ok      bool
+	}{
+		{"docker/dockerfile:1", "1", true},
+		{"docker/dockerfile:1.7-labs", "1.7", true},
+		{"docker.io/docker/dockerfile:1.4.3@sha256:abc", "1.4", true},
+		{"docker/dockerfile", "1", true},
+		{"docker/dockerfile:experimental", "1.1", true},
+		{"tonistiigi/dockerfile:runmount", "", false},
+	}
+	for _, tt := range tests {
+		f, ok := ParseFrontend(tt.syntax)
+		if ok != tt.ok || (ok && f.String() != tt.version) {
+			t.Errorf("ParseFrontend(%q) = %v, %v, want %s, %v", tt.syntax, f, ok, tt.version, tt.ok)
+		}
+	}
+}
+
+func TestDirectiveRule(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		severities []models.Severity
+	}{
+		{"current", "# syntax=docker/dockerfile:1\n# check=skip=JSONArgsRecommended\nFROM alpine:3.19\nRUN --mount=type=cache,target=/root/.cache true", nil},
+		{"no directive", "FROM alpine:3.19\nCOPY --link app /app", []models.Severity{models.SeverityLow}},
+		{"outdated", "# syntax=docker/dockerfile:1.2\nFROM alpine:3.19\nCOPY --link app /app", []models.Severity{models.SeverityLow, models.SeverityMedium}},
+		{"duplicate", "# syntax=docker/dockerfile:1\n# syntax=docker/dockerfile:1.7\nFROM alpine:3.19", []models.Severity{models.SeverityMedium}},
+		{"after a comment", "# build the app\n# syntax=docker/dockerfile:1\nFROM alpine:3.19", []models.Severity{models.SeverityLow}},
+		{"invalid check", "# check=skip=NoSuchCheck;error=yes\nFROM alpine:3.19", []models.Severity{models.SeverityLow}},
+		{"custom frontend", "# syntax=example.com/frontend:v2\nFROM alpine:3.19\nRUN <<EOF\ntrue\nEOF", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := strings.Split(tt.content, "\n")
+			var severities []models.Severity
+			for _, issue := range (&DirectiveRule{}).Check(&AnalysisContext{Lines: lines, ParsedFile: parseDockerfile(lines)}) {
+				severities = append(severities, issue.Severity)
+			}
+			if !reflect.DeepEqual(severities, tt.severities) {
+				t.Errorf("DIO037 severities = %v, want %v", severities, tt.severities)
+			}
+		})
+	}
+}
+
+func TestLenientRuns(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		pipe     bool
+		sequence bool
+	}{
+		{"pipe", "FROM debian:bookworm-slim\nRUN curl -fsSL https://example.com/x.tgz | tar -xz", true, false},
+		{"pipefail shell", "FROM debian:bookworm-slim\nSHELL [\"/bin/bash\", \"-o\", \"pipefail\", \"-c\"]\nRUN curl -fsSL https://example.com/x.tgz | tar -xz", false, false},
+		{"inherited shell", "FROM debian:bookworm-slim AS base\nSHELL [\"/bin/bash\", \"-o\", \"pipefail\", \"-c\"]\nFROM base\nRUN curl -fsSL https://example.com/x.tgz | tar -xz", false, false},
+		{"quoted pipe", "FROM alpine:3.19\nRUN grep -E 'a|b' /etc/passwd || true", false, false},
+		{"sequence", "FROM alpine:3.19\nRUN apk update; apk add curl", false, true},
+		{"set -e", "FROM alpine:3.19\nRUN set -eux; apk update; apk add curl", false, false},
+		{"loop", "FROM alpine:3.19\nRUN for f in a b; do touch $f; done", false, false},
+		{"heredoc", "FROM alpine:3.19\nRUN <<EOF\napk update\napk add \\\n  curl\nEOF", false, true},
+		{"heredoc data", "FROM alpine:3.19\nRUN cat <<EOF > /etc/motd\nhello | world\nbye\nEOF", false, false},
+		{"exec form", "FROM alpine:3.19\nRUN [\"sh\", \"-c\", \"a | b\"]", false, false},
+		{"windows", "FROM mcr.microsoft.com/windows/servercore:ltsc2022\nRUN dir | findstr x", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := parseDockerfile(strings.Split(tt.content, "\n")).LenientRuns()
+			var pipe, sequence bool
+			for _, run := range runs {
+				pipe, sequence = pipe || run.Pipe, sequence || run.Sequence
+			}
+			if pipe != tt.pipe || sequence != tt.sequence {
+				t.Errorf("pipe, sequence = %t, %t, want %t, %t", pipe, sequence, tt.pipe, tt.sequence)
+			}
+		})
+	}
+}
+
+func TestCacheBusts(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		kinds   []string
+	}{
+		{"early cache-bust arg", "FROM alpine:3.19\nARG CACHEBUST=1\nRUN apk add --no-cache git\nRUN echo $CACHEBUST && git clone --branch v1.0 https://example.com/r.git", []string{CacheBustArg}},
+		{"cache-bust arg before its use", "FROM alpine:3.19\nARG CACHE_BUST\nRUN echo ${CACHE_BUST}", nil},
+		{"latest download", "FROM alpine:3.19\nADD https://example.com/releases/latest/tool.tar.gz /tmp/", []string{CacheBustRemoteAdd}},
+		{"checksummed download", "FROM alpine:3.19\nADD --checksum=sha256:abc https://example.com/latest/tool.tar.gz /tmp/", nil},
+		{"versioned download", "FROM alpine:3.19\nADD https://example.com/releases/v1.2.3/tool.tar.gz /tmp/", nil},
+		{"branch clone", "FROM alpine:3.19\nRUN git clone --depth 1 https://github.com/org/repo.git /src", []string{CacheBustGitBranch}},
+		{"tag clone", "FROM alpine:3.19\nRUN git clone --depth 1 --branch v1.2.3 https://github.com/org/repo.git /src", nil},
+		{"checked out commit", "FROM alpine:3.19\nRUN git clone https://github.com/org/repo.git /src && cd /src && git checkout 3f2c1a9", nil},
+		{"git ADD of a branch", "FROM alpine:3.19\nADD https://github.com/org/repo.git#main /src", []string{CacheBustGitBranch}},
+		{"git ADD of a tag", "FROM alpine:3.19\nADD https://github.com/org/repo.git#v1.2.3 /src", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var kinds []string
+			for _, b := range parseDockerfile(strings.Split(tt.content, "\n")).CacheBusts() {
+				kinds = append(kinds, b.Kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.kinds) {
+				t.Errorf("cache busts = %v, want %v", kinds, tt.kinds)
+			}
+		})
+	}
+}
+
+func TestAptSplits(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		installs   []int
+		updateOnly bool
+	}{
+		{"update alone", "FROM debian:bookworm-slim\nRUN apt-get update\nRUN apt-get install -y curl", []int{3}, true},
+		{"update with install", "FROM debian:bookworm-slim\nRUN apt-get update && apt-get install -y curl\nRUN apt-get install -y git", []int{3}, false},
+		{"same RUN", "FROM debian:bookworm-slim\nRUN apt-get update && apt-get install -y curl", nil, false},
+		{"inherited", "FROM debian:bookworm-slim AS base\nRUN apt-get update\nFROM base\nRUN <<EOF\napt-get install -y curl\nEOF", []int{4}, true},
+		{"cache mount", "FROM debian:bookworm-slim\nRUN apt-get update\nRUN --mount=type=cache,target=/var/lib/apt/lists apt-get install -y curl", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var installs []int
+			updateOnly := false
+			for _, split := range parseDockerfile(strings.Split(tt.content, "\n")).AptSplits() {
+				installs = append(installs, split.Install.Line)
+				updateOnly = split.UpdateOnly
+			}
+			if !reflect.DeepEqual(installs, tt.installs) || updateOnly != tt.updateOnly {
+				t.Errorf("installs = %v (update only %t), want %v (%t)", installs, updateOnly, tt.installs, tt.updateOnly)
+			}
+		})
+	}
+}
+
+func TestChownedCopies(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		copies  []int
+		fixable bool
+	}{
+		{"chown after copy", "FROM node:20-slim\nWORKDIR /app\nCOPY . .\nRUN chown -R node:node /app", []int{3}, true},
+		{"relative target", "FROM node:20-slim\nWORKDIR /app\nCOPY . .\nRUN chown -R node:node .", []int{3}, true},
+		{"chmod", "FROM alpine:3.19\nCOPY scripts /opt/scripts\nRUN chmod -R 755 /opt/scripts", []int{2}, true},
+		{"symbolic chmod", "FROM alpine:3.19\nCOPY scripts /opt/scripts\nRUN chmod -R +x /opt/scripts", []int{2}, false},
+		{"copy into a subdirectory", "FROM alpine:3.19\nCOPY app /srv/app\nRUN chown -R app /srv", []int{2}, false},
+		{"run in between", "FROM node:20-slim\nWORKDIR /app\nCOPY package.json .\nRUN npm ci\nRUN chown -R node:node /app", []int{3}, false},
+		{"other commands", "FROM node:20-slim\nWORKDIR /app\nCOPY . .\nRUN npm ci && chown -R node:node /app", []int{3}, false},
+		{"already chowned", "FROM node:20-slim\nWORKDIR /app\nCOPY --chown=node:node . .\nRUN chown -R node:node /app", nil, false},
+		{"not recursive", "FROM node:20-slim\nWORKDIR /app\nCOPY . .\nRUN chown node:node /app", nil, false},
+		{"other directory", "FROM node:20-slim\nCOPY . /app\nRUN chown -R node:node /data", nil, false},
+		{"build stage", "FROM node:20 AS build\nCOPY . /app\nRUN chown -R node /app\nFROM nginx:alpine\nCOPY --from=build /app/dist /usr/share/nginx/html", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var copies []int
+			fixable := false
+			for _, c := range parseDockerfile(strings.Split(tt.content, "\n")).ChownedCopies() {
+				for _, cp := range c.Copies {
+					copies = append(copies, cp.Line)
+				}
+				fixable = c.Fixable
+			}
+			if !reflect.DeepEqual(copies, tt.copies) || fixable != tt.fixable {
+				t.Errorf("copies = %v (fixable %t), want %v (%t)", copies, fixable, tt.copies, tt.fixable)
+			}
+		})
+	}
+}
+
+func TestInstructionLine(t *testing.T) {
+	pdf := parseDockerfile(strings.Split("FROM node:20-slim\nARG VERSION=1\nWORKDIR /app\nCOPY . .\nRUN  npm ci \\\n    --omit=dev\nRUN chown -R node:node /app\nCOPY . .", "\n"))
+	tests := []struct {
+		createdBy string
+		line      int
+	}{
+		{"RUN |1 VERSION=1 /bin/sh -c npm ci --omit=dev # buildkit", 5},
+		{"|1 VERSION=1 /bin/sh -c chown -R node:node /app", 7},
+		{"COPY . . # buildkit", 8},
+		{"/bin/sh -c #(nop) COPY dir:4f3c2a in . ", 8},
+		{"WORKDIR /app", 3},
+		{"/bin/sh -c #(nop)  CMD [\"node\"]", 0},
+		{"RUN /bin/sh -c echo hi # buildkit", 0},
+	}
+	for _, tt := range tests {
+		if got := pdf.InstructionLine(tt.createdBy); got != tt.line {
+			t.Errorf("InstructionLine(%q) = %d, want %d", tt.createdBy, got, tt.line)
+		}
+	}
+}
+
+func TestUncleanedCaches(t *testing.T) {
+	tests := []struct {
+		name  string
+		run   string
+		tools []string
+	}{
+		{"apt cleaned", "RUN apt-get update && apt-get install -y curl && rm -rf /var/lib/apt/lists/*", nil},
+		{"apk", "RUN apk add curl", []string{"apk"}},
+		{"apk no cache", "RUN apk add --no-cache curl", nil},
+		{"apk and pip no cache dir", "RUN pip install --no-cache-dir flask && apk add curl", []string{"apk"}},
+		{"dnf", "RUN dnf install -y curl", []string{"dnf"}},
+		{"dnf cleaned", "RUN dnf install -y curl && dnf clean all", nil},
+		{"microdnf", "RUN microdnf install -y curl", []string{"microdnf"}},
+		{"yum", "RUN yum install -y curl && rm -rf /var/cache/yum", nil},
+		{"zypper", "RUN zypper --non-interactive in curl", []string{"zypper"}},
+		{"zypper cleaned", "RUN zypper -n install curl && zypper clean --all", nil},
+		{"npm", "RUN npm ci", []string{"npm"}},
+		{"npm cache mount", "RUN --mount=type=cache,target=/root/.npm npm ci", nil},
+		{"yarn", "RUN yarn install --frozen-lockfile", []string{"yarn"}},
+		{"yarn cleaned", "RUN yarn && yarn cache clean", nil},
+		{"yarn build", "RUN yarn build", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdf := parseDockerfile([]string{"FROM scratch", tt.run})
+			var tools []string
+			for _, c := range pdf.UncleanedCaches(pdf.Instructions[1]) {
+				tools = append(tools, c.Tool)
+			}
+			if !reflect.DeepEqual(tools, tt.tools) {
+				t.Errorf("caches = %v, want %v", tools, tt.tools)
+			}
+		})
+	}
+
+	// npm caches of build stages never reach the image
+	pdf := parseDockerfile(strings.Split("FROM node:20 AS build\nRUN npm ci\nFROM nginx:1.27\nCOPY --from=build /app/dist /usr/share/nginx/html", "\n"))
+	if caches := pdf.UncleanedCaches(pdf.Instructions[1]); len(caches) != 0 {
+		t.Errorf("expected no cache in a build stage, got %v", caches)
+	}
+}
+
+func TestWeakDependencyOptions(t *testing.T) {
+	tests := []struct {
+		run     string
+		missing []string
+	}{
+		{"apt-get install -y --no-install-recommends curl", nil},
+		{"apt-get install -y curl && apt-get install -y --no-install-recommends git", []string{"--no-install-recommends"}},
+		{"dnf install -y --setopt=install_weak_deps=False curl", nil},
+		{"dnf install -y curl", []string{"--setopt=install_weak_deps=False"}},
+		{"microdnf install -y curl", []string{"--setopt=install_weak_deps=0"}},
+		{"zypper -n install curl", []string{"--no-recommends"}},
+		{"yum install -y curl", nil},
+	}
+	for _, tt := range tests {
+		var missing []string
+		for _, opt := range WeakDependencyOptions {
+			if len(opt.Missing(tt.run)) > 0 {
+				missing = append(missing, opt.Option)
+			}
+		}
+		if !reflect.DeepEqual(missing, tt.missing) {
+			t.Errorf("%q: missing %v, want %v", tt.run, missing, tt.missing)
+		}
+	}
+}
+
+func TestUnpinnedPackages(t *testing.T) {
+	tests := []struct {
+		run  string
+		want []string
+	}{
+		{"apt-get install -y curl=7.88.1-10 git", []string{"git"}},
+		{"apt-get install -y -t bookworm-backports curl=7.88.1-10", nil},
+		{"apk add --no-cache --virtual .build-deps gcc~12", nil},
+		{"dnf install -y curl-8.2.1 java-17-openjdk", []string{"java-17-openjdk"}},
+		{"zypper -n in curl>=8.0", nil},
+		{"apt-get install -y $PACKAGES", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, install := range UnpinnedPackages(tt.run) {
+			got = append(got, install.Packages...)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: unpinned %v, want %v", tt.run, got, tt.want)
+		}
+	}
+}
+
+func TestRunScripts(t *testing.T) {
+	lines := strings.Split(`ARG VERSION=1.0
+FROM debian:bookworm-slim AS build
+ENV app_home=/app
+RUN --mount=type=cache,target=/var/cache/apt \
+    --mount=type=cache,target=/var/lib/apt/lists \
+    apt-get update && \
+    # tools for the build
+    apt-get install -y curl
+SHELL ["/bin/bash", "-o", "pipefail", "-c"]
+RUN <<EOF
+set -e
+curl -fsSL $URL | tar -xz
+EOF
+RUN python3 <<EOF
+print("not a shell script")
+EOF
+RUN ["echo", "exec form"]
+FROM build
+RUN echo done`, "\n")
+
+	scripts := RunScripts(parseDockerfile(lines), lines)
+	if len(scripts) != 3 {
+		t.Fatalf("expected 3 scripts, got %d: %+v", len(scripts), scripts)
+	}
+	if got := scripts[0].Script; got != "apt-get update && \\\n    apt-get install -y curl" {
+		t.Errorf("unexpected script %q", got)
+	}
+	if !reflect.DeepEqual(scripts[0].Lines, []int{6, 8}) || scripts[0].Shell != "sh" {
+		t.Errorf("unexpected lines %v, shell %s", scripts[0].Lines, scripts[0].Shell)
+	}
+	if !reflect.DeepEqual(scripts[0].Vars, []string{"VERSION", "app_home"}) {
+		t.Errorf("unexpected vars %v", scripts[0].Vars)
+	}
+	if !reflect.DeepEqual(scripts[1].Lines, []int{11, 12}) || scripts[1].Shell != "bash" {
+		t.Errorf("expected the heredoc body as a bash script, got lines %v, shell %s", scripts[1].Lines, scripts[1].Shell)
+	}
+	if scripts[2].Shell != "bash" || scripts[2].Instruction.Line != 19 {
+		t.Errorf("expected the SHELL of the build stage to be inherited, got %+v", scripts[2])
+	}
+}
+
+func TestShellcheckIssues(t *testing.T) {
+	script := RunScript{Instruction: Instruction{Line: 4}, Lines: []int{6, 8}}
+	output := `{"comments":[{"line":3,"code":2086,"level":"info","message":"Double quote to prevent globbing and word splitting."},{"line":1,"code":2034,"level":"warning","message":"x appears unused."}]}`
+	issues, err := shellcheckIssues([]byte(output), script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 2 || issues[0].ID != "SC2086" || issues[0].Line != 8 || issues[0].Severity != models.SeverityLow {
+		t.Fatalf("unexpected issues %+v", issues)
+	}
+	if issues[1].Line != 4 || issues[1].Severity != models.SeverityMedium {
+		t.Errorf("expected a finding on the exports to go to the RUN, got %+v", issues[1])
+	}
+}
+
+func TestWindowsDockerfile_Rules(t *testing.T) {
+	content := "# escape=`\n" +
+		"FROM mcr.microsoft.com/windows/servercore:ltsc2022\n" +
+		"SHELL [\"powershell\", \"-Command\"]\n" +
+		"WORKDIR C:\\app\n" +
+		"RUN Get-ChildItem | Out-Null\n"
+
+	cfg := config.Default()
+	cfg.Analyzer.Ruleset = RulesetExtended
+	disabled := false
+	cfg.Hadolint.Enabled = &disabled
+	a, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	result, err := a.AnalyzeContent(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Windows {
+		t.Error("expected result to be marked as Windows")
+	}
+	for _, issue := range result.Issues {
+		switch issue.ID {
+		case "DL4006", "DL3000", "DIO011":
+			t.Errorf("unexpected %s on a Windows Dockerfile: %s", issue.ID, issue.Title)
+		case "DIO006":
+			if !strings.Contains(issue.Suggestion, "ContainerUser") {
+				t.Errorf("expected Windows-specific DIO006 suggestion, got %q", issue.Suggestion)
+			}
+		}
+	}
+
+	nano, _ := New().AnalyzeContent("FROM mcr.microsoft.com/windows/nanoserver:ltsc2022\nCMD [\"cmd\"]\n")
+	for _, issue := range nano.Issues {
+		if issue.ID == "DIO006" {
+			t.Error("nanoserver runs as ContainerUser by default and must not be flagged as root")
+		}
+	}
+}
+
 func TestMapHadolintLevel(t *testing.T) {
 	tests := []struct {
 		level    string
@@ -258,3 +775,1923 @@ func TestNewWithOptions_HadolintDisabled(t *testing.T) {
 		t.Error("expected hadolint to be disabled")
 	}
 }
+
+func TestHadolintSeverity_Overrides(t *testing.T) {
+	overrides := map[string]models.Severity{
+		"DL3008":  models.SeverityHigh,
+		"warning": models.SeverityLow,
+	}
+	tests := []struct {
+		code     string
+		level    string
+		expected models.Severity
+	}{
+		{"DL3008", "warning", models.SeverityHigh},
+		{"DL3009", "warning", models.SeverityLow},
+		{"DL3009", "error", models.SeverityHigh},
+	}
+	for _, tt := range tests {
+		got := hadolintSeverity(tt.code, tt.level, overrides)
+		if got != tt.expected {
+			t.Errorf("hadolintSeverity(%q, %q) = %q, want %q", tt.code, tt.level, got, tt.expected)
+		}
+	}
+}
+
+func TestNewWithConfig_SeverityMap(t *testing.T) {
+	cfg := config.Default()
+	cfg.Hadolint.SeverityMap = map[string]string{"DL3008": "High", "style": "info"}
+	a, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.hadolintSeverities["DL3008"] != models.SeverityHigh || a.hadolintSeverities["style"] != models.SeverityInfo {
+		t.Errorf("expected the severities to be parsed, got %v", a.hadolintSeverities)
+	}
+
+	cfg.Hadolint.SeverityMap["DL3009"] = "hgih"
+	if _, err := NewWithConfig(cfg); err == nil || !strings.Contains(err.Error(), `hadolint.severity_map.DL3009: unknown severity "hgih"`) {
+		t.Errorf("expected an unknown severity to be rejected, got %v", err)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "hadolint.severity_map.DL3009") {
+		t.Errorf("expected dio validate to reject an unknown severity, got %v", err)
+	}
+}
+
+func TestHadolintArgs_Passthrough(t *testing.T) {
+	args := hadolintArgs("Dockerfile", config.HadolintConfig{
+		Config:            "ci/.hadolint.yaml",
+		Ignore:            []string{"DL3008"},
+		TrustedRegistries: []string{"ghcr.io"},
+	})
+	joined := strings.Join(args, " ")
+	for _, want := range []string{"--config ci/.hadolint.yaml", "--ignore DL3008", "--trusted-registry ghcr.io"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected args to contain %q, got %q", want, joined)
+		}
+	}
+	if args[len(args)-1] != "Dockerfile" {
+		t.Errorf("expected Dockerfile to be the last argument, got %q", args[len(args)-1])
+	}
+}
+
+func TestMergeHadolintIssues_Decisions(t *testing.T) {
+	dioIssues := []models.Issue{
+		{ID: "DIO001", Line: 1, Category: "base-image"},
+	}
+	hadolintIssues := []models.Issue{
+		{ID: "HL-DL3007", Line: 1, Category: "hadolint"},
+		{ID: "HL-DL3042", Line: 5, Category: "hadolint"},
+	}
+	_, decisions := mergeHadolintIssuesWithDecisions(dioIssues, hadolintIssues)
+	if len(decisions) != 2 {
+		t.Fatalf("expected 2 decisions, got %d", len(decisions))
+	}
+	if decisions[0].Kept || !decisions[1].Kept {
+		t.Errorf("expected DL3007 dropped and DL3042 kept, got %+v", decisions)
+	}
+}
+
+func TestBuildCheckIssues(t *testing.T) {
+	output := `{
+  "warnings": [
+    {
+      "ruleName": "JSONArgsRecommended",
+      "description": "JSON arguments recommended for ENTRYPOINT/CMD to prevent unintended behavior related to OS signals",
+      "url": "https://docs.docker.com/go/dockerfile/rule/json-args-recommended/",
+      "detail": "JSON arguments recommended for CMD to prevent unintended behavior related to OS signals",
+      "location": {"ranges": [{"start": {"line": 4}, "end": {"line": 4}}]}
+    },
+    {
+      "ruleName": "SecretsUsedInArgOrEnv",
+      "description": "Sensitive data should not be used in the ARG or ENV commands",
+      "url": "https://docs.docker.com/go/dockerfile/rule/secrets-used-in-arg-or-env/",
+      "detail": "Do not use ARG or ENV instructions for sensitive data (ENV \"API_TOKEN\")",
+      "location": {"ranges": [{"start": {"line": 2}, "end": {"line": 2}}]}
+    },
+    {
+      "ruleName": "NewCheck",
+      "description": "A check DIO doesn't know",
+      "location": {"ranges": [{"start": {"line": 3}, "end": {"line": 3}}]}
+    }
+  ],
+  "buildError": {
+    "message": "dockerfile parse error on line 5: unknown instruction: RUNN",
+    "location": {"ranges": [{"start": {"line": 5}, "end": {"line": 5}}]}
+  }
+}`
+	issues, err := buildCheckIssues([]byte(output))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []struct {
+		id       string
+		line     int
+		severity models.Severity
+	}{
+		{"BK-JSONArgsRecommended", 4, models.SeverityLow},
+		{"BK-SecretsUsedInArgOrEnv", 2, models.SeverityHigh},
+		{"BK-NewCheck", 3, models.SeverityLow},
+		{"BK-BuildError", 5, models.SeverityHigh},
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("expected %d issues, got %+v", len(want), issues)
+	}
+	for i, w := range want {
+		if issues[i].ID != w.id || issues[i].Line != w.line || issues[i].Severity != w.severity {
+			t.Errorf("issue %d: expected %s on line %d (%s), got %s on line %d (%s)",
+				i, w.id, w.line, w.severity, issues[i].ID, issues[i].Line, issues[i].Severity)
+		}
+	}
+	if issues[0].DocsURL != "https://docs.docker.com/go/dockerfile/rule/json-args-recommended/" {
+		t.Errorf("expected the rule URL as DocsURL, got %q", issues[0].DocsURL)
+	}
+	if issues[2].Description != "A check DIO doesn't know" {
+		t.Errorf("expected the rule description without a detail, got %q", issues[2].Description)
+	}
+
+	if _, err := buildCheckIssues([]byte("ERROR: unknown flag: --call")); err == nil {
+		t.Error("expected an error for output that is not JSON")
+	}
+}
+
+func TestBuildCheckArgs(t *testing.T) {
+	cfg := config.BuildCheckConfig{Enabled: true, Skip: []string{"JSONArgsRecommended", "StageNameCasing"}}
+	got := strings.Join(buildCheckArgs("app/Dockerfile", cfg, map[string]string{"VERSION": "1.2", "BASE": "alpine"}, "prod"), " ")
+	want := "build --call=check,format=json -f app/Dockerfile" +
+		" --build-arg BUILDKIT_DOCKERFILE_CHECK=skip=JSONArgsRecommended,StageNameCasing" +
+		" --build-arg BASE=alpine --build-arg VERSION=1.2 --target prod app"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestMergeBuildCheckIssues(t *testing.T) {
+	issues := []models.Issue{
+		{ID: "DL3025", Line: 4, Category: "best-practice"},
+		{ID: "HL-DL4000", Line: 2, Category: "hadolint"},
+		{ID: "DIO036", Line: 7, Category: "security"},
+	}
+	checkIssues := []models.Issue{
+		{ID: "BK-JSONArgsRecommended", Line: 4},
+		{ID: "BK-MaintainerDeprecated", Line: 2},
+		{ID: "BK-SecretsUsedInArgOrEnv", Line: 8},
+		{ID: "BK-UndefinedVar", Line: 4},
+	}
+	merged, decisions := mergeBuildCheckIssues(issues, checkIssues)
+	if len(decisions) != 4 {
+		t.Fatalf("expected 4 decisions, got %d", len(decisions))
+	}
+	kept := []bool{false, false, true, true}
+	for i, d := range decisions {
+		if d.Kept != kept[i] {
+			t.Errorf("decision %d (%s line %d): expected kept=%v, got %+v", i, d.Code, d.Line, kept[i], d)
+		}
+	}
+	if decisions[1].Reason != "duplicate of DL4000 on the same line" {
+		t.Errorf("unexpected reason %q", decisions[1].Reason)
+	}
+	if len(merged) != 5 || merged[3].ID != "BK-SecretsUsedInArgOrEnv" || merged[4].ID != "BK-UndefinedVar" {
+		t.Errorf("expected the kept findings appended, got %+v", merged)
+	}
+}
+
+func TestTrivyConfigIssues(t *testing.T) {
+	output := `{
+  "SchemaVersion": 2,
+  "ArtifactName": "Dockerfile",
+  "ArtifactType": "filesystem",
+  "Results": [
+    {
+      "Target": "Dockerfile",
+      "Class": "config",
+      "Type": "dockerfile",
+      "Misconfigurations": [
+        {
+          "Type": "Dockerfile Security Check",
+          "ID": "DS002",
+          "AVDID": "AVD-DS-0002",
+          "Title": "Image user should not be 'root'",
+          "Message": "Specify at least 1 USER command in Dockerfile with non-root user as argument",
+          "Resolution": "Add 'USER <non root user name>' line to the Dockerfile",
+          "Severity": "HIGH",
+          "PrimaryURL": "https://avd.aquasec.com/misconfig/ds002",
+          "Status": "FAIL",
+          "CauseMetadata": {"Provider": "Dockerfile", "Service": "general"}
+        },
+        {
+          "Type": "Dockerfile Security Check",
+          "ID": "DS004",
+          "AVDID": "AVD-DS-0004",
+          "Title": "Port 22 should not be exposed in Dockerfile",
+          "Message": "Port 22 should not be exposed in Dockerfile",
+          "Resolution": "Remove 'EXPOSE 22' statement from the Dockerfile",
+          "Severity": "MEDIUM",
+          "Status": "FAIL",
+          "CauseMetadata": {"StartLine": 6, "EndLine": 6}
+        },
+        {
+          "ID": "DS026",
+          "AVDID": "AVD-DS-0026",
+          "Title": "No HEALTHCHECK defined",
+          "Severity": "LOW",
+          "Status": "FAIL"
+        },
+        {
+          "ID": "DS005",
+          "AVDID": "AVD-DS-0005",
+          "Title": "ADD instead of COPY",
+          "Severity": "LOW",
+          "Status": "PASS"
+        }
+      ]
+    }
+  ]
+}`
+	issues, err := trivyConfigIssues([]byte(output), []string{"DS026"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues (the passed and excluded checks left out), got %+v", issues)
+	}
+	root, port := issues[0], issues[1]
+	if root.ID != "AVD-DS-0002" || root.Severity != models.SeverityHigh || root.Line != 0 {
+		t.Errorf("unexpected root user issue %+v", root)
+	}
+	if root.Suggestion != "Add 'USER <non root user name>' line to the Dockerfile" || root.DocsURL != "https://avd.aquasec.com/misconfig/ds002" {
+		t.Errorf("expected the resolution and URL of the check, got %+v", root)
+	}
+	if port.ID != "AVD-DS-0004" || port.Severity != models.SeverityMedium || port.Line != 6 {
+		t.Errorf("unexpected port issue %+v", port)
+	}
+
+	if _, err := trivyConfigIssues([]byte("not json"), nil); err == nil {
+		t.Error("expected an error for output that is not JSON")
+	}
+}
+
+func TestTrivyConfigArgs(t *testing.T) {
+	got := strings.Join(trivyConfigArgs("docker/app.dockerfile"), " ")
+	want := `config --format json --quiet --file-patterns dockerfile:app\.dockerfile$ docker/app.dockerfile`
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestMergeTrivyIssues(t *testing.T) {
+	issues := []models.Issue{
+		{ID: "DIO006", Line: 9, Category: "security"},
+		{ID: "HL-DL3020", Line: 3, Category: "hadolint"},
+	}
+	trivyIssues := []models.Issue{
+		{ID: "AVD-DS-0002", Line: 0},
+		{ID: "AVD-DS-0005", Line: 3},
+		{ID: "AVD-DS-0005", Line: 4},
+		{ID: "AVD-DS-0004", Line: 6},
+	}
+	merged, decisions := mergeTrivyIssues(issues, trivyIssues)
+	kept := []bool{false, false, true, true}
+	if len(decisions) != len(kept) {
+		t.Fatalf("expected %d decisions, got %d", len(kept), len(decisions))
+	}
+	for i, d := range decisions {
+		if d.Kept != kept[i] {
+			t.Errorf("decision %d (%s line %d): expected kept=%v, got %+v", i, d.Code, d.Line, kept[i], d)
+		}
+	}
+	if decisions[0].Reason != "duplicate of DIO006" || decisions[1].Reason != "duplicate of DL3020 on the same line" {
+		t.Errorf("unexpected reasons %q, %q", decisions[0].Reason, decisions[1].Reason)
+	}
+	if len(merged) != 4 {
+		t.Errorf("expected the 2 kept findings appended, got %+v", merged)
+	}
+}
+
+func TestExtendedRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantID  string
+	}{
+		{"cd in RUN", "FROM alpine:3.19\nRUN cd /tmp && make\n", "DL3003"},
+		{"ADD local file", "FROM alpine:3.19\nADD app.py /app/\n", "DL3020"},
+		{"shell form CMD", "FROM alpine:3.19\nCMD node index.js\n", "DL3025"},
+		{"pip cache", "FROM python:3.12\nRUN pip install flask\n", "DIO005-pip"},
+		{"pipe without pipefail", "FROM debian:12\nRUN curl -s https://x | sh\n", "DIO038"},
+		{"unknown COPY --from", "FROM alpine:3.19\nCOPY --from=build /out /out\n", "DL3022"},
+		{"duplicate alias", "FROM alpine:3.19 AS a\nFROM alpine:3.19 AS a\n", "DL3024"},
+	}
+
+	cfg := config.Default()
+	cfg.Analyzer.Ruleset = RulesetExtended
+	disabled := false
+	cfg.Hadolint.Enabled = &disabled
+	a, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := a.AnalyzeContent(tt.content)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			found := false
+			for _, issue := range result.Issues {
+				if issue.ID == tt.wantID {
+					found = true
+				}
+				if issue.ID == "DL3042" {
+					t.Error("DL3042 should be deduplicated against DIO005-pip")
+				}
+				if issue.ID == "DL4006" {
+					t.Error("DL4006 should be deduplicated against DIO038")
+				}
+			}
+			if !found {
+				t.Errorf("expected %s issue", tt.wantID)
+			}
+		})
+	}
+}
+
+func TestExtendedRules_DisabledByDefault(t *testing.T) {
+	result, err := New().AnalyzeContent("FROM alpine:3.19\nRUN cd /tmp\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, issue := range result.Issues {
+		if strings.HasPrefix(issue.ID, "DL") {
+			t.Errorf("unexpected extended issue %s with default ruleset", issue.ID)
+		}
+	}
+}
+
+func TestRuleDocs_CoverAllRules(t *testing.T) {
+	rules := append(DefaultRules(), ExtendedRules()...)
+	for _, rule := range rules {
+		doc, ok := LookupRuleDoc(rule.ID())
+		if !ok {
+			t.Errorf("rule %s has no documentation", rule.ID())
+			continue
+		}
+		if doc.URL == "" {
+			t.Errorf("rule %s has no docs URL", rule.ID())
+		}
+	}
+}
+
+func TestDocsURL(t *testing.T) {
+	if got := DocsURL("DIO005-pip"); !strings.HasSuffix(got, "#dio005") {
+		t.Errorf("DocsURL(DIO005-pip) = %q", got)
+	}
+	if got := DocsURL("HL-DL3008"); got != "https://github.com/hadolint/hadolint/wiki/DL3008" {
+		t.Errorf("DocsURL(HL-DL3008) = %q", got)
+	}
+	if got := DocsURL("SC2086"); got != "https://www.shellcheck.net/wiki/SC2086" {
+		t.Errorf("DocsURL(SC2086) = %q", got)
+	}
+}
+
+func TestIssueFilter_Apply(t *testing.T) {
+	issues := []models.Issue{
+		{ID: "DIO001", Severity: models.SeverityHigh, Category: "base-image"},
+		{ID: "DIO005-pip", Severity: models.SeverityLow, Category: "optimization"},
+		{ID: "DIO006", Severity: models.SeverityHigh, Category: "security"},
+	}
+
+	kept, filtered := IssueFilter{Severities: []string{"high"}}.Apply(issues)
+	if len(kept) != 2 || filtered != 1 {
+		t.Errorf("severity filter: got %d kept, %d filtered", len(kept), filtered)
+	}
+
+	kept, filtered = IssueFilter{Threshold: models.SeverityMedium}.Apply(issues)
+	if len(kept) != 2 || filtered != 1 {
+		t.Errorf("threshold: got %d kept, %d filtered", len(kept), filtered)
+	}
+
+	kept, _ = IssueFilter{RuleIDs: []string{"DIO005"}}.Apply(issues)
+	if len(kept) != 1 || kept[0].ID != "DIO005-pip" {
+		t.Errorf("rule filter should match variant IDs, got %+v", kept)
+	}
+
+	kept, filtered = IssueFilter{MaxIssues: 1}.Apply(issues)
+	if len(kept) != 1 || filtered != 2 {
+		t.Errorf("max-issues: got %d kept, %d filtered", len(kept), filtered)
+	}
+}
+
+func TestTooManyLayers_CountAndThreshold(t *testing.T) {
+	content := "FROM alpine:3.19 AS build\nRUN echo build\n\nFROM alpine:3.19\n" + strings.Repeat("RUN echo x\nCOPY a /a\n", 9)
+
+	result, err := New().AnalyzeContent(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var issue *models.Issue
+	for i := range result.Issues {
+		if result.Issues[i].ID == "DIO003" {
+			issue = &result.Issues[i]
+		}
+	}
+	if issue == nil {
+		t.Fatal("expected DIO003 issue")
+	}
+	if !strings.Contains(issue.Description, "18 layers") {
+		t.Errorf("expected real layer count in description, got %q", issue.Description)
+	}
+	if !strings.Contains(issue.Description, "build=1") {
+		t.Errorf("expected per-stage breakdown in description, got %q", issue.Description)
+	}
+
+	cfg := config.Default()
+	cfg.Analyzer.RuleOptions = map[string]map[string]interface{}{"DIO003": {"max_layers": 20}}
+	a, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result, _ = a.AnalyzeContent(content)
+	for _, i := range result.Issues {
+		if i.ID == "DIO003" {
+			t.Error("expected no DIO003 issue with max_layers=20")
+		}
+	}
+}
+
+func TestNewWithConfig_RuleOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		ruleset string
+		options map[string]map[string]interface{}
+		wantErr string
+	}{
+		{"configurable rule", "", map[string]map[string]interface{}{"DIO003": {"max_layers": 20}}, ""},
+		{"unknown rule", "", map[string]map[string]interface{}{"DIO03": {"max_layers": 20}}, "unknown rule DIO03"},
+		{"not configurable", "", map[string]map[string]interface{}{"DIO001": {"x": 1}}, "does not accept options"},
+		{"extended rule in the default ruleset", RulesetDefault, map[string]map[string]interface{}{"DL3003": {}}, "only in the extended ruleset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Analyzer.Ruleset = tt.ruleset
+			cfg.Analyzer.RuleOptions = tt.options
+			_, err := NewWithConfig(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewWithConfig_Ruleset(t *testing.T) {
+	for _, ruleset := range []string{"", RulesetDefault, RulesetExtended} {
+		cfg := config.Default()
+		cfg.Analyzer.Ruleset = ruleset
+		if _, err := NewWithConfig(cfg); err != nil {
+			t.Errorf("ruleset %q: unexpected error: %v", ruleset, err)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("ruleset %q: unexpected validation error: %v", ruleset, err)
+		}
+	}
+
+	cfg := config.Default()
+	cfg.Analyzer.Ruleset = "extendend"
+	if _, err := NewWithConfig(cfg); err == nil || !strings.Contains(err.Error(), `invalid analyzer.ruleset "extendend"`) {
+		t.Errorf("expected a misspelled ruleset to be rejected, got %v", err)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "analyzer.ruleset") {
+		t.Errorf("expected dio validate to reject a misspelled ruleset, got %v", err)
+	}
+}
+
+func TestStageAwareRules(t *testing.T) {
+	content := `FROM golang:1.22 AS builder
+USER builder
+HEALTHCHECK CMD true
+RUN go build -o /app
+
+FROM builder AS test
+RUN go test ./...
+
+FROM alpine:3.19
+COPY --from=builder /app /app
+CMD ["/app"]
+`
+	result, err := New().AnalyzeContent(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ids := make(map[string]models.Issue)
+	for _, issue := range result.Issues {
+		ids[issue.ID] = issue
+	}
+
+	root, ok := ids["DIO006"]
+	if !ok {
+		t.Fatal("expected DIO006: USER in builder stage must not count for the final stage")
+	}
+	if root.Stage != "stage 2" {
+		t.Errorf("expected DIO006 attributed to final stage, got %q", root.Stage)
+	}
+	if _, ok := ids["DIO012"]; !ok {
+		t.Error("expected DIO012: HEALTHCHECK in builder stage must not count for the final stage")
+	}
+	if _, ok := ids["DIO001"]; ok {
+		t.Error("FROM builder is a stage reference and must not be flagged as an unpinned image")
+	}
+
+	if len(result.Stages) != 3 || !result.Stages[2].Final {
+		t.Errorf("expected 3 stage results with the last marked final, got %+v", result.Stages)
+	}
+}
+
+func TestAnalyzeContent_Target(t *testing.T) {
+	content := `FROM golang:1.22 AS builder
+RUN go build -o /app
+
+FROM alpine:3.19 AS debug
+COPY --from=builder /app /app
+CMD ["/app"]
+
+FROM gcr.io/distroless/static-debian12:nonroot
+COPY --from=builder /app /app
+USER 65532
+HEALTHCHECK CMD ["/app", "-healthcheck"]
+CMD ["/app"]
+`
+	a := New()
+	a.SetTarget("DEBUG")
+	result, err := a.AnalyzeContent(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ids := make(map[string]models.Issue)
+	for _, issue := range result.Issues {
+		ids[issue.ID] = issue
+	}
+	if root, ok := ids["DIO006"]; !ok || root.Stage != "debug" {
+		t.Errorf("expected DIO006 in the debug target, got %+v", root)
+	}
+	if _, ok := ids["DIO012"]; !ok {
+		t.Error("expected DIO012: the HEALTHCHECK of the last stage isn't built with --target debug")
+	}
+	if result.Target != "DEBUG" || !result.Stages[1].Final || result.Stages[2].Final {
+		t.Errorf("expected the debug stage marked final, got target %q, stages %+v", result.Target, result.Stages)
+	}
+
+	a.SetTarget("release")
+	if _, err := a.AnalyzeContent(content); err == nil || !strings.Contains(err.Error(), `"release" not found`) {
+		t.Errorf("expected an error for a missing target stage, got %v", err)
+	}
+}
+
+func TestRootUserRule_InheritsFromStage(t *testing.T) {
+	content := "FROM alpine:3.19 AS base\nUSER app\n\nFROM base\nCMD [\"sh\"]\n"
+	result, err := New().AnalyzeContent(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, issue := range result.Issues {
+		if issue.ID == "DIO006" {
+			t.Error("final stage inherits USER app from base and must not be flagged")
+		}
+	}
+}
+
+func TestCopyFromExternalImage(t *testing.T) {
+	content := `FROM golang:1.22 AS builder
+RUN go build -o /app
+
+FROM alpine:3.19
+COPY --from=builder /app /app
+COPY --from=ghcr.io/foo/bar:latest /bin/tool /bin/tool
+COPY --from=localhost:5000/tools@sha256:abc /bin/x /bin/x
+`
+	result, err := New().AnalyzeContent(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var flagged []int
+	for _, issue := range result.Issues {
+		if issue.ID == "DIO001" {
+			flagged = append(flagged, issue.Line)
+		}
+	}
+	if len(flagged) != 1 || flagged[0] != 6 {
+		t.Errorf("expected DIO001 only for the unpinned COPY --from image on line 6, got lines %v", flagged)
+	}
+
+	var copyFrom []string
+	for _, ref := range result.ImageReferences {
+		if ref.Source == models.ImageSourceCopyFrom {
+			copyFrom = append(copyFrom, ref.Image)
+		}
+	}
+	if len(copyFrom) != 2 || copyFrom[0] != "ghcr.io/foo/bar:latest" {
+		t.Errorf("expected both external COPY --from images as references, got %v", copyFrom)
+	}
+}
+
+func TestDockerignore_Ignored(t *testing.T) {
+	tests := []struct {
+		patterns string
+		path     string
+		want     bool
+	}{
+		{"node_modules", "node_modules", true},
+		{"node_modules/", "node_modules", true},
+		{"/node_modules", "node_modules", true},
+		{"**/node_modules", "node_modules", true},
+		{"node_modules/*", "node_modules/x", true},
+		{"*.log", "node_modules", false},
+		{"dist\n!dist", "dist", false},
+		{".git", ".git/objects/ab", true},
+		{"ven?", "venv", true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), ".dockerignore")
+		if err := os.WriteFile(path, []byte(tt.patterns+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		patterns, err := parseDockerignore(path)
+		if err != nil {
+			t.Fatalf("parseDockerignore: %v", err)
+		}
+		if got := ignored(patterns, tt.path); got != tt.want {
+			t.Errorf("ignored(%q, %q) = %v, want %v", tt.patterns, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyze_IneffectiveDockerignore(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Dockerfile":            "FROM node:20-alpine\nCOPY . .\n",
+		".dockerignore":         "# logs\n*.log\n.git\n",
+		"node_modules/pkg/a.js": strings.Repeat("x", 2048),
+		".git/HEAD":             "ref: refs/heads/main\n",
+		"src/index.js":          "console.log(1)\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := NewWithOptions(false).Analyze(filepath.Join(dir, "Dockerfile"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var found []models.Issue
+	for _, issue := range result.Issues {
+		if issue.ID == "DIO013" {
+			found = append(found, issue)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("expected one DIO013 issue for node_modules, got %+v", found)
+	}
+	if !strings.Contains(found[0].Title, "node_modules") || !strings.Contains(found[0].Description, "2.0KB") {
+		t.Errorf("expected node_modules issue with measured size, got %q / %q", found[0].Title, found[0].Description)
+	}
+}
+
+func TestExpandArgs(t *testing.T) {
+	args := map[string]string{"BASE": "node", "TAG": "20-alpine", "EMPTY": ""}
+	tests := []struct {
+		in, want string
+	}{
+		{"${BASE}:${TAG}", "node:20-alpine"},
+		{"$BASE:$TAG", "node:20-alpine"},
+		{"${MISSING:-debian}:${TAG}", "debian:20-alpine"},
+		{"${EMPTY:-fallback}", "fallback"},
+		{"node${TAG:+-slim}", "node-slim"},
+		{"${MISSING}:1.0", "${MISSING}:1.0"},
+	}
+	for _, tt := range tests {
+		if got := ExpandArgs(tt.in, args); got != tt.want {
+			t.Errorf("ExpandArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLatestTagRule_ResolvesArgs(t *testing.T) {
+	content := "ARG BASE_IMAGE=node\nARG TAG=latest\nFROM ${BASE_IMAGE}:${TAG}\nCMD [\"node\"]\n"
+
+	hasDIO001 := func(result *models.AnalysisResult) bool {
+		for _, issue := range result.Issues {
+			if issue.ID == "DIO001" {
+				return true
+			}
+		}
+		return false
+	}
+
+	result, err := New().AnalyzeContent(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !hasDIO001(result) {
+		t.Error("expected DIO001: ARG defaults resolve to node:latest")
+	}
+
+	a := New()
+	a.SetBuildArgs(map[string]string{"TAG": "20.11-alpine", "UNDECLARED": "x"})
+	result, err = a.AnalyzeContent(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hasDIO001(result) {
+		t.Error("--build-arg TAG=20.11-alpine pins the image and must not be flagged")
+	}
+	if len(result.ImageReferences) != 1 || result.ImageReferences[0].Image != "node:20.11-alpine" {
+		t.Errorf("expected resolved image reference, got %+v", result.ImageReferences)
+	}
+
+	result, _ = New().AnalyzeContent("ARG IMAGE\nFROM $IMAGE\n")
+	if hasDIO001(result) {
+		t.Error("an unresolved ARG must not be reported as an untagged image")
+	}
+}
+
+func TestAnalyzeContent_FingerprintsIgnoreLineShifts(t *testing.T) {
+	before := "FROM ubuntu:22.04\nRUN apt-get update && apt-get install -y curl\n"
+	after := "# syntax=docker/dockerfile:1\n\nFROM ubuntu:22.04\nLABEL team=web\nRUN  apt-get update &&  apt-get install -y curl\n"
+
+	fingerprints := func(content string) map[string]string {
+		result, err := New().AnalyzeContent(content)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		fps := make(map[string]string)
+		for _, issue := range result.Issues {
+			if issue.Fingerprint == "" {
+				t.Errorf("%s has no fingerprint", issue.ID)
+			}
+			fps[issue.ID] = issue.Fingerprint
+		}
+		return fps
+	}
+
+	old, shifted := fingerprints(before), fingerprints(after)
+	if old["DIO004"] == "" || old["DIO004"] != shifted["DIO004"] {
+		t.Errorf("expected DIO004 to keep its fingerprint when lines shift: %q vs %q", old["DIO004"], shifted["DIO004"])
+	}
+}
+
+// newExtendedAnalyzer returns an analyzer with the extended ruleset and
+// hadolint disabled.
+func newExtendedAnalyzer(tb testing.TB) *Analyzer {
+	cfg := config.Default()
+	cfg.Analyzer.Ruleset = RulesetExtended
+	disabled := false
+	cfg.Hadolint.Enabled = &disabled
+	a, err := NewWithConfig(cfg)
+	if err != nil {
+		tb.Fatalf("NewWithConfig: %v", err)
+	}
+	return a
+}
+
+func TestRunRules_DeterministicOrder(t *testing.T) {
+	content, err := os.ReadFile("../../testdata/Dockerfile.sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newExtendedAnalyzer(t)
+
+	// Issues must come out in rule registration order, as if run sequentially
+	lines := strings.Split(string(content), "\n")
+	ctx := &AnalysisContext{FilePath: "<stdin>", Content: string(content), Lines: lines, ParsedFile: parseDockerfile(lines)}
+	var want []models.Issue
+	for _, rule := range a.rules {
+		want = append(want, rule.Check(ctx)...)
+	}
+	want = dropOverlappingExtendedIssues(want)
+
+	// Concurrent Analyze calls share the analyzer and must agree
+	results := make([][]models.Issue, 8)
+	done := make(chan struct{})
+	for i := range results {
+		go func(i int) {
+			defer func() { done <- struct{}{} }()
+			result, err := a.AnalyzeContent(string(content))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = result.Issues
+		}(i)
+	}
+	for range results {
+		<-done
+	}
+
+	for i, issues := range results {
+		if len(issues) != len(want) {
+			t.Fatalf("run %d: expected %d issues, got %d", i, len(want), len(issues))
+		}
+		for j := range want {
+			if issues[j].ID != want[j].ID || issues[j].Line != want[j].Line {
+				t.Errorf("run %d: issue %d is %s:%d, want %s:%d", i, j, issues[j].ID, issues[j].Line, want[j].ID, want[j].Line)
+			}
+		}
+	}
+}
+
+func BenchmarkAnalyzeContent(b *testing.B) {
+	content, err := os.ReadFile("../../testdata/Dockerfile.sample")
+	if err != nil {
+		b.Fatal(err)
+	}
+	a := newExtendedAnalyzer(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := a.AnalyzeContent(string(content)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAnalyzeContent_Parallel(b *testing.B) {
+	content, err := os.ReadFile("../../testdata/Dockerfile.sample")
+	if err != nil {
+		b.Fatal(err)
+	}
+	a := newExtendedAnalyzer(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := a.AnalyzeContent(string(content)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestAnalyze_Cache(t *testing.T) {
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	if err := os.WriteFile(dockerfile, []byte("FROM ubuntu:latest\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache := &Cache{Dir: filepath.Join(dir, "cache")}
+	a := newExtendedAnalyzer(t)
+	a.SetCache(cache)
+
+	first, err := a.Analyze(dockerfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(cache.Dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected one cache entry, got %d", len(entries))
+	}
+
+	// Tamper with the entry to prove the second run reads it
+	entry := filepath.Join(cache.Dir, entries[0].Name())
+	key := strings.TrimSuffix(entries[0].Name(), ".json")
+	first.Score = -1
+	if err := cache.Store(key, first); err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := a.Analyze(dockerfile); cached.Score != -1 {
+		t.Errorf("expected the cached result, got score %d", cached.Score)
+	}
+
+	// Changing the content or the settings must miss the cache
+	if err := os.WriteFile(dockerfile, []byte("FROM ubuntu:22.04\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := a.Analyze(dockerfile); result.Score == -1 {
+		t.Error("expected edited content to be re-analyzed")
+	}
+	a.SetBuildArgs(map[string]string{"VERSION": "1"})
+	if result, _ := a.Analyze(dockerfile); result.Score == -1 {
+		t.Error("expected new build args to be re-analyzed")
+	}
+	if _, err := os.Stat(entry); err != nil {
+		t.Errorf("expected the first entry to be kept: %v", err)
+	}
+	if entries, _ := os.ReadDir(cache.Dir); len(entries) != 3 {
+		t.Errorf("expected three cache entries, got %d", len(entries))
+	}
+}
+
+func TestCombineRunRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantLines []int
+	}{
+		{"three shell form RUNs", "FROM alpine:3.19\nRUN echo a\nRUN echo b\nRUN echo c\n", []int{2}},
+		{"exec form RUN ends the block", "FROM alpine:3.19\nRUN echo a\nRUN [\"echo\", \"b\"]\nRUN echo c\n", nil},
+		{"flags end the block", "FROM alpine:3.19\nRUN echo a\nRUN --mount=type=cache,target=/root/.cache echo b\nRUN echo c\n", nil},
+		{"cd ends the block", "FROM alpine:3.19\nRUN cd /tmp\nRUN echo b\nRUN echo c\n", nil},
+		{"comments don't separate RUNs", "FROM alpine:3.19\nRUN echo a\n# b\nRUN echo b\n\nRUN echo c\n", []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New().AnalyzeContent(tt.content)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var lines []int
+			for _, issue := range result.Issues {
+				if issue.ID == "DIO010" {
+					lines = append(lines, issue.Line)
+				}
+			}
+			if fmt.Sprint(lines) != fmt.Sprint(tt.wantLines) {
+				t.Errorf("expected DIO010 on lines %v, got %v", tt.wantLines, lines)
+			}
+		})
+	}
+}
+
+func TestStaticBinaryRule(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		wantLevels []models.Severity
+	}{
+		{
+			name:       "cgo go binary on scratch",
+			content:    "FROM golang:1.22 AS build\nRUN go build -o /app .\n\nFROM scratch\nCOPY --from=build /app /app\n",
+			wantLevels: []models.Severity{models.SeverityHigh},
+		},
+		{
+			name:    "cgo disabled on scratch",
+			content: "FROM golang:1.22 AS build\nENV CGO_ENABLED=0\nRUN go build -o /app .\n\nFROM scratch\nCOPY --from=build /app /app\n",
+		},
+		{
+			name:    "golang alpine without a compiler on scratch",
+			content: "FROM golang:1.22-alpine AS build\nRUN go build -o /app .\n\nFROM scratch\nCOPY --from=build /app /app\n",
+		},
+		{
+			name:       "glibc go binary on alpine",
+			content:    "FROM golang:1.22 AS build\nRUN go build -o /app .\n\nFROM alpine:3.19\nCOPY --from=build /app /app\n",
+			wantLevels: []models.Severity{models.SeverityHigh},
+		},
+		{
+			name:       "gnu rust binary on distroless static",
+			content:    "FROM rust:1.77 AS build\nRUN cargo build --release\n\nFROM gcr.io/distroless/static-debian12\nCOPY --from=build /target/release/app /app\n",
+			wantLevels: []models.Severity{models.SeverityHigh},
+		},
+		{
+			name:    "musl rust binary on scratch",
+			content: "FROM rust:1.77 AS build\nRUN cargo build --release --target x86_64-unknown-linux-musl\n\nFROM scratch\nCOPY --from=build /target/x86_64-unknown-linux-musl/release/app /app\n",
+		},
+		{
+			name:       "rust binary on distroless base",
+			content:    "FROM rust:1.77 AS build\nRUN cargo build --release\n\nFROM gcr.io/distroless/base-debian12\nCOPY --from=build /target/release/app /app\n",
+			wantLevels: []models.Severity{models.SeverityMedium},
+		},
+		{
+			name:       "static go binary on distroless base",
+			content:    "FROM golang:1.22 AS build\nRUN CGO_ENABLED=0 go build -o /app .\n\nFROM gcr.io/distroless/base-debian12\nCOPY --from=build /app /app\n",
+			wantLevels: []models.Severity{models.SeverityLow},
+		},
+		{
+			name:    "go binary on debian",
+			content: "FROM golang:1.22 AS build\nRUN go build -o /app .\n\nFROM debian:bookworm-slim\nCOPY --from=build /app /app\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New().AnalyzeContent(tt.content)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var levels []models.Severity
+			for _, issue := range result.Issues {
+				if issue.ID == "DIO014" {
+					levels = append(levels, issue.Severity)
+					if issue.Line != 5 {
+						t.Errorf("DIO014 on line %d, want the COPY --from on line 5", issue.Line)
+					}
+				}
+			}
+			if len(levels) != len(tt.wantLevels) || (len(levels) > 0 && levels[0] != tt.wantLevels[0]) {
+				t.Errorf("DIO014 severities = %v, want %v", levels, tt.wantLevels)
+			}
+		})
+	}
+}
+
+func TestCompiledBinaries(t *testing.T) {
+	content := `FROM golang:1.22 AS build
+ENV CGO_ENABLED=0
+RUN go build -o /out/server ./cmd/server && go build -o /out/cli ./cmd/cli
+
+FROM node:20 AS web
+RUN npm run build
+
+FROM gcr.io/distroless/static-debian12
+WORKDIR /app
+COPY --from=build /out/server .
+COPY --from=build /out/cli /out/healthcheck /usr/local/bin/
+COPY --from=build /out/config.yaml /etc/app/
+COPY --from=web /src/dist /app/static
+`
+	result, err := New().AnalyzeContent(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var paths []string
+	for _, bin := range result.Binaries {
+		if bin.Language != LanguageGo || bin.Stage != "build" || !bin.Static {
+			t.Errorf("unexpected binary %+v", bin)
+		}
+		paths = append(paths, bin.Path)
+	}
+	want := []string{"/app/server", "/usr/local/bin/cli", "/usr/local/bin/healthcheck"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("binary paths = %v, want %v", paths, want)
+	}
+}
+
+func TestRuntimeDataRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "certs installed in the build stage but not copied",
+			content: "FROM golang:1.22-alpine AS build\nRUN apk add --no-cache ca-certificates\nRUN CGO_ENABLED=0 go build -o /app .\n\nFROM scratch\nCOPY --from=build /app /app\n",
+			want:    []string{"DIO015"},
+		},
+		{
+			name:    "certs copied",
+			content: "FROM golang:1.22-alpine AS build\nRUN apk add --no-cache ca-certificates\nRUN CGO_ENABLED=0 go build -o /app .\n\nFROM scratch\nCOPY --from=build /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/\nCOPY --from=build /app /app\n",
+		},
+		{
+			name:    "https url and TZ on scratch",
+			content: "FROM golang:1.22 AS build\nRUN CGO_ENABLED=0 go build -o /app .\n\nFROM scratch\nENV API_URL=https://api.example.com TZ=Europe/Berlin\nCOPY --from=build /app /app\n",
+			want:    []string{"DIO015", "DIO016"},
+		},
+		{
+			name:    "embedded tzdata",
+			content: "FROM golang:1.22 AS build\nRUN CGO_ENABLED=0 go build -tags timetzdata -o /app .\n\nFROM scratch\nENV TZ=Europe/Berlin\nCOPY --from=build /app /app\n",
+		},
+		{
+			name:    "TZ on alpine",
+			content: "FROM alpine:3.19\nENV TZ=America/New_York\n",
+			want:    []string{"DIO016"},
+		},
+		{
+			name:    "tzdata installed on alpine",
+			content: "FROM alpine:3.19\nRUN apk add --no-cache tzdata\nENV TZ=America/New_York\n",
+		},
+		{
+			name:    "UTC needs no tzdata",
+			content: "FROM alpine:3.19\nENV TZ=UTC\n",
+		},
+		{
+			name:    "distroless static has both",
+			content: "FROM golang:1.22 AS build\nRUN apt-get install -y ca-certificates && CGO_ENABLED=0 go build -o /app .\n\nFROM gcr.io/distroless/static-debian12\nENV TZ=Europe/Berlin\nCOPY --from=build /app /app\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New().AnalyzeContent(tt.content)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, issue := range result.Issues {
+				if issue.ID == "DIO015" || issue.ID == "DIO016" {
+					got = append(got, issue.ID)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("issues = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestHealthcheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string // the HEALTHCHECK command, "" for no suggestion
+		copies  bool   // a probe binary is copied in
+	}{
+		{
+			name:    "no exposed port",
+			content: "FROM node:20\nCMD [\"node\", \"server.js\"]\n",
+		},
+		{
+			name:    "full node image has curl",
+			content: "FROM node:20\nEXPOSE 3000\n",
+			want:    "curl -fsS http://localhost:3000/ || exit 1",
+		},
+		{
+			name:    "slim python uses the interpreter",
+			content: "FROM python:3.12-slim\nEXPOSE 8000\n",
+			want:    `python -c "import urllib.request; urllib.request.urlopen('http://localhost:8000/')" || exit 1`,
+		},
+		{
+			name:    "alpine has busybox wget",
+			content: "FROM nginx:1.25-alpine\nEXPOSE 80 443\n",
+			want:    "wget -q --spider http://localhost:80/ || exit 1",
+		},
+		{
+			name:    "spring boot actuator",
+			content: "FROM eclipse-temurin:21-jre\nRUN apt-get update && apt-get install -y curl\nCOPY target/spring-boot-app.jar /app.jar\nEXPOSE 8080\n",
+			want:    "curl -fsS http://localhost:8080/actuator/health || exit 1",
+		},
+		{
+			name:    "database port gets a tcp check",
+			content: "FROM postgres:16\nEXPOSE 5432\n",
+			want:    "bash -c '</dev/tcp/localhost/5432' || exit 1",
+		},
+		{
+			name:    "unknown tools fall back from curl to wget",
+			content: "FROM debian:bookworm-slim\nEXPOSE 9000\n",
+			want:    "curl -fsS http://localhost:9000/ || wget -q --spider http://localhost:9000/ || exit 1",
+		},
+		{
+			name:    "distroless gets a probe binary",
+			content: "FROM golang:1.22 AS build\nRUN CGO_ENABLED=0 go build -o /app .\n\nFROM gcr.io/distroless/static-debian12\nCOPY --from=build /app /app\nEXPOSE 8080\n",
+			want:    `["/usr/local/bin/busybox", "wget", "-q", "--spider", "http://localhost:8080/"]`,
+			copies:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := SuggestHealthcheck(tt.content, nil, "")
+			if tt.want == "" {
+				if h != nil {
+					t.Errorf("expected no suggestion, got %+v", h)
+				}
+				return
+			}
+			if h == nil {
+				t.Fatal("expected a suggestion")
+			}
+			last := h.Instructions[len(h.Instructions)-1]
+			if got := last[strings.Index(last, " CMD ")+5:]; got != tt.want {
+				t.Errorf("HEALTHCHECK CMD = %s, want %s", got, tt.want)
+			}
+			if copies := len(h.Instructions) == 2; copies != tt.copies {
+				t.Errorf("instructions = %q, probe binary copied: want %t", h.Instructions, tt.copies)
+			}
+		})
+	}
+}
+
+func TestGenerateDockerignore(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"node_modules", "dist", ".git"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "package.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dockerfile := "FROM node:20-alpine\nCOPY package*.json ./\nRUN npm ci\nCOPY dist/ ./dist\nCOPY [\"coverage/report.html\", \"/srv/\"]\n"
+
+	got := GenerateDockerignore(dir, dockerfile)
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	has := func(pattern string) bool {
+		for _, line := range lines {
+			if line == pattern {
+				return true
+			}
+		}
+		return false
+	}
+	for _, want := range []string{".git", ".env", "node_modules", "**/npm-debug.log*"} {
+		if !has(want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	// Copied by the Dockerfile, so they must stay in the context
+	for _, unwanted := range []string{"dist", "coverage", "target"} {
+		if has(unwanted) {
+			t.Errorf("did not expect %q in:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	tests := []struct {
+		args string
+		want string
+	}{
+		{`A=1 B=2`, `[A=1 B=2]`},
+		{`MSG="hello world" PATH=/app/bin:$PATH`, `[MSG="hello world" PATH=/app/bin:$PATH]`},
+		{`GREETING=hello\ world`, `[GREETING=hello\ world]`},
+		{`MSG hello "big" world`, `[MSG="hello \"big\" world"]`},
+		{`SINGLE one`, `[SINGLE=one]`},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, v := range ParseEnv(tt.args) {
+			got = append(got, v.String())
+		}
+		if s := "[" + strings.Join(got, " ") + "]"; s != tt.want {
+			t.Errorf("ParseEnv(%q) = %s, want %s", tt.args, s, tt.want)
+		}
+	}
+}
+
+func TestSetsIDBit(t *testing.T) {
+	tests := map[string]bool{
+		"4755": true, "2755": true, "6750": true, "0755": false, "1777": false,
+		"u+s": true, "g+s": true, "+s": true, "ug=rwxs": true, "u+x,g+s": true,
+		"o+s": false, "u-s": false, "755": false, "a+rx": false,
+	}
+	for mode, want := range tests {
+		if got := setsIDBit(mode); got != want {
+			t.Errorf("setsIDBit(%q) = %v, want %v", mode, got, want)
+		}
+	}
+}
+
+func TestRunFlags(t *testing.T) {
+	flags, cmd := RunFlags("--mount=type=cache,dst=/var/lib/apt/lists,sharing=locked,z  --network=none apt-get update")
+	if cmd != "apt-get update" || len(flags) != 2 || flags[1] != "--network=none" {
+		t.Fatalf("RunFlags = %q, %q", flags, cmd)
+	}
+	m := ParseMount(strings.TrimPrefix(flags[0], "--mount="))
+	if m.Type != "cache" || m.Target != "/var/lib/apt/lists" || strings.Join(m.Options, ",") != "sharing=locked,z" {
+		t.Errorf("ParseMount = %+v", m)
+	}
+	if m := ParseMount("src=.,target=/src,U"); m.Type != "bind" || m.Source != "." || m.Target != "/src" {
+		t.Errorf("ParseMount of a bind mount = %+v", m)
+	}
+	if flags, cmd := RunFlags("--verbose true"); flags != nil || cmd != "--verbose true" {
+		t.Errorf("a command starting with a dash was taken as flags: %q, %q", flags, cmd)
+	}
+}
+
+func TestDanglingStageRefs(t *testing.T) {
+	content := `FROM golang:1.22 AS build
+RUN go build -o /app .
+
+FROM alpine:3.19 AS certs
+RUN apk add ca-certificates
+
+FROM scratch
+COPY --from=builder /app /app
+COPY --from=certs /etc/ssl/certs /etc/ssl/certs
+COPY --from=5 /tmp /tmp
+RUN --mount=from=build,target=/src true
+`
+	pdf := ParseDockerfile(strings.Split(content, "\n"), nil)
+	got := pdf.DanglingStageRefs([]string{"builder", "certs", "build"})
+	if want := []string{"builder", "5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DanglingStageRefs() = %v; want %v", got, want)
+	}
+}
+
+func TestDeadStages(t *testing.T) {
+	content := `FROM node:20 AS deps
+RUN npm ci
+
+FROM deps AS test
+RUN npm test
+
+FROM node:20 AS assets
+RUN --mount=type=bind,from=deps,target=/deps npm run build
+
+FROM nginx:alpine
+COPY --from=2 /dist /usr/share/nginx/html
+`
+	pdf := ParseDockerfile(strings.Split(content, "\n"), nil)
+	dead := pdf.DeadStages()
+	if len(dead) != 1 || dead[0].Index != 1 || dead[0].ShadowedBy != -1 {
+		t.Errorf("DeadStages() = %+v; want only the test stage", dead)
+	}
+	// Stages after the target are other images.
+	pdf.Target = "test"
+	if dead := pdf.DeadStages(); len(dead) != 0 {
+		t.Errorf("DeadStages() with --target test = %+v; want none", dead)
+	}
+
+	pdf = ParseDockerfile(strings.Split(strings.Replace(content, "--from=2", "--from=${STAGE}", 1), "\n"), nil)
+	if dead := pdf.DeadStages(); dead != nil {
+		t.Errorf("DeadStages() with an unresolved --from = %+v; want nil", dead)
+	}
+}
+
+func TestArtifacts(t *testing.T) {
+	content := `FROM golang:1.23 AS build
+WORKDIR /src
+RUN go build -o bin/app . && go build -o bin/tool ./tool
+
+FROM alpine:3.19 AS bundle
+WORKDIR /opt
+COPY --from=build /src/bin/ bin/
+COPY --from=0 src/bin/tool /usr/bin/tool
+
+FROM bundle AS runtime
+COPY --from=build / /
+
+FROM scratch
+COPY --from=runtime /opt/bin/app /app
+`
+	pdf := ParseDockerfile(strings.Split(content, "\n"), nil)
+	artifacts := pdf.Artifacts()
+	if len(artifacts) != 4 {
+		t.Fatalf("Artifacts() = %+v; want 4", artifacts)
+	}
+	want := []struct {
+		from, dest string
+		final      bool
+	}{
+		{"build", "/opt/bin", true},
+		{"build", "/usr/bin/tool", false},
+		{"build", "/", true},
+		{"runtime", "/app", true},
+	}
+	for i, w := range want {
+		a := artifacts[i]
+		if a.From != w.from || a.Dest != w.dest || a.ReachesFinal != w.final {
+			t.Errorf("artifact %d = %+v; want from %s to %s, reaches final %v", i, a, w.from, w.dest, w.final)
+		}
+	}
+	if a := artifacts[1]; a.Sources[0] != "/src/bin/tool" {
+		t.Errorf("a relative COPY --from source resolves against the stage root, got %q", a.Sources[0])
+	}
+
+	issues := (&WholeStageCopyRule{}).Check(&AnalysisContext{ParsedFile: pdf})
+	if len(issues) != 1 || issues[0].Line != 11 || !strings.Contains(issues[0].Suggestion, "COPY --from=build /src/bin/app /src/bin/app") {
+		t.Errorf("WholeStageCopyRule = %+v", issues)
+	}
+}
+
+func TestCUDARules(t *testing.T) {
+	check := func(rule Rule, content string) []models.Issue {
+		t.Helper()
+		pdf := ParseDockerfile(strings.Split(content, "\n"), nil)
+		return rule.Check(&AnalysisContext{ParsedFile: pdf})
+	}
+
+	devel := "FROM nvidia/cuda:12.2.2-devel-ubuntu22.04 AS build\nRUN nvcc -o /kernel kernel.cu\n\nFROM nvcr.io/nvidia/cuda:12.2.2-devel-ubuntu22.04\nCOPY --from=build /kernel /kernel\n"
+	if issues := check(&CUDADevelRule{}, devel); len(issues) != 1 || issues[0].Line != 4 ||
+		!strings.Contains(issues[0].Suggestion, "nvcr.io/nvidia/cuda:12.2.2-runtime-ubuntu22.04") {
+		t.Errorf("CUDADevelRule = %+v; want the final stage only", issues)
+	}
+	if issues := check(&CUDADevelRule{}, strings.Replace(devel, "-devel-ubuntu22.04\nCOPY", "-runtime-ubuntu22.04\nCOPY", 1)); len(issues) != 0 {
+		t.Errorf("CUDADevelRule with a -devel build stage = %+v; want none", issues)
+	}
+
+	versions := "FROM nvidia/cuda:12.4-runtime\nRUN apt-get install -y libcudnn8 libcudnn8-dev=8.9.7.29-1+cuda12.2 cuda-toolkit-12-4 cuda-drivers\n"
+	issues := check(&CUDAVersionRule{}, versions)
+	if len(issues) != 2 || issues[0].Line != 1 || !strings.HasPrefix(issues[1].Description, "libcudnn8 is installed") {
+		t.Errorf("CUDAVersionRule = %+v", issues)
+	}
+
+	driver := "FROM ubuntu:22.04\nRUN apt-get install -y nvidia-utils-535\nRUN sh NVIDIA-Linux-x86_64-535.104.05.run --silent\n"
+	if issues := check(&GPUDriverRule{}, driver); len(issues) != 2 {
+		t.Errorf("GPUDriverRule = %+v; want the package and the runfile", issues)
+	}
+}
+
+func TestPipInstalls(t *testing.T) {
+	installs := PipInstalls(`apt-get install -y python3-pip && PIP_NO_INPUT=1 pip3 install -U --no-cache-dir -rrequirements.txt "Torch_Audio[extra]>=2.3" -c constraints.txt --index-url=https://download.pytorch.org/whl/cpu && python3 -m pip install -e ./lib`)
+	if len(installs) != 2 {
+		t.Fatalf("PipInstalls = %+v; want 2", installs)
+	}
+	first := installs[0]
+	if !first.NoCacheDir || first.Local || first.IndexURL != "https://download.pytorch.org/whl/cpu" ||
+		strings.Join(first.Packages, ",") != "torch-audio" || first.Requirements[0] != "requirements.txt" || first.Constraints[0] != "constraints.txt" {
+		t.Errorf("first install = %+v", first)
+	}
+	if !strings.HasPrefix(first.Command, "pip3 install -U") {
+		t.Errorf("Command = %q; want it from pip3 on", first.Command)
+	}
+	if second := installs[1]; !second.Local || len(second.Packages) != 0 {
+		t.Errorf("second install = %+v; want a local project", second)
+	}
+}
+
+func TestCondaEnvFileOf(t *testing.T) {
+	parse := func(content string) *ParsedDockerfile {
+		return ParseDockerfile(strings.Split(content, "\n"), nil)
+	}
+	env := parse("FROM continuumio/miniconda3:24.1.2-0\nCOPY envs/prod.yml /tmp/env.yml\nRUN conda env create --file /tmp/env.yml && conda clean -afy\nCMD [\"python\"]").CondaEnvFileOf()
+	if env == nil || env.Source != "envs/prod.yml" || env.Run.Line != 3 {
+		t.Fatalf("CondaEnvFileOf = %+v; want envs/prod.yml created on line 3", env)
+	}
+	for _, content := range []string{
+		// Not a conda image
+		"FROM debian:bookworm-slim\nCOPY environment.yml .\nRUN conda env create -f environment.yml",
+		// The file isn't copied on its own
+		"FROM continuumio/miniconda3:24.1.2-0\nCOPY . .\nRUN conda env create -f environment.yml",
+		// conda is needed at runtime
+		"FROM continuumio/miniconda3:24.1.2-0\nCOPY environment.yml .\nRUN conda env create -f environment.yml\nCMD [\"conda\", \"run\", \"-n\", \"app\", \"python\"]",
+		// More than the environment in the RUN
+		"FROM continuumio/miniconda3:24.1.2-0\nCOPY environment.yml .\nRUN conda env create -f environment.yml && conda install -y git",
+	} {
+		if env := parse(content).CondaEnvFileOf(); env != nil {
+			t.Errorf("CondaEnvFileOf(%q) = %+v; want nil", content, env)
+		}
+	}
+}
+
+func TestJDKImage(t *testing.T) {
+	for image, want := range map[string]int{
+		"eclipse-temurin:21-jdk-jammy":     21,
+		"eclipse-temurin:17.0.10_7-jdk":    17,
+		"openjdk:11":                       11,
+		"amazoncorretto:8u402-alpine3.19":  8,
+		"maven:3.9-eclipse-temurin-21":     21,
+		"gradle:8.5-jdk17":                 17,
+		"mcr.microsoft.com/openjdk/jdk:21": 21,
+		"eclipse-temurin":                  0,
+	} {
+		if got, ok := jdkImage(image); !ok || got != want {
+			t.Errorf("jdkImage(%q) = %d, %v; want %d, true", image, got, ok, want)
+		}
+	}
+	for _, image := range []string{"eclipse-temurin:21-jre", "openjdk:8-jre-slim", "python:3.12"} {
+		if _, ok := jdkImage(image); ok {
+			t.Errorf("jdkImage(%q) reports a JDK", image)
+		}
+	}
+}
+
+func TestJavaApp(t *testing.T) {
+	parse := func(content string) *ParsedDockerfile {
+		return ParseDockerfile(strings.Split(content, "\n"), nil)
+	}
+	app := parse("FROM eclipse-temurin:17-jdk\nWORKDIR /app\nCOPY target/*.jar app.jar\nCMD java -Xmx512m -jar app.jar").JavaApp()
+	if app == nil || !app.Linkable() || app.Jar != "/app/app.jar" || app.Source != "target/*.jar" || app.From != "" {
+		t.Fatalf("JavaApp = %+v; want target/*.jar copied to /app/app.jar", app)
+	}
+	if jdk, runtime := app.Sizes(); runtime >= jdk || runtime < jlinkBaseSize {
+		t.Errorf("Sizes = %d, %d", jdk, runtime)
+	}
+	// Built in the final stage
+	app = parse("FROM maven:3.9-eclipse-temurin-17\nCOPY . .\nRUN mvn package\nCOPY target/app.jar /app.jar\nCMD [\"java\", \"-jar\", \"/app.jar\"]").JavaApp()
+	if app == nil || app.Linkable() {
+		t.Errorf("JavaApp = %+v; want a JDK that can't be replaced", app)
+	}
+	if app := parse("FROM eclipse-temurin:21-jre\nCOPY app.jar .\nCMD [\"java\", \"-jar\", \"app.jar\"]").JavaApp(); app != nil {
+		t.Errorf("JavaApp = %+v for a JRE image", app)
+	}
+}
+
+func TestFrontendBuilds(t *testing.T) {
+	parse := func(content string) *ParsedDockerfile {
+		return ParseDockerfile(strings.Split(content, "\n"), nil)
+	}
+	pdf := parse("FROM node:20 AS build\nWORKDIR /src\nRUN npm ci && npx vite build --outDir public\nFROM node:20 AS cra\nWORKDIR /web\nRUN npx react-scripts build\nRUN find build -name '*.map' -delete\nFROM nginx:alpine\nCOPY --from=build /src/public /usr/share/nginx/html")
+	builds := pdf.FrontendBuilds()
+	if len(builds) != 2 {
+		t.Fatalf("FrontendBuilds = %+v; want 2", builds)
+	}
+	if builds[0].Output != "/src/public" || builds[0].SourceMaps {
+		t.Errorf("vite build = %+v; want /src/public without source maps", builds[0])
+	}
+	if builds[1].Output != "/web/build" || builds[1].SourceMaps {
+		t.Errorf("react-scripts build = %+v; want /web/build with its maps deleted", builds[1])
+	}
+
+	site := parse("FROM node:20-alpine\nWORKDIR /app\nRUN npm ci && npm run build\nEXPOSE 8080\nCMD npx http-server dist -s").StaticFrontendOf()
+	if site == nil || site.Server.Dir != "/app/dist" || site.Server.Port != "8080" || site.Server.SPA {
+		t.Errorf("StaticFrontendOf = %+v; want /app/dist served on 8080", site)
+	}
+	// npm run serve runs a script, not a static server
+	if site := parse("FROM node:20-alpine\nRUN npm ci && npm run build\nCMD [\"npm\", \"run\", \"serve\"]").StaticFrontendOf(); site != nil {
+		t.Errorf("StaticFrontendOf = %+v; want nil for npm run serve", site)
+	}
+}
+
+func TestFindDockerfile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := FindDockerfile(dir); err == nil {
+		t.Error("expected an error for a directory without a Dockerfile")
+	}
+	for _, name := range []string{"Dockerfile", "Containerfile"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("FROM alpine:3.19\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := FindDockerfile(dir); err != nil || filepath.Base(got) != "Containerfile" {
+		t.Errorf("FindDockerfile = %q, %v; want the Containerfile", got, err)
+	}
+	if got := IgnoreFile(dir); filepath.Base(got) != ".dockerignore" {
+		t.Errorf("IgnoreFile = %q, want .dockerignore", got)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".containerignore"), []byte(".git\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := IgnoreFile(dir); filepath.Base(got) != ".containerignore" {
+		t.Errorf("IgnoreFile = %q, want .containerignore", got)
+	}
+}
+
+func TestDetectUpdater(t *testing.T) {
+	write := func(dir, name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := func(files map[string]string) string {
+		dir := t.TempDir()
+		write(dir, ".git/HEAD", "ref: refs/heads/main\n")
+		write(dir, "api/Dockerfile", "FROM node\n")
+		for name, content := range files {
+			write(dir, name, content)
+		}
+		return filepath.Join(dir, "api", "Dockerfile")
+	}
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"none", nil, ""},
+		{"renovate", map[string]string{"renovate.json": `{"extends": ["config:recommended"]}`}, UpdaterRenovate},
+		{"renovate json5", map[string]string{".github/renovate.json5": "{ extends: ['config:recommended'] }"}, UpdaterRenovate},
+		{"renovate without dockerfile manager", map[string]string{"renovate.json": `{"enabledManagers": ["npm"]}`}, ""},
+		{"renovate dockerfile disabled", map[string]string{".renovaterc": `{"dockerfile": {"enabled": false}}`}, ""},
+		{"renovate in package.json", map[string]string{"package.json": `{"name": "app", "renovate": {}}`}, UpdaterRenovate},
+		{"dependabot", map[string]string{".github/dependabot.yml": "version: 2\nupdates:\n  - package-ecosystem: docker\n    directory: /api\n"}, UpdaterDependabot},
+		{"dependabot glob", map[string]string{".github/dependabot.yml": "version: 2\nupdates:\n  - package-ecosystem: docker\n    directories: [\"/**\"]\n"}, UpdaterDependabot},
+		{"dependabot other directory", map[string]string{".github/dependabot.yml": "version: 2\nupdates:\n  - package-ecosystem: docker\n    directory: /\n  - package-ecosystem: npm\n    directory: /api\n"}, ""},
+	}
+	for _, tt := range tests {
+		if got := DetectUpdater(repo(tt.files)); got != tt.want {
+			t.Errorf("%s: DetectUpdater = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLatestTagRule_Updater(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		".git/HEAD":     "ref: refs/heads/main\n",
+		"renovate.json": "{}",
+		"Dockerfile":    "FROM node\nCOPY --from=busybox:latest /bin/sh /bin/sh\nFROM alpine:3.19\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := NewWithOptions(false).Analyze(filepath.Join(dir, "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Updater != UpdaterRenovate {
+		t.Errorf("Updater = %q, want renovate", result.Updater)
+	}
+	var pins int
+	for _, issue := range result.Issues {
+		if issue.ID != "DIO001" {
+			continue
+		}
+		pins++
+		if issue.Title != "Base image not pinned by digest" || issue.Severity != models.SeverityMedium {
+			t.Errorf("expected a digest pin suggestion, got %+v", issue)
+		}
+	}
+	if pins != 2 {
+		t.Errorf("expected 2 digest pin suggestions, got %d", pins)
+	}
+
+	// analyzer.updater: none reports unpinned tags as usual
+	a, err := NewWithConfig(&config.Config{Analyzer: config.AnalyzerConfig{Updater: UpdaterNone}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = a.Analyze(filepath.Join(dir, "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Updater != "" || len(result.Issues) == 0 || result.Issues[0].Title != "Unpinned base image tag" {
+		t.Errorf("expected the updater to be ignored, got %q and %+v", result.Updater, result.Issues)
+	}
+
+	if _, err := NewWithConfig(&config.Config{Analyzer: config.AnalyzerConfig{Updater: "greenkeeper"}}); err == nil {
+		t.Error("expected an error for an unknown updater")
+	}
+}
+
+func TestImageKindSeverities(t *testing.T) {
+	const content = "FROM node:20-alpine\nCOPY . /app\nCMD [\"node\", \"/app/index.js\"]\n"
+	analyze := func(image config.ImageConfig) *models.AnalysisResult {
+		t.Helper()
+		a, err := NewWithConfig(&config.Config{Image: image, Hadolint: config.HadolintConfig{Enabled: new(bool)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := a.AnalyzeContent(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	severity := func(result *models.AnalysisResult, id string) (models.Severity, models.Severity) {
+		for _, issue := range result.Issues {
+			if issue.ID == id {
+				return issue.Severity, issue.DefaultSeverity
+			}
+		}
+		t.Fatalf("no %s issue in %+v", id, result.Issues)
+		return "", ""
+	}
+
+	plain := analyze(config.ImageConfig{})
+	if sev, def := severity(plain, "DIO012"); sev != models.SeverityInfo || def != "" {
+		t.Errorf("without a kind, DIO012 = %s (was %s), want info", sev, def)
+	}
+
+	service := analyze(config.ImageConfig{Kind: KindService})
+	if sev, def := severity(service, "DIO012"); sev != models.SeverityHigh || def != models.SeverityInfo {
+		t.Errorf("for a service, DIO012 = %s (was %s), want high (was info)", sev, def)
+	}
+	if service.ImageKind != KindService || service.Score >= plain.Score {
+		t.Errorf("expected the raised severity to lower the score: %d vs %d", service.Score, plain.Score)
+	}
+
+	base := analyze(config.ImageConfig{Kind: KindBaseImage, Severities: map[string]map[string]string{
+		KindBaseImage: {"DIO006": "low", "DIO011": "high"},
+	}})
+	if sev, def := severity(base, "DIO006"); sev != models.SeverityLow || def != models.SeverityHigh {
+		t.Errorf("configured DIO006 = %s (was %s), want low (was high)", sev, def)
+	}
+	if sev, _ := severity(base, "DIO011"); sev != models.SeverityHigh {
+		t.Errorf("configured DIO011 = %s, want high", sev)
+	}
+
+	for _, bad := range []config.ImageConfig{
+		{Kind: "daemon"},
+		{Kind: KindJob, Severities: map[string]map[string]string{"cron": {"DIO012": "info"}}},
+		{Kind: KindJob, Severities: map[string]map[string]string{KindJob: {"DIO012": "none"}}},
+	} {
+		if _, err := NewWithConfig(&config.Config{Image: bad}); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestClassifyImage(t *testing.T) {
+	tests := []struct {
+		name, path, content, want string
+	}{
+		{"onbuild", "Dockerfile", "FROM node:20\nONBUILD COPY . /app\nCMD [\"node\"]\n", KindBaseImage},
+		{"tooling only", "Dockerfile", "FROM ubuntu:22.04\nRUN apt-get update && apt-get install -y git make\n", KindBaseImage},
+		{"named base", "images/Dockerfile.base", "FROM python:3.12\nCOPY requirements.txt /opt/\nRUN pip install -r /opt/requirements.txt\n", KindBaseImage},
+		{"base directory", "base/Dockerfile", "FROM python:3.12\nCOPY certs/ /usr/local/share/ca-certificates/\n", KindBaseImage},
+		{"app", "Dockerfile", "FROM python:3.12\nCOPY . /app\nCMD [\"python\", \"/app/main.py\"]\n", ""},
+		{"inherited CMD", "Dockerfile", "FROM nginx:1.27\nCOPY site/ /usr/share/nginx/html\n", ""},
+		{"exposes", "Dockerfile", "FROM nginx:1.27\nEXPOSE 8080\n", ""},
+		{"database", "database/Dockerfile", "FROM postgres:16\nCOPY init.sql /docker-entrypoint-initdb.d/\n", ""},
+		{"builder stage runs", "Dockerfile", "FROM golang:1.22 AS build\nRUN go build -o /app .\nFROM scratch\nCOPY --from=build /app /app\nENTRYPOINT [\"/app\"]\n", ""},
+	}
+	for _, tt := range tests {
+		kind, reasons := ClassifyImage(parseDockerfile(strings.Split(tt.content, "\n")), tt.path)
+		if kind != tt.want {
+			t.Errorf("%s: ClassifyImage = %q (%v), want %q", tt.name, kind, reasons, tt.want)
+		}
+		if kind != "" && len(reasons) == 0 {
+			t.Errorf("%s: expected reasons for the classification", tt.name)
+		}
+	}
+
+	// Detected base images get the base image severities; a declared kind
+	// or none overrides detection
+	const content = "FROM ubuntu:22.04\nRUN apt-get update && apt-get install -y --no-install-recommends git\n"
+	for kind, want := range map[string]models.Severity{"": models.SeverityInfo, KindJob: models.SeverityHigh, KindNone: models.SeverityHigh} {
+		a := New()
+		a.SetImage(config.ImageConfig{Kind: kind})
+		result, err := a.AnalyzeContent(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, issue := range result.Issues {
+			if issue.ID == "DIO006" && issue.Severity != want {
+				t.Errorf("kind %q: DIO006 = %s, want %s", kind, issue.Severity, want)
+			}
+		}
+	}
+}
+
+func TestGoldenImageRule(t *testing.T) {
+	golden := []config.GoldenImage{
+		{Name: "registry.corp/golden/python", Tags: []string{"3.12"}, Runtimes: []string{"python"}},
+		{Name: "registry.corp/golden/node", Runtimes: []string{"node"}},
+	}
+	tests := []struct {
+		name       string
+		content    string
+		golden     []config.GoldenImage
+		suggestion string // "" when no issue is expected
+	}{
+		{"no catalog", "FROM python:3.12\nCMD [\"python\", \"app.py\"]", nil, ""},
+		{"runtime from image", "FROM python:3.12-slim\nCMD [\"python\", \"app.py\"]", golden, "Use 'registry.corp/golden/python:3.12', the golden image for python."},
+		{"runtime from commands", "FROM debian:bookworm-slim\nRUN apt-get install -y nodejs npm && npm ci\nCMD [\"node\", \"index.js\"]", golden, "Use 'registry.corp/golden/node', the golden image for node."},
+		{"runtime from build stage", "FROM python:3.12 AS build\nRUN pip wheel -w /wheels .\nFROM ubuntu:22.04\nCOPY --from=build /wheels /wheels", golden, "Use 'registry.corp/golden/python:3.12', the golden image for python."},
+		{"golden image", "FROM registry.corp/golden/python:3.12\nCMD [\"python\", \"app.py\"]", golden, ""},
+		{"golden image with any tag", "FROM registry.corp/golden/node:22\nCMD [\"node\", \"index.js\"]", golden, ""},
+		{"unapproved tag", "FROM registry.corp/golden/python:3.9\nCMD [\"python\", \"app.py\"]", golden, "Use 'registry.corp/golden/python:3.12'."},
+		{"build stage only", "FROM golang:1.22 AS build\nRUN go build -o /app .\nFROM scratch\nCOPY --from=build /app /app", golden, ""},
+		{"no golden image for runtime", "FROM ruby:3.3\nCMD [\"ruby\", \"app.rb\"]", golden, "No golden image provides ruby: use one of registry.corp/golden/python:3.12, registry.corp/golden/node, or add one to the catalog."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewWithOptions(false)
+			a.SetGoldenImages(tt.golden)
+			result, err := a.AnalyzeContent(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var suggestion string
+			for _, issue := range result.Issues {
+				if issue.ID == "DIO035" {
+					suggestion = issue.Suggestion
+				}
+			}
+			if suggestion != tt.suggestion {
+				t.Errorf("DIO035 suggestion = %q, want %q", suggestion, tt.suggestion)
+			}
+		})
+	}
+}
+
+func TestSecretRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		lines   []int
+	}{
+		{"env literal", "FROM node:20\nENV NPM_TOKEN=npm_abc123 NODE_ENV=production", []int{2}},
+		{"legacy env", "FROM node:20\nENV DB_PASSWORD hunter2", []int{2}},
+		{"arg default", "ARG GITHUB_TOKEN=ghp_abc\nFROM alpine:3.19", []int{1}},
+		{"from variable", "FROM node:20\nARG API_KEY\nENV API_KEY=$API_KEY", nil},
+		{"empty", "FROM node:20\nENV AWS_SECRET_ACCESS_KEY=\"\"", nil},
+		{"not a secret name", "FROM node:20\nENV TOKEN_TTL=3600 PASSWORD_FILE=/run/secrets/db", nil},
+		{"ssh key copied", "FROM alpine:3.19\nCOPY id_rsa /root/.ssh/id_rsa", []int{2}},
+		{"key in a build stage", "FROM alpine:3.19 AS build\nCOPY deploy.key /tmp/\nFROM alpine:3.19\nCOPY --from=build /out /out", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []int
+			pdf := parseDockerfile(strings.Split(tt.content, "\n"))
+			for _, issue := range (&SecretRule{}).Check(&AnalysisContext{ParsedFile: pdf}) {
+				lines = append(lines, issue.Line)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("DIO036 lines = %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
+
+func TestImageConfigIssues(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		cfg     models.RuntimeConfig
+		want    []string // ID@line
+	}{
+		{"no command", "FROM scratch\nCOPY app /app", models.RuntimeConfig{}, []string{"DIO042@1"}},
+		{"inherited shell", "FROM debian:bookworm-slim\nCOPY app /usr/local/bin/app", models.RuntimeConfig{Cmd: []string{"bash"}}, []string{"DIO043@1"}},
+		{"shell cmd", "FROM alpine:3.19\nCOPY app /app\nCMD [\"/bin/sh\"]", models.RuntimeConfig{Cmd: []string{"/bin/sh"}}, []string{"DIO043@3"}},
+		{"shell with script", "FROM alpine:3.19\nCMD [\"/bin/sh\", \"-c\", \"exec app\"]", models.RuntimeConfig{Cmd: []string{"/bin/sh", "-c", "exec app"}}, nil},
+		{"leaked arg", "FROM node:20-slim\nARG NPM_TOKEN\nENV NPM_TOKEN=$NPM_TOKEN\nCMD [\"node\"]",
+			models.RuntimeConfig{Cmd: []string{"node"}, Env: []string{"NPM_TOKEN=abc"}}, []string{"DIO044@3"}},
+		{"arg of another stage", "FROM node:20 AS build\nARG VERSION\nFROM node:20-slim\nENV VERSION=$VERSION\nCMD [\"node\"]",
+			models.RuntimeConfig{Cmd: []string{"node"}, Env: []string{"VERSION=1"}}, nil},
+		{"env set again", "FROM node:20-slim\nARG MODE\nENV MODE=$MODE\nENV MODE=production\nCMD [\"node\"]",
+			models.RuntimeConfig{Cmd: []string{"node"}, Env: []string{"MODE=production"}}, nil},
+		{"world-writable workdir", "FROM node:20-slim\nWORKDIR /app\nRUN chmod 777 /app\nCMD [\"node\"]",
+			models.RuntimeConfig{Cmd: []string{"node"}, WorkingDir: "/app", WorkingDirMode: "0777"}, []string{"DIO045@2"}},
+		{"private workdir", "FROM node:20-slim\nWORKDIR /app\nCMD [\"node\"]",
+			models.RuntimeConfig{Cmd: []string{"node"}, WorkingDir: "/app", WorkingDirMode: "0755"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, issue := range imageConfigIssues(parseDockerfile(strings.Split(tt.content, "\n")), &tt.cfg) {
+				got = append(got, fmt.Sprintf("%s@%d", issue.ID, issue.Line))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("issues = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBudget(t *testing.T) {
+	budget := ParseBudget([]string{"# dio:budget size=150MB layers=12", "FROM node:20-slim"})
+	if want := (&models.SizeBudget{Size: "150MB", Layers: 12, Line: 1}); !reflect.DeepEqual(budget, want) {
+		t.Errorf("expected %+v, got %+v", want, budget)
+	}
+
+	content := "FROM node:20-slim\n# dio:budget size=150 layers=many\n# dio:budget size=80MB\n# dio:budget layers=3\n# dio:budget\n"
+	result, err := NewWithRules(&BudgetRule{}).AnalyzeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&models.SizeBudget{Size: "80MB", Line: 3}); !reflect.DeepEqual(result.Budget, want) {
+		t.Errorf("expected the first valid budget %+v, got %+v", want, result.Budget)
+	}
+	var lines []int
+	for _, issue := range result.Issues {
+		lines = append(lines, issue.Line)
+	}
+	// One issue for the invalid budget, one for each after the valid one
+	if want := []int{2, 4, 5}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("expected DIO046 on lines %v, got %v", want, lines)
+	}
+}
+
+func TestAnalyze_FingerprintsIgnoreInvocationPath(t *testing.T) {
+	content := []byte("FROM ubuntu:22.04\nRUN apt-get update && apt-get install -y curl\n")
+	fingerprint := func(path string) string {
+		result, err := NewWithRules(DefaultRules()...).Analyze(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, issue := range result.Issues {
+			if issue.ID == "DIO004" {
+				return issue.Fingerprint
+			}
+		}
+		t.Fatalf("expected DIO004 for %s", path)
+		return ""
+	}
+
+	repo := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(repo, "services", "api"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(repo, "services", "api", "Dockerfile")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil {
+		t.Skip(err)
+	}
+	abs := fingerprint(path)
+	if got := fingerprint(rel); got != abs {
+		t.Errorf("expected the same fingerprint for %s and %s: %q vs %q", rel, path, got, abs)
+	}
+	if got := fingerprint(filepath.Join(repo, "services", ".", "api", "..", "api", "Dockerfile")); got != abs {
+		t.Errorf("expected an unclean path to keep the fingerprint, got %q vs %q", got, abs)
+	}
+	if got := fingerprintPath(path); got != "services/api/Dockerfile" {
+		t.Errorf("expected the path relative to the repository root, got %q", got)
+	}
+
+	// Outside a repository, the same Dockerfile in two checkouts matches
+	other := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(other, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if repoRoot(filepath.Dir(other)) == "" {
+		copied := filepath.Join(t.TempDir(), "Dockerfile")
+		if err := os.WriteFile(copied, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if fingerprint(other) != fingerprint(copied) {
+			t.Error("expected Dockerfiles outside a repository to be fingerprinted by name")
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+var updateVerbs = map[string][]string{ManagerApt: {"update"}}
+
+// AptSplit is an apt-get install that installs from the package lists an
+// earlier RUN downloaded, rather than running apt-get update itself.
+type AptSplit struct {
+	Stage   int
+	Install Instruction
+	// Update is the last RUN before the install that ran apt-get update.
+	Update Instruction
+	// UpdateOnly is set when Update runs nothing but apt-get update.
+	UpdateOnly bool
+}
+
+// AptSplits returns the apt-get installs split from their apt-get update.
+// Installs with a cache mount on the package lists are left out: the lists
+// come from the mount, not from a layer.
+func (p *ParsedDockerfile) AptSplits() []AptSplit {
+	var splits []AptSplit
+	updates := make([]*Instruction, len(p.Stages))
+	for i, stage := range p.Stages {
+		var update *Instruction
+		if parent := p.resolveStageRef(i, stage.BaseImage); parent >= 0 {
+			update = updates[parent]
+		}
+		for j, inst := range stage.Instructions {
+			if inst.Command != "RUN" {
+				continue
+			}
+			if runsAptUpdate(inst.Args) {
+				update = &stage.Instructions[j]
+				continue
+			}
+			if update == nil || !installsAptPackages(inst.Args) || cacheMounted(inst, "/var/lib/apt/lists") {
+				continue
+			}
+			splits = append(splits, AptSplit{Stage: i, Install: inst, Update: *update, UpdateOnly: isAptUpdateOnly(update.Args)})
+		}
+		updates[i] = update
+	}
+	return splits
+}
+
+// runsAptUpdate reports whether a RUN script runs apt-get update.
+func runsAptUpdate(run string) bool {
+	for _, cmd := range shellSeparatorRegex.Split(run, -1) {
+		if manager, _ := packageCommand(cmd, updateVerbs); manager == ManagerApt {
+			return true
+		}
+	}
+	return false
+}
+
+// installsAptPackages reports whether a RUN script installs apt packages.
+func installsAptPackages(run string) bool {
+	for _, install := range PackageInstalls(run) {
+		if install.Manager == ManagerApt {
+			return true
+		}
+	}
+	return false
+}
+
+// isAptUpdateOnly reports whether a RUN script only runs apt-get update.
+func isAptUpdateOnly(run string) bool {
+	updates := 0
+	for _, cmd := range shellSeparatorRegex.Split(run, -1) {
+		if strings.TrimSpace(cmd) == "" {
+			continue
+		}
+		if manager, _ := packageCommand(cmd, updateVerbs); manager != ManagerApt {
+			return false
+		}
+		updates++
+	}
+	return updates > 0
+}
+
+// --- AptUpdateRule ---
+
+type AptUpdateRule struct{}
+
+func (r *AptUpdateRule) ID() string { return "DIO040" }
+
+func (r *AptUpdateRule) Check(ctx *AnalysisContext) []models.Issue {
+	var issues []models.Issue
+	for _, split := range ctx.ParsedFile.AptSplits() {
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityMedium,
+			Category:    "best-practice",
+			Title:       "apt-get install split from its apt-get update",
+			Description: fmt.Sprintf("The install uses the package lists downloaded by the apt-get update on line %d, which are cached with that layer. Rebuilds keep installing from them whatever their age, and fail with 404s once the mirrors have moved on.", split.Update.Line),
+			Line:        split.Install.Line,
+			Suggestion:  "Run apt-get update in the same RUN as the install, and remove the lists after it: apt-get update && apt-get install -y --no-install-recommends ... && rm -rf /var/lib/apt/lists/*",
+			AutoFixable: !isExecForm(split.Install.Args),
+		})
+	}
+	return issues
+}
@@ -0,0 +1,71 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// argRefRegex matches $VAR, ${VAR}, ${VAR:-default} and ${VAR:+alternative}.
+var argRefRegex = regexp.MustCompile(`\$\{(\w+)(?::?([-+])([^}]*))?\}|\$(\w+)`)
+
+// GlobalArgs returns the values of the ARGs declared before the first FROM,
+// which are the only ones FROM can reference. Values passed with --build-arg
+// override the declared defaults; build args for undeclared ARGs are ignored,
+// as docker does.
+func GlobalArgs(lines []string, buildArgs map[string]string) map[string]string {
+	args := make(map[string]string)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FROM":
+			return args
+		case "ARG":
+			name, value, hasDefault := strings.Cut(fields[1], "=")
+			if v, ok := buildArgs[name]; ok {
+				args[name] = v
+			} else if hasDefault {
+				args[name] = strings.Trim(value, `"'`)
+			}
+		}
+	}
+	return args
+}
+
+// ExpandArgs substitutes ARG references in s. References to unknown ARGs are
+// left in place so callers can tell the value couldn't be resolved.
+func ExpandArgs(s string, args map[string]string) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	return argRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		m := argRefRegex.FindStringSubmatch(ref)
+		name := m[1]
+		if name == "" {
+			name = m[4]
+		}
+		value, ok := args[name]
+		switch m[2] {
+		case "-":
+			if !ok || value == "" {
+				return m[3]
+			}
+		case "+":
+			if ok && value != "" {
+				return m[3]
+			}
+			return ""
+		}
+		if !ok {
+			return ref
+		}
+		return value
+	})
+}
+
+// hasUnresolvedArgs reports whether an expanded value still references ARGs.
+func hasUnresolvedArgs(s string) bool {
+	return strings.Contains(s, "$")
+}
@@ -0,0 +1,252 @@
+package analyzer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// stageCopy is a COPY --from from stage From into stage To.
+type stageCopy struct {
+	From, To int
+	// Sources are absolute paths in the From stage: COPY --from resolves
+	// relative sources against its root, not the WORKDIR.
+	Sources []string
+	// dirs marks the sources written with a trailing slash.
+	dirs    []bool
+	Dest    string
+	IntoDir bool
+	Inst    Instruction
+}
+
+// landings returns where source i of the copy can end up in the To stage.
+// A directory's contents are copied into the destination, a file lands
+// inside it; without a trailing slash, a source may be either.
+func (c stageCopy) landings(i int) []string {
+	src := c.Sources[i]
+	if !c.IntoDir || c.dirs[i] || src == "/" || strings.ContainsAny(src, "*?[") {
+		return []string{c.Dest}
+	}
+	return []string{path.Join(c.Dest, path.Base(src)), c.Dest}
+}
+
+// stageCopies returns the COPY --from instructions between build stages, in
+// the stages up to the final one.
+func (p *ParsedDockerfile) stageCopies() []stageCopy {
+	var copies []stageCopy
+	for i := 0; i <= p.FinalStage(); i++ {
+		// The WORKDIR is inherited from the stage this one is built on
+		chain := p.StageChain(i)
+		walkWorkdir(chain, func(inst Instruction, workdir string) {
+			if inst.Line < p.Stages[i].StartLine {
+				return
+			}
+			from := copyFromFlag(inst)
+			if from == "" {
+				return
+			}
+			src := p.resolveStageRef(i, ExpandArgs(from, p.Args))
+			if src < 0 {
+				return
+			}
+			sources, dest, intoDir, ok := copyPaths(inst, workdir)
+			if !ok {
+				return
+			}
+			c := stageCopy{From: src, To: i, Dest: path.Clean(dest), IntoDir: intoDir, Inst: inst}
+			for _, s := range sources {
+				c.Sources = append(c.Sources, path.Join("/", s))
+				c.dirs = append(c.dirs, strings.HasSuffix(s, "/"))
+			}
+			copies = append(copies, c)
+		})
+	}
+	return copies
+}
+
+// pathsOverlap reports whether one path is inside the other. A pattern is
+// taken as the directory before its first wildcard.
+func pathsOverlap(a, b string) bool {
+	a, b = globDir(a), globDir(b)
+	return isUnder(a, b) || isUnder(b, a)
+}
+
+func globDir(p string) string {
+	if i := strings.IndexAny(p, "*?["); i >= 0 {
+		return path.Dir(p[:i] + "x")
+	}
+	return p
+}
+
+func isUnder(p, dir string) bool {
+	return dir == "/" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// artifactTracer works out which paths of which stages end up in the final
+// image.
+type artifactTracer struct {
+	pdf    *ParsedDockerfile
+	copies []stageCopy
+	final  map[int]bool // the final stage and the stages it is built on
+	memo   map[string]bool
+}
+
+func newArtifactTracer(p *ParsedDockerfile) *artifactTracer {
+	t := &artifactTracer{pdf: p, copies: p.stageCopies(), final: make(map[int]bool), memo: make(map[string]bool)}
+	for i := p.FinalStage(); i >= 0 && !t.final[i]; i = p.resolveStageRef(i, p.Stages[i].BaseImage) {
+		t.final[i] = true
+	}
+	return t
+}
+
+// reaches reports whether the file or directory at p in stage idx is in the
+// final image: the stage is the final one or one it is built on, a stage
+// built on it carries it there, or a COPY --from takes it there.
+func (t *artifactTracer) reaches(idx int, p string) bool {
+	if t.final[idx] {
+		return true
+	}
+	key := fmt.Sprintf("%d:%s", idx, p)
+	if v, ok := t.memo[key]; ok {
+		return v
+	}
+	t.memo[key] = false
+	result := false
+	for i := idx + 1; i <= t.pdf.FinalStage() && !result; i++ {
+		if t.pdf.resolveStageRef(i, t.pdf.Stages[i].BaseImage) == idx {
+			result = t.reaches(i, p)
+		}
+	}
+	for _, c := range t.copies {
+		if result {
+			break
+		}
+		if c.From != idx {
+			continue
+		}
+		for i, src := range c.Sources {
+			if !pathsOverlap(src, p) {
+				continue
+			}
+			for _, dest := range c.landings(i) {
+				if rel := strings.TrimPrefix(p, globDir(src)); isUnder(p, globDir(src)) && rel != p {
+					dest = path.Join(dest, rel)
+				}
+				if t.reaches(c.To, dest) {
+					result = true
+					break
+				}
+			}
+			if result {
+				break
+			}
+		}
+	}
+	t.memo[key] = result
+	return result
+}
+
+// reachesFinal reports whether anything a copy brings in is in the final
+// image.
+func (t *artifactTracer) reachesFinal(c stageCopy) bool {
+	for i := range c.Sources {
+		for _, dest := range c.landings(i) {
+			if t.reaches(c.To, dest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Artifacts returns the COPY --from copies between build stages and whether
+// each reaches the final image, so a copy into a stage whose output is never
+// taken on shows up as unused.
+func (p *ParsedDockerfile) Artifacts() []models.StageArtifact {
+	t := newArtifactTracer(p)
+	var artifacts []models.StageArtifact
+	for _, c := range t.copies {
+		artifacts = append(artifacts, models.StageArtifact{
+			From:         p.Stages[c.From].Label(c.From),
+			To:           p.Stages[c.To].Label(c.To),
+			Sources:      c.Sources,
+			Dest:         c.Dest,
+			Line:         c.Inst.Line,
+			ReachesFinal: t.reachesFinal(c),
+		})
+	}
+	return artifacts
+}
+
+// buildOutputRegex matches the output path of a build command, such as
+// go build -o or tsc --outDir.
+var buildOutputRegex = regexp.MustCompile(`\s(?:-o|--output|--out-dir|--outDir|--outdir)[= ]+["']?([^\s"';&|]+)`)
+
+// buildOutputs returns the paths that build commands in the stage at idx
+// write their output to.
+func (p *ParsedDockerfile) buildOutputs(idx int) []string {
+	var outputs []string
+	seen := make(map[string]bool)
+	walkWorkdir(p.StageChain(idx), func(inst Instruction, workdir string) {
+		if inst.Command != "RUN" || !strings.Contains(inst.Args, "build") {
+			return
+		}
+		for _, m := range buildOutputRegex.FindAllStringSubmatch(inst.Args, -1) {
+			out := m[1]
+			if !path.IsAbs(out) {
+				out = path.Join(workdir, out)
+			}
+			if !seen[out] && !strings.Contains(out, "$") {
+				seen[out] = true
+				outputs = append(outputs, out)
+			}
+		}
+	})
+	return outputs
+}
+
+// --- WholeStageCopyRule ---
+
+type WholeStageCopyRule struct{}
+
+func (r *WholeStageCopyRule) ID() string { return "DIO024" }
+
+func (r *WholeStageCopyRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	t := newArtifactTracer(pdf)
+	var issues []models.Issue
+	for _, c := range t.copies {
+		whole := false
+		for _, src := range c.Sources {
+			whole = whole || src == "/"
+		}
+		if !whole {
+			continue
+		}
+		from := pdf.Stages[c.From].Label(c.From)
+		issue := models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityMedium,
+			Category:    "optimization",
+			Title:       "COPY --from copies a whole stage filesystem",
+			Description: fmt.Sprintf("COPY --from=%s / copies everything in stage %s, including its base image, compilers, package caches and sources, so the point of a separate build stage is lost.", copyFromFlag(c.Inst), from),
+			Line:        c.Inst.Line,
+			Suggestion:  fmt.Sprintf("Copy only the build outputs from stage %s, such as the binary or the dist directory.", from),
+		}
+		if !t.reachesFinal(c) {
+			issue.Severity = models.SeverityLow
+		}
+		if outputs := pdf.buildOutputs(c.From); len(outputs) > 0 {
+			copies := make([]string, len(outputs))
+			for i, out := range outputs {
+				copies[i] = fmt.Sprintf("COPY --from=%s %s %s", copyFromFlag(c.Inst), out, path.Join(c.Dest, out))
+			}
+			issue.Suggestion = "Copy only the build outputs: " + strings.Join(copies, "; ")
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
@@ -0,0 +1,345 @@
+package analyzer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Languages of compiled binaries.
+const (
+	LanguageGo   = "go"
+	LanguageRust = "rust"
+)
+
+// libc is the C library a binary is linked against or an image provides.
+type libc int
+
+const (
+	libcUnknown libc = iota
+	libcNone         // scratch, distroless/static: no C library or loader
+	libcMusl         // alpine
+	libcGlibc        // debian, ubuntu, distroless/base and cc, ...
+)
+
+func (l libc) String() string {
+	switch l {
+	case libcMusl:
+		return "musl"
+	case libcGlibc:
+		return "glibc"
+	}
+	return "no C library"
+}
+
+var (
+	// staticBaseHints identify runtime images without a C library.
+	staticBaseHints = []string{"distroless/static", "chainguard/static"}
+	// glibcBaseHints identify glibc-based runtime images. Official
+	// language images without -alpine are Debian based.
+	glibcBaseHints = []string{
+		"distroless/base", "distroless/cc", "chainguard/glibc-dynamic", "wolfi",
+		"debian", "ubuntu", "bookworm", "bullseye", "jammy", "noble", "focal",
+		"ubi8", "ubi9", "fedora", "centos", "rockylinux", "almalinux", "amazonlinux", "oraclelinux",
+		"golang", "rust", "python", "node", "openjdk", "eclipse-temurin", "ruby",
+	}
+)
+
+// imageLibc returns the C library an image provides, or libcUnknown.
+func imageLibc(image string) libc {
+	image = strings.ToLower(image)
+	switch {
+	case image == "scratch":
+		return libcNone
+	case containsAnyOf(image, staticBaseHints):
+		return libcNone
+	case strings.Contains(image, "alpine"):
+		return libcMusl
+	case containsAnyOf(image, glibcBaseHints):
+		return libcGlibc
+	}
+	return libcUnknown
+}
+
+func containsAnyOf(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	goBuildRegex      = regexp.MustCompile(`\bgo\s+(build|install)\b`)
+	cargoBuildRegex   = regexp.MustCompile(`\bcargo\s+(build|install)\b`)
+	cgoDisabledRegex  = regexp.MustCompile(`\bCGO_ENABLED(\s*=\s*|\s+)["']?0\b`)
+	cgoEnabledRegex   = regexp.MustCompile(`\bCGO_ENABLED(\s*=\s*|\s+)["']?1\b`)
+	goStaticFlagRegex = regexp.MustCompile(`\bnetgo\b|-extldflags[= ]+["']?[^"']*-static\b`)
+	cCompilerRegex    = regexp.MustCompile(`\b(gcc|build-base|musl-dev|clang)\b`)
+	rustStaticRegex   = regexp.MustCompile(`-linux-musl\b|\bcrt-static\b`)
+)
+
+// buildStage describes a stage that compiles Go or Rust code.
+type buildStage struct {
+	name     string
+	language string
+	static   bool
+	libc     libc // the C library a dynamic binary links against
+}
+
+// compiledStage reports what the stage at idx compiles, including settings
+// inherited via FROM <stage>. It returns nil for stages that don't build Go
+// or Rust code.
+func compiledStage(pdf *ParsedDockerfile, idx int) *buildStage {
+	chain := pdf.StageChain(idx)
+	if len(chain) == 0 {
+		return nil
+	}
+	base := strings.ToLower(chain[len(chain)-1].BaseImage)
+	var settings strings.Builder
+	goBuild, cargoBuild := false, false
+	for _, stage := range chain {
+		for _, inst := range stage.Instructions {
+			switch inst.Command {
+			case "RUN":
+				goBuild = goBuild || goBuildRegex.MatchString(inst.Args)
+				cargoBuild = cargoBuild || cargoBuildRegex.MatchString(inst.Args)
+			case "ENV", "ARG":
+			default:
+				continue
+			}
+			settings.WriteString(inst.Args + "\n")
+		}
+	}
+
+	b := &buildStage{name: chain[0].Name, libc: libcGlibc}
+	if b.name == "" {
+		b.name = strconv.Itoa(idx)
+	}
+	alpine := strings.Contains(base, "alpine")
+	if alpine {
+		b.libc = libcMusl
+	}
+	s := settings.String()
+	switch {
+	case goBuild || (strings.Contains(base, "golang") && !cargoBuild):
+		b.language = LanguageGo
+		// Without a C compiler, which golang:alpine doesn't have, the go
+		// command turns cgo off by itself
+		noCompiler := alpine && !cCompilerRegex.MatchString(s)
+		b.static = !cgoEnabledRegex.MatchString(s) &&
+			(cgoDisabledRegex.MatchString(s) || goStaticFlagRegex.MatchString(s) || noCompiler)
+	case cargoBuild || strings.Contains(base, "rust"):
+		b.language = LanguageRust
+		// musl targets, the default on rust:alpine, link statically
+		b.static = alpine || rustStaticRegex.MatchString(s)
+	default:
+		return nil
+	}
+	return b
+}
+
+// runtimeBase returns the external image the final stage is built on.
+func (p *ParsedDockerfile) runtimeBase() string {
+	chain := p.StageChain(p.FinalStage())
+	if len(chain) == 0 {
+		return ""
+	}
+	return chain[len(chain)-1].BaseImage
+}
+
+// copyFromStage resolves a COPY --from value to a stage index, or -1 for
+// external images.
+func copyFromStage(pdf *ParsedDockerfile, ref string) int {
+	if n, err := strconv.Atoi(ref); err == nil && n >= 0 && n < len(pdf.Stages) {
+		return n
+	}
+	return pdf.StageIndex(ref)
+}
+
+// CompiledBinaries returns the binaries that COPY --from instructions in
+// the final stage bring in from Go and Rust build stages. Sources with a
+// file extension or a trailing slash are taken to be data or directories,
+// not binaries.
+func (p *ParsedDockerfile) CompiledBinaries() []models.CompiledBinary {
+	final := p.FinalStage()
+	if final < 0 {
+		return nil
+	}
+	var binaries []models.CompiledBinary
+	walkWorkdir(p.StageChain(final), func(inst Instruction, workdir string) {
+		if inst.Command != "COPY" {
+			return
+		}
+		from := copyFromFlag(inst)
+		idx := copyFromStage(p, from)
+		if from == "" || idx < 0 {
+			return
+		}
+		build := compiledStage(p, idx)
+		if build == nil {
+			return
+		}
+		sources, dest, intoDir, ok := copyPaths(inst, workdir)
+		if !ok {
+			return
+		}
+		for _, src := range sources {
+			if strings.HasSuffix(src, "/") || strings.ContainsAny(src, "*?[") || path.Ext(src) != "" {
+				continue
+			}
+			target := dest
+			if intoDir {
+				target = path.Join(dest, path.Base(src))
+			}
+			binaries = append(binaries, models.CompiledBinary{
+				Path:     path.Clean(target),
+				Source:   src,
+				Stage:    build.name,
+				Language: build.language,
+				Line:     inst.Line,
+				Static:   build.static,
+			})
+		}
+	})
+	return binaries
+}
+
+// walkWorkdir calls fn for the instructions of a stage chain, as returned
+// by StageChain, from the first stage built, with the WORKDIR in effect.
+func walkWorkdir(chain []Stage, fn func(inst Instruction, workdir string)) {
+	workdir := "/"
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, inst := range chain[i].Instructions {
+			if inst.Command == "WORKDIR" {
+				if dir := strings.TrimSpace(inst.Args); path.IsAbs(dir) {
+					workdir = path.Clean(dir)
+				} else {
+					workdir = path.Join(workdir, dir)
+				}
+			}
+			fn(inst, workdir)
+		}
+	}
+}
+
+// copyPaths splits the arguments of a COPY or ADD into its sources and its
+// destination, made absolute against workdir. intoDir reports whether the
+// sources land inside the destination directory. ok is false for the JSON
+// form and for instructions without a source.
+func copyPaths(inst Instruction, workdir string) (sources []string, dest string, intoDir, ok bool) {
+	var paths []string
+	for _, f := range strings.Fields(inst.Args) {
+		if !strings.HasPrefix(f, "--") {
+			paths = append(paths, f)
+		}
+	}
+	if len(paths) < 2 || strings.HasPrefix(paths[0], "[") {
+		return nil, "", false, false
+	}
+	sources, dest = paths[:len(paths)-1], paths[len(paths)-1]
+	intoDir = strings.HasSuffix(dest, "/") || dest == "." || len(sources) > 1
+	if !path.IsAbs(dest) {
+		dest = path.Join(workdir, dest)
+	}
+	return sources, dest, intoDir, true
+}
+
+// --- StaticBinaryRule ---
+
+type StaticBinaryRule struct{}
+
+func (r *StaticBinaryRule) ID() string { return "DIO014" }
+
+func (r *StaticBinaryRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *StaticBinaryRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	final := pdf.FinalStage()
+	if final < 1 {
+		return nil
+	}
+	base := pdf.runtimeBase()
+	runtime := imageLibc(base)
+	if runtime == libcUnknown {
+		return nil
+	}
+
+	var issues []models.Issue
+	seen := make(map[int]bool)
+	for _, stage := range pdf.StageChain(final) {
+		for _, inst := range stage.Instructions {
+			idx := copyFromStage(pdf, copyFromFlag(inst))
+			if idx < 0 || seen[idx] {
+				continue
+			}
+			seen[idx] = true
+			build := compiledStage(pdf, idx)
+			if build == nil {
+				continue
+			}
+			if issue := r.check(build, base, runtime); issue != nil {
+				issue.Line = inst.Line
+				issues = append(issues, *issue)
+			}
+		}
+	}
+	return issues
+}
+
+// check compares how a build stage links with what the runtime base
+// provides.
+func (r *StaticBinaryRule) check(build *buildStage, base string, runtime libc) *models.Issue {
+	lang := "Go"
+	fix := "Build with CGO_ENABLED=0 (or -tags netgo,osusergo) to get a static binary"
+	if build.language == LanguageRust {
+		lang = "Rust"
+		fix = "Build for x86_64-unknown-linux-musl (or with RUSTFLAGS=\"-C target-feature=+crt-static\") to get a static binary"
+	}
+	issue := &models.Issue{
+		ID:       r.ID(),
+		Severity: models.SeverityHigh,
+		Category: "base-image",
+		Title:    "Binary linking doesn't match the runtime base image",
+	}
+
+	switch {
+	case build.static && runtime == libcGlibc && strings.Contains(strings.ToLower(base), "distroless/"):
+		issue.Severity = models.SeverityLow
+		issue.Category = "optimization"
+		issue.Title = "Static binary on a larger runtime base than needed"
+		issue.Description = fmt.Sprintf("The %s binary from stage %s is statically linked, but %s ships a C library it doesn't use.", lang, build.name, base)
+		issue.Suggestion = "Use gcr.io/distroless/static-debian12, which keeps CA certificates, tzdata and /etc/passwd."
+	case build.static:
+		return nil
+	case runtime == libcNone:
+		issue.Description = fmt.Sprintf("The %s binary from stage %s is likely dynamically linked against %s, but %s has no C library or dynamic loader: it fails to start with \"no such file or directory\".", lang, build.name, build.libc, base)
+		alt := "gcr.io/distroless/base-debian12"
+		if build.language == LanguageRust {
+			alt = "gcr.io/distroless/cc-debian12"
+		}
+		if build.libc == libcMusl {
+			alt = "alpine"
+		}
+		issue.Suggestion = fmt.Sprintf("%s, or run it on %s.", fix, alt)
+	case runtime != build.libc:
+		issue.Description = fmt.Sprintf("The %s binary from stage %s is likely dynamically linked against %s, but %s provides %s: the loader it needs is missing.", lang, build.name, build.libc, base, runtime)
+		alt := "build on an -alpine image"
+		if build.libc == libcMusl {
+			alt = "build on a Debian based image"
+		}
+		issue.Suggestion = fmt.Sprintf("%s, or %s so it links against %s.", fix, alt, runtime)
+	case build.language == LanguageRust && strings.Contains(strings.ToLower(base), "distroless/base"):
+		issue.Severity = models.SeverityMedium
+		issue.Description = fmt.Sprintf("The Rust binary from stage %s links against libgcc_s, which %s doesn't include.", build.name, base)
+		issue.Suggestion = "Use gcr.io/distroless/cc-debian12, the distroless variant for Rust and C++."
+	default:
+		return nil
+	}
+	return issue
+}
@@ -0,0 +1,103 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// budgetRegex matches a budget comment, "# dio:budget size=150MB layers=12".
+var budgetRegex = regexp.MustCompile(`^#\s*dio:budget(?:\s+(.*))?$`)
+
+// budgetProblem is what is wrong with a budget comment.
+type budgetProblem struct {
+	line    int
+	message string
+}
+
+// ParseBudget returns the size budget a Dockerfile declares in a
+// "# dio:budget size=150MB layers=12" comment, which the policy enforces
+// for the image built from it, or nil. Only the first budget comment
+// counts.
+func ParseBudget(lines []string) *models.SizeBudget {
+	budget, _ := parseBudget(lines)
+	return budget
+}
+
+// parseBudget returns the budget a Dockerfile declares and what is wrong
+// with its budget comments. A budget with an invalid option is dropped.
+func parseBudget(lines []string) (*models.SizeBudget, []budgetProblem) {
+	var (
+		budget   *models.SizeBudget
+		problems []budgetProblem
+	)
+	for i, line := range lines {
+		m := budgetRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		if budget != nil {
+			problems = append(problems, budgetProblem{line: i + 1, message: fmt.Sprintf("the Dockerfile already declares a budget on line %d", budget.Line)})
+			continue
+		}
+		b := &models.SizeBudget{Line: i + 1}
+		var messages []string
+		for _, opt := range strings.Fields(m[1]) {
+			key, value, _ := strings.Cut(opt, "=")
+			switch key {
+			case "size":
+				// A size without a unit is almost certainly not meant in bytes
+				if _, err := docker.ParseImageSize(value); err != nil || !strings.HasSuffix(strings.ToUpper(value), "B") {
+					messages = append(messages, fmt.Sprintf("size must be a size like 150MB, not %q", value))
+				}
+				b.Size = value
+			case "layers":
+				n, err := strconv.Atoi(value)
+				if err != nil || n <= 0 {
+					messages = append(messages, fmt.Sprintf("layers must be a positive number, not %q", value))
+				}
+				b.Layers = n
+			default:
+				messages = append(messages, fmt.Sprintf("unknown option %q (use size= and layers=)", opt))
+			}
+		}
+		if len(messages) == 0 && b.Size == "" && b.Layers == 0 {
+			messages = append(messages, "it sets neither size= nor layers=")
+		}
+		if len(messages) > 0 {
+			problems = append(problems, budgetProblem{line: i + 1, message: strings.Join(messages, "; ")})
+			continue
+		}
+		budget = b
+	}
+	return budget, problems
+}
+
+// --- BudgetRule ---
+
+type BudgetRule struct{}
+
+func (r *BudgetRule) ID() string { return "DIO046" }
+
+func (r *BudgetRule) Scope() RuleScope { return ScopeFile }
+
+func (r *BudgetRule) Check(ctx *AnalysisContext) []models.Issue {
+	_, problems := parseBudget(ctx.Lines)
+	var issues []models.Issue
+	for _, p := range problems {
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityMedium,
+			Category:    "best-practice",
+			Title:       "Invalid size budget",
+			Description: fmt.Sprintf("The dio:budget comment is ignored: %s. The policy doesn't enforce it.", p.message),
+			Line:        p.line,
+			Suggestion:  "Declare the budget once, as # dio:budget size=150MB layers=12.",
+		})
+	}
+	return issues
+}
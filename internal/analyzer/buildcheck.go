@@ -0,0 +1,217 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// buildCheckResult is the output of docker build --call=check,format=json.
+type buildCheckResult struct {
+	Warnings []struct {
+		RuleName    string             `json:"ruleName"`
+		Description string             `json:"description"`
+		URL         string             `json:"url"`
+		Detail      string             `json:"detail"`
+		Location    buildCheckLocation `json:"location"`
+	} `json:"warnings"`
+	// BuildError is set when the Dockerfile doesn't parse or its build
+	// can't be resolved.
+	BuildError *struct {
+		Message  string              `json:"message"`
+		Location *buildCheckLocation `json:"location"`
+	} `json:"buildError"`
+}
+
+// buildCheckLocation is where in the Dockerfile a build check fired.
+type buildCheckLocation struct {
+	Ranges []struct {
+		Start struct {
+			Line int `json:"line"`
+		} `json:"start"`
+	} `json:"ranges"`
+}
+
+// line returns the first line of the location, or 0.
+func (l *buildCheckLocation) line() int {
+	if l == nil || len(l.Ranges) == 0 {
+		return 0
+	}
+	return l.Ranges[0].Start.Line
+}
+
+// buildCheckSeverities are the DIO severities of the build checks. The
+// others are low.
+var buildCheckSeverities = map[string]models.Severity{
+	"SecretsUsedInArgOrEnv":          models.SeverityHigh,
+	"DuplicateStageName":             models.SeverityMedium,
+	"ReservedStageName":              models.SeverityMedium,
+	"UndefinedArgInFrom":             models.SeverityMedium,
+	"UndefinedVar":                   models.SeverityMedium,
+	"InvalidDefaultArgInFrom":        models.SeverityMedium,
+	"MultipleInstructionsDisallowed": models.SeverityMedium,
+	"CopyIgnoredFile":                models.SeverityMedium,
+	"InvalidBaseImagePlatform":       models.SeverityMedium,
+	"StageNameCasing":                models.SeverityInfo,
+	"FromAsCasing":                   models.SeverityInfo,
+	"ConsistentInstructionCasing":    models.SeverityInfo,
+}
+
+// buildCheckOverlaps maps build checks to the rules reporting the same
+// problem: native extended rules, hadolint codes (reported as HL-<code>)
+// and built-in rules.
+var buildCheckOverlaps = map[string][]string{
+	"JSONArgsRecommended":             {"DL3025"},
+	"MaintainerDeprecated":            {"DL4000"},
+	"WorkdirRelativePath":             {"DL3000"},
+	"DuplicateStageName":              {"DL3024"},
+	"MultipleInstructionsDisallowed":  {"DL4003", "DL4004", "DL3012"},
+	"FromPlatformFlagConstDisallowed": {"DL3029"},
+	"SecretsUsedInArgOrEnv":           {"DIO036"},
+}
+
+// runBuildCheck runs BuildKit's build checks on a Dockerfile with docker
+// build --call=check, in the directory of the Dockerfile, with the build
+// args and target the analyzer resolves FROM with.
+func runBuildCheck(dockerfilePath string, cfg config.BuildCheckConfig, buildArgs map[string]string, target string) ([]models.Issue, error) {
+	dockerPath, err := exec.LookPath("docker")
+	if err != nil {
+		return nil, fmt.Errorf("docker not found: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(dockerPath, buildCheckArgs(dockerfilePath, cfg, buildArgs, target)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// The check exits with an error when it finds problems, which is
+	// expected.
+	runErr := cmd.Run()
+	if stdout.Len() == 0 {
+		if runErr != nil {
+			return nil, fmt.Errorf("docker build --check failed: %w: %s", runErr, strings.TrimSpace(stderr.String()))
+		}
+		return nil, nil
+	}
+	return buildCheckIssues(stdout.Bytes())
+}
+
+// buildCheckArgs builds the docker build command line of the checks.
+func buildCheckArgs(dockerfilePath string, cfg config.BuildCheckConfig, buildArgs map[string]string, target string) []string {
+	args := []string{"build", "--call=check,format=json", "-f", dockerfilePath}
+	if len(cfg.Skip) > 0 {
+		args = append(args, "--build-arg", "BUILDKIT_DOCKERFILE_CHECK=skip="+strings.Join(cfg.Skip, ","))
+	}
+	keys := make([]string, 0, len(buildArgs))
+	for k := range buildArgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--build-arg", k+"="+buildArgs[k])
+	}
+	if target != "" {
+		args = append(args, "--target", target)
+	}
+	return append(args, filepath.Dir(dockerfilePath))
+}
+
+// buildCheckIssues converts the JSON output of the build checks into DIO
+// issues. A Dockerfile BuildKit can't parse is a high severity issue.
+func buildCheckIssues(output []byte) ([]models.Issue, error) {
+	var result buildCheckResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse docker build --check output: %w", err)
+	}
+	var issues []models.Issue
+	for _, w := range result.Warnings {
+		severity, ok := buildCheckSeverities[w.RuleName]
+		if !ok {
+			severity = models.SeverityLow
+		}
+		description := w.Detail
+		if description == "" {
+			description = w.Description
+		}
+		issues = append(issues, models.Issue{
+			ID:          "BK-" + w.RuleName,
+			Severity:    severity,
+			Category:    "buildkit",
+			Title:       w.RuleName + ": " + truncate(description, 80),
+			Description: description,
+			Line:        w.Location.line(),
+			DocsURL:     w.URL,
+		})
+	}
+	if e := result.BuildError; e != nil {
+		issues = append(issues, models.Issue{
+			ID:          "BK-BuildError",
+			Severity:    models.SeverityHigh,
+			Category:    "buildkit",
+			Title:       "BuildKit can't build the Dockerfile",
+			Description: e.Message,
+			Line:        e.Location.line(),
+		})
+	}
+	return issues, nil
+}
+
+// mergeBuildCheckIssues appends the build check findings, skipping those
+// an equivalent built-in, extended or hadolint rule reported on the same
+// line, and records why each was kept or dropped.
+func mergeBuildCheckIssues(issues, checkIssues []models.Issue) ([]models.Issue, []models.HadolintDecision) {
+	return mergeOverlappingIssues(issues, checkIssues, func(issue models.Issue) string {
+		return strings.TrimPrefix(issue.ID, "BK-")
+	}, buildCheckOverlaps, nil)
+}
+
+// mergeOverlappingIssues appends the findings of an external source,
+// skipping those one of the rules overlaps maps their code to reported on
+// the same line, or on any line for the codes of fileLevel and findings
+// without a line, and records why each was kept or dropped. Hadolint codes
+// match their HL-<code> issues.
+func mergeOverlappingIssues(issues, found []models.Issue, code func(models.Issue) string, overlaps map[string][]string, fileLevel map[string]bool) ([]models.Issue, []models.HadolintDecision) {
+	covered := make(map[int]map[string]bool)
+	anywhere := make(map[string]bool)
+	for _, issue := range issues {
+		id := strings.TrimPrefix(issue.ID, "HL-")
+		anywhere[id] = true
+		if issue.Line == 0 {
+			continue
+		}
+		if covered[issue.Line] == nil {
+			covered[issue.Line] = make(map[string]bool)
+		}
+		covered[issue.Line][id] = true
+	}
+
+	var decisions []models.HadolintDecision
+	for _, issue := range found {
+		c := code(issue)
+		decision := models.HadolintDecision{Code: c, Line: issue.Line, Kept: true, Reason: "no overlapping finding"}
+		for _, id := range overlaps[c] {
+			if covered[issue.Line][id] {
+				decision.Kept = false
+				decision.Reason = fmt.Sprintf("duplicate of %s on the same line", id)
+				break
+			}
+			if (issue.Line == 0 || fileLevel[c]) && anywhere[id] {
+				decision.Kept = false
+				decision.Reason = fmt.Sprintf("duplicate of %s", id)
+				break
+			}
+		}
+		decisions = append(decisions, decision)
+		if decision.Kept {
+			issues = append(issues, issue)
+		}
+	}
+	return issues, decisions
+}
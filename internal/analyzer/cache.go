@@ -0,0 +1,161 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// RulesetVersion identifies the behavior of the built-in rules. Bump it
+// whenever a rule changes what it reports so cached results are discarded.
+const RulesetVersion = "24"
+
+// Cache stores analysis results on disk, keyed by a hash of the Dockerfile
+// content and everything else that affects the result. Entries are never
+// invalidated, only replaced by new keys, so the directory can be shared by
+// concurrent runs and deleted at any time.
+type Cache struct {
+	Dir string
+}
+
+// DefaultCacheDir returns ~/.dio/cache.
+func DefaultCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("no home directory for the analysis cache: %w", err)
+	}
+	return filepath.Join(home, ".dio", "cache"), nil
+}
+
+// cacheInputs describes every input of an analysis. Its JSON encoding is
+// hashed into the cache key; encoding/json sorts map keys, so equal inputs
+// always produce the same key.
+type cacheInputs struct {
+	RulesetVersion string                            `json:"ruleset_version"`
+	Rules          []string                          `json:"rules"`
+	RuleOptions    map[string]map[string]interface{} `json:"rule_options,omitempty"`
+	BuildArgs      map[string]string                 `json:"build_args,omitempty"`
+	Target         string                            `json:"target,omitempty"`
+	Hadolint       *hadolintKey                      `json:"hadolint,omitempty"`
+	Shellcheck     *config.ShellcheckConfig          `json:"shellcheck,omitempty"`
+	BuildCheck     *config.BuildCheckConfig          `json:"build_check,omitempty"`
+	Trivy          *config.TrivyConfig               `json:"trivy,omitempty"`
+	Threshold      models.Severity                   `json:"threshold,omitempty"`
+	Image          config.ImageConfig                `json:"image"`
+	GoldenImages   []config.GoldenImage              `json:"golden_images,omitempty"`
+
+	Path                 string       `json:"path"`
+	ContentHash          string       `json:"content_hash"`
+	IgnoreFile           string       `json:"ignore_file,omitempty"`
+	MissingDockerignore  bool         `json:"missing_dockerignore"`
+	UncoveredContextDirs []ContextDir `json:"uncovered_context_dirs,omitempty"`
+	Updater              string       `json:"updater,omitempty"`
+}
+
+// hadolintKey captures the hadolint settings, including the contents of the
+// .hadolint.yaml passed to it, since editing that file changes the findings.
+type hadolintKey struct {
+	Config     config.HadolintConfig `json:"config"`
+	ConfigHash string                `json:"config_hash,omitempty"`
+}
+
+// cacheKey returns the cache key for analyzing ctx with a.
+func (a *Analyzer) cacheKey(ctx *AnalysisContext) (string, error) {
+	k := cacheInputs{
+		RulesetVersion:       RulesetVersion,
+		RuleOptions:          a.ruleOptions,
+		BuildArgs:            a.buildArgs,
+		Target:               a.target,
+		Threshold:            a.threshold,
+		Image:                a.image,
+		GoldenImages:         a.golden,
+		Path:                 ctx.FilePath,
+		ContentHash:          hashBytes([]byte(ctx.Content)),
+		IgnoreFile:           ctx.IgnoreFile,
+		MissingDockerignore:  ctx.MissingDockerignore,
+		UncoveredContextDirs: ctx.UncoveredContextDirs,
+		Updater:              ctx.Updater,
+	}
+	for _, rule := range a.rules {
+		k.Rules = append(k.Rules, rule.ID())
+	}
+	if a.useShellcheck {
+		k.Shellcheck = &a.shellcheck
+	}
+	if a.buildCheck.Enabled {
+		k.BuildCheck = &a.buildCheck
+	}
+	if a.trivy.Enabled {
+		k.Trivy = &a.trivy
+	}
+	if a.useHadolint {
+		k.Hadolint = &hadolintKey{Config: a.hadolint}
+		if path := hadolintConfigPath(ctx.FilePath, a.hadolint); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			k.Hadolint.ConfigHash = hashBytes(data)
+		}
+	}
+
+	data, err := json.Marshal(k)
+	if err != nil {
+		return "", err
+	}
+	return hashBytes(data), nil
+}
+
+// Load returns the cached result for key, or nil if there is none.
+func (c *Cache) Load(key string) *models.AnalysisResult {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil
+	}
+	var result models.AnalysisResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
+	}
+	return &result
+}
+
+// Store saves a result under key. The file is written to a temporary name
+// and renamed into place so concurrent readers never see a partial entry.
+func (c *Cache) Store(key string, result *models.AnalysisResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
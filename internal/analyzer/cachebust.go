@@ -0,0 +1,200 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Kinds of cache-busting patterns.
+const (
+	// CacheBustArg is an ARG declared to invalidate the cache, which
+	// invalidates every RUN after it rather than the one step meant to
+	// re-run.
+	CacheBustArg = "arg"
+	// CacheBustRemoteAdd is an ADD of a URL whose content changes, such as
+	// a latest release.
+	CacheBustRemoteAdd = "remote-add"
+	// CacheBustGitBranch is a clone of a branch, which stays cached at
+	// whatever commit the branch pointed to when it was first built.
+	CacheBustGitBranch = "git-branch"
+)
+
+var (
+	// cacheBustArgRegex matches the names of ARGs that exist to invalidate
+	// the cache.
+	cacheBustArgRegex = regexp.MustCompile(`(?i)^(?:cache_?bust(?:er)?|bust_?cache|no_?cache|cache_?(?:date|key|epoch))$`)
+	// mutableURLRegex matches URLs of artifacts that change behind the same
+	// name.
+	mutableURLRegex = regexp.MustCompile(`(?i)[/_.-](?:latest|nightly|snapshot|current|master|main|head|trunk)(?:[/_.-]|$)`)
+	// gitURLRegex matches a git repository URL ADD checks out, and
+	// captures its ref.
+	gitURLRegex = regexp.MustCompile(`^(?:git@[^:]+:\S+|(?:https?|git|ssh)://\S+?\.git)(?:#([^:]*))?(?::\S*)?$`)
+	// gitCloneRegex matches a git clone, and captures its options and
+	// arguments.
+	gitCloneRegex = regexp.MustCompile(`\bgit\s+clone\b([^&;|]*)`)
+	// gitPinRegex matches a checkout of a fixed commit or tag after a
+	// clone.
+	gitPinRegex = regexp.MustCompile(`\bgit\s+(?:checkout|reset\s+--hard|switch\s+--detach)\s+(?:-\S+\s+)*['"]?(\S+)`)
+	// pinnedRefRegex matches refs that don't move: commit hashes and
+	// version tags.
+	pinnedRefRegex = regexp.MustCompile(`^(?:[0-9a-f]{7,40}|v?\d+(?:\.\d+)*(?:[-+.]\w+)*|\$\{?\w+\}?)$`)
+)
+
+// CacheBust is an instruction that defeats the layer cache, by
+// invalidating more than it needs to or by keeping stale content.
+type CacheBust struct {
+	Kind        string
+	Stage       int
+	Instruction Instruction
+	// Detail is what the pattern is about: the ARG name, the URL, or the
+	// repository.
+	Detail string
+	// Use is the instruction that reads a cache-busting ARG, when one does.
+	Use *Instruction
+}
+
+// CacheBusts returns the cache-busting patterns of a Dockerfile.
+func (p *ParsedDockerfile) CacheBusts() []CacheBust {
+	var busts []CacheBust
+	for i, stage := range p.Stages {
+		for j, inst := range stage.Instructions {
+			switch inst.Command {
+			case "ARG":
+				for _, field := range strings.Fields(inst.Args) {
+					name, _, _ := strings.Cut(field, "=")
+					if !cacheBustArgRegex.MatchString(name) {
+						continue
+					}
+					if b, ok := cacheBustArg(i, stage.Instructions, j, name); ok {
+						busts = append(busts, b)
+					}
+				}
+			case "ADD":
+				for _, src := range copySources(inst.Args) {
+					if m := gitURLRegex.FindStringSubmatch(src); m != nil {
+						if !pinnedRefRegex.MatchString(m[1]) {
+							busts = append(busts, CacheBust{Kind: CacheBustGitBranch, Stage: i, Instruction: inst, Detail: src})
+						}
+						continue
+					}
+					if isRemoteURL(src) && mutableURLRegex.MatchString(src) && !strings.Contains(inst.Args, "--checksum=") {
+						busts = append(busts, CacheBust{Kind: CacheBustRemoteAdd, Stage: i, Instruction: inst, Detail: src})
+					}
+				}
+			case "RUN":
+				if repo := unpinnedClone(inst.Args); repo != "" {
+					busts = append(busts, CacheBust{Kind: CacheBustGitBranch, Stage: i, Instruction: inst, Detail: repo})
+				}
+			}
+		}
+	}
+	return busts
+}
+
+// cacheBustArg reports a cache-busting ARG declared at insts[j] when it
+// invalidates a RUN that doesn't read it: every RUN after an ARG misses
+// the cache when its value changes.
+func cacheBustArg(stage int, insts []Instruction, j int, name string) (CacheBust, bool) {
+	b := CacheBust{Kind: CacheBustArg, Stage: stage, Instruction: insts[j], Detail: name}
+	ref := regexp.MustCompile(`\$\{?` + regexp.QuoteMeta(name) + `\b`)
+	busted := false
+	for k := j + 1; k < len(insts); k++ {
+		inst := insts[k]
+		if ref.MatchString(inst.Args) {
+			b.Use = &insts[k]
+			break
+		}
+		if inst.Command == "RUN" {
+			busted = true
+		}
+	}
+	return b, busted
+}
+
+// isRemoteURL reports whether an ADD source is downloaded.
+func isRemoteURL(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// unpinnedClone returns the repository a RUN clones when it checks out a
+// branch rather than a tag or commit.
+func unpinnedClone(run string) string {
+	m := gitCloneRegex.FindStringSubmatch(run)
+	if m == nil {
+		return ""
+	}
+	if pin := gitPinRegex.FindStringSubmatch(run); pin != nil && pinnedRefRegex.MatchString(strings.Trim(pin[1], `'"`)) {
+		return ""
+	}
+	fields := strings.Fields(m[1])
+	repo := ""
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		switch {
+		case f == "--branch" || f == "-b":
+			if i+1 < len(fields) {
+				i++
+				if pinnedRefRegex.MatchString(strings.Trim(fields[i], `'"`)) {
+					return ""
+				}
+			}
+		case strings.HasPrefix(f, "--branch="):
+			if pinnedRefRegex.MatchString(strings.Trim(strings.TrimPrefix(f, "--branch="), `'"`)) {
+				return ""
+			}
+		case f == "--depth" || f == "-c" || f == "--config" || f == "-o" || f == "--origin":
+			i++
+		case strings.HasPrefix(f, "-"):
+		case repo == "":
+			repo = strings.Trim(f, `'"`)
+		}
+	}
+	return repo
+}
+
+// --- CacheBustRule ---
+
+type CacheBustRule struct{}
+
+func (r *CacheBustRule) ID() string { return "DIO039" }
+
+func (r *CacheBustRule) Check(ctx *AnalysisContext) []models.Issue {
+	var issues []models.Issue
+	for _, b := range ctx.ParsedFile.CacheBusts() {
+		issue := models.Issue{
+			ID:       r.ID(),
+			Severity: models.SeverityLow,
+			Category: "optimization",
+			Line:     b.Instruction.Line,
+		}
+		switch b.Kind {
+		case CacheBustArg:
+			issue.Title = fmt.Sprintf("ARG %s invalidates every RUN after it", b.Detail)
+			issue.Description = fmt.Sprintf("When the value of an ARG changes, every RUN after its declaration misses the cache, not only the ones that read it. Passing a new %s on each build rebuilds all of them.", b.Detail)
+			if b.Use != nil {
+				issue.Suggestion = fmt.Sprintf("Declare ARG %s right before the instruction that reads it, on line %d, so only that step and the ones after it re-run.", b.Detail, b.Use.Line)
+				issue.AutoFixable = len(strings.Fields(b.Instruction.Args)) == 1
+			} else {
+				issue.Suggestion = fmt.Sprintf("Declare ARG %s right before the step that should re-run, or replace it with an ADD of what that step fetches, such as ADD https://github.com/org/repo.git#v1.2.3, so the cache follows the content.", b.Detail)
+			}
+		case CacheBustRemoteAdd:
+			issue.Title = "ADD of a URL that changes behind the same name"
+			issue.Description = fmt.Sprintf("%s points at whatever is current, so each build may download different content under the same instruction, and the layers after it miss or keep the cache by chance.", b.Detail)
+			issue.Suggestion = "ADD a versioned URL and verify it with --checksum=sha256:<digest> (docker/dockerfile 1.6), so a new release is an explicit change."
+		case CacheBustGitBranch:
+			issue.Category = "reproducibility"
+			issue.Title = "Clone of a branch that moves"
+			if b.Instruction.Command == "ADD" {
+				issue.Description = fmt.Sprintf("ADD checks out %s at whatever commit the branch points to, so the layers after it are rebuilt whenever the branch moves and the image differs from build to build.", b.Detail)
+			} else {
+				issue.Description = fmt.Sprintf("The RUN clones %s without a tag or commit. Its layer stays cached at the commit the branch pointed to when it was first built, so builds silently ship stale code until something else invalidates it, which is what cache-busting ARGs are then added for.", b.Detail)
+			}
+			issue.Suggestion = "Check out a tag or commit: git clone --depth 1 --branch v1.2.3, or ADD https://github.com/org/repo.git#v1.2.3, which BuildKit caches by commit."
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
@@ -0,0 +1,278 @@
+package analyzer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// ChownedCopy is a recursive chown or chmod of files a COPY or ADD put in
+// the image. Changing the owner or mode of a file writes all of it again in
+// the layer of the RUN, so the image stores the copied files twice.
+type ChownedCopy struct {
+	// Copies are the COPY and ADD instructions the command changes files of.
+	Copies []Instruction
+	Run    Instruction
+	// Command is chown or chmod, and Value the owner or mode it sets.
+	Command string
+	Value   string
+	// Target is the directory the command changes, made absolute.
+	Target string
+	// Fixable is set when the copies can set the owner or mode themselves
+	// and the RUN then only needs to change Target itself: the RUN runs
+	// nothing but the command, the copies are all into Target, and nothing
+	// else put files there before the RUN.
+	Fixable bool
+}
+
+// Flag returns the COPY flag that sets what the command sets.
+func (c ChownedCopy) Flag() string {
+	return "--" + c.Command + "=" + c.Value
+}
+
+// copyModeRegex matches the modes COPY --chmod accepts.
+var copyModeRegex = regexp.MustCompile(`^[0-7]{3,4}$`)
+
+// recursiveChange is a chown -R or chmod -R command of a RUN.
+type recursiveChange struct {
+	command, value string
+	targets        []string
+	// plain is set when the command has no other option than -R, -f and -v.
+	plain bool
+}
+
+// recursiveChanges returns the chown -R and chmod -R commands of a RUN
+// script.
+func recursiveChanges(run string) []recursiveChange {
+	var changes []recursiveChange
+	for _, cmd := range shellSeparatorRegex.Split(run, -1) {
+		fields := strings.Fields(cmd)
+		if len(fields) > 0 && fields[0] == "sudo" {
+			fields = fields[1:]
+		}
+		if len(fields) < 3 || (fields[0] != "chown" && fields[0] != "chmod") {
+			continue
+		}
+		change := recursiveChange{command: fields[0], plain: true}
+		recursive := false
+		for _, f := range fields[1:] {
+			switch {
+			case f == "--recursive":
+				recursive = true
+			case strings.HasPrefix(f, "--"):
+				change.plain = false
+			case strings.HasPrefix(f, "-") && change.value == "" && !(fields[0] == "chmod" && strings.ContainsAny(f, "+=")):
+				recursive = recursive || strings.Contains(f, "R")
+				if strings.Trim(f, "-Rfv") != "" {
+					change.plain = false
+				}
+			case change.value == "":
+				change.value = f
+			default:
+				change.targets = append(change.targets, f)
+			}
+		}
+		if recursive && len(change.targets) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// ChownedCopies returns the recursive chowns and chmods of copied files in
+// the stages of the final image.
+func (p *ParsedDockerfile) ChownedCopies() []ChownedCopy {
+	final := p.FinalStage()
+	if final < 0 || p.IsWindows() {
+		return nil
+	}
+	type copied struct {
+		inst Instruction
+		dest string
+	}
+	var (
+		copies  []copied
+		runs    []Instruction
+		changed []ChownedCopy
+	)
+	walkWorkdir(p.StageChain(final), func(inst Instruction, workdir string) {
+		switch inst.Command {
+		case "COPY", "ADD":
+			if _, dest, _, ok := copyPaths(inst, workdir); ok {
+				copies = append(copies, copied{inst: inst, dest: path.Clean(dest)})
+			}
+			return
+		case "RUN":
+			if !onlyChangesFiles(inst.Args) {
+				runs = append(runs, inst)
+			}
+		default:
+			return
+		}
+		changes := recursiveChanges(inst.Args)
+		for _, change := range changes {
+			for _, target := range change.targets {
+				if strings.ContainsAny(target, "$*?[`") {
+					continue
+				}
+				if !path.IsAbs(target) {
+					target = path.Join(workdir, target)
+				}
+				target = path.Clean(target)
+				c := ChownedCopy{Run: inst, Command: change.command, Value: change.value, Target: target}
+				fixable := change.plain && len(change.targets) == 1 && len(changes) == 1 &&
+					len(shellCommands(inst.Args)) == 1 && len(inst.Heredocs) == 0 &&
+					(change.command == "chown" || copyModeRegex.MatchString(change.value))
+				for _, cp := range copies {
+					if !isUnder(cp.dest, target) || hasFlag(cp.inst, "--"+change.command) {
+						continue
+					}
+					c.Copies = append(c.Copies, cp.inst)
+					if cp.dest != target || cp.inst.Command != "COPY" {
+						fixable = false
+					}
+				}
+				if len(c.Copies) == 0 {
+					continue
+				}
+				// Other RUNs may have put files in the target, which the
+				// command changes too
+				for _, run := range runs {
+					if run.Line > c.Copies[0].Line && run.Line < inst.Line || run.Line < inst.Line && strings.Contains(run.Args, target) {
+						fixable = false
+					}
+				}
+				c.Fixable = fixable
+				changed = append(changed, c)
+			}
+		}
+	})
+	return changed
+}
+
+// shellCommands returns the non-empty commands of a RUN script.
+func shellCommands(run string) []string {
+	var cmds []string
+	for _, cmd := range shellSeparatorRegex.Split(run, -1) {
+		if cmd = strings.TrimSpace(cmd); cmd != "" {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// onlyChangesFiles reports whether a RUN script runs nothing but chown and
+// chmod, which create no files.
+func onlyChangesFiles(run string) bool {
+	for _, cmd := range shellCommands(run) {
+		fields := strings.Fields(cmd)
+		if fields[0] == "sudo" && len(fields) > 1 {
+			fields = fields[1:]
+		}
+		if fields[0] != "chown" && fields[0] != "chmod" {
+			return false
+		}
+	}
+	return true
+}
+
+// hasFlag reports whether a COPY or ADD sets a flag, such as --chown.
+func hasFlag(inst Instruction, flag string) bool {
+	for _, f := range strings.Fields(inst.Args) {
+		if !strings.HasPrefix(f, "--") {
+			break
+		}
+		if f == flag || strings.HasPrefix(f, flag+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// historyShellRegex matches how an image history records the shell of a
+// RUN, after the build args it ran with, as in |1 VERSION=2 /bin/sh -c.
+var historyShellRegex = regexp.MustCompile(`^(?:RUN\s+)?(?:\|\d+(?:\s+[^\s=]+=\S*)*\s+)?/bin/(?:ba)?sh\s+-c\s+`)
+
+// InstructionLine returns the line of the instruction of the final image
+// an entry of the image history was created by, as docker history shows
+// it, or 0 when none matches. Identical instructions are credited to the
+// last one.
+func (p *ParsedDockerfile) InstructionLine(createdBy string) int {
+	command, text := ParseCreatedBy(createdBy)
+	if command == "" {
+		return 0
+	}
+	insts := p.finalInstructions()
+	for i := len(insts) - 1; i >= 0; i-- {
+		inst := insts[i]
+		if inst.Command != command {
+			continue
+		}
+		// BuildKit records the arguments as written, the classic builder
+		// with the build args expanded
+		args := strings.Join(strings.Fields(inst.Args), " ")
+		switch {
+		case text == args || text == ExpandArgs(args, p.Args):
+			return inst.Line
+		case command == "COPY" || command == "ADD":
+			// The classic builder records the checksum of the sources
+			// rather than the sources: COPY dir:4f3c… in /app
+			fields := nonFlagArgs(args)
+			if in := strings.LastIndex(text, " in "); in >= 0 && len(fields) > 1 &&
+				strings.TrimSuffix(text[in+len(" in "):], "/") == strings.TrimSuffix(fields[len(fields)-1], "/") {
+				return inst.Line
+			}
+			if strings.HasSuffix(text, " "+strings.Join(fields, " ")) {
+				return inst.Line
+			}
+		}
+	}
+	return 0
+}
+
+// ParseCreatedBy splits a created_by entry of an image history into the
+// instruction and its arguments, with runs of spaces collapsed.
+func ParseCreatedBy(createdBy string) (command, text string) {
+	s := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(createdBy), "# buildkit"))
+	s = strings.TrimPrefix(s, "/bin/sh -c #(nop) ")
+	if loc := historyShellRegex.FindStringIndex(s); loc != nil {
+		return "RUN", strings.Join(strings.Fields(s[loc[1]:]), " ")
+	}
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return "", ""
+	}
+	return strings.ToUpper(fields[0]), strings.Join(fields[1:], " ")
+}
+
+// --- ChownedCopyRule ---
+
+type ChownedCopyRule struct{}
+
+func (r *ChownedCopyRule) ID() string { return "DIO041" }
+
+func (r *ChownedCopyRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *ChownedCopyRule) Check(ctx *AnalysisContext) []models.Issue {
+	var issues []models.Issue
+	for _, c := range ctx.ParsedFile.ChownedCopies() {
+		what := "owner"
+		if c.Command == "chmod" {
+			what = "mode"
+		}
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityMedium,
+			Category:    "optimization",
+			Title:       fmt.Sprintf("%s -R of copied files stores them twice", c.Command),
+			Description: fmt.Sprintf("The %s -R of %s changes the %s of the files copied on line %d, which writes them all again in the layer of this RUN. The image ships both copies.", c.Command, c.Target, what, c.Copies[0].Line),
+			Line:        c.Run.Line,
+			Suggestion:  fmt.Sprintf("Set the %s while copying with %s %s, and only %s the directory itself if it needs it.", what, c.Copies[0].Command, c.Flag(), c.Command),
+			AutoFixable: c.Fixable,
+		})
+	}
+	return issues
+}
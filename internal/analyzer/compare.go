@@ -0,0 +1,32 @@
+package analyzer
+
+import "github.com/maxlar/docker-image-optimizer/internal/models"
+
+// Compare diffs the analysis of a Dockerfile with the analysis of its
+// autofixed version. Issues are matched by rule ID rather than by
+// fingerprint, since autofix rewrites the instructions fingerprints are
+// based on: an issue counts as resolved only when its rule no longer fires
+// anywhere.
+func Compare(before, after *models.AnalysisResult) *models.AnalysisDiff {
+	return &models.AnalysisDiff{
+		ScoreBefore:    before.Score,
+		ScoreAfter:     after.Score,
+		ResolvedIssues: issuesWithout(before.Issues, after.Issues),
+		NewIssues:      issuesWithout(after.Issues, before.Issues),
+	}
+}
+
+// issuesWithout returns the issues of a whose rule has no issue in b.
+func issuesWithout(a, b []models.Issue) []models.Issue {
+	fired := make(map[string]bool, len(b))
+	for _, issue := range b {
+		fired[issue.ID] = true
+	}
+	missing := []models.Issue{}
+	for _, issue := range a {
+		if !fired[issue.ID] {
+			missing = append(missing, issue)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,213 @@
+package analyzer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+var (
+	// condaInstallRegex matches conda, mamba and micromamba commands that
+	// download packages, and captures the tool.
+	condaInstallRegex = regexp.MustCompile(`\b(conda|mamba|micromamba)\s+(install|create|update|env\s+create|env\s+update)\b`)
+	// condaCleanRegex matches a conda clean command.
+	condaCleanRegex = regexp.MustCompile(`\b(conda|mamba|micromamba)\s+clean\b`)
+	// condaInstallerRegex matches the Anaconda and Miniconda installers.
+	condaInstallerRegex = regexp.MustCompile(`\b(Anaconda|Miniconda|Miniforge|Mambaforge)3?-[\w.-]*\.sh\b`)
+	// condaEnvFileRegex matches a conda env create from an environment
+	// file, and captures the file.
+	condaEnvFileRegex = regexp.MustCompile(`\b(?:conda|mamba)\s+env\s+create\b[^&;|]*?\s(?:-f|--file)[= ]+["']?([^\s"';&|]+)`)
+)
+
+// condaPkgsDir is where conda keeps downloaded packages in the official
+// images.
+const condaPkgsDir = "/opt/conda/pkgs"
+
+// CondaTool returns the conda, mamba or micromamba command a RUN script
+// uses to install packages, or "".
+func CondaTool(run string) string {
+	if m := condaInstallRegex.FindAllStringSubmatch(run, -1); m != nil {
+		return m[len(m)-1][1]
+	}
+	return ""
+}
+
+// CondaCacheLeft reports whether a RUN installs conda packages and leaves
+// the package cache in the layer: no conda clean in the same RUN and no
+// cache mount over it.
+func CondaCacheLeft(inst Instruction) bool {
+	return inst.Command == "RUN" && CondaTool(inst.Args) != "" &&
+		!condaCleanRegex.MatchString(inst.Args) && !cacheMounted(inst, condaPkgsDir)
+}
+
+// condaDistribution returns the conda distribution an image ships:
+// "anaconda" for the full distribution, "conda" for miniconda and the like,
+// or "".
+func condaDistribution(image string) string {
+	repo := imageRepo(strings.ToLower(image))
+	switch {
+	case strings.HasPrefix(repo, "anaconda"):
+		return "anaconda"
+	case strings.HasPrefix(repo, "miniconda"), strings.HasPrefix(repo, "miniforge"), strings.HasPrefix(repo, "mambaforge"):
+		return "conda"
+	}
+	return ""
+}
+
+// CondaEnvFile describes a conda environment created from an environment
+// file copied from the build context.
+type CondaEnvFile struct {
+	Run    Instruction // the RUN creating the environment
+	Source string      // the environment file in the build context
+}
+
+// CondaEnvFileOf returns how the final stage, built on a conda image,
+// creates its conda environment from an environment file. It returns nil
+// when the stage does anything else with conda or doesn't copy the file
+// on its own.
+func (p *ParsedDockerfile) CondaEnvFileOf() *CondaEnvFile {
+	final := p.FinalStage()
+	if final < 0 || condaDistribution(p.Stages[final].BaseImage) == "" {
+		return nil
+	}
+	var env *CondaEnvFile
+	copied := make(map[string]string) // file name in the image -> source
+	for _, inst := range p.Stages[final].Instructions {
+		switch inst.Command {
+		case "COPY", "ADD":
+			if copyFromFlag(inst) != "" {
+				continue
+			}
+			if sources, dest, intoDir, ok := copyPaths(inst, "/"); ok {
+				for _, src := range sources {
+					name := path.Base(dest)
+					if intoDir {
+						name = path.Base(src)
+					}
+					copied[name] = src
+				}
+			}
+		case "RUN", "CMD", "ENTRYPOINT", "SHELL":
+			if !strings.Contains(inst.Args, "conda") && !strings.Contains(inst.Args, "mamba") && !strings.Contains(inst.Args, "activate") {
+				continue
+			}
+			m := condaEnvFileRegex.FindStringSubmatch(inst.Args)
+			if m == nil || env != nil || inst.Command != "RUN" {
+				return nil
+			}
+			// Nothing but the environment and cleaning up after it
+			for _, cmd := range shellSeparatorRegex.Split(inst.Args, -1) {
+				cmd = strings.TrimSpace(cmd)
+				if cmd != "" && !condaEnvFileRegex.MatchString(" "+cmd) && !condaCleanRegex.MatchString(cmd) {
+					return nil
+				}
+			}
+			src, ok := copied[path.Base(m[1])]
+			if !ok || strings.ContainsAny(src, "*?[") {
+				return nil
+			}
+			env = &CondaEnvFile{Run: inst, Source: src}
+		}
+	}
+	return env
+}
+
+// --- CondaDistributionRule ---
+
+type CondaDistributionRule struct{}
+
+func (r *CondaDistributionRule) ID() string { return "DIO030" }
+
+func (r *CondaDistributionRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *CondaDistributionRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	chain := pdf.StageChain(pdf.FinalStage())
+	if len(chain) == 0 {
+		return nil
+	}
+	base := chain[len(chain)-1]
+	fixable := pdf.CondaEnvFileOf() != nil
+	suggestion := "Create the environment with micromamba in a build stage (FROM mambaorg/micromamba) and copy only the environment into a slim runtime image."
+
+	var issues []models.Issue
+	switch condaDistribution(base.BaseImage) {
+	case "anaconda":
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityHigh,
+			Category:    "optimization",
+			Title:       "Full Anaconda distribution in the final image",
+			Description: fmt.Sprintf("%s ships the whole Anaconda distribution, hundreds of packages and several GB, most of which the application never imports.", base.BaseImage),
+			Line:        base.StartLine,
+			Suggestion:  suggestion,
+			AutoFixable: fixable,
+		})
+	case "conda":
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityLow,
+			Category:    "optimization",
+			Title:       "conda in the final image",
+			Description: fmt.Sprintf("%s keeps conda itself, its base environment and package cache in the image, next to the environment the application runs in.", base.BaseImage),
+			Line:        base.StartLine,
+			Suggestion:  suggestion,
+			AutoFixable: fixable,
+		})
+	}
+	for _, inst := range pdf.finalInstructions() {
+		if inst.Command == "RUN" && condaInstallerRegex.MatchString(inst.Args) {
+			issues = append(issues, models.Issue{
+				ID:          r.ID(),
+				Severity:    models.SeverityMedium,
+				Category:    "optimization",
+				Title:       "conda installed in the final image",
+				Description: fmt.Sprintf("The final stage runs the %s installer, which puts a full conda installation in the image.", condaInstallerRegex.FindString(inst.Args)),
+				Line:        inst.Line,
+				Suggestion:  suggestion,
+			})
+		}
+	}
+	return issues
+}
+
+// --- CondaCacheRule ---
+
+type CondaCacheRule struct{}
+
+func (r *CondaCacheRule) ID() string { return "DIO031" }
+
+func (r *CondaCacheRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *CondaCacheRule) Check(ctx *AnalysisContext) []models.Issue {
+	var issues []models.Issue
+	for _, inst := range ctx.ParsedFile.finalInstructions() {
+		if !CondaCacheLeft(inst) {
+			continue
+		}
+		clean := CondaCleanCommand(CondaTool(inst.Args))
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityMedium,
+			Category:    "optimization",
+			Title:       "conda package cache not cleaned",
+			Description: "conda keeps every downloaded package tarball and its extracted copy in the pkgs cache, often as large as the environment itself.",
+			Line:        inst.Line,
+			Suggestion:  fmt.Sprintf("Add '&& %s' to the same RUN command.", clean),
+			AutoFixable: true,
+		})
+	}
+	return issues
+}
+
+// CondaCleanCommand returns the command that removes the package cache
+// and index of a conda tool.
+func CondaCleanCommand(tool string) string {
+	if tool == "micromamba" {
+		return "micromamba clean --all --yes"
+	}
+	return tool + " clean -afy"
+}
@@ -0,0 +1,143 @@
+package analyzer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DockerfileNames are the names looked up in a directory, in order. Podman
+// and Buildah prefer a Containerfile over a Dockerfile.
+var DockerfileNames = []string{"Containerfile", "Dockerfile"}
+
+// FindDockerfile returns path when it is a file, and otherwise the
+// Containerfile or Dockerfile in the directory path.
+func FindDockerfile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return path, nil
+	}
+	for _, name := range DockerfileNames {
+		p := filepath.Join(path, name)
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no Containerfile or Dockerfile in %s", path)
+}
+
+// IsContainerfile reports whether a Dockerfile is named the Podman way:
+// Containerfile, Containerfile.prod or app.containerfile.
+func IsContainerfile(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	return strings.HasPrefix(name, "containerfile") || strings.HasSuffix(name, ".containerfile")
+}
+
+// IgnoreFile returns the path of the ignore file for the build context
+// dir. Podman and Buildah read .containerignore when there is one, and
+// .dockerignore otherwise; the returned .dockerignore may not exist.
+func IgnoreFile(dir string) string {
+	if p := filepath.Join(dir, ".containerignore"); fileExists(p) {
+		return p
+	}
+	return filepath.Join(dir, ".dockerignore")
+}
+
+// IgnoreFileName returns the name of the ignore file to write for a
+// Dockerfile: .containerignore next to a Containerfile, else .dockerignore.
+func IgnoreFileName(dockerfilePath string) string {
+	if IsContainerfile(dockerfilePath) {
+		return ".containerignore"
+	}
+	return ".dockerignore"
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// RunFlags splits the leading flags, such as --mount=type=cache,... and
+// --network=none, off the arguments of a RUN instruction.
+func RunFlags(args string) ([]string, string) {
+	rest := strings.TrimLeft(args, " \t")
+	var flags []string
+	for strings.HasPrefix(rest, "--") {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		if !strings.Contains(rest[:end], "=") {
+			break
+		}
+		flags = append(flags, rest[:end])
+		rest = strings.TrimLeft(rest[end:], " \t")
+	}
+	return flags, rest
+}
+
+// Mount is a RUN --mount.
+type Mount struct {
+	Type   string // bind (the default), cache, tmpfs, secret or ssh
+	Target string
+	Source string
+	From   string
+	// Options are the remaining options, e.g. sharing=locked, or the
+	// SELinux relabeling (z, Z, relabel=shared) and ownership (U) options
+	// Podman accepts.
+	Options []string
+}
+
+// ParseMount parses the value of a --mount flag. Like Buildah, it accepts
+// dst and destination for target, and src for source.
+func ParseMount(value string) Mount {
+	m := Mount{Type: "bind"}
+	for _, opt := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(opt, "=")
+		switch strings.ToLower(key) {
+		case "type":
+			m.Type = strings.ToLower(val)
+		case "target", "dst", "destination":
+			m.Target = val
+		case "source", "src":
+			m.Source = val
+		case "from":
+			m.From = val
+		case "":
+		default:
+			m.Options = append(m.Options, opt)
+		}
+	}
+	return m
+}
+
+// RunMounts returns the mounts of a RUN instruction.
+func RunMounts(inst Instruction) []Mount {
+	var mounts []Mount
+	for _, flag := range inst.Flags {
+		if value, ok := strings.CutPrefix(flag, "--mount="); ok {
+			mounts = append(mounts, ParseMount(value))
+		}
+	}
+	return mounts
+}
+
+// cacheMounted reports whether a RUN instruction mounts a cache or tmpfs
+// at dir or one of its parents, so nothing it writes there stays in the
+// image.
+func cacheMounted(inst Instruction, dir string) bool {
+	for _, m := range RunMounts(inst) {
+		if m.Type != "cache" && m.Type != "tmpfs" {
+			continue
+		}
+		target := strings.TrimSuffix(m.Target, "/")
+		if target != "" && (dir == target || strings.HasPrefix(dir, target+"/")) {
+			return true
+		}
+	}
+	return false
+}
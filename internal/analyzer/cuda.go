@@ -0,0 +1,169 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+var (
+	// cudaImageRegex matches NVIDIA CUDA images, on Docker Hub or NGC, and
+	// captures the tag.
+	cudaImageRegex = regexp.MustCompile(`^(?:docker\.io/|nvcr\.io/)?nvidia/cuda(?::([^@]+))?(?:@.*)?$`)
+	// cudaVersionRegex matches a tag that pins the full CUDA version,
+	// such as 12.4.1-cudnn-runtime-ubuntu22.04.
+	cudaVersionRegex = regexp.MustCompile(`^\d+\.\d+\.\d+-`)
+	// cudaPackageRegex matches CUDA, cuDNN, NCCL and TensorRT packages from
+	// the NVIDIA apt and yum repositories.
+	cudaPackageRegex = regexp.MustCompile(`^(cuda(-[a-z-]+)?|libcudnn\d*(-[a-z0-9-]+)?|cudnn\d*(-[a-z0-9-]+)?|libnccl\d*(-dev)?|tensorrt(-[a-z]+)?)$`)
+	// cudaVersionedPackageRegex matches package names that carry the CUDA
+	// version, such as cuda-toolkit-12-4.
+	cudaVersionedPackageRegex = regexp.MustCompile(`-\d+-\d+$`)
+	// gpuDriverPackageRegex matches NVIDIA driver packages.
+	gpuDriverPackageRegex = regexp.MustCompile(`^(nvidia-driver|nvidia-headless|nvidia-utils|nvidia-kernel|libnvidia-compute|libnvidia-gl|xserver-xorg-video-nvidia|cuda-drivers|kmod-nvidia)(-.*)?$`)
+	// gpuDriverInstallerRegex matches the NVIDIA driver runfile installer.
+	gpuDriverInstallerRegex = regexp.MustCompile(`NVIDIA-Linux-[\w.-]*\.run`)
+)
+
+// cudaTag returns the tag of an NVIDIA CUDA image, and whether image is one.
+func cudaTag(image string) (string, bool) {
+	m := cudaImageRegex.FindStringSubmatch(strings.ToLower(image))
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// --- CUDADevelRule ---
+
+type CUDADevelRule struct{}
+
+func (r *CUDADevelRule) ID() string { return "DIO025" }
+
+func (r *CUDADevelRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *CUDADevelRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	chain := pdf.StageChain(pdf.FinalStage())
+	if len(chain) == 0 {
+		return nil
+	}
+	base := chain[len(chain)-1]
+	tag, ok := cudaTag(base.BaseImage)
+	if !ok || !strings.Contains(tag, "-devel") {
+		return nil
+	}
+	runtime := strings.Replace(base.BaseImage, "-devel", "-runtime", 1)
+	return []models.Issue{{
+		ID:          r.ID(),
+		Severity:    models.SeverityHigh,
+		Category:    "optimization",
+		Title:       "CUDA -devel image in the final stage",
+		Description: fmt.Sprintf("The final image is built on %s. -devel images add nvcc, headers and static libraries, several GB more than -runtime, which has the shared libraries a CUDA application needs to run.", base.BaseImage),
+		Line:        base.StartLine,
+		Suggestion:  fmt.Sprintf("Build on %s. If the image compiles CUDA code, do it in a -devel build stage and copy the results over.", runtime),
+	}}
+}
+
+// --- CUDAVersionRule ---
+
+type CUDAVersionRule struct{}
+
+func (r *CUDAVersionRule) ID() string { return "DIO026" }
+
+func (r *CUDAVersionRule) Check(ctx *AnalysisContext) []models.Issue {
+	var issues []models.Issue
+	for _, stage := range ctx.ParsedFile.Stages {
+		// Untagged and latest images are reported by DIO001
+		tag, ok := cudaTag(stage.BaseImage)
+		if ok && tag != "" && tag != "latest" && !hasUnresolvedArgs(tag) && !cudaVersionRegex.MatchString(tag) {
+			issues = append(issues, models.Issue{
+				ID:          r.ID(),
+				Severity:    models.SeverityMedium,
+				Category:    "best-practice",
+				Title:       "CUDA version not pinned",
+				Description: fmt.Sprintf("%s doesn't name the full CUDA version. The CUDA version must match what the application and its frameworks were built against, and stay within what the host driver supports.", stage.BaseImage),
+				Line:        stage.StartLine,
+				Suggestion:  "Use a tag with the full version, such as nvidia/cuda:12.4.1-cudnn-runtime-ubuntu22.04.",
+			})
+		}
+		for _, inst := range stage.Instructions {
+			if inst.Command != "RUN" {
+				continue
+			}
+			if pkgs := unpinnedCUDAPackages(inst.Args); len(pkgs) > 0 {
+				issues = append(issues, models.Issue{
+					ID:          r.ID(),
+					Severity:    models.SeverityMedium,
+					Category:    "best-practice",
+					Title:       "CUDA libraries not pinned",
+					Description: fmt.Sprintf("%s %s installed without a version. The NVIDIA repositories publish new CUDA and cuDNN releases under the same names, so rebuilds can pick up a version that doesn't match the base image or the frameworks.", strings.Join(pkgs, ", "), isAre(len(pkgs))),
+					Line:        inst.Line,
+					Suggestion:  "Pin the versions, e.g. libcudnn8=8.9.7.29-1+cuda12.2, or use the versioned packages such as cuda-libraries-12-4.",
+				})
+			}
+		}
+	}
+	return issues
+}
+
+// unpinnedCUDAPackages returns the CUDA packages a RUN script installs
+// without a version.
+func unpinnedCUDAPackages(run string) []string {
+	var pkgs []string
+	for _, cmd := range shellSeparatorRegex.Split(run, -1) {
+		_, args := packageCommand(cmd, installVerbs)
+		for _, arg := range args {
+			name := packageName(arg)
+			if strings.HasPrefix(arg, "-") || name != arg || !cudaPackageRegex.MatchString(name) ||
+				cudaVersionedPackageRegex.MatchString(name) || gpuDriverPackageRegex.MatchString(name) {
+				continue
+			}
+			pkgs = append(pkgs, name)
+		}
+	}
+	return pkgs
+}
+
+// --- GPUDriverRule ---
+
+type GPUDriverRule struct{}
+
+func (r *GPUDriverRule) ID() string { return "DIO027" }
+
+func (r *GPUDriverRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *GPUDriverRule) Check(ctx *AnalysisContext) []models.Issue {
+	var issues []models.Issue
+	for _, inst := range ctx.ParsedFile.finalInstructions() {
+		if inst.Command != "RUN" {
+			continue
+		}
+		var found []string
+		for _, install := range PackageInstalls(inst.Args) {
+			for _, pkg := range install.Packages {
+				if gpuDriverPackageRegex.MatchString(pkg) {
+					found = append(found, pkg)
+				}
+			}
+		}
+		if m := gpuDriverInstallerRegex.FindString(inst.Args); m != "" {
+			found = append(found, m)
+		}
+		if len(found) == 0 {
+			continue
+		}
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityHigh,
+			Category:    "best-practice",
+			Title:       "NVIDIA driver installed in the image",
+			Description: fmt.Sprintf("The image installs %s. The NVIDIA Container Toolkit mounts the host's driver into the container; a driver in the image adds hundreds of MB to GBs and breaks GPU access when it doesn't match the host's kernel module exactly.", strings.Join(found, ", ")),
+			Line:        inst.Line,
+			Suggestion:  "Don't install the driver. Install it on the host, run the container with --gpus (or the nvidia runtime class), and install only CUDA libraries in the image, or build on nvidia/cuda.",
+		})
+	}
+	return issues
+}
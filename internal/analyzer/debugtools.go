@@ -0,0 +1,130 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Kinds of debugging and convenience tools.
+const (
+	toolEditor         = "editor"
+	toolDebugger       = "debugger"
+	toolNetwork        = "network tool"
+	toolHTTPClient     = "HTTP client"
+	toolRemoteAccess   = "SSH server"
+	toolPrivilege      = "privilege escalation"
+	toolPackageManager = "package manager"
+)
+
+// debugTools maps packages that are only useful to debug or administer a
+// running container to their kind.
+var debugTools = map[string]string{
+	"vim": toolEditor, "vim-tiny": toolEditor, "nano": toolEditor, "emacs": toolEditor, "emacs-nox": toolEditor,
+	"gdb": toolDebugger, "strace": toolDebugger, "ltrace": toolDebugger, "valgrind": toolDebugger,
+	"tcpdump": toolNetwork, "netcat": toolNetwork, "netcat-openbsd": toolNetwork, "netcat-traditional": toolNetwork,
+	"ncat": toolNetwork, "nmap": toolNetwork, "telnet": toolNetwork, "iputils-ping": toolNetwork,
+	"net-tools": toolNetwork, "dnsutils": toolNetwork, "bind-tools": toolNetwork,
+	"curl": toolHTTPClient, "wget": toolHTTPClient,
+	"openssh-server": toolRemoteAccess, "openssh": toolRemoteAccess, "dropbear": toolRemoteAccess,
+	"sudo": toolPrivilege, "doas": toolPrivilege,
+	"python3-pip": toolPackageManager, "py3-pip": toolPackageManager, "npm": toolPackageManager,
+}
+
+// debugTool is a debugging or convenience tool installed in a RUN
+// instruction.
+type debugTool struct {
+	Package string
+	Kind    string
+}
+
+// installedDebugTools returns the debugging and convenience tools a RUN
+// script installs and doesn't remove again. HTTP clients are left out when
+// used is true for them: a HEALTHCHECK or the container command needs them.
+func installedDebugTools(run string, used func(pkg string) bool) []debugTool {
+	removed := removedPackages(run)
+	var tools []debugTool
+	for _, install := range PackageInstalls(run) {
+		if install.Virtual != "" && removed[install.Virtual] {
+			continue
+		}
+		for _, pkg := range install.Packages {
+			kind, ok := debugTools[pkg]
+			if !ok || removed[pkg] || (kind == toolHTTPClient && used(pkg)) {
+				continue
+			}
+			tools = append(tools, debugTool{Package: pkg, Kind: kind})
+		}
+	}
+	return tools
+}
+
+// runtimeCommands returns the HEALTHCHECK, CMD and ENTRYPOINT arguments of
+// the instructions, which run in the container rather than at build time.
+func runtimeCommands(insts []Instruction) string {
+	var cmds []string
+	for _, inst := range insts {
+		switch inst.Command {
+		case "HEALTHCHECK", "CMD", "ENTRYPOINT":
+			cmds = append(cmds, inst.Args)
+		}
+	}
+	return strings.Join(cmds, "\n")
+}
+
+// --- DebugToolsRule ---
+
+type DebugToolsRule struct{}
+
+func (r *DebugToolsRule) ID() string { return "DIO019" }
+
+func (r *DebugToolsRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *DebugToolsRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	if pdf.FinalStage() < 0 {
+		return nil
+	}
+	insts := pdf.finalInstructions()
+	runtime := runtimeCommands(insts)
+	used := func(pkg string) bool {
+		return regexp.MustCompile(`\b` + regexp.QuoteMeta(pkg) + `\b`).MatchString(runtime)
+	}
+
+	var issues []models.Issue
+	for _, inst := range insts {
+		if inst.Command != "RUN" {
+			continue
+		}
+		tools := installedDebugTools(inst.Args, used)
+		if len(tools) == 0 {
+			continue
+		}
+		severity := models.SeverityMedium
+		byKind := make(map[string][]string)
+		for _, tool := range tools {
+			byKind[tool.Kind] = append(byKind[tool.Kind], tool.Package)
+			if tool.Kind == toolRemoteAccess || tool.Kind == toolPrivilege {
+				severity = models.SeverityHigh
+			}
+		}
+		var found []string
+		for kind, pkgs := range byKind {
+			found = append(found, fmt.Sprintf("%s (%s)", strings.Join(pkgs, ", "), kind))
+		}
+		sort.Strings(found)
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    severity,
+			Category:    "security",
+			Title:       "Debugging tools in the final image",
+			Description: fmt.Sprintf("The final image installs %s. Tools to inspect or administer a running container widen the attack surface and help an attacker who gets in.", strings.Join(found, "; ")),
+			Line:        inst.Line,
+			Suggestion:  "Leave them out of production images. Debug with an ephemeral container (kubectl debug, docker debug) or a separate debug stage built with --target.",
+		})
+	}
+	return issues
+}
@@ -0,0 +1,315 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// directiveRegex matches a parser directive such as "# escape=`".
+var directiveRegex = regexp.MustCompile(`^#\s*([a-zA-Z]+)\s*=\s*(\S+)\s*$`)
+
+// Parser directives BuildKit knows. Any other name ends the directives,
+// like a comment does.
+const (
+	DirectiveSyntax = "syntax"
+	DirectiveEscape = "escape"
+	DirectiveCheck  = "check"
+)
+
+// SyntaxDirective is the directive strategies add when they write syntax
+// the builder's built-in frontend may not support.
+const SyntaxDirective = "# syntax=docker/dockerfile:1"
+
+// Directives are the parser directives at the top of a Dockerfile.
+type Directives struct {
+	// Syntax is the frontend image of the syntax directive, such as
+	// docker/dockerfile:1.7. Empty uses the builder's built-in frontend.
+	Syntax string
+	// Check configures the build checks, e.g. skip=JSONArgsRecommended.
+	Check string
+	// Escape is the line continuation character, '\' by default.
+	Escape byte
+	// Lines are the lines the directives are on, by name.
+	Lines map[string]int
+	// Duplicates are the lines of directives repeated in the block, which
+	// BuildKit rejects.
+	Duplicates []int
+	// Ignored are the lines of directives after the first blank line,
+	// comment or instruction, which are comments.
+	Ignored []int
+}
+
+// ParseDirectives returns the parser directives of a Dockerfile. Like
+// BuildKit, it only honours directives at the top of the file, before
+// any blank line, comment, instruction or unknown directive.
+func ParseDirectives(lines []string) Directives {
+	d := Directives{Escape: '\\', Lines: make(map[string]int)}
+	done := false
+	for i, line := range lines {
+		m := directiveRegex.FindStringSubmatch(strings.TrimSpace(line))
+		name := ""
+		if m != nil {
+			name = strings.ToLower(m[1])
+		}
+		if name != DirectiveSyntax && name != DirectiveEscape && name != DirectiveCheck {
+			done = true
+			continue
+		}
+		if done {
+			d.Ignored = append(d.Ignored, i+1)
+			continue
+		}
+		if _, ok := d.Lines[name]; ok {
+			d.Duplicates = append(d.Duplicates, i+1)
+			continue
+		}
+		d.Lines[name] = i + 1
+		switch name {
+		case DirectiveSyntax:
+			d.Syntax = m[2]
+		case DirectiveCheck:
+			d.Check = m[2]
+		case DirectiveEscape:
+			if m[2] == "`" || m[2] == `\` {
+				d.Escape = m[2][0]
+			}
+		}
+	}
+	return d
+}
+
+// EscapeChar returns the escape character declared by an escape parser
+// directive, or '\' when there is none.
+func EscapeChar(lines []string) byte {
+	return ParseDirectives(lines).Escape
+}
+
+// Frontend is the Dockerfile frontend a syntax directive selects.
+type Frontend struct {
+	// Image is the frontend image without tag or digest.
+	Image string
+	// Major and Minor are the docker/dockerfile release the tag selects,
+	// 1.7 for 1.7, 1.7.1 or 1.7-labs. Minor is -1 for tags that follow
+	// the latest release, like 1 or latest.
+	Major, Minor int
+	// Labs is set for the labs channel, which has unreleased syntax.
+	Labs bool
+}
+
+// frontendImages are the images of the official Dockerfile frontend.
+var frontendImages = map[string]bool{
+	"docker/dockerfile":          true,
+	"docker/dockerfile-upstream": true,
+}
+
+// frontendTagRegex matches the version tags of docker/dockerfile.
+var frontendTagRegex = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:\.\d+)?(-labs)?$`)
+
+// ParseFrontend parses the image of a syntax directive. It returns false
+// for custom frontends and tags it doesn't know, whose syntax can't be
+// told from the version.
+func ParseFrontend(syntax string) (Frontend, bool) {
+	ref, _, _ := strings.Cut(syntax, "@")
+	ref = strings.TrimPrefix(strings.TrimPrefix(ref, "docker.io/"), "index.docker.io/")
+	image, tag := ref, "latest"
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		image, tag = ref[:i], ref[i+1:]
+	}
+	if !frontendImages[image] {
+		return Frontend{}, false
+	}
+	f := Frontend{Image: image, Major: 1, Minor: -1}
+	switch tag {
+	case "latest", "master":
+		return f, true
+	case "labs":
+		f.Labs = true
+		return f, true
+	case "experimental":
+		// Frozen at 1.1 when the labs channel replaced it
+		f.Minor, f.Labs = 1, true
+		return f, true
+	}
+	m := frontendTagRegex.FindStringSubmatch(tag)
+	if m == nil {
+		return Frontend{}, false
+	}
+	f.Major, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		f.Minor, _ = strconv.Atoi(m[2])
+	}
+	f.Labs = m[3] != ""
+	return f, true
+}
+
+// String returns the release of the frontend, such as 1.7 or 1.
+func (f Frontend) String() string {
+	if f.Minor < 0 {
+		return strconv.Itoa(f.Major)
+	}
+	return fmt.Sprintf("%d.%d", f.Major, f.Minor)
+}
+
+// SyntaxFeature is Dockerfile syntax that needs a docker/dockerfile
+// release of at least 1.Minor.
+type SyntaxFeature struct {
+	Name  string
+	Minor int
+}
+
+// Syntax that older frontends reject.
+var (
+	FeatureRunMount   = SyntaxFeature{"RUN --mount", 2}
+	FeatureCopyChmod  = SyntaxFeature{"COPY --chmod", 2}
+	FeatureRunNetwork = SyntaxFeature{"RUN --network", 3}
+	FeatureHeredocs   = SyntaxFeature{"heredocs", 4}
+	FeatureCopyLink   = SyntaxFeature{"COPY --link", 4}
+	FeatureChecks     = SyntaxFeature{"the check directive", 8}
+)
+
+// Supports reports whether the frontend accepts feature.
+func (f Frontend) Supports(feature SyntaxFeature) bool {
+	return f.Major > 1 || f.Minor < 0 || f.Minor >= feature.Minor
+}
+
+// minFrontendMinor is the oldest docker/dockerfile release not reported
+// as outdated: 1.4 brought heredocs and COPY --link.
+const minFrontendMinor = 4
+
+// SyntaxFeatures returns the features an instruction uses that need a
+// newer frontend than the oldest ones.
+func SyntaxFeatures(inst Instruction) []SyntaxFeature {
+	var features []SyntaxFeature
+	if len(inst.Heredocs) > 0 {
+		features = append(features, FeatureHeredocs)
+	}
+	flags := inst.Flags
+	if inst.Command == "COPY" || inst.Command == "ADD" {
+		flags = strings.Fields(inst.Args)
+	}
+	for _, flag := range flags {
+		if !strings.HasPrefix(flag, "--") {
+			break
+		}
+		name, _, _ := strings.Cut(flag, "=")
+		switch {
+		case inst.Command == "RUN" && name == "--mount":
+			features = append(features, FeatureRunMount)
+		case inst.Command == "RUN" && name == "--network":
+			features = append(features, FeatureRunNetwork)
+		case inst.Command != "RUN" && name == "--chmod":
+			features = append(features, FeatureCopyChmod)
+		case inst.Command != "RUN" && name == "--link":
+			features = append(features, FeatureCopyLink)
+		}
+	}
+	return features
+}
+
+// buildChecks are the checks of docker build --check, for the skip option
+// of the check directive.
+var buildChecks = map[string]bool{
+	"StageNameCasing": true, "FromAsCasing": true, "NoEmptyContinuation": true,
+	"ConsistentInstructionCasing": true, "DuplicateStageName": true, "ReservedStageName": true,
+	"JSONArgsRecommended": true, "MaintainerDeprecated": true, "UndefinedArgInFrom": true,
+	"WorkdirRelativePath": true, "UndefinedVar": true, "MultipleInstructionsDisallowed": true,
+	"LegacyKeyValueFormat": true, "RedundantTargetPlatform": true, "SecretsUsedInArgOrEnv": true,
+	"InvalidDefaultArgInFrom": true, "FromPlatformFlagConstDisallowed": true, "CopyIgnoredFile": true,
+	"InvalidDefinitionDescription": true, "ExposeProtoCasing": true, "ExposeInvalidFormat": true,
+}
+
+// checkDirectiveProblems returns what is wrong with the value of a check
+// directive, such as "skip=all;error=true".
+func checkDirectiveProblems(value string) []string {
+	var problems []string
+	for _, opt := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(strings.TrimSpace(opt), "=")
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%q is not key=value", opt))
+		case key == "error":
+			if _, err := strconv.ParseBool(val); err != nil {
+				problems = append(problems, fmt.Sprintf("error must be true or false, not %q", val))
+			}
+		case key == "skip":
+			for _, name := range strings.Split(val, ",") {
+				if name != "all" && !buildChecks[name] {
+					problems = append(problems, fmt.Sprintf("unknown check %q", name))
+				}
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("unknown option %q", key))
+		}
+	}
+	return problems
+}
+
+// --- DirectiveRule ---
+
+type DirectiveRule struct{}
+
+func (r *DirectiveRule) ID() string { return "DIO037" }
+
+func (r *DirectiveRule) Scope() RuleScope { return ScopeFile }
+
+func (r *DirectiveRule) Check(ctx *AnalysisContext) []models.Issue {
+	d := ParseDirectives(ctx.Lines)
+	var issues []models.Issue
+	issue := func(severity models.Severity, line int, description, suggestion string) {
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    severity,
+			Category:    "best-practice",
+			Title:       "Parser directive problem",
+			Description: description,
+			Line:        line,
+			Suggestion:  suggestion,
+		})
+	}
+
+	for _, line := range d.Duplicates {
+		issue(models.SeverityMedium, line, "The parser directive is repeated. BuildKit fails with \"only one parser directive can be used\".", "Remove the repeated directive.")
+	}
+	for _, line := range d.Ignored {
+		issue(models.SeverityLow, line, "The parser directive comes after a blank line, comment or instruction, so it is a plain comment and has no effect.", "Move it to the top of the file, before any other line.")
+	}
+
+	frontend, known := ParseFrontend(d.Syntax)
+	if d.Syntax != "" && known && frontend.Major == 1 && frontend.Minor >= 0 && frontend.Minor < minFrontendMinor {
+		issue(models.SeverityLow, d.Lines[DirectiveSyntax], fmt.Sprintf("The syntax directive pins %s, a frontend older than 1.%d without heredocs, COPY --link and current fixes.", d.Syntax, minFrontendMinor), "Use "+SyntaxDirective+" to follow the latest stable 1.x release.")
+	}
+
+	if d.Check != "" {
+		line := d.Lines[DirectiveCheck]
+		if problems := checkDirectiveProblems(d.Check); len(problems) > 0 {
+			issue(models.SeverityLow, line, "The check directive is invalid: "+strings.Join(problems, "; ")+".", "Use skip=<check>,... and error=true|false, separated by ;.")
+		}
+		if d.Syntax != "" && known && !frontend.Supports(FeatureChecks) {
+			issue(models.SeverityLow, line, fmt.Sprintf("The check directive needs docker/dockerfile 1.%d or later; %s ignores it.", FeatureChecks.Minor, d.Syntax), "Use "+SyntaxDirective+".")
+		}
+	}
+
+	// Syntax the frontend doesn't support, once per feature
+	seen := make(map[string]bool)
+	for _, inst := range ctx.ParsedFile.Instructions {
+		for _, f := range SyntaxFeatures(inst) {
+			if seen[f.Name] {
+				continue
+			}
+			switch {
+			case d.Syntax == "" && !IsContainerfile(ctx.FilePath):
+				// Buildah parses the whole syntax itself, ignoring the directive
+				seen[f.Name] = true
+				issue(models.SeverityLow, inst.Line, fmt.Sprintf("%s needs docker/dockerfile 1.%d or later, but without a syntax directive the build depends on the builder's built-in frontend, which may be older.", f.Name, f.Minor), "Add "+SyntaxDirective+" as the first line.")
+			case known && !frontend.Supports(f):
+				seen[f.Name] = true
+				issue(models.SeverityMedium, inst.Line, fmt.Sprintf("%s needs docker/dockerfile 1.%d or later, but the syntax directive selects %s. The build fails.", f.Name, f.Minor, d.Syntax), "Use "+SyntaxDirective+".")
+			}
+		}
+	}
+	return issues
+}
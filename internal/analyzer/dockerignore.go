@@ -0,0 +1,282 @@
+package analyzer
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// heavyContextDirs are directories that are commonly large and almost never
+// belong in a build context.
+var heavyContextDirs = []string{"node_modules", ".git", "dist", "venv", ".venv"}
+
+// ContextDir is a directory in the build context that .dockerignore doesn't
+// exclude.
+type ContextDir struct {
+	Path string
+	Size int64
+}
+
+// ignorePattern is a single compiled .dockerignore line.
+type ignorePattern struct {
+	pattern string
+	negate  bool
+	re      *regexp.Regexp
+}
+
+// parseDockerignore reads a .dockerignore file into match patterns.
+func parseDockerignore(path string) ([]ignorePattern, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p, ok := compileIgnorePattern(scanner.Text()); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// compileIgnorePattern compiles a .dockerignore line. It reports false for
+// blank lines, comments and patterns docker can't compile, which docker
+// skips too.
+func compileIgnorePattern(line string) (ignorePattern, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+	p := ignorePattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = strings.TrimSpace(line[1:])
+	}
+	line = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(line)), "/")
+	if line == "" || line == "." {
+		return ignorePattern{}, false
+	}
+	re, err := regexp.Compile(ignorePatternRegex(line))
+	if err != nil {
+		return ignorePattern{}, false
+	}
+	p.pattern = line
+	p.re = re
+	return p, true
+}
+
+// ignorePatternRegex converts a .dockerignore pattern to an anchored regex.
+// `**` matches any number of directories, `*` and `?` stay within one path
+// component.
+func ignorePatternRegex(pattern string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			i++
+			if i+1 < len(pattern) && pattern[i+1] == '/' {
+				i++
+				sb.WriteString("(.*/)?")
+			} else {
+				sb.WriteString(".*")
+			}
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end == -1 {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			sb.WriteString(pattern[i : i+end+1])
+			i += end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// ignored reports whether a slash-separated context path is excluded. A path
+// is excluded when it or one of its parents matches; later patterns win.
+func ignored(patterns []ignorePattern, path string) bool {
+	excluded := false
+	for _, p := range patterns {
+		if matchesPathOrParent(p.re, path) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+func matchesPathOrParent(re *regexp.Regexp, path string) bool {
+	for {
+		if re.MatchString(path) {
+			return true
+		}
+		idx := strings.LastIndex(path, "/")
+		if idx == -1 {
+			return false
+		}
+		path = path[:idx]
+	}
+}
+
+// uncoveredContextDirs returns the heavy directories present in contextDir
+// that the .dockerignore patterns leave in the build context, with their size.
+func uncoveredContextDirs(contextDir string, patterns []ignorePattern) []ContextDir {
+	var dirs []ContextDir
+	for _, name := range heavyContextDirs {
+		info, err := os.Stat(filepath.Join(contextDir, name))
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		// "node_modules/*" excludes everything inside, which is as good as
+		// excluding the directory itself.
+		if ignored(patterns, name) || ignored(patterns, name+"/x") {
+			continue
+		}
+		dirs = append(dirs, ContextDir{Path: name, Size: dirSize(filepath.Join(contextDir, name))})
+	}
+	return dirs
+}
+
+// dirSize returns the total size of regular files under dir.
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// dockerignoreDefaults are excluded by every generated .dockerignore: VCS
+// data, editor settings, logs and local secrets.
+var dockerignoreDefaults = []string{
+	".git", ".gitignore", ".idea", ".vscode", "**/.DS_Store",
+	"**/*.log", ".env", ".env.*", "*.pem", "*.key",
+	"Dockerfile*", ".dockerignore", "Containerfile*", ".containerignore",
+}
+
+// dockerignoreByProject are excluded when the context holds a project of
+// the given kind, identified by its manifest file.
+var dockerignoreByProject = []struct {
+	marker   string
+	patterns []string
+}{
+	{"package.json", []string{"node_modules", "**/npm-debug.log*", "**/yarn-error.log*", ".npm", "coverage"}},
+	{"requirements.txt", []string{"**/__pycache__", "**/*.py[cod]", ".venv", "venv", ".pytest_cache", ".mypy_cache", ".tox"}},
+	{"pyproject.toml", []string{"**/__pycache__", "**/*.py[cod]", ".venv", "venv", ".pytest_cache", ".mypy_cache", ".tox"}},
+	{"Cargo.toml", []string{"target"}},
+	{"pom.xml", []string{"target"}},
+	{"build.gradle", []string{"build", ".gradle"}},
+	{"build.gradle.kts", []string{"build", ".gradle"}},
+	{"go.mod", []string{"bin"}},
+}
+
+// GenerateDockerignore returns a .dockerignore for the build context of a
+// Dockerfile: the defaults, the build output and dependency directories of
+// the projects found in the context, and the heavy directories present.
+// Patterns that would exclude a COPY or ADD source are left out, so the
+// build keeps working.
+func GenerateDockerignore(contextDir, dockerfile string) string {
+	var candidates []string
+	seen := make(map[string]bool)
+	add := func(patterns ...string) {
+		for _, p := range patterns {
+			if !seen[p] {
+				seen[p] = true
+				candidates = append(candidates, p)
+			}
+		}
+	}
+	add(dockerignoreDefaults...)
+	for _, project := range dockerignoreByProject {
+		if _, err := os.Stat(filepath.Join(contextDir, project.marker)); err == nil {
+			add(project.patterns...)
+		}
+	}
+	for _, name := range heavyContextDirs {
+		if info, err := os.Stat(filepath.Join(contextDir, name)); err == nil && info.IsDir() {
+			add(name)
+		}
+	}
+
+	sources := contextSources(parseDockerfile(strings.Split(dockerfile, "\n")))
+	var sb strings.Builder
+	sb.WriteString("# Generated by dio: files that don't belong in the build context\n")
+	for _, line := range candidates {
+		p, ok := compileIgnorePattern(line)
+		if !ok {
+			continue
+		}
+		needed := false
+		for _, src := range sources {
+			if ignored([]ignorePattern{p}, src) {
+				needed = true
+				break
+			}
+		}
+		if !needed {
+			sb.WriteString(line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// contextSources returns the build context paths that COPY and ADD
+// instructions read, relative to the context. Wildcards are cut at the
+// first wildcard character, so "src/*.go" yields "src".
+func contextSources(pdf *ParsedDockerfile) []string {
+	var sources []string
+	for _, inst := range pdf.Instructions {
+		if (inst.Command != "COPY" && inst.Command != "ADD") || copyFromFlag(inst) != "" {
+			continue
+		}
+		for _, src := range copySources(inst.Args) {
+			src = strings.Trim(src, `[]",`)
+			if strings.Contains(src, "://") {
+				continue // ADD from a URL
+			}
+			if i := strings.IndexAny(src, "*?["); i >= 0 {
+				src = path.Dir(src[:i] + "x")
+			}
+			src = strings.TrimPrefix(path.Clean("/"+src), "/")
+			if src != "" {
+				sources = append(sources, src)
+			}
+		}
+	}
+	return sources
+}
+
+// DockerignoreExcludes reports whether the .dockerignore (or
+// .containerignore) in contextDir excludes a slash-separated context path
+// from the build context.
+func DockerignoreExcludes(contextDir, path string) bool {
+	patterns, err := parseDockerignore(IgnoreFile(contextDir))
+	if err != nil {
+		return false
+	}
+	return ignored(patterns, strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "/"))
+}
@@ -0,0 +1,385 @@
+package analyzer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// rulesDocURL is the base URL of the built-in rule reference.
+const rulesDocURL = "https://github.com/maxlar/docker-image-optimizer/blob/main/docs/rules.md"
+
+// hadolintDocURL is the base URL of the hadolint rule wiki.
+const hadolintDocURL = "https://github.com/hadolint/hadolint/wiki/"
+
+// shellcheckDocURL is the base URL of the shellcheck wiki.
+const shellcheckDocURL = "https://www.shellcheck.net/wiki/"
+
+// RuleDoc documents a built-in rule for `dio rules` and report links.
+type RuleDoc struct {
+	ID          string          `json:"id"`
+	Title       string          `json:"title"`
+	Severity    models.Severity `json:"severity"`
+	Category    string          `json:"category"`
+	Ruleset     string          `json:"ruleset"`
+	Scope       RuleScope       `json:"scope"`
+	AutoFixable bool            `json:"auto_fixable"`
+	Rationale   string          `json:"rationale"`
+	Bad         string          `json:"bad,omitempty"`
+	Good        string          `json:"good,omitempty"`
+	URL         string          `json:"url"`
+}
+
+// defaultRuleDocs documents the default ruleset.
+var defaultRuleDocs = []RuleDoc{
+	{
+		ID: "DIO001", Title: "Unpinned base image tag", Severity: models.SeverityHigh, Category: "base-image",
+		Rationale: "Untagged or :latest base images change underneath you, so the same Dockerfile produces different images over time and can silently pick up breaking changes or new CVEs. In repositories where Renovate or Dependabot updates base images, only a digest pin is asked for, at medium severity: the updater then proposes each change as a pull request.",
+		Bad:       "FROM node",
+		Good:      "FROM node:20.11-alpine",
+	},
+	{
+		ID: "DIO002", Title: "Missing .dockerignore", Severity: models.SeverityMedium, Category: "best-practice", AutoFixable: true,
+		Rationale: "Without a .dockerignore the whole directory, including .git, node_modules and local secrets, is sent as build context and may end up in the image via COPY . .",
+		Good:      "# .dockerignore\n.git\nnode_modules\n*.log",
+	},
+	{
+		ID: "DIO003", Title: "Too many layers", Severity: models.SeverityMedium, Category: "optimization", AutoFixable: true,
+		Rationale: "Every RUN, COPY and ADD creates a layer. Many small layers increase pull time and make it impossible to remove files created in earlier layers.",
+		Bad:       "RUN apt-get update\nRUN apt-get install -y curl\nRUN rm -rf /var/lib/apt/lists/*",
+		Good:      "RUN apt-get update && \\\n    apt-get install -y curl && \\\n    rm -rf /var/lib/apt/lists/*",
+	},
+	{
+		ID: "DIO004", Title: "apt-get install without --no-install-recommends", Severity: models.SeverityMedium, Category: "optimization", AutoFixable: true,
+		Rationale: "apt installs recommended packages by default, which often pulls in tens of megabytes the application never uses. dnf and microdnf install weak dependencies unless --setopt=install_weak_deps=False, and zypper recommended packages unless --no-recommends.",
+		Bad:       "RUN apt-get install -y curl",
+		Good:      "RUN apt-get install -y --no-install-recommends curl",
+	},
+	{
+		ID: "DIO005", Title: "Package manager cache not cleaned", Severity: models.SeverityMedium, Category: "optimization", AutoFixable: true,
+		Rationale: "Package indexes and download caches are only removed from the image if they are deleted in the same layer that created them. Cleaning in a later RUN does not reduce image size. The rule covers apt-get, apk (--no-cache), dnf, microdnf and yum (clean all), zypper (clean --all) and pip, and npm and yarn in the stages of the final image.",
+		Bad:       "RUN apt-get update && apt-get install -y curl\nRUN pip install flask",
+		Good:      "RUN apt-get update && apt-get install -y curl && \\\n    rm -rf /var/lib/apt/lists/*\nRUN pip install --no-cache-dir flask",
+	},
+	{
+		ID: "DIO006", Title: "Container runs as root", Severity: models.SeverityHigh, Category: "security", AutoFixable: true,
+		Rationale: "A process running as root inside the container is root on the host if it escapes the container. Running as an unprivileged user limits the blast radius.",
+		Bad:       "FROM alpine:3.19\nCMD [\"./app\"]",
+		Good:      "FROM alpine:3.19\nRUN adduser -D -u 10001 appuser\nUSER 10001\nCMD [\"./app\"]",
+	},
+	{
+		ID: "DIO007", Title: "Copying entire build context", Severity: models.SeverityLow, Category: "optimization",
+		Rationale: "COPY . . invalidates the layer cache on any file change and can copy files that don't belong in the image.",
+		Bad:       "COPY . .",
+		Good:      "COPY package*.json ./\nRUN npm ci\nCOPY src/ ./src/",
+	},
+	{
+		ID: "DIO008", Title: "No multi-stage build", Severity: models.SeverityHigh, Category: "optimization", AutoFixable: true,
+		Rationale: "Compilers, SDKs and build caches are only needed at build time. A multi-stage build copies just the build output into a small runtime image.",
+		Bad:       "FROM golang:1.22\nCOPY . .\nRUN go build -o /app",
+		Good:      "FROM golang:1.22 AS builder\nCOPY . .\nRUN go build -o /app\n\nFROM gcr.io/distroless/static\nCOPY --from=builder /app /app",
+	},
+	{
+		ID: "DIO009", Title: "Unpinned package versions", Severity: models.SeverityLow, Category: "reproducibility",
+		Rationale: "Installing packages without versions makes builds non-reproducible: the same Dockerfile installs different versions on different days. apt, apk and zypper pin with name=version, dnf and yum with name-version.",
+		Bad:       "RUN apt-get install -y curl",
+		Good:      "RUN apt-get install -y curl=7.88.1-10+deb12u5",
+	},
+	{
+		ID: "DIO010", Title: "Consecutive RUN commands", Severity: models.SeverityMedium, Category: "optimization", AutoFixable: true,
+		Rationale: "Three or more RUN instructions in a row usually belong to the same setup step and can share a single layer.",
+		Bad:       "RUN mkdir /data\nRUN chown app /data\nRUN chmod 700 /data",
+		Good:      "RUN mkdir /data && chown app /data && chmod 700 /data",
+	},
+	{
+		ID: "DIO011", Title: "No WORKDIR set", Severity: models.SeverityLow, Category: "best-practice", AutoFixable: true,
+		Rationale: "Without WORKDIR, files land in / and relative paths depend on the base image, which is fragile and hard to read.",
+		Good:      "WORKDIR /app",
+	},
+	{
+		ID: "DIO012", Title: "No HEALTHCHECK defined", Severity: models.SeverityInfo, Category: "best-practice", AutoFixable: true,
+		Rationale: "A HEALTHCHECK lets Docker and orchestrators detect a hung process and restart it instead of routing traffic to it. When the final stage exposes a port, the suggested check probes it over HTTP (at the framework's health endpoint, such as /actuator/health for Spring Boot) or TCP for database and broker ports, using curl, wget or the language runtime found in the image. Images without a shell, like scratch and distroless, get a static busybox copied in as the probe. Without an exposed port the check can't be auto-fixed.",
+		Good:      "EXPOSE 8080\nHEALTHCHECK --interval=30s --timeout=5s --start-period=15s --retries=3 CMD curl -fsS http://localhost:8080/ || exit 1",
+	},
+	{
+		ID: "DIO013", Title: "Heavy directory not excluded by .dockerignore", Severity: models.SeverityMedium, Category: "optimization",
+		Rationale: "A .dockerignore only helps if it covers what is actually in the context. Directories like node_modules, .git, dist and virtualenvs are large and slow down every build when they are sent to the daemon. The issue reports the measured size of each uncovered directory.",
+		Bad:       "# .dockerignore\n*.log",
+		Good:      "# .dockerignore\n*.log\nnode_modules\n.git\ndist",
+	},
+	{
+		ID: "DIO014", Title: "Binary linking doesn't match the runtime base image", Severity: models.SeverityHigh, Category: "base-image",
+		Rationale: "Go binaries built with cgo and Rust binaries built for a -gnu target are dynamically linked: they need the C library and loader they were built against. On scratch or distroless/static there is none, and a glibc binary on alpine (or a musl binary on Debian) finds the wrong one; either way the container fails to start with a misleading \"no such file or directory\". Static binaries, in turn, don't need distroless/base and can use distroless/static. dio run also reads the ELF headers of the built binaries to confirm the linking.",
+		Bad:       "FROM golang:1.22 AS build\nRUN go build -o /app .\n\nFROM scratch\nCOPY --from=build /app /app",
+		Good:      "FROM golang:1.22 AS build\nRUN CGO_ENABLED=0 go build -o /app .\n\nFROM scratch\nCOPY --from=build /app /app",
+	},
+	{
+		ID: "DIO015", Title: "No CA certificates for HTTPS", Severity: models.SeverityMedium, Category: "best-practice", AutoFixable: true,
+		Rationale: "scratch and the plain debian and ubuntu images have no CA certificate bundle, so every TLS connection fails with \"certificate signed by unknown authority\". The rule fires when the image evidently talks HTTPS — an https:// URL in ENV, CMD, ENTRYPOINT or HEALTHCHECK, or ca-certificates installed in a build stage that is never copied over. distroless, alpine and the official language images already include the bundle.",
+		Bad:       "FROM golang:1.22-alpine AS build\nRUN apk add ca-certificates && CGO_ENABLED=0 go build -o /app .\n\nFROM scratch\nCOPY --from=build /app /app",
+		Good:      "FROM scratch\nCOPY --from=gcr.io/distroless/static-debian12 /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/\nCOPY --from=build /app /app",
+	},
+	{
+		ID: "DIO016", Title: "No timezone data for TZ", Severity: models.SeverityMedium, Category: "best-practice", AutoFixable: true,
+		Rationale: "Setting TZ only works when the timezone database is in the image. scratch, alpine, debian and ubuntu don't include it, and applications silently fall back to UTC. Go binaries built with -tags timetzdata embed their own copy.",
+		Bad:       "FROM alpine:3.19\nENV TZ=Europe/Berlin",
+		Good:      "FROM alpine:3.19\nRUN apk add --no-cache tzdata\nENV TZ=Europe/Berlin",
+	},
+	{
+		ID: "DIO017", Title: "ENV instructions can be consolidated", Severity: models.SeverityLow, Category: "optimization", AutoFixable: true,
+		Rationale: "Each ENV is a build step and an entry in the image history. Values overwritten before anything uses them are noise, and constant ENVs after a COPY are rebuilt whenever the copied files change.",
+		Bad:       "COPY . .\nENV NODE_ENV=development\nENV NODE_ENV=production\nENV PORT=8080",
+		Good:      "ENV NODE_ENV=production \\\n    PORT=8080\nCOPY . .",
+	},
+	{
+		ID: "DIO018", Title: "Build-only packages in the final image", Severity: models.SeverityMedium, Category: "optimization", AutoFixable: true,
+		Rationale: "Compilers, build tools and -dev headers are only needed to build native extensions. Left in the final image they add tens to hundreds of megabytes and give attackers a toolchain.",
+		Bad:       "RUN apt-get install -y gcc python3-dev && pip install psycopg2",
+		Good:      "RUN apt-get install -y gcc python3-dev && pip install psycopg2 && \\\n    apt-get purge -y gcc python3-dev",
+	},
+	{
+		ID: "DIO019", Title: "Debugging tools in the final image", Severity: models.SeverityMedium, Category: "security",
+		Rationale: "Editors, debuggers, network tools, SSH servers, sudo and package managers let an attacker who gets into the container explore, pivot and escalate. curl and wget are allowed when a HEALTHCHECK or the container command uses them. Remote access and privilege escalation tools are reported as high severity.",
+		Bad:       "RUN apt-get install -y vim strace openssh-server sudo",
+		Good:      "# debug with kubectl debug or docker debug instead",
+	},
+	{
+		ID: "DIO020", Title: "Root regained after dropping privileges", Severity: models.SeverityLow, Category: "security",
+		Rationale: "Switching back to USER root after a non-root USER runs the following instructions as root again and is easy to leave in place. Doing the root work first keeps the privilege drop in one place; a final USER root is reported by DIO006.",
+		Bad:       "USER app\nCOPY . .\nUSER root\nRUN chown -R app /app\nUSER app",
+		Good:      "COPY --chown=app:app . .\nUSER app",
+	},
+	{
+		ID: "DIO021", Title: "Setuid or setgid bit set", Severity: models.SeverityMedium, Category: "security",
+		Rationale: "A setuid or setgid file runs with its owner's or group's privileges, so it turns any flaw in it into a privilege escalation. File capabilities grant only what the binary needs.",
+		Bad:       "RUN chmod u+s /usr/local/bin/ping",
+		Good:      "RUN setcap cap_net_raw+ep /usr/local/bin/ping",
+	},
+	{
+		ID: "DIO022", Title: "USER is not numeric", Severity: models.SeverityLow, Category: "security",
+		Rationale: "Kubernetes can only verify runAsNonRoot against a numeric UID. With a named USER, pods that set runAsNonRoot: true fail to start unless they also set runAsUser.",
+		Bad:       "USER appuser",
+		Good:      "USER 10001:10001",
+	},
+	{
+		ID: "DIO023", Title: "Unused build stage", Severity: models.SeverityLow, Category: "best-practice",
+		Rationale: "A stage that the final stage never reaches through FROM, COPY --from or RUN --mount=from is skipped by BuildKit and built for nothing by the legacy builder. An earlier stage with the same name as a later one is shadowed: references after the later one reach it instead. Reported as medium when shadowed.",
+		Bad:       "FROM golang:1.22 AS build\nRUN go build -o /app .\nFROM golang:1.23 AS build\nRUN go build -o /app .\nFROM alpine\nCOPY --from=build /app /app",
+		Good:      "FROM golang:1.23 AS build\nRUN go build -o /app .\nFROM alpine\nCOPY --from=build /app /app",
+	},
+	{
+		ID: "DIO024", Title: "COPY --from copies a whole stage filesystem", Severity: models.SeverityMedium, Category: "optimization",
+		Rationale: "Copying / from a build stage brings its base image, compilers, package caches and sources along, which undoes the multi-stage build. Reported as low when the copy doesn't reach the final image.",
+		Bad:       "COPY --from=builder / /",
+		Good:      "COPY --from=builder /out/app /usr/local/bin/app",
+	},
+	{
+		ID: "DIO025", Title: "CUDA -devel image in the final stage", Severity: models.SeverityHigh, Category: "optimization",
+		Rationale: "nvidia/cuda -devel images add nvcc, headers and static libraries, several GB more than the -runtime images, which have everything a CUDA application needs to run. Compile in a -devel build stage instead.",
+		Bad:       "FROM nvidia/cuda:12.4.1-cudnn-devel-ubuntu22.04\nCOPY . /app\nCMD [\"python3\", \"/app/serve.py\"]",
+		Good:      "FROM nvidia/cuda:12.4.1-cudnn-runtime-ubuntu22.04\nCOPY . /app\nCMD [\"python3\", \"/app/serve.py\"]",
+	},
+	{
+		ID: "DIO026", Title: "CUDA version not pinned", Severity: models.SeverityMedium, Category: "best-practice",
+		Rationale: "The CUDA and cuDNN versions must match what the frameworks were built against and what the host driver supports. nvidia/cuda tags without the full version, and CUDA, cuDNN, NCCL or TensorRT packages installed without one, change under the same name.",
+		Bad:       "RUN apt-get install -y libcudnn8",
+		Good:      "RUN apt-get install -y libcudnn8=8.9.7.29-1+cuda12.2",
+	},
+	{
+		ID: "DIO027", Title: "NVIDIA driver installed in the image", Severity: models.SeverityHigh, Category: "best-practice",
+		Rationale: "The NVIDIA Container Toolkit mounts the host's driver into the container. A driver installed in the image adds hundreds of MB to GBs, and breaks GPU access when it doesn't match the host's kernel module exactly.",
+		Bad:       "RUN apt-get install -y nvidia-driver-535",
+		Good:      "FROM nvidia/cuda:12.4.1-runtime-ubuntu22.04",
+	},
+	{
+		ID: "DIO028", Title: "ML stack installed with pip in the final stage", Severity: models.SeverityMedium, Category: "optimization",
+		Rationale: "PyTorch, TensorFlow, JAX and their CUDA wheels are GBs. Installed in the final stage, pip's cache and build leftovers stay in the image and every change reinstalls the stack. A virtual environment or wheels built in a separate stage, with a constraints file, keep the final image to what runs.",
+		Bad:       "FROM python:3.11-slim\nRUN pip install torch torchvision",
+		Good:      "FROM python:3.11-slim AS python-deps\nRUN python -m venv /opt/venv\nENV PATH=\"/opt/venv/bin:$PATH\"\nRUN pip install --no-cache-dir -c constraints.txt torch torchvision\n\nFROM python:3.11-slim\nCOPY --from=python-deps /opt/venv /opt/venv\nENV PATH=\"/opt/venv/bin:$PATH\"",
+	},
+	{
+		ID: "DIO029", Title: "Duplicate CUDA-enabled torch", Severity: models.SeverityHigh, Category: "optimization",
+		Rationale: "CUDA builds of torch bundle CUDA and cuDNN as nvidia-* wheels. On a CUDA base image, over a PyTorch base image, or installed twice in separate layers, the image carries GBs of the same libraries twice.",
+		Bad:       "FROM nvidia/cuda:12.1.1-cudnn8-runtime-ubuntu22.04\nRUN pip install torch",
+		Good:      "FROM python:3.11-slim\nRUN pip install --no-cache-dir torch",
+	},
+	{
+		ID: "DIO030", Title: "conda distribution in the final image", Severity: models.SeverityHigh, Category: "optimization",
+		Rationale: "Anaconda images ship hundreds of packages and several GB the application never imports; Miniconda and Miniforge still keep conda, its base environment and package cache next to the application's environment. Only the environment is needed at runtime.",
+		Bad:       "FROM continuumio/anaconda3:2024.02-1\nCOPY environment.yml .\nRUN conda env create -f environment.yml",
+		Good:      "FROM mambaorg/micromamba:1.5.10 AS conda-env\nCOPY --chown=$MAMBA_USER:$MAMBA_USER environment.yml /tmp/environment.yml\nRUN micromamba create -y -p /opt/conda/envs/app -f /tmp/environment.yml && \\\n    micromamba clean --all --yes\n\nFROM debian:bookworm-slim\nCOPY --from=conda-env /opt/conda/envs/app /opt/conda/envs/app\nENV PATH=\"/opt/conda/envs/app/bin:$PATH\"",
+	},
+	{
+		ID: "DIO031", Title: "conda package cache not cleaned", Severity: models.SeverityMedium, Category: "optimization",
+		Rationale: "conda keeps every downloaded package tarball and its extracted copy in /opt/conda/pkgs. Unless the same RUN cleans it, the cache is committed to the layer, often as large as the environment itself.",
+		Bad:       "RUN conda install -y numpy pandas",
+		Good:      "RUN conda install -y numpy pandas && \\\n    conda clean -afy",
+	},
+	{
+		ID: "DIO032", Title: "Full JDK in the final image", Severity: models.SeverityMedium, Category: "optimization",
+		Rationale: "A JDK carries the compiler, jlink, jdeps and every module of the platform, about 320 MB, and maven and gradle images add the build tool on top. An application needs a runtime with the modules it uses: built with jlink from what jdeps finds in the jar, that is typically 50 to 80 MB. The reported sizes are estimates from the modules a typical server or Spring Boot application needs.",
+		Bad:       "FROM eclipse-temurin:21-jdk\nCOPY --from=build /src/target/app.jar /app/app.jar\nENTRYPOINT [\"java\", \"-jar\", \"/app/app.jar\"]",
+		Good:      "FROM eclipse-temurin:21-jdk AS jre-build\nRUN jlink --add-modules java.base,java.logging,java.sql,jdk.crypto.ec \\\n      --strip-debug --no-man-pages --no-header-files --compress=zip-6 --output /tmp/jre\n\nFROM debian:bookworm-slim\nCOPY --from=jre-build /tmp/jre /opt/java/openjdk\nCOPY --from=build /src/target/app.jar /app/app.jar\nENTRYPOINT [\"/opt/java/openjdk/bin/java\", \"-jar\", \"/app/app.jar\"]",
+	},
+	{
+		ID: "DIO033", Title: "node_modules in a static front-end image", Severity: models.SeverityHigh, Category: "optimization",
+		Rationale: "A front-end build needs node_modules and Node.js, the site it produces doesn't. Serving the build with serve or http-server from the image that built it, or copying the whole project into nginx, ships hundreds of MB of build tooling and sources to serve a directory of files. Medium when node_modules are copied from a build stage, high when the final stage builds the front-end itself.",
+		Bad:       "FROM node:20\nCOPY . .\nRUN npm ci && npm run build\nCMD [\"npx\", \"serve\", \"-s\", \"dist\"]",
+		Good:      "FROM node:20 AS frontend-build\nCOPY . .\nRUN npm ci && npm run build\n\nFROM nginxinc/nginx-unprivileged:1.27-alpine\nCOPY --from=frontend-build /dist /usr/share/nginx/html",
+	},
+	{
+		ID: "DIO034", Title: "Source maps shipped with the front-end build", Severity: models.SeverityLow, Category: "security",
+		Rationale: "Source maps let anyone who can fetch the bundles read the original sources, comments included, and are often as large as the bundles. The rule fires for builds that evidently write them — Create React App, whose output is build/, or --source-map options — unless GENERATE_SOURCEMAP=false is set or the maps are deleted.",
+		Bad:       "RUN npm run build",
+		Good:      "ENV GENERATE_SOURCEMAP=false\nRUN npm run build",
+	},
+	{
+		ID: "DIO035", Title: "Base image is not a golden image", Severity: models.SeverityMedium, Category: "best-practice",
+		Rationale: "Golden images are the base images an organization maintains, patches and scans itself, with the runtimes its applications need. Final images built on public images miss those patches and the support around them. The rule only runs with a catalog under golden_images in .dio.yaml, and suggests the golden image for the runtime the Dockerfile uses; golden images with a tag the catalog doesn't list are reported too.",
+		Bad:       "FROM node:20-alpine\nCOPY . /app\nCMD [\"node\", \"/app/server.js\"]",
+		Good:      "FROM registry.corp/golden/node:20\nCOPY . /app\nCMD [\"node\", \"/app/server.js\"]",
+	},
+	{
+		ID: "DIO036", Title: "Secret in the Dockerfile", Severity: models.SeverityHigh, Category: "security",
+		Rationale: "ENV and ARG values are kept in the image config and history, and the Dockerfile itself is usually in version control, so a password or token written into it is readable by everyone who can pull the image or clone the repository. Files such as SSH keys or .npmrc copied into the final image stay in their layer even when a later one deletes them. The rule flags variables named like secrets (PASSWORD, TOKEN, API_KEY, SECRET_ACCESS_KEY, ...) set to literal values, and credential files copied into the final stage.",
+		Bad:       "ENV NPM_TOKEN=npm_abc123\nRUN npm ci",
+		Good:      "RUN --mount=type=secret,id=npm_token \\\n    NPM_TOKEN=$(cat /run/secrets/npm_token) npm ci",
+	},
+	{
+		ID: "DIO037", Title: "Parser directive problem", Severity: models.SeverityLow, Category: "best-practice",
+		Rationale: "The syntax directive selects the Dockerfile frontend, and with it the syntax the file may use: RUN --mount needs docker/dockerfile 1.2, heredocs and COPY --link 1.4, the check directive 1.8. Without it, the build depends on the frontend built into the builder, which may be older; pinned to an old release, newer syntax fails to parse. Directives only count at the very top of the file: after a blank line, comment or instruction they are plain comments, and a repeated one fails the build. Reported as medium when the build fails.",
+		Bad:       "# syntax=docker/dockerfile:1.2\nFROM alpine:3.19\nCOPY --link app /app",
+		Good:      "# syntax=docker/dockerfile:1\nFROM alpine:3.19\nCOPY --link app /app",
+	},
+	{
+		ID: "DIO038", Title: "RUN can fail without failing the build", Severity: models.SeverityMedium, Category: "best-practice",
+		Rationale: "A shell reports the exit status of the last command it ran. In a pipeline that is the last command of the pipe, so a curl that fails to download feeds nothing to tar or sh and the RUN still succeeds; in a heredoc script or a list of commands separated by ; it is the last line. The image builds without what the step should have installed, and the failure shows up at runtime. pipefail and set -e make the shell fail on the first error. POSIX sh has no pipefail: on Debian-based images switch to bash with SHELL, on Alpine busybox sh supports set -o pipefail.",
+		Bad:       "FROM debian:bookworm-slim\nRUN curl -fsSL https://example.com/tool.tar.gz | tar -xz -C /usr/local/bin",
+		Good:      "FROM debian:bookworm-slim\nSHELL [\"/bin/bash\", \"-o\", \"pipefail\", \"-c\"]\nRUN curl -fsSL https://example.com/tool.tar.gz | tar -xz -C /usr/local/bin",
+	},
+	{
+		ID: "DIO039", Title: "Cache-busting pattern", Severity: models.SeverityLow, Category: "optimization",
+		Rationale: "Some patterns defeat the layer cache. Every RUN after an ARG misses the cache when its value changes, so an ARG CACHEBUST declared early rebuilds far more than the step meant to re-run. An ADD of a latest or nightly URL downloads whatever is current under the same instruction. A RUN git clone of a branch stays cached at the commit it first saw and ships stale code, an ADD of a branch rebuilds whenever it moves. Reported as reproducibility for clones of branches; an apt-get update split from its install is DIO040.",
+		Bad:       "FROM debian:bookworm-slim\nARG CACHEBUST=1\nRUN apt-get update && apt-get install -y --no-install-recommends git && rm -rf /var/lib/apt/lists/*\nRUN echo $CACHEBUST && git clone https://github.com/org/repo.git /src",
+		Good:      "FROM debian:bookworm-slim\nRUN apt-get update && apt-get install -y --no-install-recommends git && rm -rf /var/lib/apt/lists/*\nADD https://github.com/org/repo.git#v1.2.3 /src",
+	},
+	{
+		ID: "DIO040", Title: "apt-get install split from its apt-get update", Severity: models.SeverityMedium, Category: "best-practice",
+		Rationale: "The package lists apt-get update downloads are cached with the layer of its RUN. An install in a later RUN uses them whatever their age: rebuilds install outdated packages from the cache, and fail with 404s once the mirrors have dropped them. Updating, installing and removing the lists in one RUN keeps them current and out of the image. Installs with a cache mount on /var/lib/apt/lists are not reported.",
+		Bad:       "FROM debian:bookworm-slim\nRUN apt-get update\nRUN apt-get install -y --no-install-recommends curl",
+		Good:      "FROM debian:bookworm-slim\nRUN apt-get update && apt-get install -y --no-install-recommends curl && rm -rf /var/lib/apt/lists/*",
+	},
+	{
+		ID: "DIO041", Title: "chown -R or chmod -R of copied files", Severity: models.SeverityMedium, Category: "optimization",
+		Rationale: "Layers store whole files: changing the owner or mode of a file copies it into the layer of the RUN, so a chown -R after a COPY ships the copied files twice. COPY --chown and --chmod set them as the files are copied. The directory the files land in keeps the owner it had, so a non-recursive chown of it may still be needed. dio run finds the duplicated files in the built image and reports their size.",
+		Bad:       "FROM node:20-slim\nWORKDIR /app\nCOPY . .\nRUN chown -R node:node /app",
+		Good:      "FROM node:20-slim\nWORKDIR /app\nCOPY --chown=node:node . .\nRUN chown node:node /app",
+	},
+	{
+		ID: "DIO042", Title: "Image has no CMD or ENTRYPOINT", Severity: models.SeverityMedium, Category: "best-practice", Scope: ScopeImage,
+		Rationale: "Checked in the config of the built image, which includes what the base image sets. Without a command, docker run fails unless one is given on its command line, and orchestrators can't start the image.",
+		Bad:       "FROM scratch\nCOPY app /app",
+		Good:      "FROM scratch\nCOPY app /app\nENTRYPOINT [\"/app\"]",
+	},
+	{
+		ID: "DIO043", Title: "Container defaults to a shell", Severity: models.SeverityMedium, Category: "best-practice", Scope: ScopeImage,
+		Rationale: "Checked in the config of the built image. Base images such as debian, ubuntu and alpine run a shell by default. An image that keeps it runs a shell that exits at once without a terminal instead of the application.",
+		Bad:       "FROM debian:bookworm-slim\nCOPY app /usr/local/bin/app",
+		Good:      "FROM debian:bookworm-slim\nCOPY app /usr/local/bin/app\nCMD [\"app\"]",
+	},
+	{
+		ID: "DIO044", Title: "ENV persists a build arg", Severity: models.SeverityLow, Category: "security", Scope: ScopeImage,
+		Rationale: "Build args only exist during the build, but an ENV set from one stores the value in the image config, where docker inspect shows it and every container gets it. Checked against the environment of the built image; high severity when the name looks like a secret.",
+		Bad:       "ARG NPM_TOKEN\nENV NPM_TOKEN=$NPM_TOKEN\nRUN npm ci",
+		Good:      "RUN --mount=type=secret,id=npm_token NPM_TOKEN=$(cat /run/secrets/npm_token) npm ci",
+	},
+	{
+		ID: "DIO045", Title: "World-writable WORKDIR", Severity: models.SeverityMedium, Category: "security", Scope: ScopeImage,
+		Rationale: "Checked in the filesystem of the built image. Any user in the container can write to a world-writable working directory, and replace the code or configuration the application loads from it.",
+		Bad:       "WORKDIR /app\nCOPY . .\nRUN chmod -R 777 /app",
+		Good:      "WORKDIR /app\nCOPY --chown=app:app . .\nUSER app",
+	},
+	{
+		ID: "DIO046", Title: "Invalid size budget", Severity: models.SeverityMedium, Category: "best-practice",
+		Rationale: "A # dio:budget comment declares the size and layer count the image built from the Dockerfile may reach, and the policy enforces it as budget_size and budget_layers. A budget with an unknown option or a value that doesn't parse is ignored rather than guessed at, so the image is no longer held to it; only the first budget comment counts.",
+		Bad:       "# dio:budget size=150 megs layers=12\nFROM node:20-slim",
+		Good:      "# dio:budget size=150MB layers=12\nFROM node:20-slim",
+	},
+}
+
+// RuleDocs returns documentation for every built-in rule, sorted by ID.
+func RuleDocs() []RuleDoc {
+	docs := make([]RuleDoc, 0, len(defaultRuleDocs)+len(extendedRuleDefs))
+	scopes := make(map[string]RuleScope)
+	for _, r := range DefaultRules() {
+		scopes[r.ID()] = ScopeOf(r)
+	}
+	for _, d := range defaultRuleDocs {
+		d.Ruleset = RulesetDefault
+		if scope, ok := scopes[d.ID]; ok {
+			d.Scope = scope
+		}
+		d.URL = DocsURL(d.ID)
+		docs = append(docs, d)
+	}
+	for _, r := range extendedRuleDefs {
+		docs = append(docs, RuleDoc{
+			ID:        r.id,
+			Title:     r.title,
+			Severity:  mapHadolintLevel(r.level),
+			Category:  r.category,
+			Ruleset:   RulesetExtended,
+			Scope:     ScopeAllStages,
+			Rationale: r.description + " " + r.suggestion,
+			URL:       DocsURL(r.id),
+		})
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	return docs
+}
+
+// LookupRuleDoc returns the documentation for a rule ID. Suffixed IDs such as
+// DIO005-pip and hadolint IDs such as HL-DL3008 resolve to their base rule.
+func LookupRuleDoc(id string) (RuleDoc, bool) {
+	base := baseRuleID(id)
+	for _, d := range RuleDocs() {
+		if d.ID == base {
+			return d, true
+		}
+	}
+	return RuleDoc{}, false
+}
+
+// DocsURL returns the documentation URL for a rule ID.
+func DocsURL(id string) string {
+	base := baseRuleID(id)
+	if strings.HasPrefix(base, "DL") {
+		return hadolintDocURL + base
+	}
+	if strings.HasPrefix(base, "SC") {
+		return shellcheckDocURL + base
+	}
+	if strings.HasPrefix(base, "DIO") {
+		return rulesDocURL + "#" + strings.ToLower(base)
+	}
+	return ""
+}
+
+// baseRuleID strips tool prefixes and variant suffixes from an issue ID.
+func baseRuleID(id string) string {
+	id = strings.TrimPrefix(strings.ToUpper(id), "HL-")
+	if idx := strings.Index(id, "-"); idx != -1 {
+		id = id[:idx]
+	}
+	return id
+}
+
+// attachDocsURLs fills in the documentation link of every issue.
+func attachDocsURLs(issues []models.Issue) {
+	for i := range issues {
+		if issues[i].DocsURL == "" {
+			issues[i].DocsURL = DocsURL(issues[i].ID)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// EnvVar is a variable set by an ENV instruction.
+type EnvVar struct {
+	Key string
+	// Value is the value as written, with its quotes. Values of the legacy
+	// "ENV KEY value" form are quoted when they contain spaces, so the
+	// variable can always be written as Key=Value.
+	Value string
+}
+
+func (v EnvVar) String() string { return v.Key + "=" + v.Value }
+
+// ParseEnv parses the arguments of an ENV instruction, in the KEY=value
+// form or the legacy KEY value form.
+func ParseEnv(args string) []EnvVar {
+	args = strings.TrimSpace(args)
+	tokens := envTokens(args)
+	if len(tokens) == 0 {
+		return nil
+	}
+	if !strings.Contains(tokens[0], "=") {
+		// ENV KEY value with spaces
+		key := tokens[0]
+		value := strings.TrimSpace(strings.TrimPrefix(args, key))
+		if strings.ContainsAny(value, " \t") && !strings.HasPrefix(value, `"`) {
+			value = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+		}
+		return []EnvVar{{Key: key, Value: value}}
+	}
+	var vars []EnvVar
+	for _, token := range tokens {
+		key, value, _ := strings.Cut(token, "=")
+		vars = append(vars, EnvVar{Key: key, Value: value})
+	}
+	return vars
+}
+
+// envTokens splits ENV arguments on whitespace outside quotes.
+func envTokens(args string) []string {
+	var tokens []string
+	var cur strings.Builder
+	var quote rune
+	escaped := false
+	for _, r := range args {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ' ' || r == '\t':
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+// referencesVar reports whether s expands the variable key, as $key or
+// ${key...}.
+func referencesVar(s, key string) bool {
+	return regexp.MustCompile(`\$\{?` + regexp.QuoteMeta(key) + `\b`).MatchString(s)
+}
+
+// setsEnv reports whether the ENV instruction sets key.
+func setsEnv(inst Instruction, key string) bool {
+	for _, v := range ParseEnv(inst.Args) {
+		if v.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// OverwrittenEnv is an ENV variable set again later in its stage before
+// anything can use it.
+type OverwrittenEnv struct {
+	Index int // of the ENV instruction in the stage
+	Key   string
+	By    int // line of the ENV overwriting it
+}
+
+// OverwrittenEnvVars returns the ENV variables of the stage that a later ENV
+// overwrites with no RUN or reference to the variable in between, so the
+// first value is never used.
+func OverwrittenEnvVars(stage Stage) []OverwrittenEnv {
+	var found []OverwrittenEnv
+	insts := stage.Instructions
+	for i, inst := range insts {
+		if inst.Command != "ENV" {
+			continue
+		}
+	vars:
+		for _, v := range ParseEnv(inst.Args) {
+			for j := i + 1; j < len(insts); j++ {
+				next := insts[j]
+				if next.Command == "RUN" || next.Command == "ONBUILD" || referencesVar(next.Args, v.Key) {
+					continue vars
+				}
+				if next.Command == "ENV" && setsEnv(next, v.Key) {
+					found = append(found, OverwrittenEnv{Index: i, Key: v.Key, By: next.Line})
+					continue vars
+				}
+			}
+		}
+	}
+	return found
+}
+
+// HoistedEnv is an ENV instruction that can move above the COPY and ADD
+// instructions right before it.
+type HoistedEnv struct {
+	Index  int // of the ENV instruction in the stage
+	Before int // index of the first COPY or ADD it moves above
+}
+
+// HoistableEnv returns the ENV instructions of the stage that can move
+// above the COPY and ADD instructions right before them. Only ENVs with
+// constant values that nothing they pass refers to are moved, so the move
+// doesn't change any value, and the ENV steps stay cached when the copied
+// files change.
+func HoistableEnv(stage Stage) []HoistedEnv {
+	var hoist []HoistedEnv
+	insts := stage.Instructions
+	for i, inst := range insts {
+		if inst.Command != "ENV" || strings.Contains(inst.Args, "$") {
+			continue
+		}
+		// Walk back over the COPY and ADD (and other ENV) instructions
+		first := -1
+		for j := i - 1; j >= 0; j-- {
+			switch insts[j].Command {
+			case "COPY", "ADD":
+				first = j
+				continue
+			case "ENV":
+				continue
+			}
+			break
+		}
+		if first < 0 {
+			continue
+		}
+		vars := ParseEnv(inst.Args)
+		movable := true
+		for j := first; j < i && movable; j++ {
+			for _, v := range vars {
+				if referencesVar(insts[j].Args, v.Key) || (insts[j].Command == "ENV" && setsEnv(insts[j], v.Key)) {
+					movable = false
+					break
+				}
+			}
+		}
+		if movable {
+			hoist = append(hoist, HoistedEnv{Index: i, Before: first})
+		}
+	}
+	return hoist
+}
+
+// EnvRuns returns the runs of consecutive ENV instructions in the stage
+// that can be merged into one, as the indexes of their first and last
+// instruction. A run ends before an ENV that refers to a variable set in
+// the run, since within one ENV instruction references see the values from
+// before it.
+func EnvRuns(stage Stage) [][2]int {
+	var runs [][2]int
+	insts := stage.Instructions
+	start := -1
+	var keys []string
+	flush := func(end int) {
+		if start >= 0 && end > start {
+			runs = append(runs, [2]int{start, end})
+		}
+		start, keys = -1, nil
+	}
+	for i, inst := range insts {
+		if inst.Command != "ENV" {
+			flush(i - 1)
+			continue
+		}
+		for _, key := range keys {
+			if referencesVar(inst.Args, key) {
+				flush(i - 1)
+				break
+			}
+		}
+		if start < 0 {
+			start = i
+		}
+		for _, v := range ParseEnv(inst.Args) {
+			keys = append(keys, v.Key)
+		}
+	}
+	flush(len(insts) - 1)
+	return runs
+}
+
+// --- EnvConsolidationRule ---
+
+type EnvConsolidationRule struct{}
+
+func (r *EnvConsolidationRule) ID() string { return "DIO017" }
+
+func (r *EnvConsolidationRule) Check(ctx *AnalysisContext) []models.Issue {
+	var issues []models.Issue
+	issue := func(line int, title, description, suggestion string) {
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityLow,
+			Category:    "optimization",
+			Title:       title,
+			Description: description,
+			Line:        line,
+			Suggestion:  suggestion,
+			AutoFixable: true,
+		})
+	}
+	for _, stage := range ctx.ParsedFile.Stages {
+		insts := stage.Instructions
+		for _, o := range OverwrittenEnvVars(stage) {
+			issue(insts[o.Index].Line, "ENV overwritten before use",
+				fmt.Sprintf("%s is set again on line %d before anything uses it.", o.Key, o.By),
+				fmt.Sprintf("Remove %s from this ENV.", o.Key))
+		}
+		for _, h := range HoistableEnv(stage) {
+			issue(insts[h.Index].Line, "ENV after COPY",
+				fmt.Sprintf("This ENV follows the COPY or ADD on line %d, so it is rebuilt whenever the copied files change.", insts[h.Before].Line),
+				"Move constant ENV instructions above the COPY and ADD instructions.")
+		}
+		for _, run := range EnvRuns(stage) {
+			issue(insts[run[0]].Line, "Consecutive ENV instructions",
+				fmt.Sprintf("%d consecutive ENV instructions each add a build step and an entry to the image history.", run[1]-run[0]+1),
+				"Set the variables in a single ENV instruction.")
+		}
+	}
+	return issues
+}
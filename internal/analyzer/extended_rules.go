@@ -0,0 +1,618 @@
+package analyzer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Ruleset names accepted by the analyzer.
+const (
+	RulesetDefault  = "default"
+	RulesetExtended = "extended"
+)
+
+// ExtendedRules returns native ports of the most valuable hadolint checks.
+// They keep the hadolint rule codes as IDs so findings line up with hadolint
+// documentation, and they are only enabled with the "extended" ruleset.
+func ExtendedRules() []Rule {
+	rules := make([]Rule, 0, len(extendedRuleDefs))
+	for i := range extendedRuleDefs {
+		rules = append(rules, &extendedRuleDefs[i])
+	}
+	return rules
+}
+
+// isExtendedRule reports whether id is the ID of an extended rule.
+func isExtendedRule(id string) bool {
+	for i := range extendedRuleDefs {
+		if extendedRuleDefs[i].id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// extendedRule is a table-driven rule. The check function returns the lines
+// of the offending instructions.
+type extendedRule struct {
+	id          string
+	level       string // hadolint level: error, warning, info, style
+	category    string
+	title       string
+	description string
+	suggestion  string
+	check       func(ctx *AnalysisContext) []int
+}
+
+func (r *extendedRule) ID() string { return r.id }
+
+func (r *extendedRule) Check(ctx *AnalysisContext) []models.Issue {
+	var issues []models.Issue
+	for _, line := range r.check(ctx) {
+		issues = append(issues, models.Issue{
+			ID:          r.id,
+			Severity:    mapHadolintLevel(r.level),
+			Category:    r.category,
+			Title:       r.title,
+			Description: r.description,
+			Line:        line,
+			Suggestion:  r.suggestion,
+			AutoFixable: false,
+		})
+	}
+	return issues
+}
+
+// extendedOverlaps maps extended rules to default rules reporting the same
+// problem, so enabling the extended ruleset doesn't double-count a finding.
+var extendedOverlaps = map[string]string{
+	"DL3002": "DIO006",
+	"DL3019": "DIO005",
+	"DL3032": "DIO005",
+	"DL3036": "DIO005",
+	"DL3040": "DIO005",
+	"DL3042": "DIO005-pip",
+	"DL4006": "DIO038",
+}
+
+// dropOverlappingExtendedIssues removes extended findings already reported
+// by an equivalent default rule on the same line.
+func dropOverlappingExtendedIssues(issues []models.Issue) []models.Issue {
+	covered := make(map[string]bool)
+	for _, issue := range issues {
+		covered[issue.ID+":"+strconv.Itoa(issue.Line)] = true
+	}
+
+	var result []models.Issue
+	for _, issue := range issues {
+		if dioID, ok := extendedOverlaps[issue.ID]; ok && covered[dioID+":"+strconv.Itoa(issue.Line)] {
+			continue
+		}
+		result = append(result, issue)
+	}
+	return result
+}
+
+var extendedRuleDefs = []extendedRule{
+	{
+		id: "DL3000", level: "error", category: "best-practice",
+		title:       "Use absolute WORKDIR",
+		description: "Relative WORKDIR paths depend on the previous WORKDIR and are easy to get wrong.",
+		suggestion:  "Use an absolute path, e.g., WORKDIR /app",
+		check: matchInstructions("WORKDIR", func(inst Instruction) bool {
+			dir := strings.Trim(strings.TrimSpace(inst.Args), `"'`)
+			return !strings.HasPrefix(dir, "/") && !strings.HasPrefix(dir, "$") && !windowsPathRegex.MatchString(dir)
+		}),
+	},
+	{
+		id: "DL3001", level: "info", category: "best-practice",
+		title:       "Command makes no sense in a container",
+		description: "Commands like ssh, vim, shutdown, service, ps, free, top, kill, mount and ifconfig have no use in a Dockerfile RUN.",
+		suggestion:  "Remove interactive or system-management commands from RUN instructions.",
+		check:       matchRun(shellCommandRegex(`ssh|vim|shutdown|service|ps|free|top|kill|mount|ifconfig`)),
+	},
+	{
+		id: "DL3002", level: "warning", category: "security",
+		title:       "Last USER should not be root",
+		description: "The final stage switches to root last, so the container runs with root privileges.",
+		suggestion:  "Switch back to a non-root user after privileged steps.",
+		check: func(ctx *AnalysisContext) []int {
+			stage := finalStage(ctx)
+			if stage == nil {
+				return nil
+			}
+			var last *Instruction
+			for i := range stage.Instructions {
+				if stage.Instructions[i].Command == "USER" {
+					last = &stage.Instructions[i]
+				}
+			}
+			if last != nil && IsRootUser(last.Args) {
+				return []int{last.Line}
+			}
+			return nil
+		},
+	},
+	{
+		id: "DL3003", level: "warning", category: "best-practice",
+		title:       "Use WORKDIR to switch to a directory",
+		description: "Using cd inside RUN only affects that layer and hides the working directory from readers.",
+		suggestion:  "Use WORKDIR instead of cd.",
+		check:       matchRun(shellCommandRegex(`cd`)),
+	},
+	{
+		id: "DL3004", level: "error", category: "security",
+		title:       "Do not use sudo",
+		description: "sudo has unpredictable TTY and signal-forwarding behavior in containers.",
+		suggestion:  "Run privileged steps as root before switching USER, or use gosu.",
+		check:       matchRun(shellCommandRegex(`sudo`)),
+	},
+	{
+		id: "DL3005", level: "error", category: "reproducibility",
+		title:       "Do not use apt-get upgrade or dist-upgrade",
+		description: "Upgrading all packages makes builds non-reproducible; update the base image instead.",
+		suggestion:  "Pin a newer base image tag instead of upgrading packages in place.",
+		check:       matchRun(regexp.MustCompile(`apt-get\s+(-\S+\s+)*(dist-)?upgrade`)),
+	},
+	{
+		id: "DL3011", level: "error", category: "best-practice",
+		title:       "Valid UNIX ports range from 0 to 65535",
+		description: "EXPOSE references a port outside the valid range.",
+		suggestion:  "Expose a port between 0 and 65535.",
+		check: matchInstructions("EXPOSE", func(inst Instruction) bool {
+			for _, p := range strings.Fields(inst.Args) {
+				p = strings.SplitN(p, "/", 2)[0]
+				if strings.Contains(p, "$") {
+					continue
+				}
+				for _, part := range strings.SplitN(p, "-", 2) {
+					if n, err := strconv.Atoi(part); err == nil && n > 65535 {
+						return true
+					}
+				}
+			}
+			return false
+		}),
+	},
+	{
+		id: "DL3012", level: "error", category: "best-practice",
+		title:       "Multiple HEALTHCHECK instructions",
+		description: "Only the last HEALTHCHECK in a stage takes effect.",
+		suggestion:  "Keep a single HEALTHCHECK per stage.",
+		check:       duplicateInStage("HEALTHCHECK"),
+	},
+	{
+		id: "DL3014", level: "warning", category: "best-practice",
+		title:       "Use the -y switch with apt-get install",
+		description: "apt-get install without -y waits for confirmation and fails in non-interactive builds.",
+		suggestion:  "Add -y to apt-get install.",
+		check:       matchRunMissing(regexp.MustCompile(`apt-get\s+(\S+\s+)*install`), regexp.MustCompile(`(\s-\w*y|--yes|--assume-yes|\s-qq)`)),
+	},
+	{
+		id: "DL3019", level: "info", category: "optimization",
+		title:       "Use --no-cache with apk add",
+		description: "apk add without --no-cache leaves the package index in the layer.",
+		suggestion:  "Use apk add --no-cache.",
+		check:       matchRunUncached(regexp.MustCompile(`apk\s+(\S+\s+)*add`), regexp.MustCompile(`--no-cache`), "/var/cache/apk"),
+	},
+	{
+		id: "DL3020", level: "error", category: "best-practice",
+		title:       "Use COPY instead of ADD for files and folders",
+		description: "ADD has implicit URL-download and archive-extraction behavior; COPY is explicit.",
+		suggestion:  "Replace ADD with COPY unless extracting a local archive.",
+		check: matchInstructions("ADD", func(inst Instruction) bool {
+			srcs := copySources(inst.Args)
+			for _, src := range srcs {
+				if strings.Contains(src, "://") || archiveRegex.MatchString(src) {
+					return false
+				}
+			}
+			return len(srcs) > 0
+		}),
+	},
+	{
+		id: "DL3021", level: "error", category: "best-practice",
+		title:       "COPY with more than 2 arguments requires the last argument to end with /",
+		description: "When copying multiple sources the destination must be a directory.",
+		suggestion:  "Add a trailing / to the COPY destination.",
+		check: matchInstructions("COPY", func(inst Instruction) bool {
+			args := nonFlagArgs(inst.Args)
+			return len(args) > 2 && !strings.HasSuffix(args[len(args)-1], "/")
+		}),
+	},
+	{
+		id: "DL3022", level: "warning", category: "best-practice",
+		title:       "COPY --from should reference a previously defined FROM alias",
+		description: "COPY --from references a stage that was not defined earlier in the Dockerfile.",
+		suggestion:  "Define the stage with FROM ... AS <name> before copying from it.",
+		check: func(ctx *AnalysisContext) []int {
+			var lines []int
+			seen := make(map[string]bool)
+			for i, stage := range ctx.ParsedFile.Stages {
+				for _, inst := range stage.Instructions {
+					from := copyFromFlag(inst)
+					if from == "" || seen[strings.ToLower(from)] || isExternalImageRef(from) {
+						continue
+					}
+					if n, err := strconv.Atoi(from); err == nil && n < i {
+						continue
+					}
+					lines = append(lines, inst.Line)
+				}
+				if stage.Name != "" {
+					seen[strings.ToLower(stage.Name)] = true
+				}
+			}
+			return lines
+		},
+	},
+	{
+		id: "DL3023", level: "error", category: "best-practice",
+		title:       "COPY --from cannot reference its own FROM alias",
+		description: "A stage cannot copy from itself.",
+		suggestion:  "Reference an earlier stage in COPY --from.",
+		check: func(ctx *AnalysisContext) []int {
+			var lines []int
+			for _, stage := range ctx.ParsedFile.Stages {
+				for _, inst := range stage.Instructions {
+					if from := copyFromFlag(inst); from != "" && stage.Name != "" && strings.EqualFold(from, stage.Name) {
+						lines = append(lines, inst.Line)
+					}
+				}
+			}
+			return lines
+		},
+	},
+	{
+		id: "DL3024", level: "error", category: "best-practice",
+		title:       "FROM aliases must be unique",
+		description: "Two stages share the same alias, so COPY --from references are ambiguous.",
+		suggestion:  "Give every stage a unique name.",
+		check: func(ctx *AnalysisContext) []int {
+			var lines []int
+			seen := make(map[string]bool)
+			for _, stage := range ctx.ParsedFile.Stages {
+				name := strings.ToLower(stage.Name)
+				if name == "" {
+					continue
+				}
+				if seen[name] {
+					lines = append(lines, stage.StartLine)
+				}
+				seen[name] = true
+			}
+			return lines
+		},
+	},
+	{
+		id: "DL3025", level: "warning", category: "best-practice",
+		title:       "Use JSON notation for CMD and ENTRYPOINT",
+		description: "Shell form runs the process under /bin/sh -c, which does not forward signals.",
+		suggestion:  `Use exec form, e.g., CMD ["node", "index.js"]`,
+		check: func(ctx *AnalysisContext) []int {
+			var lines []int
+			for _, inst := range ctx.ParsedFile.Instructions {
+				if (inst.Command == "CMD" || inst.Command == "ENTRYPOINT") && !isExecForm(inst.Args) {
+					lines = append(lines, inst.Line)
+				}
+			}
+			return lines
+		},
+	},
+	{
+		id: "DL3027", level: "warning", category: "best-practice",
+		title:       "Do not use apt, use apt-get",
+		description: "apt is meant for interactive use and its CLI is not stable for scripts.",
+		suggestion:  "Replace apt with apt-get or apt-cache.",
+		check:       matchRun(shellCommandRegex(`apt`)),
+	},
+	{
+		id: "DL3029", level: "warning", category: "reproducibility",
+		title:       "Do not use --platform with FROM",
+		description: "Hardcoding --platform prevents multi-platform builds.",
+		suggestion:  "Pass the platform at build time or use $BUILDPLATFORM.",
+		check: matchInstructions("FROM", func(inst Instruction) bool {
+			return strings.Contains(inst.Args, "--platform") && !strings.Contains(inst.Args, "$")
+		}),
+	},
+	{
+		id: "DL3030", level: "warning", category: "best-practice",
+		title:       "Use the -y switch with yum install",
+		description: "yum install without -y waits for confirmation and fails in non-interactive builds.",
+		suggestion:  "Add -y to yum install.",
+		check:       matchRunMissing(regexp.MustCompile(`yum\s+(\S+\s+)*install`), regexp.MustCompile(`(\s-\w*y|--assumeyes)`)),
+	},
+	{
+		id: "DL3032", level: "warning", category: "optimization",
+		title:       "yum clean all missing after yum install",
+		description: "yum caches are left in the layer.",
+		suggestion:  "Add '&& yum clean all' to the same RUN command.",
+		check:       matchRunMissing(regexp.MustCompile(`yum\s+(\S+\s+)*install`), regexp.MustCompile(`yum\s+clean\s+all|rm\s+-rf\s+/var/cache/yum`)),
+	},
+	{
+		id: "DL3034", level: "warning", category: "best-practice",
+		title:       "Non-interactive switch missing from zypper command",
+		description: "zypper waits for confirmation unless -n/--non-interactive or -y is used.",
+		suggestion:  "Use zypper --non-interactive install -y.",
+		check:       matchRunMissing(regexp.MustCompile(`zypper\s+(\S+\s+)*(install|in|remove|rm|update|up)\s`), regexp.MustCompile(`(\s-n\s|--non-interactive|\s-y|--no-confirm)`)),
+	},
+	{
+		id: "DL3036", level: "warning", category: "optimization",
+		title:       "zypper clean missing after zypper install",
+		description: "zypper caches are left in the layer.",
+		suggestion:  "Add '&& zypper clean' to the same RUN command.",
+		check:       matchRunMissing(regexp.MustCompile(`zypper\s+(\S+\s+)*(install|in)\s`), regexp.MustCompile(`zypper\s+(\S+\s+)*(clean|cc)`)),
+	},
+	{
+		id: "DL3038", level: "warning", category: "best-practice",
+		title:       "Use the -y switch with dnf install",
+		description: "dnf install without -y waits for confirmation and fails in non-interactive builds.",
+		suggestion:  "Add -y to dnf install.",
+		check:       matchRunMissing(regexp.MustCompile(`(dnf|microdnf)\s+(\S+\s+)*install`), regexp.MustCompile(`(\s-\w*y|--assumeyes)`)),
+	},
+	{
+		id: "DL3040", level: "warning", category: "optimization",
+		title:       "dnf clean all missing after dnf install",
+		description: "dnf caches are left in the layer.",
+		suggestion:  "Add '&& dnf clean all' to the same RUN command.",
+		check:       matchRunUncached(regexp.MustCompile(`(dnf|microdnf)\s+(\S+\s+)*install`), regexp.MustCompile(`dnf\s+clean\s+all|rm\s+-rf\s+/var/cache/(yum|dnf)`), "/var/cache/dnf"),
+	},
+	{
+		id: "DL3042", level: "warning", category: "optimization",
+		title:       "Avoid the pip cache with pip install --no-cache-dir",
+		description: "pip keeps downloaded wheels in the layer unless caching is disabled.",
+		suggestion:  "Add --no-cache-dir or set ENV PIP_NO_CACHE_DIR=1.",
+		check: func(ctx *AnalysisContext) []int {
+			for _, inst := range ctx.ParsedFile.Instructions {
+				if inst.Command == "ENV" && strings.Contains(inst.Args, "PIP_NO_CACHE_DIR") {
+					return nil
+				}
+			}
+			return matchRunUncached(regexp.MustCompile(`pip3?\s+(\S+\s+)*install`), regexp.MustCompile(`--no-cache-dir`), "/root/.cache/pip")(ctx)
+		},
+	},
+	{
+		id: "DL3045", level: "warning", category: "best-practice",
+		title:       "COPY to a relative destination without WORKDIR set",
+		description: "The destination depends on the base image's working directory.",
+		suggestion:  "Set WORKDIR before copying to a relative path.",
+		check: func(ctx *AnalysisContext) []int {
+			var lines []int
+			for _, stage := range ctx.ParsedFile.Stages {
+				hasWorkdir := false
+				for _, inst := range stage.Instructions {
+					switch inst.Command {
+					case "WORKDIR":
+						hasWorkdir = true
+					case "COPY":
+						args := nonFlagArgs(inst.Args)
+						if hasWorkdir || len(args) < 2 || isExecForm(inst.Args) {
+							continue
+						}
+						dest := args[len(args)-1]
+						if !strings.HasPrefix(dest, "/") && !strings.HasPrefix(dest, "$") && !windowsPathRegex.MatchString(dest) {
+							lines = append(lines, inst.Line)
+						}
+					}
+				}
+			}
+			return lines
+		},
+	},
+	{
+		id: "DL4000", level: "error", category: "best-practice",
+		title:       "MAINTAINER is deprecated",
+		description: "The MAINTAINER instruction is deprecated.",
+		suggestion:  `Use LABEL maintainer="name <email>" instead.`,
+		check:       matchInstructions("MAINTAINER", func(Instruction) bool { return true }),
+	},
+	{
+		id: "DL4001", level: "warning", category: "optimization",
+		title:       "Either use wget or curl but not both",
+		description: "Installing and using both download tools adds redundant packages.",
+		suggestion:  "Standardize on one of curl or wget.",
+		check: func(ctx *AnalysisContext) []int {
+			curl, wget := shellCommandRegex(`curl`), shellCommandRegex(`wget`)
+			var curlLines, wgetLines []int
+			for _, inst := range ctx.ParsedFile.Instructions {
+				if inst.Command != "RUN" {
+					continue
+				}
+				if curl.MatchString(inst.Args) {
+					curlLines = append(curlLines, inst.Line)
+				}
+				if wget.MatchString(inst.Args) {
+					wgetLines = append(wgetLines, inst.Line)
+				}
+			}
+			if len(curlLines) == 0 || len(wgetLines) == 0 {
+				return nil
+			}
+			return wgetLines
+		},
+	},
+	{
+		id: "DL4003", level: "warning", category: "best-practice",
+		title:       "Multiple CMD instructions found",
+		description: "Only the last CMD in a stage takes effect.",
+		suggestion:  "Keep a single CMD per stage.",
+		check:       duplicateInStage("CMD"),
+	},
+	{
+		id: "DL4004", level: "error", category: "best-practice",
+		title:       "Multiple ENTRYPOINT instructions found",
+		description: "Only the last ENTRYPOINT in a stage takes effect.",
+		suggestion:  "Keep a single ENTRYPOINT per stage.",
+		check:       duplicateInStage("ENTRYPOINT"),
+	},
+	{
+		id: "DL4005", level: "warning", category: "best-practice",
+		title:       "Use SHELL to change the default shell",
+		description: "Replacing /bin/sh with a symlink is fragile and invisible to readers.",
+		suggestion:  `Use SHELL ["/bin/bash", "-c"] instead of linking /bin/sh.`,
+		check:       matchRun(regexp.MustCompile(`ln\s+(-\w+\s+)*\S+\s+/bin/sh(\s|$)`)),
+	},
+	{
+		id: "DL4006", level: "warning", category: "best-practice",
+		title:       "Set the SHELL option -o pipefail before RUN with a pipe",
+		description: "Without pipefail, a failing command on the left of a pipe does not fail the build.",
+		suggestion:  `Add SHELL ["/bin/bash", "-o", "pipefail", "-c"] before the RUN.`,
+		check: func(ctx *AnalysisContext) []int {
+			var lines []int
+			pipe := regexp.MustCompile(`[^|]\|[^|]`)
+			for _, stage := range ctx.ParsedFile.Stages {
+				// Windows images default to cmd, which has no pipefail.
+				if IsWindowsImage(stage.BaseImage) {
+					continue
+				}
+				pipefail := false
+				for _, inst := range stage.Instructions {
+					switch inst.Command {
+					case "SHELL":
+						pipefail = strings.Contains(inst.Args, "pipefail") || !isPOSIXShell(inst.Args)
+					case "RUN":
+						if pipefail || isExecForm(inst.Args) || strings.Contains(inst.Args, "pipefail") {
+							continue
+						}
+						if pipe.MatchString(inst.Args) {
+							lines = append(lines, inst.Line)
+						}
+					}
+				}
+			}
+			return lines
+		},
+	},
+}
+
+// --- Helpers ---
+
+var (
+	windowsPathRegex = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+	archiveRegex     = regexp.MustCompile(`\.(tar|tar\.gz|tgz|tar\.bz2|tbz2|tar\.xz|txz|tar\.zst)$`)
+)
+
+// shellCommandRegex matches any of the given commands in command position of
+// a shell script (start of script or after &&, ||, ;, |).
+func shellCommandRegex(commands string) *regexp.Regexp {
+	return regexp.MustCompile(`(^|&&|\|\||;|\|)\s*(` + commands + `)(\s|$)`)
+}
+
+// matchInstructions returns a check that reports every instruction of the
+// given command for which match returns true.
+func matchInstructions(command string, match func(Instruction) bool) func(ctx *AnalysisContext) []int {
+	return func(ctx *AnalysisContext) []int {
+		var lines []int
+		for _, inst := range ctx.ParsedFile.Instructions {
+			if inst.Command == command && match(inst) {
+				lines = append(lines, inst.Line)
+			}
+		}
+		return lines
+	}
+}
+
+// matchRun returns a check that reports RUN instructions matching re.
+func matchRun(re *regexp.Regexp) func(ctx *AnalysisContext) []int {
+	return matchInstructions("RUN", func(inst Instruction) bool {
+		return re.MatchString(inst.Args)
+	})
+}
+
+// matchRunMissing returns a check that reports RUN instructions matching
+// trigger but not required.
+func matchRunMissing(trigger, required *regexp.Regexp) func(ctx *AnalysisContext) []int {
+	return matchInstructions("RUN", func(inst Instruction) bool {
+		return trigger.MatchString(inst.Args) && !required.MatchString(inst.Args)
+	})
+}
+
+// matchRunUncached is matchRunMissing for cache cleanups, which a cache
+// mount at cacheDir makes unnecessary.
+func matchRunUncached(trigger, required *regexp.Regexp, cacheDir string) func(ctx *AnalysisContext) []int {
+	return matchInstructions("RUN", func(inst Instruction) bool {
+		return trigger.MatchString(inst.Args) && !required.MatchString(inst.Args) && !cacheMounted(inst, cacheDir)
+	})
+}
+
+// duplicateInStage returns a check that reports repeated instructions of the
+// given command within a single stage.
+func duplicateInStage(command string) func(ctx *AnalysisContext) []int {
+	return func(ctx *AnalysisContext) []int {
+		var lines []int
+		for _, stage := range ctx.ParsedFile.Stages {
+			count := 0
+			for _, inst := range stage.Instructions {
+				if inst.Command == command {
+					count++
+					if count > 1 {
+						lines = append(lines, inst.Line)
+					}
+				}
+			}
+		}
+		return lines
+	}
+}
+
+func finalStage(ctx *AnalysisContext) *Stage {
+	idx := ctx.ParsedFile.FinalStage()
+	if idx < 0 {
+		return nil
+	}
+	return &ctx.ParsedFile.Stages[idx]
+}
+
+// IsRootUser reports whether a USER value runs with root (or Windows
+// administrator) privileges.
+func IsRootUser(args string) bool {
+	user := strings.SplitN(strings.TrimSpace(args), ":", 2)[0]
+	return user == "root" || user == "0" || strings.EqualFold(user, "ContainerAdministrator")
+}
+
+func isExecForm(args string) bool {
+	return strings.HasPrefix(strings.TrimSpace(args), "[")
+}
+
+// nonFlagArgs returns the instruction arguments without leading --flags.
+func nonFlagArgs(args string) []string {
+	var result []string
+	for _, f := range strings.Fields(args) {
+		if strings.HasPrefix(f, "--") && len(result) == 0 {
+			continue
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// copySources returns the source arguments of a COPY or ADD instruction.
+func copySources(args string) []string {
+	fields := nonFlagArgs(args)
+	if len(fields) < 2 {
+		return nil
+	}
+	return fields[:len(fields)-1]
+}
+
+// copyFromFlag returns the value of a COPY --from flag, or "".
+func copyFromFlag(inst Instruction) string {
+	if inst.Command != "COPY" {
+		return ""
+	}
+	for _, f := range strings.Fields(inst.Args) {
+		if strings.HasPrefix(f, "--from=") {
+			return strings.TrimPrefix(f, "--from=")
+		}
+	}
+	return ""
+}
+
+// isExternalImageRef reports whether a COPY --from value refers to an image
+// rather than a build stage.
+func isExternalImageRef(ref string) bool {
+	return strings.ContainsAny(ref, ":/@")
+}
@@ -0,0 +1,69 @@
+package analyzer
+
+import (
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// IssueFilter narrows a list of issues for display. An empty field matches
+// everything.
+type IssueFilter struct {
+	// Threshold drops issues below this severity.
+	Threshold  models.Severity
+	Severities []string
+	Categories []string
+	RuleIDs    []string
+	MaxIssues  int // 0 = unlimited
+}
+
+// Apply returns the issues matching the filter and the number of issues
+// that were filtered out (including those dropped by MaxIssues).
+func (f IssueFilter) Apply(issues []models.Issue) ([]models.Issue, int) {
+	var kept []models.Issue
+	for _, issue := range issues {
+		if !issue.Severity.AtLeast(f.Threshold) ||
+			!matchesAny(string(issue.Severity), f.Severities) ||
+			!matchesAny(issue.Category, f.Categories) ||
+			!f.matchesRule(issue.ID) {
+			continue
+		}
+		kept = append(kept, issue)
+	}
+
+	if f.MaxIssues > 0 && len(kept) > f.MaxIssues {
+		kept = kept[:f.MaxIssues]
+	}
+	return kept, len(issues) - len(kept)
+}
+
+// IsEmpty reports whether the filter matches every issue.
+func (f IssueFilter) IsEmpty() bool {
+	return f.Threshold == "" && len(f.Severities) == 0 && len(f.Categories) == 0 && len(f.RuleIDs) == 0 && f.MaxIssues == 0
+}
+
+// matchesRule matches an issue ID against the rule list, treating variant
+// IDs such as DIO005-pip as their base rule.
+func (f IssueFilter) matchesRule(id string) bool {
+	if len(f.RuleIDs) == 0 {
+		return true
+	}
+	for _, r := range f.RuleIDs {
+		if strings.EqualFold(r, id) || strings.EqualFold(r, baseRuleID(id)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(value string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(strings.TrimSpace(a), value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package analyzer
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// attachFingerprints sets a fingerprint on every issue that stays the same
+// when lines are added or removed elsewhere in the Dockerfile: it hashes the
+// file, the rule ID and the normalized instruction the issue points at,
+// rather than the line number. Identical findings on identical instructions
+// are told apart by their order.
+func attachFingerprints(pdf *ParsedDockerfile, dockerfilePath string, issues []models.Issue) {
+	file := fingerprintPath(dockerfilePath)
+	seen := make(map[string]int)
+	for i := range issues {
+		instruction := ""
+		if issues[i].Line > 0 {
+			instruction = pdf.normalizedInstructionAt(issues[i].Line)
+		}
+		key := issues[i].ID + "\x00" + instruction
+		seen[key]++
+		issues[i].Fingerprint = models.Fingerprint(file, issues[i].ID, instruction, strings.Repeat("+", seen[key]-1))
+	}
+}
+
+// fingerprintPath returns the Dockerfile path fingerprints hash: relative
+// to the repository root, so that the same file gets the same fingerprints
+// however it is passed on the command line and from whichever directory.
+// Outside a repository it is the file name, relative to the build context.
+func fingerprintPath(dockerfilePath string) string {
+	if dockerfilePath == stdinPath {
+		return dockerfilePath
+	}
+	abs, err := filepath.Abs(dockerfilePath)
+	if err != nil {
+		return filepath.ToSlash(filepath.Clean(dockerfilePath))
+	}
+	if root := repoRoot(filepath.Dir(abs)); root != "" {
+		if rel, err := filepath.Rel(root, abs); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(abs)
+}
+
+// normalizedInstructionAt returns the instruction starting at or enclosing
+// the given line, with its command upper-cased and whitespace collapsed.
+func (p *ParsedDockerfile) normalizedInstructionAt(line int) string {
+	var found *Instruction
+	for s := range p.Stages {
+		for i := range p.Stages[s].Instructions {
+			inst := &p.Stages[s].Instructions[i]
+			if inst.Line <= line && (found == nil || inst.Line > found.Line) {
+				found = inst
+			}
+		}
+	}
+	if found == nil {
+		return ""
+	}
+	return strings.ToUpper(found.Command) + " " + strings.Join(strings.Fields(found.Args), " ")
+}
@@ -0,0 +1,299 @@
+package analyzer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+var (
+	// frontendBuildRegex matches the build command of a front-end project.
+	frontendBuildRegex = regexp.MustCompile(`\b(?:(?:npm|pnpm|bun)\s+run\s+build|(?:yarn|pnpm)\s+build|(?:vite|ng|react-scripts|vue-cli-service|astro|gatsby|next)\s+build|next\s+export)\b`)
+	// nodeInstallRegex matches a package install into node_modules.
+	nodeInstallRegex = regexp.MustCompile(`^(?:npm\s+(?:ci|install|i)|pnpm\s+(?:i|install)|bun\s+install|yarn(?:\s+install)?)(?:\s|$)`)
+	// staticServerRegex matches a command that serves a directory of static
+	// files, and captures the server and its arguments.
+	staticServerRegex = regexp.MustCompile(`(?:^|[\s/])(run\s+)?(serve|http-server|sirv|live-server|vite\s+preview)(?:\s|$)(.*)`)
+	// sourceMapFlagRegex matches build options that turn source maps on.
+	sourceMapFlagRegex = regexp.MustCompile(`--source-?map(?:=true)?(?:\s|$)`)
+	// sourceMapDeleteRegex matches a command deleting source maps.
+	sourceMapDeleteRegex = regexp.MustCompile(`\*\.(?:js\.)?map\b`)
+)
+
+// webServerImages are the images of static web servers.
+var webServerImages = map[string]bool{
+	"nginx": true, "nginx-unprivileged": true, "caddy": true, "httpd": true, "lighttpd": true,
+}
+
+// staticServerPorts are the ports static servers listen on by default.
+var staticServerPorts = map[string]string{
+	"serve": "3000", "http-server": "8080", "sirv": "8080", "live-server": "8080", "vite preview": "4173",
+}
+
+// FrontendBuild is a front-end build in a RUN instruction.
+type FrontendBuild struct {
+	Stage int
+	Run   Instruction
+	// Output is the directory the build writes to, absolute.
+	Output string
+	// SourceMaps is set when the build evidently writes source maps and
+	// nothing deletes them.
+	SourceMaps bool
+}
+
+// FrontendBuilds returns the front-end builds of the stages up to the
+// final one.
+func (p *ParsedDockerfile) FrontendBuilds() []FrontendBuild {
+	var builds []FrontendBuild
+	copies := p.stageCopies()
+	for i := 0; i <= p.FinalStage(); i++ {
+		stage := p.Stages[i]
+		var stageBuilds []FrontendBuild
+		noMaps := false
+		walkWorkdir(p.StageChain(i), func(inst Instruction, workdir string) {
+			if strings.Contains(inst.Args, "GENERATE_SOURCEMAP=false") {
+				noMaps = true
+			}
+			if inst.Line < stage.StartLine || inst.Command != "RUN" {
+				return
+			}
+			if sourceMapDeleteRegex.MatchString(inst.Args) {
+				noMaps = true
+				for j := range stageBuilds {
+					stageBuilds[j].SourceMaps = false
+				}
+			}
+			m := frontendBuildRegex.FindString(inst.Args)
+			if m == "" {
+				return
+			}
+			b := FrontendBuild{Stage: i, Run: inst, Output: p.frontendOutput(i, inst, m, workdir, copies)}
+			b.SourceMaps = !noMaps && (sourceMapFlagRegex.MatchString(inst.Args) ||
+				strings.Contains(m, "react-scripts") || path.Base(b.Output) == "build" && !strings.Contains(m, "next"))
+			stageBuilds = append(stageBuilds, b)
+		})
+		builds = append(builds, stageBuilds...)
+	}
+	return builds
+}
+
+// frontendOutput works out where a front-end build writes: the output
+// option of the command, the directory the final stage serves or a later
+// stage copies from under the WORKDIR, or the default of the tool.
+func (p *ParsedDockerfile) frontendOutput(idx int, run Instruction, build, workdir string, copies []stageCopy) string {
+	if m := buildOutputRegex.FindStringSubmatch(run.Args); m != nil && !strings.Contains(m[1], "$") {
+		return path.Join(workdir, m[1])
+	}
+	if server := p.staticServer(); server != nil && p.inFinalChain(idx) && server.Dir != "" {
+		return server.Dir
+	}
+	for _, c := range copies {
+		for _, src := range c.Sources {
+			if c.From == idx && src != workdir && isUnder(globDir(src), workdir) {
+				return globDir(src)
+			}
+		}
+	}
+	switch {
+	case strings.Contains(build, "react-scripts"):
+		return path.Join(workdir, "build")
+	case strings.Contains(build, "next"):
+		return path.Join(workdir, "out")
+	}
+	return path.Join(workdir, "dist")
+}
+
+// inFinalChain reports whether the final stage is the stage at idx or
+// built on it.
+func (p *ParsedDockerfile) inFinalChain(idx int) bool {
+	for i := p.FinalStage(); i >= 0; i = p.resolveStageRef(i, p.Stages[i].BaseImage) {
+		if i == idx {
+			return true
+		}
+	}
+	return false
+}
+
+// StaticServer is a static file server the final stage runs.
+type StaticServer struct {
+	Server string // serve, http-server, sirv, live-server or vite preview
+	// Dir is the directory it serves, absolute, or "" when unknown.
+	Dir  string
+	Port string
+	// SPA is set when the server answers unknown paths with index.html.
+	SPA bool
+}
+
+// staticServer returns the static file server the final stage's CMD or
+// ENTRYPOINT runs, or nil.
+func (p *ParsedDockerfile) staticServer() *StaticServer {
+	var server *StaticServer
+	port := ""
+	walkWorkdir(p.StageChain(p.FinalStage()), func(inst Instruction, workdir string) {
+		switch inst.Command {
+		case "EXPOSE":
+			if fields := strings.Fields(inst.Args); len(fields) > 0 && port == "" {
+				port = strings.Split(fields[0], "/")[0]
+			}
+		case "CMD", "ENTRYPOINT":
+			cmd := strings.NewReplacer("[", " ", "]", " ", `"`, " ", ",", " ").Replace(inst.Args)
+			// npm run serve is a script, usually a development server
+			m := staticServerRegex.FindStringSubmatch(cmd)
+			if m == nil || m[1] != "" {
+				server = nil
+				return
+			}
+			server = &StaticServer{Server: strings.Join(strings.Fields(m[2]), " ")}
+			dir := ""
+			args := strings.Fields(m[3])
+			for i := 0; i < len(args); i++ {
+				switch arg := args[i]; {
+				case (arg == "-s" || arg == "--single") && server.Server != "http-server":
+					server.SPA = true
+				case (arg == "-l" || arg == "--listen" || arg == "-p" || arg == "--port") && i+1 < len(args):
+					i++
+					server.Port = args[i][strings.LastIndex(args[i], ":")+1:]
+				case arg == "--outDir" && i+1 < len(args):
+					i++
+					dir = args[i]
+				case arg == "-c" || arg == "--config" || arg == "-a" || arg == "--host":
+					i++
+				case !strings.HasPrefix(arg, "-") && dir == "" && server.Server != "vite preview":
+					dir = arg
+				}
+			}
+			if server.Server == "vite preview" {
+				server.SPA = true
+				if dir == "" {
+					dir = "dist"
+				}
+			}
+			if dir != "" && !strings.Contains(dir, "$") {
+				server.Dir = path.Join(workdir, dir)
+			}
+		}
+	})
+	if server != nil && server.Port == "" {
+		server.Port = port
+		if server.Port == "" {
+			server.Port = staticServerPorts[server.Server]
+		}
+	}
+	return server
+}
+
+// StaticFrontend is a final stage that builds a front-end and serves it
+// with a static file server on a Node.js image.
+type StaticFrontend struct {
+	Build  FrontendBuild
+	Server StaticServer
+}
+
+// StaticFrontendOf returns the front-end the final stage builds and serves
+// itself, or nil. The final stage must be the last one, built on an
+// external image, and serve a known directory.
+func (p *ParsedDockerfile) StaticFrontendOf() *StaticFrontend {
+	final := p.FinalStage()
+	if final < 0 || final != len(p.Stages)-1 || len(p.StageChain(final)) != 1 || p.IsWindows() {
+		return nil
+	}
+	server := p.staticServer()
+	if server == nil || server.Dir == "" {
+		return nil
+	}
+	for _, b := range p.FrontendBuilds() {
+		if b.Stage == final && isUnder(server.Dir, b.Output) {
+			return &StaticFrontend{Build: b, Server: *server}
+		}
+	}
+	return nil
+}
+
+// --- FrontendNodeModulesRule ---
+
+type FrontendNodeModulesRule struct{}
+
+func (r *FrontendNodeModulesRule) ID() string { return "DIO033" }
+
+func (r *FrontendNodeModulesRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *FrontendNodeModulesRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	builds := pdf.FrontendBuilds()
+	if len(builds) == 0 {
+		return nil
+	}
+	serverBase := webServerImages[imageRepo(strings.ToLower(pdf.runtimeBase()))]
+	if !serverBase && pdf.staticServer() == nil {
+		// node_modules are the application's runtime dependencies
+		return nil
+	}
+	fixable := pdf.StaticFrontendOf() != nil
+	t := newArtifactTracer(pdf)
+	var issues []models.Issue
+	for i := 0; i <= pdf.FinalStage(); i++ {
+		walkWorkdir(pdf.StageChain(i), func(inst Instruction, workdir string) {
+			if inst.Line < pdf.Stages[i].StartLine || inst.Command != "RUN" {
+				return
+			}
+			installs := false
+			for _, cmd := range shellSeparatorRegex.Split(inst.Args, -1) {
+				cmd = strings.TrimSpace(cmd)
+				installs = installs || nodeInstallRegex.MatchString(cmd) && !strings.Contains(cmd, " -g") && !strings.Contains(cmd, "--global")
+			}
+			modules := path.Join(workdir, "node_modules")
+			if !installs || !t.reaches(i, modules) {
+				return
+			}
+			issue := models.Issue{
+				ID:          r.ID(),
+				Severity:    models.SeverityMedium,
+				Category:    "optimization",
+				Title:       "node_modules in a static front-end image",
+				Description: fmt.Sprintf("The image serves a static front-end build, but the node_modules installed in %s on this line end up in it too: hundreds of MB of build tooling nothing serves.", modules),
+				Line:        inst.Line,
+				Suggestion:  "Build the front-end in a build stage and copy only its output (dist or build) into an nginx or caddy alpine image.",
+				AutoFixable: fixable,
+			}
+			if pdf.inFinalChain(i) {
+				issue.Severity = models.SeverityHigh
+				issue.Description = fmt.Sprintf("The final stage builds a static front-end and serves it with Node.js, so node_modules in %s, the sources and the Node.js runtime stay in the image, hundreds of MB to serve a directory of files.", modules)
+			}
+			issues = append(issues, issue)
+		})
+	}
+	return issues
+}
+
+// --- SourceMapRule ---
+
+type SourceMapRule struct{}
+
+func (r *SourceMapRule) ID() string { return "DIO034" }
+
+func (r *SourceMapRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *SourceMapRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	t := newArtifactTracer(pdf)
+	var issues []models.Issue
+	for _, b := range pdf.FrontendBuilds() {
+		if !b.SourceMaps || !t.reaches(b.Stage, b.Output) {
+			continue
+		}
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityLow,
+			Category:    "security",
+			Title:       "Source maps shipped with the front-end build",
+			Description: fmt.Sprintf("The build writes source maps into %s, which ends up in the final image. They publish the original sources to anyone who requests them and are often as large as the bundles.", b.Output),
+			Line:        b.Run.Line,
+			Suggestion:  fmt.Sprintf("Turn source maps off for production builds (GENERATE_SOURCEMAP=false for Create React App) or delete them after the build: find %s -name '*.map' -delete.", b.Output),
+			AutoFixable: true,
+		})
+	}
+	return issues
+}
@@ -0,0 +1,204 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// runtimeImages maps the repositories of official language and server
+// images to the runtime they provide.
+var runtimeImages = map[string]string{
+	"node": "node", "python": "python", "pypy": "python", "golang": "go",
+	"openjdk": "java", "eclipse-temurin": "java", "amazoncorretto": "java", "ibm-semeru-runtimes": "java",
+	"sapmachine": "java", "maven": "java", "gradle": "java", "ruby": "ruby", "php": "php",
+	"rust": "rust", "nginx": "nginx",
+}
+
+// runtimeCommandRegexes match the commands of RUN, CMD and ENTRYPOINT
+// instructions that tell the runtime, in the order they are tried.
+var runtimeCommandRegexes = []struct {
+	runtime string
+	regex   *regexp.Regexp
+}{
+	{"node", regexp.MustCompile(`(?:^|[\s/;&|("'])(?:npm|npx|yarn|pnpm|node)(?:["'\s]|$)`)},
+	{"python", regexp.MustCompile(`(?:^|[\s/;&|("'])(?:pip3?|pipenv|poetry|python3?|gunicorn|uvicorn)(?:["'\s]|$)`)},
+	{"go", regexp.MustCompile(`(?:^|[\s/;&|("'])go\s+(?:build|install|mod)\b`)},
+	{"java", regexp.MustCompile(`(?:^|[\s/;&|("'])(?:mvnw?|gradlew?|java)(?:["'\s]|$)`)},
+	{"ruby", regexp.MustCompile(`(?:^|[\s/;&|("'])(?:bundle|gem|rails|ruby)(?:["'\s]|$)`)},
+	{"php", regexp.MustCompile(`(?:^|[\s/;&|("'])(?:composer|php|php-fpm)(?:["'\s]|$)`)},
+	{"rust", regexp.MustCompile(`(?:^|[\s/;&|("'])cargo\s`)},
+	{"dotnet", regexp.MustCompile(`(?:^|[\s/;&|("'])dotnet(?:["'\s]|$)`)},
+}
+
+// Runtime returns the language or server the application runs on, such as
+// node or go, or "" when the Dockerfile doesn't tell. The images and
+// commands of the final stage count first, then those of the build stages.
+func (p *ParsedDockerfile) Runtime() string {
+	chain := p.StageChain(p.FinalStage())
+	stages := append([]Stage(nil), chain...)
+	inChain := make(map[int]bool)
+	for _, stage := range chain {
+		inChain[stage.StartLine] = true
+	}
+	for i := len(p.Stages) - 1; i >= 0; i-- {
+		if !inChain[p.Stages[i].StartLine] {
+			stages = append(stages, p.Stages[i])
+		}
+	}
+	for _, stage := range stages {
+		if runtime := imageRuntime(stage.BaseImage); runtime != "" {
+			return runtime
+		}
+	}
+	for _, stage := range stages {
+		for _, inst := range stage.Instructions {
+			switch inst.Command {
+			case "RUN", "CMD", "ENTRYPOINT":
+			default:
+				continue
+			}
+			for _, c := range runtimeCommandRegexes {
+				if c.regex.MatchString(inst.Args) {
+					return c.runtime
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// imageRuntime returns the runtime an official image provides, or "".
+func imageRuntime(image string) string {
+	image = strings.ToLower(image)
+	if strings.Contains(image, "/dotnet/") {
+		return "dotnet"
+	}
+	return runtimeImages[imageRepo(image)]
+}
+
+// GoldenImageFor returns the golden image for an application on runtime:
+// the first that provides it, else the first that lists no runtimes.
+func GoldenImageFor(images []config.GoldenImage, runtime string) (config.GoldenImage, bool) {
+	if runtime != "" {
+		for _, g := range images {
+			if containsString(g.Runtimes, runtime) {
+				return g, true
+			}
+		}
+	}
+	for _, g := range images {
+		if len(g.Runtimes) == 0 {
+			return g, true
+		}
+	}
+	return config.GoldenImage{}, false
+}
+
+// goldenImage returns the catalog entry for the repository of image.
+func goldenImage(images []config.GoldenImage, image string) (config.GoldenImage, bool) {
+	repo, _ := docker.SplitImageRef(image)
+	for _, g := range images {
+		if strings.EqualFold(docker.NormalizeRepo(g.Name), docker.NormalizeRepo(repo)) {
+			return g, true
+		}
+	}
+	return config.GoldenImage{}, false
+}
+
+// GoldenChange is the change of the base image of the final stage to a
+// golden image.
+type GoldenChange struct {
+	Line    int    // of the FROM instruction
+	From    string // the base image, with ARGs resolved
+	Runtime string // of the application, or ""
+	// To is the golden image to build on instead, or "" when the catalog
+	// has none for the runtime.
+	To string
+	// Tag is set when From is a golden image, with a tag the catalog
+	// doesn't approve.
+	Tag bool
+}
+
+// GoldenChange returns the change of the base image of the final stage to
+// the golden image for the application, or nil when it already is one with
+// an approved tag, or builds from scratch.
+func (p *ParsedDockerfile) GoldenChange(images []config.GoldenImage) *GoldenChange {
+	if len(images) == 0 {
+		return nil
+	}
+	chain := p.StageChain(p.FinalStage())
+	if len(chain) == 0 {
+		return nil
+	}
+	root := chain[len(chain)-1]
+	if root.BaseImage == "" || strings.EqualFold(root.BaseImage, "scratch") {
+		return nil
+	}
+	change := &GoldenChange{Line: root.StartLine, From: root.BaseImage}
+	if g, ok := goldenImage(images, root.BaseImage); ok {
+		_, tag := docker.SplitImageRef(root.BaseImage)
+		// A digest pins an image of the repository; the tag can't be told
+		if len(g.Tags) == 0 || containsString(g.Tags, tag) || (tag == "" && strings.Contains(root.BaseImage, "@")) {
+			return nil
+		}
+		change.To, change.Tag = g.Ref(), true
+		return change
+	}
+	change.Runtime = p.Runtime()
+	if g, ok := GoldenImageFor(images, change.Runtime); ok {
+		change.To = g.Ref()
+	}
+	return change
+}
+
+// --- GoldenImageRule ---
+
+// GoldenImageRule reports final images built on anything but the golden
+// images configured under golden_images in .dio.yaml.
+type GoldenImageRule struct{}
+
+func (r *GoldenImageRule) ID() string { return "DIO035" }
+
+func (r *GoldenImageRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *GoldenImageRule) Check(ctx *AnalysisContext) []models.Issue {
+	change := ctx.ParsedFile.GoldenChange(ctx.GoldenImages)
+	if change == nil {
+		return nil
+	}
+	issue := models.Issue{
+		ID:          r.ID(),
+		Severity:    models.SeverityMedium,
+		Category:    "best-practice",
+		Title:       "Base image is not a golden image",
+		Description: fmt.Sprintf("The final stage is built on '%s', which is not in the golden image catalog.", change.From),
+		Line:        change.Line,
+		AutoFixable: change.To != "",
+	}
+	switch {
+	case change.Tag:
+		issue.Title = "Golden image tag not approved"
+		issue.Description = fmt.Sprintf("'%s' is a golden image, but the catalog doesn't approve its tag.", change.From)
+		issue.Suggestion = fmt.Sprintf("Use '%s'.", change.To)
+	case change.To != "" && change.Runtime != "":
+		issue.Suggestion = fmt.Sprintf("Use '%s', the golden image for %s.", change.To, change.Runtime)
+	case change.To != "":
+		issue.Suggestion = fmt.Sprintf("Use '%s'.", change.To)
+	default:
+		var refs []string
+		for _, g := range ctx.GoldenImages {
+			refs = append(refs, g.Ref())
+		}
+		runtime := "the application's runtime"
+		if change.Runtime != "" {
+			runtime = change.Runtime
+		}
+		issue.Suggestion = fmt.Sprintf("No golden image provides %s: use one of %s, or add one to the catalog.", runtime, strings.Join(refs, ", "))
+	}
+	return []models.Issue{issue}
+}
@@ -0,0 +1,13 @@
+package analyzer_test
+
+import (
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/testutil"
+)
+
+func TestRules_Golden(t *testing.T) {
+	rules := append(analyzer.DefaultRules(), analyzer.ExtendedRules()...)
+	testutil.RunRules(t, rules, testutil.Cases(t, "testdata/cases"))
+}
@@ -0,0 +1,213 @@
+package analyzer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ProbeImage provides the probe binary for images without a shell: the
+// musl build of busybox is static, so it runs on scratch and distroless,
+// and its wget and nc applets cover HTTP and TCP checks.
+const ProbeImage = "busybox:1.36.1-musl"
+
+// probePath is where the probe binary is copied to.
+const probePath = "/usr/local/bin/busybox"
+
+// healthcheckFlags are the timing options of suggested HEALTHCHECKs.
+const healthcheckFlags = "--interval=30s --timeout=5s --start-period=15s --retries=3"
+
+// Healthcheck is a HEALTHCHECK suggested for a Dockerfile from its EXPOSE
+// ports, the framework it runs and the tools in the final image.
+type Healthcheck struct {
+	Port     string // the probed port
+	Protocol string // http, https or tcp
+	Path     string // the probed HTTP path
+	Probe    string // what runs the check: curl, wget, python, node, bash, nc or busybox
+	// Instructions are added to the final stage: for images without a
+	// shell a COPY of the probe binary, then the HEALTHCHECK.
+	Instructions []string
+}
+
+// tcpPorts are well-known ports of services that don't speak HTTP.
+var tcpPorts = map[string]bool{
+	"21": true, "22": true, "25": true, "53": true, "389": true, "587": true,
+	"1433": true, "1521": true, "2181": true, "3306": true, "4222": true,
+	"5432": true, "5672": true, "6379": true, "9042": true, "9092": true,
+	"11211": true, "27017": true, "50051": true,
+}
+
+// healthPaths are the health endpoints frameworks provide out of the box,
+// keyed by a hint found in the Dockerfile.
+var healthPaths = []struct{ hint, path string }{
+	{"spring", "/actuator/health"},
+	{"actuator", "/actuator/health"},
+	{"quarkus", "/q/health"},
+	{"rails", "/up"},
+}
+
+// SuggestHealthcheck parses Dockerfile content and suggests a HEALTHCHECK
+// for its final stage, or the target stage when target is set. It returns
+// nil when there is nothing to probe: no port is exposed, or the image is a
+// Windows image.
+func SuggestHealthcheck(content string, buildArgs map[string]string, target string) *Healthcheck {
+	pdf := parseDockerfileWithArgs(strings.Split(content, "\n"), buildArgs)
+	pdf.Target = target
+	return pdf.suggestHealthcheck()
+}
+
+func (p *ParsedDockerfile) suggestHealthcheck() *Healthcheck {
+	if p.FinalStage() < 0 || p.IsWindows() {
+		return nil
+	}
+	insts := p.finalInstructions()
+	port := probedPort(insts)
+	if port == "" {
+		return nil
+	}
+
+	h := &Healthcheck{Port: port, Protocol: "http", Path: "/"}
+	switch {
+	case tcpPorts[port]:
+		h.Protocol = "tcp"
+	case port == "443" || port == "8443":
+		h.Protocol = "https"
+	}
+	if h.Protocol != "tcp" {
+		h.Path = p.healthPath()
+	}
+	url := fmt.Sprintf("%s://localhost:%s%s", h.Protocol, port, h.Path)
+
+	base := strings.ToLower(p.runtimeBase())
+	var installed strings.Builder
+	for _, inst := range insts {
+		if inst.Command == "RUN" {
+			installed.WriteString(inst.Args + "\n")
+		}
+	}
+	tools := installed.String()
+	shell := base != "scratch" && !strings.Contains(base, "distroless") && !strings.Contains(base, "chainguard/static")
+	busybox := strings.Contains(base, "alpine") || strings.Contains(base, "busybox")
+
+	// localhost can't match the certificate of an HTTPS server
+	curlFlags, wgetFlags := "-fsS", "-q --spider"
+	if h.Protocol == "https" {
+		curlFlags, wgetFlags = "-fsSk", "-q --spider --no-check-certificate"
+	}
+
+	var cmd string
+	switch {
+	case !shell:
+		h.Probe = "busybox"
+		h.Instructions = append(h.Instructions, fmt.Sprintf("COPY --from=%s /bin/busybox %s", ProbeImage, probePath))
+		args := append([]string{probePath, "wget"}, strings.Fields(wgetFlags)...)
+		args = append(args, url)
+		if h.Protocol == "tcp" {
+			args = []string{probePath, "nc", "-z", "localhost", port}
+		}
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = strconv.Quote(arg)
+		}
+		cmd = "[" + strings.Join(quoted, ", ") + "]"
+	case h.Protocol == "tcp" && busybox:
+		h.Probe = "nc"
+		cmd = fmt.Sprintf("nc -z localhost %s || exit 1", port)
+	case h.Protocol == "tcp":
+		h.Probe = "bash"
+		cmd = fmt.Sprintf("bash -c '</dev/tcp/localhost/%s' || exit 1", port)
+	case strings.Contains(tools, "curl") || hasCurl(base):
+		h.Probe = "curl"
+		cmd = fmt.Sprintf("curl %s %s || exit 1", curlFlags, url)
+	case strings.Contains(tools, "wget") || busybox:
+		h.Probe = "wget"
+		cmd = fmt.Sprintf("wget %s %s || exit 1", wgetFlags, url)
+	case h.Protocol == "http" && strings.HasPrefix(imageRepo(base), "python"):
+		h.Probe = "python"
+		cmd = fmt.Sprintf(`python -c "import urllib.request; urllib.request.urlopen('%s')" || exit 1`, url)
+	case h.Protocol == "http" && strings.HasPrefix(imageRepo(base), "node"):
+		h.Probe = "node"
+		cmd = fmt.Sprintf(`node -e "require('http').get('%s', r => process.exit(r.statusCode < 400 ? 0 : 1)).on('error', () => process.exit(1))"`, url)
+	default:
+		// Neither tool is known to be there: try both
+		h.Probe = "curl"
+		cmd = fmt.Sprintf("curl %s %s || wget %s %s || exit 1", curlFlags, url, wgetFlags, url)
+	}
+	h.Instructions = append(h.Instructions, "HEALTHCHECK "+healthcheckFlags+" CMD "+cmd)
+	return h
+}
+
+// probedPort returns the first HTTP port the final stage exposes, or the
+// first port when none looks like HTTP. UDP ports and unresolved
+// variables are skipped.
+func probedPort(insts []Instruction) string {
+	var ports []string
+	for _, inst := range insts {
+		if inst.Command != "EXPOSE" {
+			continue
+		}
+		for _, f := range strings.Fields(inst.Args) {
+			port, proto, _ := strings.Cut(f, "/")
+			if strings.EqualFold(proto, "udp") {
+				continue
+			}
+			if _, err := strconv.Atoi(port); err == nil {
+				ports = append(ports, port)
+			}
+		}
+	}
+	for _, port := range ports {
+		if !tcpPorts[port] {
+			return port
+		}
+	}
+	if len(ports) > 0 {
+		return ports[0]
+	}
+	return ""
+}
+
+// healthPath returns the health endpoint of the framework the Dockerfile
+// appears to run, or "/".
+func (p *ParsedDockerfile) healthPath() string {
+	var text strings.Builder
+	for _, inst := range p.Instructions {
+		text.WriteString(strings.ToLower(inst.Args) + "\n")
+	}
+	for _, stage := range p.Stages {
+		text.WriteString(strings.ToLower(stage.BaseImage) + "\n")
+	}
+	s := text.String()
+	for _, hp := range healthPaths {
+		if strings.Contains(s, hp.hint) {
+			return hp.path
+		}
+	}
+	return "/"
+}
+
+// hasCurl reports whether an image is known to include curl: the full
+// (non-slim) official language images are built on buildpack-deps.
+func hasCurl(image string) bool {
+	if strings.Contains(image, "slim") || strings.Contains(image, "alpine") {
+		return false
+	}
+	switch repo := imageRepo(image); {
+	case repo == "nginx":
+		return true
+	case strings.HasPrefix(repo, "python"), strings.HasPrefix(repo, "node"),
+		repo == "golang", repo == "ruby", repo == "rust", repo == "php":
+		return true
+	}
+	return false
+}
+
+// imageRepo returns the repository name of an image without registry,
+// namespace or tag, e.g. "python" for docker.io/library/python:3.12.
+func imageRepo(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.IndexAny(name, ":@"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
@@ -0,0 +1,191 @@
+package analyzer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// shellCommandNames are the shells a container started without a command
+// of its own drops into.
+var shellCommandNames = map[string]bool{"sh": true, "bash": true, "ash": true, "dash": true, "zsh": true}
+
+// CheckImage checks the runtime configuration of the image built from the
+// analyzed Dockerfile and adds the findings (DIO042 to DIO045) to the
+// analysis, at the lines that set what they report, updating its stages
+// and score. The Dockerfile is read again from result.Dockerfile.
+func (a *Analyzer) CheckImage(result *models.AnalysisResult, cfg *models.RuntimeConfig) error {
+	content, err := os.ReadFile(result.Dockerfile)
+	if err != nil {
+		return fmt.Errorf("failed to read Dockerfile: %w", err)
+	}
+	return a.CheckImageContent(result, string(content), cfg)
+}
+
+// CheckImageContent is CheckImage for Dockerfile content analyzed with
+// AnalyzeContent.
+func (a *Analyzer) CheckImageContent(result *models.AnalysisResult, content string, cfg *models.RuntimeConfig) error {
+	pdf, err := a.parse(strings.Split(content, "\n"))
+	if err != nil {
+		return fmt.Errorf("%s: %w", result.Dockerfile, err)
+	}
+	issues := imageConfigIssues(pdf, cfg)
+	kind := result.ImageKind
+	if kind == "" {
+		kind, _ = imageKind(a.image, pdf, result.Dockerfile)
+	}
+	applyKindSeverities(issues, kindSeverities(a.image, kind))
+	attachDocsURLs(issues)
+	attachFingerprints(pdf, result.Dockerfile, issues)
+	result.Issues = append(result.Issues, issues...)
+	result.Stages = attributeStages(pdf, result.Issues)
+	result.Score = calculateScore(result.Issues, a.threshold)
+	result.Runtime = cfg
+	return nil
+}
+
+// imageConfigIssues returns the findings of the image config rules.
+func imageConfigIssues(pdf *ParsedDockerfile, cfg *models.RuntimeConfig) []models.Issue {
+	final := pdf.FinalStage()
+	if final < 0 || pdf.IsWindows() {
+		return nil
+	}
+	from := pdf.Stages[final].StartLine
+	last := func(command string) int {
+		line := 0
+		for _, inst := range pdf.finalInstructions() {
+			if inst.Command == command {
+				line = inst.Line
+			}
+		}
+		return line
+	}
+
+	command := append(append([]string(nil), cfg.Entrypoint...), cfg.Cmd...)
+	var issues []models.Issue
+	switch {
+	case len(command) == 0:
+		issues = append(issues, models.Issue{
+			ID:          "DIO042",
+			Severity:    models.SeverityMedium,
+			Category:    "best-practice",
+			Title:       "Image has no CMD or ENTRYPOINT",
+			Description: fmt.Sprintf("Neither the Dockerfile nor the base image sets what %s runs: docker run fails without a command on its command line.", cfg.Image),
+			Line:        from,
+			Suggestion:  "Set the process the image runs with CMD or ENTRYPOINT, in exec form.",
+		})
+	case len(command) == 1 && shellCommandNames[path.Base(command[0])]:
+		line, inherited := last("CMD"), ""
+		if len(cfg.Entrypoint) > 0 {
+			line = last("ENTRYPOINT")
+		}
+		if line == 0 {
+			line, inherited = from, ", inherited from the base image"
+		}
+		issues = append(issues, models.Issue{
+			ID:          "DIO043",
+			Severity:    models.SeverityMedium,
+			Category:    "best-practice",
+			Title:       "Container defaults to a shell",
+			Description: fmt.Sprintf("%s runs %s%s. A container started without a command runs an interactive shell, which exits at once without a terminal and leaves a shell in the image for anyone who can exec into it.", cfg.Image, strings.Join(command, " "), inherited),
+			Line:        line,
+			Suggestion:  "Run the application with CMD or ENTRYPOINT in exec form.",
+		})
+	}
+
+	for _, leak := range leakedArgs(pdf, cfg.Env) {
+		severity := models.SeverityLow
+		if secretNameRegex.MatchString(leak.key) || secretNameRegex.MatchString(leak.arg) {
+			severity = models.SeverityHigh
+		}
+		issues = append(issues, models.Issue{
+			ID:          "DIO044",
+			Severity:    severity,
+			Category:    "security",
+			Title:       "ENV persists a build arg",
+			Description: fmt.Sprintf("ENV %s is set from the build arg %s and is in the config of %s: the value passed at build time is readable with docker inspect by anyone who can pull the image, and every container runs with it.", leak.key, leak.arg, cfg.Image),
+			Line:        leak.line,
+			Suggestion:  fmt.Sprintf("Use $%s only in the RUN that needs it, or mount it with RUN --mount=type=secret if it is a secret.", leak.arg),
+		})
+	}
+
+	if mode, err := strconv.ParseUint(cfg.WorkingDirMode, 8, 32); err == nil && mode&0o002 != 0 {
+		line := last("WORKDIR")
+		if line == 0 {
+			line = from
+		}
+		issues = append(issues, models.Issue{
+			ID:          "DIO045",
+			Severity:    models.SeverityMedium,
+			Category:    "security",
+			Title:       "World-writable WORKDIR",
+			Description: fmt.Sprintf("The working directory %s has mode %s: any user in the container can write to it, and replace the files the application loads from it.", cfg.WorkingDir, cfg.WorkingDirMode),
+			Line:        line,
+			Suggestion:  "Give the directory to the user the image runs as (COPY --chown, or chown without -R) and remove the write permission for others.",
+		})
+	}
+	return issues
+}
+
+// leakedArg is an ENV of the final image set from a build arg.
+type leakedArg struct {
+	key, arg string
+	line     int
+}
+
+// leakedArgs returns the variables of the image environment that an ENV of
+// the final image sets from an ARG. A later ENV setting the variable
+// without a build arg replaces the value.
+func leakedArgs(pdf *ParsedDockerfile, env []string) []leakedArg {
+	present := make(map[string]bool)
+	for _, kv := range env {
+		if key, value, ok := strings.Cut(kv, "="); ok && value != "" {
+			present[key] = true
+		}
+	}
+	var (
+		args  []string
+		leaks []leakedArg
+		index = make(map[string]int)
+	)
+	for _, inst := range pdf.finalInstructions() {
+		switch inst.Command {
+		case "FROM":
+			// ARGs are scoped to their stage
+			args = nil
+		case "ARG":
+			for _, field := range strings.Fields(inst.Args) {
+				name, _, _ := strings.Cut(field, "=")
+				args = append(args, name)
+			}
+		case "ENV":
+			for _, v := range ParseEnv(inst.Args) {
+				leak := leakedArg{key: v.Key, line: inst.Line}
+				for _, arg := range args {
+					if referencesVar(v.Value, arg) {
+						leak.arg = arg
+						break
+					}
+				}
+				if i, ok := index[v.Key]; ok {
+					leaks[i].arg = ""
+				}
+				if leak.arg != "" {
+					index[v.Key] = len(leaks)
+					leaks = append(leaks, leak)
+				}
+			}
+		}
+	}
+	var found []leakedArg
+	for _, leak := range leaks {
+		if leak.arg != "" && present[leak.key] {
+			found = append(found, leak)
+		}
+	}
+	return found
+}
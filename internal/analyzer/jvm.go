@@ -0,0 +1,216 @@
+package analyzer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+var (
+	// javaJarRegex matches java -jar in a CMD or ENTRYPOINT, in shell or
+	// JSON form, and captures the jar.
+	javaJarRegex = regexp.MustCompile(`-jar["',\s]+([^"',\s\]]+\.jar)`)
+	// javaVersionRegex captures the Java version in the tag of a JDK image,
+	// such as 21 in 21-jdk-jammy, 3.9-eclipse-temurin-21 or 8.5-jdk17.
+	javaVersionRegex = regexp.MustCompile(`(?:^|jdk-?|temurin-|corretto-|openjdk-|liberica-)(\d+)(?:[._u-]|$)`)
+	// jdkToolRegex matches JDK and build tools that a JRE doesn't have.
+	jdkToolRegex = regexp.MustCompile(`(?:^|[\s/;&|(])(javac|jar|jshell|jlink|jdeps|jpackage|mvnw?|gradlew?)(?:\s|$)`)
+)
+
+// jdkImages are the repositories of images that ship a full JDK, unless
+// the tag says jre.
+var jdkImages = map[string]bool{
+	"openjdk": true, "eclipse-temurin": true, "amazoncorretto": true, "ibm-semeru-runtimes": true,
+	"sapmachine": true, "liberica-openjdk-debian": true, "liberica-openjdk-alpine": true,
+	"liberica-openjdk-alpine-musl": true, "jdk": true, "maven": true, "gradle": true,
+}
+
+// jdkImage returns the Java version of an image that ships a full JDK, 0
+// when the tag doesn't say, and whether image is one.
+func jdkImage(image string) (int, bool) {
+	image = strings.ToLower(image)
+	repo := imageRepo(image)
+	if !jdkImages[repo] {
+		return 0, false
+	}
+	tag := ""
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		tag = image[i+1:]
+	}
+	if i := strings.Index(tag, "@"); i >= 0 {
+		tag = tag[:i]
+	}
+	if strings.Contains(tag, "jre") {
+		return 0, false
+	}
+	if repo == "maven" || repo == "gradle" {
+		// The leading number is the tool's version
+		tag = strings.TrimLeft(tag, "0123456789.")
+	}
+	version := 0
+	if m := javaVersionRegex.FindStringSubmatch(tag); m != nil {
+		version, _ = strconv.Atoi(m[1])
+	}
+	return version, true
+}
+
+// Approximate sizes in MB, uncompressed.
+const (
+	// jdkSize is a full JDK install.
+	jdkSize = 320
+	// jlinkBaseSize is a jlink runtime with java.base only, stripped of
+	// debug symbols, man pages and headers.
+	jlinkBaseSize = 45
+)
+
+// buildToolSizes are what build tool images add to the JDK.
+var buildToolSizes = map[string]int{"maven": 10, "gradle": 130}
+
+// moduleSizes are the approximate sizes in MB that JDK modules add to a
+// jlink runtime.
+var moduleSizes = map[string]float64{
+	"java.compiler": 0.3, "java.desktop": 12, "java.instrument": 0.1, "java.logging": 0.2,
+	"java.management": 1.5, "java.naming": 0.5, "java.net.http": 1, "java.prefs": 0.1,
+	"java.rmi": 0.4, "java.scripting": 0.1, "java.security.jgss": 0.7, "java.sql": 0.5,
+	"java.xml": 4, "java.xml.crypto": 1, "jdk.crypto.ec": 0.1, "jdk.jfr": 1.5,
+	"jdk.management": 0.2, "jdk.unsupported": 0.1, "jdk.zipfs": 0.1,
+}
+
+// Modules a typical server application needs: jdeps finds most of them,
+// jdk.crypto.ec (TLS) and jdk.zipfs are loaded by name.
+var (
+	serverModules = []string{
+		"java.base", "java.logging", "java.management", "java.naming", "java.net.http",
+		"java.security.jgss", "java.sql", "java.xml", "jdk.crypto.ec", "jdk.unsupported", "jdk.zipfs",
+	}
+	springBootModules = []string{
+		"java.base", "java.compiler", "java.desktop", "java.instrument", "java.management",
+		"java.naming", "java.net.http", "java.prefs", "java.rmi", "java.scripting",
+		"java.security.jgss", "java.sql", "jdk.crypto.ec", "jdk.jfr", "jdk.unsupported", "jdk.zipfs",
+	}
+)
+
+// JavaApp is a final stage that runs on a full JDK image.
+type JavaApp struct {
+	JDK     string // the JDK image the final stage is built on
+	Version int    // the Java version, 0 when the tag doesn't say
+	// Jar is the jar run with java -jar, absolute, or "".
+	Jar string
+	// Copy is the COPY of the final stage that puts Jar in the image, with
+	// Source the jar it copies from From, a stage or image, or the build
+	// context when empty. It is nil when the final stage isn't built on the
+	// JDK directly, or also runs JDK or build tools.
+	Copy   *Instruction
+	Source string
+	From   string
+	// SpringBoot is set when the Dockerfile mentions Spring.
+	SpringBoot bool
+	// Modules are the JDK modules the application likely needs.
+	Modules []string
+}
+
+// Linkable reports whether a jlink runtime built from the jar can replace
+// the JDK.
+func (a *JavaApp) Linkable() bool {
+	return a.Copy != nil && a.Version > 0
+}
+
+// Sizes returns the estimated size in MB of the JDK and of a jlink
+// runtime with the application's modules.
+func (a *JavaApp) Sizes() (jdk, runtime int) {
+	jdk = jdkSize + buildToolSizes[imageRepo(strings.ToLower(a.JDK))]
+	size := float64(jlinkBaseSize)
+	for _, m := range a.Modules {
+		size += moduleSizes[m]
+	}
+	return jdk, int(size + 0.5)
+}
+
+// JavaApp returns the Java application of the final stage when the image
+// runs on a full JDK, or nil.
+func (p *ParsedDockerfile) JavaApp() *JavaApp {
+	final := p.FinalStage()
+	base := p.runtimeBase()
+	version, ok := jdkImage(base)
+	if final < 0 || !ok || p.IsWindows() {
+		return nil
+	}
+	app := &JavaApp{JDK: base, Version: version, Modules: serverModules}
+	if p.healthPath() == "/actuator/health" {
+		app.SpringBoot, app.Modules = true, springBootModules
+	}
+
+	chain := p.StageChain(final)
+	walkWorkdir(chain, func(inst Instruction, workdir string) {
+		if inst.Command != "CMD" && inst.Command != "ENTRYPOINT" {
+			return
+		}
+		if m := javaJarRegex.FindStringSubmatch(inst.Args); m != nil {
+			app.Jar = m[1]
+			if !path.IsAbs(app.Jar) {
+				app.Jar = path.Join(workdir, app.Jar)
+			}
+		}
+	})
+	if app.Jar == "" || len(chain) > 1 {
+		return app
+	}
+	var jarCopy *Instruction
+	source := ""
+	tools := false
+	walkWorkdir(chain, func(inst Instruction, workdir string) {
+		switch inst.Command {
+		case "RUN":
+			tools = tools || jdkToolRegex.MatchString(inst.Args)
+		case "COPY", "ADD":
+			sources, dest, intoDir, ok := copyPaths(inst, workdir)
+			if !ok || len(sources) != 1 {
+				return
+			}
+			src := sources[0]
+			if dest == app.Jar && !intoDir || intoDir && !strings.ContainsAny(src, "*?[") && path.Join(dest, path.Base(src)) == app.Jar {
+				jarCopy, source = &inst, src
+			}
+		}
+	})
+	if !tools && jarCopy != nil && jarCopy.Command == "COPY" {
+		app.Copy, app.Source, app.From = jarCopy, source, copyFromFlag(*jarCopy)
+	}
+	return app
+}
+
+// --- JDKRuntimeRule ---
+
+type JDKRuntimeRule struct{}
+
+func (r *JDKRuntimeRule) ID() string { return "DIO032" }
+
+func (r *JDKRuntimeRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *JDKRuntimeRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	app := pdf.JavaApp()
+	if app == nil {
+		return nil
+	}
+	chain := pdf.StageChain(pdf.FinalStage())
+	jdk, runtime := app.Sizes()
+	suggestion := "Build a custom runtime with jdeps and jlink in a build stage and copy it into a slim image, or at least use a JRE image such as eclipse-temurin:21-jre."
+	if app.SpringBoot {
+		suggestion += " For Spring Boot, also extract the jar's layers (java -Djarmode=tools -jar app.jar extract --layers, or -Djarmode=layertools before Spring Boot 3.3) so dependencies get layers of their own."
+	}
+	return []models.Issue{{
+		ID:          r.ID(),
+		Severity:    models.SeverityMedium,
+		Category:    "optimization",
+		Title:       "Full JDK in the final image",
+		Description: fmt.Sprintf("The final image runs on %s, a JDK with compilers and tools of about %d MB. A jlink runtime with the %d modules the application likely needs is about %d MB.", app.JDK, jdk, len(app.Modules), runtime),
+		Line:        chain[len(chain)-1].StartLine,
+		Suggestion:  suggestion,
+		AutoFixable: app.Linkable(),
+	}}
+}
@@ -0,0 +1,177 @@
+package analyzer
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Image kinds: what an image is for. Some rules matter more for one kind
+// than another, so the kind adjusts the severity of their issues.
+const (
+	// KindService is a long-running server, such as a web API.
+	KindService = "service"
+	// KindJob is a batch job or CLI that runs to completion.
+	KindJob = "job"
+	// KindBaseImage is built on by other Dockerfiles rather than run.
+	KindBaseImage = "base-image"
+)
+
+// ImageKinds lists the image kinds.
+var ImageKinds = []string{KindService, KindJob, KindBaseImage}
+
+// defaultKindSeverities are the built-in severities of rules by image
+// kind, for the rules whose importance depends on it.
+var defaultKindSeverities = map[string]map[string]models.Severity{
+	KindService: {
+		// An orchestrator routes traffic to a hung server without one
+		"DIO012": models.SeverityHigh,
+	},
+	KindJob: {
+		// A job that hangs is caught by its timeout, not a health check
+		"DIO012": models.SeverityInfo,
+	},
+	KindBaseImage: {
+		// The images built on it set the user and health check they need
+		"DIO006": models.SeverityInfo,
+		"DIO012": models.SeverityInfo,
+		"DIO022": models.SeverityInfo,
+	},
+}
+
+// Values of image.kind besides the kinds: detect the kind, or leave every
+// rule at its own severity.
+const (
+	KindAuto = "auto"
+	KindNone = "none"
+)
+
+// validateImageConfig checks the image section of .dio.yaml.
+func validateImageConfig(cfg config.ImageConfig) error {
+	switch cfg.Kind {
+	case "", KindAuto, KindNone, KindService, KindJob, KindBaseImage:
+	default:
+		return fmt.Errorf("unknown image.kind %q (use auto, none, %s)", cfg.Kind, strings.Join(ImageKinds, ", "))
+	}
+	for kind, severities := range cfg.Severities {
+		if !isImageKind(kind) {
+			return fmt.Errorf("unknown image kind %q in image.severities (use %s)", kind, strings.Join(ImageKinds, ", "))
+		}
+		for id, s := range severities {
+			if _, err := models.ParseSeverity(s); err != nil {
+				return fmt.Errorf("image.severities.%s.%s: %w", kind, id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// kindSeverities returns the severities of rules for an image kind: the
+// built-in ones with those of the image.severities section of .dio.yaml
+// on top. Keys are rule IDs; hadolint codes such as DL3008 work too.
+func kindSeverities(cfg config.ImageConfig, kind string) map[string]models.Severity {
+	if kind == "" {
+		return nil
+	}
+	severities := make(map[string]models.Severity)
+	for id, sev := range defaultKindSeverities[kind] {
+		severities[id] = sev
+	}
+	for id, s := range cfg.Severities[kind] {
+		// Validated by validateImageConfig
+		severities[id], _ = models.ParseSeverity(s)
+	}
+	return severities
+}
+
+// imageKind returns the kind of image the Dockerfile at path builds: the
+// one declared in cfg, or the one ClassifyImage detects with the reasons
+// for it.
+func imageKind(cfg config.ImageConfig, pdf *ParsedDockerfile, path string) (string, []string) {
+	switch cfg.Kind {
+	case KindNone:
+		return "", nil
+	case "", KindAuto:
+		return ClassifyImage(pdf, path)
+	}
+	return cfg.Kind, nil
+}
+
+// baseNameRegex matches Dockerfile and directory names of base images,
+// such as Dockerfile.base, base.Dockerfile or base-images/.
+var baseNameRegex = regexp.MustCompile(`(?i)(^|[._-])base($|[._-])`)
+
+// ClassifyImage tells from the final stage of a Dockerfile whether it
+// builds a base image for other Dockerfiles to build on, and why. It
+// returns KindBaseImage or "" for an application image: telling services
+// from jobs takes knowing what the application does. A base image has
+// ONBUILD triggers, or no CMD, ENTRYPOINT or EXPOSE of its own and either
+// nothing copied in, only tooling installed with RUN, or a name that says
+// so. An application image usually inherits what it runs from its base
+// image when it sets none, but copies its files in.
+// path is the Dockerfile's, or "" when there is no file.
+func ClassifyImage(pdf *ParsedDockerfile, path string) (string, []string) {
+	if len(pdf.Stages) == 0 {
+		return "", nil
+	}
+	var onbuild, runs, copies bool
+	for _, stage := range pdf.StageChain(pdf.FinalStage()) {
+		for _, inst := range stage.Instructions {
+			switch inst.Command {
+			case "ONBUILD":
+				onbuild = true
+			case "CMD", "ENTRYPOINT", "EXPOSE":
+				runs = true
+			case "COPY", "ADD":
+				copies = true
+			}
+		}
+	}
+	if onbuild {
+		return KindBaseImage, []string{"ONBUILD triggers for the images built on it"}
+	}
+	if runs {
+		return "", nil
+	}
+	reasons := []string{"no CMD, ENTRYPOINT or EXPOSE"}
+	if !copies {
+		return KindBaseImage, append(reasons, "nothing copied in")
+	}
+	if path != "" {
+		for _, name := range []string{filepath.Base(path), filepath.Base(filepath.Dir(path))} {
+			if baseNameRegex.MatchString(name) {
+				return KindBaseImage, append(reasons, fmt.Sprintf("named %s", name))
+			}
+		}
+	}
+	return "", nil
+}
+
+func isImageKind(kind string) bool {
+	for _, k := range ImageKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// applyKindSeverities sets the severity of issues whose rule has one for
+// the image kind, keeping the rule's own in DefaultSeverity.
+func applyKindSeverities(issues []models.Issue, severities map[string]models.Severity) {
+	for i := range issues {
+		sev, ok := severities[issues[i].ID]
+		if !ok {
+			sev, ok = severities[strings.TrimPrefix(issues[i].ID, "HL-")]
+		}
+		if !ok || sev == issues[i].Severity {
+			continue
+		}
+		issues[i].DefaultSeverity = issues[i].Severity
+		issues[i].Severity = sev
+	}
+}
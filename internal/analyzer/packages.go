@@ -0,0 +1,232 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Package managers recognized in RUN instructions.
+const (
+	ManagerApt    = "apt"
+	ManagerApk    = "apk"
+	ManagerDnf    = "dnf" // also yum and microdnf
+	ManagerZypper = "zypper"
+)
+
+// PackageInstall is a package manager install command in a RUN instruction.
+type PackageInstall struct {
+	Manager  string
+	Packages []string // without version pins
+	// Virtual is the group name of apk add --virtual, which apk del removes
+	// as a whole.
+	Virtual string
+}
+
+// shellSeparatorRegex splits a shell script into commands. Continuation
+// lines are joined in Args, so newlines only separate the commands of a
+// heredoc script.
+var shellSeparatorRegex = regexp.MustCompile(`&&|\|\||;|\||\n`)
+
+// packageCommand returns the package manager and the arguments after the
+// verb of a package manager command, if the command's verb is one of verbs.
+func packageCommand(cmd string, verbs map[string][]string) (string, []string) {
+	fields := strings.Fields(cmd)
+	for len(fields) > 0 && (fields[0] == "sudo" || strings.Contains(fields[0], "=")) {
+		fields = fields[1:] // sudo, DEBIAN_FRONTEND=noninteractive
+	}
+	if len(fields) < 2 {
+		return "", nil
+	}
+	var manager string
+	switch fields[0] {
+	case "apt-get", "apt":
+		manager = ManagerApt
+	case "apk":
+		manager = ManagerApk
+	case "dnf", "yum", "microdnf":
+		manager = ManagerDnf
+	case "zypper":
+		manager = ManagerZypper
+	default:
+		return "", nil
+	}
+	for i, f := range fields[1:] {
+		if strings.HasPrefix(f, "-") {
+			continue
+		}
+		for _, verb := range verbs[manager] {
+			if f == verb {
+				return manager, fields[i+2:]
+			}
+		}
+		return "", nil
+	}
+	return "", nil
+}
+
+var (
+	installVerbs = map[string][]string{ManagerApt: {"install"}, ManagerApk: {"add"}, ManagerDnf: {"install"}, ManagerZypper: {"install", "in"}}
+	removeVerbs  = map[string][]string{ManagerApt: {"purge", "remove"}, ManagerApk: {"del"}, ManagerDnf: {"remove", "erase"}, ManagerZypper: {"remove", "rm"}}
+)
+
+// PackageInstalls returns the package install commands of a RUN script.
+func PackageInstalls(run string) []PackageInstall {
+	var installs []PackageInstall
+	for _, cmd := range shellSeparatorRegex.Split(run, -1) {
+		manager, args := packageCommand(cmd, installVerbs)
+		if manager == "" {
+			continue
+		}
+		install := PackageInstall{Manager: manager}
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			switch {
+			case arg == "--virtual" || arg == "-t":
+				if i+1 < len(args) {
+					i++
+					install.Virtual = args[i]
+				}
+			case strings.HasPrefix(arg, "--virtual="):
+				install.Virtual = strings.TrimPrefix(arg, "--virtual=")
+			case strings.HasPrefix(arg, "-") || strings.ContainsAny(arg, "$/`"):
+			default:
+				install.Packages = append(install.Packages, packageName(arg))
+			}
+		}
+		installs = append(installs, install)
+	}
+	return installs
+}
+
+// removedPackages returns the packages (and apk virtual groups) a RUN
+// script removes.
+func removedPackages(run string) map[string]bool {
+	removed := make(map[string]bool)
+	for _, cmd := range shellSeparatorRegex.Split(run, -1) {
+		if _, args := packageCommand(cmd, removeVerbs); args != nil {
+			for _, arg := range args {
+				if !strings.HasPrefix(arg, "-") {
+					removed[packageName(arg)] = true
+				}
+			}
+		}
+	}
+	return removed
+}
+
+// packageName strips a version pin: gcc=4:12.2, musl-dev~1.2 or
+// python3-dev>=3.11.
+func packageName(arg string) string {
+	if i := strings.IndexAny(arg, "=<>~"); i > 0 {
+		return arg[:i]
+	}
+	return arg
+}
+
+// buildOnlyPackages are packages only needed to compile software.
+var buildOnlyPackages = map[string]bool{
+	"build-essential": true, "build-base": true, "gcc": true, "g++": true, "gcc-c++": true,
+	"make": true, "cmake": true, "autoconf": true, "automake": true, "libtool": true,
+	"pkg-config": true, "pkgconf": true, "clang": true, "linux-headers": true,
+}
+
+// IsBuildOnlyPackage reports whether a package is only needed to compile
+// software: compilers, build tools and development headers (-dev, -devel).
+func IsBuildOnlyPackage(name string) bool {
+	return buildOnlyPackages[name] || strings.HasSuffix(name, "-dev") || strings.HasSuffix(name, "-devel")
+}
+
+// LeftoverBuildPackages returns the build-only packages a RUN script
+// installs and doesn't remove again, grouped by install command.
+func LeftoverBuildPackages(run string) []PackageInstall {
+	removed := removedPackages(run)
+	var leftover []PackageInstall
+	for _, install := range PackageInstalls(run) {
+		if install.Virtual != "" && removed[install.Virtual] {
+			continue
+		}
+		build := PackageInstall{Manager: install.Manager}
+		for _, pkg := range install.Packages {
+			if IsBuildOnlyPackage(pkg) && !removed[pkg] {
+				build.Packages = append(build.Packages, pkg)
+			}
+		}
+		if len(build.Packages) > 0 {
+			leftover = append(leftover, build)
+		}
+	}
+	return leftover
+}
+
+// RemoveCommand returns the command that removes packages installed with
+// the given manager. apt autoremoves what they pulled in unless a -dev
+// package is among them, whose runtime library the application likely
+// needs.
+func RemoveCommand(manager string, pkgs []string) string {
+	list := strings.Join(pkgs, " ")
+	switch manager {
+	case ManagerApk:
+		return "apk del " + list
+	case ManagerDnf:
+		return "dnf remove -y " + list
+	case ManagerZypper:
+		return "zypper --non-interactive remove " + list
+	}
+	for _, pkg := range pkgs {
+		if strings.HasSuffix(pkg, "-dev") {
+			return "apt-get purge -y " + list
+		}
+	}
+	return "apt-get purge -y --auto-remove " + list
+}
+
+func isAre(n int) string {
+	if n == 1 {
+		return "is"
+	}
+	return "are"
+}
+
+// --- BuildPackagesRule ---
+
+type BuildPackagesRule struct{}
+
+func (r *BuildPackagesRule) ID() string { return "DIO018" }
+
+func (r *BuildPackagesRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *BuildPackagesRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	if pdf.FinalStage() < 0 {
+		return nil
+	}
+	var issues []models.Issue
+	for _, inst := range pdf.finalInstructions() {
+		if inst.Command != "RUN" {
+			continue
+		}
+		var pkgs, fixes []string
+		for _, install := range LeftoverBuildPackages(inst.Args) {
+			pkgs = append(pkgs, install.Packages...)
+			fixes = append(fixes, RemoveCommand(install.Manager, install.Packages))
+		}
+		if len(pkgs) == 0 {
+			continue
+		}
+		suggestion := "Install and use them in a builder stage and copy only the result, or remove them at the end of the same RUN: " + strings.Join(fixes, " && ")
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityMedium,
+			Category:    "optimization",
+			Title:       "Build-only packages in the final image",
+			Description: fmt.Sprintf("%s %s only needed to compile software, but stay in the final image.", strings.Join(pkgs, ", "), isAre(len(pkgs))),
+			Line:        inst.Line,
+			Suggestion:  suggestion,
+			AutoFixable: true,
+		})
+	}
+	return issues
+}
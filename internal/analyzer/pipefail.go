@@ -0,0 +1,247 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+var (
+	// quotedRegex matches quoted strings, whose pipes and semicolons are
+	// text rather than shell syntax.
+	quotedRegex = regexp.MustCompile(`'[^']*'|"(?:[^"\\]|\\.)*"`)
+	// pipeRegex matches a pipe, but not ||.
+	pipeRegex = regexp.MustCompile(`(^|[^|\\])\|([^|]|$)`)
+	// errexitRegex matches a set -e, or a shell started with -e.
+	errexitRegex = regexp.MustCompile(`(?:^|[\s;&|(])set\s+(?:[-+][a-zA-Z]+\s+)*-[a-zA-Z]*e|set\s+-o\s+errexit|\b(?:ba|da|a|k)?sh\s+-[a-zA-Z]*e`)
+	// compoundRegex matches shell compound commands and subshells, in which
+	// a ; is syntax rather than a sequence of commands.
+	compoundRegex = regexp.MustCompile(`\b(?:if|for|while|until|case|function)\b|[{}()]`)
+	// continuedRegex matches the end of a script line whose command goes on
+	// on the next line.
+	continuedRegex = regexp.MustCompile(`(?:\\|&&|\|\||\||\{|\(|\bthen|\bdo|\belse)\s*$`)
+)
+
+// bashImageHints identify images that ship bash and whose /bin/sh is
+// dash, like Debian, Ubuntu and the official language images built on
+// them.
+var bashImageHints = []string{
+	"debian", "ubuntu", "bookworm", "bullseye", "trixie", "jammy", "noble", "focal",
+	"golang", "rust", "python", "node", "openjdk", "eclipse-temurin", "maven", "gradle",
+	"ruby", "php", "buildpack-deps", "nvidia/cuda",
+}
+
+// bashShImageHints identify images whose /bin/sh is bash.
+var bashShImageHints = []string{
+	"fedora", "centos", "rockylinux", "almalinux", "amazonlinux", "oraclelinux", "ubi8", "ubi9",
+}
+
+// LenientRun is a shell-form RUN whose script can fail without failing the
+// build, because the shell only reports the exit status of its last
+// command.
+type LenientRun struct {
+	Stage int
+	Run   Instruction
+	// Pipe is set when the script pipes commands without pipefail, so a
+	// failed download piped to tar or sh goes unnoticed.
+	Pipe bool
+	// Sequence is set when the script runs several commands one after the
+	// other without set -e.
+	Sequence bool
+	// Heredoc is set when the script is the body of a heredoc.
+	Heredoc bool
+	// Shell is the shell SHELL selects, such as bash, or "" for the
+	// default /bin/sh.
+	Shell string
+	// Bash is set when the image is known to ship bash.
+	Bash bool
+	// ShPipefail is set when the /bin/sh of the image is known to support
+	// set -o pipefail: busybox ash, or bash.
+	ShPipefail bool
+}
+
+// Pipefail reports whether the shell running the script supports
+// set -o pipefail.
+func (r LenientRun) Pipefail() bool {
+	switch r.Shell {
+	case "", "sh":
+		return r.ShPipefail
+	case "bash", "ash", "ksh", "zsh":
+		return true
+	}
+	return false
+}
+
+// Fixable reports whether the script can be made strict: set -e works in
+// every POSIX shell, pipefail needs a shell that supports it or bash to
+// switch to.
+func (r LenientRun) Fixable() bool {
+	return !r.Pipe || r.Pipefail() || (r.Shell == "" && r.Bash)
+}
+
+// imageShells reports whether an image is known to ship bash, and whether
+// its /bin/sh supports set -o pipefail.
+func imageShells(image string) (bash, shPipefail bool) {
+	image = strings.ToLower(image)
+	switch {
+	case strings.Contains(image, "alpine"), strings.Contains(image, "busybox"):
+		return false, true
+	case containsAnyOf(image, bashShImageHints):
+		return true, true
+	case containsAnyOf(image, bashImageHints):
+		return true, false
+	}
+	return false, false
+}
+
+// strictShell is the shell a RUN runs in: the command SHELL selects and
+// whether its options already make scripts strict.
+type strictShell struct {
+	name     string
+	posix    bool
+	pipefail bool
+	errexit  bool
+}
+
+func parseStrictShell(args string) strictShell {
+	s := strictShell{posix: isPOSIXShell(args), pipefail: strings.Contains(args, "pipefail")}
+	var argv []string
+	if err := json.Unmarshal([]byte(args), &argv); err != nil || len(argv) == 0 {
+		return s
+	}
+	s.name = path.Base(argv[0])
+	for _, arg := range argv[1:] {
+		if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "e") {
+			s.errexit = true
+		}
+	}
+	return s
+}
+
+// LenientRuns returns the shell-form RUNs whose scripts can fail without
+// failing the build. Windows stages and shells other than POSIX ones are
+// left out.
+func (p *ParsedDockerfile) LenientRuns() []LenientRun {
+	var runs []LenientRun
+	shells := make([]strictShell, len(p.Stages))
+	for i, stage := range p.Stages {
+		shell := strictShell{posix: true}
+		if parent := p.resolveStageRef(i, stage.BaseImage); parent >= 0 {
+			shell = shells[parent]
+		} else if IsWindowsImage(stage.BaseImage) {
+			shell.posix = false
+		}
+		chain := p.StageChain(i)
+		bash, shPipefail := imageShells(chain[len(chain)-1].BaseImage)
+		for _, inst := range stage.Instructions {
+			switch inst.Command {
+			case "SHELL":
+				shell = parseStrictShell(inst.Args)
+			case "RUN":
+				if !shell.posix || isExecForm(inst.Args) {
+					continue
+				}
+				run := LenientRun{Stage: i, Run: inst, Shell: shell.name, Bash: bash, ShPipefail: shPipefail}
+				script, sequence, ok := lenientScript(inst)
+				if !ok {
+					continue
+				}
+				run.Heredoc = len(inst.Heredocs) > 0
+				stripped := quotedRegex.ReplaceAllString(script, "")
+				run.Pipe = !shell.pipefail && !strings.Contains(script, "pipefail") && pipeRegex.MatchString(stripped)
+				run.Sequence = !shell.errexit && !errexitRegex.MatchString(inst.Args) && sequence
+				if run.Pipe || run.Sequence {
+					runs = append(runs, run)
+				}
+			}
+		}
+		shells[i] = shell
+	}
+	return runs
+}
+
+// lenientScript returns the shell script of a RUN and whether it runs
+// several commands in sequence. It returns false for heredocs run by
+// interpreters other than a shell.
+func lenientScript(inst Instruction) (string, bool, bool) {
+	if len(inst.Heredocs) == 0 {
+		flat := quotedRegex.ReplaceAllString(inst.Args, "")
+		flat = strings.NewReplacer(`\;`, "", ";;", "").Replace(flat)
+		return inst.Args, strings.Contains(flat, ";") && !compoundRegex.MatchString(flat), true
+	}
+
+	command := strings.TrimSpace(strings.SplitN(inst.Args, "\n", 2)[0])
+	if len(inst.Heredocs) > 1 || !shellHeredocRegex.MatchString(command) {
+		// The heredoc is data, such as the content of a file
+		return command, false, true
+	}
+	if m := shellHeredocRegex.FindStringSubmatch(command); m[1] != "" && shellDialects[path.Base(m[1])] == "" {
+		return "", false, false
+	}
+	body := inst.Heredocs[0]
+	if m := shebangRegex.FindStringSubmatch(body); m != nil && strings.HasPrefix(body, "#!") && shellDialects[path.Base(m[1])] == "" {
+		return "", false, false
+	}
+	commands, continued := 0, false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !continued {
+			commands++
+		}
+		continued = continuedRegex.MatchString(line)
+	}
+	return body, commands > 1, true
+}
+
+// --- StrictShellRule ---
+
+type StrictShellRule struct{}
+
+func (r *StrictShellRule) ID() string { return "DIO038" }
+
+func (r *StrictShellRule) Check(ctx *AnalysisContext) []models.Issue {
+	var issues []models.Issue
+	for _, run := range ctx.ParsedFile.LenientRuns() {
+		var problems, fixes []string
+		if run.Pipe {
+			problems = append(problems, "The RUN pipes commands without pipefail, so only the exit status of the last command of the pipeline counts: a failed curl piped to tar or sh still builds.")
+			switch {
+			case run.Pipefail():
+				fixes = append(fixes, "set -o pipefail")
+			case run.Shell == "" && run.Bash:
+				fixes = append(fixes, `SHELL ["/bin/bash", "-o", "pipefail", "-c"] before the RUN`)
+			default:
+				fixes = append(fixes, "a shell that supports pipefail, such as bash")
+			}
+		}
+		if run.Sequence {
+			subject := "The RUN runs"
+			if run.Pipe {
+				subject = "It also runs"
+			}
+			problems = append(problems, subject+" several commands without set -e, so only the exit status of the last one counts.")
+			fixes = append(fixes, "set -eux at the start of the script")
+		}
+		title := "RUN pipeline can fail without failing the build"
+		if !run.Pipe {
+			title = "RUN commands can fail without failing the build"
+		}
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityMedium,
+			Category:    "best-practice",
+			Title:       title,
+			Description: strings.Join(problems, " ") + " The image then builds without what the step should have added.",
+			Line:        run.Run.Line,
+			Suggestion:  "Make the shell strict: " + strings.Join(fixes, ", and ") + ".",
+			AutoFixable: run.Fixable(),
+		})
+	}
+	return issues
+}
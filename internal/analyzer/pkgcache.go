@@ -0,0 +1,203 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Install commands of the package managers, up to their verb.
+var (
+	aptInstallRegex      = regexp.MustCompile(`\bapt-get\s+(?:-\S+\s+)*install\b`)
+	apkAddRegex          = regexp.MustCompile(`\bapk\s+(?:-\S+\s+)*add\b`)
+	dnfInstallRegex      = regexp.MustCompile(`\bdnf\s+(?:-\S+\s+)*install\b`)
+	microdnfInstallRegex = regexp.MustCompile(`\bmicrodnf\s+(?:-\S+\s+)*install\b`)
+	yumInstallRegex      = regexp.MustCompile(`\byum\s+(?:-\S+\s+)*install\b`)
+	zypperInstallRegex   = regexp.MustCompile(`\bzypper\s+(?:-\S+\s+)*(?:install|in)\b`)
+	npmInstallRegex      = regexp.MustCompile(`\bnpm\s+(?:-\S+\s+)*(?:install|i|ci|add)\b`)
+	// yarnInstallRegex matches yarn install, yarn add, and a bare yarn,
+	// which installs too.
+	yarnInstallRegex = regexp.MustCompile(`\byarn\s+(?:global\s+)?(?:install|add)\b|\byarn\s+--(?:frozen-lockfile|pure-lockfile|production)\b|\byarn\s*(?:$|&&|;)`)
+)
+
+// InstallOption is an option of a package manager's install command.
+type InstallOption struct {
+	Tool   string
+	Option string
+	// install matches the install commands, and set the option or an
+	// equivalent spelling.
+	install, set *regexp.Regexp
+}
+
+// Missing returns the offsets in script right after the verb of each
+// install command that lacks the option, where the option goes.
+func (o InstallOption) Missing(script string) []int {
+	var offsets []int
+	for _, m := range o.install.FindAllStringIndex(script, -1) {
+		if !o.set.MatchString(script[m[1] : m[1]+commandEnd(script[m[1]:])]) {
+			offsets = append(offsets, m[1])
+		}
+	}
+	return offsets
+}
+
+// commandEnd returns the length of the first command of a script. Newlines
+// end commands unless they are escaped.
+func commandEnd(script string) int {
+	for i := 0; i < len(script); i++ {
+		switch script[i] {
+		case ';', '|':
+			return i
+		case '&':
+			if i+1 < len(script) && script[i+1] == '&' {
+				return i
+			}
+		case '\n':
+			if i == 0 || script[i-1] != '\\' {
+				return i
+			}
+		}
+	}
+	return len(script)
+}
+
+// WeakDependencyOptions are the install options that leave out recommended
+// and weak dependencies, which package managers install by default.
+var WeakDependencyOptions = []InstallOption{
+	{Tool: "apt-get", Option: "--no-install-recommends", install: aptInstallRegex, set: regexp.MustCompile(`--no-install-recommends|APT::Install-Recommends=(?:false|0)`)},
+	{Tool: "dnf", Option: "--setopt=install_weak_deps=False", install: dnfInstallRegex, set: regexp.MustCompile(`install_weak_deps=(?:False|false|0)`)},
+	{Tool: "microdnf", Option: "--setopt=install_weak_deps=0", install: microdnfInstallRegex, set: regexp.MustCompile(`install_weak_deps=(?:False|false|0)`)},
+	{Tool: "zypper", Option: "--no-recommends", install: zypperInstallRegex, set: regexp.MustCompile(`--no-recommends`)},
+}
+
+// PackageCache is the cache a package manager fills when it installs, and
+// how to keep it out of the layer of the RUN.
+type PackageCache struct {
+	Tool string
+	// Dir is where the cache lives. A cache mount there keeps it out of the
+	// layer.
+	Dir string
+	// Option is the install option that keeps no cache, when there is one.
+	Option *InstallOption
+	// Clean is the command that removes the cache after the install.
+	Clean string
+	// Install matches the install commands.
+	Install *regexp.Regexp
+	// uses matches the commands that fill the cache, when other commands
+	// than installs do, and cleaned the ones that remove it.
+	uses, cleaned *regexp.Regexp
+	// shippedOnly is set for the caches of language package managers,
+	// which mostly install in build stages whose caches never reach the
+	// image.
+	shippedOnly bool
+}
+
+var packageCaches = []PackageCache{
+	{
+		Tool: "apt-get", Dir: "/var/lib/apt/lists", Clean: "rm -rf /var/lib/apt/lists/*", Install: aptInstallRegex,
+		uses:    regexp.MustCompile(`\bapt-get\s+(?:-\S+\s+)*(?:install|update)\b`),
+		cleaned: regexp.MustCompile(`rm\s+-\w+\s+/var/lib/apt/lists|\bapt-get\s+(?:clean|autoremove)\b`),
+	},
+	{
+		Tool: "apk", Dir: "/var/cache/apk", Install: apkAddRegex,
+		Option:  &InstallOption{Tool: "apk", Option: "--no-cache", install: apkAddRegex, set: regexp.MustCompile(`--no-cache(?:\s|$)`)},
+		cleaned: regexp.MustCompile(`--no-cache(?:\s|$)|rm\s+-\w+\s+/var/cache/apk|\bapk\s+cache\s+clean\b`),
+	},
+	{
+		Tool: "dnf", Dir: "/var/cache/dnf", Clean: "dnf clean all", Install: dnfInstallRegex,
+		cleaned: regexp.MustCompile(`\bdnf\s+clean\s+all\b|rm\s+-\w+\s+/var/cache/(?:dnf|yum)`),
+	},
+	{
+		Tool: "microdnf", Dir: "/var/cache/yum", Clean: "microdnf clean all", Install: microdnfInstallRegex,
+		cleaned: regexp.MustCompile(`\bmicrodnf\s+clean\s+all\b|rm\s+-\w+\s+/var/cache/(?:dnf|yum)`),
+	},
+	{
+		Tool: "yum", Dir: "/var/cache/yum", Clean: "yum clean all", Install: yumInstallRegex,
+		cleaned: regexp.MustCompile(`\byum\s+clean\s+all\b|rm\s+-\w+\s+/var/cache/yum`),
+	},
+	{
+		Tool: "zypper", Dir: "/var/cache/zypp", Clean: "zypper clean --all", Install: zypperInstallRegex,
+		cleaned: regexp.MustCompile(`\bzypper\s+(?:-\S+\s+)*(?:clean|cc)\b|rm\s+-\w+\s+/var/cache/zypp`),
+	},
+	{
+		Tool: "npm", Dir: "/root/.npm", Clean: "npm cache clean --force", Install: npmInstallRegex, shippedOnly: true,
+		cleaned: regexp.MustCompile(`\bnpm\s+cache\s+clean\b|rm\s+-\w+\s+\S*/\.npm\b`),
+	},
+	{
+		Tool: "yarn", Dir: "/usr/local/share/.cache/yarn", Clean: "yarn cache clean", Install: yarnInstallRegex, shippedOnly: true,
+		cleaned: regexp.MustCompile(`\byarn\s+cache\s+clean\b|rm\s+-\w+\s+\S*/\.cache/yarn`),
+	},
+}
+
+// UncleanedCaches returns the package manager caches a RUN leaves in its
+// layer. npm and yarn caches only count in the stages of the final image.
+func (p *ParsedDockerfile) UncleanedCaches(inst Instruction) []PackageCache {
+	shipped := false
+	for _, final := range p.finalInstructions() {
+		if final.Line == inst.Line {
+			shipped = true
+		}
+	}
+	var caches []PackageCache
+	for _, c := range packageCaches {
+		uses := c.uses
+		if uses == nil {
+			uses = c.Install
+		}
+		if c.shippedOnly && !shipped {
+			continue
+		}
+		if uses.MatchString(inst.Args) && !c.cleaned.MatchString(inst.Args) && !cacheMounted(inst, c.Dir) {
+			caches = append(caches, c)
+		}
+	}
+	return caches
+}
+
+// Fix returns how to keep the cache out of the layer.
+func (c PackageCache) Fix() string {
+	if c.Option != nil {
+		return "Use " + c.Option.Tool + " add " + c.Option.Option + "."
+	}
+	return "Add '&& " + c.Clean + "' to the same RUN command."
+}
+
+// dnfVersionRegex matches the version dnf and yum accept after a package
+// name: python3-3.11.2, or curl-8.2.1-1.fc39.
+var dnfVersionRegex = regexp.MustCompile(`-\d[\w.+~^]*(?:-\d[\w.+~^]*)?$`)
+
+// UnpinnedPackages returns the packages a RUN script installs without a
+// version, grouped by install command.
+func UnpinnedPackages(run string) []PackageInstall {
+	var unpinned []PackageInstall
+	for _, cmd := range shellSeparatorRegex.Split(run, -1) {
+		manager, args := packageCommand(cmd, installVerbs)
+		if manager == "" {
+			continue
+		}
+		install := PackageInstall{Manager: manager}
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			switch {
+			case arg == "--virtual" || arg == "-t" || arg == "--repo" || arg == "-r":
+				i++
+			case strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "@") || strings.ContainsAny(arg, "$/`"):
+			case strings.ContainsAny(arg, "=<>~"):
+			case manager == ManagerDnf && dnfVersionRegex.MatchString(arg):
+			default:
+				install.Packages = append(install.Packages, arg)
+			}
+		}
+		if len(install.Packages) > 0 {
+			unpinned = append(unpinned, install)
+		}
+	}
+	return unpinned
+}
+
+// pinExamples show how each package manager pins a version.
+var pinExamples = map[string]string{
+	ManagerApt:    "curl=7.88.1-10+deb12u5",
+	ManagerApk:    "curl=8.5.0-r0",
+	ManagerDnf:    "curl-8.2.1",
+	ManagerZypper: "curl=8.0.1",
+}
@@ -0,0 +1,207 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- RootReescalationRule ---
+
+type RootReescalationRule struct{}
+
+func (r *RootReescalationRule) ID() string { return "DIO020" }
+
+func (r *RootReescalationRule) Scope() RuleScope { return ScopeFinalStage }
+
+// Check flags USER root after the final stage dropped privileges. A final
+// USER root that is never dropped again is reported by DIO006.
+func (r *RootReescalationRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	if pdf.FinalStage() < 0 || pdf.IsWindows() {
+		return nil
+	}
+	var issues []models.Issue
+	dropped, escalated := 0, 0 // lines of the USER instructions
+	escalatedTo := ""
+	for _, inst := range pdf.finalInstructions() {
+		if inst.Command != "USER" {
+			continue
+		}
+		user := strings.TrimSpace(inst.Args)
+		switch {
+		case IsRootUser(user):
+			if dropped > 0 && escalated == 0 {
+				escalated, escalatedTo = inst.Line, user
+			}
+		case escalated > 0:
+			issues = append(issues, models.Issue{
+				ID:          r.ID(),
+				Severity:    models.SeverityLow,
+				Category:    "security",
+				Title:       "Root regained after dropping privileges",
+				Description: fmt.Sprintf("USER %s switches back to root after USER on line %d dropped privileges; the instructions up to line %d run as root again.", escalatedTo, dropped, inst.Line),
+				Line:        escalated,
+				Suggestion:  "Do the work that needs root before the first non-root USER, and use COPY --chown or --chmod instead of switching to root to fix ownership.",
+			})
+			dropped, escalated = inst.Line, 0
+		default:
+			dropped = inst.Line
+		}
+	}
+	return issues
+}
+
+// symbolicSetIDRegex matches a chmod clause that sets the setuid or setgid
+// bit: u+s, g+s, +s, ug=rwxs.
+var symbolicSetIDRegex = regexp.MustCompile(`^[ugoa]*[+=][rwxXt]*s`)
+
+var octalModeRegex = regexp.MustCompile(`^[0-7]{4}$`)
+
+// setsIDBit reports whether a chmod mode sets the setuid or setgid bit.
+func setsIDBit(mode string) bool {
+	if octalModeRegex.MatchString(mode) {
+		return mode[0] != '0' && mode[0] != '1'
+	}
+	for _, clause := range strings.Split(mode, ",") {
+		if strings.HasPrefix(clause, "o") {
+			continue // o+s has no effect
+		}
+		if symbolicSetIDRegex.MatchString(clause) {
+			return true
+		}
+	}
+	return false
+}
+
+// setIDModes returns the setuid and setgid modes an instruction applies
+// with chmod in RUN or --chmod in COPY and ADD.
+func setIDModes(inst Instruction) []string {
+	var modes []string
+	switch inst.Command {
+	case "RUN":
+		for _, cmd := range shellSeparatorRegex.Split(inst.Args, -1) {
+			fields := strings.Fields(cmd)
+			if len(fields) > 0 && fields[0] == "sudo" {
+				fields = fields[1:]
+			}
+			if len(fields) < 2 || fields[0] != "chmod" {
+				continue
+			}
+			for _, f := range fields[1:] {
+				if strings.HasPrefix(f, "-") {
+					continue // -R; -s clears the bits
+				}
+				if setsIDBit(f) {
+					modes = append(modes, f)
+				}
+				break
+			}
+		}
+	case "COPY", "ADD":
+		for _, f := range strings.Fields(inst.Args) {
+			if mode, ok := strings.CutPrefix(f, "--chmod="); ok && setsIDBit(mode) {
+				modes = append(modes, mode)
+			}
+		}
+	}
+	return modes
+}
+
+// --- SetIDRule ---
+
+type SetIDRule struct{}
+
+func (r *SetIDRule) ID() string { return "DIO021" }
+
+func (r *SetIDRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *SetIDRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	if pdf.FinalStage() < 0 || pdf.IsWindows() {
+		return nil
+	}
+	var issues []models.Issue
+	for _, inst := range pdf.finalInstructions() {
+		modes := setIDModes(inst)
+		if len(modes) == 0 {
+			continue
+		}
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityMedium,
+			Category:    "security",
+			Title:       "Setuid or setgid bit set",
+			Description: fmt.Sprintf("%s sets the setuid or setgid bit (%s), so any user running the file gains its owner's or group's privileges.", inst.Command, strings.Join(modes, ", ")),
+			Line:        inst.Line,
+			Suggestion:  "Grant only the capabilities the binary needs with setcap instead, or run it as its own user. Kubernetes blocks setuid escalation with allowPrivilegeEscalation: false.",
+		})
+	}
+	return issues
+}
+
+// wellKnownUIDs are the UIDs of users that common base images define.
+var wellKnownUIDs = map[string]string{
+	"nobody":  "65534",
+	"nonroot": "65532", // distroless
+	"node":    "1000",
+}
+
+// userIDRegex matches the UID given to a user created with useradd -u or
+// adduser -u/--uid; the user name is the last argument.
+var userIDRegex = regexp.MustCompile(`\b(?:useradd|adduser)\b[^&|;]*?(?:-u|--uid)[ =]?(\d+)[^&|;]*?\s([a-z_][a-z0-9_-]*)\s*(?:$|&&|\|\||;)`)
+
+var numericIDRegex = regexp.MustCompile(`^\d+$`)
+
+// --- NumericUserRule ---
+
+type NumericUserRule struct{}
+
+func (r *NumericUserRule) ID() string { return "DIO022" }
+
+func (r *NumericUserRule) Scope() RuleScope { return ScopeFinalStage }
+
+// Check flags a final USER given by name. Kubernetes can only enforce
+// runAsNonRoot for an image whose user is numeric; it refuses to start the
+// container otherwise, unless the pod sets runAsUser.
+func (r *NumericUserRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	if pdf.FinalStage() < 0 || pdf.IsWindows() {
+		return nil
+	}
+	user, line := pdf.EffectiveUser()
+	if user == "" || IsRootUser(user) || strings.Contains(user, "$") {
+		return nil
+	}
+	name, group, _ := strings.Cut(user, ":")
+	if numericIDRegex.MatchString(name) && (group == "" || numericIDRegex.MatchString(group)) {
+		return nil
+	}
+
+	uid := wellKnownUIDs[name]
+	for _, inst := range pdf.finalInstructions() {
+		if inst.Command != "RUN" {
+			continue
+		}
+		for _, m := range userIDRegex.FindAllStringSubmatch(inst.Args, -1) {
+			if m[2] == name {
+				uid = m[1]
+			}
+		}
+	}
+	suggestion := "Use the numeric UID (and GID), e.g. USER 10001:10001, so runAsNonRoot can verify the user."
+	if uid != "" {
+		suggestion = fmt.Sprintf("Use the numeric UID of %s: USER %s, so runAsNonRoot can verify the user.", name, uid)
+	}
+	return []models.Issue{{
+		ID:          r.ID(),
+		Severity:    models.SeverityLow,
+		Category:    "security",
+		Title:       "USER is not numeric",
+		Description: fmt.Sprintf("USER %s names the user. Kubernetes can't tell that a named user isn't root, so pods with runAsNonRoot: true refuse to start the image unless they also set runAsUser.", user),
+		Line:        line,
+		Suggestion:  suggestion,
+	}}
+}
@@ -0,0 +1,249 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// PipInstall is a pip install command in a RUN instruction.
+type PipInstall struct {
+	// Command is the command as written, from pip (or python -m pip) on.
+	Command string
+	// Packages are the names of the packages installed, lowercase and
+	// without extras or version specifiers.
+	Packages     []string
+	Requirements []string // -r files
+	Constraints  []string // -c files
+	IndexURL     string   // --index-url
+	NoCacheDir   bool
+	// Local is set when the command installs a local project or path, such
+	// as pip install . or -e ./lib.
+	Local bool
+}
+
+// pipCommandRegex matches a pip install command, after any sudo and
+// environment assignments, and captures its arguments.
+var pipCommandRegex = regexp.MustCompile(`^(?:sudo\s+)?(?:[A-Za-z_]\w*=\S*\s+)*((?:pip[\d.]*|python[\d.]*\s+-m\s+pip)\s+install)(\s.*)?$`)
+
+// pipValueOptions are pip install options that take a value.
+var pipValueOptions = map[string]bool{
+	"-r": true, "--requirement": true, "-c": true, "--constraint": true,
+	"-i": true, "--index-url": true, "--extra-index-url": true, "-f": true, "--find-links": true,
+	"-t": true, "--target": true, "--prefix": true, "--root": true, "--src": true,
+	"--platform": true, "--python-version": true, "--implementation": true, "--abi": true,
+	"--trusted-host": true, "-e": true, "--editable": true, "--only-binary": true, "--no-binary": true,
+	"--upgrade-strategy": true, "--progress-bar": true, "--root-user-action": true,
+}
+
+// packageSpecEnd finds where the name of a requirement specifier ends.
+var packageSpecEnd = regexp.MustCompile(`[\[<>=!~;@ ]`)
+
+// PipInstalls returns the pip install commands of a RUN script.
+func PipInstalls(run string) []PipInstall {
+	var installs []PipInstall
+	for _, cmd := range shellSeparatorRegex.Split(run, -1) {
+		cmd = strings.TrimSpace(strings.ReplaceAll(cmd, "\\\n", " "))
+		m := pipCommandRegex.FindStringSubmatch(cmd)
+		if m == nil {
+			continue
+		}
+		install := PipInstall{Command: strings.TrimSpace(cmd[strings.Index(cmd, m[1]):])}
+		args := strings.Fields(m[2])
+		for i := 0; i < len(args); i++ {
+			arg := strings.Trim(args[i], `"'`)
+			opt, value, hasValue := strings.Cut(arg, "=")
+			if !strings.HasPrefix(arg, "-") {
+				if strings.HasPrefix(arg, ".") || strings.HasPrefix(arg, "/") || strings.Contains(arg, "://") {
+					install.Local = true
+					continue
+				}
+				name := arg
+				if loc := packageSpecEnd.FindStringIndex(name); loc != nil {
+					name = name[:loc[0]]
+				}
+				install.Packages = append(install.Packages, strings.ReplaceAll(strings.ToLower(name), "_", "-"))
+				continue
+			}
+			if !strings.HasPrefix(arg, "--") {
+				// -rrequirements.txt
+				if len(arg) > 2 && pipValueOptions[arg[:2]] {
+					opt, value, hasValue = arg[:2], arg[2:], true
+				} else {
+					opt, hasValue = arg, false
+				}
+			}
+			if !hasValue && pipValueOptions[opt] && i+1 < len(args) {
+				i++
+				value = strings.Trim(args[i], `"'`)
+			}
+			switch opt {
+			case "--no-cache-dir":
+				install.NoCacheDir = true
+			case "-r", "--requirement":
+				install.Requirements = append(install.Requirements, value)
+			case "-c", "--constraint":
+				install.Constraints = append(install.Constraints, value)
+			case "-i", "--index-url":
+				install.IndexURL = value
+			case "-e", "--editable":
+				install.Local = install.Local || !strings.Contains(value, "://")
+			}
+		}
+		installs = append(installs, install)
+	}
+	return installs
+}
+
+// mlPackages are Python packages of ML frameworks and their GPU runtimes,
+// each hundreds of MB to GBs of wheels.
+var mlPackages = map[string]bool{
+	"torch": true, "torchvision": true, "torchaudio": true, "xformers": true, "triton": true,
+	"tensorflow": true, "tensorflow-gpu": true, "tensorflow-cpu": true, "tf-nightly": true,
+	"jax": true, "jaxlib": true, "paddlepaddle": true, "paddlepaddle-gpu": true, "mxnet": true,
+	"onnxruntime-gpu": true, "vllm": true, "deepspeed": true, "flash-attn": true,
+	"cupy-cuda11x": true, "cupy-cuda12x": true,
+}
+
+// nvidiaWheelRegex matches the CUDA libraries published as wheels, such as
+// nvidia-cudnn-cu12.
+var nvidiaWheelRegex = regexp.MustCompile(`^nvidia-[a-z-]+-cu\d+$`)
+
+// IsMLPackage reports whether a Python package is part of a heavy ML stack.
+func IsMLPackage(name string) bool {
+	return mlPackages[name] || nvidiaWheelRegex.MatchString(name)
+}
+
+// mlBaseImage reports whether an image is made for ML workloads: CUDA,
+// framework and NGC images, whose requirements files are likely ML stacks.
+func mlBaseImage(image string) bool {
+	image = strings.ToLower(image)
+	if _, ok := cudaTag(image); ok {
+		return true
+	}
+	return strings.HasPrefix(image, "pytorch/") || strings.HasPrefix(image, "tensorflow/") || strings.HasPrefix(image, "nvcr.io/nvidia/")
+}
+
+// torchBaseImage reports whether an image ships PyTorch.
+func torchBaseImage(image string) bool {
+	image = strings.ToLower(image)
+	return strings.HasPrefix(image, "pytorch/pytorch") || strings.HasPrefix(image, "nvcr.io/nvidia/pytorch")
+}
+
+// mlPackagesOf returns the ML packages a pip install command installs.
+func mlPackagesOf(install PipInstall) []string {
+	var pkgs []string
+	for _, pkg := range install.Packages {
+		if IsMLPackage(pkg) {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs
+}
+
+// --- PipMLStackRule ---
+
+type PipMLStackRule struct{}
+
+func (r *PipMLStackRule) ID() string { return "DIO028" }
+
+func (r *PipMLStackRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *PipMLStackRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	mlBase := mlBaseImage(pdf.runtimeBase())
+	var issues []models.Issue
+	for _, inst := range pdf.finalInstructions() {
+		if inst.Command != "RUN" {
+			continue
+		}
+		var what []string
+		for _, install := range PipInstalls(inst.Args) {
+			what = append(what, mlPackagesOf(install)...)
+			if mlBase && len(install.Requirements) > 0 && len(mlPackagesOf(install)) == 0 {
+				what = append(what, install.Requirements...)
+			}
+		}
+		if len(what) == 0 {
+			continue
+		}
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityMedium,
+			Category:    "optimization",
+			Title:       "ML stack installed with pip in the final stage",
+			Description: fmt.Sprintf("The final stage pip installs %s. ML stacks are GBs of wheels: whatever pip caches and builds along the way stays in the image, and any change to the command reinstalls all of it.", strings.Join(what, ", ")),
+			Line:        inst.Line,
+			Suggestion:  "Install into a virtual environment (or build wheels) in a separate stage and copy it over, with --no-cache-dir and a constraints file that pins the framework versions.",
+			AutoFixable: true,
+		})
+	}
+	return issues
+}
+
+// --- DuplicateTorchRule ---
+
+type DuplicateTorchRule struct{}
+
+func (r *DuplicateTorchRule) ID() string { return "DIO029" }
+
+func (r *DuplicateTorchRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *DuplicateTorchRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	base := pdf.runtimeBase()
+	var torch []Instruction
+	cuda := false // a torch install with CUDA, i.e. not from the CPU index
+	for _, inst := range pdf.finalInstructions() {
+		if inst.Command != "RUN" {
+			continue
+		}
+		for _, install := range PipInstalls(inst.Args) {
+			for _, pkg := range install.Packages {
+				if pkg == "torch" {
+					torch = append(torch, inst)
+					cuda = cuda || !strings.Contains(install.IndexURL, "/cpu")
+				}
+			}
+		}
+	}
+	if len(torch) == 0 {
+		return nil
+	}
+
+	issue := func(line int, title, description, suggestion string) models.Issue {
+		return models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityHigh,
+			Category:    "optimization",
+			Title:       title,
+			Description: description,
+			Line:        line,
+			Suggestion:  suggestion,
+		}
+	}
+	var issues []models.Issue
+	tag, cudaBase := cudaTag(base)
+	switch {
+	case torchBaseImage(base):
+		issues = append(issues, issue(torch[0].Line, "PyTorch installed over a PyTorch base image",
+			fmt.Sprintf("%s already ships PyTorch with its CUDA libraries. Installing torch again adds a second copy of several GB in a new layer.", base),
+			"Use the torch the base image ships, or start from a plain Python image and install torch once."))
+	case cuda && cudaBase && !strings.Contains(tag, "-base"):
+		issues = append(issues, issue(torch[0].Line, "CUDA-enabled torch on a CUDA base image",
+			fmt.Sprintf("CUDA builds of torch bundle their own CUDA and cuDNN libraries as nvidia-* wheels, so on %s the image carries the CUDA libraries twice, several GB.", base),
+			"Build on a plain Python image (or nvidia/cuda:*-base) and let the torch wheels bring CUDA, or install torch from https://download.pytorch.org/whl/cpu if the image doesn't use a GPU."))
+	}
+	if len(torch) > 1 {
+		var lines []string
+		for _, inst := range torch {
+			lines = append(lines, fmt.Sprint(inst.Line))
+		}
+		issues = append(issues, issue(torch[1].Line, "torch installed more than once",
+			fmt.Sprintf("torch is installed by the RUN instructions on lines %s. Each install in a later layer leaves the earlier copy, GBs with CUDA, in the image.", strings.Join(lines, ", ")),
+			"Install torch, torchvision and the rest of the stack in one pip install, with the index URL for the CUDA version you need."))
+	}
+	return issues
+}
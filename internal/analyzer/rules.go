@@ -1,10 +1,12 @@
 package analyzer
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 
 	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
 )
 
 // Rule is an interface for Dockerfile analysis rules.
@@ -13,6 +15,43 @@ type Rule interface {
 	Check(ctx *AnalysisContext) []models.Issue
 }
 
+// RuleScope describes which part of a Dockerfile a rule evaluates.
+type RuleScope string
+
+const (
+	// ScopeFile rules evaluate the Dockerfile or build context as a whole.
+	ScopeFile RuleScope = "file"
+	// ScopeAllStages rules evaluate instructions in every stage.
+	ScopeAllStages RuleScope = "all-stages"
+	// ScopeFinalStage rules only evaluate the stage that produces the image,
+	// including settings it inherits from earlier stages via FROM <stage>.
+	ScopeFinalStage RuleScope = "final-stage"
+	// ScopeImage rules check the config of the image built from the
+	// Dockerfile, after dio run builds it.
+	ScopeImage RuleScope = "image"
+)
+
+// ScopedRule is implemented by rules that declare their scope explicitly.
+// Rules that don't are treated as ScopeAllStages.
+type ScopedRule interface {
+	Scope() RuleScope
+}
+
+// ScopeOf returns the scope of a rule.
+func ScopeOf(r Rule) RuleScope {
+	if scoped, ok := r.(ScopedRule); ok {
+		return scoped.Scope()
+	}
+	return ScopeAllStages
+}
+
+// ConfigurableRule is implemented by rules that accept options from the
+// analyzer.rule_options section of .dio.yaml.
+type ConfigurableRule interface {
+	Rule
+	Configure(options map[string]interface{}) error
+}
+
 // DefaultRules returns all built-in analysis rules.
 func DefaultRules() []Rule {
 	return []Rule{
@@ -28,6 +67,36 @@ func DefaultRules() []Rule {
 		&CombineRunRule{},
 		&WorkdirRule{},
 		&HealthcheckRule{},
+		&IneffectiveDockerignoreRule{},
+		&StaticBinaryRule{},
+		&CACertificatesRule{},
+		&TimezoneDataRule{},
+		&EnvConsolidationRule{},
+		&BuildPackagesRule{},
+		&DebugToolsRule{},
+		&RootReescalationRule{},
+		&SetIDRule{},
+		&NumericUserRule{},
+		&DeadStageRule{},
+		&WholeStageCopyRule{},
+		&CUDADevelRule{},
+		&CUDAVersionRule{},
+		&GPUDriverRule{},
+		&PipMLStackRule{},
+		&DuplicateTorchRule{},
+		&CondaDistributionRule{},
+		&CondaCacheRule{},
+		&JDKRuntimeRule{},
+		&FrontendNodeModulesRule{},
+		&SourceMapRule{},
+		&GoldenImageRule{},
+		&SecretRule{},
+		&DirectiveRule{},
+		&StrictShellRule{},
+		&CacheBustRule{},
+		&AptUpdateRule{},
+		&ChownedCopyRule{},
+		&BudgetRule{},
 	}
 }
 
@@ -39,37 +108,99 @@ func (r *LatestTagRule) ID() string { return "DIO001" }
 
 func (r *LatestTagRule) Check(ctx *AnalysisContext) []models.Issue {
 	var issues []models.Issue
-	for _, img := range ctx.ParsedFile.BaseImages {
-		if strings.HasSuffix(img, ":latest") || !strings.Contains(img, ":") {
-			if img == "scratch" {
-				continue
-			}
-			for _, inst := range ctx.ParsedFile.Instructions {
-				if inst.Command == "FROM" && strings.Contains(strings.ToLower(inst.Args), img) {
-					issues = append(issues, models.Issue{
-						ID:          r.ID(),
-						Severity:    models.SeverityHigh,
-						Category:    "base-image",
-						Title:       "Unpinned base image tag",
-						Description: "Using 'latest' or untagged base image: " + img,
-						Line:        inst.Line,
-						Suggestion:  "Pin to a specific version, e.g., " + img + ":22.04",
-						AutoFixable: false,
-					})
-					break
-				}
-			}
+	for i, stage := range ctx.ParsedFile.Stages {
+		img := stage.BaseImage
+		if img == "scratch" {
+			continue
+		}
+		// The effective image isn't known without the missing build args
+		if hasUnresolvedArgs(img) {
+			continue
+		}
+		// FROM <earlier stage> is a stage reference, not an image
+		if parent := ctx.ParsedFile.StageIndex(img); parent != -1 && parent < i {
+			continue
 		}
+		if !IsUnpinnedTag(img) {
+			continue
+		}
+		if ctx.Updater != "" {
+			issues = append(issues, digestPinIssue(r.ID(), ctx.Updater, img, stage.StartLine))
+			continue
+		}
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityHigh,
+			Category:    "base-image",
+			Title:       "Unpinned base image tag",
+			Description: "Using 'latest' or untagged base image: " + img,
+			Line:        stage.StartLine,
+			Suggestion:  "Pin to a specific version, e.g., " + img + ":22.04",
+			AutoFixable: false,
+		})
+	}
+
+	// COPY --from=<image> pulls an image just like FROM does
+	for _, ref := range ctx.ParsedFile.CopyFromImages {
+		if hasUnresolvedArgs(ref.Image) || !IsUnpinnedTag(ref.Image) {
+			continue
+		}
+		if ctx.Updater != "" {
+			issues = append(issues, digestPinIssue(r.ID(), ctx.Updater, ref.Image, ref.Line))
+			continue
+		}
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityHigh,
+			Category:    "base-image",
+			Title:       "Unpinned COPY --from image tag",
+			Description: "COPY --from uses a 'latest' or untagged image: " + ref.Image,
+			Line:        ref.Line,
+			Suggestion:  "Pin the COPY --from image to a specific version or digest.",
+			AutoFixable: false,
+		})
 	}
 	return issues
 }
 
+// digestPinIssue reports an unpinned image in a repository whose updater
+// keeps base images current. Moving to newer versions is the updater's
+// job, so the issue only asks for the digest pin that turns the silent
+// changes of a floating tag into update pull requests.
+func digestPinIssue(id, updater, img string, line int) models.Issue {
+	name := strings.ToUpper(updater[:1]) + updater[1:]
+	return models.Issue{
+		ID:          id,
+		Severity:    models.SeverityMedium,
+		Category:    "base-image",
+		Title:       "Base image not pinned by digest",
+		Description: fmt.Sprintf("%s floats: it changes whenever the tag is pushed again. %s updates the base images of this repository, but only proposes changes for references it can compare.", img, name),
+		Line:        line,
+		Suggestion:  fmt.Sprintf("Pin the digest, e.g. %s@sha256:<digest>; %s then opens a pull request whenever it changes.", img, name),
+		AutoFixable: false,
+	}
+}
+
+// IsUnpinnedTag reports whether an image reference has no tag or uses
+// :latest. Digest-pinned references are always considered pinned.
+func IsUnpinnedTag(img string) bool {
+	if strings.Contains(img, "@sha256:") {
+		return false
+	}
+	// Only look for a tag after the last path component, so registry ports
+	// like localhost:5000/app aren't mistaken for tags.
+	name := img[strings.LastIndex(img, "/")+1:]
+	return !strings.Contains(name, ":") || strings.HasSuffix(name, ":latest")
+}
+
 // --- MissingDockerignoreRule ---
 
 type MissingDockerignoreRule struct{}
 
 func (r *MissingDockerignoreRule) ID() string { return "DIO002" }
 
+func (r *MissingDockerignoreRule) Scope() RuleScope { return ScopeFile }
+
 func (r *MissingDockerignoreRule) Check(ctx *AnalysisContext) []models.Issue {
 	if !ctx.MissingDockerignore {
 		return nil
@@ -80,7 +211,7 @@ func (r *MissingDockerignoreRule) Check(ctx *AnalysisContext) []models.Issue {
 			Severity:    models.SeverityMedium,
 			Category:    "best-practice",
 			Title:       "Missing .dockerignore",
-			Description: "No .dockerignore file found. This may cause unnecessary files to be included in the build context.",
+			Description: "No .dockerignore (or .containerignore) file found. This may cause unnecessary files to be included in the build context.",
 			Suggestion:  "Create a .dockerignore file to exclude node_modules, .git, docs, etc.",
 			AutoFixable: true,
 		},
@@ -89,33 +220,71 @@ func (r *MissingDockerignoreRule) Check(ctx *AnalysisContext) []models.Issue {
 
 // --- TooManyLayersRule ---
 
-type TooManyLayersRule struct{}
+// defaultMaxLayers is the layer threshold used when none is configured.
+const defaultMaxLayers = 15
+
+type TooManyLayersRule struct {
+	// MaxLayers is the maximum number of layer-creating instructions allowed
+	// in the final stage. Zero means defaultMaxLayers.
+	MaxLayers int
+}
 
 func (r *TooManyLayersRule) ID() string { return "DIO003" }
 
+func (r *TooManyLayersRule) Scope() RuleScope { return ScopeFinalStage }
+
+// Configure applies the "max_layers" option.
+func (r *TooManyLayersRule) Configure(options map[string]interface{}) error {
+	if v, ok := options["max_layers"]; ok {
+		n, ok := v.(int)
+		if !ok || n <= 0 {
+			return fmt.Errorf("max_layers must be a positive integer, got %v", v)
+		}
+		r.MaxLayers = n
+	}
+	return nil
+}
+
 func (r *TooManyLayersRule) Check(ctx *AnalysisContext) []models.Issue {
 	// Count layer-creating instructions (RUN, COPY, ADD) in the final stage
 	if len(ctx.ParsedFile.Stages) == 0 {
 		return nil
 	}
 
-	finalStage := ctx.ParsedFile.Stages[len(ctx.ParsedFile.Stages)-1]
+	maxLayers := r.MaxLayers
+	if maxLayers == 0 {
+		maxLayers = defaultMaxLayers
+	}
+
+	final := ctx.ParsedFile.FinalStage()
+	var breakdown []string
 	layerCount := 0
-	for _, inst := range finalStage.Instructions {
-		switch inst.Command {
-		case "RUN", "COPY", "ADD":
-			layerCount++
+	for i, stage := range ctx.ParsedFile.Stages {
+		count := countLayers(stage)
+		name := stage.Name
+		if name == "" {
+			name = fmt.Sprintf("stage %d", i)
+		}
+		breakdown = append(breakdown, fmt.Sprintf("%s=%d", name, count))
+		if i == final {
+			layerCount = count
 		}
 	}
 
-	if layerCount > 15 {
+	if layerCount > maxLayers {
+		finalStage := ctx.ParsedFile.Stages[final]
+		description := fmt.Sprintf("Final stage has %d layers (threshold: %d). Consider combining RUN commands.", layerCount, maxLayers)
+		if len(breakdown) > 1 {
+			description += " Layers per stage: " + strings.Join(breakdown, ", ") + "."
+		}
 		return []models.Issue{
 			{
 				ID:          r.ID(),
 				Severity:    models.SeverityMedium,
 				Category:    "optimization",
 				Title:       "Too many layers",
-				Description: "Final stage has " + string(rune(layerCount+'0')) + " layers. Consider combining RUN commands.",
+				Description: description,
+				Line:        finalStage.StartLine,
 				Suggestion:  "Combine related RUN commands using && to reduce layers.",
 				AutoFixable: true,
 			},
@@ -124,6 +293,18 @@ func (r *TooManyLayersRule) Check(ctx *AnalysisContext) []models.Issue {
 	return nil
 }
 
+// countLayers counts the layer-creating instructions (RUN, COPY, ADD) in a stage.
+func countLayers(stage Stage) int {
+	count := 0
+	for _, inst := range stage.Instructions {
+		switch inst.Command {
+		case "RUN", "COPY", "ADD":
+			count++
+		}
+	}
+	return count
+}
+
 // --- AptGetRule ---
 
 type AptGetRule struct{}
@@ -136,15 +317,18 @@ func (r *AptGetRule) Check(ctx *AnalysisContext) []models.Issue {
 		if inst.Command != "RUN" {
 			continue
 		}
-		if strings.Contains(inst.Args, "apt-get install") && !strings.Contains(inst.Args, "--no-install-recommends") {
+		for _, opt := range WeakDependencyOptions {
+			if len(opt.Missing(inst.Args)) == 0 {
+				continue
+			}
 			issues = append(issues, models.Issue{
 				ID:          r.ID(),
 				Severity:    models.SeverityMedium,
 				Category:    "optimization",
-				Title:       "apt-get install without --no-install-recommends",
-				Description: "apt-get install should use --no-install-recommends to avoid unnecessary packages.",
+				Title:       fmt.Sprintf("%s install without %s", opt.Tool, opt.Option),
+				Description: fmt.Sprintf("%s install should use %s to avoid unnecessary packages.", opt.Tool, opt.Option),
 				Line:        inst.Line,
-				Suggestion:  "Add --no-install-recommends to apt-get install commands.",
+				Suggestion:  fmt.Sprintf("Add %s to %s install commands.", opt.Option, opt.Tool),
 				AutoFixable: true,
 			})
 		}
@@ -165,27 +349,22 @@ func (r *CacheNotCleanedRule) Check(ctx *AnalysisContext) []models.Issue {
 			continue
 		}
 
-		hasAptGet := strings.Contains(inst.Args, "apt-get install") || strings.Contains(inst.Args, "apt-get update")
-		hasClean := strings.Contains(inst.Args, "rm -rf /var/lib/apt/lists") ||
-			strings.Contains(inst.Args, "apt-get clean") ||
-			strings.Contains(inst.Args, "apt-get autoremove")
-
-		if hasAptGet && !hasClean {
+		for _, c := range ctx.ParsedFile.UncleanedCaches(inst) {
 			issues = append(issues, models.Issue{
 				ID:          r.ID(),
 				Severity:    models.SeverityMedium,
 				Category:    "optimization",
 				Title:       "Package manager cache not cleaned",
-				Description: "apt-get commands should clean up cache in the same layer.",
+				Description: c.Tool + " commands should clean up their cache in the same layer.",
 				Line:        inst.Line,
-				Suggestion:  "Add '&& rm -rf /var/lib/apt/lists/*' to the same RUN command.",
-				AutoFixable: true,
+				Suggestion:  c.Fix(),
+				AutoFixable: c.Option != nil || len(inst.Heredocs) == 0,
 			})
 		}
 
 		// Pip cache
 		hasPip := strings.Contains(inst.Args, "pip install")
-		hasPipNoCache := strings.Contains(inst.Args, "--no-cache-dir")
+		hasPipNoCache := strings.Contains(inst.Args, "--no-cache-dir") || cacheMounted(inst, "/root/.cache/pip")
 		if hasPip && !hasPipNoCache {
 			issues = append(issues, models.Issue{
 				ID:          r.ID() + "-pip",
@@ -208,31 +387,50 @@ type RootUserRule struct{}
 
 func (r *RootUserRule) ID() string { return "DIO006" }
 
+func (r *RootUserRule) Scope() RuleScope { return ScopeFinalStage }
+
 func (r *RootUserRule) Check(ctx *AnalysisContext) []models.Issue {
-	hasUserInstruction := false
-	for _, inst := range ctx.ParsedFile.Instructions {
-		if inst.Command == "USER" {
-			user := strings.TrimSpace(inst.Args)
-			if user != "root" && user != "0" {
-				hasUserInstruction = true
-			}
-		}
+	final := ctx.ParsedFile.FinalStage()
+	if final < 0 {
+		return nil
 	}
 
-	if !hasUserInstruction {
-		return []models.Issue{
-			{
-				ID:          r.ID(),
-				Severity:    models.SeverityHigh,
-				Category:    "security",
-				Title:       "Container runs as root",
-				Description: "No USER instruction found. The container will run as root by default.",
-				Suggestion:  "Add 'USER nonroot' or create a dedicated user.",
-				AutoFixable: true,
-			},
-		}
+	user, line := ctx.ParsedFile.EffectiveUser()
+
+	if user != "" && !IsRootUser(user) {
+		return nil
+	}
+
+	// Windows images run as ContainerAdministrator unless they are based on
+	// nanoserver, which defaults to ContainerUser.
+	windows := ctx.ParsedFile.IsWindows()
+	if user == "" && windows && ctx.ParsedFile.isNanoserver() {
+		return nil
+	}
+
+	description := "No USER instruction found in the final stage. The container will run as root by default."
+	suggestion := "Add 'USER nonroot' or create a dedicated user."
+	if windows {
+		description = "No USER instruction found in the final stage. The container will run as ContainerAdministrator by default."
+		suggestion = "Add 'USER ContainerUser' to run without administrator rights."
+	}
+	if user != "" {
+		description = "The final stage switches to root (USER " + user + ") and never drops privileges."
+	} else {
+		line = ctx.ParsedFile.Stages[final].StartLine
+	}
+	return []models.Issue{
+		{
+			ID:          r.ID(),
+			Severity:    models.SeverityHigh,
+			Category:    "security",
+			Title:       "Container runs as root",
+			Description: description,
+			Line:        line,
+			Suggestion:  suggestion,
+			AutoFixable: true,
+		},
 	}
-	return nil
 }
 
 // --- CopyAllRule ---
@@ -267,6 +465,8 @@ type NoMultiStageRule struct{}
 
 func (r *NoMultiStageRule) ID() string { return "DIO008" }
 
+func (r *NoMultiStageRule) Scope() RuleScope { return ScopeFile }
+
 func (r *NoMultiStageRule) Check(ctx *AnalysisContext) []models.Issue {
 	if ctx.ParsedFile.HasMultiStage {
 		return nil
@@ -310,23 +510,24 @@ func (r *PinVersionRule) ID() string { return "DIO009" }
 
 func (r *PinVersionRule) Check(ctx *AnalysisContext) []models.Issue {
 	var issues []models.Issue
-	unpinnedRegex := regexp.MustCompile(`(apt-get install|apk add).*\s+\w+\s*($|&&)`)
 	for _, inst := range ctx.ParsedFile.Instructions {
-		if inst.Command == "RUN" && unpinnedRegex.MatchString(inst.Args) {
-			// Check for pinned versions (=, ==, >=)
-			if !strings.Contains(inst.Args, "=") {
-				issues = append(issues, models.Issue{
-					ID:          r.ID(),
-					Severity:    models.SeverityLow,
-					Category:    "reproducibility",
-					Title:       "Unpinned package versions",
-					Description: "Package versions are not pinned, which may lead to non-reproducible builds.",
-					Line:        inst.Line,
-					Suggestion:  "Pin package versions, e.g., curl=7.88.1-10+deb12u5",
-					AutoFixable: false,
-				})
-			}
+		if inst.Command != "RUN" {
+			continue
+		}
+		unpinned := UnpinnedPackages(inst.Args)
+		if len(unpinned) == 0 {
+			continue
 		}
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityLow,
+			Category:    "reproducibility",
+			Title:       "Unpinned package versions",
+			Description: "Package versions are not pinned, which may lead to non-reproducible builds.",
+			Line:        inst.Line,
+			Suggestion:  "Pin package versions, e.g., " + pinExamples[unpinned[0].Manager],
+			AutoFixable: false,
+		})
 	}
 	return issues
 }
@@ -338,33 +539,23 @@ type CombineRunRule struct{}
 func (r *CombineRunRule) ID() string { return "DIO010" }
 
 func (r *CombineRunRule) Check(ctx *AnalysisContext) []models.Issue {
-	// Check for consecutive RUN commands that could be combined
+	// Check for blocks of consecutive RUN commands that could be combined:
+	// the blocks the combine-layers autofix merges
 	var issues []models.Issue
-	consecutiveRuns := 0
-	firstRunLine := 0
-
-	for _, inst := range ctx.ParsedFile.Instructions {
-		if inst.Command == "RUN" {
-			consecutiveRuns++
-			if consecutiveRuns == 1 {
-				firstRunLine = inst.Line
-			}
-			if consecutiveRuns >= 3 {
-				issues = append(issues, models.Issue{
-					ID:          r.ID(),
-					Severity:    models.SeverityMedium,
-					Category:    "optimization",
-					Title:       "Consecutive RUN commands",
-					Description: "Multiple consecutive RUN commands can be combined to reduce layers.",
-					Line:        firstRunLine,
-					Suggestion:  "Combine RUN commands using && to reduce image layers.",
-					AutoFixable: true,
-				})
-				consecutiveRuns = 0
-			}
-		} else {
-			consecutiveRuns = 0
+	for _, block := range RunBlocks(ctx.ParsedFile) {
+		if len(block) < 3 {
+			continue
 		}
+		issues = append(issues, models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityMedium,
+			Category:    "optimization",
+			Title:       "Consecutive RUN commands",
+			Description: "Multiple consecutive RUN commands can be combined to reduce layers.",
+			Line:        block[0].Line,
+			Suggestion:  "Combine RUN commands using && to reduce image layers.",
+			AutoFixable: true,
+		})
 	}
 	return issues
 }
@@ -375,28 +566,25 @@ type WorkdirRule struct{}
 
 func (r *WorkdirRule) ID() string { return "DIO011" }
 
+func (r *WorkdirRule) Scope() RuleScope { return ScopeFinalStage }
+
 func (r *WorkdirRule) Check(ctx *AnalysisContext) []models.Issue {
-	hasWorkdir := false
-	for _, inst := range ctx.ParsedFile.Instructions {
-		if inst.Command == "WORKDIR" {
-			hasWorkdir = true
-			break
-		}
+	final := ctx.ParsedFile.FinalStage()
+	if final < 0 || stageChainHas(ctx.ParsedFile, final, "WORKDIR") {
+		return nil
 	}
-	if !hasWorkdir {
-		return []models.Issue{
-			{
-				ID:          r.ID(),
-				Severity:    models.SeverityLow,
-				Category:    "best-practice",
-				Title:       "No WORKDIR set",
-				Description: "No WORKDIR instruction found. Files will be placed in / by default.",
-				Suggestion:  "Add WORKDIR /app or similar to set a proper working directory.",
-				AutoFixable: true,
-			},
-		}
+	return []models.Issue{
+		{
+			ID:          r.ID(),
+			Severity:    models.SeverityLow,
+			Category:    "best-practice",
+			Title:       "No WORKDIR set",
+			Description: "No WORKDIR instruction found in the final stage. Files will be placed in / by default.",
+			Line:        ctx.ParsedFile.Stages[final].StartLine,
+			Suggestion:  "Add WORKDIR /app or similar to set a proper working directory.",
+			AutoFixable: true,
+		},
 	}
-	return nil
 }
 
 // --- HealthcheckRule ---
@@ -405,21 +593,68 @@ type HealthcheckRule struct{}
 
 func (r *HealthcheckRule) ID() string { return "DIO012" }
 
+func (r *HealthcheckRule) Scope() RuleScope { return ScopeFinalStage }
+
 func (r *HealthcheckRule) Check(ctx *AnalysisContext) []models.Issue {
-	for _, inst := range ctx.ParsedFile.Instructions {
-		if inst.Command == "HEALTHCHECK" {
-			return nil
+	final := ctx.ParsedFile.FinalStage()
+	if final < 0 || stageChainHas(ctx.ParsedFile, final, "HEALTHCHECK") {
+		return nil
+	}
+	issue := models.Issue{
+		ID:          r.ID(),
+		Severity:    models.SeverityInfo,
+		Category:    "best-practice",
+		Title:       "No HEALTHCHECK defined",
+		Description: "Consider adding a HEALTHCHECK instruction to the final stage for container orchestration.",
+		Line:        ctx.ParsedFile.Stages[final].StartLine,
+		Suggestion:  "Add HEALTHCHECK CMD curl -f http://localhost/ || exit 1",
+		AutoFixable: false,
+	}
+	// With an exposed port the check can be tailored to the protocol and
+	// the tools in the image, and added automatically
+	if h := ctx.ParsedFile.suggestHealthcheck(); h != nil {
+		issue.Suggestion = "Add " + strings.Join(h.Instructions, "\n")
+		issue.AutoFixable = true
+	}
+	return []models.Issue{issue}
+}
+
+// stageChainHas reports whether the stage at idx, or a stage it inherits
+// from, contains an instruction with the given command.
+func stageChainHas(pdf *ParsedDockerfile, idx int, command string) bool {
+	for _, stage := range pdf.StageChain(idx) {
+		for _, inst := range stage.Instructions {
+			if inst.Command == command {
+				return true
+			}
 		}
 	}
-	return []models.Issue{
-		{
+	return false
+}
+
+// --- IneffectiveDockerignoreRule ---
+
+type IneffectiveDockerignoreRule struct{}
+
+func (r *IneffectiveDockerignoreRule) ID() string { return "DIO013" }
+
+func (r *IneffectiveDockerignoreRule) Scope() RuleScope { return ScopeFile }
+
+func (r *IneffectiveDockerignoreRule) Check(ctx *AnalysisContext) []models.Issue {
+	ignoreFile := ctx.IgnoreFile
+	if ignoreFile == "" {
+		ignoreFile = ".dockerignore"
+	}
+	var issues []models.Issue
+	for _, dir := range ctx.UncoveredContextDirs {
+		issues = append(issues, models.Issue{
 			ID:          r.ID(),
-			Severity:    models.SeverityInfo,
-			Category:    "best-practice",
-			Title:       "No HEALTHCHECK defined",
-			Description: "Consider adding a HEALTHCHECK instruction for container orchestration.",
-			Suggestion:  "Add HEALTHCHECK CMD curl -f http://localhost/ || exit 1",
-			AutoFixable: false,
-		},
+			Severity:    models.SeverityMedium,
+			Category:    "optimization",
+			Title:       fmt.Sprintf("%s/ not excluded by %s", dir.Path, ignoreFile),
+			Description: fmt.Sprintf("%s/ (%s) is present in the build context but not covered by %s, so it is sent to the daemon on every build.", dir.Path, docker.HumanSize(dir.Size), ignoreFile),
+			Suggestion:  fmt.Sprintf("Add %q to %s.", dir.Path, ignoreFile),
+		})
 	}
+	return issues
 }
@@ -0,0 +1,115 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// commandEndRegex matches the end of a shell command.
+var commandEndRegex = regexp.MustCompile(`&&|\|\||;|\|`)
+
+// RunBlocks returns the blocks of two or more consecutive RUN instructions
+// that can be merged into one, which DIO010 reports and the combine-layers
+// strategy merges. Comments and blank lines don't separate RUNs.
+func RunBlocks(pdf *ParsedDockerfile) [][]Instruction {
+	var (
+		blocks [][]Instruction
+		block  []Instruction
+	)
+	flush := func() {
+		if len(block) >= 2 {
+			blocks = append(blocks, block)
+		}
+		block = nil
+	}
+	for _, inst := range pdf.Instructions {
+		if !mergeableRun(inst) {
+			flush()
+			continue
+		}
+		block = append(block, inst)
+		if !chainable(inst.Args) {
+			flush()
+		}
+	}
+	flush()
+	return blocks
+}
+
+// mergeableRun reports whether inst is a RUN that can be merged with
+// others. Flags like --mount apply to the whole command, exec form RUNs
+// have no shell to chain them with, and heredoc scripts end at their
+// terminator line.
+func mergeableRun(inst Instruction) bool {
+	return inst.Command == "RUN" && len(inst.Flags) == 0 && len(inst.Heredocs) == 0 &&
+		!strings.HasPrefix(strings.TrimSpace(inst.Args), "[")
+}
+
+// statefulCommands change the shell that runs them, which the commands
+// merged after them would inherit: a cd would move them, an exit skip them.
+var statefulCommands = map[string]bool{
+	"cd": true, "pushd": true, "popd": true, "export": true, "unset": true, "set": true,
+	"source": true, ".": true, "umask": true, "ulimit": true, "alias": true, "shopt": true,
+	"trap": true, "exit": true, "exec": true, "readonly": true, "declare": true, "typeset": true,
+}
+
+// chainable reports whether commands can be merged after script without
+// changing what it or they do. Scripts that change the state of the shell
+// or end in a comment or an operator can only end a merged RUN.
+func chainable(script string) bool {
+	if !Appendable(script) {
+		return false
+	}
+	for _, cmd := range commandEndRegex.Split(script, -1) {
+		fields := strings.Fields(strings.TrimLeft(cmd, " \t({!"))
+		if len(fields) == 0 {
+			continue
+		}
+		// A bare assignment sets a shell variable
+		if statefulCommands[fields[0]] || len(fields) == 1 && strings.Contains(fields[0], "=") {
+			return false
+		}
+	}
+	return true
+}
+
+// Appendable reports whether commands can be appended to script with &&:
+// it doesn't end in a comment, which would swallow them, or in an
+// operator, which would leave an empty command before them.
+func Appendable(script string) bool {
+	script = strings.TrimSpace(script)
+	if hasShellComment(script) {
+		return false
+	}
+	for _, op := range []string{"&", ";", "|", "(", "{"} {
+		if strings.HasSuffix(script, op) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasShellComment reports whether a script has a comment outside quotes:
+// merged after it on the same logical line, the next commands would be
+// part of the comment.
+func hasShellComment(script string) bool {
+	var quote byte
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '\\':
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '#' && (i == 0 || strings.IndexByte(" \t;&|(", script[i-1]) >= 0):
+			return true
+		}
+	}
+	return false
+}
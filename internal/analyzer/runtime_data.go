@@ -0,0 +1,211 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// RuntimeDataImage is the image the CA certificates and timezone database
+// are copied from into scratch images. distroless/static has both and
+// nothing else worth copying.
+const RuntimeDataImage = "gcr.io/distroless/static-debian12"
+
+var (
+	httpsURLRegex     = regexp.MustCompile(`https://`)
+	installCertsRegex = regexp.MustCompile(`\b(apk|apt-get|apt|yum|dnf|microdnf)\b[^&;|]*\bca-certificates\b`)
+	installTzRegex    = regexp.MustCompile(`\b(apk|apt-get|apt|yum|dnf|microdnf)\b[^&;|]*\btzdata\b`)
+	certsEnvRegex     = regexp.MustCompile(`\bSSL_CERT_(FILE|DIR)\b`)
+	tzEnvRegex        = regexp.MustCompile(`\bTZ(=|\s+)["']?([^"'\s]+)`)
+	embeddedTzRegex   = regexp.MustCompile(`\btimetzdata\b|time/tzdata|\bZONEINFO\b`)
+)
+
+// runtimeDataGaps reports whether an image lacks the CA certificate bundle
+// or the timezone database. Plain debian and ubuntu images ship neither,
+// alpine has certificates but no tzdata, and distroless and language images
+// have both.
+func runtimeDataGaps(image string) (certs, tzdata bool) {
+	image = strings.ToLower(image)
+	repo := image
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	repo = strings.TrimPrefix(repo, "docker.io/")
+	repo = strings.TrimPrefix(repo, "library/")
+	switch {
+	case image == "scratch":
+		return true, true
+	case repo == "alpine":
+		return false, true
+	case repo == "debian" || repo == "ubuntu":
+		return true, true
+	}
+	return false, false
+}
+
+// finalInstructions returns the instructions of the final stage and the
+// stages it inherits from, earliest first.
+func (p *ParsedDockerfile) finalInstructions() []Instruction {
+	var insts []Instruction
+	chain := p.StageChain(p.FinalStage())
+	for i := len(chain) - 1; i >= 0; i-- {
+		insts = append(insts, chain[i].Instructions...)
+	}
+	return insts
+}
+
+// copiedStageInstructions returns the instructions of the build stages the
+// final stage copies from with COPY --from, including what they inherit.
+func (p *ParsedDockerfile) copiedStageInstructions() []Instruction {
+	var insts []Instruction
+	seen := make(map[int]bool)
+	for _, inst := range p.finalInstructions() {
+		idx := copyFromStage(p, copyFromFlag(inst))
+		if idx < 0 || seen[idx] {
+			continue
+		}
+		seen[idx] = true
+		for _, stage := range p.StageChain(idx) {
+			insts = append(insts, stage.Instructions...)
+		}
+	}
+	return insts
+}
+
+// --- CACertificatesRule ---
+
+type CACertificatesRule struct{}
+
+func (r *CACertificatesRule) ID() string { return "DIO015" }
+
+func (r *CACertificatesRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *CACertificatesRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	if pdf.FinalStage() < 0 {
+		return nil
+	}
+	base := pdf.runtimeBase()
+	if missing, _ := runtimeDataGaps(base); !missing {
+		return nil
+	}
+
+	line, reason := 0, ""
+	for _, inst := range pdf.finalInstructions() {
+		switch {
+		case inst.Command == "COPY" && (strings.Contains(inst.Args, "/etc/ssl") || strings.Contains(inst.Args, "ca-certificates")),
+			inst.Command == "RUN" && installCertsRegex.MatchString(inst.Args),
+			inst.Command == "ENV" && certsEnvRegex.MatchString(inst.Args):
+			return nil
+		case line == 0 && (inst.Command == "ENV" || inst.Command == "CMD" || inst.Command == "ENTRYPOINT" || inst.Command == "HEALTHCHECK") &&
+			httpsURLRegex.MatchString(inst.Args):
+			line, reason = inst.Line, "uses an https:// URL"
+		}
+	}
+	if line == 0 {
+		// Installing certificates in the build stage and not copying them
+		// is the classic scratch mistake
+		for _, inst := range pdf.copiedStageInstructions() {
+			if inst.Command == "RUN" && installCertsRegex.MatchString(inst.Args) {
+				line, reason = inst.Line, "installs ca-certificates in a build stage"
+				break
+			}
+		}
+	}
+	if line == 0 {
+		return nil
+	}
+
+	return []models.Issue{{
+		ID:          r.ID(),
+		Severity:    models.SeverityMedium,
+		Category:    "best-practice",
+		Title:       "No CA certificates for HTTPS",
+		Description: fmt.Sprintf("The image %s, but %s has no CA certificate bundle: TLS connections fail with \"certificate signed by unknown authority\".", reason, base),
+		Line:        line,
+		Suggestion:  certsFix(base),
+		AutoFixable: true,
+	}}
+}
+
+func certsFix(base string) string {
+	if base == "scratch" {
+		return "COPY --from=" + RuntimeDataImage + " /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/"
+	}
+	return "Install ca-certificates in the final stage."
+}
+
+// --- TimezoneDataRule ---
+
+type TimezoneDataRule struct{}
+
+func (r *TimezoneDataRule) ID() string { return "DIO016" }
+
+func (r *TimezoneDataRule) Scope() RuleScope { return ScopeFinalStage }
+
+func (r *TimezoneDataRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	if pdf.FinalStage() < 0 {
+		return nil
+	}
+	base := pdf.runtimeBase()
+	if _, missing := runtimeDataGaps(base); !missing {
+		return nil
+	}
+
+	line, zone := 0, ""
+	for _, inst := range pdf.finalInstructions() {
+		switch {
+		case inst.Command == "COPY" && strings.Contains(inst.Args, "zoneinfo"),
+			inst.Command == "RUN" && installTzRegex.MatchString(inst.Args),
+			inst.Command == "ENV" && embeddedTzRegex.MatchString(inst.Args):
+			return nil
+		case inst.Command == "ENV" || inst.Command == "ARG":
+			if m := tzEnvRegex.FindStringSubmatch(inst.Args); m != nil && !isUTC(m[2]) {
+				line, zone = inst.Line, m[2]
+			}
+		}
+	}
+	if line == 0 {
+		return nil
+	}
+	// Go binaries built with -tags timetzdata or importing time/tzdata
+	// carry their own copy
+	for _, inst := range pdf.copiedStageInstructions() {
+		if embeddedTzRegex.MatchString(inst.Args) {
+			return nil
+		}
+	}
+
+	return []models.Issue{{
+		ID:          r.ID(),
+		Severity:    models.SeverityMedium,
+		Category:    "best-practice",
+		Title:       "No timezone data for TZ",
+		Description: fmt.Sprintf("TZ is set to %s, but %s has no timezone database: the application silently falls back to UTC.", zone, base),
+		Line:        line,
+		Suggestion:  tzdataFix(base),
+		AutoFixable: true,
+	}}
+}
+
+func tzdataFix(base string) string {
+	switch {
+	case base == "scratch":
+		return "COPY --from=" + RuntimeDataImage + " /usr/share/zoneinfo /usr/share/zoneinfo"
+	case strings.Contains(strings.ToLower(base), "alpine"):
+		return "RUN apk add --no-cache tzdata"
+	}
+	return "Install tzdata in the final stage."
+}
+
+// isUTC reports whether a TZ value needs no timezone database.
+func isUTC(zone string) bool {
+	switch strings.TrimPrefix(strings.ToUpper(zone), ":") {
+	case "UTC", "ETC/UTC", "GMT", "ETC/GMT", "UTC0", "GMT0", "Z", "ZULU":
+		return true
+	}
+	return false
+}
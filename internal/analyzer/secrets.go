@@ -0,0 +1,83 @@
+package analyzer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+var (
+	// secretNameRegex matches the names of variables that hold secrets,
+	// such as DB_PASSWORD, NPM_TOKEN or AWS_SECRET_ACCESS_KEY.
+	secretNameRegex = regexp.MustCompile(`(?i)(?:^|_)(?:PASSWORD|PASSWD|SECRET|TOKEN|API_?KEY|PRIVATE_?KEY|ACCESS_?KEY|SECRET_?KEY|CREDENTIALS?)$`)
+	// secretFileRegex matches the names of files that hold credentials:
+	// SSH keys, package manager credentials and private keys.
+	secretFileRegex = regexp.MustCompile(`^(?:id_rsa|id_dsa|id_ecdsa|id_ed25519|\.npmrc|\.pypirc|\.netrc|\.git-credentials)$|\.(?:key|p12|pfx)$`)
+)
+
+// --- SecretRule ---
+
+type SecretRule struct{}
+
+func (r *SecretRule) ID() string { return "DIO036" }
+
+func (r *SecretRule) Check(ctx *AnalysisContext) []models.Issue {
+	var issues []models.Issue
+	for _, inst := range ctx.ParsedFile.Instructions {
+		var vars []EnvVar
+		switch inst.Command {
+		case "ENV":
+			vars = ParseEnv(inst.Args)
+		case "ARG":
+			for _, field := range strings.Fields(inst.Args) {
+				if key, value, ok := strings.Cut(field, "="); ok {
+					vars = append(vars, EnvVar{Key: key, Value: value})
+				}
+			}
+		default:
+			continue
+		}
+		for _, v := range vars {
+			value := strings.Trim(v.Value, `"'`)
+			if !secretNameRegex.MatchString(v.Key) || value == "" || strings.HasPrefix(value, "$") {
+				continue
+			}
+			issues = append(issues, models.Issue{
+				ID:          r.ID(),
+				Severity:    models.SeverityHigh,
+				Category:    "security",
+				Title:       "Secret in the Dockerfile",
+				Description: fmt.Sprintf("%s %s is set to a literal value. It is readable by anyone with the Dockerfile, and with docker history or docker inspect by anyone who can pull the image.", inst.Command, v.Key),
+				Line:        inst.Line,
+				Suggestion:  "Pass it at build time with a BuildKit secret (RUN --mount=type=secret,id=...) or at run time from the orchestrator's secret store.",
+			})
+		}
+	}
+
+	if ctx.ParsedFile.FinalStage() < 0 {
+		return issues
+	}
+	for _, inst := range ctx.ParsedFile.finalInstructions() {
+		if inst.Command != "COPY" && inst.Command != "ADD" {
+			continue
+		}
+		for _, src := range copySources(inst.Args) {
+			if !secretFileRegex.MatchString(path.Base(src)) {
+				continue
+			}
+			issues = append(issues, models.Issue{
+				ID:          r.ID(),
+				Severity:    models.SeverityHigh,
+				Category:    "security",
+				Title:       "Secret in the Dockerfile",
+				Description: fmt.Sprintf("%s copies %s into the final image, where anyone who can pull the image can read it, even if a later layer deletes it.", inst.Command, src),
+				Line:        inst.Line,
+				Suggestion:  "Mount it only where it's needed with RUN --mount=type=secret or --mount=type=ssh.",
+			})
+		}
+	}
+	return issues
+}
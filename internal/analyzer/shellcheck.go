@@ -0,0 +1,303 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// RunScript is the shell script of a RUN instruction, as shellcheck reads
+// it.
+type RunScript struct {
+	Instruction Instruction
+	// Script is the command of the RUN, or the body of its heredoc, with
+	// the comment lines docker drops removed.
+	Script string
+	// Shell is the shellcheck dialect: sh, bash, dash or ksh.
+	Shell string
+	// Lines maps each line of Script to its line in the Dockerfile.
+	Lines []int
+	// Vars are the ARGs and ENVs set before the RUN, which the script
+	// sees in its environment.
+	Vars []string
+}
+
+// shellDialects maps shell binaries to the dialect shellcheck checks them
+// as.
+var shellDialects = map[string]string{
+	"sh":   "sh",
+	"ash":  "sh",
+	"dash": "dash",
+	"bash": "bash",
+	"ksh":  "ksh",
+}
+
+// shellHeredocRegex matches the command line of a RUN whose heredoc is
+// its script: a bare <<EOF, or one fed to a shell such as bash <<EOF.
+var shellHeredocRegex = regexp.MustCompile(`^(?:(\S*\b(?:sh|ash|dash|bash|ksh))(?:\s+-\w+)*\s+)?\d*<<-?["']?[A-Za-z_][\w.-]*["']?$`)
+
+// shebangRegex matches the interpreter of a shebang line.
+var shebangRegex = regexp.MustCompile(`^#!\s*(?:/usr/bin/env\s+)?(\S+)`)
+
+// RunScripts returns the shell scripts of the RUN instructions of a
+// Dockerfile. Exec-form RUNs, Windows stages, shells shellcheck doesn't
+// know and heredocs run by other interpreters are left out.
+func RunScripts(pdf *ParsedDockerfile, lines []string) []RunScript {
+	if pdf.Escape != '\\' {
+		return nil
+	}
+	var scripts []RunScript
+	shells := make([]string, len(pdf.Stages))
+	vars := make([][]string, len(pdf.Stages))
+	for i, stage := range pdf.Stages {
+		shell := "sh"
+		var stageVars []string
+		for name := range pdf.Args {
+			stageVars = append(stageVars, name)
+		}
+		if parent := pdf.resolveStageRef(i, stage.BaseImage); parent >= 0 {
+			shell, stageVars = shells[parent], append(stageVars, vars[parent]...)
+		} else if IsWindowsImage(stage.BaseImage) {
+			shell = ""
+		}
+		for _, inst := range stage.Instructions {
+			switch inst.Command {
+			case "SHELL":
+				shell = shellDialect(inst.Args)
+			case "ENV":
+				for _, v := range ParseEnv(inst.Args) {
+					stageVars = append(stageVars, v.Key)
+				}
+			case "ARG":
+				for _, field := range strings.Fields(inst.Args) {
+					name, _, _ := strings.Cut(field, "=")
+					stageVars = append(stageVars, name)
+				}
+			case "RUN":
+				if shell == "" || strings.HasPrefix(strings.TrimSpace(inst.Args), "[") {
+					continue
+				}
+				script, ok := runScript(inst, lines)
+				if !ok {
+					continue
+				}
+				script.Shell = shell
+				if len(script.Script) > 2 && strings.HasPrefix(script.Script, "#!") {
+					if m := shebangRegex.FindStringSubmatch(script.Script); m != nil {
+						if script.Shell = shellDialects[path.Base(m[1])]; script.Shell == "" {
+							continue
+						}
+					}
+				}
+				script.Vars = append([]string(nil), stageVars...)
+				scripts = append(scripts, script)
+			}
+		}
+		shells[i], vars[i] = shell, stageVars
+	}
+	return scripts
+}
+
+// shellDialect returns the dialect of the shell a SHELL instruction
+// selects, or "" for shells shellcheck doesn't check.
+func shellDialect(args string) string {
+	var argv []string
+	if err := json.Unmarshal([]byte(args), &argv); err != nil || len(argv) == 0 {
+		return ""
+	}
+	return shellDialects[path.Base(argv[0])]
+}
+
+// runScript extracts the script of a shell-form RUN from lines: the body
+// of its heredoc when that is the script, or its command otherwise.
+func runScript(inst Instruction, lines []string) (RunScript, bool) {
+	s := RunScript{Instruction: inst}
+	if len(inst.Heredocs) > 0 {
+		command := strings.TrimSpace(strings.SplitN(inst.Args, "\n", 2)[0])
+		if len(inst.Heredocs) > 1 || !shellHeredocRegex.MatchString(command) {
+			return s, false
+		}
+		m := shellHeredocRegex.FindStringSubmatch(command)
+		if m[1] != "" && shellDialects[path.Base(m[1])] == "" {
+			return s, false
+		}
+		body := strings.Split(inst.Heredocs[0], "\n")
+		first := inst.EndLine - len(body)
+		for i := range body {
+			s.Lines = append(s.Lines, first+i)
+		}
+		s.Script = inst.Heredocs[0]
+		return s, true
+	}
+
+	var script []string
+	flags := true
+	for n := inst.Line; n <= inst.EndLine && n <= len(lines); n++ {
+		line := lines[n-1]
+		trimmed := strings.TrimSpace(line)
+		if n > inst.Line && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+		if n == inst.Line {
+			// Drop the RUN keyword
+			line = strings.TrimSpace(trimmed[len("RUN"):])
+		}
+		for flags {
+			line = strings.TrimLeft(line, " \t")
+			if !strings.HasPrefix(line, "--") {
+				if strings.TrimSpace(line) != `\` && strings.TrimSpace(line) != "" {
+					flags = false
+				}
+				break
+			}
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			line = line[end:]
+		}
+		if flags {
+			continue
+		}
+		script = append(script, line)
+		s.Lines = append(s.Lines, n)
+	}
+	if len(script) == 0 {
+		return s, false
+	}
+	s.Script = strings.Join(script, "\n")
+	return s, true
+}
+
+// shellcheckResult is the json1 output of shellcheck.
+type shellcheckResult struct {
+	Comments []struct {
+		Line    int    `json:"line"`
+		Code    int    `json:"code"`
+		Level   string `json:"level"` // error, warning, info, style
+		Message string `json:"message"`
+	} `json:"comments"`
+}
+
+// isShellcheckAvailable checks whether shellcheck is installed and on PATH.
+func isShellcheckAvailable() bool {
+	_, err := exec.LookPath("shellcheck")
+	return err == nil
+}
+
+// runShellcheck checks the shell scripts of the RUN instructions of a
+// Dockerfile with shellcheck.
+func runShellcheck(pdf *ParsedDockerfile, lines []string, cfg config.ShellcheckConfig) ([]models.Issue, error) {
+	shellcheckPath, err := exec.LookPath("shellcheck")
+	if err != nil {
+		return nil, fmt.Errorf("shellcheck not found: %w", err)
+	}
+
+	var issues []models.Issue
+	for _, script := range RunScripts(pdf, lines) {
+		args := []string{"--format=json1", "--shell=" + script.Shell}
+		if len(cfg.Exclude) > 0 {
+			args = append(args, "--exclude="+strings.Join(cfg.Exclude, ","))
+		}
+		var stdout bytes.Buffer
+		cmd := exec.Command(shellcheckPath, append(args, "-")...)
+		cmd.Stdin = strings.NewReader(shellcheckInput(script))
+		cmd.Stdout = &stdout
+
+		// shellcheck returns exit code 1 when it finds issues, which is
+		// expected.
+		_ = cmd.Run()
+		if stdout.Len() == 0 {
+			continue
+		}
+		found, err := shellcheckIssues(stdout.Bytes(), script)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, found...)
+	}
+	return issues, nil
+}
+
+// shellcheckInput returns the script as shellcheck gets it: after a line
+// exporting the ARGs and ENVs set before the RUN, so that referencing
+// them isn't reported as unassigned.
+func shellcheckInput(script RunScript) string {
+	var exports []string
+	seen := make(map[string]bool)
+	for _, name := range script.Vars {
+		if !seen[name] && envVarNameRegex.MatchString(name) {
+			seen[name] = true
+			exports = append(exports, name+"=")
+		}
+	}
+	prelude := ":"
+	if len(exports) > 0 {
+		prelude = "export " + strings.Join(exports, " ")
+	}
+	return prelude + "\n" + script.Script + "\n"
+}
+
+// envVarNameRegex matches valid shell variable names.
+var envVarNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// shellcheckIssues converts the json1 output of shellcheck for a script
+// into DIO issues on the lines of the Dockerfile.
+func shellcheckIssues(output []byte, script RunScript) ([]models.Issue, error) {
+	var result shellcheckResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse shellcheck output: %w", err)
+	}
+	var issues []models.Issue
+	for _, c := range result.Comments {
+		// Line 1 is the exports shellcheckInput adds
+		line := script.Instruction.Line
+		if n := c.Line - 2; n >= 0 && n < len(script.Lines) {
+			line = script.Lines[n]
+		}
+		code := fmt.Sprintf("SC%d", c.Code)
+		issues = append(issues, models.Issue{
+			ID:          code,
+			Severity:    mapShellcheckLevel(c.Level),
+			Category:    "shellcheck",
+			Title:       code + ": " + truncate(c.Message, 80),
+			Description: c.Message,
+			Line:        line,
+		})
+	}
+	return issues, nil
+}
+
+// mapShellcheckLevel converts shellcheck levels to DIO severity.
+func mapShellcheckLevel(level string) models.Severity {
+	switch level {
+	case "error":
+		return models.SeverityHigh
+	case "warning":
+		return models.SeverityMedium
+	case "info":
+		return models.SeverityLow
+	default:
+		return models.SeverityInfo
+	}
+}
+
+// dropHadolintShellcheck drops the shellcheck findings hadolint reports,
+// HL-SC codes, which shellcheck reported itself with the lines of the
+// script rather than of the RUN.
+func dropHadolintShellcheck(issues []models.Issue) []models.Issue {
+	kept := issues[:0]
+	for _, issue := range issues {
+		if !strings.HasPrefix(issue.ID, "HL-SC") {
+			kept = append(kept, issue)
+		}
+	}
+	return kept
+}
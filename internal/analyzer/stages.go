@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// resolveStageRef resolves a stage name or index used in stage i, by FROM,
+// COPY --from or RUN --mount=from, to the index of an earlier stage. A name
+// refers to the latest stage with that name defined before i, so an earlier
+// stage of the same name is shadowed. It returns -1 for images.
+func (p *ParsedDockerfile) resolveStageRef(i int, ref string) int {
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n >= 0 && n < i {
+			return n
+		}
+		return -1
+	}
+	for j := i - 1; j >= 0; j-- {
+		if p.Stages[j].Name != "" && strings.EqualFold(p.Stages[j].Name, ref) {
+			return j
+		}
+	}
+	return -1
+}
+
+// stageRefs returns the references of stage i to other stages or images:
+// its FROM image, and the sources of its COPY --from and RUN --mount=from.
+func (p *ParsedDockerfile) stageRefs(i int) []string {
+	refs := []string{p.Stages[i].BaseImage}
+	for _, inst := range p.Stages[i].Instructions {
+		if from := copyFromFlag(inst); from != "" {
+			refs = append(refs, ExpandArgs(from, p.Args))
+		}
+		for _, m := range RunMounts(inst) {
+			if m.From != "" {
+				refs = append(refs, ExpandArgs(m.From, p.Args))
+			}
+		}
+	}
+	return refs
+}
+
+// DanglingStageRefs returns the references by FROM, COPY --from or RUN
+// --mount=from that name one of names, or a stage index, but no stage
+// defined before them. Docker would pull a name as an image and fail on an
+// index.
+func (p *ParsedDockerfile) DanglingStageRefs(names []string) []string {
+	stages := make(map[string]bool)
+	for _, name := range names {
+		stages[strings.ToLower(name)] = true
+	}
+	var dangling []string
+	for i := range p.Stages {
+		for _, ref := range p.stageRefs(i) {
+			_, err := strconv.Atoi(ref)
+			if (err == nil || stages[strings.ToLower(ref)]) && p.resolveStageRef(i, ref) < 0 {
+				dangling = append(dangling, ref)
+			}
+		}
+	}
+	return dangling
+}
+
+// DeadStage is a stage that building the final stage never uses.
+type DeadStage struct {
+	Index int
+	// ShadowedBy is the index of the later stage with the same name, which
+	// references by that name reach instead; -1 if there is none.
+	ShadowedBy int
+}
+
+// DeadStages returns the stages that the final stage doesn't reach through
+// FROM, COPY --from or RUN --mount=from, directly or through other stages.
+// BuildKit skips them. Stages after a --target are left out, since they are
+// built with other targets. It returns nil when a reference can't be
+// resolved, e.g. COPY --from=${STAGE} without a default.
+func (p *ParsedDockerfile) DeadStages() []DeadStage {
+	final := p.FinalStage()
+	if final < 1 {
+		return nil
+	}
+	used := map[int]bool{final: true}
+	queue := []int{final}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, ref := range p.stageRefs(i) {
+			if strings.Contains(ref, "$") {
+				return nil
+			}
+			if j := p.resolveStageRef(i, ref); j >= 0 && !used[j] {
+				used[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	var dead []DeadStage
+	for i := 0; i < final; i++ {
+		if used[i] {
+			continue
+		}
+		d := DeadStage{Index: i, ShadowedBy: -1}
+		for j := i + 1; j < len(p.Stages) && p.Stages[i].Name != ""; j++ {
+			if strings.EqualFold(p.Stages[j].Name, p.Stages[i].Name) {
+				d.ShadowedBy = j
+				break
+			}
+		}
+		dead = append(dead, d)
+	}
+	return dead
+}
+
+// --- DeadStageRule ---
+
+type DeadStageRule struct{}
+
+func (r *DeadStageRule) ID() string { return "DIO023" }
+
+func (r *DeadStageRule) Check(ctx *AnalysisContext) []models.Issue {
+	pdf := ctx.ParsedFile
+	var issues []models.Issue
+	for _, d := range pdf.DeadStages() {
+		stage := pdf.Stages[d.Index]
+		label := stage.Label(d.Index)
+		issue := models.Issue{
+			ID:          r.ID(),
+			Severity:    models.SeverityLow,
+			Category:    "best-practice",
+			Title:       "Unused build stage",
+			Description: fmt.Sprintf("Stage %s is never used by the final stage: no FROM, COPY --from or RUN --mount=from reaches it. BuildKit skips it, the legacy builder builds it for nothing, and readers have to work out that it doesn't matter.", label),
+			Line:        stage.StartLine,
+			Suggestion:  "Remove the stage. If it is a separate image built with --target, such as a test stage, it can stay.",
+			AutoFixable: true,
+		}
+		if d.ShadowedBy >= 0 {
+			issue.Severity = models.SeverityMedium
+			issue.Title = "Build stage shadowed by a later one"
+			issue.Description = fmt.Sprintf("Stage %s has the same name as the stage on line %d, so references to %s after it reach that stage instead, and this one is never used.", label, pdf.Stages[d.ShadowedBy].StartLine, stage.Name)
+			issue.Suggestion = "Remove the stage, or rename it if one of the references was meant for it."
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
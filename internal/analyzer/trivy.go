@@ -0,0 +1,160 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// trivyConfigOutput is the output of trivy config --format json.
+type trivyConfigOutput struct {
+	Results []struct {
+		Target            string `json:"Target"`
+		Misconfigurations []struct {
+			// ID is DS002 in older trivy versions and DS-0002 in newer
+			// ones, AVDID AVD-DS-0002 in both.
+			ID            string `json:"ID"`
+			AVDID         string `json:"AVDID"`
+			Title         string `json:"Title"`
+			Message       string `json:"Message"`
+			Resolution    string `json:"Resolution"`
+			Severity      string `json:"Severity"`
+			PrimaryURL    string `json:"PrimaryURL"`
+			Status        string `json:"Status"`
+			CauseMetadata struct {
+				StartLine int `json:"StartLine"`
+			} `json:"CauseMetadata"`
+		} `json:"Misconfigurations"`
+	} `json:"Results"`
+}
+
+// trivySeverities maps trivy severities to DIO severities.
+var trivySeverities = map[string]models.Severity{
+	"CRITICAL": models.SeverityCritical,
+	"HIGH":     models.SeverityHigh,
+	"MEDIUM":   models.SeverityMedium,
+	"LOW":      models.SeverityLow,
+}
+
+// trivyOverlaps maps trivy's Dockerfile checks to the built-in rules,
+// native extended rules and hadolint codes reporting the same problem.
+var trivyOverlaps = map[string][]string{
+	"AVD-DS-0001": {"DIO001", "DL3007"},
+	"AVD-DS-0002": {"DIO006", "DL3002"},
+	"AVD-DS-0005": {"DL3020"},
+	"AVD-DS-0006": {"DL3023"},
+	"AVD-DS-0007": {"DL4004"},
+	"AVD-DS-0008": {"DL3011"},
+	"AVD-DS-0009": {"DL3000"},
+	"AVD-DS-0010": {"DL3004"},
+	"AVD-DS-0011": {"DL3021"},
+	"AVD-DS-0012": {"DL3024"},
+	"AVD-DS-0013": {"DL3003"},
+	"AVD-DS-0014": {"DL4001"},
+	"AVD-DS-0015": {"DL3032", "DIO005"},
+	"AVD-DS-0016": {"DL4003"},
+	"AVD-DS-0017": {"DIO040", "DL3009"},
+	"AVD-DS-0019": {"DL3040", "DIO005"},
+	"AVD-DS-0020": {"DL3036", "DIO005"},
+	"AVD-DS-0021": {"DL3014"},
+	"AVD-DS-0022": {"DL4000"},
+	"AVD-DS-0023": {"DL3012"},
+	"AVD-DS-0024": {"DL3005"},
+	"AVD-DS-0025": {"DL3019", "DIO005"},
+	"AVD-DS-0026": {"DIO012"},
+	"AVD-DS-0029": {"DL3015", "DIO004"},
+	"AVD-DS-0031": {"DIO036"},
+}
+
+// trivyFileLevel are the checks about the image as a whole, which trivy
+// and the built-in rules report on different lines.
+var trivyFileLevel = map[string]bool{
+	"AVD-DS-0002": true,
+	"AVD-DS-0026": true,
+}
+
+// runTrivyConfig scans a Dockerfile for misconfigurations with trivy
+// config. Whatever its name, the file is scanned as a Dockerfile.
+func runTrivyConfig(dockerfilePath string, cfg config.TrivyConfig) ([]models.Issue, error) {
+	trivyPath, err := exec.LookPath("trivy")
+	if err != nil {
+		return nil, fmt.Errorf("trivy not found: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(trivyPath, trivyConfigArgs(dockerfilePath)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil && stdout.Len() == 0 {
+		return nil, fmt.Errorf("trivy config failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return trivyConfigIssues(stdout.Bytes(), cfg.Exclude)
+}
+
+// trivyConfigArgs builds the trivy config command line of a Dockerfile.
+func trivyConfigArgs(dockerfilePath string) []string {
+	pattern := "dockerfile:" + regexp.QuoteMeta(filepath.Base(dockerfilePath)) + "$"
+	return []string{"config", "--format", "json", "--quiet", "--file-patterns", pattern, dockerfilePath}
+}
+
+// trivyConfigIssues converts the JSON output of trivy config into DIO
+// issues, identified by their AVD ID. Checks that passed, and those
+// exclude lists by AVD ID or trivy ID, are left out.
+func trivyConfigIssues(output []byte, exclude []string) ([]models.Issue, error) {
+	var result trivyConfigOutput
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse trivy output: %w", err)
+	}
+	excluded := make(map[string]bool)
+	for _, id := range exclude {
+		excluded[id] = true
+	}
+
+	var issues []models.Issue
+	for _, r := range result.Results {
+		for _, m := range r.Misconfigurations {
+			if m.Status != "" && m.Status != "FAIL" {
+				continue
+			}
+			id := m.AVDID
+			if id == "" {
+				id = m.ID
+			}
+			if excluded[id] || excluded[m.ID] {
+				continue
+			}
+			severity, ok := trivySeverities[m.Severity]
+			if !ok {
+				severity = models.SeverityInfo
+			}
+			issues = append(issues, models.Issue{
+				ID:          id,
+				Severity:    severity,
+				Category:    "trivy",
+				Title:       m.Title,
+				Description: m.Message,
+				Line:        m.CauseMetadata.StartLine,
+				Suggestion:  m.Resolution,
+				DocsURL:     m.PrimaryURL,
+			})
+		}
+	}
+	return issues, nil
+}
+
+// mergeTrivyIssues appends the trivy findings, skipping those an equivalent
+// built-in, extended or hadolint rule already reported, and records why
+// each was kept or dropped.
+func mergeTrivyIssues(issues, trivyIssues []models.Issue) ([]models.Issue, []models.HadolintDecision) {
+	return mergeOverlappingIssues(issues, trivyIssues, func(issue models.Issue) string {
+		return issue.ID
+	}, trivyOverlaps, trivyFileLevel)
+}
@@ -0,0 +1,191 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dependency updaters that keep base image references current. With one
+// in place, DIO001 only asks for what the updater can't do on its own.
+const (
+	UpdaterRenovate   = "renovate"
+	UpdaterDependabot = "dependabot"
+	// UpdaterNone turns detection off in analyzer.updater.
+	UpdaterNone = "none"
+)
+
+// renovateConfigs are the files Renovate reads its config from, relative
+// to the repository root, in the order it looks for them.
+var renovateConfigs = []string{
+	"renovate.json",
+	"renovate.json5",
+	".github/renovate.json",
+	".github/renovate.json5",
+	".gitlab/renovate.json",
+	".gitlab/renovate.json5",
+	".renovaterc",
+	".renovaterc.json",
+	".renovaterc.json5",
+}
+
+// renovateConfig holds the settings that turn Dockerfile updates off.
+type renovateConfig struct {
+	Enabled         *bool    `json:"enabled"`
+	EnabledManagers []string `json:"enabledManagers"`
+	Dockerfile      struct {
+		Enabled *bool `json:"enabled"`
+	} `json:"dockerfile"`
+	// Docker holds the same settings in older configs
+	Docker struct {
+		Enabled *bool `json:"enabled"`
+	} `json:"docker"`
+}
+
+// dependabotConfig is the part of .github/dependabot.yml that says which
+// directories get Docker updates.
+type dependabotConfig struct {
+	Updates []struct {
+		Ecosystem   string   `yaml:"package-ecosystem"`
+		Directory   string   `yaml:"directory"`
+		Directories []string `yaml:"directories"`
+	} `yaml:"updates"`
+}
+
+// DetectUpdater returns the dependency updater that keeps the base images
+// of the Dockerfile at dockerfilePath current, UpdaterRenovate or
+// UpdaterDependabot, or "" when there is none. Their config is looked up
+// at the root of the git repository containing the Dockerfile.
+func DetectUpdater(dockerfilePath string) string {
+	abs, err := filepath.Abs(dockerfilePath)
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Dir(abs)
+	root := repoRoot(dir)
+	if root == "" {
+		return ""
+	}
+	if renovateUpdatesDocker(root) {
+		return UpdaterRenovate
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err == nil && dependabotUpdatesDocker(root, "/"+strings.TrimPrefix(filepath.ToSlash(rel), ".")) {
+		return UpdaterDependabot
+	}
+	return ""
+}
+
+// repoRoot returns the closest directory at or above dir with a .git
+// entry, or "" outside a repository.
+func repoRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// renovateUpdatesDocker reports whether the repository at root has a
+// Renovate config that leaves the dockerfile manager on. Configs that
+// can't be read as JSON, such as JSON5, are taken to leave it on, as it is
+// by default.
+func renovateUpdatesDocker(root string) bool {
+	for _, name := range renovateConfigs {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil {
+			continue
+		}
+		var cfg renovateConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return true
+		}
+		return cfg.updatesDocker()
+	}
+	// Renovate also reads the renovate key of package.json
+	data, err := os.ReadFile(filepath.Join(root, "package.json"))
+	if err != nil {
+		return false
+	}
+	var pkg struct {
+		Renovate *renovateConfig `json:"renovate"`
+	}
+	if json.Unmarshal(data, &pkg) != nil || pkg.Renovate == nil {
+		return false
+	}
+	return pkg.Renovate.updatesDocker()
+}
+
+func (c *renovateConfig) updatesDocker() bool {
+	if c.Enabled != nil && !*c.Enabled {
+		return false
+	}
+	if len(c.EnabledManagers) > 0 && !containsString(c.EnabledManagers, "dockerfile") {
+		return false
+	}
+	for _, enabled := range []*bool{c.Dockerfile.Enabled, c.Docker.Enabled} {
+		if enabled != nil && !*enabled {
+			return false
+		}
+	}
+	return true
+}
+
+// dependabotUpdatesDocker reports whether the Dependabot config of the
+// repository at root has Docker updates for dir, a directory given
+// relative to root with a leading slash, the way Dependabot writes it.
+func dependabotUpdatesDocker(root, dir string) bool {
+	for _, name := range []string{"dependabot.yml", "dependabot.yaml"} {
+		data, err := os.ReadFile(filepath.Join(root, ".github", name))
+		if err != nil {
+			continue
+		}
+		var cfg dependabotConfig
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return false
+		}
+		for _, u := range cfg.Updates {
+			if u.Ecosystem != "docker" {
+				continue
+			}
+			for _, pattern := range append(u.Directories, u.Directory) {
+				if pattern != "" && dependabotDirMatches(pattern, dir) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// dependabotDirMatches reports whether a directory or directories entry
+// of a Dependabot config covers dir. Entries are exact directories or
+// globs, where a trailing /** matches a directory and all below it.
+func dependabotDirMatches(pattern, dir string) bool {
+	clean := func(p string) string { return path.Clean("/" + strings.TrimPrefix(p, "/")) }
+	pattern, dir = clean(pattern), clean(dir)
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return prefix == "" || dir == prefix || strings.HasPrefix(dir, prefix+"/")
+	}
+	matched, _ := path.Match(pattern, dir)
+	return matched
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
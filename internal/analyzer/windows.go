@@ -0,0 +1,59 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// windowsImagePrefixes identify Windows base images.
+var windowsImagePrefixes = []string{
+	"mcr.microsoft.com/windows",
+	"microsoft/windowsservercore",
+	"microsoft/nanoserver",
+}
+
+// IsWindowsImage reports whether an image reference is a Windows base image,
+// including runtime images built on servercore or nanoserver tags.
+func IsWindowsImage(image string) bool {
+	image = strings.ToLower(image)
+	for _, prefix := range windowsImagePrefixes {
+		if strings.HasPrefix(image, prefix) {
+			return true
+		}
+	}
+	if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		tag := image[idx+1:]
+		return strings.Contains(tag, "windowsservercore") || strings.Contains(tag, "nanoserver")
+	}
+	return false
+}
+
+// IsWindows reports whether the final image is built on a Windows base image.
+func (p *ParsedDockerfile) IsWindows() bool {
+	for _, stage := range p.StageChain(p.FinalStage()) {
+		if IsWindowsImage(stage.BaseImage) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNanoserver reports whether the final image is built on nanoserver, whose
+// default user is the unprivileged ContainerUser.
+func (p *ParsedDockerfile) isNanoserver() bool {
+	for _, stage := range p.StageChain(p.FinalStage()) {
+		if strings.Contains(strings.ToLower(stage.BaseImage), "nanoserver") {
+			return true
+		}
+	}
+	return false
+}
+
+// nonPOSIXShellRegex matches SHELL arguments selecting PowerShell or cmd.
+var nonPOSIXShellRegex = regexp.MustCompile(`(?i)\b(powershell|pwsh|cmd)(\.exe)?\b`)
+
+// isPOSIXShell reports whether SHELL arguments select a POSIX shell.
+// PowerShell and cmd don't support options like -o pipefail.
+func isPOSIXShell(shell string) bool {
+	return !nonPOSIXShellRegex.MatchString(shell)
+}
@@ -0,0 +1,141 @@
+// Package badge renders the health of an image, its score and policy
+// status, as a README badge: a flat SVG like the ones shields.io draws, or
+// the JSON a shields.io endpoint badge reads.
+package badge
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// DefaultLabel is the left-hand text of a badge.
+const DefaultLabel = "dio"
+
+// Badge is the text and color of a badge. Color is a shields.io color
+// name, such as brightgreen or red.
+type Badge struct {
+	Label   string
+	Message string
+	Color   string
+}
+
+// Endpoint is the JSON a shields.io endpoint badge reads, see
+// https://shields.io/badges/endpoint-badge.
+type Endpoint struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// colors maps the shields.io color names used here to their hex values.
+var colors = map[string]string{
+	"brightgreen": "#4c1",
+	"green":       "#97ca00",
+	"yellow":      "#dfb317",
+	"orange":      "#fe7d37",
+	"red":         "#e05d44",
+	"lightgrey":   "#9f9f9f",
+}
+
+// For returns the badge of a run: its score and whether it passed the
+// policy, e.g. "85/100 | passing". A failing policy makes the badge red
+// whatever the score; otherwise the score picks the color.
+func For(result *models.PipelineResult) Badge {
+	b := Badge{Label: DefaultLabel, Color: "lightgrey"}
+	var parts []string
+	if result.Analysis != nil {
+		parts = append(parts, fmt.Sprintf("%d/100", result.Analysis.Score))
+		b.Color = scoreColor(result.Analysis.Score)
+	}
+	if result.Policy != nil {
+		if result.Policy.Passed || result.Policy.Override != nil {
+			parts = append(parts, "passing")
+			if result.Analysis == nil {
+				b.Color = "brightgreen"
+			}
+		} else {
+			parts = append(parts, "failing")
+			b.Color = "red"
+		}
+	}
+	b.Message = strings.Join(parts, " | ")
+	if b.Message == "" {
+		b.Message = "unknown"
+	}
+	return b
+}
+
+// Unknown is the badge shown when there is no run to report on.
+func Unknown() Badge {
+	return Badge{Label: DefaultLabel, Message: "unknown", Color: "lightgrey"}
+}
+
+func scoreColor(score int) string {
+	switch {
+	case score >= 90:
+		return "brightgreen"
+	case score >= 75:
+		return "green"
+	case score >= 60:
+		return "yellow"
+	case score >= 40:
+		return "orange"
+	default:
+		return "red"
+	}
+}
+
+// Endpoint returns the badge as shields.io endpoint JSON.
+func (b Badge) Endpoint() Endpoint {
+	return Endpoint{SchemaVersion: 1, Label: b.Label, Message: b.Message, Color: b.Color}
+}
+
+// SVG renders the badge in the flat style of shields.io.
+func (b Badge) SVG() []byte {
+	fill := colors[b.Color]
+	if fill == "" {
+		fill = colors["lightgrey"]
+	}
+	lw, mw := textWidth(b.Label)+10, textWidth(b.Message)+10
+	w := lw + mw
+	label, message := html.EscapeString(b.Label), html.EscapeString(b.Message)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`, w, label, message))
+	sb.WriteString(fmt.Sprintf(`<title>%s: %s</title>`, label, message))
+	sb.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	sb.WriteString(fmt.Sprintf(`<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, w))
+	sb.WriteString(fmt.Sprintf(`<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`, lw, lw, mw, fill, w))
+	sb.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	for _, t := range []struct {
+		x    int
+		text string
+	}{{lw / 2, label}, {lw + mw/2, message}} {
+		sb.WriteString(fmt.Sprintf(`<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`, t.x, t.text, t.x, t.text))
+	}
+	sb.WriteString("</g></svg>\n")
+	return []byte(sb.String())
+}
+
+// textWidth approximates the width in pixels of s in 11px Verdana, which
+// is close enough to size the badge without font metrics.
+func textWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune("fijlrt.,:;!|' ", r):
+			w += 4
+		case strings.ContainsRune("mwMW", r):
+			w += 10
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			w += 7
+		default:
+			w += 6
+		}
+	}
+	return w
+}
@@ -0,0 +1,50 @@
+package badge
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func TestFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  *models.PipelineResult
+		message string
+		color   string
+	}{
+		{"score only", &models.PipelineResult{Analysis: &models.AnalysisResult{Score: 92}}, "92/100", "brightgreen"},
+		{"passing", &models.PipelineResult{
+			Analysis: &models.AnalysisResult{Score: 65},
+			Policy:   &models.PolicyResult{Passed: true},
+		}, "65/100 | passing", "yellow"},
+		{"failing", &models.PipelineResult{
+			Analysis: &models.AnalysisResult{Score: 95},
+			Policy:   &models.PolicyResult{},
+		}, "95/100 | failing", "red"},
+		{"overridden", &models.PipelineResult{
+			Analysis: &models.AnalysisResult{Score: 80},
+			Policy:   &models.PolicyResult{Override: &models.PolicyOverride{Reason: "hotfix"}},
+		}, "80/100 | passing", "green"},
+		{"image evaluation", &models.PipelineResult{Policy: &models.PolicyResult{Passed: true}}, "passing", "brightgreen"},
+		{"nothing", &models.PipelineResult{}, "unknown", "lightgrey"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := For(tt.result)
+			if b.Message != tt.message || b.Color != tt.color {
+				t.Errorf("badge = %q %s, want %q %s", b.Message, b.Color, tt.message, tt.color)
+			}
+		})
+	}
+}
+
+func TestSVG(t *testing.T) {
+	svg := string(Badge{Label: "dio", Message: "<80> | passing", Color: "green"}.SVG())
+	for _, want := range []string{`<title>dio: &lt;80&gt; | passing</title>`, `fill="#97ca00"`, `role="img"`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("expected %q in the SVG:\n%s", want, svg)
+		}
+	}
+}
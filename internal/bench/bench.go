@@ -0,0 +1,243 @@
+// Package bench builds several candidate Dockerfiles for the same
+// application and ranks them by image size, CVEs, layers and build time.
+package bench
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/reporter"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// Sort keys for ranking candidates.
+const (
+	SortSize   = "size"
+	SortCVEs   = "cves"
+	SortBuild  = "build"
+	SortLayers = "layers"
+)
+
+// BuildFunc builds a Dockerfile into an image tagged tag. Cold builds
+// bypass the build cache.
+type BuildFunc func(dockerfile, contextDir, tag string, cold bool) (*models.ImageMetrics, error)
+
+// ScanFunc scans an image for vulnerabilities.
+type ScanFunc func(image string) (*models.ScanResult, error)
+
+// Options configures a benchmark.
+type Options struct {
+	// ContextDir is the build context of every candidate. Empty means each
+	// Dockerfile's own directory.
+	ContextDir string
+	Scan       ScanFunc // nil skips scanning
+	Sort       string   // one of the Sort keys; empty means SortSize
+	// OnResult, if set, is called as each candidate finishes.
+	OnResult func(Result)
+}
+
+// Result is one benchmarked Dockerfile.
+type Result struct {
+	Dockerfile string  `json:"dockerfile"`
+	Image      string  `json:"image"`
+	Rank       int     `json:"rank"`
+	Size       int64   `json:"size"`
+	Layers     int     `json:"layers"`
+	ColdBuild  float64 `json:"cold_build_seconds"`
+	WarmBuild  float64 `json:"warm_build_seconds"`
+	Scanned    bool    `json:"scanned"`
+	Critical   int     `json:"critical"`
+	High       int     `json:"high"`
+	Medium     int     `json:"medium"`
+	Low        int     `json:"low"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Report is the ranked result of a benchmark.
+type Report struct {
+	Timestamp time.Time `json:"timestamp"`
+	Sort      string    `json:"sort"`
+	// Baseline is the first Dockerfile given, which sizes are compared to.
+	Baseline string   `json:"baseline"`
+	Results  []Result `json:"results"` // best first
+}
+
+// Run builds each Dockerfile twice, first without the build cache for the
+// cold build time and then again with the cache warm, scans the images
+// and ranks them. A candidate that fails to build or scan is reported with
+// its error and ranked last.
+func Run(dockerfiles []string, build BuildFunc, opts Options) (*Report, error) {
+	if len(dockerfiles) == 0 {
+		return nil, fmt.Errorf("no Dockerfiles to compare")
+	}
+	if opts.Sort == "" {
+		opts.Sort = SortSize
+	}
+	switch opts.Sort {
+	case SortSize, SortCVEs, SortBuild, SortLayers:
+	default:
+		return nil, fmt.Errorf("unknown sort key %q (supported: %s, %s, %s, %s)", opts.Sort, SortSize, SortCVEs, SortBuild, SortLayers)
+	}
+
+	report := &Report{Timestamp: time.Now(), Sort: opts.Sort, Baseline: dockerfiles[0]}
+	for i, dockerfile := range dockerfiles {
+		r := run(dockerfile, Tag(i, dockerfile), build, opts)
+		if opts.OnResult != nil {
+			opts.OnResult(r)
+		}
+		report.Results = append(report.Results, r)
+	}
+	report.rank()
+	return report, nil
+}
+
+func run(dockerfile, tag string, build BuildFunc, opts Options) Result {
+	r := Result{Dockerfile: dockerfile, Image: tag}
+	contextDir := opts.ContextDir
+	if contextDir == "" {
+		contextDir = filepath.Dir(dockerfile)
+	}
+
+	cold, err := build(dockerfile, contextDir, tag, true)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.ColdBuild = cold.BuildTime
+	warm, err := build(dockerfile, contextDir, tag, false)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.WarmBuild = warm.BuildTime
+	r.Size, r.Layers = warm.Size, warm.Layers
+
+	if opts.Scan != nil {
+		scan, err := opts.Scan(tag)
+		if err != nil {
+			r.Error = fmt.Sprintf("scan failed: %v", err)
+			return r
+		}
+		r.Scanned = true
+		r.Critical, r.High = scan.CriticalCount, scan.HighCount
+		r.Medium, r.Low = scan.MediumCount, scan.LowCount
+	}
+	return r
+}
+
+var tagUnsafe = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// Tag returns the image tag of the i-th candidate, e.g.
+// dio-bench:2-dockerfile.optimized.
+func Tag(i int, dockerfile string) string {
+	name := strings.Trim(tagUnsafe.ReplaceAllString(strings.ToLower(filepath.Base(dockerfile)), "-"), "-.")
+	tag := fmt.Sprintf("%d-%s", i+1, name)
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return "dio-bench:" + tag
+}
+
+// rank sorts the results by the sort key. Ties are broken by CVEs, size,
+// warm build time and layers, in that order, so candidates that are equal
+// on the chosen key still get a stable, meaningful order.
+func (r *Report) rank() {
+	keys := []string{r.Sort, SortCVEs, SortSize, SortBuild, SortLayers}
+	sort.SliceStable(r.Results, func(i, j int) bool {
+		a, b := r.Results[i], r.Results[j]
+		if (a.Error == "") != (b.Error == "") {
+			return a.Error == ""
+		}
+		for _, key := range keys {
+			if c := compare(a, b, key); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	for i := range r.Results {
+		r.Results[i].Rank = i + 1
+	}
+}
+
+// compare orders two results by key: negative when a is better.
+func compare(a, b Result, key string) int {
+	switch key {
+	case SortSize:
+		return sign(float64(a.Size - b.Size))
+	case SortLayers:
+		return a.Layers - b.Layers
+	case SortBuild:
+		if c := sign(a.ColdBuild - b.ColdBuild); c != 0 {
+			return c
+		}
+		return sign(a.WarmBuild - b.WarmBuild)
+	case SortCVEs:
+		// The most severe level decides
+		for _, d := range []int{a.Critical - b.Critical, a.High - b.High, a.Medium - b.Medium, a.Low - b.Low} {
+			if d != 0 {
+				return d
+			}
+		}
+	}
+	return 0
+}
+
+func sign(f float64) int {
+	switch {
+	case f < 0:
+		return -1
+	case f > 0:
+		return 1
+	}
+	return 0
+}
+
+// SizeChange returns how a result's size compares with the baseline's, as
+// a percentage, and false when either wasn't built.
+func (r *Report) SizeChange(res Result) (float64, bool) {
+	for _, base := range r.Results {
+		if base.Dockerfile != r.Baseline {
+			continue
+		}
+		if base.Error != "" || res.Error != "" || base.Size == 0 {
+			return 0, false
+		}
+		return float64(res.Size-base.Size) / float64(base.Size) * 100, true
+	}
+	return 0, false
+}
+
+// Markdown renders the report as a ranked table.
+func (r *Report) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("# 🏁 DIO Benchmark\n\n")
+	fmt.Fprintf(&sb, "**Generated:** %s  \n", r.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&sb, "**Ranked by:** %s  \n", r.Sort)
+	fmt.Fprintf(&sb, "**Baseline:** `%s`\n\n", r.Baseline)
+
+	sb.WriteString("| # | Dockerfile | Size | vs baseline | Layers | Cold build | Warm build | Critical | High | Medium | Low |\n")
+	sb.WriteString("|---|------------|------|-------------|--------|------------|------------|----------|------|--------|-----|\n")
+	for _, res := range r.Results {
+		if res.Error != "" {
+			fmt.Fprintf(&sb, "| %d | `%s` | ⚠️ %s | | | | | | | | |\n", res.Rank, res.Dockerfile, reporter.MarkdownCell(res.Error))
+			continue
+		}
+		change := "—"
+		if pct, ok := r.SizeChange(res); ok && res.Dockerfile != r.Baseline {
+			change = fmt.Sprintf("%+.1f%%", pct)
+		}
+		cves := "— | — | — | —"
+		if res.Scanned {
+			cves = fmt.Sprintf("%d | %d | %d | %d", res.Critical, res.High, res.Medium, res.Low)
+		}
+		fmt.Fprintf(&sb, "| %d | `%s` | %s | %s | %d | %.1fs | %.1fs | %s |\n",
+			res.Rank, res.Dockerfile, docker.HumanSize(res.Size), change, res.Layers, res.ColdBuild, res.WarmBuild, cves)
+	}
+	return sb.String()
+}
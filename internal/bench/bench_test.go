@@ -0,0 +1,92 @@
+package bench
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func TestRun_Rank(t *testing.T) {
+	images := map[string]models.ImageMetrics{
+		"app/Dockerfile":           {Size: 900, Layers: 12},
+		"app/Dockerfile.optimized": {Size: 300, Layers: 6},
+		"app/Dockerfile.alpine":    {Size: 300, Layers: 5},
+	}
+	cves := map[string]*models.ScanResult{
+		"dio-bench:1-dockerfile":           {CriticalCount: 3},
+		"dio-bench:2-dockerfile.optimized": {HighCount: 1},
+		"dio-bench:4-dockerfile.alpine":    {HighCount: 2},
+	}
+	var builds []string
+	build := func(dockerfile, contextDir, tag string, cold bool) (*models.ImageMetrics, error) {
+		builds = append(builds, dockerfile)
+		if contextDir != "app" {
+			t.Errorf("expected the Dockerfile's directory as context, got %q", contextDir)
+		}
+		img, ok := images[dockerfile]
+		if !ok {
+			return nil, errors.New("docker build failed")
+		}
+		img.ImageName = tag
+		img.BuildTime = 1
+		if cold {
+			img.BuildTime = 10
+		}
+		return &img, nil
+	}
+	scan := func(image string) (*models.ScanResult, error) { return cves[image], nil }
+
+	dockerfiles := []string{"app/Dockerfile", "app/Dockerfile.optimized", "app/Dockerfile.broken", "app/Dockerfile.alpine"}
+	report, err := Run(dockerfiles, build, Options{Scan: scan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(builds) != 7 {
+		t.Errorf("expected a cold and a warm build per candidate, got %v", builds)
+	}
+	var order []string
+	for _, r := range report.Results {
+		order = append(order, r.Dockerfile)
+	}
+	// Equal sizes are decided by CVEs, not layers
+	want := []string{"app/Dockerfile.optimized", "app/Dockerfile.alpine", "app/Dockerfile", "app/Dockerfile.broken"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("ranking by size = %v, want %v", order, want)
+	}
+	if r := report.Results[0]; r.Rank != 1 || r.ColdBuild != 10 || r.WarmBuild != 1 || r.High != 1 {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if pct, ok := report.SizeChange(report.Results[0]); !ok || int(pct) != -66 {
+		t.Errorf("expected -66%% vs baseline, got %.1f (%v)", pct, ok)
+	}
+	md := report.Markdown()
+	if !strings.Contains(md, "| 1 | `app/Dockerfile.optimized` | 300B | -66.7% | 6 | 10.0s | 1.0s | 0 | 1 | 0 | 0 |") ||
+		!strings.Contains(md, "| 4 | `app/Dockerfile.broken` | ⚠️ docker build failed |") {
+		t.Errorf("unexpected markdown:\n%s", md)
+	}
+
+	builds = nil
+	report, err = Run(dockerfiles, build, Options{Scan: scan, Sort: SortCVEs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Results[2].Dockerfile; got != "app/Dockerfile" {
+		t.Errorf("expected the image with critical CVEs ranked last of the built ones, got %s", got)
+	}
+
+	if _, err := Run(dockerfiles, build, Options{Sort: "speed"}); err == nil {
+		t.Error("expected an error for an unknown sort key")
+	}
+}
+
+func TestTag(t *testing.T) {
+	if got := Tag(1, "build/Dockerfile.Optimized"); got != "dio-bench:2-dockerfile.optimized" {
+		t.Errorf("Tag = %q", got)
+	}
+	if got := Tag(0, "docker/App Server+v2.dockerfile"); got != "dio-bench:1-app-server-v2.dockerfile" {
+		t.Errorf("Tag = %q", got)
+	}
+}
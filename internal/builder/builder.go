@@ -2,18 +2,46 @@
 package builder
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"path/filepath"
+	"path"
+	"strings"
 
+	"github.com/maxlar/docker-image-optimizer/internal/diagnose"
 	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/retry"
 	"github.com/maxlar/docker-image-optimizer/pkg/docker"
 )
 
 // Builder handles image building and metric collection.
 type Builder struct {
 	client *docker.Client
+	labels map[string]string
+	logs   []models.BuildLog
+	retry  retry.Policy
+	// args, target and platform apply to every build.
+	args     map[string]string
+	target   string
+	platform string
+	// sourceDateEpoch and rewriteTimestamps date every build.
+	sourceDateEpoch   string
+	rewriteTimestamps bool
 }
 
+// BuildError is a docker build that failed. Build names it: baseline,
+// optimized, cold, reproducibility, attestation or "stage NAME".
+type BuildError struct {
+	Build string
+	Err   error
+}
+
+func (e *BuildError) Error() string {
+	return fmt.Sprintf("%s build failed: %v", e.Build, e.Err)
+}
+
+func (e *BuildError) Unwrap() error { return e.Err }
+
 // New creates a new Builder.
 func New() (*Builder, error) {
 	client, err := docker.NewClient()
@@ -28,25 +56,312 @@ func NewWithClient(client *docker.Client) *Builder {
 	return &Builder{client: client}
 }
 
+// SetLabels sets the labels added to the images built from now on.
+func (b *Builder) SetLabels(labels map[string]string) {
+	b.labels = labels
+}
+
+// SetBuildArgs sets the --build-arg values of the builds from now on.
+func (b *Builder) SetBuildArgs(args map[string]string) {
+	b.args = args
+}
+
+// SetTarget sets the stage the baseline, optimized and cold builds build
+// up to. Empty builds the final stage.
+func (b *Builder) SetTarget(stage string) {
+	b.target = stage
+}
+
+// SetPlatform sets the platform of the builds from now on, e.g.
+// linux/arm64. Empty builds for the host.
+func (b *Builder) SetPlatform(platform string) {
+	b.platform = platform
+}
+
+// SetSourceDateEpoch dates the builds from now on with SOURCE_DATE_EPOCH, a
+// Unix timestamp, for reproducibility. rewrite also clamps the timestamps
+// of the files in the layers. Empty builds normally.
+func (b *Builder) SetSourceDateEpoch(epoch string, rewrite bool) {
+	b.sourceDateEpoch, b.rewriteTimestamps = epoch, rewrite
+}
+
+// SetRetry sets how builds that fail for transient reasons, such as a
+// timeout pulling the base image or fetching packages, are retried.
+func (b *Builder) SetRetry(policy retry.Policy) {
+	b.retry = policy
+}
+
 // BuildBaseline builds the original image and returns metrics.
-func (b *Builder) BuildBaseline(dockerfilePath, tag string) (*models.ImageMetrics, error) {
-	contextDir := filepath.Dir(dockerfilePath)
-	metrics, err := b.client.Build(dockerfilePath, contextDir, tag)
+func (b *Builder) BuildBaseline(dockerfilePath, contextDir, tag string) (*models.ImageMetrics, error) {
+	metrics, err := b.build("baseline", dockerfilePath, contextDir, tag, docker.BuildOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("baseline build failed: %w", err)
+		return nil, &BuildError{Build: "baseline", Err: err}
 	}
 	return metrics, nil
 }
 
 // BuildOptimized builds the optimized image and returns metrics.
 func (b *Builder) BuildOptimized(dockerfilePath, contextDir, tag string) (*models.ImageMetrics, error) {
-	metrics, err := b.client.Build(dockerfilePath, contextDir, tag)
+	metrics, err := b.build("optimized", dockerfilePath, contextDir, tag, docker.BuildOptions{})
+	if err != nil {
+		return nil, &BuildError{Build: "optimized", Err: err}
+	}
+	return metrics, nil
+}
+
+// BuildCold builds an image without the build cache and returns metrics
+// with the cold build time.
+func (b *Builder) BuildCold(dockerfilePath, contextDir, tag string) (*models.ImageMetrics, error) {
+	metrics, err := b.build("cold", dockerfilePath, contextDir, tag, docker.BuildOptions{NoCache: true})
+	if err != nil {
+		return nil, &BuildError{Build: "cold", Err: err}
+	}
+	return metrics, nil
+}
+
+// CheckReproducible builds an image twice without the build cache, as tag
+// with the suffixes -a and -b, and compares the builds. The images are
+// removed afterwards.
+func (b *Builder) CheckReproducible(dockerfilePath, contextDir, tag string) (*models.ReproducibilityResult, error) {
+	result := &models.ReproducibilityResult{SourceDateEpoch: b.sourceDateEpoch}
+	tags := []string{tag + "-a", tag + "-b"}
+	defer b.Cleanup(tags...)
+	for _, t := range tags {
+		metrics, err := b.build("reproducibility", dockerfilePath, contextDir, t, docker.BuildOptions{NoCache: true})
+		if err != nil {
+			return nil, &BuildError{Build: "reproducibility", Err: err}
+		}
+		result.ImageIDs = append(result.ImageIDs, metrics.ImageID)
+	}
+	if result.ImageIDs[0] == result.ImageIDs[1] {
+		result.Reproducible = true
+		return result, nil
+	}
+	var err error
+	result.ConfigFields, result.Layers, err = b.client.DiffImages(tags[0], tags[1])
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Attest builds an image with the build args, target, platform and
+// SOURCE_DATE_EPOCH set on the Builder, requesting provenance and SBOM
+// attestations, and writes them to dir.
+func (b *Builder) Attest(dockerfilePath, contextDir, dir string, attest docker.AttestOptions) (*models.AttestationResult, error) {
+	opts := docker.BuildOptions{Target: b.target, Args: b.args, Platform: b.platform, SourceDateEpoch: b.sourceDateEpoch}
+	var result *models.AttestationResult
+	err := b.retry.Do("attestation build", func() error {
+		var err error
+		result, err = b.client.Attest(dockerfilePath, contextDir, dir, opts, attest)
+		return err
+	})
+	if err != nil {
+		return nil, &BuildError{Build: "attestation", Err: err}
+	}
+	return result, nil
+}
+
+// BuildStage builds a single named stage of the Dockerfile and returns its
+// metrics.
+func (b *Builder) BuildStage(dockerfilePath, contextDir, stage, tag string) (*models.ImageMetrics, error) {
+	metrics, err := b.build("stage "+stage, dockerfilePath, contextDir, tag, docker.BuildOptions{Target: stage})
 	if err != nil {
-		return nil, fmt.Errorf("optimized build failed: %w", err)
+		return nil, &BuildError{Build: "stage " + stage, Err: err}
 	}
 	return metrics, nil
 }
 
+// build runs a docker build with the labels, build arguments, target and
+// platform set on the Builder, and records the output of its last attempt.
+// The output of a failed build is run through the diagnoser.
+func (b *Builder) build(name, dockerfilePath, contextDir, tag string, opts docker.BuildOptions) (*models.ImageMetrics, error) {
+	opts.Labels, opts.Args, opts.Platform = b.labels, b.args, b.platform
+	opts.SourceDateEpoch, opts.RewriteTimestamps = b.sourceDateEpoch, b.rewriteTimestamps
+	if opts.Target == "" {
+		opts.Target = b.target
+	}
+	var output bytes.Buffer
+	opts.Output = &output
+	var metrics *models.ImageMetrics
+	err := b.retry.Do(name+" build", func() error {
+		var err error
+		output.Reset()
+		metrics, err = b.client.BuildWith(dockerfilePath, contextDir, tag, opts)
+		return err
+	})
+	log := models.BuildLog{
+		Name:       name,
+		Dockerfile: dockerfilePath,
+		Image:      tag,
+		Failed:     err != nil,
+		Output:     output.String(),
+	}
+	if err != nil {
+		log.Diagnoses = diagnose.Build(log.Output, dockerfilePath, contextDir)
+	}
+	b.logs = append(b.logs, log)
+	return metrics, err
+}
+
+// Logs returns the output of the builds run so far, in order.
+func (b *Builder) Logs() []models.BuildLog {
+	return b.logs
+}
+
+// CompressedSize sets the compressed (registry) size on the image metrics.
+func (b *Builder) CompressedSize(metrics *models.ImageMetrics) error {
+	size, err := b.client.CompressedSize(metrics.ImageName)
+	if err != nil {
+		return err
+	}
+	metrics.CompressedSize = size
+	return nil
+}
+
+// Squash flattens img into a single layer tagged tag when it has more than
+// maxLayers layers or wastes more than maxWasted bytes on files overwritten
+// or deleted by later layers. A zero threshold is not checked. The result
+// records the size effect and what squashing gives up.
+func (b *Builder) Squash(img *models.ImageMetrics, tag string, maxLayers int, maxWasted int64) (*models.SquashResult, error) {
+	wasted, err := b.client.WastedBytes(img.ImageName)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.SquashResult{
+		Source:      img.ImageName,
+		Layers:      img.Layers,
+		WastedBytes: wasted,
+	}
+
+	var reasons []string
+	if maxLayers > 0 && img.Layers > maxLayers {
+		reasons = append(reasons, fmt.Sprintf("%d layers (threshold %d)", img.Layers, maxLayers))
+	}
+	if maxWasted > 0 && wasted > maxWasted {
+		reasons = append(reasons, fmt.Sprintf("%s wasted (threshold %s)", docker.HumanSize(wasted), docker.HumanSize(maxWasted)))
+	}
+	if len(reasons) == 0 {
+		result.Reason = fmt.Sprintf("%d layers and %s wasted are within the thresholds", img.Layers, docker.HumanSize(wasted))
+		return result, nil
+	}
+
+	squashed, err := b.client.Squash(img.ImageName, tag)
+	if err != nil {
+		return nil, err
+	}
+	result.Squashed = true
+	result.Reason = strings.Join(reasons, ", ")
+	result.Image = squashed
+	result.SizeDiff = squashed.Size - img.Size
+	result.Tradeoffs = []string{
+		fmt.Sprintf("Layers are no longer shared with the base image or other images: every pull and push transfers the full %s instead of only the changed layers", squashed.SizeHuman),
+		"Builds can't reuse the squashed image as a layer cache (--cache-from), and each rebuild produces an entirely new layer",
+		"The image history (docker history) is lost",
+	}
+	if img.Healthcheck {
+		result.Tradeoffs = append(result.Tradeoffs, "HEALTHCHECK is not carried over by docker import and must be set at runtime")
+	}
+	return result, nil
+}
+
+// CheckBinaries reads how the compiled binaries found by the analyzer are
+// linked in img. A destination that turns out to be a directory holds the
+// binary under its source name, as with COPY into an existing directory.
+// Binaries that can't be read are skipped and reported in the error.
+func (b *Builder) CheckBinaries(img *models.ImageMetrics, binaries []models.CompiledBinary) ([]models.BinaryLinkage, error) {
+	var (
+		linkages []models.BinaryLinkage
+		errs     []error
+	)
+	for _, bin := range binaries {
+		linkage, err := b.client.Linkage(img.ImageName, bin.Path)
+		if errors.Is(err, docker.ErrIsDir) {
+			linkage, err = b.client.Linkage(img.ImageName, path.Join(bin.Path, path.Base(bin.Source)))
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		linkage.Language = bin.Language
+		linkages = append(linkages, *linkage)
+	}
+	return linkages, errors.Join(errs...)
+}
+
+// DirsSize returns the total size of the files under dirs in img.
+func (b *Builder) DirsSize(img *models.ImageMetrics, dirs []string) (int64, error) {
+	files, err := b.client.Files(img.ImageName)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for p, n := range files {
+		for _, dir := range dirs {
+			if strings.HasPrefix(p, dir+"/") {
+				size += n
+				break
+			}
+		}
+	}
+	return size, nil
+}
+
+// minDuplicatedBytes is the smallest duplication LayerDuplicates reports:
+// package managers rewrite a few small files in place, like their
+// databases, which is not worth reporting.
+const minDuplicatedBytes = 1024 * 1024
+
+// LayerDuplicates returns the layers of img that store files an earlier
+// layer holds already, as a chown -R of copied files does.
+func (b *Builder) LayerDuplicates(img *models.ImageMetrics) ([]models.LayerDuplication, error) {
+	dups, err := b.client.LayerDuplicates(img.ImageName)
+	if err != nil {
+		return nil, err
+	}
+	var large []models.LayerDuplication
+	for _, dup := range dups {
+		if dup.Bytes >= minDuplicatedBytes {
+			large = append(large, dup)
+		}
+	}
+	return large, nil
+}
+
+// SetIDFiles lists the setuid and setgid files in img.
+func (b *Builder) SetIDFiles(img *models.ImageMetrics) ([]models.SetIDFile, error) {
+	return b.client.SetIDFiles(img.ImageName)
+}
+
+// RuntimeConfig returns the entrypoint, command, environment and working
+// directory img runs with.
+func (b *Builder) RuntimeConfig(img *models.ImageMetrics) (*models.RuntimeConfig, error) {
+	return b.client.RuntimeConfig(img.ImageName)
+}
+
+// Label adds labels to img in place. Only the image config changes, so
+// the image ID is updated and the layers stay the same.
+func (b *Builder) Label(img *models.ImageMetrics, labels map[string]string) error {
+	if err := b.client.Label(img.ImageName, img.ImageName, labels); err != nil {
+		return err
+	}
+	labeled, err := b.client.Inspect(img.ImageName)
+	if err != nil {
+		return err
+	}
+	img.ImageID = labeled.ImageID
+	return nil
+}
+
+// Push pushes img to ref with the given labels added to its config.
+func (b *Builder) Push(img *models.ImageMetrics, ref string, labels map[string]string) (*models.PushResult, error) {
+	digest, err := b.client.Push(img.ImageName, ref, labels)
+	if err != nil {
+		return nil, fmt.Errorf("push to %s failed: %w", ref, err)
+	}
+	return &models.PushResult{Source: img.ImageName, Ref: ref, Pushed: true, Digest: digest, Labels: labels}, nil
+}
+
 // Compare generates comparison metrics between baseline and optimized images.
 func (b *Builder) Compare(baseline, optimized *models.ImageMetrics) *models.ComparisonMetrics {
 	sizeDiff := baseline.Size - optimized.Size
@@ -64,6 +379,72 @@ func (b *Builder) Compare(baseline, optimized *models.ImageMetrics) *models.Comp
 	}
 }
 
+// EstimateBaseline stands in for Compare when the baseline image was not
+// built: it compares the registry sizes of the final base images of the
+// original and the optimized Dockerfile, for the platform of the optimized
+// image.
+func (b *Builder) EstimateBaseline(original, optimizedAnalysis *models.AnalysisResult, optimized *models.ImageMetrics) (*models.BaselineEstimate, error) {
+	est := &models.BaselineEstimate{
+		BaseImage:          finalBaseImage(original),
+		OptimizedBaseImage: finalBaseImage(optimizedAnalysis),
+	}
+	if est.BaseImage == "" {
+		return nil, errors.New("the original Dockerfile has no final base image")
+	}
+	if est.OptimizedBaseImage == "" {
+		est.OptimizedBaseImage = est.BaseImage
+	}
+	var err error
+	if est.BaseImageSize, err = b.registrySize(est.BaseImage, optimized); err != nil {
+		return nil, err
+	}
+	if est.OptimizedBaseImageSize, err = b.registrySize(est.OptimizedBaseImage, optimized); err != nil {
+		return nil, err
+	}
+	est.SizeDiff = est.BaseImageSize - est.OptimizedBaseImageSize
+	return est, nil
+}
+
+// registrySize returns the registry size of image for the platform of img.
+// scratch is empty.
+func (b *Builder) registrySize(image string, img *models.ImageMetrics) (int64, error) {
+	if image == "scratch" {
+		return 0, nil
+	}
+	size, err := b.client.RegistrySize(image, img.OS, img.Architecture)
+	if err != nil {
+		return 0, fmt.Errorf("cannot get the registry size of %s: %w", image, err)
+	}
+	return size, nil
+}
+
+// finalBaseImage returns the external image the final stage is built on,
+// following FROM <stage> references.
+func finalBaseImage(analysis *models.AnalysisResult) string {
+	if analysis == nil {
+		return ""
+	}
+	var base string
+	for _, stage := range analysis.Stages {
+		if stage.Final {
+			base = stage.BaseImage
+		}
+	}
+	for range analysis.Stages {
+		next := ""
+		for _, stage := range analysis.Stages {
+			if stage.Name != "" && strings.EqualFold(stage.Name, base) {
+				next = stage.BaseImage
+			}
+		}
+		if next == "" {
+			break
+		}
+		base = next
+	}
+	return base
+}
+
 // Cleanup removes temporary images.
 func (b *Builder) Cleanup(tags ...string) {
 	for _, tag := range tags {
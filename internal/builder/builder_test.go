@@ -0,0 +1,212 @@
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// fakeDocker puts a docker shell script running script on PATH and returns
+// a Builder using it.
+func fakeDocker(t *testing.T, script string) *Builder {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	b, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// analyze parses a Dockerfile without running any rules.
+func analyze(t *testing.T, content string) *models.AnalysisResult {
+	t.Helper()
+	analysis, err := analyzer.NewWithRules().AnalyzeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return analysis
+}
+
+func TestFinalBaseImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       string
+	}{
+		{"single stage", "FROM node:20\nCMD [\"node\"]\n", "node:20"},
+		{"multi-stage", "FROM golang:1.22 AS build\nRUN go build -o /app\n\nFROM alpine:3.20\nCOPY --from=build /app /app\n", "alpine:3.20"},
+		{"stage chain", "FROM node:20-slim AS base\n\nFROM base AS deps\nRUN npm ci\n\nFROM deps\nCMD [\"node\"]\n", "node:20-slim"},
+		{"arg", "ARG NODE_VERSION=20\nFROM node:${NODE_VERSION}-alpine\n", "node:20-alpine"},
+		{"scratch", "FROM golang:1.22 AS build\nRUN go build -o /app\n\nFROM scratch\nCOPY --from=build /app /app\n", "scratch"},
+		{"scratch stage", "FROM scratch AS empty\n\nFROM empty\n", "scratch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := finalBaseImage(analyze(t, tt.dockerfile)); got != tt.want {
+				t.Errorf("finalBaseImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := finalBaseImage(nil); got != "" {
+		t.Errorf("expected no base image without an analysis, got %q", got)
+	}
+}
+
+// manifests answers docker manifest inspect -v with a node:20 manifest
+// list and a single-platform alpine manifest.
+const manifests = `case "$1" in
+  --version) echo "Docker version 27.0.3, build 7d4bcd8" ;;
+  manifest)
+    case "$4" in
+      node:20) echo '[
+        {"Descriptor": {"platform": {"architecture": "amd64", "os": "linux"}}, "SchemaV2Manifest": {"config": {"size": 100}, "layers": [{"size": 400000000}]}},
+        {"Descriptor": {"platform": {"architecture": "arm64", "os": "linux"}}, "SchemaV2Manifest": {"config": {"size": 100}, "layers": [{"size": 390000000}]}}
+      ]' ;;
+      node:20-alpine) echo '{"Descriptor": {}, "OCIManifest": {"config": {"size": 50}, "layers": [{"size": 40000000}, {"size": 2000}]}}' ;;
+      *) echo "no such manifest: $4" >&2; exit 1 ;;
+    esac ;;
+  *) exit 1 ;;
+esac
+`
+
+func TestEstimateBaseline(t *testing.T) {
+	b := fakeDocker(t, manifests)
+	original := analyze(t, "FROM node:20\nCOPY . /app\n")
+	optimized := analyze(t, "FROM node:20 AS build\nRUN npm ci\n\nFROM node:20-alpine\nCOPY --from=build /app /app\n")
+	img := &models.ImageMetrics{OS: "linux", Architecture: "arm64"}
+
+	est, err := b.EstimateBaseline(original, optimized, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.BaselineEstimate{
+		BaseImage:              "node:20",
+		BaseImageSize:          390000100,
+		OptimizedBaseImage:     "node:20-alpine",
+		OptimizedBaseImageSize: 40002050,
+		SizeDiff:               390000100 - 40002050,
+	}
+	if *est != want {
+		t.Errorf("EstimateBaseline() = %+v, want %+v", *est, want)
+	}
+}
+
+func TestEstimateBaseline_Scratch(t *testing.T) {
+	b := fakeDocker(t, manifests)
+	original := analyze(t, "FROM node:20-alpine\nCOPY app /app\n")
+	optimized := analyze(t, "FROM scratch\nCOPY app /app\n")
+
+	est, err := b.EstimateBaseline(original, optimized, &models.ImageMetrics{OS: "linux", Architecture: "amd64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.OptimizedBaseImage != "scratch" || est.OptimizedBaseImageSize != 0 || est.SizeDiff != 40002050 {
+		t.Errorf("expected scratch to count as empty, got %+v", *est)
+	}
+}
+
+func TestEstimateBaseline_Unchanged(t *testing.T) {
+	b := fakeDocker(t, manifests)
+	original := analyze(t, "FROM node:20\nCOPY . /app\n")
+
+	est, err := b.EstimateBaseline(original, nil, &models.ImageMetrics{OS: "linux", Architecture: "amd64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.OptimizedBaseImage != "node:20" || est.SizeDiff != 0 {
+		t.Errorf("expected the original base image without an optimized analysis, got %+v", *est)
+	}
+}
+
+func TestEstimateBaseline_Errors(t *testing.T) {
+	b := fakeDocker(t, manifests)
+	img := &models.ImageMetrics{OS: "linux", Architecture: "amd64"}
+
+	if _, err := b.EstimateBaseline(&models.AnalysisResult{}, nil, img); err == nil {
+		t.Error("expected an error without a final base image")
+	}
+	_, err := b.EstimateBaseline(analyze(t, "FROM private.corp/app:1\n"), nil, img)
+	if err == nil || !strings.Contains(err.Error(), "cannot get the registry size of private.corp/app:1") {
+		t.Errorf("expected the registry error, got %v", err)
+	}
+	_, err = b.EstimateBaseline(analyze(t, "FROM node:20\n"), nil, &models.ImageMetrics{OS: "linux", Architecture: "s390x"})
+	if err == nil || !strings.Contains(err.Error(), "no linux/s390x manifest") {
+		t.Errorf("expected a missing platform error, got %v", err)
+	}
+}
+
+func TestBuild_Labels(t *testing.T) {
+	calls := filepath.Join(t.TempDir(), "calls")
+	t.Setenv("DOCKER_CALLS", calls)
+	b := fakeDocker(t, `echo "$@" >> "$DOCKER_CALLS"
+case "$1" in
+  --version) echo "Docker version 27.0.3, build 7d4bcd8" ;;
+  inspect) echo '[{"Id": "sha256:abc", "Size": 1024, "Os": "linux", "Architecture": "amd64", "RootFS": {"Layers": ["sha256:1"]}}]' ;;
+esac
+`)
+	b.SetLabels(map[string]string{LabelVersion: "1.4.0", LabelOptimizations: "OPT-MULTISTAGE", LabelDockerfile: "Dockerfile"})
+	b.SetBuildArgs(map[string]string{"NODE_VERSION": "20"})
+
+	if _, err := b.BuildOptimized("Dockerfile.optimized", ".", "app:dio"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.BuildStage("Dockerfile", ".", "build", "app:build"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var builds []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if strings.HasPrefix(line, "build ") {
+			builds = append(builds, line)
+		}
+	}
+	want := []string{
+		"build -f Dockerfile.optimized -t app:dio --build-arg NODE_VERSION=20 --label dio.dockerfile=Dockerfile --label dio.optimizations=OPT-MULTISTAGE --label dio.version=1.4.0 .",
+		"build -f Dockerfile -t app:build --target build --build-arg NODE_VERSION=20 --label dio.dockerfile=Dockerfile --label dio.optimizations=OPT-MULTISTAGE --label dio.version=1.4.0 .",
+	}
+	if !reflect.DeepEqual(builds, want) {
+		t.Errorf("expected every build to carry the labels sorted by key:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(builds, "\n"))
+	}
+}
+
+func TestPush(t *testing.T) {
+	b := fakeDocker(t, `case "$1" in
+  --version) echo "Docker version 27.0.3, build 7d4bcd8" ;;
+  inspect) echo '[{"Id": "sha256:abc", "RepoDigests": ["registry.corp/app@sha256:111"]}]' ;;
+esac
+`)
+	labels := map[string]string{LabelVersion: "1.4.0"}
+	got, err := b.Push(&models.ImageMetrics{ImageName: "app:dio"}, "registry.corp/app:1.0", labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.PushResult{Source: "app:dio", Ref: "registry.corp/app:1.0", Pushed: true, Digest: "registry.corp/app@sha256:111", Labels: labels}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("Push() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestPush_Error(t *testing.T) {
+	b := fakeDocker(t, `case "$1" in
+  --version) echo "Docker version 27.0.3, build 7d4bcd8" ;;
+  push) echo "denied: requested access to the resource is denied" >&2; exit 1 ;;
+esac
+`)
+	_, err := b.Push(&models.ImageMetrics{ImageName: "app:dio"}, "registry.corp/app:1.0", nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "push to registry.corp/app:1.0 failed: ") {
+		t.Errorf("expected the push error to name the reference, got %v", err)
+	}
+}
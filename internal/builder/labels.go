@@ -0,0 +1,56 @@
+package builder
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Labels DIO sets on the images it builds, so inventory systems can tell
+// which images went through the optimizer.
+const (
+	LabelVersion       = "dio.version"
+	LabelDockerfile    = "dio.dockerfile"
+	LabelScore         = "dio.score"
+	LabelOptimizations = "dio.optimizations"
+	LabelPolicy        = "dio.policy"
+)
+
+// Labels returns the DIO metadata labels for an image built from the
+// pipeline's Dockerfile. For the optimized image, dio.optimizations lists
+// the IDs of the applied optimizations; for others it is "none". dio.policy
+// (passed, failed or overridden) is only known once the policy has been
+// evaluated, so it is set after the build.
+func Labels(version string, result *models.PipelineResult, optimized bool) map[string]string {
+	labels := map[string]string{
+		LabelVersion:       version,
+		LabelDockerfile:    result.Dockerfile,
+		LabelOptimizations: "none",
+	}
+	if result.Analysis != nil {
+		labels[LabelScore] = strconv.Itoa(result.Analysis.Score)
+	}
+	if optimized && result.Optimization != nil {
+		var applied []string
+		for _, opt := range result.Optimization.Optimizations {
+			if opt.Applied {
+				applied = append(applied, opt.ID)
+			}
+		}
+		if len(applied) > 0 {
+			labels[LabelOptimizations] = strings.Join(applied, ",")
+		}
+	}
+	if p := result.Policy; p != nil {
+		switch {
+		case p.Override != nil:
+			labels[LabelPolicy] = "overridden"
+		case p.Passed:
+			labels[LabelPolicy] = "passed"
+		default:
+			labels[LabelPolicy] = "failed"
+		}
+	}
+	return labels
+}
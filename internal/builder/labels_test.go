@@ -0,0 +1,64 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func TestLabels(t *testing.T) {
+	result := &models.PipelineResult{
+		Dockerfile: "services/api/Dockerfile",
+		Analysis:   &models.AnalysisResult{Score: 72},
+		Optimization: &models.OptimizationResult{Optimizations: []models.Optimization{
+			{ID: "OPT-MULTISTAGE", Applied: true},
+			{ID: "OPT-BASE-IMAGE"},
+			{ID: "OPT-CACHE-MOUNT", Applied: true},
+		}},
+	}
+	tests := []struct {
+		name      string
+		policy    *models.PolicyResult
+		optimized bool
+		want      map[string]string
+	}{
+		{"baseline", nil, false, map[string]string{
+			LabelVersion: "1.4.0", LabelDockerfile: "services/api/Dockerfile", LabelScore: "72", LabelOptimizations: "none",
+		}},
+		{"optimized", nil, true, map[string]string{
+			LabelVersion: "1.4.0", LabelDockerfile: "services/api/Dockerfile", LabelScore: "72", LabelOptimizations: "OPT-MULTISTAGE,OPT-CACHE-MOUNT",
+		}},
+		{"policy passed", &models.PolicyResult{Passed: true}, true, map[string]string{
+			LabelVersion: "1.4.0", LabelDockerfile: "services/api/Dockerfile", LabelScore: "72", LabelOptimizations: "OPT-MULTISTAGE,OPT-CACHE-MOUNT", LabelPolicy: "passed",
+		}},
+		{"policy failed", &models.PolicyResult{}, false, map[string]string{
+			LabelVersion: "1.4.0", LabelDockerfile: "services/api/Dockerfile", LabelScore: "72", LabelOptimizations: "none", LabelPolicy: "failed",
+		}},
+		{"policy overridden", &models.PolicyResult{Override: &models.PolicyOverride{}}, false, map[string]string{
+			LabelVersion: "1.4.0", LabelDockerfile: "services/api/Dockerfile", LabelScore: "72", LabelOptimizations: "none", LabelPolicy: "overridden",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result.Policy = tt.policy
+			if got := Labels("1.4.0", result, tt.optimized); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Labels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabels_NothingApplied(t *testing.T) {
+	result := &models.PipelineResult{
+		Dockerfile:   "Dockerfile",
+		Optimization: &models.OptimizationResult{Optimizations: []models.Optimization{{ID: "OPT-MULTISTAGE"}}},
+	}
+	got := Labels("dev", result, true)
+	if got[LabelOptimizations] != "none" {
+		t.Errorf("expected none without applied optimizations, got %q", got[LabelOptimizations])
+	}
+	if _, ok := got[LabelScore]; ok {
+		t.Errorf("expected no score without an analysis, got %v", got)
+	}
+}
@@ -0,0 +1,216 @@
+package buildspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LoadBake reads the targets of Bake files. Targets and variables defined
+// again in a later file are merged into the earlier ones. Contexts are
+// resolved against the directory of the first file, where docker buildx
+// bake runs.
+func LoadBake(paths ...string) ([]Spec, error) {
+	var blocks []hclBlock
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var bs []hclBlock
+		if filepath.Ext(path) == ".json" {
+			bs, err = parseBakeJSON(data)
+		} else {
+			bs, err = parseHCL(string(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		blocks = append(blocks, bs...)
+	}
+
+	vars := make(map[string]interface{})
+	groups := make(map[string][]string)
+	targets := make(map[string]map[string]interface{})
+	var order []string
+	for _, b := range blocks {
+		if len(b.Labels) != 1 {
+			continue
+		}
+		name := b.Labels[0]
+		switch b.Type {
+		case "variable":
+			vars[name] = b.Attrs["default"]
+		case "group":
+			groups[name] = stringList(b.Attrs["targets"], nil)
+		case "target":
+			if targets[name] == nil {
+				targets[name] = make(map[string]interface{})
+				order = append(order, name)
+			}
+			mergeAttrs(targets[name], b.Attrs)
+		}
+	}
+
+	// Like bake, an environment variable overrides the default of the
+	// variable with its name
+	var lookup func(name string) (string, bool)
+	depth := 0
+	lookup = func(name string) (string, bool) {
+		def, ok := vars[name]
+		if !ok {
+			return "", false
+		}
+		if v, ok := os.LookupEnv(name); ok {
+			return v, true
+		}
+		s, ok := scalar(def)
+		if !ok || depth > 10 {
+			return "", ok
+		}
+		depth++
+		defer func() { depth-- }()
+		return interpolate(s, false, lookup), true
+	}
+
+	var resolve func(name string, seen map[string]bool) map[string]interface{}
+	resolve = func(name string, seen map[string]bool) map[string]interface{} {
+		attrs := make(map[string]interface{})
+		if seen[name] || targets[name] == nil {
+			return attrs
+		}
+		seen[name] = true
+		for _, parent := range stringList(targets[name]["inherits"], lookup) {
+			mergeAttrs(attrs, resolve(parent, seen))
+		}
+		mergeAttrs(attrs, targets[name])
+		return attrs
+	}
+
+	// The targets of the default group come first: they are what a plain
+	// docker buildx bake builds
+	var names []string
+	added := make(map[string]bool)
+	var addGroup func(group string, depth int)
+	addGroup = func(group string, depth int) {
+		for _, name := range groups[group] {
+			if _, ok := groups[name]; ok && depth < 10 {
+				addGroup(name, depth+1)
+			} else if !added[name] && targets[name] != nil {
+				names, added[name] = append(names, name), true
+			}
+		}
+	}
+	addGroup("default", 0)
+	for _, name := range order {
+		if !added[name] {
+			names = append(names, name)
+		}
+	}
+
+	dir := filepath.Dir(paths[0])
+	var specs []Spec
+	for _, name := range names {
+		attrs := resolve(name, make(map[string]bool))
+		spec := Spec{
+			Source:     paths[0],
+			Name:       name,
+			Context:    stringAttr(attrs["context"], lookup),
+			Dockerfile: stringAttr(attrs["dockerfile"], lookup),
+			Target:     stringAttr(attrs["target"], lookup),
+			Platforms:  stringList(attrs["platforms"], lookup),
+		}
+		if args, ok := attrs["args"].(map[string]interface{}); ok {
+			spec.Args = make(map[string]string)
+			for k, v := range args {
+				if s, ok := scalar(v); ok {
+					spec.Args[k] = interpolate(s, false, lookup)
+				}
+			}
+		}
+		if spec.resolvePaths(dir) {
+			specs = append(specs, spec)
+		}
+	}
+	return specs, nil
+}
+
+// parseBakeJSON converts a docker-bake.json file to blocks.
+func parseBakeJSON(data []byte) ([]hclBlock, error) {
+	var file map[string]map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	var blocks []hclBlock
+	for _, typ := range []string{"variable", "group", "target"} {
+		names := make([]string, 0, len(file[typ]))
+		for name := range file[typ] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			blocks = append(blocks, hclBlock{Type: typ, Labels: []string{name}, Attrs: file[typ][name]})
+		}
+	}
+	return blocks, nil
+}
+
+// mergeAttrs sets the attributes of src in dst. Build arguments are merged
+// one by one, as bake does.
+func mergeAttrs(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if k == "args" {
+			srcArgs, ok := v.(map[string]interface{})
+			dstArgs, ok2 := dst[k].(map[string]interface{})
+			if ok && ok2 {
+				merged := make(map[string]interface{}, len(dstArgs)+len(srcArgs))
+				for ak, av := range dstArgs {
+					merged[ak] = av
+				}
+				for ak, av := range srcArgs {
+					merged[ak] = av
+				}
+				dst[k] = merged
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// scalar returns a string, number or boolean value as a string.
+func scalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64, bool:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+func stringAttr(v interface{}, lookup func(string) (string, bool)) string {
+	s, _ := scalar(v)
+	return strings.TrimSpace(interpolate(s, false, lookup))
+}
+
+// stringList returns the scalar items of a list, interpolated with lookup
+// unless it is nil.
+func stringList(v interface{}, lookup func(string) (string, bool)) []string {
+	items, _ := v.([]interface{})
+	var list []string
+	for _, item := range items {
+		s, ok := scalar(item)
+		if !ok {
+			continue
+		}
+		if lookup != nil {
+			s = interpolate(s, false, lookup)
+		}
+		list = append(list, s)
+	}
+	return list
+}
@@ -0,0 +1,213 @@
+// Package buildspec reads how a project builds its images from a Docker
+// Bake file or a Compose file: the build arguments, target stage, platforms
+// and context used for each Dockerfile. DIO builds with the same settings so
+// its images match the ones the team ships.
+package buildspec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// BakeFiles and ComposeFiles are the files looked up in a directory, in
+// order. The later files of each list override the earlier ones.
+var (
+	BakeFiles    = []string{"docker-bake.json", "docker-bake.hcl", "docker-bake.override.json", "docker-bake.override.hcl"}
+	ComposeFiles = []string{"compose.yaml", "compose.yml", "docker-compose.yml", "docker-compose.yaml", "compose.override.yaml", "compose.override.yml", "docker-compose.override.yml", "docker-compose.override.yaml"}
+)
+
+// Spec is how one Bake target or Compose service builds a Dockerfile.
+type Spec struct {
+	Source     string // the Bake or Compose file
+	Name       string // the Bake target or Compose service
+	Context    string // the build context directory
+	Dockerfile string
+	Args       map[string]string
+	Target     string // the stage to build; empty builds the final stage
+	Platforms  []string
+}
+
+// Platform returns the platform to build. A multi-platform build can't be
+// loaded into the local image store, so one is picked: the host's when it
+// is listed, and the first one otherwise.
+func (s *Spec) Platform() string {
+	host := "linux/" + runtime.GOARCH
+	for _, p := range s.Platforms {
+		if p == host || strings.HasPrefix(p, host+"/") {
+			return p
+		}
+	}
+	if len(s.Platforms) > 0 {
+		return s.Platforms[0]
+	}
+	return ""
+}
+
+// Load reads the build definitions of Bake or Compose files, which must be
+// of the same kind: .hcl and docker-bake*.json files are Bake files, the
+// rest Compose files.
+func Load(paths ...string) ([]Spec, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	if isBakeFile(paths[0]) {
+		return LoadBake(paths...)
+	}
+	return LoadCompose(paths...)
+}
+
+func isBakeFile(path string) bool {
+	name := filepath.Base(path)
+	return filepath.Ext(name) == ".hcl" || strings.HasPrefix(name, "docker-bake") && filepath.Ext(name) == ".json"
+}
+
+// Find looks for the Bake or Compose files that build dockerfilePath in its
+// directory and the parent directories, up to the root of the repository,
+// and returns the matching Spec (see Select). It returns nil when none
+// builds it.
+func Find(dockerfilePath, name string) (*Spec, error) {
+	abs, err := filepath.Abs(dockerfilePath)
+	if err != nil {
+		return nil, err
+	}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		for _, names := range [][]string{BakeFiles, ComposeFiles} {
+			paths := existing(dir, names)
+			if len(paths) == 0 {
+				continue
+			}
+			specs, err := Load(paths...)
+			if err != nil {
+				return nil, err
+			}
+			if spec, err := Select(specs, dockerfilePath, name); err != nil || spec != nil {
+				return spec, err
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil || filepath.Dir(dir) == dir {
+			return nil, nil
+		}
+	}
+}
+
+// existing returns the paths of the named files that exist in dir.
+func existing(dir string, names []string) []string {
+	var paths []string
+	for _, name := range names {
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// Select returns the Spec that builds dockerfilePath, or nil if none does.
+// A non-empty name selects the Bake target or Compose service, which must
+// build the Dockerfile; otherwise the first Spec building it is used.
+func Select(specs []Spec, dockerfilePath, name string) (*Spec, error) {
+	abs, err := filepath.Abs(dockerfilePath)
+	if err != nil {
+		return nil, err
+	}
+	for i := range specs {
+		if name != "" {
+			if specs[i].Name != name {
+				continue
+			}
+			if specs[i].Dockerfile != abs {
+				return nil, fmt.Errorf("%s in %s builds %s, not %s", name, specs[i].Source, specs[i].Dockerfile, dockerfilePath)
+			}
+			return &specs[i], nil
+		}
+		if specs[i].Dockerfile == abs {
+			return &specs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ArgNames returns the names of the build arguments, sorted.
+func (s *Spec) ArgNames() []string {
+	names := make([]string, 0, len(s.Args))
+	for name := range s.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolvePaths makes the context of a local build absolute, relative to
+// dir, and the Dockerfile absolute, relative to the context. It reports
+// false for remote contexts, such as Git URLs.
+func (s *Spec) resolvePaths(dir string) bool {
+	if s.Context == "" {
+		s.Context = "."
+	}
+	if strings.Contains(s.Context, "://") || strings.HasPrefix(s.Context, "git@") {
+		return false
+	}
+	if !filepath.IsAbs(s.Context) {
+		s.Context = filepath.Join(dir, s.Context)
+	}
+	if s.Dockerfile == "" {
+		s.Dockerfile = "Dockerfile"
+	}
+	if !filepath.IsAbs(s.Dockerfile) {
+		s.Dockerfile = filepath.Join(s.Context, s.Dockerfile)
+	}
+	return true
+}
+
+// interpolate replaces ${NAME}, ${NAME:-default}, ${NAME-default} and, when
+// bare is true, $NAME with the values lookup returns. $$ is a literal $.
+func interpolate(s string, bare bool, lookup func(string) (string, bool)) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch c := s[i+1]; {
+		case c == '$':
+			b.WriteByte('$')
+			i++
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				b.WriteString(s[i:])
+				return b.String()
+			}
+			expr := s[i+2 : i+end]
+			i += end
+			name, fallback, unsetOnly := expr, "", false
+			if n, d, ok := strings.Cut(expr, ":-"); ok {
+				name, fallback = n, d
+			} else if n, d, ok := strings.Cut(expr, "-"); ok && !strings.ContainsAny(n, "?:") {
+				name, fallback, unsetOnly = n, d, true
+			} else if n, _, ok := strings.Cut(expr, ":?"); ok {
+				name = n
+			}
+			v, ok := lookup(strings.TrimSpace(name))
+			if !ok || (v == "" && !unsetOnly) {
+				v = fallback
+			}
+			b.WriteString(v)
+		case bare && (c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			v, _ := lookup(s[i+1 : j])
+			b.WriteString(v)
+			i = j - 1
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,229 @@
+package buildspec
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const bakeHCL = `
+# Shared settings
+variable "GO_VERSION" {
+  default = "1.22"
+}
+variable "TAG" { default = "dev" }
+
+group "default" {
+  targets = ["api"]
+}
+
+target "_common" {
+  args = {
+    GO_VERSION = GO_VERSION
+    CGO_ENABLED = 0
+  }
+  platforms = ["linux/amd64", "linux/arm64"]
+}
+
+/* The API server */
+target "api" {
+  inherits   = ["_common"]
+  context    = "services/api"
+  dockerfile = "build/Dockerfile"
+  target     = "runtime"
+  tags       = ["registry.corp/api:${TAG}"]
+  args = {
+    VERSION = "v${GO_VERSION}-$${literal}"
+  }
+  labels = {
+    "org.opencontainers.image.created" = timestamp()
+  }
+  description = <<-EOT
+    The API, built with
+    Go ${GO_VERSION}
+    EOT
+}
+
+target "remote" {
+  context = "https://github.com/org/repo.git"
+}
+`
+
+func TestLoadBake(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docker-bake.hcl")
+	writeFile(t, path, bakeHCL)
+	writeFile(t, filepath.Join(dir, "docker-bake.override.hcl"), `target "api" {
+  args = { EXTRA = "1" }
+}`)
+	t.Setenv("GO_VERSION", "1.23")
+
+	specs, err := LoadBake(path, filepath.Join(dir, "docker-bake.override.hcl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 2 || specs[0].Name != "api" || specs[1].Name != "_common" {
+		t.Fatalf("specs = %+v; want api, then _common", specs)
+	}
+	api := specs[0]
+	want := Spec{
+		Source:     path,
+		Name:       "api",
+		Context:    filepath.Join(dir, "services/api"),
+		Dockerfile: filepath.Join(dir, "services/api/build/Dockerfile"),
+		Args:       map[string]string{"GO_VERSION": "1.23", "CGO_ENABLED": "0", "VERSION": "v1.23-${literal}", "EXTRA": "1"},
+		Target:     "runtime",
+		Platforms:  []string{"linux/amd64", "linux/arm64"},
+	}
+	if !reflect.DeepEqual(api, want) {
+		t.Errorf("api = %+v\nwant %+v", api, want)
+	}
+}
+
+func TestLoadBake_JSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docker-bake.json")
+	writeFile(t, path, `{
+  "variable": {"BASE": {"default": "alpine"}},
+  "target": {"app": {"args": {"BASE": "${BASE}:3.19"}, "platforms": ["linux/arm64"]}}
+}`)
+	specs, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 1 || specs[0].Args["BASE"] != "alpine:3.19" || specs[0].Dockerfile != filepath.Join(dir, "Dockerfile") {
+		t.Errorf("specs = %+v", specs)
+	}
+	if got := specs[0].Platform(); got != "linux/arm64" {
+		t.Errorf("Platform() = %q; want the only one listed", got)
+	}
+}
+
+func TestParseHCL_Errors(t *testing.T) {
+	for _, src := range []string{
+		`target "app" {`,
+		`target "app" { args = { A = "unterminated } }`,
+		`target "app" { context = ! }`,
+	} {
+		if _, err := parseHCL(src); err == nil {
+			t.Errorf("parseHCL(%q): expected an error", src)
+		}
+	}
+}
+
+func TestLoadCompose(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "compose.yaml")
+	writeFile(t, path, `services:
+  web:
+    build:
+      context: ./web
+      dockerfile: Dockerfile.prod
+      target: ${WEB_TARGET:-production}
+      args:
+        NODE_VERSION: $NODE_VERSION
+        API_URL: https://api.example.com
+        TOKEN:
+        COUNT: 3
+    platform: linux/arm64
+  worker:
+    build: ./worker
+  db:
+    image: postgres:16
+`)
+	writeFile(t, filepath.Join(dir, "compose.override.yaml"), `services:
+  worker:
+    build:
+      args:
+        - DEBUG=1
+        - HOME
+`)
+	writeFile(t, filepath.Join(dir, ".env"), "# versions\nNODE_VERSION=\"20\"\n")
+	t.Setenv("HOME", "/home/ci")
+	t.Setenv("TOKEN", "")
+
+	specs, err := Load(path, filepath.Join(dir, "compose.override.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 2 {
+		t.Fatalf("specs = %+v; want web and worker", specs)
+	}
+	web, worker := specs[0], specs[1]
+	if web.Dockerfile != filepath.Join(dir, "web/Dockerfile.prod") || web.Target != "production" ||
+		!reflect.DeepEqual(web.Platforms, []string{"linux/arm64"}) {
+		t.Errorf("web = %+v", web)
+	}
+	if want := map[string]string{"NODE_VERSION": "20", "API_URL": "https://api.example.com", "TOKEN": "", "COUNT": "3"}; !reflect.DeepEqual(web.Args, want) {
+		t.Errorf("web args = %v; want %v", web.Args, want)
+	}
+	if worker.Dockerfile != filepath.Join(dir, "worker/Dockerfile") ||
+		!reflect.DeepEqual(worker.Args, map[string]string{"DEBUG": "1", "HOME": "/home/ci"}) {
+		t.Errorf("worker = %+v", worker)
+	}
+}
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "docker-compose.yml"), `services:
+  api:
+    build:
+      context: svc/api
+      target: runtime
+  api-debug:
+    build:
+      context: svc/api
+      target: debug
+`)
+	dockerfile := filepath.Join(root, "svc/api/Dockerfile")
+	writeFile(t, dockerfile, "FROM alpine\n")
+
+	spec, err := Find(dockerfile, "")
+	if err != nil || spec == nil || spec.Name != "api" || spec.Context != filepath.Join(root, "svc/api") {
+		t.Fatalf("Find() = %+v, %v; want the api service", spec, err)
+	}
+	if spec, err := Find(dockerfile, "api-debug"); err != nil || spec == nil || spec.Target != "debug" {
+		t.Errorf("Find(api-debug) = %+v, %v", spec, err)
+	}
+	if spec, err := Find(filepath.Join(root, "svc/other/Dockerfile"), ""); err != nil || spec != nil {
+		t.Errorf("Find() for an unbuilt Dockerfile = %+v, %v; want nil", spec, err)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{"A": "a", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+	tests := []struct {
+		in   string
+		bare bool
+		want string
+	}{
+		{"${A}-$A", false, "a-$A"},
+		{"${A}-$A", true, "a-a"},
+		{"${MISSING:-x}/${EMPTY:-y}/${EMPTY-z}", false, "x/y/"},
+		{"$${A} costs $$5", true, "${A} costs $5"},
+		{"${A", false, "${A"},
+	}
+	for _, tt := range tests {
+		if got := interpolate(tt.in, tt.bare, lookup); got != tt.want {
+			t.Errorf("interpolate(%q, %v) = %q; want %q", tt.in, tt.bare, got, tt.want)
+		}
+	}
+}
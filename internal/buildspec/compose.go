@@ -0,0 +1,187 @@
+package buildspec
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Build    yaml.Node `yaml:"build"`
+	Platform string    `yaml:"platform"`
+}
+
+type composeBuild struct {
+	Context    string    `yaml:"context"`
+	Dockerfile string    `yaml:"dockerfile"`
+	Args       yaml.Node `yaml:"args"`
+	Target     string    `yaml:"target"`
+	Platforms  []string  `yaml:"platforms"`
+}
+
+// LoadCompose reads the services that build an image from Compose files.
+// The build settings of a service defined again in a later file, such as
+// compose.override.yaml, override the earlier ones. Values are
+// interpolated from the environment and the .env file next to the first
+// file, and paths are resolved against its directory.
+func LoadCompose(paths ...string) ([]Spec, error) {
+	dir := filepath.Dir(paths[0])
+	env, err := readEnvFile(filepath.Join(dir, ".env"))
+	if err != nil {
+		return nil, err
+	}
+	lookup := func(name string) (string, bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			return v, true
+		}
+		v, ok := env[name]
+		return v, ok
+	}
+	expand := func(s string) string { return interpolate(s, true, lookup) }
+
+	specs := make(map[string]*Spec)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var file composeFile
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for name, svc := range file.Services {
+			var build composeBuild
+			switch svc.Build.Kind {
+			case 0:
+				continue
+			case yaml.ScalarNode:
+				build.Context = svc.Build.Value
+			default:
+				if err := svc.Build.Decode(&build); err != nil {
+					return nil, fmt.Errorf("%s: service %s: %w", path, name, err)
+				}
+			}
+			spec := specs[name]
+			if spec == nil {
+				spec = &Spec{Source: paths[0], Name: name, Args: make(map[string]string)}
+				specs[name] = spec
+			}
+			if build.Context != "" {
+				spec.Context = expand(build.Context)
+			}
+			if build.Dockerfile != "" {
+				spec.Dockerfile = expand(build.Dockerfile)
+			}
+			if build.Target != "" {
+				spec.Target = expand(build.Target)
+			}
+			if len(build.Platforms) > 0 {
+				spec.Platforms = nil
+				for _, p := range build.Platforms {
+					spec.Platforms = append(spec.Platforms, expand(p))
+				}
+			} else if svc.Platform != "" {
+				spec.Platforms = []string{expand(svc.Platform)}
+			}
+			args, err := composeArgs(&build.Args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: service %s: %w", path, name, err)
+			}
+			for k, v := range args {
+				// An argument without a value takes it from the environment,
+				// and is left out when it isn't set
+				if v == nil {
+					if s, ok := lookup(k); ok {
+						spec.Args[k] = s
+					}
+					continue
+				}
+				spec.Args[k] = expand(*v)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var result []Spec
+	for _, name := range names {
+		if spec := specs[name]; spec.resolvePaths(dir) {
+			result = append(result, *spec)
+		}
+	}
+	return result, nil
+}
+
+// composeArgs decodes build args given as a map or as a list of KEY=VALUE
+// items. A nil value means the argument has none.
+func composeArgs(node *yaml.Node) (map[string]*string, error) {
+	args := make(map[string]*string)
+	switch node.Kind {
+	case 0:
+	case yaml.SequenceNode:
+		var items []string
+		if err := node.Decode(&items); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			k, v, ok := strings.Cut(item, "=")
+			if ok {
+				args[k] = &v
+			} else {
+				args[k] = nil
+			}
+		}
+	default:
+		var m map[string]*string
+		if err := node.Decode(&m); err != nil {
+			return nil, fmt.Errorf("args: %w", err)
+		}
+		for k, v := range m {
+			args[k] = v
+		}
+	}
+	return args, nil
+}
+
+// readEnvFile reads the KEY=VALUE lines of a .env file. A missing file is
+// empty.
+func readEnvFile(path string) (map[string]string, error) {
+	env := make(map[string]string)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return env, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		env[strings.TrimSpace(k)] = v
+	}
+	return env, scanner.Err()
+}
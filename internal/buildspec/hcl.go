@@ -0,0 +1,375 @@
+package buildspec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hclBlock is a block of an HCL file, such as target "app" { ... }.
+type hclBlock struct {
+	Type   string
+	Labels []string
+	// Attrs holds the attribute values: a string, nil for null and for
+	// expressions that aren't supported, []interface{} or
+	// map[string]interface{}. A variable reference is kept as the string
+	// "${NAME}" so it is resolved like any interpolation.
+	Attrs map[string]interface{}
+}
+
+// hclParser parses the subset of HCL that Bake files use: blocks,
+// attributes, strings, numbers, booleans, lists, objects, heredocs and
+// variable references. Function calls, conditionals and other expressions
+// are skipped.
+type hclParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func parseHCL(src string) ([]hclBlock, error) {
+	p := &hclParser{src: src, line: 1}
+	_, blocks, err := p.body(0)
+	return blocks, err
+}
+
+func (p *hclParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *hclParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *hclParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *hclParser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skip skips blanks and comments, and newlines too when newlines is true.
+func (p *hclParser) skip(newlines bool) {
+	for !p.eof() {
+		c := p.peek()
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || (newlines && c == '\n'):
+			p.next()
+		case c == '#' || strings.HasPrefix(p.src[p.pos:], "//"):
+			for !p.eof() && p.peek() != '\n' {
+				p.next()
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				end = len(p.src) - p.pos - 4
+			}
+			for i := 0; i < end+4 && !p.eof(); i++ {
+				p.next()
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *hclParser) ident() string {
+	start := p.pos
+	for !p.eof() && isIdentByte(p.peek()) {
+		p.next()
+	}
+	return p.src[start:p.pos]
+}
+
+// body parses attributes and blocks up to the closing brace end, or to the
+// end of the file when end is 0.
+func (p *hclParser) body(end byte) (map[string]interface{}, []hclBlock, error) {
+	attrs := make(map[string]interface{})
+	var blocks []hclBlock
+	for {
+		p.skip(true)
+		if p.eof() {
+			if end != 0 {
+				return nil, nil, p.errorf("missing %q", end)
+			}
+			return attrs, blocks, nil
+		}
+		if p.peek() == end {
+			p.next()
+			return attrs, blocks, nil
+		}
+		name := p.ident()
+		if name == "" {
+			return nil, nil, p.errorf("unexpected %q", p.peek())
+		}
+		p.skip(false)
+		if p.peek() == '=' {
+			p.next()
+			value, err := p.expression()
+			if err != nil {
+				return nil, nil, err
+			}
+			attrs[name] = value
+			continue
+		}
+
+		block := hclBlock{Type: name}
+		for {
+			p.skip(false)
+			if p.peek() == '{' {
+				p.next()
+				break
+			}
+			var label string
+			if p.peek() == '"' {
+				s, err := p.quoted()
+				if err != nil {
+					return nil, nil, err
+				}
+				label = s
+			} else if label = p.ident(); label == "" {
+				return nil, nil, p.errorf("expected a label or \"{\" after %s", name)
+			}
+			block.Labels = append(block.Labels, label)
+		}
+		var err error
+		if block.Attrs, _, err = p.body('}'); err != nil {
+			return nil, nil, err
+		}
+		blocks = append(blocks, block)
+	}
+}
+
+// expression parses the value of an attribute. What follows a value up to
+// the end of the line, such as an operator, makes it unsupported.
+func (p *hclParser) expression() (interface{}, error) {
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skip(false)
+	if c := p.peek(); c != 0 && c != '\n' && c != ',' && c != '}' && c != ']' {
+		if err := p.skipExpression(); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return value, nil
+}
+
+func (p *hclParser) value() (interface{}, error) {
+	p.skip(false)
+	switch c := p.peek(); {
+	case c == '"':
+		return p.quoted()
+	case c == '[':
+		p.next()
+		var list []interface{}
+		for {
+			p.skip(true)
+			if p.peek() == ']' {
+				p.next()
+				return list, nil
+			}
+			v, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			p.skip(true)
+			if p.peek() == ',' {
+				p.next()
+			}
+		}
+	case c == '{':
+		p.next()
+		obj := make(map[string]interface{})
+		for {
+			p.skip(true)
+			if p.peek() == '}' {
+				p.next()
+				return obj, nil
+			}
+			var key string
+			if p.peek() == '"' {
+				s, err := p.quoted()
+				if err != nil {
+					return nil, err
+				}
+				key = s
+			} else if key = p.ident(); key == "" {
+				return nil, p.errorf("expected an object key")
+			}
+			p.skip(false)
+			if c := p.peek(); c != '=' && c != ':' {
+				return nil, p.errorf("expected \"=\" after %s", key)
+			}
+			p.next()
+			v, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = v
+			p.skip(false)
+			if p.peek() == ',' {
+				p.next()
+			}
+		}
+	case strings.HasPrefix(p.src[p.pos:], "<<"):
+		return p.heredoc()
+	case c == '-' || c >= '0' && c <= '9':
+		start := p.pos
+		p.next()
+		for !p.eof() && strings.IndexByte("0123456789.eE+-", p.peek()) >= 0 {
+			p.next()
+		}
+		return p.src[start:p.pos], nil
+	case isIdentByte(c):
+		name := p.ident()
+		switch name {
+		case "true", "false":
+			return name, nil
+		case "null":
+			return nil, nil
+		}
+		if c := p.peek(); c == '(' || c == '.' || c == '[' {
+			// A function call or an attribute of another block
+			if err := p.skipExpression(); err != nil {
+				return nil, err
+			}
+			return nil, nil
+		}
+		return "${" + name + "}", nil
+	case c == 0:
+		return nil, p.errorf("unexpected end of file")
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+// quoted parses a quoted string. Interpolations are kept as they are.
+func (p *hclParser) quoted() (string, error) {
+	p.next()
+	var b strings.Builder
+	depth := 0 // of the braces of interpolations
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.next()
+		switch {
+		case c == '"' && depth == 0:
+			return b.String(), nil
+		case c == '\\' && !p.eof():
+			e := p.next()
+			switch e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(e)
+			}
+		case c == '$' && p.peek() == '{':
+			b.WriteByte(c)
+			b.WriteByte(p.next())
+			depth++
+		case c == '}' && depth > 0:
+			b.WriteByte(c)
+			depth--
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// heredoc parses <<EOT or <<-EOT up to the line holding only EOT.
+func (p *hclParser) heredoc() (string, error) {
+	p.pos += 2
+	indented := p.peek() == '-'
+	if indented {
+		p.next()
+	}
+	marker := p.ident()
+	if marker == "" {
+		return "", p.errorf("expected a heredoc marker")
+	}
+	for !p.eof() && p.next() != '\n' {
+	}
+	var lines []string
+	for !p.eof() {
+		start := p.pos
+		for !p.eof() && p.peek() != '\n' {
+			p.next()
+		}
+		line := p.src[start:p.pos]
+		if !p.eof() {
+			p.next()
+		}
+		if strings.TrimSpace(line) == marker {
+			if indented {
+				lines = trimIndent(lines)
+			}
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, line)
+	}
+	return "", p.errorf("missing heredoc end %s", marker)
+}
+
+// trimIndent removes the indentation the lines have in common.
+func trimIndent(lines []string) []string {
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if n := len(l) - len(strings.TrimLeft(l, " \t")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, l := range lines {
+		if len(l) >= indent && indent > 0 {
+			lines[i] = l[indent:]
+		}
+	}
+	return lines
+}
+
+// skipExpression skips to the end of the line, or to the end of a list or
+// object the expression is in, past nested brackets and strings.
+func (p *hclParser) skipExpression() error {
+	depth := 0
+	for !p.eof() {
+		switch c := p.peek(); c {
+		case '"':
+			if _, err := p.quoted(); err != nil {
+				return err
+			}
+			continue
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		case ',', '\n':
+			if depth == 0 {
+				return nil
+			}
+		}
+		p.next()
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// Package compliance maps the findings of dio onto the controls of the CIS
+// Docker Benchmark and NIST SP 800-190, for reports and GRC tooling. Only
+// the controls dio can check from a Dockerfile, an image and its scan are
+// listed; the others need the host, the daemon or the registry.
+package compliance
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Frameworks, as they appear in ComplianceControl.Framework.
+const (
+	FrameworkCIS  = "cis-docker-1.6.0"
+	FrameworkNIST = "nist-sp-800-190"
+)
+
+// FrameworkNames are the titles of the frameworks.
+var FrameworkNames = map[string]string{
+	FrameworkCIS:  "CIS Docker Benchmark v1.6.0",
+	FrameworkNIST: "NIST SP 800-190",
+}
+
+// Control is a benchmark control and how dio checks it.
+type Control struct {
+	Framework string
+	ID        string
+	Title     string
+	// Rules are the analyzer rules whose issues fail the control. Extended
+	// ruleset and hadolint codes match with or without the HL- prefix.
+	Rules []string
+	// Vulnerabilities fails the control on critical or high CVEs in the
+	// scan of the final image.
+	Vulnerabilities bool
+	// SetIDFiles fails the control on setuid and setgid files found in
+	// the final image.
+	SetIDFiles bool
+	// Healthcheck fails the control on an image config without a
+	// HEALTHCHECK, when there is no Dockerfile to analyze.
+	Healthcheck bool
+	// User fails the control on an image config that runs as root, when
+	// there is no Dockerfile to analyze.
+	User bool
+}
+
+// Controls are the controls dio checks, in report order.
+var Controls = []Control{
+	{Framework: FrameworkCIS, ID: "4.1", Title: "Ensure that a user for the container has been created",
+		Rules: []string{"DIO006", "DIO020", "DL3002"}, User: true},
+	{Framework: FrameworkCIS, ID: "4.2", Title: "Ensure that containers use only trusted base images",
+		Rules: []string{"DIO001", "DIO035", "DL3006", "DL3007"}},
+	{Framework: FrameworkCIS, ID: "4.3", Title: "Ensure that unnecessary packages are not installed in the container",
+		Rules: []string{"DIO004", "DIO018", "DIO019", "DL3015"}},
+	{Framework: FrameworkCIS, ID: "4.4", Title: "Ensure images are scanned and rebuilt to include security patches",
+		Vulnerabilities: true},
+	{Framework: FrameworkCIS, ID: "4.6", Title: "Ensure that HEALTHCHECK instructions have been added to container images",
+		Rules: []string{"DIO012"}, Healthcheck: true},
+	{Framework: FrameworkCIS, ID: "4.8", Title: "Ensure setuid and setgid permissions are removed",
+		Rules: []string{"DIO021"}, SetIDFiles: true},
+	{Framework: FrameworkCIS, ID: "4.10", Title: "Ensure secrets are not stored in Dockerfiles",
+		Rules: []string{"DIO036"}},
+	{Framework: FrameworkNIST, ID: "4.1.1", Title: "Image vulnerabilities",
+		Vulnerabilities: true},
+	{Framework: FrameworkNIST, ID: "4.1.2", Title: "Image configuration defects",
+		Rules: []string{"DIO006", "DIO019", "DIO020", "DIO021", "DL3002"}, SetIDFiles: true, User: true},
+	{Framework: FrameworkNIST, ID: "4.1.4", Title: "Embedded clear text secrets",
+		Rules: []string{"DIO036"}},
+	{Framework: FrameworkNIST, ID: "4.1.5", Title: "Use of untrusted images",
+		Rules: []string{"DIO001", "DIO035", "DL3006", "DL3007"}},
+}
+
+// ControlsFor returns the controls an analyzer rule checks, e.g.
+// "CIS 4.1" for DIO006.
+func ControlsFor(ruleID string) []string {
+	ruleID = strings.TrimPrefix(ruleID, "HL-")
+	var controls []string
+	for _, c := range Controls {
+		for _, id := range c.Rules {
+			if id == ruleID {
+				controls = append(controls, shortName(c.Framework)+" "+c.ID)
+			}
+		}
+	}
+	return controls
+}
+
+func shortName(framework string) string {
+	if framework == FrameworkCIS {
+		return "CIS"
+	}
+	return "NIST"
+}
+
+// Evaluate returns the status of each control for the results of a run,
+// a Dockerfile analysis or the evaluation of an image. Like the policy,
+// Dockerfile controls check the autofixed Dockerfile when the policy did.
+func Evaluate(result *models.PipelineResult) *models.ComplianceResult {
+	analysis := result.Analysis
+	if result.Policy != nil && result.Policy.Analysis == models.AnalysisOptimized && result.OptimizedAnalysis != nil {
+		analysis = result.OptimizedAnalysis
+	}
+	c := &models.ComplianceResult{}
+	for _, control := range Controls {
+		cc := evaluate(control, result, analysis)
+		switch cc.Status {
+		case models.ControlPass:
+			c.Passed++
+		case models.ControlFail:
+			c.Failed++
+		default:
+			c.NotApplicable++
+		}
+		c.Controls = append(c.Controls, cc)
+	}
+	return c
+}
+
+func evaluate(control Control, result *models.PipelineResult, analysis *models.AnalysisResult) models.ComplianceControl {
+	cc := models.ComplianceControl{
+		Framework: control.Framework,
+		ID:        control.ID,
+		Title:     control.Title,
+		Rules:     control.Rules,
+	}
+	checked := false
+	var notApplicable []string
+
+	if analysis != nil && len(control.Rules) > 0 {
+		checked = true
+		var relaxed []string
+		for _, issue := range analysis.Issues {
+			if !containsRule(control.Rules, issue.ID) {
+				continue
+			}
+			// The image kind lowered it: the control doesn't apply to it
+			if issue.DefaultSeverity != "" && issue.Severity == models.SeverityInfo {
+				relaxed = append(relaxed, fmt.Sprintf("%s is info for a %s image", issue.ID, analysis.ImageKind))
+				continue
+			}
+			cc.Findings = append(cc.Findings, issueFinding(issue))
+		}
+		if len(cc.Findings) == 0 && len(relaxed) > 0 {
+			notApplicable = append(notApplicable, relaxed...)
+			checked = false
+		}
+	}
+
+	img := result.FinalImage()
+	if analysis == nil && img != nil {
+		if control.User {
+			checked = true
+			if img.User == "" || img.User == "root" || strings.HasPrefix(img.User, "0:") || img.User == "0" {
+				cc.Findings = append(cc.Findings, "Image config runs as root")
+			}
+		}
+		if control.Healthcheck {
+			checked = true
+			if !img.Healthcheck {
+				cc.Findings = append(cc.Findings, "Image config has no HEALTHCHECK")
+			}
+		}
+	}
+
+	if control.SetIDFiles && len(result.SetIDFiles) > 0 {
+		checked = true
+		for _, f := range result.SetIDFiles {
+			cc.Findings = append(cc.Findings, fmt.Sprintf("%s has mode %s", f.Path, f.Mode))
+		}
+	}
+
+	if control.Vulnerabilities {
+		if scan := result.FinalScan(); scan != nil {
+			checked = true
+			if scan.CriticalCount+scan.HighCount > 0 {
+				cc.Findings = append(cc.Findings, fmt.Sprintf("%d critical and %d high vulnerabilities in %s", scan.CriticalCount, scan.HighCount, scan.ImageName))
+			}
+		} else {
+			notApplicable = append(notApplicable, "The image was not scanned")
+		}
+	}
+
+	switch {
+	case len(cc.Findings) > 0:
+		cc.Status = models.ControlFail
+	case checked:
+		cc.Status = models.ControlPass
+	default:
+		cc.Status = models.ControlNotApplicable
+		cc.Findings = notApplicable
+		if len(cc.Findings) == 0 {
+			cc.Findings = []string{"No Dockerfile analysis or image to check"}
+		}
+	}
+	return cc
+}
+
+func containsRule(rules []string, id string) bool {
+	id = strings.TrimPrefix(id, "HL-")
+	for _, r := range rules {
+		if r == id {
+			return true
+		}
+	}
+	return false
+}
+
+// issueFinding describes an issue as a finding, e.g. "DIO006 (line 5):
+// Container runs as root".
+func issueFinding(issue models.Issue) string {
+	if issue.Line > 0 {
+		return fmt.Sprintf("%s (line %d): %s", issue.ID, issue.Line, issue.Title)
+	}
+	return fmt.Sprintf("%s: %s", issue.ID, issue.Title)
+}
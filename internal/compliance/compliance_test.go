@@ -0,0 +1,76 @@
+package compliance
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func statuses(c *models.ComplianceResult) map[string]string {
+	s := make(map[string]string)
+	for _, control := range c.Controls {
+		s[shortName(control.Framework)+" "+control.ID] = control.Status
+	}
+	return s
+}
+
+func TestEvaluate_Dockerfile(t *testing.T) {
+	result := &models.PipelineResult{Analysis: &models.AnalysisResult{
+		ImageKind: "job",
+		Issues: []models.Issue{
+			{ID: "DIO006", Line: 3, Title: "Container runs as root", Severity: models.SeverityHigh},
+			{ID: "HL-DL3007", Line: 1, Title: "Using latest", Severity: models.SeverityMedium},
+			{ID: "DIO012", Severity: models.SeverityInfo, DefaultSeverity: models.SeverityLow},
+		},
+	}}
+	c := Evaluate(result)
+	got := statuses(c)
+	want := map[string]string{
+		"CIS 4.1": models.ControlFail, "CIS 4.2": models.ControlFail, "CIS 4.3": models.ControlPass,
+		"CIS 4.4": models.ControlNotApplicable, "CIS 4.6": models.ControlNotApplicable,
+		"CIS 4.8": models.ControlPass, "CIS 4.10": models.ControlPass,
+		"NIST 4.1.1": models.ControlNotApplicable, "NIST 4.1.2": models.ControlFail,
+		"NIST 4.1.4": models.ControlPass, "NIST 4.1.5": models.ControlFail,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if c.Passed != 4 || c.Failed != 4 || c.NotApplicable != 3 {
+		t.Errorf("counts = %d/%d/%d, want 4/4/3", c.Passed, c.Failed, c.NotApplicable)
+	}
+	if f := c.Controls[0].Findings; len(f) != 1 || f[0] != "DIO006 (line 3): Container runs as root" {
+		t.Errorf("CIS 4.1 findings = %v", f)
+	}
+}
+
+func TestEvaluate_Image(t *testing.T) {
+	result := &models.PipelineResult{
+		Image:         "app:1.0",
+		BaselineImage: &models.ImageMetrics{User: "app", Healthcheck: false},
+		ScanResult:    &models.ScanResult{ImageName: "app:1.0", CriticalCount: 1},
+		SetIDFiles:    []models.SetIDFile{{Path: "/usr/bin/su", Mode: "4755", Setuid: true}},
+	}
+	got := statuses(Evaluate(result))
+	for id, want := range map[string]string{
+		"CIS 4.1":    models.ControlPass,
+		"CIS 4.2":    models.ControlNotApplicable, // needs the Dockerfile
+		"CIS 4.4":    models.ControlFail,
+		"CIS 4.6":    models.ControlFail,
+		"CIS 4.8":    models.ControlFail,
+		"NIST 4.1.2": models.ControlFail,
+	} {
+		if got[id] != want {
+			t.Errorf("%s = %s, want %s", id, got[id], want)
+		}
+	}
+}
+
+func TestControlsFor(t *testing.T) {
+	if got := ControlsFor("HL-DL3007"); !reflect.DeepEqual(got, []string{"CIS 4.2", "NIST 4.1.5"}) {
+		t.Errorf("ControlsFor(HL-DL3007) = %v", got)
+	}
+	if got := ControlsFor("DIO010"); got != nil {
+		t.Errorf("ControlsFor(DIO010) = %v, want none", got)
+	}
+}
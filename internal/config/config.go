@@ -0,0 +1,593 @@
+// Package config loads the project-level .dio.yaml configuration file.
+// It controls how DIO components behave (which analyzers run, how their
+// findings are mapped), as opposed to policy files which define pass/fail gates.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// DefaultFileName is the configuration file DIO looks for when none is given.
+const DefaultFileName = ".dio.yaml"
+
+// Config represents the .dio.yaml configuration file.
+type Config struct {
+	// Threshold is the lowest severity that counts: issues below it don't
+	// lower the analyzer score, and vulnerabilities below it don't fail
+	// dio scan or the policy. Empty counts every severity.
+	Threshold string `yaml:"threshold"`
+
+	Analyzer     AnalyzerConfig     `yaml:"analyzer"`
+	Image        ImageConfig        `yaml:"image"`
+	Hadolint     HadolintConfig     `yaml:"hadolint"`
+	Shellcheck   ShellcheckConfig   `yaml:"shellcheck"`
+	BuildCheck   BuildCheckConfig   `yaml:"build_check"`
+	Trivy        TrivyConfig        `yaml:"trivy"`
+	Policy       PolicyConfig       `yaml:"policy"`
+	Tickets      TicketsConfig      `yaml:"tickets"`
+	Updates      UpdatesConfig      `yaml:"updates"`
+	PullRequests PullRequestsConfig `yaml:"pull_requests"`
+	History      HistoryConfig      `yaml:"history"`
+	Squash       SquashConfig       `yaml:"squash"`
+	Slim         SlimConfig         `yaml:"slim"`
+	Registry     RegistryConfig     `yaml:"registry"`
+	Retry        RetryConfig        `yaml:"retry"`
+	Mirrors      MirrorsConfig      `yaml:"mirrors"`
+	Strip        StripConfig        `yaml:"strip"`
+	Optimizer    OptimizerConfig    `yaml:"optimizer"`
+	Reproducible ReproducibleConfig `yaml:"reproducible"`
+	Attestations AttestationsConfig `yaml:"attestations"`
+	GoldenImages GoldenImagesConfig `yaml:"golden_images"`
+	Cost         CostConfig         `yaml:"cost"`
+	Carbon       CarbonConfig       `yaml:"carbon"`
+}
+
+// AnalyzerConfig controls the built-in Dockerfile analyzer.
+type AnalyzerConfig struct {
+	// Ruleset selects the built-in rules: "default" or "extended" (default
+	// rules plus native ports of common hadolint checks).
+	Ruleset string `yaml:"ruleset"`
+	// RuleOptions holds per-rule settings keyed by rule ID, e.g.
+	// {"DIO003": {"max_layers": 20}}.
+	RuleOptions map[string]map[string]interface{} `yaml:"rule_options"`
+	// Cache turns the on-disk analysis cache on or off (default: on).
+	Cache *bool `yaml:"cache"`
+	// CacheDir overrides where analysis results are cached (default:
+	// ~/.dio/cache).
+	CacheDir string `yaml:"cache_dir"`
+	// Updater is the dependency updater keeping base images current:
+	// "auto" (default) detects a Renovate or Dependabot config in the
+	// repository, "renovate" or "dependabot" assume one, "none" ignores it.
+	Updater string `yaml:"updater"`
+}
+
+// ImageConfig declares what the image is for, so that rules which only
+// matter for some images weigh accordingly in the score, the policy and
+// reports.
+type ImageConfig struct {
+	// Kind is "service", "job" or "base-image"; "auto" (default) detects
+	// base images from the Dockerfile, and "none" leaves every rule at its
+	// own severity.
+	Kind string `yaml:"kind"`
+	// Severities overrides the severity of rules by kind, e.g.
+	// {"job": {"DIO012": "info"}}, on top of the built-in mapping. Keys are
+	// rule IDs or hadolint codes.
+	Severities map[string]map[string]string `yaml:"severities"`
+}
+
+// HadolintConfig controls the optional hadolint integration.
+type HadolintConfig struct {
+	// Enabled turns hadolint on or off. When unset, hadolint is used
+	// automatically if the binary is found in PATH.
+	Enabled *bool `yaml:"enabled"`
+	// Config is the path to a .hadolint.yaml file passed through with --config.
+	// When empty, a .hadolint.yaml next to the Dockerfile is used if present.
+	Config string `yaml:"config"`
+	// Ignore lists hadolint rule codes to skip (e.g., DL3008).
+	Ignore []string `yaml:"ignore"`
+	// TrustedRegistries lists registries passed to hadolint's DL3026 check.
+	TrustedRegistries []string `yaml:"trusted_registries"`
+	// SeverityMap overrides the DIO severity of hadolint findings. Keys are
+	// either hadolint levels (error, warning, info, style) or rule codes
+	// (DL3008); rule codes take precedence.
+	SeverityMap map[string]string `yaml:"severity_map"`
+}
+
+// ShellcheckConfig controls the optional shellcheck integration, which
+// checks the shell scripts of RUN instructions.
+type ShellcheckConfig struct {
+	// Enabled turns shellcheck on or off. When unset, shellcheck is used
+	// automatically if the binary is found in PATH.
+	Enabled *bool `yaml:"enabled"`
+	// Exclude lists shellcheck codes to skip (e.g., SC2086).
+	Exclude []string `yaml:"exclude"`
+}
+
+// BuildCheckConfig controls the optional docker build --check integration,
+// which runs BuildKit's build checks on the Dockerfile.
+type BuildCheckConfig struct {
+	// Enabled turns the build checks on. They are off by default: they
+	// need docker with buildx 0.15 or later and a running builder.
+	Enabled bool `yaml:"enabled"`
+	// Skip lists build checks to skip (e.g., JSONArgsRecommended).
+	Skip []string `yaml:"skip"`
+}
+
+// TrivyConfig controls the optional trivy config integration, which scans
+// the Dockerfile for misconfigurations.
+type TrivyConfig struct {
+	// Enabled turns the scan on. It is off by default, even when trivy is
+	// installed for image scans.
+	Enabled bool `yaml:"enabled"`
+	// Exclude lists trivy checks to skip, by AVD ID (e.g., AVD-DS-0026)
+	// or trivy ID (e.g., DS026).
+	Exclude []string `yaml:"exclude"`
+}
+
+// PolicyConfig controls how remote policies (https:// URLs and oci://
+// artifacts passed to --policy) are fetched.
+type PolicyConfig struct {
+	// PublicKey is the path to an ed25519 public key. When set, remote
+	// policies must be signed with the matching private key.
+	PublicKey string `yaml:"public_key"`
+	// CacheDir overrides where remote policies are cached.
+	CacheDir string `yaml:"cache_dir"`
+	// AllowHTTP permits fetching policies from plain http:// URLs without
+	// PublicKey, e.g. from an internal server without TLS.
+	AllowHTTP bool `yaml:"allow_http"`
+}
+
+// TicketsConfig controls exporting findings to an issue tracker with
+// dio tickets. Credentials are read from environment variables, never from
+// the file.
+type TicketsConfig struct {
+	// Provider is the issue tracker: "github" or "jira".
+	Provider string `yaml:"provider"`
+	// Labels are added to every ticket (default: dio).
+	Labels []string `yaml:"labels"`
+	// MinSeverity is the lowest CVE severity exported (default: the
+	// threshold, or critical when there is none).
+	MinSeverity string `yaml:"min_severity"`
+
+	GitHub GitHubTicketsConfig `yaml:"github"`
+	Jira   JiraTicketsConfig   `yaml:"jira"`
+}
+
+// GitHubTicketsConfig configures GitHub Issues.
+type GitHubTicketsConfig struct {
+	// Repo is the repository issues are filed in, as owner/name.
+	Repo string `yaml:"repo"`
+	// APIURL overrides the API endpoint for GitHub Enterprise.
+	APIURL string `yaml:"api_url"`
+	// TokenEnv names the variable holding the token (default: GITHUB_TOKEN).
+	TokenEnv string `yaml:"token_env"`
+}
+
+// JiraTicketsConfig configures Jira.
+type JiraTicketsConfig struct {
+	URL       string `yaml:"url"`
+	Project   string `yaml:"project"`
+	IssueType string `yaml:"issue_type"` // default: Bug
+	// UserEnv and TokenEnv name the variables holding the basic auth
+	// credentials (default: JIRA_USER and JIRA_TOKEN).
+	UserEnv  string `yaml:"user_env"`
+	TokenEnv string `yaml:"token_env"`
+}
+
+// PullRequestsConfig controls the pull requests dio update --pr opens.
+// Credentials are read from environment variables, never from the file.
+type PullRequestsConfig struct {
+	// Provider is the forge: "github" or "gitlab".
+	Provider string `yaml:"provider"`
+	// Labels are added to every pull request (default: dio, dependencies).
+	Labels []string `yaml:"labels"`
+	// BaseBranch is the branch pull requests target (default: the current
+	// branch).
+	BaseBranch string `yaml:"base_branch"`
+	// Remote is the git remote branches are pushed to (default: origin).
+	Remote string `yaml:"remote"`
+
+	GitHub GitHubPullRequestsConfig `yaml:"github"`
+	GitLab GitLabPullRequestsConfig `yaml:"gitlab"`
+}
+
+// GitHubPullRequestsConfig configures GitHub pull requests.
+type GitHubPullRequestsConfig struct {
+	// Repo is the repository pull requests are opened in, as owner/name.
+	Repo string `yaml:"repo"`
+	// APIURL overrides the API endpoint for GitHub Enterprise.
+	APIURL string `yaml:"api_url"`
+	// TokenEnv names the variable holding the token (default: GITHUB_TOKEN).
+	TokenEnv string `yaml:"token_env"`
+}
+
+// GitLabPullRequestsConfig configures GitLab merge requests.
+type GitLabPullRequestsConfig struct {
+	// Project is the project merge requests are opened in, as its path
+	// (group/name) or numeric ID.
+	Project string `yaml:"project"`
+	// APIURL overrides the API endpoint for self-managed GitLab.
+	APIURL string `yaml:"api_url"`
+	// TokenEnv names the variable holding the token (default: GITLAB_TOKEN).
+	TokenEnv string `yaml:"token_env"`
+}
+
+// UpdatesConfig controls the update notice.
+type UpdatesConfig struct {
+	// Notify prints a notice when a newer DIO release exists, checking
+	// GitHub at most once a day. Off by default.
+	Notify bool `yaml:"notify"`
+}
+
+// HistoryConfig controls the run history that dio run records and
+// dio serve displays.
+type HistoryConfig struct {
+	// Enabled turns recording on or off (default: on).
+	Enabled *bool `yaml:"enabled"`
+	// Dir overrides where runs are stored (default: ~/.dio/history).
+	Dir string `yaml:"dir"`
+}
+
+// SquashConfig controls the optional squash step of dio run, which
+// flattens the final image into a single layer after the build.
+type SquashConfig struct {
+	// Enabled turns the step on, like dio run --squash. Off by default.
+	Enabled bool `yaml:"enabled"`
+	// MaxLayers squashes images with more layers than this (default: 20).
+	MaxLayers int `yaml:"max_layers"`
+	// MaxWasted squashes images spending more than this on files that later
+	// layers overwrite or delete, e.g. "20MB" (default: 20MB).
+	MaxWasted string `yaml:"max_wasted"`
+}
+
+// SlimConfig controls runtime minification with mint (docker-slim), used
+// by dio slim and the slim stage of dio run.
+type SlimConfig struct {
+	// Enabled runs the slim stage in dio run, like dio run --slim. Off by
+	// default.
+	Enabled bool `yaml:"enabled"`
+	// HTTPProbe exercises the exposed ports with HTTP requests while the
+	// image is observed.
+	HTTPProbe bool `yaml:"http_probe"`
+	// ContinueAfter is when observation stops: probe, exec, container.exit
+	// or a number of seconds (default: probe with http_probe, otherwise 10).
+	ContinueAfter string `yaml:"continue_after"`
+	// IncludePaths are kept in the minified image even if unused.
+	IncludePaths []string `yaml:"include_paths"`
+}
+
+// RegistryConfig controls how DIO reaches registries directly, for fleet
+// scans and oci:// policies. Credentials come from the docker config and
+// its credential helpers, or the aws, gcloud and az CLIs for ECR,
+// GCR/Artifact Registry and ACR.
+type RegistryConfig struct {
+	// DockerConfig is the docker config.json to read credentials from
+	// (default: $DOCKER_CONFIG/config.json or ~/.docker/config.json).
+	DockerConfig string `yaml:"docker_config"`
+	// CAFile is a PEM bundle of additional CAs trusted for every registry.
+	CAFile string `yaml:"ca_file"`
+	// CertsDir holds per-registry CAs and client certificates laid out like
+	// docker's certs.d (default: /etc/docker/certs.d).
+	CertsDir string `yaml:"certs_dir"`
+	// Insecure lists registries whose TLS certificates are not verified.
+	Insecure []string `yaml:"insecure"`
+}
+
+// RetryConfig controls retries of registry pulls, scanner database
+// downloads and docker builds that fail for transient reasons, such as
+// network timeouts or registry rate limits.
+type RetryConfig struct {
+	// Attempts is the total number of attempts (default: 3; 1 disables
+	// retries).
+	Attempts int `yaml:"attempts"`
+	// Delay is the wait before the first retry, doubled after each attempt
+	// (default: 2s).
+	Delay string `yaml:"delay"`
+	// MaxDelay caps the wait between attempts (default: 30s).
+	MaxDelay string `yaml:"max_delay"`
+}
+
+// MirrorsConfig points builds at internal pull-through caches and mirrors:
+// the optimizer rewrites base images and package sources to use them
+// (OPT-MIRROR).
+type MirrorsConfig struct {
+	// Registries maps a registry to its mirror, e.g. {"docker.io":
+	// "registry-mirror.corp"}. Docker Hub official images keep their
+	// library/ namespace on the mirror.
+	Registries map[string]string `yaml:"registries"`
+	// Apt replaces the Debian and Ubuntu archive hosts in apt sources, e.g.
+	// http://apt-mirror.corp; the paths are kept.
+	Apt string `yaml:"apt"`
+	// Apk replaces https://dl-cdn.alpinelinux.org/alpine in apk repositories.
+	Apk string `yaml:"apk"`
+	// Pip and Npm are the package index and registry pip and npm install
+	// from.
+	Pip string `yaml:"pip"`
+	Npm string `yaml:"npm"`
+}
+
+// Enabled reports whether any mirror is configured.
+func (m MirrorsConfig) Enabled() bool {
+	return len(m.Registries) > 0 || m.Apt != "" || m.Apk != "" || m.Pip != "" || m.Npm != ""
+}
+
+// StripConfig turns on the strip-docs strategy, which keeps documentation,
+// man pages and translations out of Debian and Ubuntu images (OPT-STRIP-DOCS).
+// Off by default: man, info and translated messages stop working, and
+// the documentation shipped with packages is gone.
+type StripConfig struct {
+	// Enabled turns the strategy on.
+	Enabled bool `yaml:"enabled"`
+	// Method is "dpkg" (default), which configures dpkg path-excludes so
+	// that packages installed later don't unpack the files, or "remove",
+	// which deletes them at the end of each RUN that installs packages.
+	Method string `yaml:"method"`
+	// KeepLocales lists the translations to keep, e.g. ["de", "fr"].
+	KeepLocales []string `yaml:"keep_locales"`
+}
+
+// OptimizerConfig makes autofix follow the conventions of the organization
+// instead of DIO's defaults.
+type OptimizerConfig struct {
+	BaseImage BaseImageConfig `yaml:"base_image"`
+	User      UserConfig      `yaml:"user"`
+	// Workdir is the WORKDIR added to Linux images without one, and that of
+	// the final stage of multi-stage rewrites (default: /app).
+	Workdir string `yaml:"workdir"`
+}
+
+// Variants of smaller base images.
+const (
+	VariantSlim       = "slim"
+	VariantAlpine     = "alpine"
+	VariantDistroless = "distroless"
+)
+
+// BaseImageConfig controls the smaller base images the optimizer proposes
+// (OPT-BASE) when there is no golden image catalog.
+type BaseImageConfig struct {
+	// Variant is the preferred variant: slim, alpine or distroless. Images
+	// without that variant get the default alternative. Empty picks per
+	// image, alpine for most runtimes. Distroless images have no shell, so
+	// they are suggested but not applied.
+	Variant string `yaml:"variant"`
+}
+
+// UserConfig is the non-root user autofix creates and runs the final stage
+// as (OPT-USER).
+type UserConfig struct {
+	// Name is the user (default: appuser) and Group its primary group
+	// (default: appgroup).
+	Name  string `yaml:"name"`
+	Group string `yaml:"group"`
+	// UID and GID are their IDs (default: 1001). USER names them
+	// numerically, so that runAsNonRoot can verify it.
+	UID int `yaml:"uid"`
+	GID int `yaml:"gid"`
+}
+
+// Defaults of the non-root user and working directory.
+const (
+	DefaultUserName  = "appuser"
+	DefaultUserGroup = "appgroup"
+	DefaultUserID    = 1001
+	DefaultWorkdir   = "/app"
+)
+
+// WithDefaults returns the user with the defaults filled in.
+func (u UserConfig) WithDefaults() UserConfig {
+	if u.Name == "" {
+		u.Name = DefaultUserName
+	}
+	if u.Group == "" {
+		u.Group = DefaultUserGroup
+	}
+	if u.UID == 0 {
+		u.UID = DefaultUserID
+	}
+	if u.GID == 0 {
+		u.GID = DefaultUserID
+	}
+	return u
+}
+
+// ReproducibleConfig dates the builds of dio run for reproducibility.
+// Builds that set the same SOURCE_DATE_EPOCH from the same sources can be
+// byte-identical; the require_reproducible policy rule checks it.
+type ReproducibleConfig struct {
+	// SourceDateEpoch is a Unix timestamp, or "git" for the time of the
+	// last commit of the Dockerfile's repository. Empty builds normally;
+	// dio run --source-date-epoch overrides it.
+	SourceDateEpoch string `yaml:"source_date_epoch"`
+	// RewriteTimestamps also clamps the timestamps of the files in the
+	// layers, which needs BuildKit 0.13 (Docker 27).
+	RewriteTimestamps bool `yaml:"rewrite_timestamps"`
+}
+
+// AttestationsConfig has dio run generate BuildKit attestations of the
+// final image and store them with the reports, under attestations/. The
+// require_provenance and require_sbom_attestation policy rules turn them on
+// too.
+type AttestationsConfig struct {
+	// Provenance is the SLSA v1 provenance mode: min, or max to also record
+	// the build args, the Dockerfile and the sources. Empty generates none.
+	Provenance string `yaml:"provenance"`
+	// SBOM generates an SPDX SBOM attestation.
+	SBOM bool `yaml:"sbom"`
+}
+
+// GoldenImagesConfig is the organization's catalog of golden base images,
+// maintained and patched internally. With images listed, the analyzer
+// reports final images built on anything else (DIO035) and the optimizer
+// proposes the golden image for the application's runtime instead of
+// public slim images.
+type GoldenImagesConfig struct {
+	Images []GoldenImage `yaml:"images"`
+}
+
+// GoldenImage is an image of the golden image catalog.
+type GoldenImage struct {
+	// Name is the repository, e.g. registry.corp/golden/node.
+	Name string `yaml:"name"`
+	// Tags are the approved tags, the recommended one first. Empty approves
+	// any tag.
+	Tags []string `yaml:"tags"`
+	// Runtimes are the languages and servers the image provides: node,
+	// python, go, java, ruby, php, rust, dotnet or nginx. An image without
+	// runtimes is the fallback for applications of any other.
+	Runtimes []string `yaml:"runtimes"`
+}
+
+// Ref returns the reference of the image with its recommended tag.
+func (g GoldenImage) Ref() string {
+	if len(g.Tags) == 0 {
+		return g.Name
+	}
+	return g.Name + ":" + g.Tags[0]
+}
+
+// CostConfig prices registry usage so that dio run reports what the size
+// reduction saves per month. Off unless a price is set.
+type CostConfig struct {
+	// StoragePerGB is the registry storage price per GB and month.
+	StoragePerGB float64 `yaml:"storage_per_gb"`
+	// EgressPerGB is the price per GB transferred out of the registry.
+	EgressPerGB float64 `yaml:"egress_per_gb"`
+	// PullsPerDay is how often the image is pulled, e.g. by nodes and CI.
+	PullsPerDay float64 `yaml:"pulls_per_day"`
+	// Currency labels the amounts (default: USD).
+	Currency string `yaml:"currency"`
+}
+
+// CarbonConfig turns on the estimate of the energy and emissions the size
+// reduction saves in registry transfers and storage, in dio run reports.
+type CarbonConfig struct {
+	// Enabled turns the estimate on. Off by default.
+	Enabled bool `yaml:"enabled"`
+	// PullsPerDay is how often the image is pulled (default:
+	// cost.pulls_per_day).
+	PullsPerDay float64 `yaml:"pulls_per_day"`
+	// TransferKWhPerGB is the energy of transferring a GB (default: 0.001).
+	TransferKWhPerGB float64 `yaml:"transfer_kwh_per_gb"`
+	// StorageKWhPerGB is the energy of storing a GB for a month (default:
+	// 0.0014).
+	StorageKWhPerGB float64 `yaml:"storage_kwh_per_gb"`
+	// GridIntensity is the carbon intensity of the electricity in gCO2e per
+	// kWh (default: 475, the world average).
+	GridIntensity float64 `yaml:"grid_intensity"`
+}
+
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{}
+}
+
+// Load reads a configuration from a YAML file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := Default()
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// accountNameRegex matches the user and group names adduser accepts.
+var accountNameRegex = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+
+// Validate checks the settings that must parse: the threshold, the
+// analyzer ruleset, the hadolint severity map, the retry delays, the strip method and the optimizer
+// settings.
+func (c *Config) Validate() error {
+	if c.Threshold != "" {
+		if _, err := models.ParseSeverity(c.Threshold); err != nil {
+			return fmt.Errorf("threshold: %w", err)
+		}
+	}
+	switch c.Analyzer.Ruleset {
+	case "", "default", "extended":
+	default:
+		return fmt.Errorf("analyzer.ruleset: unknown ruleset %q (want default or extended)", c.Analyzer.Ruleset)
+	}
+	keys := make([]string, 0, len(c.Hadolint.SeverityMap))
+	for key := range c.Hadolint.SeverityMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := models.ParseSeverity(c.Hadolint.SeverityMap[key]); err != nil {
+			return fmt.Errorf("hadolint.severity_map.%s: %w", key, err)
+		}
+	}
+	for key, value := range map[string]string{"retry.delay": c.Retry.Delay, "retry.max_delay": c.Retry.MaxDelay} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	switch c.Strip.Method {
+	case "", "dpkg", "remove":
+	default:
+		return fmt.Errorf("strip.method: unknown method %q (want dpkg or remove)", c.Strip.Method)
+	}
+	switch c.Optimizer.BaseImage.Variant {
+	case "", VariantSlim, VariantAlpine, VariantDistroless:
+	default:
+		return fmt.Errorf("optimizer.base_image.variant: unknown variant %q (want slim, alpine or distroless)", c.Optimizer.BaseImage.Variant)
+	}
+	user := c.Optimizer.User
+	for key, name := range map[string]string{"optimizer.user.name": user.Name, "optimizer.user.group": user.Group} {
+		if name != "" && !accountNameRegex.MatchString(name) {
+			return fmt.Errorf("%s: %q is not a valid user or group name", key, name)
+		}
+	}
+	// UID 0 is root; 0 stands for the default here
+	for key, id := range map[string]int{"optimizer.user.uid": user.UID, "optimizer.user.gid": user.GID} {
+		if id < 0 {
+			return fmt.Errorf("%s: %d is not a valid ID", key, id)
+		}
+	}
+	if w := c.Optimizer.Workdir; w != "" && !path.IsAbs(w) {
+		return fmt.Errorf("optimizer.workdir: %q is not an absolute path", w)
+	}
+	if p := c.Attestations.Provenance; p != "" && p != "min" && p != "max" {
+		return fmt.Errorf("attestations.provenance: unknown mode %q (want min or max)", p)
+	}
+	if epoch := c.Reproducible.SourceDateEpoch; epoch != "" && epoch != "git" {
+		if _, err := strconv.ParseInt(epoch, 10, 64); err != nil {
+			return fmt.Errorf("reproducible.source_date_epoch: %q is neither a Unix timestamp nor git", epoch)
+		}
+	}
+	return nil
+}
+
+// LoadOrDefault loads the configuration at path. If path is empty, it looks
+// for .dio.yaml in the current directory and falls back to the defaults when
+// no file is found.
+func LoadOrDefault(path string) (*Config, error) {
+	if path != "" {
+		return Load(path)
+	}
+	if _, err := os.Stat(DefaultFileName); err == nil {
+		return Load(filepath.Clean(DefaultFileName))
+	}
+	return Default(), nil
+}
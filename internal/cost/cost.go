@@ -0,0 +1,56 @@
+// Package cost estimates what an image size reduction saves in registry
+// storage and egress each month.
+package cost
+
+import (
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// gb is the unit registries bill in.
+const gb = 1 << 30
+
+// DaysPerMonth is the length of the month costs are computed for.
+const DaysPerMonth = 30
+
+// DefaultCurrency is used when the rates don't name one.
+const DefaultCurrency = "USD"
+
+// Rates are the prices and the traffic the estimate is based on.
+type Rates struct {
+	// StoragePerGB is the registry storage price per GB and month.
+	StoragePerGB float64
+	// EgressPerGB is the price of transferring a GB out of the registry.
+	EgressPerGB float64
+	// PullsPerDay is how often the image is pulled.
+	PullsPerDay float64
+	Currency    string
+}
+
+// Enabled reports whether any price is set.
+func (r Rates) Enabled() bool {
+	return r.StoragePerGB > 0 || r.EgressPerGB > 0
+}
+
+// Estimate returns the monthly cost impact of an image sizeDiff smaller,
+// as returned by PipelineResult.SizeReduction: stored once, and pulled
+// PullsPerDay times a day. It returns nil when no price is set.
+func Estimate(sizeDiff int64, compressed bool, rates Rates) *models.CostImpact {
+	if !rates.Enabled() {
+		return nil
+	}
+	currency := rates.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	diffGB := float64(sizeDiff) / gb
+	impact := &models.CostImpact{
+		SizeDiff:    sizeDiff,
+		Compressed:  compressed,
+		PullsPerDay: rates.PullsPerDay,
+		Currency:    currency,
+		Storage:     diffGB * rates.StoragePerGB,
+		Egress:      diffGB * rates.PullsPerDay * DaysPerMonth * rates.EgressPerGB,
+	}
+	impact.Total = impact.Storage + impact.Egress
+	return impact
+}
@@ -0,0 +1,31 @@
+package cost
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	rates := Rates{StoragePerGB: 0.10, EgressPerGB: 0.09, PullsPerDay: 100}
+	got := Estimate(512<<20, true, rates)
+	if got == nil || !got.Compressed || got.SizeDiff != 512<<20 || got.Currency != DefaultCurrency {
+		t.Fatalf("Estimate = %+v, want the compressed difference in USD", got)
+	}
+	// 0.5 GB stored once and pulled 100 times a day for 30 days
+	for name, c := range map[string][2]float64{
+		"storage": {got.Storage, 0.05},
+		"egress":  {got.Egress, 135},
+		"total":   {got.Total, 135.05},
+	} {
+		if math.Abs(c[0]-c[1]) > 1e-9 {
+			t.Errorf("%s = %v, want %v", name, c[0], c[1])
+		}
+	}
+
+	if got := Estimate(512<<20, true, Rates{PullsPerDay: 100}); got != nil {
+		t.Errorf("without prices, Estimate = %+v, want nil", got)
+	}
+	if got := Estimate(-1<<30, false, Rates{StoragePerGB: 1, Currency: "EUR"}); got == nil || got.Total != -1 || got.Currency != "EUR" {
+		t.Errorf("Estimate = %+v, want an extra cost of 1 EUR", got)
+	}
+}
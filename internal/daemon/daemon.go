@@ -0,0 +1,168 @@
+// Package daemon loads the targets that dio daemon re-evaluates on a
+// schedule and sends notifications when a target regresses.
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/maxlar/docker-image-optimizer/internal/fleet"
+	"github.com/maxlar/docker-image-optimizer/internal/policy"
+	"github.com/maxlar/docker-image-optimizer/internal/schedule"
+)
+
+// Targets is a targets file:
+//
+//	schedule: "0 3 * * *"
+//	notify:
+//	  webhook: https://hooks.slack.com/services/...
+//	targets:
+//	  - name: api
+//	    dockerfile: services/api/Dockerfile
+//	    policy: policy.yaml
+//	    profile: prod
+//	  - name: team-images
+//	    fleet: registry.corp/team/*
+//	    schedule: "0 4 * * sun"
+type Targets struct {
+	// Schedule is the default cron expression of the targets.
+	Schedule string       `yaml:"schedule"`
+	Notify   NotifyConfig `yaml:"notify"`
+	Targets  []Target     `yaml:"targets"`
+}
+
+// NotifyConfig configures where regressions are reported.
+type NotifyConfig struct {
+	// Webhook receives a JSON POST per regressed target. The payload has a
+	// "text" field, so Slack and Mattermost incoming webhooks work as is.
+	Webhook string `yaml:"webhook"`
+}
+
+// Target is a Dockerfile run through the full pipeline, or a fleet
+// pattern whose images are evaluated.
+type Target struct {
+	Name       string `yaml:"name"`
+	Dockerfile string `yaml:"dockerfile"`
+	Fleet      string `yaml:"fleet"`
+	// Schedule overrides the default schedule for this target.
+	Schedule string `yaml:"schedule"`
+	Policy   string `yaml:"policy"`
+	Profile  string `yaml:"profile"`
+	// Mode is the optimizer mode of pipeline targets: suggest or autofix.
+	Mode string `yaml:"mode"`
+	// Output is the report directory (default: reports/<name> next to the
+	// targets file).
+	Output    string `yaml:"output"`
+	SkipBuild bool   `yaml:"skip_build"`
+	SkipScan  bool   `yaml:"skip_scan"`
+	// Concurrency is the number of fleet images evaluated at once.
+	Concurrency int `yaml:"concurrency"`
+
+	// Cron is the parsed schedule.
+	Cron *schedule.Schedule `yaml:"-"`
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Load reads and validates a targets file. Relative paths in it are
+// resolved against the file's directory. defaultSchedule, when not empty,
+// takes precedence over the file's schedule.
+func Load(path, defaultSchedule string) (*Targets, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read targets file: %w", err)
+	}
+	var t Targets
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse targets file: %w", err)
+	}
+	if defaultSchedule != "" {
+		t.Schedule = defaultSchedule
+	}
+	if len(t.Targets) == 0 {
+		return nil, fmt.Errorf("targets file %s has no targets", path)
+	}
+
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+	seen := make(map[string]bool)
+	for i := range t.Targets {
+		target := &t.Targets[i]
+		if (target.Dockerfile == "") == (target.Fleet == "") {
+			return nil, fmt.Errorf("target %d: exactly one of dockerfile or fleet must be set", i+1)
+		}
+		if target.Name == "" {
+			target.Name = target.Dockerfile + target.Fleet
+		}
+		if seen[target.Name] {
+			return nil, fmt.Errorf("duplicate target name %q", target.Name)
+		}
+		seen[target.Name] = true
+
+		if target.Fleet != "" {
+			if _, err := fleet.ParsePattern(target.Fleet); err != nil {
+				return nil, fmt.Errorf("target %s: %w", target.Name, err)
+			}
+		}
+		switch target.Mode {
+		case "":
+			target.Mode = "suggest"
+		case "suggest", "autofix":
+		default:
+			return nil, fmt.Errorf("target %s: invalid mode %q (expected suggest or autofix)", target.Name, target.Mode)
+		}
+
+		expr := target.Schedule
+		if expr == "" {
+			expr = t.Schedule
+		}
+		if expr == "" {
+			return nil, fmt.Errorf("target %s has no schedule (set --schedule or schedule in the targets file)", target.Name)
+		}
+		if target.Cron, err = schedule.Parse(expr); err != nil {
+			return nil, fmt.Errorf("target %s: %w", target.Name, err)
+		}
+
+		target.Dockerfile = resolve(target.Dockerfile)
+		if target.Output == "" {
+			target.Output = filepath.Join("reports", unsafeNameChars.ReplaceAllString(target.Name, "_"))
+		}
+		target.Output = resolve(target.Output)
+		if target.Policy != "" && !policy.IsRemote(target.Policy) {
+			target.Policy = resolve(target.Policy)
+		}
+	}
+	return &t, nil
+}
+
+// Due returns the targets scheduled to run at the earliest upcoming time
+// after now, and that time.
+func (t *Targets) Due(now time.Time) ([]*Target, time.Time) {
+	var (
+		due  []*Target
+		next time.Time
+	)
+	for i := range t.Targets {
+		target := &t.Targets[i]
+		at := target.Cron.Next(now)
+		switch {
+		case at.IsZero():
+			continue
+		case next.IsZero() || at.Before(next):
+			due, next = []*Target{target}, at
+		case at.Equal(next):
+			due = append(due, target)
+		}
+	}
+	return due, next
+}
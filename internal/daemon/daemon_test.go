@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/history"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func writeTargets(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeTargets(t, `
+schedule: "0 3 * * *"
+targets:
+  - name: api
+    dockerfile: services/api/Dockerfile
+    policy: policy.yaml
+  - fleet: registry.corp/team/*
+    policy: oci://registry.corp/policies/prod:1
+    schedule: "0 * * * *"
+`)
+	targets, err := Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(path)
+	api, team := targets.Targets[0], targets.Targets[1]
+	if api.Dockerfile != filepath.Join(dir, "services/api/Dockerfile") || api.Policy != filepath.Join(dir, "policy.yaml") ||
+		api.Output != filepath.Join(dir, "reports/api") || api.Mode != "suggest" {
+		t.Errorf("unexpected pipeline target %+v", api)
+	}
+	if team.Name != "registry.corp/team/*" || team.Policy != "oci://registry.corp/policies/prod:1" ||
+		team.Output != filepath.Join(dir, "reports/registry.corp_team_") {
+		t.Errorf("unexpected fleet target %+v", team)
+	}
+
+	// The hourly fleet target comes first; at 03:00 both are due
+	now := time.Date(2024, 5, 15, 2, 30, 0, 0, time.UTC)
+	due, next := targets.Due(now)
+	if len(due) != 2 || !next.Equal(time.Date(2024, 5, 15, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected both targets due at 03:00, got %d at %v", len(due), next)
+	}
+	due, _ = targets.Due(next)
+	if len(due) != 1 || due[0].Name != team.Name {
+		t.Errorf("expected only the fleet target next, got %v", due)
+	}
+
+	// --schedule overrides the file's default but not per-target schedules
+	targets, err = Load(path, "*/5 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets.Targets[0].Cron.String() != "*/5 * * * *" || targets.Targets[1].Cron.String() != "0 * * * *" {
+		t.Errorf("unexpected schedules %s and %s", targets.Targets[0].Cron, targets.Targets[1].Cron)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"no targets":  `schedule: "0 3 * * *"`,
+		"no schedule": "targets:\n  - dockerfile: Dockerfile\n",
+		"both kinds":  "schedule: \"@daily\"\ntargets:\n  - dockerfile: Dockerfile\n    fleet: registry.corp/team/*\n",
+		"duplicate":   "schedule: \"@daily\"\ntargets:\n  - dockerfile: Dockerfile\n  - dockerfile: Dockerfile\n",
+		"bad pattern": "schedule: \"@daily\"\ntargets:\n  - fleet: team/*\n",
+		"bad mode":    "schedule: \"@daily\"\ntargets:\n  - dockerfile: Dockerfile\n    mode: yolo\n",
+		"bad cron":    "schedule: \"0 3 * *\"\ntargets:\n  - dockerfile: Dockerfile\n",
+	} {
+		if _, err := Load(writeTargets(t, content), ""); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var got Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	from := &models.PipelineResult{Dockerfile: "Dockerfile", Analysis: &models.AnalysisResult{Score: 90}, Policy: &models.PolicyResult{Passed: true}}
+	to := &models.PipelineResult{Dockerfile: "Dockerfile", Analysis: &models.AnalysisResult{Score: 70}, Policy: &models.PolicyResult{Passed: false}}
+	if n := NewNotification("api", history.Compare("a", from, "b", from)); n != nil {
+		t.Errorf("expected no notification without regressions, got %+v", n)
+	}
+	n := NewNotification("api", history.Compare("a", from, "b", to))
+	if n == nil {
+		t.Fatal("expected a notification")
+	}
+	if err := (&Notifier{Webhook: srv.URL}).Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if got.Target != "api" || got.ToRun != "b" || len(got.Regressions) != 2 ||
+		!strings.HasPrefix(got.Text, "DIO: Dockerfile (api) regressed: policy checks now fail") {
+		t.Errorf("unexpected notification %+v", got)
+	}
+}
@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/history"
+)
+
+// Notification reports a target that regressed since its previous run.
+type Notification struct {
+	// Text is a human-readable summary, for chat webhooks.
+	Text        string   `json:"text"`
+	Target      string   `json:"target"`
+	Subject     string   `json:"subject"` // the Dockerfile or image
+	FromRun     string   `json:"from_run"`
+	ToRun       string   `json:"to_run"`
+	Regressions []string `json:"regressions"`
+}
+
+// NewNotification returns the notification for a diff between two runs of
+// a target, or nil if nothing regressed.
+func NewNotification(target string, d *history.Diff) *Notification {
+	regressions := d.Regressions()
+	if len(regressions) == 0 {
+		return nil
+	}
+	subject := d.To.Target()
+	text := fmt.Sprintf("DIO: %s regressed", subject)
+	if subject != target {
+		text = fmt.Sprintf("DIO: %s (%s) regressed", subject, target)
+	}
+	return &Notification{
+		Text:        text + ": " + strings.Join(regressions, "; "),
+		Target:      target,
+		Subject:     subject,
+		FromRun:     d.From.ID,
+		ToRun:       d.To.ID,
+		Regressions: regressions,
+	}
+}
+
+// Notifier posts notifications to a webhook.
+type Notifier struct {
+	Webhook    string
+	HTTPClient *http.Client
+}
+
+// Notify sends n. It does nothing when no webhook is configured.
+func (nf *Notifier) Notify(n *Notification) error {
+	if nf.Webhook == "" {
+		return nil
+	}
+	client := nf.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(nf.Webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to send notification: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Package dashboard serves a single-page web UI over the run history:
+// recent runs, score/size/CVE trends per Dockerfile, run details and diffs
+// between runs.
+package dashboard
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/maxlar/docker-image-optimizer/internal/badge"
+	"github.com/maxlar/docker-image-optimizer/internal/history"
+)
+
+//go:embed static/index.html
+var indexHTML []byte
+
+// Handler returns the dashboard and its JSON API:
+//
+//	GET /                          the dashboard
+//	GET /api/runs[?dockerfile=]    run summaries, newest first
+//	GET /api/runs/{id}             the full report of a run
+//	GET /api/diff?from=ID&to=ID    changes between two runs
+//	GET /badge[?target=][&format=json]
+//	                               the badge of the latest run, as SVG or
+//	                               shields.io endpoint JSON
+func Handler(store *history.Store) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(indexHTML)
+	})
+
+	mux.HandleFunc("GET /api/runs", func(w http.ResponseWriter, r *http.Request) {
+		runs, err := store.List()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if dockerfile := r.URL.Query().Get("dockerfile"); dockerfile != "" {
+			filtered := runs[:0]
+			for _, run := range runs {
+				if run.Dockerfile == dockerfile {
+					filtered = append(filtered, run)
+				}
+			}
+			runs = filtered
+		}
+		if runs == nil {
+			runs = []history.Run{}
+		}
+		writeJSON(w, runs)
+	})
+
+	mux.HandleFunc("GET /api/runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		result, err := store.Load(r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, result)
+	})
+
+	mux.HandleFunc("GET /api/diff", func(w http.ResponseWriter, r *http.Request) {
+		fromID, toID := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+		from, err := store.Load(fromID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		to, err := store.Load(toID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, history.Compare(fromID, from, toID, to))
+	})
+
+	mux.HandleFunc("GET /badge", func(w http.ResponseWriter, r *http.Request) {
+		run, err := store.Latest(r.URL.Query().Get("target"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		b := badge.Unknown()
+		if run != nil {
+			result, err := store.Load(run.ID)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			b = badge.For(result)
+		}
+		// Keep GitHub's image proxy from serving a stale badge
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.URL.Query().Get("format") == "json" {
+			writeJSON(w, b.Endpoint())
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(b.SVG())
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError maps store errors to HTTP statuses: unknown runs are 404,
+// malformed IDs 400, anything else 500.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, history.ErrInvalidID):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
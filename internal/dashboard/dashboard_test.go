@@ -0,0 +1,73 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/history"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func TestHandler(t *testing.T) {
+	store := &history.Store{Dir: t.TempDir()}
+	for i, file := range []string{"api/Dockerfile", "web/Dockerfile"} {
+		if _, err := store.Save(&models.PipelineResult{
+			Timestamp:  time.Date(2024, 5, 1, i, 0, 0, 0, time.UTC),
+			Dockerfile: file,
+			Analysis:   &models.AnalysisResult{Score: 70},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(Handler(store))
+	defer srv.Close()
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(data)
+	}
+
+	if resp, body := get("/"); resp.StatusCode != http.StatusOK || !strings.Contains(body, "DIO Dashboard") {
+		t.Errorf("expected the dashboard page, got %d", resp.StatusCode)
+	}
+
+	_, body := get("/api/runs?dockerfile=web/Dockerfile")
+	var runs []history.Run
+	if err := json.Unmarshal([]byte(body), &runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Dockerfile != "web/Dockerfile" {
+		t.Fatalf("expected the web/Dockerfile run, got %+v", runs)
+	}
+
+	if resp, _ := get("/api/runs/" + runs[0].ID); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected run details, got %d", resp.StatusCode)
+	}
+	if resp, _ := get("/api/runs/nope"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a malformed ID, got %d", resp.StatusCode)
+	}
+	if resp, _ := get("/api/runs/20000101T000000.000000000Z"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown run, got %d", resp.StatusCode)
+	}
+
+	if resp, body := get("/badge?target=api/Dockerfile"); resp.Header.Get("Content-Type") != "image/svg+xml" || !strings.Contains(body, "70/100") {
+		t.Errorf("expected an SVG badge with the score, got %q", body)
+	}
+	_, body = get("/badge?target=none&format=json")
+	if !strings.Contains(body, `"message":"unknown"`) {
+		t.Errorf("expected an unknown endpoint badge, got %s", body)
+	}
+}
@@ -0,0 +1,269 @@
+// Package diagnose recognizes common causes of failed docker builds in the
+// build output and suggests targeted fixes, in particular for failures
+// introduced by autofix, such as a switch to an alpine or distroless base
+// or a USER instruction added before a step that writes to root-owned
+// files.
+package diagnose
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+var (
+	// BuildKit repeats the failing step as " > [stage 3/5] RUN ...:" and
+	// points at its line as "Dockerfile:12"
+	buildkitStepRegex = regexp.MustCompile(`(?m)^\s*> \[[^\]]+\] (.+?):?\s*$`)
+	buildkitLineRegex = regexp.MustCompile(`(?m)^\S+:(\d+)\s*\n-{5,}`)
+	// The legacy builder prints "Step 3/5 : RUN ..." before each step
+	legacyStepRegex = regexp.MustCompile(`(?m)^Step \d+/\d+ : (.+)$`)
+	// buildkitPrefix is the "#8 0.512 " prefix of BuildKit output lines
+	buildkitPrefix = regexp.MustCompile(`(?m)^#\d+ [\d.]+ `)
+
+	notFoundRegex       = regexp.MustCompile(`"([^"]+)": not found`)
+	legacyNotFoundRegex = regexp.MustCompile(`stat (\S+): file does not exist`)
+	apkMissingRegex     = regexp.MustCompile(`(?m)^\s*(\S+) \(no such package\)`)
+	aptMissingRegex     = regexp.MustCompile(`E: Unable to locate package (\S+)|E: Package '([^']+)' has no installation candidate`)
+	permissionRegex     = regexp.MustCompile(`(?i)permission denied|\bEACCES\b|operation not permitted`)
+	shNotFoundRegex     = regexp.MustCompile(`(?m)(?:^|\s)(?:/bin/)?(?:ba)?sh: (?:\d+: |line \d+: )?([^\s:]+): (?:command )?not found`)
+	execNotFoundRegex   = regexp.MustCompile(`exec: "([^"]+)": executable file not found`)
+	noShellRegex        = regexp.MustCompile(`"/bin/sh": stat /bin/sh: no such file or directory|/bin/sh: no such file or directory`)
+)
+
+// alpinePackages maps Debian package names to their Alpine equivalents.
+var alpinePackages = map[string]string{
+	"build-essential":            "build-base",
+	"libssl-dev":                 "openssl-dev",
+	"zlib1g-dev":                 "zlib-dev",
+	"libjpeg-dev":                "libjpeg-turbo-dev",
+	"libcurl4-openssl-dev":       "curl-dev",
+	"default-libmysqlclient-dev": "mariadb-dev",
+	"libmysqlclient-dev":         "mariadb-dev",
+	"netcat":                     "netcat-openbsd",
+	"dnsutils":                   "bind-tools",
+	"iputils-ping":               "iputils",
+	"libpq5":                     "libpq",
+	"python3-pip":                "py3-pip",
+	"xz-utils":                   "xz",
+}
+
+// failedStep is the instruction a build failed on.
+type failedStep struct {
+	line        int
+	instruction string
+}
+
+// Build diagnoses a failed build from its output. The Dockerfile and
+// build context are inspected to tell apart, for example, a file missing
+// from the context from one excluded by .dockerignore.
+func Build(output, dockerfilePath, contextDir string) []models.BuildDiagnosis {
+	output = buildkitPrefix.ReplaceAllString(output, "")
+	content, _ := os.ReadFile(dockerfilePath)
+	lines := strings.Split(string(content), "\n")
+	step := findStep(output, lines)
+
+	var diagnoses []models.BuildDiagnosis
+	add := func(cause, message, hint string) {
+		diagnoses = append(diagnoses, models.BuildDiagnosis{
+			Cause:       cause,
+			Line:        step.line,
+			Instruction: step.instruction,
+			Message:     message,
+			Hint:        hint,
+		})
+	}
+
+	if path := missingPath(output); path != "" {
+		add(models.CauseMissingFile, fmt.Sprintf("%s was not found", path), missingFileHint(path, step.instruction, contextDir))
+	}
+	if pkgs := matches(apkMissingRegex, output); len(pkgs) > 0 {
+		add(models.CausePackageNotFound, fmt.Sprintf("apk has no package %s", strings.Join(pkgs, ", ")), apkHint(pkgs))
+	}
+	if pkgs := matches(aptMissingRegex, output); len(pkgs) > 0 {
+		hint := "The package isn't in the release's repositories: check its name for this Debian/Ubuntu release (apt-cache search, packages.debian.org)."
+		if !strings.Contains(step.instruction, "apt-get update") && !strings.Contains(step.instruction, "apt update") {
+			hint = "Run apt-get update in the same RUN instruction as apt-get install: the package lists are not part of the base image, and an update in an earlier layer can be stale."
+		}
+		add(models.CausePackageNotFound, fmt.Sprintf("apt has no package %s", strings.Join(pkgs, ", ")), hint)
+	}
+	if noShellRegex.MatchString(output) {
+		add(models.CauseCommandNotFound, "the image has no /bin/sh",
+			"The base image has no shell, so shell-form RUN, CMD and ENTRYPOINT can't run. Distroless and scratch images need everything prepared in a build stage and copied in, and exec-form CMD/ENTRYPOINT.")
+	} else if cmds := append(matches(shNotFoundRegex, output), matches(execNotFoundRegex, output)...); len(cmds) > 0 {
+		add(models.CauseCommandNotFound, fmt.Sprintf("%s is not installed", strings.Join(cmds, ", ")), commandHint(cmds, baseImage(lines, step.line)))
+	}
+	if permissionRegex.MatchString(output) {
+		add(models.CausePermissionDenied, "permission denied", permissionHint(lines, step.line))
+	}
+	return diagnoses
+}
+
+// findStep locates the failing instruction and its Dockerfile line.
+func findStep(output string, lines []string) failedStep {
+	var step failedStep
+	if m := buildkitStepRegex.FindAllStringSubmatch(output, -1); m != nil {
+		step.instruction = m[len(m)-1][1]
+	} else if m := legacyStepRegex.FindAllStringSubmatch(output, -1); m != nil {
+		step.instruction = m[len(m)-1][1]
+	}
+	if m := buildkitLineRegex.FindStringSubmatch(output); m != nil {
+		fmt.Sscan(m[1], &step.line)
+	}
+	if step.line == 0 && step.instruction != "" {
+		want := strings.Join(strings.Fields(step.instruction), " ")
+		for i, line := range lines {
+			if strings.Join(strings.Fields(line), " ") == want {
+				step.line = i + 1
+				break
+			}
+		}
+	}
+	if step.instruction == "" && step.line > 0 && step.line <= len(lines) {
+		step.instruction = strings.TrimSpace(lines[step.line-1])
+	}
+	return step
+}
+
+// matches returns the distinct first non-empty submatches of re.
+func matches(re *regexp.Regexp, s string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, m := range re.FindAllStringSubmatch(s, -1) {
+		for _, g := range m[1:] {
+			if g != "" && !seen[g] {
+				seen[g] = true
+				result = append(result, g)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// missingPath returns the COPY or ADD source a build couldn't find.
+func missingPath(output string) string {
+	if !strings.Contains(output, "failed to compute cache key") && !strings.Contains(output, "COPY failed") &&
+		!strings.Contains(output, "failed to calculate checksum") && !strings.Contains(output, "ADD failed") {
+		return ""
+	}
+	if m := notFoundRegex.FindStringSubmatch(output); m != nil {
+		return m[1]
+	}
+	if m := legacyNotFoundRegex.FindStringSubmatch(output); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func missingFileHint(path, instruction, contextDir string) string {
+	if m := regexp.MustCompile(`--from=(\S+)`).FindStringSubmatch(instruction); m != nil {
+		return fmt.Sprintf("%s doesn't exist in %s: check where that stage writes it. Relative paths there are resolved against its WORKDIR.", path, m[1])
+	}
+	rel := strings.TrimPrefix(filepath.ToSlash(path), "/")
+	if contextDir == "" {
+		return "Source paths are relative to the build context, not to the Dockerfile. Check that the file exists there and that .dockerignore doesn't exclude it."
+	}
+	_, err := os.Stat(filepath.Join(contextDir, filepath.FromSlash(rel)))
+	switch {
+	case err == nil && analyzer.DockerignoreExcludes(contextDir, rel):
+		return fmt.Sprintf("%s exists but .dockerignore excludes it from the build context: remove the matching pattern or add !%s.", rel, rel)
+	case err == nil:
+		return fmt.Sprintf("%s exists in %s: check for a case mismatch or a symlink that points outside the build context.", rel, contextDir)
+	}
+	return fmt.Sprintf("%s doesn't exist in the build context %s. Source paths are relative to the context, not to the Dockerfile. Files produced by a build step must be copied from that stage with COPY --from.", rel, contextDir)
+}
+
+func apkHint(pkgs []string) string {
+	var renames []string
+	for _, pkg := range pkgs {
+		if alt, ok := alpinePackages[pkg]; ok {
+			renames = append(renames, pkg+" → "+alt)
+		}
+	}
+	hint := "Alpine package names often differ from Debian's; search https://pkgs.alpinelinux.org for this Alpine release."
+	if len(renames) > 0 {
+		sort.Strings(renames)
+		hint = "Use the Alpine names: " + strings.Join(renames, ", ") + ". " + hint
+	}
+	return hint
+}
+
+func commandHint(cmds []string, base string) string {
+	base = strings.ToLower(base)
+	switch {
+	case containsString(cmds, "bash") && strings.Contains(base, "alpine"):
+		return "Alpine has no bash: use sh, or add it with apk add --no-cache bash."
+	case strings.Contains(base, "alpine"):
+		return fmt.Sprintf("%s is not part of %s: install it with apk add --no-cache in an earlier RUN.", strings.Join(cmds, ", "), base)
+	case strings.Contains(base, "slim"):
+		return fmt.Sprintf("Slim images leave out many tools: install %s with apt-get in an earlier RUN, or use it only in a build stage.", strings.Join(cmds, ", "))
+	}
+	return fmt.Sprintf("Install %s in an earlier RUN, or use a base image that includes it. A base switched to a smaller variant may have dropped it.", strings.Join(cmds, ", "))
+}
+
+func permissionHint(lines []string, failing int) string {
+	user, line := activeUser(lines, failing)
+	if user == "" || analyzer.IsRootUser(user) {
+		return "A file lacks the needed permissions: make scripts executable with COPY --chmod=755 or chmod +x, and check ownership of the directories written to."
+	}
+	return fmt.Sprintf("This step runs as %s (USER on line %d), which can't write files and directories owned by root. Use COPY --chown=%s, create the directories and chown them before USER, or move USER after this step.", user, line, user)
+}
+
+// activeUser returns the USER in effect at a line of the Dockerfile, and
+// the line it was set on. Each FROM resets it.
+func activeUser(lines []string, failing int) (string, int) {
+	user, at := "", 0
+	for i, line := range lines {
+		if failing > 0 && i+1 >= failing {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FROM":
+			user, at = "", 0
+		case "USER":
+			if len(fields) > 1 {
+				user, at = fields[1], i+1
+			}
+		}
+	}
+	return user, at
+}
+
+// baseImage returns the base image of the stage containing a line.
+func baseImage(lines []string, failing int) string {
+	base := ""
+	for i, line := range lines {
+		if failing > 0 && i+1 > failing {
+			break
+		}
+		if fields := strings.Fields(line); len(fields) > 1 && strings.EqualFold(fields[0], "FROM") {
+			for _, f := range fields[1:] {
+				if !strings.HasPrefix(f, "--") {
+					base = f
+					break
+				}
+			}
+		}
+	}
+	return base
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package diagnose
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// writeContext creates a build context holding the given files.
+func writeContext(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuild_MissingFile(t *testing.T) {
+	dockerfile := "FROM node:20-alpine\nWORKDIR /app\nCOPY package.json .npmrc ./\nRUN npm ci\n"
+	output := `#7 [2/4] WORKDIR /app
+#7 CACHED
+#8 [3/4] COPY package.json .npmrc ./
+#8 ERROR: failed to calculate checksum of ref abc::def: "/.npmrc": not found
+------
+ > [3/4] COPY package.json .npmrc ./:
+------
+Dockerfile:3
+--------------------
+   1 |     FROM node:20-alpine
+   2 |     WORKDIR /app
+   3 | >>> COPY package.json .npmrc ./
+--------------------
+ERROR: failed to solve: failed to compute cache key: failed to calculate checksum of ref abc::def: "/.npmrc": not found
+`
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"absent", map[string]string{}, "doesn't exist in the build context"},
+		{"ignored", map[string]string{".npmrc": "x", ".dockerignore": ".npmrc\n"}, ".dockerignore excludes it"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.files["Dockerfile"] = dockerfile
+			dir := writeContext(t, tt.files)
+			got := Build(output, filepath.Join(dir, "Dockerfile"), dir)
+			if len(got) != 1 || got[0].Cause != models.CauseMissingFile {
+				t.Fatalf("expected one missing file diagnosis, got %+v", got)
+			}
+			if got[0].Line != 3 || got[0].Instruction != "COPY package.json .npmrc ./" {
+				t.Errorf("failing step = %d %q", got[0].Line, got[0].Instruction)
+			}
+			if !strings.Contains(got[0].Hint, tt.want) {
+				t.Errorf("hint %q doesn't mention %q", got[0].Hint, tt.want)
+			}
+		})
+	}
+
+	legacy := "Step 3/4 : COPY --from=build /src/dist /app\nCOPY failed: stat src/dist: file does not exist\n"
+	got := Build(legacy, "", "")
+	if len(got) != 1 || !strings.Contains(got[0].Hint, "doesn't exist in build") {
+		t.Errorf("expected a hint about the build stage, got %+v", got)
+	}
+}
+
+func TestBuild_PackageNotFound(t *testing.T) {
+	output := `#6 [2/3] RUN apk add --no-cache build-essential libssl-dev curl
+#6 0.412 fetch https://dl-cdn.alpinelinux.org/alpine/v3.19/main/x86_64/APKINDEX.tar.gz
+#6 1.203 ERROR: unable to select packages:
+#6 1.204   build-essential (no such package):
+#6 1.204     required by: world[build-essential]
+#6 1.204   libssl-dev (no such package):
+#6 1.204     required by: world[libssl-dev]
+#6 ERROR: process "/bin/sh -c apk add --no-cache build-essential libssl-dev curl" did not complete successfully: exit code: 2
+`
+	got := Build(output, "", "")
+	if len(got) != 1 || got[0].Cause != models.CausePackageNotFound {
+		t.Fatalf("expected one package diagnosis, got %+v", got)
+	}
+	if !strings.Contains(got[0].Hint, "build-essential → build-base, libssl-dev → openssl-dev") {
+		t.Errorf("hint %q doesn't map the Debian names", got[0].Hint)
+	}
+
+	got = Build("Step 2/3 : RUN apt-get install -y libfoo\nE: Unable to locate package libfoo\n", "", "")
+	if len(got) != 1 || !strings.Contains(got[0].Hint, "apt-get update in the same RUN") {
+		t.Errorf("expected an apt-get update hint, got %+v", got)
+	}
+}
+
+func TestBuild_PermissionDenied(t *testing.T) {
+	dir := writeContext(t, map[string]string{
+		"Dockerfile": "FROM python:3.12-slim\nUSER app\nWORKDIR /srv\nRUN pip install --no-cache-dir -r requirements.txt\n",
+	})
+	output := ` > [3/4] RUN pip install --no-cache-dir -r requirements.txt:
+0.812 ERROR: Could not install packages due to an OSError: [Errno 13] Permission denied: '/usr/local/lib/python3.12/site-packages/x'
+`
+	got := Build(output, filepath.Join(dir, "Dockerfile"), dir)
+	if len(got) != 1 || got[0].Cause != models.CausePermissionDenied {
+		t.Fatalf("expected one permission diagnosis, got %+v", got)
+	}
+	if got[0].Line != 4 || !strings.Contains(got[0].Hint, "runs as app (USER on line 2)") {
+		t.Errorf("unexpected diagnosis %+v", got[0])
+	}
+}
+
+func TestBuild_CommandNotFound(t *testing.T) {
+	dir := writeContext(t, map[string]string{
+		"Dockerfile": "FROM alpine:3.19\nCOPY build.sh .\nRUN bash build.sh\n",
+	})
+	got := Build(" > [3/3] RUN bash build.sh:\n0.215 /bin/sh: bash: not found\n", filepath.Join(dir, "Dockerfile"), dir)
+	if len(got) != 1 || got[0].Cause != models.CauseCommandNotFound || !strings.Contains(got[0].Hint, "Alpine has no bash") {
+		t.Errorf("expected an alpine bash hint, got %+v", got)
+	}
+
+	got = Build(`failed to create shim task: exec: "/bin/sh": stat /bin/sh: no such file or directory`, "", "")
+	if len(got) != 1 || !strings.Contains(got[0].Hint, "no shell") {
+		t.Errorf("expected a no-shell hint, got %+v", got)
+	}
+}
+
+func TestBuild_Unknown(t *testing.T) {
+	if got := Build("ERROR: failed to solve: rpc error: code = Unavailable\n", "", ""); len(got) != 0 {
+		t.Errorf("expected no diagnosis, got %+v", got)
+	}
+}
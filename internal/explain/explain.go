@@ -0,0 +1,225 @@
+// Package explain reconstructs an approximate Dockerfile from the history
+// of an image, for images whose Dockerfile is lost or third-party, and
+// analyzes it like a Dockerfile on disk.
+package explain
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/optimizer"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// unknownBase stands for a base image the history doesn't name.
+const unknownBase = "base"
+
+// Reconstruct rebuilds a Dockerfile from the history of image, oldest entry
+// first. base names the base image, and baseHistory, when known, tells
+// which entries are its. Without it, the entries up to the last CMD or
+// ENTRYPOINT that a layer follows are taken to be the base image's: base
+// images usually end with one.
+func Reconstruct(image string, history []models.HistoryEntry, base string, baseHistory []models.HistoryEntry) *models.ExplainResult {
+	result := &models.ExplainResult{Image: image, BaseImage: base}
+	result.BaseEntries = baseEntries(history, baseHistory)
+	for _, entry := range history[:result.BaseEntries] {
+		result.BaseSize += entry.Size
+	}
+
+	var lines []string
+	switch {
+	case base != "":
+		lines = append(lines, "FROM "+base)
+	case result.BaseEntries == 0:
+		lines = append(lines, "FROM scratch")
+	default:
+		lines = append(lines,
+			fmt.Sprintf("# The base image (%d history entries, %s) is not recorded in the image; name it with --base", result.BaseEntries, docker.HumanSize(result.BaseSize)),
+			"FROM "+unknownBase)
+	}
+	for _, entry := range history[result.BaseEntries:] {
+		command, text := analyzer.ParseCreatedBy(entry.CreatedBy)
+		if command == "" {
+			if entry.Size > 0 {
+				lines = append(lines, fmt.Sprintf("# A layer of %s with no recorded instruction", docker.HumanSize(entry.Size)))
+			}
+			continue
+		}
+		inst := command + " " + instructionArgs(command, text)
+		if entry.Size > 0 {
+			lines = append(lines, "# "+docker.HumanSize(entry.Size))
+			result.Layers = append(result.Layers, models.ExplainedLayer{Line: len(lines) + 1, Instruction: inst, Size: entry.Size})
+		}
+		lines = append(lines, inst)
+	}
+	result.Dockerfile = strings.Join(lines, "\n") + "\n"
+	return result
+}
+
+// baseEntries returns how many of the oldest history entries are the base
+// image's.
+func baseEntries(history, baseHistory []models.HistoryEntry) int {
+	if len(baseHistory) > 0 && len(baseHistory) <= len(history) {
+		matches := true
+		for i, entry := range baseHistory {
+			if entry.CreatedBy != history[i].CreatedBy {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return len(baseHistory)
+		}
+	}
+	n, layered := 0, false
+	for i := len(history) - 1; i >= 0; i-- {
+		command, _ := analyzer.ParseCreatedBy(history[i].CreatedBy)
+		if (command == "CMD" || command == "ENTRYPOINT") && layered {
+			n = i + 1
+			break
+		}
+		layered = layered || history[i].Size > 0
+	}
+	return n
+}
+
+var (
+	// quotedRegex matches a Go-quoted string, as history entries list the
+	// arguments of CMD, ENTRYPOINT, SHELL and HEALTHCHECK.
+	quotedRegex = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+	// checksumSourceRegex matches what the classic builder records for the
+	// sources of COPY and ADD: file:4f3c… in /app.
+	checksumSourceRegex = regexp.MustCompile(`^(\S+:\S+) in (\S+)\s*$`)
+	// exposedPortRegex matches a port of EXPOSE map[3000/tcp:{}].
+	exposedPortRegex = regexp.MustCompile(`(\d+/\w+):\{\}`)
+	// healthcheckRegex matches the test command of a recorded HEALTHCHECK,
+	// &{["CMD-SHELL" "curl -f http://localhost/"] "30s" …}.
+	healthcheckRegex = regexp.MustCompile(`^&\{\[((?:"(?:[^"\\]|\\.)*"\s*)*)\]`)
+)
+
+// instructionArgs turns the arguments of an instruction as the history
+// records them back into Dockerfile syntax.
+func instructionArgs(command, text string) string {
+	switch command {
+	case "CMD", "ENTRYPOINT", "SHELL":
+		if strings.HasPrefix(text, "[") {
+			return execForm(text)
+		}
+	case "HEALTHCHECK":
+		m := healthcheckRegex.FindStringSubmatch(text)
+		if m == nil {
+			return text
+		}
+		test := unquoteAll(m[1])
+		switch {
+		case len(test) == 0 || test[0] == "NONE":
+			return "NONE"
+		case test[0] == "CMD-SHELL" && len(test) > 1:
+			return "CMD " + test[1]
+		case test[0] == "CMD":
+			return "CMD " + jsonArray(test[1:])
+		}
+	case "EXPOSE":
+		if ports := exposedPortRegex.FindAllStringSubmatch(text, -1); len(ports) > 0 {
+			var list []string
+			for _, p := range ports {
+				list = append(list, p[1])
+			}
+			return strings.Join(list, " ")
+		}
+	case "VOLUME":
+		return strings.TrimSuffix(strings.TrimPrefix(text, "["), "]")
+	case "COPY", "ADD":
+		if m := checksumSourceRegex.FindStringSubmatch(text); m != nil {
+			return m[1] + " " + m[2]
+		}
+	}
+	return text
+}
+
+// execForm turns a list formatted with %q, ["node" "index.js"], into the
+// JSON of the exec form.
+func execForm(text string) string {
+	return jsonArray(unquoteAll(text))
+}
+
+// unquoteAll returns the Go-quoted strings in s.
+func unquoteAll(s string) []string {
+	var values []string
+	for _, q := range quotedRegex.FindAllString(s, -1) {
+		if v, err := strconv.Unquote(q); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// jsonArray formats values as a JSON array, with a space after the commas
+// as Dockerfiles usually write it.
+func jsonArray(values []string) string {
+	items := make([]string, len(values))
+	for i, v := range values {
+		b, _ := json.Marshal(v)
+		items[i] = string(b)
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// Analyze runs the analyzer on the reconstructed Dockerfile, with the
+// checks of the image config when cfg is set, and the optimizer in
+// suggest mode. Findings about an unnamed base image are left out: they
+// are about the placeholder.
+func Analyze(result *models.ExplainResult, a *analyzer.Analyzer, opt *optimizer.Optimizer, cfg *models.RuntimeConfig) error {
+	analysis, err := a.AnalyzeContent(result.Dockerfile)
+	if err != nil {
+		return err
+	}
+	analysis.Dockerfile = result.Image
+	if result.BaseImage == "" && result.BaseEntries > 0 {
+		from := fromLine(result.Dockerfile)
+		issues := analysis.Issues[:0]
+		for _, issue := range analysis.Issues {
+			if issue.Line != from {
+				issues = append(issues, issue)
+				continue
+			}
+			for i := range analysis.Stages {
+				if analysis.Stages[i].Name == issue.Stage {
+					analysis.Stages[i].Issues--
+				}
+			}
+		}
+		analysis.Issues = issues
+		analysis.Score = a.Score(issues)
+	}
+	// The image config checks may report at the FROM line what the base
+	// image sets
+	if cfg != nil {
+		if err := a.CheckImageContent(analysis, result.Dockerfile, cfg); err != nil {
+			return err
+		}
+	}
+	opts, err := opt.OptimizeContent(result.Dockerfile)
+	if err != nil {
+		return err
+	}
+	optimizer.LinkIssues(analysis, opts.Optimizations)
+	result.Analysis = analysis
+	result.Optimizations = opts
+	return nil
+}
+
+// fromLine returns the line of the first FROM of a Dockerfile.
+func fromLine(dockerfile string) int {
+	for i, line := range strings.Split(dockerfile, "\n") {
+		if strings.HasPrefix(line, "FROM ") {
+			return i + 1
+		}
+	}
+	return 0
+}
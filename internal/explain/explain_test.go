@@ -0,0 +1,107 @@
+package explain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/optimizer"
+)
+
+// nodeHistory is the history of an image built FROM a base image ending with
+// CMD ["bash"], oldest entry first.
+var nodeHistory = []models.HistoryEntry{
+	{CreatedBy: "/bin/sh -c #(nop) ADD file:4f3c2e1d in / ", Size: 80 << 20},
+	{CreatedBy: `/bin/sh -c #(nop)  CMD ["bash"]`},
+	{CreatedBy: "WORKDIR /app", Size: 0},
+	{CreatedBy: "COPY . . # buildkit", Size: 2 << 20},
+	{CreatedBy: "RUN /bin/sh -c apt-get update && apt-get install -y curl # buildkit", Size: 30 << 20},
+	{CreatedBy: "EXPOSE map[3000/tcp:{}]"},
+	{CreatedBy: `CMD ["node" "index.js"]`},
+}
+
+func TestReconstruct(t *testing.T) {
+	result := Reconstruct("app:1", nodeHistory, "", nil)
+	if result.BaseEntries != 2 || result.BaseSize != 80<<20 {
+		t.Errorf("expected 2 base entries of 80MB, got %d of %d", result.BaseEntries, result.BaseSize)
+	}
+	want := strings.Join([]string{
+		"# The base image (2 history entries, 80.0MB) is not recorded in the image; name it with --base",
+		"FROM base",
+		"WORKDIR /app",
+		"# 2.0MB",
+		"COPY . .",
+		"# 30.0MB",
+		"RUN apt-get update && apt-get install -y curl",
+		"EXPOSE 3000/tcp",
+		`CMD ["node", "index.js"]`,
+	}, "\n") + "\n"
+	if result.Dockerfile != want {
+		t.Errorf("unexpected Dockerfile:\n%s", result.Dockerfile)
+	}
+	if len(result.Layers) != 2 || result.Layers[1].Line != 7 || result.Layers[1].Size != 30<<20 {
+		t.Errorf("unexpected layers %+v", result.Layers)
+	}
+}
+
+func TestReconstruct_Base(t *testing.T) {
+	base := nodeHistory[:1]
+	result := Reconstruct("app:1", nodeHistory, "debian:bookworm", base)
+	if result.BaseEntries != 1 {
+		t.Errorf("expected the base history to mark 1 entry, got %d", result.BaseEntries)
+	}
+	if !strings.HasPrefix(result.Dockerfile, "FROM debian:bookworm\nCMD [\"bash\"]\n") {
+		t.Errorf("unexpected Dockerfile:\n%s", result.Dockerfile)
+	}
+
+	// A base history that isn't a prefix falls back to the heuristic
+	result = Reconstruct("app:1", nodeHistory, "alpine", []models.HistoryEntry{{CreatedBy: "ADD other in /"}})
+	if result.BaseEntries != 2 {
+		t.Errorf("expected 2 base entries, got %d", result.BaseEntries)
+	}
+}
+
+func TestInstructionArgs(t *testing.T) {
+	tests := []struct {
+		command, text, want string
+	}{
+		{"CMD", `["node" "index.js"]`, `["node", "index.js"]`},
+		{"ENTRYPOINT", `["/bin/sh" "-c" "echo \"hi\""]`, `["/bin/sh", "-c", "echo \"hi\""]`},
+		{"CMD", "node index.js", "node index.js"},
+		{"HEALTHCHECK", `&{["CMD-SHELL" "curl -f http://localhost/"] "30s" "5s" "0s" "0s" '\x00'}`, "CMD curl -f http://localhost/"},
+		{"HEALTHCHECK", `&{["CMD" "/healthcheck"] "0s" "0s" "0s" "0s" '\x00'}`, `CMD ["/healthcheck"]`},
+		{"HEALTHCHECK", `&{["NONE"] "0s" "0s" "0s" "0s" '\x00'}`, "NONE"},
+		{"EXPOSE", "map[80/tcp:{} 443/tcp:{}]", "80/tcp 443/tcp"},
+		{"VOLUME", "[/data]", "/data"},
+		{"COPY", "file:9a8b7c6d in /app/", "file:9a8b7c6d /app/"},
+		{"COPY", "--chown=node . .", "--chown=node . ."},
+	}
+	for _, tt := range tests {
+		if got := instructionArgs(tt.command, tt.text); got != tt.want {
+			t.Errorf("instructionArgs(%s, %s) = %q, want %q", tt.command, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	result := Reconstruct("app:1", nodeHistory, "", nil)
+	cfg := &models.RuntimeConfig{Image: "app:1", Cmd: []string{"node", "index.js"}}
+	if err := Analyze(result, analyzer.NewWithOptions(false), optimizer.New(optimizer.ModeSuggest), cfg); err != nil {
+		t.Fatal(err)
+	}
+	from := fromLine(result.Dockerfile)
+	found := false
+	for _, issue := range result.Analysis.Issues {
+		if issue.Line == from {
+			t.Errorf("unexpected issue %s about the unnamed base image", issue.ID)
+		}
+		found = found || issue.Line == 7
+	}
+	if !found {
+		t.Errorf("expected issues on the apt-get RUN, got %+v", result.Analysis.Issues)
+	}
+	if result.Analysis.Dockerfile != "app:1" || result.Analysis.Runtime != cfg || result.Optimizations == nil {
+		t.Errorf("unexpected analysis %+v", result.Analysis)
+	}
+}
@@ -0,0 +1,181 @@
+// Package fleet evaluates every image in a registry namespace and ranks
+// them by risk and size.
+package fleet
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/registry"
+)
+
+// Pattern selects images in a registry, e.g. "registry.corp/team/*" or
+// "registry.corp/team/api:v1.*". The repository and tag are globs; a
+// pattern without a tag selects "latest".
+type Pattern struct {
+	Registry string
+	Repo     string
+	Tag      string
+}
+
+// ParsePattern parses an image pattern.
+func ParsePattern(s string) (*Pattern, error) {
+	host, rest, ok := strings.Cut(s, "/")
+	if !ok || rest == "" || !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return nil, fmt.Errorf("invalid pattern %q, expected registry/namespace/* (e.g. registry.corp/team/*)", s)
+	}
+	p := &Pattern{Registry: host, Repo: rest, Tag: "latest"}
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		p.Repo, p.Tag = rest[:i], rest[i+1:]
+	}
+	for _, glob := range []string{p.Repo, p.Tag} {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", s, err)
+		}
+	}
+	return p, nil
+}
+
+func (p *Pattern) String() string {
+	return p.Registry + "/" + p.Repo + ":" + p.Tag
+}
+
+// Enumerate lists the images matching a pattern, sorted. The catalog is
+// only listed when the repository is a glob.
+func Enumerate(c *registry.Client, p *Pattern) ([]string, error) {
+	repos := []string{p.Repo}
+	if strings.ContainsAny(p.Repo, "*?[") {
+		all, err := c.Catalog(p.Registry)
+		if err != nil {
+			return nil, err
+		}
+		repos = repos[:0]
+		for _, repo := range all {
+			if ok, _ := path.Match(p.Repo, repo); ok {
+				repos = append(repos, repo)
+			}
+		}
+	}
+
+	var images []string
+	for _, repo := range repos {
+		tags, err := c.Tags(p.Registry, repo)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			if ok, _ := path.Match(p.Tag, tag); ok {
+				images = append(images, p.Registry+"/"+repo+":"+tag)
+			}
+		}
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// Evaluator inspects, scans and evaluates the policy of a single image.
+type Evaluator func(image string) (*models.PipelineResult, error)
+
+// Options controls a fleet scan.
+type Options struct {
+	// Concurrency is the number of images evaluated at once (default 4).
+	Concurrency int
+	// Dir stores the result of each evaluated image, so an interrupted
+	// scan can be resumed.
+	Dir string
+	// Resume reuses results already in Dir instead of re-evaluating.
+	Resume bool
+	// OnEntry is called, one at a time, as each image completes.
+	OnEntry func(Entry)
+}
+
+// Scan evaluates images with bounded concurrency and returns the ranked
+// fleet report. Failed evaluations are reported, not saved, so a resumed
+// scan retries them.
+func Scan(pattern string, images []string, eval Evaluator, opts Options) (*Report, error) {
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create fleet directory: %w", err)
+		}
+	}
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = 4
+	}
+
+	entries := make([]Entry, len(images))
+	var mu sync.Mutex
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				entry := evaluate(images[i], eval, opts)
+				entries[i] = entry
+				if opts.OnEntry != nil {
+					mu.Lock()
+					opts.OnEntry(entry)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range images {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	report := &Report{Pattern: pattern, Timestamp: time.Now(), Images: entries}
+	report.rank()
+	return report, nil
+}
+
+// evaluate returns the entry for one image, from a saved result when
+// resuming.
+func evaluate(image string, eval Evaluator, opts Options) Entry {
+	resultPath := ""
+	if opts.Dir != "" {
+		resultPath = filepath.Join(opts.Dir, models.Fingerprint(image)+".json")
+	}
+	if opts.Resume && resultPath != "" {
+		if result, err := loadResult(resultPath); err == nil {
+			entry := NewEntry(image, result)
+			entry.Resumed = true
+			return entry
+		}
+	}
+
+	result, err := eval(image)
+	if err != nil {
+		return Entry{Image: image, Error: err.Error()}
+	}
+	if resultPath != "" {
+		if data, err := json.Marshal(result); err == nil {
+			_ = os.WriteFile(resultPath, data, 0o644)
+		}
+	}
+	return NewEntry(image, result)
+}
+
+func loadResult(path string) (*models.PipelineResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var result models.PipelineResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,131 @@
+package fleet
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/registry"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		in        string
+		repo, tag string
+		wantErr   bool
+	}{
+		{"registry.corp/team/*", "team/*", "latest", false},
+		{"registry.corp/team/api:v1.*", "team/api", "v1.*", false},
+		{"localhost:5000/team/*:*", "team/*", "*", false},
+		{"team/*", "", "", true},
+		{"registry.corp/team/[", "", "", true},
+	}
+	for _, tt := range tests {
+		p, err := ParsePattern(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParsePattern(%q): expected an error", tt.in)
+			}
+			continue
+		}
+		if err != nil || p.Repo != tt.repo || p.Tag != tt.tag {
+			t.Errorf("ParsePattern(%q) = %+v, %v; want repo %q tag %q", tt.in, p, err, tt.repo, tt.tag)
+		}
+	}
+}
+
+func TestEnumerate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			fmt.Fprint(w, `{"token":"t"}`)
+		case r.Header.Get("Authorization") != "Bearer t":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="test"`, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/_catalog" && r.URL.Query().Get("last") == "":
+			// First page links to the second
+			w.Header().Set("Link", `</v2/_catalog?last=team%2Fapi&n=100>; rel="next"`)
+			fmt.Fprint(w, `{"repositories":["other/app","team/api"]}`)
+		case r.URL.Path == "/v2/_catalog":
+			fmt.Fprint(w, `{"repositories":["team/web","team/web/nested"]}`)
+		case strings.HasSuffix(r.URL.Path, "/tags/list"):
+			fmt.Fprint(w, `{"tags":["latest","v1.0","v1.1"]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	p, err := ParsePattern(host + "/team/*:v1.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := Enumerate(&registry.Client{}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{host + "/team/api:v1.0", host + "/team/api:v1.1", host + "/team/web:v1.0", host + "/team/web:v1.1"}
+	if !reflect.DeepEqual(images, want) {
+		t.Errorf("Enumerate = %v, want %v", images, want)
+	}
+}
+
+func TestScan_RankAndResume(t *testing.T) {
+	results := map[string]*models.PipelineResult{
+		"r/small-risky:1": {
+			BaselineImage: &models.ImageMetrics{Size: 10},
+			ScanResult:    &models.ScanResult{CriticalCount: 2},
+			Policy:        &models.PolicyResult{Passed: false, Rules: []models.PolicyRule{{Name: "max_critical_cves", Enforcement: models.EnforcementDeny}}},
+		},
+		"r/big-clean:1":   {BaselineImage: &models.ImageMetrics{Size: 900}, ScanResult: &models.ScanResult{}, Policy: &models.PolicyResult{Passed: true}},
+		"r/small-clean:1": {BaselineImage: &models.ImageMetrics{Size: 20}, ScanResult: &models.ScanResult{}, Policy: &models.PolicyResult{Passed: true}},
+	}
+	images := []string{"r/big-clean:1", "r/broken:1", "r/small-clean:1", "r/small-risky:1"}
+	var evaluated []string
+	eval := func(image string) (*models.PipelineResult, error) {
+		evaluated = append(evaluated, image)
+		if result, ok := results[image]; ok {
+			return result, nil
+		}
+		return nil, errors.New("pull failed")
+	}
+
+	dir := t.TempDir()
+	report, err := Scan("r/*", images, eval, Options{Concurrency: 1, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, e := range report.Images {
+		order = append(order, e.Image)
+	}
+	want := []string{"r/small-risky:1", "r/big-clean:1", "r/small-clean:1", "r/broken:1"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("ranking = %v, want %v", order, want)
+	}
+	if top := report.Images[0]; top.Risk != 2*riskCritical+riskPolicyFailed || len(top.FailedRules) != 1 {
+		t.Errorf("unexpected risk entry %+v", top)
+	}
+	if failed, errs := report.Counts(); failed != 1 || errs != 1 {
+		t.Errorf("expected 1 failing and 1 erroring image, got %d and %d", failed, errs)
+	}
+
+	// Resuming only retries the image that failed to evaluate
+	evaluated = nil
+	report, err = Scan("r/*", images, eval, Options{Concurrency: 2, Dir: dir, Resume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(evaluated, []string{"r/broken:1"}) {
+		t.Errorf("expected only r/broken:1 to be re-evaluated, got %v", evaluated)
+	}
+	if !strings.Contains(report.Markdown(), "| 1 | `r/small-risky:1` | 40 |") {
+		t.Errorf("expected the riskiest image first in the markdown report:\n%s", report.Markdown())
+	}
+}
@@ -0,0 +1,138 @@
+package fleet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/reporter"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// Risk weights. A failed deny rule weighs as much as two critical CVEs.
+const (
+	riskCritical     = 10
+	riskHigh         = 5
+	riskMedium       = 1
+	riskPolicyFailed = 20
+)
+
+// Entry is one image in the fleet report.
+type Entry struct {
+	Image        string   `json:"image"`
+	Risk         int      `json:"risk"`
+	Size         int64    `json:"size"`
+	Layers       int      `json:"layers"`
+	Critical     int      `json:"critical"`
+	High         int      `json:"high"`
+	Medium       int      `json:"medium"`
+	Low          int      `json:"low"`
+	Scanned      bool     `json:"scanned"`
+	PolicyPassed bool     `json:"policy_passed"`
+	FailedRules  []string `json:"failed_rules,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Resumed      bool     `json:"-"` // loaded from a previous, interrupted scan
+}
+
+// NewEntry summarizes an image's evaluation and computes its risk score.
+func NewEntry(image string, result *models.PipelineResult) Entry {
+	e := Entry{Image: image, PolicyPassed: true}
+	if img := result.FinalImage(); img != nil {
+		e.Size, e.Layers = img.Size, img.Layers
+	}
+	if scan := result.FinalScan(); scan != nil {
+		e.Scanned = true
+		e.Critical, e.High = scan.CriticalCount, scan.HighCount
+		e.Medium, e.Low = scan.MediumCount, scan.LowCount
+	}
+	if result.Policy != nil {
+		e.PolicyPassed = result.Policy.Passed
+		for _, rule := range result.Policy.Rules {
+			if !rule.Passed && rule.Enforcement == models.EnforcementDeny {
+				e.FailedRules = append(e.FailedRules, rule.Name)
+			}
+		}
+	}
+
+	e.Risk = e.Critical*riskCritical + e.High*riskHigh + e.Medium*riskMedium
+	if !e.PolicyPassed {
+		e.Risk += riskPolicyFailed
+	}
+	return e
+}
+
+// Report is the result of a fleet scan.
+type Report struct {
+	Pattern   string    `json:"pattern"`
+	Timestamp time.Time `json:"timestamp"`
+	Images    []Entry   `json:"images"` // riskiest first
+}
+
+// rank sorts images by risk, then size, largest first. Images that could
+// not be evaluated go last.
+func (r *Report) rank() {
+	sort.SliceStable(r.Images, func(i, j int) bool {
+		a, b := r.Images[i], r.Images[j]
+		if (a.Error == "") != (b.Error == "") {
+			return a.Error == ""
+		}
+		if a.Risk != b.Risk {
+			return a.Risk > b.Risk
+		}
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Image < b.Image
+	})
+}
+
+// Counts returns the number of images that failed policy and that could
+// not be evaluated.
+func (r *Report) Counts() (failed, errors int) {
+	for _, e := range r.Images {
+		switch {
+		case e.Error != "":
+			errors++
+		case !e.PolicyPassed:
+			failed++
+		}
+	}
+	return failed, errors
+}
+
+// Markdown renders the report as a ranked table.
+func (r *Report) Markdown() string {
+	var sb strings.Builder
+	failed, errors := r.Counts()
+	var total int64
+	for _, e := range r.Images {
+		total += e.Size
+	}
+
+	sb.WriteString("# 🚢 DIO Fleet Report\n\n")
+	fmt.Fprintf(&sb, "**Pattern:** `%s`  \n", r.Pattern)
+	fmt.Fprintf(&sb, "**Generated:** %s  \n", r.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&sb, "**Images:** %d (%d failing policy, %d not evaluated), %s in total\n\n",
+		len(r.Images), failed, errors, docker.HumanSize(total))
+
+	sb.WriteString("| # | Image | Risk | Size | Critical | High | Medium | Low | Policy |\n")
+	sb.WriteString("|---|-------|------|------|----------|------|--------|-----|--------|\n")
+	for i, e := range r.Images {
+		if e.Error != "" {
+			fmt.Fprintf(&sb, "| %d | `%s` | — | — | — | — | — | — | ⚠️ %s |\n", i+1, e.Image, reporter.MarkdownCell(e.Error))
+			continue
+		}
+		cves := "— | — | — | —"
+		if e.Scanned {
+			cves = fmt.Sprintf("%d | %d | %d | %d", e.Critical, e.High, e.Medium, e.Low)
+		}
+		status := "✅"
+		if !e.PolicyPassed {
+			status = "❌ " + strings.Join(e.FailedRules, ", ")
+		}
+		fmt.Fprintf(&sb, "| %d | `%s` | %d | %s | %s | %s |\n", i+1, e.Image, e.Risk, docker.HumanSize(e.Size), cves, status)
+	}
+	return sb.String()
+}
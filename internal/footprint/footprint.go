@@ -0,0 +1,79 @@
+// Package footprint estimates the energy and emissions an image size
+// reduction saves in registry transfers and storage. The estimate is only
+// as good as its coefficients; the defaults are conservative published
+// averages, and organizations with their own figures should set them.
+package footprint
+
+import (
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// gb is the unit the coefficients are given in.
+const gb = 1 << 30
+
+// DaysPerMonth is the length of the month energy is computed for.
+const DaysPerMonth = 30
+
+// Default coefficients.
+const (
+	// DefaultTransferKWhPerGB is the network energy of moving a GB, the
+	// Cloud Carbon Footprint methodology's figure.
+	DefaultTransferKWhPerGB = 0.001
+	// DefaultStorageKWhPerGB is the energy of storing a GB for a month on
+	// hard disks (0.65 Wh per TB-hour) with three replicas, as object
+	// storage keeps them.
+	DefaultStorageKWhPerGB = 0.0014
+	// DefaultGridIntensity is the average carbon intensity of electricity
+	// worldwide, in gCO2e per kWh.
+	DefaultGridIntensity = 475
+)
+
+// Coefficients convert the size reduction into energy and emissions.
+type Coefficients struct {
+	// PullsPerDay is how often the image is pulled.
+	PullsPerDay float64
+	// TransferKWhPerGB is the energy of transferring a GB (default:
+	// DefaultTransferKWhPerGB).
+	TransferKWhPerGB float64
+	// StorageKWhPerGB is the energy of storing a GB for a month (default:
+	// DefaultStorageKWhPerGB).
+	StorageKWhPerGB float64
+	// GridIntensity is the carbon intensity of the electricity in gCO2e
+	// per kWh (default: DefaultGridIntensity).
+	GridIntensity float64
+}
+
+// withDefaults fills in the coefficients left unset.
+func (c Coefficients) withDefaults() Coefficients {
+	if c.TransferKWhPerGB == 0 {
+		c.TransferKWhPerGB = DefaultTransferKWhPerGB
+	}
+	if c.StorageKWhPerGB == 0 {
+		c.StorageKWhPerGB = DefaultStorageKWhPerGB
+	}
+	if c.GridIntensity == 0 {
+		c.GridIntensity = DefaultGridIntensity
+	}
+	return c
+}
+
+// Estimate returns the monthly energy and emissions of an image sizeDiff
+// smaller, as returned by PipelineResult.SizeReduction: stored once, and
+// pulled PullsPerDay times a day.
+func Estimate(sizeDiff int64, compressed bool, c Coefficients) *models.Footprint {
+	c = c.withDefaults()
+	diffGB := float64(sizeDiff) / gb
+	fp := &models.Footprint{
+		SizeDiff:         sizeDiff,
+		Compressed:       compressed,
+		PullsPerDay:      c.PullsPerDay,
+		TransferKWhPerGB: c.TransferKWhPerGB,
+		StorageKWhPerGB:  c.StorageKWhPerGB,
+		GridIntensity:    c.GridIntensity,
+		TransferKWh:      diffGB * c.PullsPerDay * DaysPerMonth * c.TransferKWhPerGB,
+		StorageKWh:       diffGB * c.StorageKWhPerGB,
+	}
+	fp.TotalKWh = fp.TransferKWh + fp.StorageKWh
+	fp.CO2eKg = fp.TotalKWh * c.GridIntensity / 1000
+	return fp
+}
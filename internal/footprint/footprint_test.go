@@ -0,0 +1,29 @@
+package footprint
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	// 0.5 GB pulled 1000 times a day for 30 days and stored once
+	fp := Estimate(512<<20, true, Coefficients{PullsPerDay: 1000})
+	if !fp.Compressed || fp.GridIntensity != DefaultGridIntensity {
+		t.Fatalf("Estimate = %+v, want the default coefficients", fp)
+	}
+	for name, c := range map[string][2]float64{
+		"transfer": {fp.TransferKWh, 15},
+		"storage":  {fp.StorageKWh, 0.0007},
+		"total":    {fp.TotalKWh, 15.0007},
+		"co2e":     {fp.CO2eKg, 15.0007 * 0.475},
+	} {
+		if math.Abs(c[0]-c[1]) > 1e-9 {
+			t.Errorf("%s = %v, want %v", name, c[0], c[1])
+		}
+	}
+
+	fp = Estimate(1<<30, false, Coefficients{PullsPerDay: 10, TransferKWhPerGB: 0.01, StorageKWhPerGB: 0.1, GridIntensity: 100})
+	if math.Abs(fp.TotalKWh-3.1) > 1e-9 || math.Abs(fp.CO2eKg-0.31) > 1e-9 {
+		t.Errorf("Estimate with custom coefficients = %+v, want 3.1 kWh and 0.31 kg", fp)
+	}
+}
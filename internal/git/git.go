@@ -0,0 +1,187 @@
+// Package git reads the revision a Dockerfile is evaluated at from the
+// enclosing git repository, so that a report can be traced back to the
+// exact source it came from, and the files a branch changed, and pushes
+// the changes dio makes to a branch of their own. It runs the git CLI.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// branchEnv are the variables CI systems set to the branch they build,
+// for the detached HEAD they usually check out. The first one set wins.
+var branchEnv = []string{
+	"GITHUB_HEAD_REF",        // GitHub Actions, pull requests
+	"GITHUB_REF_NAME",        // GitHub Actions
+	"CI_COMMIT_REF_NAME",     // GitLab CI
+	"BUILDKITE_BRANCH",       // Buildkite
+	"CIRCLE_BRANCH",          // CircleCI
+	"BRANCH_NAME",            // Jenkins multibranch
+	"BITBUCKET_BRANCH",       // Bitbucket Pipelines
+	"BUILD_SOURCEBRANCHNAME", // Azure Pipelines
+}
+
+// Detect returns the git metadata of the repository containing path, a
+// Dockerfile, or nil when path is not in a git work tree or git is not
+// installed.
+func Detect(path string) *models.GitInfo {
+	dir := filepath.Dir(path)
+	commit, err := run(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil
+	}
+	info := &models.GitInfo{Commit: commit}
+
+	if branch, err := run(dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+		info.Branch = branch
+	} else {
+		for _, name := range branchEnv {
+			if v := os.Getenv(name); v != "" {
+				info.Branch = v
+				break
+			}
+		}
+	}
+	// Untracked files, such as reports written into the work tree, don't
+	// change what was built
+	if status, err := run(dir, "status", "--porcelain", "--untracked-files=no"); err == nil {
+		info.Dirty = status != ""
+	}
+
+	if out, err := run(dir, "blame", "--line-porcelain", "--", filepath.Base(path)); err == nil {
+		info.DockerfileChanged, info.DockerfileOldestLine = blameRange(out)
+	}
+	return info
+}
+
+// Changed returns the files a branch changed since it forked from base,
+// as absolute paths: the differences between the merge base of base and
+// HEAD and the work tree, so uncommitted changes count, and untracked
+// files. dir is any directory of the repository.
+func Changed(dir, base string) ([]string, error) {
+	root, err := run(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in a git work tree", dir)
+	}
+	mergeBase, err := run(root, "merge-base", base, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("no common ancestor of %s and HEAD (is %s fetched?)", base, base)
+	}
+	// Without rename detection, a moved file changes both locations
+	diff, err := run(root, "diff", "--name-only", "--no-renames", mergeBase)
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s: %w", base, err)
+	}
+	untracked, err := run(root, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+	var files []string
+	for _, name := range strings.Split(diff+"\n"+untracked, "\n") {
+		if name != "" {
+			files = append(files, filepath.Join(root, filepath.FromSlash(name)))
+		}
+	}
+	return files, nil
+}
+
+// Modified reports whether the file at path has uncommitted changes.
+func Modified(path string) (bool, error) {
+	status, err := run(filepath.Dir(path), "status", "--porcelain", "--", filepath.Base(path))
+	if err != nil {
+		return false, err
+	}
+	return status != "", nil
+}
+
+// PushBranch commits the changes to paths, files of the repository
+// containing dir, to a new branch and pushes it to remote. Other staged
+// changes are left out of the commit. The work tree returns to the branch
+// or commit it was on, without the changes.
+func PushBranch(dir, remote, branch, message string, paths ...string) (err error) {
+	original, err := run(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return fmt.Errorf("%s is not in a git work tree", dir)
+	}
+	if original == "HEAD" {
+		if original, err = run(dir, "rev-parse", "HEAD"); err != nil {
+			return err
+		}
+	}
+	if _, err := run(dir, "checkout", "-q", "-b", branch); err != nil {
+		return fmt.Errorf("git checkout -b %s: %w", branch, err)
+	}
+	defer func() {
+		if _, cerr := run(dir, "checkout", "-q", original); cerr != nil && err == nil {
+			err = fmt.Errorf("git checkout %s: %w", original, cerr)
+		}
+	}()
+	if _, err := run(dir, append([]string{"add", "--"}, paths...)...); err != nil {
+		return fmt.Errorf("git add: %w", err)
+	}
+	// Only paths: changes the user staged stay out of the commit
+	if _, err := run(dir, append([]string{"commit", "-q", "-m", message, "--"}, paths...)...); err != nil {
+		return fmt.Errorf("git commit: %w", err)
+	}
+	if _, err := run(dir, "push", "-q", "-u", remote, branch); err != nil {
+		return fmt.Errorf("git push %s %s: %w", remote, branch, err)
+	}
+	return nil
+}
+
+// blameRange returns the newest and the oldest author time of the lines
+// in git blame --line-porcelain output. Uncommitted lines count as changed
+// now.
+func blameRange(out string) (newest, oldest *time.Time) {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "author-time ")
+		if !ok {
+			continue
+		}
+		sec, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		t := time.Unix(sec, 0).UTC()
+		if newest == nil || t.After(*newest) {
+			newest = &t
+		}
+		if oldest == nil || t.Before(*oldest) {
+			oldest = &t
+		}
+	}
+	return newest, oldest
+}
+
+// CommitTime returns the Unix time of the last commit of the repository
+// containing path, a Dockerfile, the usual SOURCE_DATE_EPOCH of its builds.
+func CommitTime(path string) (string, error) {
+	return run(filepath.Dir(path), "log", "-1", "--format=%ct")
+}
+
+// run runs git in dir and returns its trimmed output. Errors carry what
+// git printed to stderr.
+func run(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
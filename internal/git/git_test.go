@@ -0,0 +1,211 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// gitCmd runs git in dir with a fixed identity and commit dates.
+func gitCmd(t *testing.T, dir, date string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=dio", "-c", "user.email=dio@example.com"}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Dockerfile")
+	gitCmd(t, dir, "2024-01-02T00:00:00Z", "init", "-q", "-b", "main")
+	if err := os.WriteFile(path, []byte("FROM alpine:3.19\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "2024-01-02T00:00:00Z", "add", "Dockerfile")
+	gitCmd(t, dir, "2024-01-02T00:00:00Z", "commit", "-q", "-m", "base")
+	if err := os.WriteFile(path, []byte("FROM alpine:3.19\nUSER app\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "2024-03-04T00:00:00Z", "commit", "-q", "-am", "user")
+
+	info := Detect(path)
+	if info == nil {
+		t.Fatal("expected git metadata")
+	}
+	if len(info.Commit) != 40 || info.Branch != "main" || info.Dirty {
+		t.Errorf("Detect = %+v, want a clean checkout of main", info)
+	}
+	if info.DockerfileChanged == nil || !info.DockerfileChanged.Equal(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("DockerfileChanged = %v, want 2024-03-04", info.DockerfileChanged)
+	}
+	if info.DockerfileOldestLine == nil || !info.DockerfileOldestLine.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("DockerfileOldestLine = %v, want 2024-01-02", info.DockerfileOldestLine)
+	}
+
+	// Untracked files don't make the checkout dirty, changes do
+	if err := os.WriteFile(filepath.Join(dir, "report.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if Detect(path).Dirty {
+		t.Error("untracked files should not make the checkout dirty")
+	}
+	if err := os.WriteFile(path, []byte("FROM alpine:3.20\nUSER app\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !Detect(path).Dirty {
+		t.Error("a changed Dockerfile should make the checkout dirty")
+	}
+
+	if Detect(filepath.Join(t.TempDir(), "Dockerfile")) != nil {
+		t.Error("expected no metadata outside a git repository")
+	}
+}
+
+func TestChanged(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const date = "2024-01-02T00:00:00Z"
+	gitCmd(t, dir, date, "init", "-q", "-b", "main")
+	write("api/Dockerfile", "FROM alpine:3.19\n")
+	write("web/Dockerfile", "FROM nginx:1.27\n")
+	write("web/index.html", "<h1>hi</h1>\n")
+	gitCmd(t, dir, date, "add", ".")
+	gitCmd(t, dir, date, "commit", "-q", "-m", "base")
+
+	gitCmd(t, dir, date, "checkout", "-q", "-b", "feature")
+	write("web/index.html", "<h1>hello</h1>\n")
+	gitCmd(t, dir, date, "commit", "-q", "-am", "greeting")
+	// Untracked files count too
+	write("api/main.go", "package main\n")
+	gitCmd(t, dir, date, "checkout", "-q", "main")
+	write("api/Dockerfile", "FROM alpine:3.20\n")
+	gitCmd(t, dir, date, "commit", "-q", "-am", "bump on main")
+	gitCmd(t, dir, date, "checkout", "-q", "feature")
+
+	files, err := Changed(filepath.Join(dir, "web"), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := filepath.EvalSymlinks(dir)
+	want := []string{filepath.Join(root, "web/index.html"), filepath.Join(root, "api/main.go")}
+	if len(files) != len(want) {
+		t.Fatalf("Changed = %v, want %v (changes on main are not the branch's)", files, want)
+	}
+	for i := range want {
+		if got, _ := filepath.EvalSymlinks(files[i]); got != want[i] {
+			t.Errorf("Changed[%d] = %s, want %s", i, files[i], want[i])
+		}
+	}
+
+	if _, err := Changed(dir, "no-such-ref"); err == nil {
+		t.Error("expected an error for an unknown base")
+	}
+}
+
+func TestPushBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	const date = "2024-01-02T00:00:00Z"
+	remote, dir := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "Dockerfile")
+	gitCmd(t, remote, date, "init", "-q", "--bare")
+	gitCmd(t, dir, date, "init", "-q", "-b", "main")
+	gitCmd(t, dir, date, "remote", "add", "origin", remote)
+	if err := os.WriteFile(path, []byte("FROM alpine:3.19\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, date, "add", "Dockerfile")
+	gitCmd(t, dir, date, "commit", "-q", "-m", "base")
+	if modified, err := Modified(path); err != nil || modified {
+		t.Fatalf("Modified = %v, %v; want a clean Dockerfile", modified, err)
+	}
+
+	if err := os.WriteFile(path, []byte("FROM alpine:3.20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if modified, _ := Modified(path); !modified {
+		t.Error("expected the rewritten Dockerfile to be modified")
+	}
+	// The committer identity comes from the environment
+	t.Setenv("GIT_AUTHOR_NAME", "dio")
+	t.Setenv("GIT_AUTHOR_EMAIL", "dio@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "dio")
+	t.Setenv("GIT_COMMITTER_EMAIL", "dio@example.com")
+	if err := PushBranch(dir, "origin", "dio/update", "Bump alpine", path); err != nil {
+		t.Fatal(err)
+	}
+
+	if branch, _ := run(dir, "rev-parse", "--abbrev-ref", "HEAD"); branch != "main" {
+		t.Errorf("expected to be back on main, got %s", branch)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "FROM alpine:3.19\n" {
+		t.Errorf("expected main's Dockerfile back, got %q", content)
+	}
+	if pushed, err := run(remote, "show", "dio/update:Dockerfile"); err != nil || pushed != "FROM alpine:3.20" {
+		t.Errorf("expected the change on the pushed branch, got %q, %v", pushed, err)
+	}
+
+	if err := PushBranch(dir, "origin", "dio/update", "Bump alpine", path); err == nil {
+		t.Error("expected an error for an existing branch")
+	}
+}
+
+func TestPushBranch_StagedChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	const date = "2024-01-02T00:00:00Z"
+	remote, dir := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "Dockerfile")
+	gitCmd(t, remote, date, "init", "-q", "--bare")
+	gitCmd(t, dir, date, "init", "-q", "-b", "main")
+	gitCmd(t, dir, date, "remote", "add", "origin", remote)
+	if err := os.WriteFile(path, []byte("FROM alpine:3.19\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, date, "add", "Dockerfile")
+	gitCmd(t, dir, date, "commit", "-q", "-m", "base")
+
+	// Work in progress the user staged before running dio update
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("wip\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, date, "add", "notes.txt")
+	if err := os.WriteFile(path, []byte("FROM alpine:3.20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "dio")
+	t.Setenv("GIT_AUTHOR_EMAIL", "dio@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "dio")
+	t.Setenv("GIT_COMMITTER_EMAIL", "dio@example.com")
+	if err := PushBranch(dir, "origin", "dio/update", "Bump alpine", path); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, err := run(remote, "ls-tree", "--name-only", "dio/update"); err != nil || files != "Dockerfile" {
+		t.Errorf("expected only the Dockerfile on the pushed branch, got %q, %v", files, err)
+	}
+	if staged, _ := run(dir, "diff", "--cached", "--name-only"); staged != "notes.txt" {
+		t.Errorf("expected notes.txt to stay staged, got %q", staged)
+	}
+}
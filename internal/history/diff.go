@@ -0,0 +1,138 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Diff describes what changed between two runs. Issues and vulnerabilities
+// are matched by fingerprint, so findings that only moved to another line
+// are neither added nor resolved.
+type Diff struct {
+	From           Run                    `json:"from"`
+	To             Run                    `json:"to"`
+	ScoreDelta     int                    `json:"score_delta"`
+	SizeDelta      int64                  `json:"size_delta"`
+	NewIssues      []models.Issue         `json:"new_issues"`
+	ResolvedIssues []models.Issue         `json:"resolved_issues"`
+	NewCVEs        []models.Vulnerability `json:"new_cves"`
+	ResolvedCVEs   []models.Vulnerability `json:"resolved_cves"`
+}
+
+// Compare diffs two recorded runs, from the older to the newer.
+func Compare(fromID string, from *models.PipelineResult, toID string, to *models.PipelineResult) *Diff {
+	d := &Diff{
+		From:           Summarize(fromID, from),
+		To:             Summarize(toID, to),
+		NewIssues:      []models.Issue{},
+		ResolvedIssues: []models.Issue{},
+		NewCVEs:        []models.Vulnerability{},
+		ResolvedCVEs:   []models.Vulnerability{},
+	}
+	d.ScoreDelta = d.To.Score - d.From.Score
+	if d.From.Size > 0 && d.To.Size > 0 {
+		d.SizeDelta = d.To.Size - d.From.Size
+	}
+
+	fromIssues, toIssues := issuesOf(from), issuesOf(to)
+	d.NewIssues = append(d.NewIssues, missingIssues(toIssues, fromIssues)...)
+	d.ResolvedIssues = append(d.ResolvedIssues, missingIssues(fromIssues, toIssues)...)
+
+	fromCVEs, toCVEs := vulnerabilitiesOf(from), vulnerabilitiesOf(to)
+	d.NewCVEs = append(d.NewCVEs, missingVulnerabilities(toCVEs, fromCVEs)...)
+	d.ResolvedCVEs = append(d.ResolvedCVEs, missingVulnerabilities(fromCVEs, toCVEs)...)
+	return d
+}
+
+// sizeRegressionPct is how much the image may grow between runs before it
+// counts as a regression.
+const sizeRegressionPct = 10
+
+// Regressions describes what got worse between the runs: the policy
+// starting to fail, new critical or high CVEs, a lower score or an image
+// that grew by more than 10%. It is empty when nothing regressed.
+func (d *Diff) Regressions() []string {
+	var regressions []string
+	if d.From.Passed && !d.To.Passed {
+		regressions = append(regressions, "policy checks now fail")
+	}
+	var cves []string
+	for _, v := range d.NewCVEs {
+		if v.Severity == models.SeverityCritical || v.Severity == models.SeverityHigh {
+			cves = append(cves, v.ID)
+		}
+	}
+	if len(cves) > 0 {
+		regressions = append(regressions, fmt.Sprintf("%d new critical/high CVE(s): %s", len(cves), strings.Join(cves, ", ")))
+	}
+	if d.ScoreDelta < 0 {
+		regressions = append(regressions, fmt.Sprintf("score dropped from %d to %d", d.From.Score, d.To.Score))
+	}
+	if d.SizeDelta*100 > d.From.Size*sizeRegressionPct {
+		regressions = append(regressions, fmt.Sprintf("image grew by %.1f%%", float64(d.SizeDelta)*100/float64(d.From.Size)))
+	}
+	return regressions
+}
+
+func issuesOf(result *models.PipelineResult) []models.Issue {
+	if result.Analysis == nil {
+		return nil
+	}
+	return result.Analysis.Issues
+}
+
+func vulnerabilitiesOf(result *models.PipelineResult) []models.Vulnerability {
+	if scan := result.FinalScan(); scan != nil {
+		return scan.Vulnerabilities
+	}
+	return nil
+}
+
+// issueKey identifies an issue across runs. Reports recorded before
+// fingerprints existed fall back to the rule ID and line.
+func issueKey(issue models.Issue) string {
+	if issue.Fingerprint != "" {
+		return issue.Fingerprint
+	}
+	return models.Fingerprint(issue.ID, strconv.Itoa(issue.Line))
+}
+
+func vulnerabilityKey(v models.Vulnerability) string {
+	if v.Fingerprint != "" {
+		return v.Fingerprint
+	}
+	return models.Fingerprint(v.ID, v.Package)
+}
+
+// missingIssues returns the issues in a that are not in b.
+func missingIssues(a, b []models.Issue) []models.Issue {
+	seen := make(map[string]bool, len(b))
+	for _, issue := range b {
+		seen[issueKey(issue)] = true
+	}
+	var missing []models.Issue
+	for _, issue := range a {
+		if !seen[issueKey(issue)] {
+			missing = append(missing, issue)
+		}
+	}
+	return missing
+}
+
+// missingVulnerabilities returns the vulnerabilities in a that are not in b.
+func missingVulnerabilities(a, b []models.Vulnerability) []models.Vulnerability {
+	seen := make(map[string]bool, len(b))
+	for _, v := range b {
+		seen[vulnerabilityKey(v)] = true
+	}
+	var missing []models.Vulnerability
+	for _, v := range a {
+		if !seen[vulnerabilityKey(v)] {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
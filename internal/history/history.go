@@ -0,0 +1,190 @@
+// Package history records pipeline results on disk so runs can be compared
+// over time. Each run is stored as the full JSON report in its own file.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// idRegex matches run IDs, which are also file names, so IDs coming from
+// HTTP requests can't escape the store directory.
+var idRegex = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}\.[0-9]{9}Z$`)
+
+// ErrInvalidID is returned for run IDs that aren't of the form Save uses.
+var ErrInvalidID = errors.New("invalid run ID")
+
+// Run summarizes a recorded pipeline run.
+type Run struct {
+	ID         string    `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Dockerfile string    `json:"dockerfile"`
+	Image      string    `json:"image,omitempty"`
+	Score      int       `json:"score"`
+	Issues     int       `json:"issues"`
+	Size       int64     `json:"size,omitempty"`
+	Critical   int       `json:"critical"`
+	High       int       `json:"high"`
+	Medium     int       `json:"medium"`
+	Low        int       `json:"low"`
+	Scanned    bool      `json:"scanned"`
+	Passed     bool      `json:"passed"`
+}
+
+// Store is a directory of recorded runs.
+type Store struct {
+	Dir string
+}
+
+// DefaultDir returns ~/.dio/history.
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("no home directory for the history store: %w", err)
+	}
+	return filepath.Join(home, ".dio", "history"), nil
+}
+
+// Save records a pipeline result and returns its summary.
+func (s *Store) Save(result *models.PipelineResult) (*Run, error) {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	id := ID(result)
+	if err := os.WriteFile(filepath.Join(s.Dir, id+".json"), data, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to record run: %w", err)
+	}
+	run := Summarize(id, result)
+	return &run, nil
+}
+
+// ID returns the ID a result is recorded under, derived from its
+// timestamp.
+func ID(result *models.PipelineResult) string {
+	return result.Timestamp.UTC().Format("20060102T150405.000000000Z")
+}
+
+// Load returns the full result of a recorded run.
+func (s *Store) Load(id string) (*models.PipelineResult, error) {
+	if !idRegex.MatchString(id) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidID, id)
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var result models.PipelineResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse run %s: %w", id, err)
+	}
+	return &result, nil
+}
+
+// List returns the recorded runs, newest first. Unreadable entries are
+// skipped. A missing store has no runs.
+func (s *Store) List() ([]Run, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []Run
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !idRegex.MatchString(id) {
+			continue
+		}
+		result, err := s.Load(id)
+		if err != nil {
+			continue
+		}
+		runs = append(runs, Summarize(id, result))
+	}
+	// IDs are UTC timestamps, so they sort chronologically
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID > runs[j].ID })
+	return runs, nil
+}
+
+// Previous returns the most recent run of the same target recorded before
+// run, or nil if there is none.
+func (s *Store) Previous(run *Run) (*Run, error) {
+	runs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range runs {
+		if runs[i].ID < run.ID && runs[i].Target() == run.Target() {
+			return &runs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Latest returns the most recent run of target, a Dockerfile or an image,
+// or of any target when it is empty. It returns nil if there is none.
+func (s *Store) Latest(target string) (*Run, error) {
+	runs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range runs {
+		if target == "" || runs[i].Target() == target {
+			return &runs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Target identifies what a run evaluated: the Dockerfile for pipeline
+// runs, the image for image evaluations.
+func (r Run) Target() string {
+	if r.Dockerfile != "" {
+		return r.Dockerfile
+	}
+	return r.Image
+}
+
+// Summarize condenses a pipeline result into a Run.
+func Summarize(id string, result *models.PipelineResult) Run {
+	run := Run{
+		ID:         id,
+		Timestamp:  result.Timestamp,
+		Dockerfile: result.Dockerfile,
+		Image:      result.Image,
+	}
+	if result.Analysis != nil {
+		run.Score = result.Analysis.Score
+		run.Issues = len(result.Analysis.Issues)
+	}
+	if img := result.FinalImage(); img != nil {
+		run.Size = img.Size
+		if run.Image == "" {
+			run.Image = img.ImageName
+		}
+	}
+	if scan := result.FinalScan(); scan != nil {
+		run.Scanned = true
+		run.Critical, run.High = scan.CriticalCount, scan.HighCount
+		run.Medium, run.Low = scan.MediumCount, scan.LowCount
+	}
+	if result.Policy != nil {
+		run.Passed = result.Policy.Passed || result.Policy.Override != nil
+	}
+	return run
+}
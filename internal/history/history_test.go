@@ -0,0 +1,94 @@
+package history
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func TestStore_SaveListLoad(t *testing.T) {
+	store := &Store{Dir: t.TempDir()}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, score := range []int{60, 80} {
+		_, err := store.Save(&models.PipelineResult{
+			Timestamp:  start.Add(time.Duration(i) * time.Hour),
+			Dockerfile: "Dockerfile",
+			Analysis:   &models.AnalysisResult{Score: score},
+			Policy:     &models.PolicyResult{Passed: score > 70},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Score != 80 || !runs[0].Passed || runs[1].Passed {
+		t.Fatalf("expected two runs newest first, got %+v", runs)
+	}
+	result, err := store.Load(runs[1].ID)
+	if err != nil || result.Analysis.Score != 60 {
+		t.Errorf("expected to load the older run, got %+v, %v", result, err)
+	}
+	if prev, err := store.Previous(&runs[0]); err != nil || prev == nil || prev.ID != runs[1].ID {
+		t.Errorf("expected the older run to be the previous one, got %+v, %v", prev, err)
+	}
+	if latest, err := store.Latest("Dockerfile"); err != nil || latest == nil || latest.ID != runs[0].ID {
+		t.Errorf("expected the newer run to be the latest one, got %+v, %v", latest, err)
+	}
+	if latest, err := store.Latest("other/Dockerfile"); err != nil || latest != nil {
+		t.Errorf("expected no run of another Dockerfile, got %+v, %v", latest, err)
+	}
+	if _, err := store.Load("../../etc/passwd"); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("expected an invalid ID error, got %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	issue := func(id, fp string, line int) models.Issue {
+		return models.Issue{ID: id, Fingerprint: fp, Line: line}
+	}
+	from := &models.PipelineResult{
+		Analysis:      &models.AnalysisResult{Score: 60, Issues: []models.Issue{issue("DIO001", "a", 1), issue("DIO004", "b", 3)}},
+		BaselineImage: &models.ImageMetrics{Size: 300},
+		ScanResult: &models.ScanResult{Vulnerabilities: []models.Vulnerability{
+			{ID: "CVE-1", Package: "openssl", Severity: models.SeverityCritical}, {ID: "CVE-2", Package: "zlib"},
+		}},
+	}
+	to := &models.PipelineResult{
+		// DIO004 moved to another line but keeps its fingerprint
+		Analysis:      &models.AnalysisResult{Score: 75, Issues: []models.Issue{issue("DIO004", "b", 5), issue("DIO006", "c", 2)}},
+		BaselineImage: &models.ImageMetrics{Size: 200},
+		ScanResult: &models.ScanResult{Vulnerabilities: []models.Vulnerability{
+			{ID: "CVE-2", Package: "zlib"}, {ID: "CVE-3", Package: "curl"},
+		}},
+	}
+
+	d := Compare("old", from, "new", to)
+	if d.ScoreDelta != 15 || d.SizeDelta != -100 {
+		t.Errorf("expected +15 score and -100 size, got %d and %d", d.ScoreDelta, d.SizeDelta)
+	}
+	if len(d.NewIssues) != 1 || d.NewIssues[0].ID != "DIO006" {
+		t.Errorf("expected DIO006 to be new, got %+v", d.NewIssues)
+	}
+	if len(d.ResolvedIssues) != 1 || d.ResolvedIssues[0].ID != "DIO001" {
+		t.Errorf("expected DIO001 to be resolved, got %+v", d.ResolvedIssues)
+	}
+	if len(d.NewCVEs) != 1 || d.NewCVEs[0].ID != "CVE-3" || len(d.ResolvedCVEs) != 1 || d.ResolvedCVEs[0].ID != "CVE-1" {
+		t.Errorf("expected CVE-3 new and CVE-1 resolved, got %+v / %+v", d.NewCVEs, d.ResolvedCVEs)
+	}
+	if r := d.Regressions(); len(r) != 0 {
+		t.Errorf("expected no regressions, got %v", r)
+	}
+
+	// The other way around, CVE-1 comes back, the score drops and the image grows
+	want := []string{"1 new critical/high CVE(s): CVE-1", "score dropped from 75 to 60", "image grew by 50.0%"}
+	if r := Compare("new", to, "old", from).Regressions(); !reflect.DeepEqual(r, want) {
+		t.Errorf("Regressions = %v, want %v", r, want)
+	}
+}
@@ -0,0 +1,82 @@
+// Package httpjson calls the JSON REST APIs dio files issues and opens
+// pull requests with: GitHub, GitLab and Jira.
+package httpjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultGitHubAPI is the GitHub REST API endpoint.
+const DefaultGitHubAPI = "https://api.github.com"
+
+// defaultHTTPClient is used when a caller has no client configured.
+var defaultHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// Do sends a JSON request and decodes the JSON response into out, if
+// given. Non-2xx responses are returned as errors with the response body.
+// The request accepts application/json unless it sets its own Accept
+// header.
+func Do(client *http.Client, req *http.Request, in, out interface{}) error {
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL, resp.Status, bytes.TrimSpace(body))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// GitHub calls the REST API of a GitHub repository.
+type GitHub struct {
+	Repo       string // owner/name
+	Token      string
+	APIURL     string // default DefaultGitHubAPI, or a GitHub Enterprise API URL
+	HTTPClient *http.Client
+}
+
+// Do sends a request to path, relative to the repository's API URL
+// (/repos/owner/name), like Do.
+func (g *GitHub) Do(method, path string, in, out interface{}) error {
+	api := g.APIURL
+	if api == "" {
+		api = DefaultGitHubAPI
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/repos/%s%s", strings.TrimSuffix(api, "/"), g.Repo, path), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	return Do(g.HTTPClient, req, in, out)
+}
@@ -0,0 +1,55 @@
+package httpjson
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGitHub_Do(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/app/issues" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Accept") != "application/vnd.github+json" {
+			t.Errorf("expected the GitHub media type to be accepted, got %q", r.Header.Get("Accept"))
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("expected the token to be sent, got %q", r.Header.Get("Authorization"))
+		}
+		_, _ = w.Write([]byte(`{"number": 3}`))
+	}))
+	defer srv.Close()
+
+	var out struct {
+		Number int `json:"number"`
+	}
+	g := &GitHub{Repo: "acme/app", Token: "secret", APIURL: srv.URL + "/"}
+	if err := g.Do(http.MethodPost, "/issues", map[string]string{"title": "t"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Number != 3 {
+		t.Errorf("expected the response to be decoded, got %+v", out)
+	}
+}
+
+func TestDo_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json" {
+			t.Errorf("expected JSON to be accepted, got %q", r.Header.Get("Accept"))
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte("validation failed\n"))
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Do(nil, req, nil, nil)
+	if err == nil || !strings.HasSuffix(err.Error(), "422 Unprocessable Entity: validation failed") {
+		t.Errorf("expected the status and body in the error, got %v", err)
+	}
+}
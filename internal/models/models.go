@@ -1,7 +1,13 @@
 // Package models defines shared types used across all DIO components.
 package models
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // Severity represents the severity level of an issue.
 type Severity string
@@ -14,6 +20,35 @@ const (
 	SeverityInfo     Severity = "info"
 )
 
+// Severities lists the severities from most to least severe.
+var Severities = []Severity{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo}
+
+// ParseSeverity parses a severity name, ignoring case.
+func ParseSeverity(s string) (Severity, error) {
+	sev := Severity(strings.ToLower(strings.TrimSpace(s)))
+	if sev.Rank() == 0 {
+		return "", fmt.Errorf("unknown severity %q (valid: critical, high, medium, low, info)", s)
+	}
+	return sev, nil
+}
+
+// Rank orders severities from info (1) to critical (5). Unknown severities
+// rank 0.
+func (s Severity) Rank() int {
+	for i, sev := range Severities {
+		if s == sev {
+			return len(Severities) - i
+		}
+	}
+	return 0
+}
+
+// AtLeast reports whether s is at or above threshold. An empty threshold
+// includes every severity.
+func (s Severity) AtLeast(threshold Severity) bool {
+	return threshold == "" || s.Rank() >= threshold.Rank()
+}
+
 // Issue represents a single problem found during analysis.
 type Issue struct {
 	ID          string   `json:"id"`
@@ -24,13 +59,171 @@ type Issue struct {
 	Line        int      `json:"line,omitempty"`
 	Suggestion  string   `json:"suggestion,omitempty"`
 	AutoFixable bool     `json:"auto_fixable"`
+	DocsURL     string   `json:"docs_url,omitempty"`
+	Stage       string   `json:"stage,omitempty"` // build stage containing Line
+	// Fingerprint identifies the finding across runs, independent of Line.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// FixedByOptimization is the ID of the auto-fixable optimization that
+	// resolves the issue, e.g. OPT-CLEANUP for DIO005.
+	FixedByOptimization string `json:"fixed_by_optimization,omitempty"`
+	// DefaultSeverity is the rule's own severity when the image kind
+	// changed it.
+	DefaultSeverity Severity `json:"default_severity,omitempty"`
 }
 
 // AnalysisResult holds the output of the Dockerfile analyzer.
 type AnalysisResult struct {
-	Dockerfile string  `json:"dockerfile"`
-	Issues     []Issue `json:"issues"`
-	Score      int     `json:"score"` // 0-100, higher = better
+	Dockerfile        string             `json:"dockerfile"`
+	Issues            []Issue            `json:"issues"`
+	Score             int                `json:"score"` // 0-100, higher = better
+	Stages            []StageResult      `json:"stages,omitempty"`
+	ImageReferences   []ImageReference   `json:"image_references,omitempty"`
+	HadolintDecisions []HadolintDecision `json:"hadolint_decisions,omitempty"`
+	// BuildCheckDecisions record which docker build --check findings were
+	// kept or dropped as duplicates of other rules.
+	BuildCheckDecisions []HadolintDecision `json:"build_check_decisions,omitempty"`
+	// TrivyDecisions record which trivy config findings were kept or
+	// dropped as duplicates of other rules.
+	TrivyDecisions []HadolintDecision `json:"trivy_decisions,omitempty"`
+	Windows        bool               `json:"windows,omitempty"` // final image uses a Windows base
+	User           string             `json:"user,omitempty"`    // effective USER of the final stage, empty = base image default
+	Target         string             `json:"target,omitempty"`  // stage analyzed as the final one (--target), empty = the last stage
+	// Binaries are the compiled Go and Rust binaries copied into the final
+	// image from build stages.
+	Binaries []CompiledBinary `json:"binaries,omitempty"`
+	// Artifacts are the COPY --from copies between build stages.
+	Artifacts []StageArtifact `json:"artifacts,omitempty"`
+	// Updater is the dependency updater, renovate or dependabot, found
+	// keeping the base images current. Unpinned base images are then only
+	// reported for a digest pin.
+	Updater string `json:"updater,omitempty"`
+	// ImageKind is the kind of image the severities were adjusted for:
+	// service, job or base-image.
+	ImageKind string `json:"image_kind,omitempty"`
+	// ImageKindReasons say why the Dockerfile was classified as ImageKind
+	// when it wasn't declared.
+	ImageKindReasons []string `json:"image_kind_reasons,omitempty"`
+	// Runtime is the configuration of the image built from the Dockerfile,
+	// when dio run checked it. Its findings are among Issues.
+	Runtime *RuntimeConfig `json:"runtime_config,omitempty"`
+	// Budget is the size budget the Dockerfile declares for its image in a
+	// dio:budget comment.
+	Budget *SizeBudget `json:"budget,omitempty"`
+	// FilteredOut counts the issues that dio analyze filters (--severity,
+	// --category, --rule, --max-issues) left out of Issues.
+	FilteredOut int `json:"filtered_out,omitempty"`
+}
+
+// SizeBudget is the size budget a Dockerfile declares for the image built
+// from it, "# dio:budget size=150MB layers=12". Zero values are unlimited.
+type SizeBudget struct {
+	Size   string `json:"size,omitempty"`
+	Layers int    `json:"layers,omitempty"`
+	Line   int    `json:"line"`
+}
+
+// HistoryEntry is an entry of an image's history: the instruction that
+// created it, as docker history shows it, and the size of its layer.
+type HistoryEntry struct {
+	CreatedBy string `json:"created_by"`
+	Size      int64  `json:"size"`
+}
+
+// ExplainResult is a Dockerfile reconstructed from the history of an image
+// by dio explain, and what the analyzer and optimizer find in it.
+type ExplainResult struct {
+	Image string `json:"image"`
+	// BaseImage is the base image, when named with --base; BaseEntries and
+	// BaseSize are the history entries taken to be the base image's and the
+	// size of their layers.
+	BaseImage   string `json:"base_image,omitempty"`
+	BaseEntries int    `json:"base_entries"`
+	BaseSize    int64  `json:"base_size"`
+	Dockerfile  string `json:"dockerfile"`
+	// Layers are the layers the image adds to its base, with the lines of
+	// Dockerfile that created them.
+	Layers        []ExplainedLayer    `json:"layers,omitempty"`
+	Analysis      *AnalysisResult     `json:"analysis"`
+	Optimizations *OptimizationResult `json:"optimizations"`
+}
+
+// ExplainedLayer is a layer of an explained image.
+type ExplainedLayer struct {
+	Line        int    `json:"line"`
+	Instruction string `json:"instruction"`
+	Size        int64  `json:"size"`
+}
+
+// RuntimeConfig is what a built image runs with, from its config.
+type RuntimeConfig struct {
+	Image      string   `json:"image"`
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	Cmd        []string `json:"cmd,omitempty"`
+	Env        []string `json:"env,omitempty"` // KEY=value
+	WorkingDir string   `json:"working_dir,omitempty"`
+	// WorkingDirMode is the octal mode of WorkingDir in the image, e.g.
+	// 0755; empty when it couldn't be read.
+	WorkingDirMode string `json:"working_dir_mode,omitempty"`
+}
+
+// StageArtifact is a COPY --from from one build stage into another, and
+// whether what it copies ends up in the final image.
+type StageArtifact struct {
+	From    string   `json:"from"`    // the stage copied from
+	To      string   `json:"to"`      // the stage copied into
+	Sources []string `json:"sources"` // paths in the From stage
+	Dest    string   `json:"dest"`    // absolute destination in the To stage
+	Line    int      `json:"line"`
+	// ReachesFinal is whether the copied files are in the final image:
+	// copied into the final stage or a stage it is built on, or taken on
+	// from there by a later copy.
+	ReachesFinal bool `json:"reaches_final"`
+}
+
+// CompiledBinary is a binary built in a Go or Rust stage and copied into
+// the final image.
+type CompiledBinary struct {
+	Path     string `json:"path"`     // where it lands in the final image
+	Source   string `json:"source"`   // path in the build stage
+	Stage    string `json:"stage"`    // the build stage it is copied from
+	Language string `json:"language"` // go or rust
+	Line     int    `json:"line"`     // the COPY --from instruction
+	// Static is whether the build settings produce a statically linked
+	// binary, as far as the Dockerfile shows.
+	Static bool `json:"static"`
+}
+
+// ImageReference is an external image a Dockerfile depends on, either as a
+// FROM base image or as the source of a COPY --from.
+type ImageReference struct {
+	Image  string `json:"image"`
+	Line   int    `json:"line"`
+	Source string `json:"source"` // ImageSourceFrom or ImageSourceCopyFrom
+}
+
+// Image reference sources.
+const (
+	ImageSourceFrom     = "from"
+	ImageSourceCopyFrom = "copy-from"
+)
+
+// StageResult summarizes analysis findings for a single build stage.
+type StageResult struct {
+	Name      string `json:"name"`
+	BaseImage string `json:"base_image"`
+	StartLine int    `json:"start_line"`
+	Final     bool   `json:"final"`
+	Issues    int    `json:"issues"`
+}
+
+// HadolintDecision records whether a hadolint finding, or a finding of
+// docker build --check or trivy config, was kept or dropped when merging
+// it with the built-in rule results.
+type HadolintDecision struct {
+	Code   string `json:"code"`
+	Line   int    `json:"line"`
+	Kept   bool   `json:"kept"`
+	Reason string `json:"reason"`
 }
 
 // ImageMetrics captures information about a built Docker image.
@@ -45,6 +238,10 @@ type ImageMetrics struct {
 	BuildTime    float64   `json:"build_time_seconds"`
 	Architecture string    `json:"architecture"`
 	OS           string    `json:"os"`
+	User         string    `json:"user,omitempty"` // configured USER, empty = root
+	Healthcheck  bool      `json:"healthcheck,omitempty"`
+	// CompressedSize is the registry (compressed) size of the image layers.
+	CompressedSize int64 `json:"compressed_size,omitempty"`
 }
 
 // Vulnerability represents a single CVE or security issue.
@@ -58,6 +255,8 @@ type Vulnerability struct {
 	Description   string   `json:"description"`
 	DataSource    string   `json:"data_source"`
 	PublishedDate string   `json:"published_date,omitempty"`
+	// Fingerprint identifies the vulnerability across scans (CVE + package).
+	Fingerprint string `json:"fingerprint,omitempty"`
 }
 
 // ScanResult holds the output of the security scanner.
@@ -80,6 +279,21 @@ type Secret struct {
 	Severity string `json:"severity"`
 }
 
+// SBOM is the package inventory of an image.
+type SBOM struct {
+	ImageName string    `json:"image_name"`
+	Generator string    `json:"generator"`
+	Packages  []Package `json:"packages"`
+}
+
+// Package is an OS or language package found in an image.
+type Package struct {
+	Name     string   `json:"name"`
+	Version  string   `json:"version"`
+	Type     string   `json:"type,omitempty"`     // package URL type, e.g. deb, npm
+	Licenses []string `json:"licenses,omitempty"` // SPDX IDs, names or expressions
+}
+
 // Optimization represents a single optimization that can be applied.
 type Optimization struct {
 	ID          string `json:"id"`
@@ -90,31 +304,115 @@ type Optimization struct {
 	Applied     bool   `json:"applied"`
 	AutoFixable bool   `json:"auto_fixable"`
 	Priority    int    `json:"priority"` // 1 = highest
+	// RelatedIssueIDs are the analyzer issues the optimization resolves.
+	RelatedIssueIDs []string `json:"related_issue_ids,omitempty"`
+	// EstimatedBytes is the size the optimization typically saves, zero
+	// for optimizations that aren't about size.
+	EstimatedBytes int64 `json:"estimated_bytes,omitempty"`
+	// Confidence is how likely the change is to work without further
+	// edits: swaps to alpine and multi-stage rewrites often break builds.
+	Confidence string `json:"confidence"`
+	// Rejected is why autofix didn't apply the optimization: the
+	// Dockerfile the fix produced doesn't parse or fails docker build
+	// --check.
+	Rejected string `json:"rejected,omitempty"`
 }
 
+// Confidence levels of optimizations.
+const (
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+)
+
 // OptimizationResult holds the output of the optimizer engine.
 type OptimizationResult struct {
 	OriginalDockerfile  string         `json:"original_dockerfile"`
 	OptimizedDockerfile string         `json:"optimized_dockerfile"`
 	Optimizations       []Optimization `json:"optimizations"`
 	EstimatedReduction  string         `json:"estimated_reduction"`
+	// Dockerignore is the path of the .dockerignore (or .containerignore)
+	// generated in autofix mode, if any.
+	Dockerignore string `json:"dockerignore,omitempty"`
 }
 
+// Policy enforcement levels.
+const (
+	EnforcementDeny = "deny" // a failed rule fails the policy
+	EnforcementWarn = "warn" // a failed rule is reported but the policy passes
+)
+
 // PolicyRule represents a single policy rule.
 type PolicyRule struct {
 	Name        string      `json:"name"`
 	Description string      `json:"description"`
 	Value       interface{} `json:"value"`
 	Passed      bool        `json:"passed"`
+	Enforcement string      `json:"enforcement"`
 	Message     string      `json:"message,omitempty"`
+	// NotEvaluated is set when the rule couldn't be checked for lack of
+	// data, such as an SBOM. It warns, with the reason in Message.
+	NotEvaluated bool `json:"not_evaluated,omitempty"`
 }
 
 // PolicyResult holds the output of the policy enforcer.
 type PolicyResult struct {
-	Passed bool         `json:"passed"`
-	Rules  []PolicyRule `json:"rules"`
+	Passed   bool            `json:"passed"`
+	Profile  string          `json:"profile,omitempty"`
+	Warnings int             `json:"warnings"`
+	Rules    []PolicyRule    `json:"rules"`
+	Override *PolicyOverride `json:"override,omitempty"`
+	// Analysis is the Dockerfile analysis the rules checked:
+	// AnalysisOriginal or AnalysisOptimized.
+	Analysis string `json:"analysis,omitempty"`
+}
+
+// Dockerfile analyses a policy can check.
+const (
+	AnalysisOriginal  = "original"
+	AnalysisOptimized = "optimized"
+)
+
+// PolicyOverride records a break-glass override of a failed policy for the
+// audit trail.
+type PolicyOverride struct {
+	Reason      string    `json:"reason"`
+	User        string    `json:"user,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	FailedRules []string  `json:"failed_rules"`
+	TokenUsed   bool      `json:"token_used"`
+}
+
+// ComplianceResult maps the findings of a run onto the controls of
+// security benchmarks, such as the CIS Docker Benchmark.
+type ComplianceResult struct {
+	Controls      []ComplianceControl `json:"controls"`
+	Passed        int                 `json:"passed"`
+	Failed        int                 `json:"failed"`
+	NotApplicable int                 `json:"not_applicable"`
+}
+
+// ComplianceControl is the status of a benchmark control.
+type ComplianceControl struct {
+	// Framework identifies the benchmark, e.g. cis-docker-1.6.0.
+	Framework string `json:"framework"`
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	// Status is ControlPass, ControlFail or ControlNotApplicable.
+	Status string `json:"status"`
+	// Rules are the dio rules that check the control.
+	Rules []string `json:"rules,omitempty"`
+	// Findings are what fails it, or why it doesn't apply.
+	Findings []string `json:"findings,omitempty"`
 }
 
+// Statuses of a compliance control.
+const (
+	ControlPass          = "pass"
+	ControlFail          = "fail"
+	ControlNotApplicable = "not-applicable"
+)
+
 // ComparisonMetrics shows before/after comparison.
 type ComparisonMetrics struct {
 	Baseline  ImageMetrics `json:"baseline"`
@@ -125,16 +423,405 @@ type ComparisonMetrics struct {
 	CVEDiff   int          `json:"cve_diff"`
 }
 
+// AnalysisDiff compares the analysis of a Dockerfile before and after
+// autofix.
+type AnalysisDiff struct {
+	ScoreBefore int `json:"score_before"`
+	ScoreAfter  int `json:"score_after"`
+	// ResolvedIssues are the issues before autofix whose rule no longer
+	// fires, and NewIssues those after autofix whose rule didn't fire
+	// before.
+	ResolvedIssues []Issue `json:"resolved_issues"`
+	NewIssues      []Issue `json:"new_issues"`
+}
+
+// CostImpact is the monthly registry cost the size reduction saves, from
+// the prices in the configuration. Negative amounts are extra costs.
+type CostImpact struct {
+	// SizeDiff is the baseline size minus the optimized size, compressed
+	// when Compressed is set.
+	SizeDiff    int64   `json:"size_diff"`
+	Compressed  bool    `json:"compressed"`
+	PullsPerDay float64 `json:"pulls_per_day"`
+	Currency    string  `json:"currency"`
+	// Storage, Egress and Total are amounts per month.
+	Storage float64 `json:"storage"`
+	Egress  float64 `json:"egress"`
+	Total   float64 `json:"total"`
+}
+
+// Footprint is the monthly energy and emissions the size reduction saves
+// in registry transfers and storage, with the coefficients used. Negative
+// amounts are extra energy.
+type Footprint struct {
+	// SizeDiff is the baseline size minus the optimized size, compressed
+	// when Compressed is set.
+	SizeDiff         int64   `json:"size_diff"`
+	Compressed       bool    `json:"compressed"`
+	PullsPerDay      float64 `json:"pulls_per_day"`
+	TransferKWhPerGB float64 `json:"transfer_kwh_per_gb"`
+	StorageKWhPerGB  float64 `json:"storage_kwh_per_gb"`
+	GridIntensity    float64 `json:"grid_intensity"` // gCO2e per kWh
+	// TransferKWh, StorageKWh, TotalKWh and CO2eKg are amounts per month.
+	TransferKWh float64 `json:"transfer_kwh"`
+	StorageKWh  float64 `json:"storage_kwh"`
+	TotalKWh    float64 `json:"total_kwh"`
+	CO2eKg      float64 `json:"co2e_kg"`
+}
+
+// BaselineEstimate estimates the size effect of the optimizations without
+// building the baseline image, from the registry (compressed) sizes of the
+// final base images of the original and the optimized Dockerfile. Layers
+// added on top of the base images are not counted.
+type BaselineEstimate struct {
+	BaseImage              string `json:"base_image"`
+	BaseImageSize          int64  `json:"base_image_size"`
+	OptimizedBaseImage     string `json:"optimized_base_image"`
+	OptimizedBaseImageSize int64  `json:"optimized_base_image_size"`
+	// SizeDiff is the base image size minus the optimized base image size.
+	SizeDiff int64 `json:"size_diff"`
+}
+
+// SquashResult describes the optional squash step, which flattens the
+// final image into a single layer.
+type SquashResult struct {
+	Source   string `json:"source"` // the image considered for squashing
+	Squashed bool   `json:"squashed"`
+	// Reason explains why the image was or wasn't squashed.
+	Reason      string `json:"reason"`
+	Layers      int    `json:"layers"`
+	WastedBytes int64  `json:"wasted_bytes"`
+	// Image is the squashed image and SizeDiff its size minus the source's.
+	Image     *ImageMetrics `json:"image,omitempty"`
+	SizeDiff  int64         `json:"size_diff,omitempty"`
+	Tradeoffs []string      `json:"tradeoffs,omitempty"`
+}
+
+// StripDocsResult measures the strip-docs strategy: the size of the
+// documentation, man pages and translations in each image.
+type StripDocsResult struct {
+	Dirs           []string `json:"dirs"`
+	BaselineBytes  int64    `json:"baseline_bytes"`
+	OptimizedBytes int64    `json:"optimized_bytes"`
+}
+
+// Saved returns the bytes the strategy removed.
+func (r *StripDocsResult) Saved() int64 {
+	return r.BaselineBytes - r.OptimizedBytes
+}
+
+// LayerDuplication is a layer that adds files an earlier layer already
+// holds, unchanged in size, as a chown -R or chmod -R of copied files does.
+// The image stores those files twice.
+type LayerDuplication struct {
+	Layer     int    `json:"layer"` // index among the image's layers
+	CreatedBy string `json:"created_by,omitempty"`
+	Files     int    `json:"files"`
+	Bytes     int64  `json:"bytes"`
+	// SourceLayer is the earlier layer most of the bytes come from.
+	SourceLayer     int    `json:"source_layer"`
+	SourceCreatedBy string `json:"source_created_by,omitempty"`
+	// Line and SourceLine are the Dockerfile lines of the instructions
+	// that created the layers, when they could be told.
+	Line       int `json:"line,omitempty"`
+	SourceLine int `json:"source_line,omitempty"`
+}
+
+// ReproducibilityResult compares two builds of the final image without the
+// build cache, for the require_reproducible policy rule.
+type ReproducibilityResult struct {
+	// SourceDateEpoch is the SOURCE_DATE_EPOCH both builds ran with.
+	SourceDateEpoch string `json:"source_date_epoch,omitempty"`
+	// ImageIDs are the image IDs of the two builds.
+	ImageIDs     []string `json:"image_ids"`
+	Reproducible bool     `json:"reproducible"`
+	// ConfigFields are the fields of the image configs that differ, such as
+	// created or history[2].created.
+	ConfigFields []string    `json:"config_fields,omitempty"`
+	Layers       []LayerDiff `json:"layers,omitempty"`
+}
+
+// LayerDiff is a layer that differs between two builds.
+type LayerDiff struct {
+	Layer     int    `json:"layer"` // index among the image's layers
+	CreatedBy string `json:"created_by,omitempty"`
+	// Files are the first paths that differ in content, metadata or
+	// presence; Changed counts them all.
+	Files   []string `json:"files"`
+	Changed int      `json:"changed"`
+}
+
+// AttestationResult records the BuildKit attestations of the final image
+// that dio run stored with the reports, for the require_provenance and
+// require_sbom_attestation policy rules.
+type AttestationResult struct {
+	// Provenance is the file with the provenance statement.
+	Provenance string `json:"provenance,omitempty"`
+	// PredicateType is the provenance's, e.g. https://slsa.dev/provenance/v1.
+	PredicateType string `json:"predicate_type,omitempty"`
+	BuildType     string `json:"build_type,omitempty"`
+	BuilderID     string `json:"builder_id,omitempty"`
+	// Materials are the resolved dependencies of the build, such as the
+	// base images, with their digests.
+	Materials []string `json:"materials,omitempty"`
+	// SBOMs are the files with the SPDX SBOM statements.
+	SBOMs []string `json:"sboms,omitempty"`
+}
+
+// BuildLog is the output of one docker build.
+type BuildLog struct {
+	Name       string `json:"name"` // baseline, optimized, stage <name>, ...
+	Dockerfile string `json:"dockerfile"`
+	Image      string `json:"image"`
+	Failed     bool   `json:"failed"`
+	Output     string `json:"output"`
+	// Diagnoses are the likely causes of a failed build.
+	Diagnoses []BuildDiagnosis `json:"diagnoses,omitempty"`
+}
+
+// Causes of build failures recognized by the diagnoser.
+const (
+	CauseMissingFile      = "missing-file"
+	CausePackageNotFound  = "package-not-found"
+	CausePermissionDenied = "permission-denied"
+	CauseCommandNotFound  = "command-not-found"
+)
+
+// BuildDiagnosis is a likely cause of a build failure with a targeted
+// hint.
+type BuildDiagnosis struct {
+	Cause       string `json:"cause"`
+	Line        int    `json:"line,omitempty"` // of the failing instruction
+	Instruction string `json:"instruction,omitempty"`
+	Message     string `json:"message"`
+	Hint        string `json:"hint"`
+}
+
+// PushResult records the push of the pipeline's final image to a registry.
+type PushResult struct {
+	Source string `json:"source"` // the local image
+	Ref    string `json:"ref"`    // where it was pushed to
+	Pushed bool   `json:"pushed"`
+	// Reason explains why --push-if-better skipped the push, and Error why
+	// the push failed.
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Digest is the pushed reference with its digest (repo@sha256:...).
+	Digest string            `json:"digest,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// SlimResult describes an image minified by running it and keeping only
+// the files it used (docker-slim / mint).
+type SlimResult struct {
+	Source string `json:"source"` // the image that was minified
+	Tool   string `json:"tool"`
+	// Image is the minified image and SizeDiff its size minus the source's.
+	Image    *ImageMetrics `json:"image"`
+	SizeDiff int64         `json:"size_diff"`
+	// RemovedFiles and RemovedBytes count the files of the source image
+	// missing from the minified one; Removed groups them by directory,
+	// largest first.
+	RemovedFiles int           `json:"removed_files"`
+	RemovedBytes int64         `json:"removed_bytes"`
+	Removed      []RemovedPath `json:"removed,omitempty"`
+	// Scan is the security scan of the minified image.
+	Scan *ScanResult `json:"scan,omitempty"`
+}
+
+// RemovedPath is a directory whose files were (partly) removed by
+// minification.
+type RemovedPath struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// BinaryLinkage is how a compiled binary in the built image is linked, read
+// from its ELF headers.
+type BinaryLinkage struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	Static   bool   `json:"static"`
+	// Interpreter is the dynamic loader the binary requests and Libraries
+	// the shared libraries it needs; both are empty for static binaries.
+	Interpreter string   `json:"interpreter,omitempty"`
+	Libraries   []string `json:"libraries,omitempty"`
+	// MissingInterpreter is set when the loader isn't in the image, so the
+	// binary fails to start with "no such file or directory".
+	MissingInterpreter bool `json:"missing_interpreter,omitempty"`
+}
+
+// SetIDFile is a setuid or setgid file in the built image, through which a
+// process can gain the privileges of the file's owner or group.
+type SetIDFile struct {
+	Path   string `json:"path"`
+	Mode   string `json:"mode"` // octal, e.g. 4755
+	Setuid bool   `json:"setuid,omitempty"`
+	Setgid bool   `json:"setgid,omitempty"`
+}
+
+// Step error kinds.
+const (
+	// StepSkipped is a step the environment can't run, e.g. without a
+	// Docker CLI or a vulnerability scanner.
+	StepSkipped = "skipped"
+	// StepFailed is a step that ran and failed.
+	StepFailed = "failed"
+)
+
+// StepError is a pipeline step, or part of one, that produced no result.
+// The pipeline goes on without it, so the rest of the result is partial.
+type StepError struct {
+	Step    string `json:"step"` // build, scan, ...
+	Kind    string `json:"kind"` // StepSkipped or StepFailed
+	Message string `json:"message"`
+	// Target is the build that failed (baseline, optimized, ...) or the
+	// image whose scan failed, when known.
+	Target string `json:"target,omitempty"`
+}
+
+// StepTiming is the wall-clock time a pipeline step took.
+type StepTiming struct {
+	Step    string  `json:"step"` // analyze, optimize, build baseline, ...
+	Seconds float64 `json:"seconds"`
+}
+
+// GitInfo is the revision of the git repository a Dockerfile was
+// evaluated at.
+type GitInfo struct {
+	Commit string `json:"commit"`
+	// Branch is empty on a detached HEAD outside CI.
+	Branch string `json:"branch,omitempty"`
+	// Dirty is set when tracked files had uncommitted changes.
+	Dirty bool `json:"dirty"`
+	// DockerfileChanged is when a line of the Dockerfile last changed, and
+	// DockerfileOldestLine when its oldest line was written, from git
+	// blame. Both are unset for an untracked Dockerfile.
+	DockerfileChanged    *time.Time `json:"dockerfile_changed,omitempty"`
+	DockerfileOldestLine *time.Time `json:"dockerfile_oldest_line,omitempty"`
+}
+
 // PipelineResult is the top-level result of the entire DIO pipeline.
 type PipelineResult struct {
 	Timestamp      time.Time           `json:"timestamp"`
 	Dockerfile     string              `json:"dockerfile"`
+	Git            *GitInfo            `json:"git,omitempty"`   // the revision of the Dockerfile
+	Image          string              `json:"image,omitempty"` // set when evaluating an existing image
 	Analysis       *AnalysisResult     `json:"analysis,omitempty"`
 	BaselineImage  *ImageMetrics       `json:"baseline_image,omitempty"`
 	ScanResult     *ScanResult         `json:"scan_result,omitempty"`
 	Optimization   *OptimizationResult `json:"optimization,omitempty"`
 	OptimizedImage *ImageMetrics       `json:"optimized_image,omitempty"`
 	OptScanResult  *ScanResult         `json:"optimized_scan_result,omitempty"`
-	Policy         *PolicyResult       `json:"policy,omitempty"`
-	Comparison     *ComparisonMetrics  `json:"comparison,omitempty"`
+	// SBOM is the package inventory of the final image.
+	SBOM *SBOM `json:"sbom,omitempty"`
+	// StageImages holds images built for individual stages with --target.
+	StageImages map[string]*ImageMetrics `json:"stage_images,omitempty"`
+	// PreviousImage is the final image of the previous recorded run.
+	PreviousImage *ImageMetrics `json:"previous_image,omitempty"`
+	// ExternalScanResults holds scans of images referenced by COPY --from.
+	ExternalScanResults []ScanResult       `json:"external_scan_results,omitempty"`
+	Policy              *PolicyResult      `json:"policy,omitempty"`
+	Compliance          *ComplianceResult  `json:"compliance,omitempty"` // benchmark controls
+	Comparison          *ComparisonMetrics `json:"comparison,omitempty"`
+	Squash              *SquashResult      `json:"squash,omitempty"`
+	Slim                *SlimResult        `json:"slim,omitempty"`
+	// StripDocs measures what the strip-docs strategy saved, when enabled.
+	StripDocs *StripDocsResult `json:"strip_docs,omitempty"`
+	// Binaries is the linkage of the compiled binaries in the final image.
+	Binaries []BinaryLinkage `json:"binaries,omitempty"`
+	// SetIDFiles are the setuid and setgid files in the final image.
+	SetIDFiles []SetIDFile `json:"setid_files,omitempty"`
+	// LayerDuplicates are the layers of the image built from the original
+	// Dockerfile, or the optimized one without a baseline, that store files
+	// of earlier layers again.
+	LayerDuplicates []LayerDuplication `json:"layer_duplicates,omitempty"`
+	// Reproducibility compares two rebuilds of the final image, for the
+	// require_reproducible policy rule.
+	Reproducibility *ReproducibilityResult `json:"reproducibility,omitempty"`
+	// Attestations are the provenance and SBOM attestations generated for
+	// the final image.
+	Attestations *AttestationResult `json:"attestations,omitempty"`
+	// Push records pushing the final image with dio run --push.
+	Push *PushResult `json:"push,omitempty"`
+	// Builds holds the output of each docker build the pipeline ran.
+	Builds []BuildLog `json:"builds,omitempty"`
+	// OptimizedAnalysis is the analysis of the autofixed Dockerfile, and
+	// AnalysisDiff compares it with Analysis.
+	OptimizedAnalysis *AnalysisResult `json:"optimized_analysis,omitempty"`
+	AnalysisDiff      *AnalysisDiff   `json:"analysis_diff,omitempty"`
+	// BaselineEstimate replaces Comparison when the baseline image was not
+	// built (dio run --build-target optimized-only).
+	BaselineEstimate *BaselineEstimate `json:"baseline_estimate,omitempty"`
+	// CostImpact is the monthly cost effect of Comparison or
+	// BaselineEstimate, when prices are configured.
+	CostImpact *CostImpact `json:"cost_impact,omitempty"`
+	// Footprint is the monthly energy and emissions effect of the same
+	// reduction, with carbon estimation turned on.
+	Footprint *Footprint `json:"footprint,omitempty"`
+	// Errors lists the steps that were skipped or failed. Steps turned off
+	// with --skip-build or --skip-scan are not errors.
+	Errors []StepError `json:"errors,omitempty"`
+	// Timings are the durations of the steps that ran, in order.
+	Timings []StepTiming `json:"timings,omitempty"`
+}
+
+// FinalImage returns the minified image when the slim stage ran, otherwise
+// the optimized image when one was built, otherwise the baseline image.
+func (r *PipelineResult) FinalImage() *ImageMetrics {
+	if r.Slim != nil {
+		return r.Slim.Image
+	}
+	if r.OptimizedImage != nil {
+		return r.OptimizedImage
+	}
+	return r.BaselineImage
+}
+
+// SizeReduction returns how much smaller the optimized image is than the
+// baseline, from Comparison or else BaselineEstimate. Registries store and
+// serve compressed layers, so the difference is compressed when both
+// compared images have a compressed size, and the uncompressed difference,
+// which overstates transfers, otherwise. ok is false when there is nothing
+// to compare.
+func (r *PipelineResult) SizeReduction() (diff int64, compressed, ok bool) {
+	switch {
+	case r.Comparison != nil && r.Comparison.Baseline.CompressedSize > 0 && r.Comparison.Optimized.CompressedSize > 0:
+		return r.Comparison.Baseline.CompressedSize - r.Comparison.Optimized.CompressedSize, true, true
+	case r.Comparison != nil:
+		return r.Comparison.SizeDiff, false, true
+	case r.BaselineEstimate != nil:
+		return r.BaselineEstimate.SizeDiff, true, true
+	}
+	return 0, false, false
+}
+
+// FinalAnalysis returns the analysis of the autofixed Dockerfile when
+// there is one, unless its image failed to build while the original's
+// built, otherwise the analysis of the original Dockerfile.
+func (r *PipelineResult) FinalAnalysis() *AnalysisResult {
+	if r.OptimizedAnalysis != nil && (r.OptimizedImage != nil || r.BaselineImage == nil) {
+		return r.OptimizedAnalysis
+	}
+	return r.Analysis
+}
+
+// FinalScan returns the scan of the minified or optimized image when one
+// was scanned, otherwise the scan of the baseline image.
+func (r *PipelineResult) FinalScan() *ScanResult {
+	if r.Slim != nil && r.Slim.Scan != nil {
+		return r.Slim.Scan
+	}
+	if r.OptScanResult != nil {
+		return r.OptScanResult
+	}
+	return r.ScanResult
+}
+
+// Fingerprint returns a short, deterministic hash of the parts identifying a
+// finding, used to match findings across runs.
+func Fingerprint(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])[:16]
 }
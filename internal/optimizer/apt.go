@@ -0,0 +1,114 @@
+package optimizer
+
+import (
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- AptUpdateStrategy ---
+// Runs apt-get update in each RUN that installs from the lists of an
+// earlier one (DIO040), removes the lists after the install, and drops
+// RUNs that only ran the update. It runs after CombineLayersStrategy,
+// which already joins an update with an install in the next RUN: joining
+// them here first would have the combined RUN update twice.
+
+type AptUpdateStrategy struct{}
+
+func (s *AptUpdateStrategy) Name() string { return "apt-update" }
+
+func (s *AptUpdateStrategy) After() []string { return []string{"combine-layers"} }
+
+func (s *AptUpdateStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	related := reportedIssues(ctx.Analysis, "DIO040")
+	if len(related) == 0 {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-APT-UPDATE",
+		Category:        "best-practice",
+		Title:           "Run apt-get update in the RUN that installs",
+		Description:     "Merge apt-get update into each RUN that installs apt packages and remove the package lists after the install, so installs never use stale cached lists.",
+		Impact:          "Reliable rebuilds, and no package lists in the image",
+		EstimatedBytes:  20 << 20,
+		Confidence:      models.ConfidenceHigh,
+		Priority:        2,
+		AutoFixable:     true,
+		RelatedIssueIDs: related,
+	}
+}
+
+// aptListsCleanup removes the package lists apt-get update downloads.
+const aptListsCleanup = "rm -rf /var/lib/apt/lists/*"
+
+func (s *AptUpdateStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	scripts := make(map[int]analyzer.RunScript)
+	for _, script := range analyzer.RunScripts(pdf, lines) {
+		scripts[script.Instruction.Line] = script
+	}
+
+	edits := make(map[int]*lineEdit)
+	// Updates that run nothing else are dropped once every install of
+	// their lists runs its own
+	updates := make(map[int]analyzer.Instruction)
+	kept := make(map[int]bool)
+	for _, split := range pdf.AptSplits() {
+		if split.UpdateOnly {
+			updates[split.Update.Line] = split.Update
+		}
+		script, ok := scripts[split.Install.Line]
+		if !ok {
+			kept[split.Update.Line] = true
+			continue
+		}
+		start, end := span(split.Install)
+		edited := mergeAptUpdate(lines[start:end], script, start, ctx.Escape)
+		if edited == nil {
+			kept[split.Update.Line] = true
+			continue
+		}
+		edits[start] = &lineEdit{end: end, lines: edited}
+	}
+	for line, update := range updates {
+		if !kept[line] {
+			start, end := span(update)
+			edits[start] = &lineEdit{end: end}
+		}
+	}
+	return strings.Join(applyEdits(lines, edits), "\n"), nil
+}
+
+// mergeAptUpdate returns the lines of an install RUN, starting at line
+// start, with apt-get update before its script and the lists removed after
+// it. It returns nil when the script can't be found in the lines.
+func mergeAptUpdate(lines []string, script analyzer.RunScript, start int, escape byte) []string {
+	edited := append([]string(nil), lines...)
+	clean := !strings.Contains(script.Instruction.Args, "/var/lib/apt/lists")
+	n := script.Lines[0] - 1 - start
+	if len(script.Instruction.Heredocs) > 0 {
+		at := n
+		if strings.HasPrefix(strings.TrimSpace(edited[n]), "#!") {
+			at++
+		}
+		edited = append(edited[:at], append([]string{"apt-get update"}, edited[at:]...)...)
+		if clean {
+			// Before the heredoc terminator
+			last := len(edited) - 1
+			edited = append(edited[:last], aptListsCleanup, edited[last])
+		}
+		return edited
+	}
+	first := strings.SplitN(script.Script, "\n", 2)[0]
+	i := strings.LastIndex(edited[n], first)
+	if i < 0 {
+		return nil
+	}
+	edited[n] = edited[n][:i] + "apt-get update && " + edited[n][i:]
+	if clean && analyzer.Appendable(script.Instruction.Args) {
+		edited[len(edited)-1] += " && " + string(escape) + "\n    " + aptListsCleanup
+	}
+	return edited
+}
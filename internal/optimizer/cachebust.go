@@ -0,0 +1,55 @@
+package optimizer
+
+import (
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- CacheBustStrategy ---
+// Fixes the cache-busting pattern (DIO039) that can be fixed without
+// knowing what the build fetches: moves a cache-busting ARG down to the
+// instruction that reads it.
+
+type CacheBustStrategy struct{}
+
+func (s *CacheBustStrategy) Name() string { return "cache-busting" }
+
+func (s *CacheBustStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	related := reportedIssues(ctx.Analysis, "DIO039")
+	if len(related) == 0 {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-CACHE-BUST",
+		Category:        "cache-optimization",
+		Title:           "Invalidate only the layers that need to change",
+		Description:     "Declare cache-busting ARGs right before the step that reads them. Clones of branches and ADDs of mutable URLs need a tag, commit or checksum, which only you know.",
+		Impact:          "Faster rebuilds",
+		Confidence:      models.ConfidenceMedium,
+		Priority:        2,
+		AutoFixable:     true,
+		RelatedIssueIDs: related,
+	}
+}
+
+func (s *CacheBustStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	edits := make(map[int]*lineEdit)
+	for _, b := range pdf.CacheBusts() {
+		if b.Kind != analyzer.CacheBustArg || b.Use == nil || len(strings.Fields(b.Instruction.Args)) != 1 {
+			continue
+		}
+		start, end := span(b.Instruction)
+		useStart, useEnd := span(*b.Use)
+		if edits[start] != nil || edits[useStart] != nil {
+			continue
+		}
+		edits[start] = &lineEdit{end: end}
+		moved := append(append([]string(nil), lines[start:end]...), lines[useStart:useEnd]...)
+		edits[useStart] = &lineEdit{end: useEnd, lines: moved}
+	}
+	return strings.Join(applyEdits(lines, edits), "\n"), nil
+}
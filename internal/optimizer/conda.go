@@ -0,0 +1,140 @@
+package optimizer
+
+import (
+	"path"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- CondaStrategy ---
+// Cleans the conda package cache in the RUN that fills it (DIO031) and,
+// when the final stage only creates an environment from an environment
+// file on a conda image (DIO030), creates it with micromamba in a conda-env
+// stage and copies just the environment into a slim Debian image.
+
+type CondaStrategy struct{}
+
+func (s *CondaStrategy) Name() string { return "conda" }
+
+func (s *CondaStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	related := reportedIssues(ctx.Analysis, "DIO030", "DIO031")
+	if len(related) == 0 || ctx.Windows {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-CONDA",
+		Category:        "multi-stage",
+		Title:           "Slim down conda environments",
+		Description:     "Run conda clean -afy in the RUN that installs packages, and build the environment with micromamba in a separate stage so only the environment reaches the final image.",
+		Impact:          "Hundreds of MB for the package cache; GBs for Anaconda images",
+		EstimatedBytes:  300 << 20,
+		Confidence:      models.ConfidenceLow,
+		Priority:        2,
+		AutoFixable:     true,
+		RelatedIssueIDs: related,
+	}
+}
+
+func (s *CondaStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	if len(reportedIssues(ctx.Analysis, "DIO030")) > 0 {
+		lines = isolateCondaEnv(lines, ctx)
+	}
+	lines = addCondaClean(lines, ctx)
+	return strings.Join(lines, "\n"), nil
+}
+
+const (
+	// condaEnvStage is the stage that creates the conda environment.
+	condaEnvStage = "conda-env"
+	// micromambaImage is the image of condaEnvStage. Its user can write
+	// under /opt/conda only.
+	micromambaImage = "mambaorg/micromamba:1.5.10"
+	// condaRuntimeImage is the image the environment is copied into.
+	condaRuntimeImage = "debian:bookworm-slim"
+)
+
+// addCondaClean appends the tool's clean command to the RUN instructions
+// of the final stage that leave conda's package cache behind.
+func addCondaClean(lines []string, ctx *OptimizationContext) []string {
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	chain := pdf.StageChain(pdf.FinalStage())
+	edits := make(map[int]*lineEdit)
+	for _, stage := range chain {
+		for _, inst := range stage.Instructions {
+			if !analyzer.CondaCacheLeft(inst) || strings.HasPrefix(strings.TrimSpace(inst.Args), "[") || strings.Contains(inst.Args, "<<") {
+				continue
+			}
+			start, end := span(inst)
+			edited := append([]string(nil), lines[start:end]...)
+			edited[len(edited)-1] += " && \\"
+			edited = append(edited, "    "+analyzer.CondaCleanCommand(analyzer.CondaTool(inst.Args)))
+			edits[start] = &lineEdit{end: end, lines: edited}
+		}
+	}
+	return applyEdits(lines, edits)
+}
+
+// isolateCondaEnv moves the creation of the final stage's conda
+// environment into a micromamba stage and bases the final stage on a slim
+// image that gets the environment only.
+func isolateCondaEnv(lines []string, ctx *OptimizationContext) []string {
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	env := pdf.CondaEnvFileOf()
+	if env == nil || pdf.StageIndex(condaEnvStage) >= 0 {
+		return lines
+	}
+	stage := pdf.Stages[pdf.FinalStage()]
+
+	name := "app"
+	fields := strings.Fields(env.Run.Args)
+	for i, f := range fields {
+		if (f == "-n" || f == "--name") && i+1 < len(fields) {
+			name = strings.Trim(fields[i+1], `"'`)
+		}
+	}
+	prefix := "/opt/conda/envs/" + name
+	file := "/tmp/" + path.Base(env.Source)
+	builder := []string{
+		"FROM " + micromambaImage + " AS " + condaEnvStage,
+		"COPY --chown=$MAMBA_USER:$MAMBA_USER " + env.Source + " " + file,
+		"RUN micromamba create -y -p " + prefix + " -f " + file + " && \\",
+		"    " + analyzer.CondaCleanCommand("micromamba"),
+	}
+
+	edits := make(map[int]*lineEdit)
+	edits[stage.StartLine-1] = &lineEdit{end: stage.StartLine, lines: []string{withFromImage(lines[stage.StartLine-1], condaRuntimeImage)}}
+	for _, inst := range stage.Instructions[1:] {
+		start, end := span(inst)
+		switch {
+		case inst.Line == env.Run.Line:
+			edits[start] = &lineEdit{end: end, lines: []string{
+				"COPY --from=" + condaEnvStage + " " + prefix + " " + prefix,
+				`ENV PATH="` + prefix + `/bin:$PATH"`,
+			}}
+		case inst.Command == "COPY" && copiesOnly(inst, env.Source):
+			// The environment file is only needed to create the environment
+			edits[start] = &lineEdit{end: end}
+		}
+	}
+	return insertStage(lines, stage, builder, edits)
+}
+
+// copiesOnly reports whether a COPY copies the single file src from the
+// build context.
+func copiesOnly(inst analyzer.Instruction, src string) bool {
+	var paths []string
+	for _, f := range strings.Fields(inst.Args) {
+		if strings.HasPrefix(f, "--from") {
+			return false
+		}
+		if !strings.HasPrefix(f, "--") {
+			paths = append(paths, f)
+		}
+	}
+	return len(paths) == 2 && path.Clean(paths[0]) == path.Clean(src)
+}
@@ -0,0 +1,81 @@
+package optimizer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- CopyChownStrategy ---
+// Fixes DIO041: moves a chown -R or chmod -R of copied files into the COPY,
+// as --chown or --chmod, and leaves the RUN to change the directory itself,
+// which COPY doesn't change when it already exists.
+
+type CopyChownStrategy struct{}
+
+func (s *CopyChownStrategy) Name() string { return "copy-chown" }
+
+func (s *CopyChownStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	related := reportedIssues(ctx.Analysis, "DIO041")
+	if len(related) == 0 {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-COPY-CHOWN",
+		Category:        "layer-optimization",
+		Title:           "Set owners and modes while copying",
+		Description:     "Use COPY --chown and --chmod instead of a chown -R or chmod -R in a later RUN, which stores every copied file a second time.",
+		Impact:          "Saves the size of the copied files; dio run measures the duplicated bytes",
+		EstimatedBytes:  50 << 20,
+		Confidence:      models.ConfidenceHigh,
+		Priority:        2,
+		AutoFixable:     true,
+		RelatedIssueIDs: related,
+	}
+}
+
+// copyKeywordRegex matches the COPY keyword starting an instruction.
+var copyKeywordRegex = regexp.MustCompile(`(?i)^(\s*COPY)(\s)`)
+
+func (s *CopyChownStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	edits := make(map[int]*lineEdit)
+	chmod := false
+	for _, c := range pdf.ChownedCopies() {
+		if !c.Fixable || c.Command == "chmod" && !syntaxSupported(lines, analyzer.FeatureCopyChmod) {
+			continue
+		}
+		chmod = chmod || c.Command == "chmod"
+		start, end := span(c.Run)
+		if edits[start] != nil {
+			continue
+		}
+		edits[start] = &lineEdit{end: end, lines: []string{fmt.Sprintf("RUN %s %s %s", c.Command, c.Value, c.Target)}}
+		for _, cp := range c.Copies {
+			first := cp.Line - 1
+			if edits[first] != nil {
+				// Already edited for the other command: COPY --chown and
+				// --chmod can go together
+				edits[first].lines[0] = copyKeywordRegex.ReplaceAllString(edits[first].lines[0], "${1} "+c.Flag()+"${2}")
+				continue
+			}
+			copyStart, copyEnd := span(cp)
+			edited := append([]string(nil), lines[copyStart:copyEnd]...)
+			edited[0] = copyKeywordRegex.ReplaceAllString(edited[0], "${1} "+c.Flag()+"${2}")
+			edits[copyStart] = &lineEdit{end: copyEnd, lines: edited}
+		}
+	}
+	if len(edits) == 0 {
+		return ctx.CurrentContent, fmt.Errorf("no chown -R or chmod -R to move into a COPY")
+	}
+	lines = applyEdits(lines, edits)
+	if chmod {
+		lines = addSyntaxDirective(lines)
+	}
+	return strings.Join(lines, "\n"), nil
+}
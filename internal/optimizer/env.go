@@ -0,0 +1,145 @@
+package optimizer
+
+import (
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- EnvStrategy ---
+// Consolidates ENV instructions (DIO017): drops values overwritten before
+// use, moves constant ENVs above the COPY and ADD right before them, and
+// merges consecutive ENVs.
+
+type EnvStrategy struct{}
+
+func (s *EnvStrategy) Name() string { return "env-consolidation" }
+
+func (s *EnvStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	related := reportedIssues(ctx.Analysis, "DIO017")
+	if len(related) == 0 {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-ENV",
+		Category:        "layer-optimization",
+		Title:           "Consolidate ENV instructions",
+		Description:     "Remove ENV values overwritten before use, set constant ENVs before COPY, and merge consecutive ENVs into one.",
+		Impact:          "Fewer build steps, better cache hits",
+		Confidence:      models.ConfidenceHigh,
+		Priority:        3,
+		AutoFixable:     true,
+		RelatedIssueIDs: related,
+	}
+}
+
+func (s *EnvStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	lines = dropOverwrittenEnv(lines, ctx)
+	lines = hoistEnv(lines, ctx)
+	lines = mergeEnv(lines, ctx)
+	return strings.Join(lines, "\n"), nil
+}
+
+// lineEdit replaces lines[start:end] of a Dockerfile with lines.
+type lineEdit struct {
+	end   int
+	lines []string
+}
+
+// applyEdits applies edits keyed by the first line they replace.
+func applyEdits(lines []string, edits map[int]*lineEdit) []string {
+	var out []string
+	for i := 0; i < len(lines); {
+		if e, ok := edits[i]; ok {
+			out = append(out, e.lines...)
+			i = e.end
+			continue
+		}
+		out = append(out, lines[i])
+		i++
+	}
+	return out
+}
+
+// renderEnv writes an ENV instruction setting vars, one per line when
+// there are several.
+func renderEnv(vars []analyzer.EnvVar, escape byte) []string {
+	if len(vars) == 0 {
+		return nil
+	}
+	parts := make([]string, len(vars))
+	for i, v := range vars {
+		parts[i] = v.String()
+	}
+	return strings.Split("ENV "+strings.Join(parts, " "+string(escape)+"\n    "), "\n")
+}
+
+// span returns the lines of an instruction as a [start, end) range.
+func span(inst analyzer.Instruction) (int, int) {
+	return inst.Line - 1, inst.EndLine
+}
+
+func dropOverwrittenEnv(lines []string, ctx *OptimizationContext) []string {
+	edits := make(map[int]*lineEdit)
+	for _, stage := range analyzer.ParseDockerfile(lines, ctx.Args).Stages {
+		drop := make(map[int]map[string]bool)
+		for _, o := range analyzer.OverwrittenEnvVars(stage) {
+			if drop[o.Index] == nil {
+				drop[o.Index] = make(map[string]bool)
+			}
+			drop[o.Index][o.Key] = true
+		}
+		for idx, keys := range drop {
+			inst := stage.Instructions[idx]
+			var keep []analyzer.EnvVar
+			for _, v := range analyzer.ParseEnv(inst.Args) {
+				if !keys[v.Key] {
+					keep = append(keep, v)
+				}
+			}
+			start, end := span(inst)
+			edits[start] = &lineEdit{end: end, lines: renderEnv(keep, ctx.Escape)}
+		}
+	}
+	return applyEdits(lines, edits)
+}
+
+func hoistEnv(lines []string, ctx *OptimizationContext) []string {
+	edits := make(map[int]*lineEdit)
+	for _, stage := range analyzer.ParseDockerfile(lines, ctx.Args).Stages {
+		for _, h := range analyzer.HoistableEnv(stage) {
+			start, end := span(stage.Instructions[h.Index])
+			env := append([]string(nil), lines[start:end]...)
+			edits[start] = &lineEdit{end: end}
+
+			before, beforeEnd := span(stage.Instructions[h.Before])
+			e, ok := edits[before]
+			if !ok {
+				e = &lineEdit{end: beforeEnd, lines: append([]string(nil), lines[before:beforeEnd]...)}
+				edits[before] = e
+			}
+			// Keep hoisted ENVs in order, above the COPY
+			n := len(e.lines) - (beforeEnd - before)
+			e.lines = append(append(append([]string(nil), e.lines[:n]...), env...), e.lines[n:]...)
+		}
+	}
+	return applyEdits(lines, edits)
+}
+
+func mergeEnv(lines []string, ctx *OptimizationContext) []string {
+	edits := make(map[int]*lineEdit)
+	for _, stage := range analyzer.ParseDockerfile(lines, ctx.Args).Stages {
+		for _, run := range analyzer.EnvRuns(stage) {
+			var vars []analyzer.EnvVar
+			for _, inst := range stage.Instructions[run[0] : run[1]+1] {
+				vars = append(vars, analyzer.ParseEnv(inst.Args)...)
+			}
+			start, _ := span(stage.Instructions[run[0]])
+			_, end := span(stage.Instructions[run[1]])
+			edits[start] = &lineEdit{end: end, lines: renderEnv(vars, ctx.Escape)}
+		}
+	}
+	return applyEdits(lines, edits)
+}
@@ -0,0 +1,164 @@
+package optimizer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- StaticFrontendStrategy ---
+// Deletes the source maps front-end builds ship (DIO034) and, when the
+// final stage builds a front-end and serves it with Node.js (DIO033), turns
+// it into a build stage and serves its output from nginx.
+
+type StaticFrontendStrategy struct{}
+
+func (s *StaticFrontendStrategy) Name() string { return "static-frontend" }
+
+func (s *StaticFrontendStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	related := reportedIssues(ctx.Analysis, "DIO033", "DIO034")
+	if len(related) == 0 {
+		return nil
+	}
+	// The nginx stage that replaces the final stage runs as a user
+	pdf := analyzer.ParseDockerfile(ctx.Lines, ctx.Args)
+	pdf.Target = ctx.Target
+	if len(reportedIssues(ctx.Analysis, "DIO033")) > 0 && pdf.StaticFrontendOf() != nil {
+		related = append(related, reportedIssues(ctx.Analysis, "DIO006")...)
+	}
+	return &models.Optimization{
+		ID:              "OPT-STATIC-FRONTEND",
+		Category:        "multi-stage",
+		Title:           "Serve only the front-end build output",
+		Description:     "Copy only the dist or build directory into an unprivileged nginx alpine image instead of serving it from the Node.js image that built it, and delete source maps after the build.",
+		Impact:          "Hundreds of MB: node_modules, sources and Node.js stay in the build stage",
+		EstimatedBytes:  300 << 20,
+		Confidence:      models.ConfidenceMedium,
+		Priority:        1,
+		AutoFixable:     true,
+		RelatedIssueIDs: related,
+	}
+}
+
+func (s *StaticFrontendStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	if len(reportedIssues(ctx.Analysis, "DIO034")) > 0 {
+		lines = deleteSourceMaps(lines, ctx)
+	}
+	if len(reportedIssues(ctx.Analysis, "DIO033")) > 0 {
+		lines = serveStatically(lines, ctx)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+const (
+	// frontendStage is the name given to the stage that builds the
+	// front-end.
+	frontendStage = "frontend-build"
+	// staticImage serves the front-end. It runs nginx as staticUser and
+	// listens on staticPort rather than on 80.
+	staticImage = "nginxinc/nginx-unprivileged:1.27-alpine"
+	// staticUser is the UID and GID staticImage runs as.
+	staticUser = "101:101"
+	// staticPort is the port staticImage listens on by default, and the
+	// one used instead of privileged ports non-root nginx can't bind.
+	staticPort = "8080"
+	// staticRoot is where staticImage serves files from.
+	staticRoot = "/usr/share/nginx/html"
+)
+
+// globalInstallRegex matches a RUN that only installs a package globally,
+// and captures the package.
+var globalInstallRegex = regexp.MustCompile(`^(?:npm\s+(?:install|i)\s+(?:-g|--global)|yarn\s+global\s+add|pnpm\s+(?:add|install)\s+(?:-g|--global))\s+([\w@./-]+)$`)
+
+// staticServerPackages are the npm packages of the static servers.
+var staticServerPackages = map[string]string{
+	"serve": "serve", "http-server": "http-server", "sirv": "sirv-cli", "live-server": "live-server",
+}
+
+// deleteSourceMaps deletes the source maps after each front-end build
+// that writes them.
+func deleteSourceMaps(lines []string, ctx *OptimizationContext) []string {
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	edits := make(map[int]*lineEdit)
+	for _, b := range pdf.FrontendBuilds() {
+		if !b.SourceMaps || strings.HasPrefix(strings.TrimSpace(b.Run.Args), "[") || strings.Contains(b.Run.Args, "<<") {
+			continue
+		}
+		start, end := span(b.Run)
+		edited := append([]string(nil), lines[start:end]...)
+		edited[len(edited)-1] += " && \\"
+		edited = append(edited, "    find "+b.Output+" -name '*.map' -delete")
+		edits[start] = &lineEdit{end: end, lines: edited}
+	}
+	return applyEdits(lines, edits)
+}
+
+// serveStatically makes the final stage a build stage, without the
+// install of the static server, and adds a non-root nginx stage that serves
+// its output on the same port, or on staticPort instead of a privileged
+// one.
+func serveStatically(lines []string, ctx *OptimizationContext) []string {
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	site := pdf.StaticFrontendOf()
+	if site == nil || pdf.StageIndex(frontendStage) >= 0 {
+		return lines
+	}
+	stage := pdf.Stages[pdf.FinalStage()]
+
+	name := stage.Name
+	edits := make(map[int]*lineEdit)
+	if name == "" {
+		name = frontendStage
+		edits[stage.StartLine-1] = &lineEdit{end: stage.StartLine, lines: []string{lines[stage.StartLine-1] + " AS " + name}}
+	}
+	// The health check probes the same port on the new stage
+	var healthcheck []string
+	for _, inst := range stage.Instructions[1:] {
+		start, end := span(inst)
+		switch inst.Command {
+		case "HEALTHCHECK":
+			healthcheck = append([]string(nil), lines[start:end]...)
+			fallthrough
+		case "CMD", "ENTRYPOINT", "EXPOSE":
+			edits[start] = &lineEdit{end: end}
+		case "RUN":
+			if m := globalInstallRegex.FindStringSubmatch(strings.TrimSpace(inst.Args)); m != nil && m[1] == staticServerPackages[site.Server.Server] {
+				edits[start] = &lineEdit{end: end}
+			}
+		}
+	}
+	lines = applyEdits(lines, edits)
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	lines = append(lines, "", "FROM "+staticImage, "COPY --from="+name+" "+site.Server.Dir+" "+staticRoot)
+	port := site.Server.Port
+	if n, err := strconv.Atoi(port); err != nil || n < 1024 {
+		port = staticPort
+		// The health check probes the new port
+		if site.Server.Port != "" {
+			for i, line := range healthcheck {
+				healthcheck[i] = strings.ReplaceAll(line, "localhost:"+site.Server.Port, "localhost:"+port)
+			}
+		}
+	}
+	if port != staticPort || site.Server.SPA {
+		location := ""
+		if site.Server.SPA {
+			// Client-side routes are answered with the app
+			location = `\n    location / {\n        try_files $uri $uri/ /index.html;\n    }`
+		}
+		lines = append(lines, fmt.Sprintf(`RUN printf 'server {\n    listen %s;\n    root %s;%s\n}\n' > /etc/nginx/conf.d/default.conf`, port, staticRoot, location))
+	}
+	lines = append(lines, "USER "+staticUser, "EXPOSE "+port)
+	lines = append(lines, healthcheck...)
+	return append(lines, "")
+}
@@ -0,0 +1,64 @@
+package optimizer_test
+
+import (
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/optimizer"
+	"github.com/maxlar/docker-image-optimizer/internal/testutil"
+)
+
+func TestStrategies_Golden(t *testing.T) {
+	testutil.RunStrategies(t, optimizer.Strategies(), testutil.Cases(t, "testdata/cases"))
+}
+
+func TestMirrorStrategy_Golden(t *testing.T) {
+	mirrors := config.MirrorsConfig{
+		Registries: map[string]string{"docker.io": "registry-mirror.corp", "gcr.io": "registry-mirror.corp/gcr"},
+		Apt:        "http://apt-mirror.corp",
+		Apk:        "https://apk-mirror.corp/alpine",
+		Pip:        "https://pypi-mirror.corp/simple",
+		Npm:        "https://npm-mirror.corp",
+	}
+	testutil.RunStrategies(t, []optimizer.Strategy{&optimizer.MirrorStrategy{Mirrors: mirrors}}, []testutil.Case{
+		{Name: "mirror-multistage", Dockerfile: "FROM node:20-alpine AS build\nRUN apk add --no-cache git\nRUN npm ci\nFROM gcr.io/distroless/nodejs20\nCOPY --from=build /app /app\n"},
+		{Name: "mirror-debian", Dockerfile: "FROM python:3.12-slim\nRUN apt-get update && apt-get install -y gcc\nRUN pip install -r requirements.txt\n"},
+		{Name: "mirror-stage-index", Dockerfile: "FROM golang:1.22\nRUN go build -o /app .\nFROM alpine:3.19\nCOPY --from=0 /app /app\nCOPY --from=busybox:1.36 /bin/busybox /bin/busybox\n"},
+		{Name: "mirror-unmirrored", Dockerfile: "FROM quay.io/org/app:1.0\nCOPY --from=ghcr.io/org/tools:1 /bin/tool /bin/tool\n"},
+		{Name: "mirror-applied", Dockerfile: "FROM registry-mirror.corp/library/alpine:3.19\nRUN sed -i 's|https\\?://dl-cdn.alpinelinux.org/alpine|https://apk-mirror.corp/alpine|g' /etc/apk/repositories\nRUN apk add curl\n"},
+	})
+}
+
+func TestBaseImageStrategy_GoldenImages(t *testing.T) {
+	golden := []config.GoldenImage{
+		{Name: "registry.corp/golden/node", Tags: []string{"20", "22"}, Runtimes: []string{"node"}},
+		{Name: "registry.corp/golden/static", Tags: []string{"1.4"}, Runtimes: []string{"go", "rust"}},
+		{Name: "registry.corp/golden/debian", Tags: []string{"12"}},
+	}
+	testutil.RunStrategies(t, []optimizer.Strategy{&optimizer.BaseImageStrategy{Golden: golden}}, []testutil.Case{
+		{Name: "catalog-node", Dockerfile: "FROM node:20\nCOPY . /app\nCMD [\"node\", \"/app/server.js\"]\n"},
+		{Name: "catalog-go-multistage", Dockerfile: "FROM golang:1.22 AS build\nRUN go build -o /app .\nFROM alpine:3.19 AS runtime\nCOPY --from=build /app /app\nENTRYPOINT [\"/app\"]\n"},
+		{Name: "catalog-fallback", Dockerfile: "FROM ubuntu:22.04\nCOPY run.sh /run.sh\nCMD [\"/run.sh\"]\n"},
+		{Name: "catalog-unapproved-tag", Dockerfile: "FROM registry.corp/golden/node:18\nCMD [\"node\", \"server.js\"]\n"},
+	})
+}
+
+func TestStripDocsStrategy_Golden(t *testing.T) {
+	const multistage = "FROM golang:1.22 AS build\nRUN apt-get update && apt-get install -y git\nFROM ubuntu:24.04\nRUN apt-get update && apt-get install -y --no-install-recommends ca-certificates curl && \\\n    rm -rf /var/lib/apt/lists/*\nRUN apt-get update && apt-get install -y tzdata\nCOPY --from=build /go/bin/app /app\n"
+	testutil.RunStrategies(t, []optimizer.Strategy{&optimizer.StripDocsStrategy{Config: config.StripConfig{KeepLocales: []string{"de"}}}}, []testutil.Case{
+		{Name: "strip-docs-dpkg", Dockerfile: multistage},
+		{Name: "strip-docs-slim", Dockerfile: "FROM debian:bookworm-slim\nRUN apt-get update && apt-get install -y curl\n"},
+	})
+	testutil.RunStrategies(t, []optimizer.Strategy{&optimizer.StripDocsStrategy{Config: config.StripConfig{Method: "remove"}}}, []testutil.Case{
+		{Name: "strip-docs-remove", Dockerfile: multistage},
+	})
+}
+
+func TestRuntimeDataStrategy_Golden(t *testing.T) {
+	testutil.RunStrategies(t, []optimizer.Strategy{&optimizer.RuntimeDataStrategy{}}, []testutil.Case{
+		{Name: "runtime-data-scratch", Dockerfile: "FROM golang:1.22 AS build\nRUN apt-get update && apt-get install -y ca-certificates\nRUN go build -o /app .\nFROM scratch\nENV TZ=Europe/Berlin\nCOPY --from=build /app /app\nENTRYPOINT [\"/app\"]\n"},
+		{Name: "runtime-data-alpine", Dockerfile: "FROM alpine:3.20\nENV TZ=America/New_York\nCOPY app /app\nCMD [\"/app\"]\n"},
+		{Name: "runtime-data-debian", Dockerfile: "ARG BASE=debian:12\nFROM node:20 AS build\nRUN npm ci\nFROM ${BASE}\nENV TZ=Asia/Tokyo\nCOPY --from=build /app /app\nCMD [\"/app/run\", \"https://api.example.com\"]\n"},
+		{Name: "runtime-data-present", Dockerfile: "FROM alpine:3.20\nRUN apk add --no-cache tzdata\nENV TZ=Europe/Paris\nCMD [\"/app\"]\n"},
+	})
+}
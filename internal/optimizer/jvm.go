@@ -0,0 +1,136 @@
+package optimizer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- JVMRuntimeStrategy ---
+// Replaces the full JDK under a Java application (DIO032) with a runtime
+// jlink builds in a jre-build stage from the modules jdeps finds in the
+// jar, copied into a slim image.
+
+type JVMRuntimeStrategy struct{}
+
+func (s *JVMRuntimeStrategy) Name() string { return "jvm-runtime" }
+
+func (s *JVMRuntimeStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	related := reportedIssues(ctx.Analysis, "DIO032")
+	if len(related) == 0 {
+		return nil
+	}
+	pdf := analyzer.ParseDockerfile(ctx.Lines, ctx.Args)
+	pdf.Target = ctx.Target
+	app := pdf.JavaApp()
+	if app == nil {
+		return nil
+	}
+	jdk, runtime := app.Sizes()
+	description := "Build a custom Java runtime with jlink, from the modules jdeps finds in the application jar, and copy it into a slim image instead of running on the full JDK."
+	if app.SpringBoot {
+		description += " For Spring Boot, extracting the jar's layers (-Djarmode=tools extract --layers) in the build stage and copying them one by one also keeps dependencies cached across releases."
+	}
+	return &models.Optimization{
+		ID:              "OPT-JVM-RUNTIME",
+		Category:        "multi-stage",
+		Title:           "Replace the JDK with a jlink runtime",
+		Description:     description,
+		Impact:          fmt.Sprintf("~%d MB: a runtime of about %d MB for %d modules instead of a %d MB JDK", jdk-runtime, runtime, len(app.Modules), jdk),
+		EstimatedBytes:  int64(jdk-runtime) << 20,
+		Confidence:      models.ConfidenceLow,
+		Priority:        2,
+		AutoFixable:     app.Linkable(),
+		RelatedIssueIDs: related,
+	}
+}
+
+func (s *JVMRuntimeStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	app := pdf.JavaApp()
+	if app == nil || !app.Linkable() || pdf.StageIndex(jreStage) >= 0 {
+		return ctx.CurrentContent, nil
+	}
+	stage := pdf.Stages[pdf.FinalStage()]
+
+	copyJar := "COPY "
+	if app.From != "" {
+		copyJar += "--from=" + app.From + " "
+	}
+	builder := []string{
+		"FROM " + fromImageRef(lines[stage.StartLine-1]) + " AS " + jreStage,
+		copyJar + app.Source + " /tmp/app.jar",
+		// jdeps needs the dependencies of fat jars, such as Spring Boot's
+		// BOOT-INF/lib, on the class path
+		"RUN mkdir /tmp/jar && cd /tmp/jar && jar xf /tmp/app.jar && \\",
+		fmt.Sprintf("    jdeps --ignore-missing-deps -q --recursive --multi-release %d --print-module-deps \\", app.Version),
+		`      --class-path "$(find /tmp/jar -name '*.jar' | tr '\n' ':')" /tmp/app.jar > /tmp/modules && \`,
+		`    jlink --add-modules "$(cat /tmp/modules),` + strings.Join(namedModules(app.Version), ",") + `" \`,
+		"      --strip-debug --no-man-pages --no-header-files " + jlinkCompress(app.Version) + " \\",
+		"      --output " + jreOutput,
+	}
+
+	alpine := strings.Contains(strings.ToLower(app.JDK), "alpine")
+	from := []string{withFromImage(lines[stage.StartLine-1], "debian:bookworm-slim")}
+	if alpine {
+		from[0] = withFromImage(lines[stage.StartLine-1], "alpine:3.20")
+	}
+	from = append(from,
+		"ENV JAVA_HOME="+javaHome+" \\",
+		`    PATH="`+javaHome+`/bin:$PATH"`,
+		"COPY --from="+jreStage+" "+jreOutput+" "+javaHome,
+	)
+	// The JDK images have curl and wget, the slim ones don't
+	var tools []string
+	for _, tool := range []string{"curl", "wget"} {
+		for _, inst := range stage.Instructions[1:] {
+			if strings.Contains(" "+inst.Args+" ", " "+tool+" ") {
+				tools = append(tools, tool)
+				break
+			}
+		}
+	}
+	switch {
+	case len(tools) == 0:
+	case alpine:
+		from = append(from, "RUN apk add --no-cache "+strings.Join(tools, " "))
+	default:
+		from = append(from, "RUN apt-get update && apt-get install -y --no-install-recommends "+strings.Join(tools, " ")+" && rm -rf /var/lib/apt/lists/*")
+	}
+	edits := map[int]*lineEdit{stage.StartLine - 1: {end: stage.StartLine, lines: from}}
+	return strings.Join(insertStage(lines, stage, builder, edits), "\n"), nil
+}
+
+const (
+	// jreStage is the stage that builds the Java runtime.
+	jreStage = "jre-build"
+	// jreOutput is where jlink writes the runtime in the jre-build stage.
+	// It must not exist: in the JDK images javaHome is the JDK itself.
+	jreOutput = "/tmp/jre"
+	// javaHome is where the runtime goes, the JAVA_HOME of the Temurin
+	// images.
+	javaHome = "/opt/java/openjdk"
+)
+
+// namedModules returns the modules applications load by name, which jdeps
+// can't find: the elliptic curve provider TLS needs (part of java.base
+// since Java 22) and the zip file system.
+func namedModules(version int) []string {
+	if version >= 22 {
+		return []string{"jdk.zipfs"}
+	}
+	return []string{"jdk.crypto.ec", "jdk.zipfs"}
+}
+
+// jlinkCompress returns the jlink compression option for a Java version;
+// Java 21 replaced the numeric levels.
+func jlinkCompress(version int) string {
+	if version >= 21 {
+		return "--compress=zip-6"
+	}
+	return "--compress=2"
+}
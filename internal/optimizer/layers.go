@@ -0,0 +1,81 @@
+package optimizer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- CombineLayersStrategy ---
+// Merges each block of consecutive RUN instructions into one. Only shell
+// form RUNs without flags or heredocs are merged, a RUN whose script would
+// change what the commands merged after it do ends its block, and the
+// comments between the RUNs of a block are moved above the merged RUN.
+
+type CombineLayersStrategy struct{}
+
+func (s *CombineLayersStrategy) Name() string { return "combine-layers" }
+
+func (s *CombineLayersStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	if len(runBlocks(ctx.Lines, ctx.Args)) == 0 {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-LAYERS",
+		Category:        "layer-optimization",
+		Title:           "Combine consecutive RUN commands",
+		Description:     "Multiple consecutive RUN commands can be merged to reduce layers.",
+		Impact:          "10-20% size reduction",
+		EstimatedBytes:  30 << 20,
+		Confidence:      models.ConfidenceMedium,
+		Priority:        3,
+		AutoFixable:     true,
+		RelatedIssueIDs: reportedIssues(ctx.Analysis, "DIO003", "DIO010"),
+	}
+}
+
+func (s *CombineLayersStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	blocks := runBlocks(lines, ctx.Args)
+	if len(blocks) == 0 {
+		return ctx.CurrentContent, fmt.Errorf("no consecutive RUN instructions to combine")
+	}
+	continuation := commandSeparator(ctx) + " " + string(ctx.Escape)
+
+	var result []string
+	next := 0
+	for _, block := range blocks {
+		result = append(result, lines[next:block[0].Line-1]...)
+		var comments, merged []string
+		for i, run := range block {
+			body := append([]string(nil), lines[run.Line-1:run.EndLine]...)
+			if i == 0 {
+				merged = body
+				continue
+			}
+			for _, line := range lines[block[i-1].EndLine : run.Line-1] {
+				if strings.HasPrefix(strings.TrimSpace(line), "#") {
+					comments = append(comments, line)
+				}
+			}
+			// Drop the RUN keyword
+			body[0] = "    " + strings.TrimSpace(strings.TrimSpace(body[0])[len("RUN"):])
+			last := len(merged) - 1
+			merged[last] = strings.TrimRight(merged[last], " \t") + continuation
+			merged = append(merged, body...)
+		}
+		result = append(result, comments...)
+		result = append(result, merged...)
+		next = block[len(block)-1].EndLine
+	}
+	result = append(result, lines[next:]...)
+	return strings.Join(result, "\n"), nil
+}
+
+// runBlocks returns the blocks of consecutive RUN instructions that can
+// be merged into one.
+func runBlocks(lines []string, args map[string]string) [][]analyzer.Instruction {
+	return analyzer.RunBlocks(analyzer.ParseDockerfile(lines, args))
+}
@@ -0,0 +1,177 @@
+package optimizer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- MirrorStrategy ---
+// Rewrites base images and package sources to internal pull-through caches
+// and mirrors, configured under mirrors in .dio.yaml.
+
+type MirrorStrategy struct {
+	Mirrors config.MirrorsConfig
+}
+
+func (s *MirrorStrategy) Name() string { return "mirror" }
+
+// Upstream package sources replaced by the apt and apk mirrors.
+var (
+	aptSources = []string{"deb.debian.org", "security.debian.org", "archive.ubuntu.com", "security.ubuntu.com"}
+	apkSource  = "dl-cdn.alpinelinux.org"
+)
+
+func (s *MirrorStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	if ctx.Windows {
+		return nil
+	}
+	_, changes := s.rewrite(ctx.Lines)
+	if len(changes) == 0 {
+		return nil
+	}
+	return &models.Optimization{
+		ID:          "OPT-MIRROR",
+		Category:    "best-practice",
+		Title:       "Pull through the internal mirrors",
+		Description: strings.Join(changes, "; ") + ".",
+		Impact:      "Faster, cached CI builds without egress to public registries",
+		Confidence:  models.ConfidenceHigh,
+		Priority:    3,
+		AutoFixable: true,
+	}
+}
+
+func (s *MirrorStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines, changes := s.rewrite(strings.Split(ctx.CurrentContent, "\n"))
+	if len(changes) == 0 {
+		return ctx.CurrentContent, fmt.Errorf("nothing to rewrite")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// rewrite points the FROM and COPY --from images at the registry mirrors
+// and, in each stage that installs packages, the package managers at theirs.
+// It returns the rewritten lines and a description of each change.
+func (s *MirrorStrategy) rewrite(lines []string) ([]string, []string) {
+	var out, changes []string
+	stages := make(map[string]bool)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			out = append(out, line)
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FROM":
+			ref := fromImageRef(line)
+			if mirrored := mirrorImage(ref, s.Mirrors.Registries); mirrored != "" && !stages[strings.ToLower(ref)] {
+				line = strings.Replace(line, ref, mirrored, 1)
+				changes = append(changes, fmt.Sprintf("pull %s through %s", ref, mirrored))
+			}
+			if n := len(fields); n >= 4 && strings.EqualFold(fields[n-2], "AS") {
+				stages[strings.ToLower(fields[n-1])] = true
+			}
+			out = append(out, line)
+			end := stageEnd(lines, i)
+			add, what := s.packageSources(lines[i+1 : end])
+			out = append(out, add...)
+			changes = append(changes, what...)
+		case "COPY":
+			for _, f := range fields[1:] {
+				// A numeric --from is the index of a stage
+				ref, ok := strings.CutPrefix(f, "--from=")
+				if !ok || stages[strings.ToLower(ref)] || isStageIndex(ref) {
+					continue
+				}
+				if mirrored := mirrorImage(ref, s.Mirrors.Registries); mirrored != "" {
+					line = strings.Replace(line, f, "--from="+mirrored, 1)
+					changes = append(changes, fmt.Sprintf("copy from %s through %s", ref, mirrored))
+				}
+			}
+			out = append(out, line)
+		default:
+			out = append(out, line)
+		}
+	}
+	return out, changes
+}
+
+// isStageIndex reports whether a --from reference is a stage index.
+func isStageIndex(ref string) bool {
+	_, err := strconv.Atoi(ref)
+	return err == nil
+}
+
+// packageSources returns the instructions to add at the start of a stage so
+// that its package installs use the mirrors, with a description of each.
+// Stages already using a mirror are left alone.
+func (s *MirrorStrategy) packageSources(stage []string) ([]string, []string) {
+	body := strings.ToLower(strings.Join(stage, "\n"))
+	// mirrored reports whether the stage already uses the mirror m
+	mirrored := func(m string) bool { return strings.Contains(body, strings.ToLower(m)) }
+	var add, changes []string
+	if m := s.Mirrors.Apt; m != "" && strings.Contains(body, "apt-get ") && !mirrored(m) {
+		var expr []string
+		for _, src := range aptSources {
+			expr = append(expr, fmt.Sprintf("-e 's|https\\?://%s|%s|g'", src, strings.TrimSuffix(m, "/")))
+		}
+		add = append(add, "RUN find /etc/apt -name '*.list' -o -name '*.sources' | xargs -r sed -i "+strings.Join(expr, " "))
+		changes = append(changes, "install apt packages from "+m)
+	}
+	if m := s.Mirrors.Apk; m != "" && strings.Contains(body, "apk add") && !mirrored(m) {
+		add = append(add, fmt.Sprintf("RUN sed -i 's|https\\?://%s/alpine|%s|g' /etc/apk/repositories", apkSource, strings.TrimSuffix(m, "/")))
+		changes = append(changes, "install apk packages from "+m)
+	}
+	// Build args are set in the environment of RUN but not in the image
+	if m := s.Mirrors.Pip; m != "" && (strings.Contains(body, "pip install") || strings.Contains(body, "pip3 install")) && !mirrored(m) {
+		add = append(add, "ARG PIP_INDEX_URL="+m)
+		changes = append(changes, "install pip packages from "+m)
+	}
+	if m := s.Mirrors.Npm; m != "" && (strings.Contains(body, "npm install") || strings.Contains(body, "npm ci")) && !mirrored(m) {
+		add = append(add, "ARG NPM_CONFIG_REGISTRY="+m)
+		changes = append(changes, "install npm packages from "+m)
+	}
+	return add, changes
+}
+
+// stageEnd returns the index of the FROM line after the stage starting at
+// from, or len(lines).
+func stageEnd(lines []string, from int) int {
+	for i := from + 1; i < len(lines); i++ {
+		if fields := strings.Fields(lines[i]); len(fields) > 0 && strings.EqualFold(fields[0], "FROM") {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// mirrorImage returns ref pulled through the mirror of its registry, e.g.
+// registry-mirror.corp/library/node:20-alpine for node:20-alpine with
+// docker.io mirrored to registry-mirror.corp. It returns "" when the
+// registry has no mirror or ref can't be rewritten.
+func mirrorImage(ref string, registries map[string]string) string {
+	if ref == "" || ref == "scratch" || strings.Contains(ref, "$") {
+		return ""
+	}
+	registry, path := "docker.io", ref
+	if host, rest, ok := strings.Cut(ref, "/"); ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		registry, path = host, rest
+	}
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io":
+		registry = "docker.io"
+	}
+	mirror, ok := registries[registry]
+	if !ok || mirror == "" {
+		return ""
+	}
+	if registry == "docker.io" && !strings.Contains(path, "/") {
+		path = "library/" + path
+	}
+	return strings.TrimSuffix(mirror, "/") + "/" + path
+}
@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/config"
 	"github.com/maxlar/docker-image-optimizer/internal/models"
 )
 
@@ -25,53 +27,270 @@ const (
 
 // Optimizer is the core optimization engine.
 type Optimizer struct {
-	mode       Mode
-	strategies []Strategy
+	mode              Mode
+	strategies        []Strategy
+	buildArgs         map[string]string
+	target            string
+	writeDockerignore bool
+	buildCheck        func(dockerfile string) error
+	// analyzer finds the issues the strategies fix
+	analyzer *analyzer.Analyzer
 }
 
 // New creates a new Optimizer with all built-in strategies registered.
 func New(mode Mode) *Optimizer {
-	return &Optimizer{
-		mode: mode,
-		strategies: []Strategy{
-			&BaseImageStrategy{},
-			&CombineLayersStrategy{},
-			&MultiStageStrategy{},
-			&CacheOptStrategy{},
-			&NonRootUserStrategy{},
-			&CleanupStrategy{},
-			&WorkdirStrategy{},
-		},
+	return NewWithStrategies(mode, Strategies()...)
+}
+
+// NewWithConfig creates an Optimizer with the built-in strategies and those
+// enabled in the configuration, such as doc stripping and mirror rewriting. A golden image
+// catalog replaces the public slim images BaseImageStrategy suggests, and
+// the optimizer settings choose the base image variant, the non-root user
+// and the working directory autofix writes. The issues are found with the
+// ruleset and rule options of the configuration.
+func NewWithConfig(mode Mode, cfg *config.Config) (*Optimizer, error) {
+	a, err := analyzer.NewWithConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	strategies := Strategies()
+	for _, s := range strategies {
+		switch s := s.(type) {
+		case *BaseImageStrategy:
+			s.Golden = cfg.GoldenImages.Images
+			s.Variant = cfg.Optimizer.BaseImage.Variant
+		case *NonRootUserStrategy:
+			s.User = cfg.Optimizer.User
+		case *WorkdirStrategy:
+			s.Path = cfg.Optimizer.Workdir
+		case *MultiStageStrategy:
+			s.User = cfg.Optimizer.User
+			s.Workdir = cfg.Optimizer.Workdir
+		}
+	}
+	if cfg.Strip.Enabled {
+		strategies = append(strategies, &StripDocsStrategy{Config: cfg.Strip})
+	}
+	if cfg.Mirrors.Enabled() {
+		// Last, so that it also rewrites images the other strategies add
+		strategies = append(strategies, &MirrorStrategy{Mirrors: cfg.Mirrors})
+	}
+	o := NewWithStrategies(mode, strategies...)
+	o.analyzer = a
+	return o, nil
+}
+
+// NewWithStrategies creates an Optimizer that applies only the given
+// strategies, in order, except that a strategy implementing Ordered is
+// moved after those it must follow.
+func NewWithStrategies(mode Mode, strategies ...Strategy) *Optimizer {
+	return &Optimizer{mode: mode, strategies: orderStrategies(strategies), analyzer: analyzer.New()}
+}
+
+// orderStrategies returns strategies in their order, with each moved after
+// the strategies its After names. Strategies it names that are not in the
+// list are ignored, and a cycle keeps the strategies in it in their order.
+func orderStrategies(strategies []Strategy) []Strategy {
+	index := make(map[string]int)
+	for i, s := range strategies {
+		index[s.Name()] = i
+	}
+	done := make([]bool, len(strategies))
+	ready := func(i int) bool {
+		o, ok := strategies[i].(Ordered)
+		if !ok {
+			return true
+		}
+		for _, name := range o.After() {
+			if j, ok := index[name]; ok && j != i && !done[j] {
+				return false
+			}
+		}
+		return true
+	}
+	ordered := make([]Strategy, 0, len(strategies))
+	for len(ordered) < len(strategies) {
+		next := -1
+		for i := range strategies {
+			if !done[i] && ready(i) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			// A cycle: take the first strategy left
+			for i := range strategies {
+				if !done[i] {
+					next = i
+					break
+				}
+			}
+		}
+		done[next] = true
+		ordered = append(ordered, strategies[next])
 	}
+	return ordered
+}
+
+// Strategies returns the built-in strategies in the order New applies
+// them.
+func Strategies() []Strategy {
+	return []Strategy{
+		&BaseImageStrategy{},
+		&CopyChownStrategy{},
+		// Before the RUNs are combined, so that it can drop the static
+		// server's install, and before the non-root user is added to the
+		// final stage it replaces
+		&StaticFrontendStrategy{},
+		&CombineLayersStrategy{},
+		&AptUpdateStrategy{},
+		&EnvStrategy{},
+		&MultiStageStrategy{},
+		&CacheOptStrategy{},
+		&CacheBustStrategy{},
+		&NonRootUserStrategy{},
+		&CleanupStrategy{},
+		&BuildPackagesStrategy{},
+		&WorkdirStrategy{},
+		&RuntimeDataStrategy{},
+		&HealthcheckStrategy{},
+		&DeadStageStrategy{},
+		&PythonDepsStrategy{},
+		&CondaStrategy{},
+		&JVMRuntimeStrategy{},
+		&StrictShellStrategy{},
+	}
+}
+
+// SetBuildArgs sets --build-arg values used to resolve ARG references in
+// FROM instructions.
+func (o *Optimizer) SetBuildArgs(args map[string]string) {
+	o.buildArgs = args
+	o.analyzer.SetBuildArgs(args)
+}
+
+// SetTarget sets the stage built with docker build --target. Strategies
+// that change the final stage change it instead of the last stage.
+func (o *Optimizer) SetTarget(stage string) {
+	o.target = stage
+	o.analyzer.SetTarget(stage)
 }
 
 // Optimize reads a Dockerfile, applies optimization strategies, and returns the result.
 func (o *Optimizer) Optimize(dockerfilePath string) (*models.OptimizationResult, error) {
+	return o.OptimizeAnalyzed(dockerfilePath, nil)
+}
+
+// OptimizeAnalyzed is Optimize for a Dockerfile the caller has analyzed
+// already, so the strategies work from that analysis instead of a second
+// one. A nil analysis analyzes the Dockerfile's content.
+func (o *Optimizer) OptimizeAnalyzed(dockerfilePath string, analysis *models.AnalysisResult) (*models.OptimizationResult, error) {
 	content, err := os.ReadFile(dockerfilePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read Dockerfile: %w", err)
 	}
+	if analysis == nil {
+		if analysis, err = o.analyzer.AnalyzeContent(string(content)); err != nil {
+			return nil, fmt.Errorf("analysis failed: %w", err)
+		}
+	}
+
+	result := o.optimize(string(content), analysis)
+	opt, err := o.dockerignore(dockerfilePath, string(content), result)
+	if err != nil {
+		return nil, err
+	}
+	if opt != nil {
+		result.Optimizations = append(result.Optimizations, *opt)
+		result.EstimatedReduction = estimateReduction(result.Optimizations)
+		rankOptimizations(result.Optimizations)
+	}
+	return result, nil
+}
 
-	return o.OptimizeContent(string(content))
+// SetBuildCheck sets a check, such as docker build --check, that each fix
+// applied in autofix mode must pass on top of the parser's. It is skipped
+// when the Dockerfile fails it before any fix.
+func (o *Optimizer) SetBuildCheck(check func(dockerfile string) error) {
+	o.buildCheck = check
+}
+
+// SetWriteDockerignore makes autofix mode generate a .dockerignore in the
+// build context when there is none (DIO002). An existing file is never
+// overwritten.
+func (o *Optimizer) SetWriteDockerignore(write bool) {
+	o.writeDockerignore = write
+}
+
+// dockerignore suggests a .dockerignore when the build context of the
+// Dockerfile has none, and writes it in autofix mode if enabled. A
+// Containerfile gets a .containerignore.
+func (o *Optimizer) dockerignore(dockerfilePath, content string, result *models.OptimizationResult) (*models.Optimization, error) {
+	dir := filepath.Dir(dockerfilePath)
+	if _, err := os.Stat(analyzer.IgnoreFile(dir)); !os.IsNotExist(err) {
+		return nil, nil
+	}
+	name := analyzer.IgnoreFileName(dockerfilePath)
+	path := filepath.Join(dir, name)
+	opt := &models.Optimization{
+		ID:              "OPT-DOCKERIGNORE",
+		Category:        "best-practice",
+		Title:           "Generate " + name,
+		Description:     "No .dockerignore found: the whole directory, including VCS data, dependencies and local secrets, is sent as build context.",
+		Impact:          "Smaller build context, faster builds",
+		Confidence:      models.ConfidenceHigh,
+		Priority:        2,
+		AutoFixable:     true,
+		RelatedIssueIDs: []string{"DIO002"},
+	}
+	if o.mode != ModeAutoFix || !o.writeDockerignore {
+		return opt, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	_, err = f.WriteString(analyzer.GenerateDockerignore(dir, content))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	opt.Applied = true
+	result.Dockerignore = path
+	return opt, nil
 }
 
 // OptimizeContent optimizes Dockerfile content from a string.
 func (o *Optimizer) OptimizeContent(content string) (*models.OptimizationResult, error) {
-	lines := strings.Split(content, "\n")
-	a := analyzer.New()
-	analysisResult, err := a.AnalyzeContent(content)
+	analysisResult, err := o.analyzer.AnalyzeContent(content)
 	if err != nil {
 		return nil, fmt.Errorf("analysis failed: %w", err)
 	}
+	return o.optimize(content, analysisResult), nil
+}
 
+// optimize runs the strategies on content, given its analysis.
+func (o *Optimizer) optimize(content string, analysisResult *models.AnalysisResult) *models.OptimizationResult {
+	lines := strings.Split(content, "\n")
 	ctx := &OptimizationContext{
 		OriginalContent: content,
 		Lines:           lines,
 		Analysis:        analysisResult,
 		CurrentContent:  content,
+		Escape:          analyzer.EscapeChar(lines),
+		Windows:         analysisResult.Windows,
+		Args:            analyzer.GlobalArgs(lines, o.buildArgs),
+		Target:          o.target,
 	}
 
 	var optimizations []models.Optimization
+	check := o.buildCheck
+	if o.mode == ModeAutoFix && check != nil && check(content) != nil {
+		check = nil
+	}
 
 	for _, strategy := range o.strategies {
 		opt := strategy.Analyze(ctx)
@@ -82,25 +301,88 @@ func (o *Optimizer) OptimizeContent(content string) (*models.OptimizationResult,
 		if o.mode == ModeAutoFix && opt.AutoFixable {
 			newContent, err := strategy.Apply(ctx)
 			if err == nil {
-				ctx.CurrentContent = newContent
-				ctx.Lines = strings.Split(newContent, "\n")
-				opt.Applied = true
+				// The output is parsed again, and a fix that breaks it is
+				// reported and dropped: the next strategies rewrite what
+				// this one leaves
+				err = validateOutput(ctx.CurrentContent, newContent, ctx.Args)
+				if err == nil && check != nil && newContent != ctx.CurrentContent {
+					err = check(newContent)
+				}
+				if err != nil {
+					opt.Rejected = err.Error()
+				} else {
+					ctx.CurrentContent = newContent
+					ctx.Lines = strings.Split(newContent, "\n")
+					opt.Applied = true
+				}
 			}
 		}
 
 		optimizations = append(optimizations, *opt)
 	}
+	// Strategies are applied in their order, which later ones depend on;
+	// the result lists the most worthwhile first
+	rankOptimizations(optimizations)
 
 	return &models.OptimizationResult{
 		OriginalDockerfile:  content,
 		OptimizedDockerfile: ctx.CurrentContent,
 		Optimizations:       optimizations,
 		EstimatedReduction:  estimateReduction(optimizations),
-	}, nil
+	}
 }
 
-// WriteOptimized writes the optimized Dockerfile to disk.
+// danglingStageRefs returns the references of after to stages of before
+// that after no longer defines ahead of them, such as a renamed or removed
+// stage. References that already dangled in before don't count.
+func danglingStageRefs(before, after string, args map[string]string) []string {
+	old := analyzer.ParseDockerfile(strings.Split(before, "\n"), args)
+	var names []string
+	for _, stage := range old.Stages {
+		if stage.Name != "" {
+			names = append(names, stage.Name)
+		}
+	}
+	existing := make(map[string]int)
+	for _, ref := range old.DanglingStageRefs(names) {
+		existing[strings.ToLower(ref)]++
+	}
+	var dangling []string
+	for _, ref := range analyzer.ParseDockerfile(strings.Split(after, "\n"), args).DanglingStageRefs(names) {
+		if existing[strings.ToLower(ref)] > 0 {
+			existing[strings.ToLower(ref)]--
+			continue
+		}
+		dangling = append(dangling, ref)
+	}
+	return dangling
+}
+
+// LinkIssues sets FixedByOptimization on each issue of the analysis that
+// an auto-fixable optimization resolves.
+func LinkIssues(analysis *models.AnalysisResult, optimizations []models.Optimization) {
+	fixedBy := make(map[string]string)
+	for _, opt := range optimizations {
+		if !opt.AutoFixable {
+			continue
+		}
+		for _, id := range opt.RelatedIssueIDs {
+			if _, ok := fixedBy[id]; !ok {
+				fixedBy[id] = opt.ID
+			}
+		}
+	}
+	for i := range analysis.Issues {
+		analysis.Issues[i].FixedByOptimization = fixedBy[analysis.Issues[i].ID]
+	}
+}
+
+// WriteOptimized writes the optimized Dockerfile to disk. An optimized
+// Dockerfile with parse errors the original doesn't have is not written.
 func (o *Optimizer) WriteOptimized(result *models.OptimizationResult, outputPath string) error {
+	if err := validateOutput(result.OriginalDockerfile, result.OptimizedDockerfile, o.buildArgs); err != nil {
+		return fmt.Errorf("invalid Dockerfile: %w", err)
+	}
 	dir := filepath.Dir(outputPath)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
@@ -114,6 +396,39 @@ type OptimizationContext struct {
 	Lines           []string
 	Analysis        *models.AnalysisResult
 	CurrentContent  string
+	// Escape is the Dockerfile line continuation character.
+	Escape byte
+	// Windows is set when the final image uses a Windows base image.
+	Windows bool
+	// Args holds the resolved ARGs available to FROM instructions.
+	Args map[string]string
+	// Target is the stage built with --target, which is then the final
+	// stage. Empty builds the last stage.
+	Target string
+}
+
+// confidenceWeights weigh the estimated savings of an optimization by how
+// likely it is to work without further edits.
+var confidenceWeights = map[string]float64{
+	models.ConfidenceHigh:   1,
+	models.ConfidenceMedium: 0.6,
+	models.ConfidenceLow:    0.3,
+}
+
+// rankOptimizations sorts optimizations by expected impact, their estimated
+// savings weighed by their confidence, then by priority. Optimizations that
+// save no size, like security fixes, come after those that do.
+func rankOptimizations(optimizations []models.Optimization) {
+	expected := func(o models.Optimization) float64 {
+		return float64(o.EstimatedBytes) * confidenceWeights[o.Confidence]
+	}
+	sort.SliceStable(optimizations, func(i, j int) bool {
+		a, b := expected(optimizations[i]), expected(optimizations[j])
+		if a != b {
+			return a > b
+		}
+		return optimizations[i].Priority < optimizations[j].Priority
+	})
 }
 
 func estimateReduction(optimizations []models.Optimization) string {
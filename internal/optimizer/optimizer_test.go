@@ -0,0 +1,866 @@
+package optimizer_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/optimizer"
+)
+
+func TestLinkIssues(t *testing.T) {
+	content := "FROM ubuntu:22.04\nRUN apt-get update && apt-get install curl\nCOPY . .\nCMD [\"bash\"]\n"
+	analysis, err := analyzer.NewWithRules(analyzer.DefaultRules()...).AnalyzeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := optimizer.New(optimizer.ModeSuggest).OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	optimizer.LinkIssues(analysis, result.Optimizations)
+	want := map[string]string{
+		"DIO004": "OPT-CLEANUP",
+		"DIO005": "OPT-CLEANUP",
+		"DIO006": "OPT-USER",
+		"DIO007": "", // no strategy rewrites COPY . .
+		"DIO011": "OPT-WORKDIR",
+	}
+	for _, issue := range analysis.Issues {
+		fixedBy, ok := want[issue.ID]
+		if !ok {
+			continue
+		}
+		if issue.FixedByOptimization != fixedBy {
+			t.Errorf("%s: got fixed by %q, want %q", issue.ID, issue.FixedByOptimization, fixedBy)
+		}
+		delete(want, issue.ID)
+	}
+	for id := range want {
+		t.Errorf("expected an issue %s", id)
+	}
+}
+
+func TestOptimizeContent_Target(t *testing.T) {
+	content := `FROM node:20-alpine AS app
+WORKDIR /app
+COPY . .
+EXPOSE 3000
+CMD ["node", "server.js"]
+
+FROM app AS test
+RUN npm test
+`
+	opt := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.NonRootUserStrategy{}, &optimizer.HealthcheckStrategy{})
+	opt.SetTarget("app")
+	result, err := opt.OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	optimized := result.OptimizedDockerfile
+	test := strings.Index(optimized, "FROM app AS test")
+	user := strings.Index(optimized, "USER 1001:1001")
+	healthcheck := strings.Index(optimized, "HEALTHCHECK")
+	if user < 0 || healthcheck < 0 || user > test || healthcheck > test {
+		t.Errorf("expected USER and HEALTHCHECK added to the app target, got:\n%s", optimized)
+	}
+}
+
+func TestOptimizeContent_BaseImage(t *testing.T) {
+	const content = "FROM ubuntu:22.04\nRUN apt-get update && apt-get install -y make gcc\n"
+	has := func(result *models.OptimizationResult, id string) bool {
+		for _, opt := range result.Optimizations {
+			if opt.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Detected as a base image: the images built on it pick their user
+	result, err := optimizer.New(optimizer.ModeAutoFix).OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has(result, "OPT-USER") || !has(result, "OPT-CLEANUP") {
+		t.Errorf("expected app-centric strategies to be skipped for a base image, got %+v", result.Optimizations)
+	}
+	if strings.Contains(result.OptimizedDockerfile, "USER") {
+		t.Errorf("expected no USER added to a base image:\n%s", result.OptimizedDockerfile)
+	}
+
+	// Declared as a job, it is an application image after all
+	opt, err := optimizer.NewWithConfig(optimizer.ModeSuggest, &config.Config{Image: config.ImageConfig{Kind: "job"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = opt.OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has(result, "OPT-USER") {
+		t.Errorf("expected OPT-USER for a declared job, got %+v", result.Optimizations)
+	}
+}
+
+func TestOptimizeContent_SyntaxGating(t *testing.T) {
+	const body = `FROM nvidia/cuda:12.4.1-cudnn-runtime-ubuntu22.04
+RUN apt-get update && apt-get install -y --no-install-recommends python3 python3-pip
+COPY requirements.txt .
+RUN pip3 install --no-cache-dir tensorflow==2.16.1
+CMD ["python3", "serve.py"]
+`
+	tests := []struct {
+		name      string
+		directive string
+		wheels    bool
+		syntax    string
+	}{
+		{"no directive", "", true, "# syntax=docker/dockerfile:1\n"},
+		{"current", "# syntax=docker/dockerfile:1.7\n", true, "# syntax=docker/dockerfile:1.7\n"},
+		{"too old for mounts", "# syntax=docker/dockerfile:1.1\n", false, "# syntax=docker/dockerfile:1.1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.PythonDepsStrategy{})
+			result, err := opt.OptimizeContent(tt.directive + body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			optimized := result.OptimizedDockerfile
+			if wheels := strings.Contains(optimized, "AS python-wheels"); wheels != tt.wheels {
+				t.Errorf("python-wheels stage = %t, want %t:\n%s", wheels, tt.wheels, optimized)
+			}
+			if !strings.HasPrefix(optimized, tt.syntax) {
+				t.Errorf("expected the Dockerfile to start with %q, got:\n%s", tt.syntax, optimized)
+			}
+		})
+	}
+}
+
+func TestOptimizeContent_StrictShell(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"bash image", "FROM debian:bookworm-slim\nRUN curl -fsSL https://example.com/tool.tgz | tar -xz\nRUN wget -qO- https://example.com/b.tgz | tar -xz\n",
+			"FROM debian:bookworm-slim\nSHELL [\"/bin/bash\", \"-o\", \"pipefail\", \"-c\"]\nRUN curl -fsSL https://example.com/tool.tgz | tar -xz\nRUN wget -qO- https://example.com/b.tgz | tar -xz\n"},
+		{"alpine", "FROM alpine:3.19\nRUN wget -qO- https://example.com/tool.tgz | tar -xz; rm -f /tmp/x\n",
+			"FROM alpine:3.19\nRUN set -eux -o pipefail; wget -qO- https://example.com/tool.tgz | tar -xz; rm -f /tmp/x\n"},
+		{"heredoc", "FROM alpine:3.19\nRUN <<EOF\n#!/bin/sh\napk add --no-cache curl\ncurl -fsS https://example.com\nEOF\n",
+			"FROM alpine:3.19\nRUN <<EOF\n#!/bin/sh\nset -eux\napk add --no-cache curl\ncurl -fsS https://example.com\nEOF\n"},
+		{"unknown image", "FROM example.com/base:1\nRUN curl -fsSL https://example.com/tool.tgz | tar -xz\n",
+			"FROM example.com/base:1\nRUN curl -fsSL https://example.com/tool.tgz | tar -xz\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.StrictShellStrategy{})
+			result, err := opt.OptimizeContent(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.OptimizedDockerfile != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", result.OptimizedDockerfile, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptimizeContent_CacheBust(t *testing.T) {
+	const content = `FROM debian:bookworm-slim
+ARG CACHEBUST=1
+RUN apt-get update
+ENV DEBIAN_FRONTEND=noninteractive
+RUN apt-get install -y --no-install-recommends git
+RUN echo "$CACHEBUST" && git clone --depth 1 --branch v1.2.3 https://github.com/org/repo.git /src
+`
+	const want = `FROM debian:bookworm-slim
+RUN apt-get update
+ENV DEBIAN_FRONTEND=noninteractive
+RUN apt-get install -y --no-install-recommends git
+ARG CACHEBUST=1
+RUN echo "$CACHEBUST" && git clone --depth 1 --branch v1.2.3 https://github.com/org/repo.git /src
+`
+	opt := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.CacheBustStrategy{})
+	result, err := opt.OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OptimizedDockerfile != want {
+		t.Errorf("got:\n%s\nwant:\n%s", result.OptimizedDockerfile, want)
+	}
+}
+
+func TestOptimizeContent_AptUpdate(t *testing.T) {
+	const content = `FROM debian:bookworm-slim
+RUN apt-get update
+ENV DEBIAN_FRONTEND=noninteractive
+RUN apt-get install -y --no-install-recommends git
+COPY . /src
+RUN --mount=type=secret,id=netrc \
+    apt-get install -y --no-install-recommends curl && \
+    rm -rf /var/lib/apt/lists/*
+`
+	const want = `FROM debian:bookworm-slim
+ENV DEBIAN_FRONTEND=noninteractive
+RUN apt-get update && apt-get install -y --no-install-recommends git && \
+    rm -rf /var/lib/apt/lists/*
+COPY . /src
+RUN --mount=type=secret,id=netrc \
+    apt-get update && apt-get install -y --no-install-recommends curl && \
+    rm -rf /var/lib/apt/lists/*
+`
+	opt := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.AptUpdateStrategy{})
+	result, err := opt.OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OptimizedDockerfile != want {
+		t.Errorf("got:\n%s\nwant:\n%s", result.OptimizedDockerfile, want)
+	}
+}
+
+func TestOptimizeContent_Workdir(t *testing.T) {
+	const content = `FROM golang:1.22 AS build
+WORKDIR /src
+COPY . .
+RUN go build -o /out/app .
+
+FROM alpine:3.19
+COPY --from=build /out/app /usr/local/bin/app
+CMD ["app"]
+`
+	const want = `FROM golang:1.22 AS build
+WORKDIR /src
+COPY . .
+RUN go build -o /out/app .
+
+FROM alpine:3.19
+WORKDIR /app
+COPY --from=build /out/app /usr/local/bin/app
+CMD ["app"]
+`
+	opt := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.WorkdirStrategy{})
+	result, err := opt.OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OptimizedDockerfile != want {
+		t.Errorf("got:\n%s\nwant:\n%s", result.OptimizedDockerfile, want)
+	}
+	if len(result.Optimizations) != 1 || !result.Optimizations[0].Applied {
+		t.Errorf("expected OPT-WORKDIR applied, got %+v", result.Optimizations)
+	}
+
+	// A WORKDIR the final stage inherits already applies: nothing to fix
+	inherited := "FROM alpine:3.19 AS base\nWORKDIR /srv\n\nFROM base\nCMD [\"app\"]\n"
+	ctx := &optimizer.OptimizationContext{CurrentContent: inherited}
+	if out, err := (&optimizer.WorkdirStrategy{}).Apply(ctx); err == nil || out != inherited {
+		t.Errorf("expected an error and the content unchanged, got %v:\n%s", err, out)
+	}
+}
+
+func TestBuildPackagesStrategy_Apply(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string // "" when the packages must stay
+	}{
+		{
+			name:    "removed in the RUN installing them",
+			content: "FROM alpine:3.19\nRUN apk add gcc musl-dev && gcc -o /app app.c\nCMD [\"/app\"]\n",
+			want:    "FROM alpine:3.19\nRUN apk add gcc musl-dev && gcc -o /app app.c && apk del gcc musl-dev\nCMD [\"/app\"]\n",
+		},
+		{
+			name:    "still needed later in the stage",
+			content: "FROM alpine:3.19\nRUN apk add gcc musl-dev\nCOPY . .\nRUN make\n",
+		},
+		{
+			name:    "still needed in the final stage inheriting them",
+			content: "FROM debian:12 AS base\nRUN apt-get install -y build-essential\n\nFROM base\nCOPY . .\nRUN make\n",
+		},
+		{
+			name:    "inherited stage with no later compile",
+			content: "FROM debian:12 AS base\nRUN apt-get install -y build-essential && make\n\nFROM base\nCMD [\"/app\"]\n",
+			want:    "FROM debian:12 AS base\nRUN apt-get install -y build-essential && make && apt-get purge -y --auto-remove build-essential\n\nFROM base\nCMD [\"/app\"]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &optimizer.OptimizationContext{CurrentContent: tt.content}
+			got, err := (&optimizer.BuildPackagesStrategy{}).Apply(ctx)
+			if tt.want == "" {
+				if err == nil || got != tt.content {
+					t.Errorf("expected an error and the content unchanged, got %v:\n%s", err, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptimizeContent_CopyChown(t *testing.T) {
+	const content = `FROM node:20-slim
+WORKDIR /app
+COPY . .
+RUN chown -R node:node /app
+COPY scripts /opt/scripts
+RUN chown -R node /opt/scripts
+RUN chmod -R 750 /opt/scripts
+COPY static /srv/static
+RUN chown -R node /srv
+USER node
+`
+	const want = `# syntax=docker/dockerfile:1
+FROM node:20-slim
+WORKDIR /app
+COPY --chown=node:node . .
+RUN chown node:node /app
+COPY --chmod=750 --chown=node scripts /opt/scripts
+RUN chown node /opt/scripts
+RUN chmod 750 /opt/scripts
+COPY static /srv/static
+RUN chown -R node /srv
+USER node
+`
+	opt := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.CopyChownStrategy{})
+	result, err := opt.OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OptimizedDockerfile != want {
+		t.Errorf("got:\n%s\nwant:\n%s", result.OptimizedDockerfile, want)
+	}
+}
+
+func TestOptimizeContent_CleanupPackageManagers(t *testing.T) {
+	const content = `FROM fedora:40
+RUN dnf install -y gcc && \
+    dnf install -y --setopt=install_weak_deps=False make
+RUN apt-get install -y --no-install-recommends curl \
+    git
+RUN apt-get install -y \
+    --no-install-recommends vim
+RUN apk add curl
+RUN zypper -n in curl
+RUN npm ci
+`
+	const want = `FROM fedora:40
+RUN dnf install --setopt=install_weak_deps=False -y gcc && \
+    dnf install -y --setopt=install_weak_deps=False make && \
+    dnf clean all
+RUN apt-get install -y --no-install-recommends curl \
+    git && \
+    rm -rf /var/lib/apt/lists/*
+RUN apt-get install -y \
+    --no-install-recommends vim && \
+    rm -rf /var/lib/apt/lists/*
+RUN apk add --no-cache curl
+RUN zypper -n in --no-recommends curl && \
+    zypper clean --all
+RUN npm ci && \
+    npm cache clean --force
+`
+	opt := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.CleanupStrategy{})
+	result, err := opt.OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OptimizedDockerfile != want {
+		t.Errorf("got:\n%s\nwant:\n%s", result.OptimizedDockerfile, want)
+	}
+}
+
+func TestOptimizeContent_Ranking(t *testing.T) {
+	content := "FROM node:20\nRUN apt-get update && apt-get install -y python3\nCOPY . /app\nRUN npm run build\nCMD [\"node\", \"/app/server.js\"]\n"
+	result, err := optimizer.New(optimizer.ModeSuggest).OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weights := map[string]float64{models.ConfidenceHigh: 1, models.ConfidenceMedium: 0.6, models.ConfidenceLow: 0.3}
+	confidence := make(map[string]string)
+	last := -1.0
+	for i, o := range result.Optimizations {
+		w, ok := weights[o.Confidence]
+		if !ok {
+			t.Fatalf("%s: unknown confidence %q", o.ID, o.Confidence)
+		}
+		expected := float64(o.EstimatedBytes) * w
+		if i > 0 && expected > last {
+			t.Errorf("%s (%.0f bytes expected) ranked after an optimization of %.0f", o.ID, expected, last)
+		}
+		last = expected
+		confidence[o.ID] = o.Confidence
+	}
+	// Alpine swaps and multi-stage rewrites often break builds
+	for id, want := range map[string]string{"OPT-BASE": models.ConfidenceLow, "OPT-MULTISTAGE": models.ConfidenceLow, "OPT-CLEANUP": models.ConfidenceHigh} {
+		if confidence[id] != want {
+			t.Errorf("%s: got confidence %q, want %q", id, confidence[id], want)
+		}
+	}
+	if got := result.Optimizations[len(result.Optimizations)-1].EstimatedBytes; got != 0 {
+		t.Errorf("expected optimizations that save no size last, got %d bytes", got)
+	}
+}
+
+func TestNewWithConfig_Conventions(t *testing.T) {
+	cfg := &config.Config{Optimizer: config.OptimizerConfig{
+		BaseImage: config.BaseImageConfig{Variant: config.VariantSlim},
+		User:      config.UserConfig{Name: "svc", Group: "svc", UID: 10001, GID: 10001},
+		Workdir:   "/srv/app",
+	}}
+	content := "FROM node:20\nCOPY . .\nCMD [\"node\", \"server.js\"]\n"
+	opt, err := optimizer.NewWithConfig(optimizer.ModeAutoFix, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := opt.OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"FROM node:lts-slim",
+		"WORKDIR /srv/app",
+		"RUN addgroup --system --gid 10001 svc && \\\n    adduser --system --uid 10001 --ingroup svc svc\nUSER 10001:10001",
+	} {
+		if !strings.Contains(result.OptimizedDockerfile, want) {
+			t.Errorf("expected %q in:\n%s", want, result.OptimizedDockerfile)
+		}
+	}
+
+	// Distroless images are proposed, not applied: the stage has no shell
+	cfg.Optimizer.BaseImage.Variant = config.VariantDistroless
+	opt, err = optimizer.NewWithConfig(optimizer.ModeAutoFix, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = opt.OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range result.Optimizations {
+		if o.ID != "OPT-BASE" {
+			continue
+		}
+		if o.Applied || !strings.Contains(o.Description, "gcr.io/distroless/nodejs20-debian12") {
+			t.Errorf("expected an unapplied distroless suggestion, got %+v", o)
+		}
+	}
+	if !strings.HasPrefix(result.OptimizedDockerfile, "FROM node:20\n") {
+		t.Errorf("expected the base image to be kept, got:\n%s", result.OptimizedDockerfile)
+	}
+}
+
+func TestNewWithConfig_Analyzer(t *testing.T) {
+	content := "FROM alpine:3.19\nRUN echo a\nRUN echo b\nRUN echo c\n"
+	related := func(cfg *config.Config) []string {
+		t.Helper()
+		opt, err := optimizer.NewWithConfig(optimizer.ModeSuggest, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := opt.OptimizeContent(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range result.Optimizations {
+			if o.ID == "OPT-LAYERS" {
+				return o.RelatedIssueIDs
+			}
+		}
+		t.Fatalf("expected OPT-LAYERS, got %+v", result.Optimizations)
+		return nil
+	}
+
+	cfg := config.Default()
+	if got := related(cfg); strings.Contains(strings.Join(got, ","), "DIO003") {
+		t.Errorf("expected no DIO003 with the default max_layers, got %v", got)
+	}
+	// The rule options of the configuration reach the optimizer's analysis
+	cfg.Analyzer.RuleOptions = map[string]map[string]interface{}{"DIO003": {"max_layers": 2}}
+	if got := related(cfg); !strings.Contains(strings.Join(got, ","), "DIO003") {
+		t.Errorf("expected DIO003 with max_layers 2, got %v", got)
+	}
+
+	cfg.Analyzer.RuleOptions = map[string]map[string]interface{}{"DIO03": {"max_layers": 2}}
+	if _, err := optimizer.NewWithConfig(optimizer.ModeSuggest, cfg); err == nil {
+		t.Error("expected an error for an unknown rule in rule_options")
+	}
+}
+
+// renameStage is a broken strategy that renames the first stage.
+type renameStage struct{}
+
+func (s *renameStage) Name() string { return "rename-stage" }
+
+func (s *renameStage) Analyze(ctx *optimizer.OptimizationContext) *models.Optimization {
+	return &models.Optimization{ID: "OPT-RENAME", AutoFixable: true}
+}
+
+func (s *renameStage) Apply(ctx *optimizer.OptimizationContext) (string, error) {
+	return strings.Replace(ctx.CurrentContent, " AS builder", " AS build", 1), nil
+}
+
+func TestOptimizeContent_StageNames(t *testing.T) {
+	// The second FROM names the stage, not the node image
+	content := "FROM node:20-alpine AS node\nRUN npm ci\nFROM node\nCMD [\"node\", \"server.js\"]\n"
+	result, err := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.BaseImageStrategy{}).OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Optimizations) != 0 || result.OptimizedDockerfile != content {
+		t.Errorf("expected the stage reference to be kept, got %+v:\n%s", result.Optimizations, result.OptimizedDockerfile)
+	}
+
+	// Flags and stage names of the FROM are kept
+	content = "FROM --platform=$BUILDPLATFORM golang:1.22 AS builder\nRUN go build -o /app .\nFROM gcr.io/distroless/static-debian12\nCOPY --from=builder /app /app\n"
+	result, err = optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.BaseImageStrategy{}).OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "FROM --platform=$BUILDPLATFORM golang:1.22-alpine AS builder\n"; !strings.HasPrefix(result.OptimizedDockerfile, want) {
+		t.Errorf("expected %q, got:\n%s", want, result.OptimizedDockerfile)
+	}
+
+	// Multi-stage rewrites keep the name of the stage they replace
+	content = "FROM node:20 AS builder\nCOPY . .\nRUN npm run build\nCMD [\"node\", \"dist/index.js\"]\n"
+	result, err = optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.MultiStageStrategy{}).OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"-alpine AS build\n", "-alpine AS builder\n", "COPY --from=build /app/dist ./dist\n"} {
+		if !strings.Contains(result.OptimizedDockerfile, want) {
+			t.Errorf("expected %q in:\n%s", want, result.OptimizedDockerfile)
+		}
+	}
+
+	// Fixes that leave a stage reference dangling are not applied
+	content = "FROM golang:1.22 AS builder\nRUN go build -o /app .\nFROM scratch\nCOPY --from=builder /app /app\n"
+	result, err = optimizer.NewWithStrategies(optimizer.ModeAutoFix, &renameStage{}).OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Optimizations[0].Applied || result.OptimizedDockerfile != content {
+		t.Errorf("expected the rename not to be applied, got:\n%s", result.OptimizedDockerfile)
+	}
+}
+
+func TestCombineLayersStrategy(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{
+			name:    "separated by COPY",
+			content: "FROM alpine:3.19\nRUN apk add curl\nCOPY . .\nRUN ./build.sh\n",
+		},
+		{
+			name:    "exec form",
+			content: "FROM alpine:3.19\nRUN apk add curl\nRUN [\"./build.sh\"]\n",
+		},
+		{
+			name:    "multi-line RUN and comments",
+			content: "FROM alpine:3.19\n# tools\nRUN apk add \\\n      curl\n\n# build\nRUN ./build.sh\nCMD [\"./app\"]\n",
+			want:    "FROM alpine:3.19\n# tools\n# build\nRUN apk add \\\n      curl && \\\n    ./build.sh\nCMD [\"./app\"]\n",
+		},
+		{
+			name:    "cd ends a block",
+			content: "FROM alpine:3.19\nRUN apk add make\nRUN cd /src && make\nRUN make install\n",
+			want:    "FROM alpine:3.19\nRUN apk add make && \\\n    cd /src && make\nRUN make install\n",
+		},
+		{
+			name:    "trailing comment ends a block",
+			content: "FROM alpine:3.19\nRUN apk add make # for the build\nRUN make\n",
+		},
+		{
+			name:    "blocks in each stage",
+			content: "FROM alpine:3.19 AS build\nRUN apk add make\nRUN make\nFROM alpine:3.19\nRUN apk add ca-certificates\nRUN update-ca-certificates\n",
+			want:    "FROM alpine:3.19 AS build\nRUN apk add make && \\\n    make\nFROM alpine:3.19\nRUN apk add ca-certificates && \\\n    update-ca-certificates\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.CombineLayersStrategy{}).OptimizeContent(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if len(result.Optimizations) != 0 || result.OptimizedDockerfile != tt.content {
+					t.Errorf("expected no RUNs to combine, got:\n%s", result.OptimizedDockerfile)
+				}
+				return
+			}
+			if result.OptimizedDockerfile != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", result.OptimizedDockerfile, tt.want)
+			}
+		})
+	}
+}
+
+// rewriteRun is a strategy that rewrites the last line of a Dockerfile.
+type rewriteRun struct {
+	rewrite func(string) string
+}
+
+func (s *rewriteRun) Name() string { return "rewrite-run" }
+
+func (s *rewriteRun) Analyze(ctx *optimizer.OptimizationContext) *models.Optimization {
+	return &models.Optimization{ID: "OPT-REWRITE", AutoFixable: true}
+}
+
+func (s *rewriteRun) Apply(ctx *optimizer.OptimizationContext) (string, error) {
+	lines := strings.Split(strings.TrimSuffix(ctx.CurrentContent, "\n"), "\n")
+	lines[len(lines)-1] = s.rewrite(lines[len(lines)-1])
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+func TestOptimizeContent_Validation(t *testing.T) {
+	content := "FROM debian:12\nRUN apt-get install -y curl # tools\n"
+	broken := map[string]func(string) string{
+		"continuation on the last line": func(line string) string { return line + " \\" },
+		"command after a comment":       func(line string) string { return line + " && \\\n    rm -rf /var/lib/apt/lists/*" },
+		"dangling operator":             func(line string) string { return strings.TrimSuffix(line, " # tools") + " &&" },
+		"unterminated quote":            func(line string) string { return strings.TrimSuffix(line, " # tools") + ` && echo "done` },
+		"unknown instruction":           func(line string) string { return line + "\nRM -rf /tmp/*" },
+		"no arguments":                  func(line string) string { return line + "\nUSER" },
+		"unknown flag":                  func(line string) string { return line + "\nCOPY --form=build /app /app" },
+		"duplicate stage name":          func(line string) string { return line + "\nFROM debian:12 AS Runtime\nFROM debian:12 AS runtime" },
+		"invalid stage name":            func(line string) string { return line + "\nFROM debian:12 AS 2nd" },
+		"shell form SHELL":              func(line string) string { return line + "\nSHELL /bin/bash -c" },
+	}
+	for name, rewrite := range broken {
+		t.Run(name, func(t *testing.T) {
+			result, err := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &rewriteRun{rewrite: rewrite}).OptimizeContent(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Optimizations[0].Applied || result.OptimizedDockerfile != content {
+				t.Errorf("expected the rewrite not to be applied, got:\n%s", result.OptimizedDockerfile)
+			}
+			if result.Optimizations[0].Rejected == "" {
+				t.Error("expected the rejection to be reported")
+			}
+		})
+	}
+
+	// Problems the Dockerfile already had don't reject a fix
+	content = "FROM debian:12\nRUN echo \"unterminated\nRUN apt-get install -y curl\n"
+	result, err := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &rewriteRun{rewrite: func(line string) string {
+		return line + " && rm -rf /var/lib/apt/lists/*"
+	}}).OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Optimizations[0].Applied {
+		t.Errorf("expected the rewrite to be applied, got:\n%s", result.OptimizedDockerfile)
+	}
+}
+
+func TestNewWithStrategies_Order(t *testing.T) {
+	// Cleanup runs after the RUNs are combined, whatever the order given
+	content := "FROM debian:12\nRUN apt-get update\nRUN apt-get install -y curl\n"
+	result, err := optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.CleanupStrategy{}, &optimizer.CombineLayersStrategy{}).OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "FROM debian:12\nRUN apt-get update && \\\n    apt-get install --no-install-recommends -y curl && \\\n    rm -rf /var/lib/apt/lists/*\n"
+	if result.OptimizedDockerfile != want {
+		t.Errorf("got:\n%s\nwant:\n%s", result.OptimizedDockerfile, want)
+	}
+
+	// A cleanup can't follow a comment
+	content = "FROM debian:12\nRUN apt-get update && apt-get install -y curl # tools\n"
+	result, err = optimizer.NewWithStrategies(optimizer.ModeAutoFix, &optimizer.CleanupStrategy{}).OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(result.OptimizedDockerfile, "rm -rf") {
+		t.Errorf("expected no cleanup after the comment, got:\n%s", result.OptimizedDockerfile)
+	}
+}
+
+func TestOptimizeContent_BuildCheck(t *testing.T) {
+	content := "FROM debian:12\nRUN apt-get install -y curl\n"
+	cleanup := &rewriteRun{rewrite: func(line string) string { return line + " && rm -rf /var/lib/apt/lists/*" }}
+	failCleanup := func(dockerfile string) error {
+		if strings.Contains(dockerfile, "rm -rf") {
+			return errors.New("line 2: cleanup not allowed")
+		}
+		return nil
+	}
+	o := optimizer.NewWithStrategies(optimizer.ModeAutoFix, cleanup)
+	o.SetBuildCheck(failCleanup)
+	result, err := o.OptimizeContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Optimizations[0].Applied || result.Optimizations[0].Rejected != "line 2: cleanup not allowed" {
+		t.Errorf("expected the fix to be rejected by the check, got %+v", result.Optimizations[0])
+	}
+
+	// A Dockerfile that already fails the check is checked by the parser
+	// only
+	o.SetBuildCheck(func(string) error { return errors.New("no daemon") })
+	if result, err = o.OptimizeContent(content); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Optimizations[0].Applied {
+		t.Errorf("expected the fix to be applied, got %+v", result.Optimizations[0])
+	}
+}
+
+func TestWriteOptimized_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Dockerfile.optimized")
+	result := &models.OptimizationResult{
+		OriginalDockerfile:  "FROM debian:12\nRUN apt-get install -y curl\n",
+		OptimizedDockerfile: "FROM debian:12\nRUN apt-get install -y curl &&\n",
+	}
+	if err := optimizer.New(optimizer.ModeAutoFix).WriteOptimized(result, path); err == nil {
+		t.Fatal("expected an error for an invalid Dockerfile")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s not to be written", path)
+	}
+}
+
+func TestOptimize_Dockerignore(t *testing.T) {
+	const dockerfile = "FROM node:20\nCOPY . /app\nRUN npm ci\n"
+	tests := []struct {
+		name        string
+		mode        optimizer.Mode
+		write       bool
+		file        string // Dockerfile name
+		existing    string // ignore file present beforehand
+		wantFile    string // ignore file expected to be written
+		wantSuggest bool
+	}{
+		{"absent", optimizer.ModeAutoFix, true, "Dockerfile", "", ".dockerignore", true},
+		{"absent containerfile", optimizer.ModeAutoFix, true, "Containerfile", "", ".containerignore", true},
+		{"absent without write", optimizer.ModeAutoFix, false, "Dockerfile", "", "", true},
+		{"absent in suggest mode", optimizer.ModeSuggest, true, "Dockerfile", "", "", true},
+		{"exists", optimizer.ModeAutoFix, true, "Dockerfile", ".dockerignore", "", false},
+		{"containerignore exists", optimizer.ModeAutoFix, true, "Containerfile", ".containerignore", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(dockerfile), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			const existing = "# maintained by hand\nnode_modules\n"
+			if tt.existing != "" {
+				if err := os.WriteFile(filepath.Join(dir, tt.existing), []byte(existing), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			o := optimizer.NewWithStrategies(tt.mode)
+			o.SetWriteDockerignore(tt.write)
+			result, err := o.Optimize(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var opt *models.Optimization
+			for i := range result.Optimizations {
+				if result.Optimizations[i].ID == "OPT-DOCKERIGNORE" {
+					opt = &result.Optimizations[i]
+				}
+			}
+			if (opt != nil) != tt.wantSuggest {
+				t.Fatalf("expected OPT-DOCKERIGNORE suggested: %v, got %+v", tt.wantSuggest, result.Optimizations)
+			}
+			if tt.existing != "" {
+				if data, err := os.ReadFile(filepath.Join(dir, tt.existing)); err != nil || string(data) != existing {
+					t.Errorf("expected %s to be left untouched, got %q, %v", tt.existing, data, err)
+				}
+			}
+			if tt.wantFile == "" {
+				if opt != nil && opt.Applied {
+					t.Errorf("expected OPT-DOCKERIGNORE not to be applied, got %+v", opt)
+				}
+				if tt.existing == "" {
+					if _, err := os.Stat(filepath.Join(dir, ".dockerignore")); !os.IsNotExist(err) {
+						t.Error("expected no .dockerignore to be written")
+					}
+				}
+				return
+			}
+			want := filepath.Join(dir, tt.wantFile)
+			data, err := os.ReadFile(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), ".git") || !opt.Applied || result.Dockerignore != want {
+				t.Errorf("expected %s to be written and recorded, got applied=%v, path %q:\n%s", want, opt.Applied, result.Dockerignore, data)
+			}
+		})
+	}
+}
+
+func TestOptimize_DockerignoreNoClobber(t *testing.T) {
+	// A dangling symlink passes the existence check; O_EXCL must still
+	// refuse to write through it
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Dockerfile")
+	if err := os.WriteFile(path, []byte("FROM node:20\nCOPY . /app\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(t.TempDir(), "elsewhere")
+	if err := os.Symlink(target, filepath.Join(dir, ".dockerignore")); err != nil {
+		t.Skip(err)
+	}
+
+	o := optimizer.NewWithStrategies(optimizer.ModeAutoFix)
+	o.SetWriteDockerignore(true)
+	if _, err := o.Optimize(path); err == nil || !strings.Contains(err.Error(), "failed to create .dockerignore") {
+		t.Errorf("expected the existing .dockerignore not to be overwritten, got %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written through the symlink")
+	}
+}
+
+func TestOptimizeAnalyzed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Dockerfile")
+	if err := os.WriteFile(path, []byte("FROM alpine:3.20\nCMD [\"/app\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte(".git\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	o := optimizer.NewWithStrategies(optimizer.ModeSuggest, &optimizer.RuntimeDataStrategy{})
+
+	// The content alone has no timezone finding
+	result, err := o.Optimize(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Optimizations) != 0 {
+		t.Fatalf("expected no optimizations, got %+v", result.Optimizations)
+	}
+
+	// The given analysis is used instead of analyzing again
+	analysis := &models.AnalysisResult{Issues: []models.Issue{{ID: "DIO016", Line: 1}}}
+	result, err = o.OptimizeAnalyzed(path, analysis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Optimizations) != 1 || result.Optimizations[0].ID != "OPT-RUNTIME-DATA" {
+		t.Errorf("expected the optimizations of the given analysis, got %+v", result.Optimizations)
+	}
+}
@@ -0,0 +1,99 @@
+package optimizer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- BuildPackagesStrategy ---
+// Removes compilers, build tools and -dev headers at the end of the RUN
+// that installs them in the final stage (DIO018).
+
+type BuildPackagesStrategy struct{}
+
+func (s *BuildPackagesStrategy) Name() string { return "build-packages" }
+
+// After has the packages removed at the end of the RUNs
+// CombineLayersStrategy merges: merged before a later compile, the removal
+// would break it.
+func (s *BuildPackagesStrategy) After() []string { return []string{"combine-layers"} }
+
+// compileCommandRegex matches later commands that may need the build
+// packages: compilers, make, and installers that build native extensions.
+var compileCommandRegex = regexp.MustCompile(`(^|&&|\|\||;|\|)\s*(gcc|g\+\+|cc|c\+\+|clang|make|cmake|\./configure|pip3?\s+install|python3?\s+-m\s+pip\s+install|npm\s+(install|ci)|yarn|gem\s+install|bundle\s+install|cargo|go\s+build)(\s|$)`)
+
+func (s *BuildPackagesStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	related := reportedIssues(ctx.Analysis, "DIO018")
+	if len(related) == 0 || ctx.Windows {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-BUILD-PACKAGES",
+		Category:        "cleanup",
+		Title:           "Remove build-only packages",
+		Description:     "Compilers, build tools and -dev headers are only needed while building. Remove them in the same RUN that installs them, or build in a separate stage.",
+		Impact:          "50-300MB reduction",
+		EstimatedBytes:  150 << 20,
+		Confidence:      models.ConfidenceMedium,
+		Priority:        2,
+		AutoFixable:     true,
+		RelatedIssueIDs: related,
+	}
+}
+
+// Apply removes the packages at the end of the RUN installing them, unless
+// a later RUN of the final stage may still need them.
+func (s *BuildPackagesStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	if pdf.FinalStage() < 0 {
+		return ctx.CurrentContent, fmt.Errorf("no final stage")
+	}
+	// The chain starts at the final stage: its oldest stage runs first
+	var runs []analyzer.Instruction
+	chain := pdf.StageChain(pdf.FinalStage())
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, inst := range chain[i].Instructions {
+			if inst.Command == "RUN" {
+				runs = append(runs, inst)
+			}
+		}
+	}
+
+	modified := false
+	for i, run := range runs {
+		leftover := analyzer.LeftoverBuildPackages(run.Args)
+		// The removal can't follow the terminator of a heredoc, nor a
+		// comment or an operator the script ends with
+		if len(leftover) == 0 || strings.HasPrefix(strings.TrimSpace(run.Args), "[") || len(run.Heredocs) > 0 || !analyzer.Appendable(run.Args) || laterRunCompiles(runs[i+1:]) {
+			continue
+		}
+		var cmds []string
+		for _, install := range leftover {
+			cmds = append(cmds, analyzer.RemoveCommand(install.Manager, install.Packages))
+		}
+		last := run.EndLine - 1
+		lines[last] = strings.TrimRight(lines[last], " \t") + " && " + strings.Join(cmds, " && ")
+		modified = true
+	}
+	if !modified {
+		return ctx.CurrentContent, fmt.Errorf("build packages are still needed by later RUN instructions")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// laterRunCompiles reports whether any of the RUN instructions may compile
+// something.
+func laterRunCompiles(runs []analyzer.Instruction) bool {
+	for _, run := range runs {
+		if compileCommandRegex.MatchString(strings.TrimSpace(run.Args)) {
+			return true
+		}
+	}
+	return false
+}
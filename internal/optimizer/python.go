@@ -0,0 +1,422 @@
+package optimizer
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- PythonDepsStrategy ---
+// Adds --no-cache-dir to pip installs (DIO005-pip), makes them use a
+// constraints file copied into the image, and moves pip installs of ML
+// stacks out of the final stage (DIO028): into a virtual environment built
+// in a python-deps stage when the image has venv, otherwise into wheels
+// built in a python-wheels stage and installed from a bind mount.
+
+type PythonDepsStrategy struct{}
+
+func (s *PythonDepsStrategy) Name() string { return "python-deps" }
+
+func (s *PythonDepsStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	related := reportedIssues(ctx.Analysis, "DIO005-pip", "DIO028")
+	if len(related) == 0 || ctx.Windows {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-PYTHON-DEPS",
+		Category:        "multi-stage",
+		Title:           "Install Python dependencies without caches, in a separate stage",
+		Description:     "Add --no-cache-dir and the constraints file to pip installs, and install ML stacks into a virtual environment or wheels built in a separate stage.",
+		Impact:          "Hundreds of MB to GBs for ML images; faster rebuilds",
+		EstimatedBytes:  300 << 20,
+		Confidence:      models.ConfidenceLow,
+		Priority:        2,
+		AutoFixable:     true,
+		RelatedIssueIDs: related,
+	}
+}
+
+func (s *PythonDepsStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	lines = addPipNoCacheDir(lines, ctx)
+	lines = addPipConstraints(lines, ctx)
+	if len(reportedIssues(ctx.Analysis, "DIO028")) > 0 {
+		lines = isolatePythonDeps(lines, ctx)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+var (
+	// pipInstallRegex matches the start of a pip install command.
+	pipInstallRegex = regexp.MustCompile(`\b(pip[\d.]*|python[\d.]*\s+-m\s+pip)\s+install\b`)
+	// commandEndRegex matches the end of a shell command.
+	commandEndRegex = regexp.MustCompile(`&&|\|\||;|\|`)
+	// constraintsFileRegex matches the name of a pip constraints file.
+	constraintsFileRegex = regexp.MustCompile(`^constraints[\w.-]*\.txt$`)
+	// pipTargetOptionRegex matches pip install options that install
+	// somewhere else than the environment.
+	pipTargetOptionRegex = regexp.MustCompile(`\s(--user|--target|-t|--prefix|--root)(\s|=|$)`)
+	// venvPackageRegex matches the Debian and Ubuntu packages of the venv
+	// module.
+	venvPackageRegex = regexp.MustCompile(`^python3[\d.]*-venv$`)
+	// runRegex matches the RUN keyword of an instruction.
+	runRegex = regexp.MustCompile(`(?i)^(\s*RUN)\s+`)
+)
+
+// editPipInstalls inserts what opts returns after "install" in each pip
+// install command of text. opts gets the rest of the command.
+func editPipInstalls(text string, opts func(rest string) string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range pipInstallRegex.FindAllStringIndex(text, -1) {
+		// uv pip has options of its own
+		if strings.HasSuffix(strings.TrimSpace(text[:m[0]]), "uv") {
+			continue
+		}
+		rest := text[m[1]:]
+		if end := commandEndRegex.FindStringIndex(rest); end != nil {
+			rest = rest[:end[0]]
+		}
+		sb.WriteString(text[last:m[1]])
+		sb.WriteString(opts(rest))
+		last = m[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// editRun applies edit to the text of a RUN instruction in lines.
+func editRun(lines []string, inst analyzer.Instruction, edit func(string) string) {
+	start, end := span(inst)
+	edited := strings.Split(edit(strings.Join(lines[start:end], "\n")), "\n")
+	copy(lines[start:end], edited)
+}
+
+// pipCacheMounted reports whether a RUN mounts a cache over pip's cache.
+func pipCacheMounted(inst analyzer.Instruction) bool {
+	for _, m := range analyzer.RunMounts(inst) {
+		if (m.Type == "cache" || m.Type == "tmpfs") && strings.HasPrefix("/root/.cache/pip", strings.TrimSuffix(m.Target, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func addPipNoCacheDir(lines []string, ctx *OptimizationContext) []string {
+	for _, stage := range analyzer.ParseDockerfile(lines, ctx.Args).Stages {
+		for _, inst := range stage.Instructions {
+			if inst.Command != "RUN" || pipCacheMounted(inst) {
+				continue
+			}
+			editRun(lines, inst, func(text string) string {
+				return editPipInstalls(text, func(rest string) string {
+					if strings.Contains(rest, "--no-cache-dir") {
+						return ""
+					}
+					return " --no-cache-dir"
+				})
+			})
+		}
+	}
+	return lines
+}
+
+// addPipConstraints adds -c to the pip installs that follow a COPY of a
+// constraints file in the same stage, and don't use one yet.
+func addPipConstraints(lines []string, ctx *OptimizationContext) []string {
+	for _, stage := range analyzer.ParseDockerfile(lines, ctx.Args).Stages {
+		constraints := ""
+		for _, inst := range stage.Instructions {
+			switch inst.Command {
+			case "COPY":
+				if file := copiedConstraintsFile(inst); file != "" {
+					constraints = file
+				}
+			case "RUN":
+				if constraints == "" {
+					continue
+				}
+				editRun(lines, inst, func(text string) string {
+					return editPipInstalls(text, func(rest string) string {
+						if strings.Contains(rest, "-c ") || strings.Contains(rest, "--constraint") || !pipInstallsPackages(rest) {
+							return ""
+						}
+						return " -c " + constraints
+					})
+				})
+			}
+		}
+	}
+	return lines
+}
+
+// copiedConstraintsFile returns where a COPY from the build context puts a
+// constraints file, relative to the WORKDIR unless the destination is
+// absolute, or "".
+func copiedConstraintsFile(inst analyzer.Instruction) string {
+	var paths []string
+	for _, f := range strings.Fields(inst.Args) {
+		if strings.HasPrefix(f, "--from") {
+			return ""
+		}
+		if !strings.HasPrefix(f, "--") {
+			paths = append(paths, f)
+		}
+	}
+	if len(paths) < 2 {
+		return ""
+	}
+	sources, dest := paths[:len(paths)-1], paths[len(paths)-1]
+	for _, src := range sources {
+		name := path.Base(src)
+		if !constraintsFileRegex.MatchString(name) {
+			continue
+		}
+		if len(sources) > 1 || dest == "." || strings.HasSuffix(dest, "/") {
+			return path.Join(dest, name)
+		}
+		return dest
+	}
+	return ""
+}
+
+// installsPackages reports whether any of the pip installs installs
+// packages.
+func installsPackages(installs []analyzer.PipInstall) bool {
+	for _, install := range installs {
+		if pipInstallsPackages(strings.SplitN(install.Command, " install", 2)[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// pipInstallsPackages reports whether the arguments of a pip install name
+// packages or requirements files, rather than only upgrading pip itself.
+func pipInstallsPackages(args string) bool {
+	installs := analyzer.PipInstalls("pip install " + args)
+	if len(installs) == 0 {
+		return false
+	}
+	if len(installs[0].Requirements) > 0 || installs[0].Local {
+		return true
+	}
+	for _, pkg := range installs[0].Packages {
+		if !pipTooling[pkg] {
+			return true
+		}
+	}
+	return false
+}
+
+// pipTooling are the packages of pip's own toolchain.
+var pipTooling = map[string]bool{"pip": true, "setuptools": true, "wheel": true}
+
+// Names of the stages that build Python dependencies.
+const (
+	venvStage   = "python-deps"
+	wheelsStage = "python-wheels"
+	venvDir     = "/opt/venv"
+)
+
+// runtimeOnlyCommands are instructions that only configure the container
+// and have no place in a build stage.
+var runtimeOnlyCommands = map[string]bool{
+	"USER": true, "CMD": true, "ENTRYPOINT": true, "EXPOSE": true, "HEALTHCHECK": true,
+	"LABEL": true, "VOLUME": true, "STOPSIGNAL": true, "ONBUILD": true, "MAINTAINER": true,
+}
+
+// pipOnlyRun returns the pip installs of a RUN that only installs
+// packages from an index with pip, or nil.
+func pipOnlyRun(inst analyzer.Instruction) []analyzer.PipInstall {
+	if inst.Command != "RUN" || strings.HasPrefix(strings.TrimSpace(inst.Args), "[") {
+		return nil
+	}
+	installs := analyzer.PipInstalls(inst.Args)
+	commands := 0
+	for _, cmd := range commandEndRegex.Split(inst.Args, -1) {
+		if strings.TrimSpace(cmd) != "" {
+			commands++
+		}
+	}
+	if len(installs) == 0 || len(installs) != commands {
+		return nil
+	}
+	for _, install := range installs {
+		if install.Local || pipTargetOptionRegex.MatchString(install.Command) {
+			return nil
+		}
+	}
+	return installs
+}
+
+// isolatePythonDeps moves the pip-only RUN instructions of the final stage
+// into a build stage that replays the final stage up to them.
+func isolatePythonDeps(lines []string, ctx *OptimizationContext) []string {
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	final := pdf.FinalStage()
+	if final < 0 || pdf.StageIndex(venvStage) >= 0 || pdf.StageIndex(wheelsStage) >= 0 {
+		return lines
+	}
+	stage := pdf.Stages[final]
+	var moved []analyzer.Instruction
+	for _, inst := range stage.Instructions {
+		if installs := pipOnlyRun(inst); installs != nil && installsPackages(installs) {
+			moved = append(moved, inst)
+		}
+	}
+	if len(moved) == 0 {
+		return lines
+	}
+
+	venv := strings.HasPrefix(imageName(pdf.StageChain(final)), "python")
+	for _, s := range pdf.StageChain(final) {
+		for _, inst := range s.Instructions {
+			for _, install := range analyzer.PackageInstalls(inst.Args) {
+				for _, pkg := range install.Packages {
+					venv = venv || venvPackageRegex.MatchString(pkg)
+				}
+			}
+		}
+	}
+
+	// Wheels are installed from a bind mount, which needs a recent frontend
+	if !venv && !syntaxSupported(lines, analyzer.FeatureRunMount) {
+		return lines
+	}
+
+	from := strings.Fields(lines[stage.StartLine-1])
+	if n := len(from); n >= 4 && strings.EqualFold(from[n-2], "AS") {
+		from = from[:n-2]
+	}
+	name := wheelsStage
+	if venv {
+		name = venvStage
+	}
+	builder := []string{strings.Join(from, " ") + " AS " + name}
+	last := moved[len(moved)-1]
+	for _, inst := range stage.Instructions[1:] {
+		if inst.Line > last.Line {
+			break
+		}
+		// The venv is created once python and its venv package are in
+		if venv && inst.Line == moved[0].Line {
+			builder = append(builder, "RUN python3 -m venv "+venvDir, `ENV PATH="`+venvDir+`/bin:$PATH"`)
+		}
+		start, end := span(inst)
+		switch {
+		case runtimeOnlyCommands[inst.Command]:
+		case pipOnlyRun(inst) != nil && !venv:
+			builder = append(builder, wheelRun(inst))
+		default:
+			builder = append(builder, lines[start:end]...)
+		}
+	}
+	edits := make(map[int]*lineEdit)
+	for i, inst := range moved {
+		start, end := span(inst)
+		switch {
+		case !venv:
+			edits[start] = &lineEdit{end: end, lines: strings.Split(installFromWheels(strings.Join(lines[start:end], "\n")), "\n")}
+		case i == 0:
+			edits[start] = &lineEdit{end: end, lines: []string{"COPY --from=" + venvStage + " " + venvDir + " " + venvDir, `ENV PATH="` + venvDir + `/bin:$PATH"`}}
+		default:
+			edits[start] = &lineEdit{end: end}
+		}
+	}
+	lines = insertStage(lines, stage, builder, edits)
+	if !venv {
+		lines = addSyntaxDirective(lines)
+	}
+	return lines
+}
+
+// insertStage inserts the lines of a build stage right before stage, and
+// the comments that introduce it, and applies edits to lines.
+func insertStage(lines []string, stage analyzer.Stage, builder []string, edits map[int]*lineEdit) []string {
+	at := stage.StartLine - 1
+	for at > 0 && strings.HasPrefix(strings.TrimSpace(lines[at-1]), "#") && !isDirective(lines[at-1]) {
+		at--
+	}
+	out := append([]string(nil), lines[:at]...)
+	out = append(out, builder...)
+	out = append(out, "")
+	return append(out, applyEdits(lines[at:], shiftEdits(edits, at))...)
+}
+
+// withFromImage returns a FROM line with its image replaced by image.
+func withFromImage(line, image string) string {
+	fields := strings.Fields(line)
+	for i, f := range fields[1:] {
+		if !strings.HasPrefix(f, "--") {
+			fields[i+1] = image
+			break
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// shiftEdits rebases edits keyed by line index onto lines[offset:].
+func shiftEdits(edits map[int]*lineEdit, offset int) map[int]*lineEdit {
+	shifted := make(map[int]*lineEdit, len(edits))
+	for start, e := range edits {
+		shifted[start-offset] = &lineEdit{end: e.end - offset, lines: e.lines}
+	}
+	return shifted
+}
+
+// imageName returns the repository name of the external image a stage
+// chain is built on, such as python for python:3.12-slim.
+func imageName(chain []analyzer.Stage) string {
+	if len(chain) == 0 {
+		return ""
+	}
+	image := chain[len(chain)-1].BaseImage
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.IndexAny(name, ":@"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// installOnlyOptionRegex matches pip install options that pip wheel
+// doesn't take.
+var installOnlyOptionRegex = regexp.MustCompile(`\s(-U|--upgrade|--force-reinstall|-I|--ignore-installed|--break-system-packages|--no-warn-script-location|--compile|--no-compile|--root-user-action[= ]\S+|--upgrade-strategy[= ]\S+)(\s|$)`)
+
+// wheelRun turns a pip-only RUN into one that builds wheels into /wheels.
+// Upgrades of pip itself are kept as they are.
+func wheelRun(inst analyzer.Instruction) string {
+	var cmds []string
+	for _, install := range analyzer.PipInstalls(inst.Args) {
+		cmd := install.Command
+		if !pipInstallsPackages(strings.SplitN(cmd, " install", 2)[1]) {
+			cmds = append(cmds, cmd)
+			continue
+		}
+		for installOnlyOptionRegex.MatchString(cmd) {
+			cmd = installOnlyOptionRegex.ReplaceAllString(cmd, "$2")
+		}
+		cmds = append(cmds, pipInstallRegex.ReplaceAllString(cmd, "$1 wheel --wheel-dir /wheels"))
+	}
+	run := "RUN "
+	if len(inst.Flags) > 0 {
+		run += strings.Join(inst.Flags, " ") + " "
+	}
+	return run + strings.Join(cmds, " && \\\n    ")
+}
+
+// installFromWheels makes the pip installs of a RUN install from the
+// wheels of the python-wheels stage, mounted for the RUN only.
+func installFromWheels(run string) string {
+	run = runRegex.ReplaceAllString(run, "${1} --mount=type=bind,from="+wheelsStage+",source=/wheels,target=/wheels \\\n    ")
+	return editPipInstalls(run, func(rest string) string {
+		if !pipInstallsPackages(rest) {
+			return ""
+		}
+		return " --no-index --find-links=/wheels"
+	})
+}
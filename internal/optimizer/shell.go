@@ -0,0 +1,106 @@
+package optimizer
+
+import (
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- StrictShellStrategy ---
+// Makes RUN scripts fail on the first failing command (DIO038): switches
+// stages that pipe commands to bash with pipefail, or sets pipefail and
+// -e in the script when its shell supports them.
+
+type StrictShellStrategy struct{}
+
+func (s *StrictShellStrategy) Name() string { return "strict-shell" }
+
+func (s *StrictShellStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	related := reportedIssues(ctx.Analysis, "DIO038")
+	if len(related) == 0 {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-STRICT-SHELL",
+		Category:        "best-practice",
+		Title:           "Fail the build on the first failing command",
+		Description:     `Add SHELL ["/bin/bash", "-o", "pipefail", "-c"] before RUNs that pipe commands, or set -eux at the start of their scripts, so a failed download doesn't build an image without what it should have installed.`,
+		Impact:          "Reliability: failed steps fail the build instead of the image",
+		Confidence:      models.ConfidenceMedium,
+		Priority:        2,
+		AutoFixable:     true,
+		RelatedIssueIDs: related,
+	}
+}
+
+// pipefailShell is the SHELL that makes pipelines fail when any of their
+// commands fails.
+const pipefailShell = `SHELL ["/bin/bash", "-o", "pipefail", "-c"]`
+
+func (s *StrictShellStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	scripts := make(map[int]analyzer.RunScript)
+	for _, script := range analyzer.RunScripts(pdf, lines) {
+		scripts[script.Instruction.Line] = script
+	}
+
+	edits := make(map[int]*lineEdit)
+	// switched holds the stages given pipefailShell, by their FROM line
+	switched := make(map[int]bool)
+	for _, run := range pdf.LenientRuns() {
+		script, ok := scripts[run.Run.Line]
+		if !ok || !run.Fixable() {
+			continue
+		}
+		start, end := span(run.Run)
+		edited := append([]string(nil), lines[start:end]...)
+
+		var opts []string
+		if run.Sequence {
+			opts = append(opts, "-eux")
+		}
+		if run.Pipe {
+			switch {
+			case run.Pipefail():
+				opts = append(opts, "-o pipefail")
+			case !switchedChain(pdf.StageChain(run.Stage), switched):
+				// Later RUNs of the stage, and of stages built on it, run
+				// in bash with pipefail too
+				switched[pdf.Stages[run.Stage].StartLine] = true
+				edited = append([]string{pipefailShell}, edited...)
+			}
+		}
+		if len(opts) > 0 {
+			set := "set " + strings.Join(opts, " ")
+			n := script.Lines[0] - 1 - start + len(edited) - (end - start)
+			if run.Heredoc {
+				at := n
+				if strings.HasPrefix(strings.TrimSpace(edited[n]), "#!") {
+					at++
+				}
+				edited = append(edited[:at], append([]string{set}, edited[at:]...)...)
+			} else {
+				first := strings.SplitN(script.Script, "\n", 2)[0]
+				if i := strings.LastIndex(edited[n], first); i >= 0 {
+					edited[n] = edited[n][:i] + set + "; " + edited[n][i:]
+				}
+			}
+		}
+		edits[start] = &lineEdit{end: end, lines: edited}
+	}
+	return strings.Join(applyEdits(lines, edits), "\n"), nil
+}
+
+// switchedChain reports whether a stage, or one it is built on, was given
+// pipefailShell.
+func switchedChain(chain []analyzer.Stage, switched map[int]bool) bool {
+	for _, stage := range chain {
+		if switched[stage.StartLine] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package optimizer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- DeadStageStrategy ---
+// Removes build stages the final stage never uses (DIO023), and renumbers
+// COPY --from and RUN --mount=from references to stages by index.
+
+type DeadStageStrategy struct{}
+
+func (s *DeadStageStrategy) Name() string { return "dead-stages" }
+
+func (s *DeadStageStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	related := reportedIssues(ctx.Analysis, "DIO023")
+	if len(related) == 0 {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-DEAD-STAGES",
+		Category:        "cleanup",
+		Title:           "Remove unused build stages",
+		Description:     "Delete stages that no FROM, COPY --from or RUN --mount=from of the final stage reaches, including stages shadowed by a later stage with the same name.",
+		Impact:          "Shorter Dockerfile; no wasted stages with the legacy builder",
+		Confidence:      models.ConfidenceHigh,
+		Priority:        4,
+		AutoFixable:     true,
+		RelatedIssueIDs: related,
+	}
+}
+
+// stageIndexRef matches a reference to a stage by index in COPY --from or
+// a RUN --mount from option.
+var stageIndexRef = regexp.MustCompile(`(--from=|[=,]from=)(\d+)\b`)
+
+// directiveLine matches a parser directive line.
+var directiveLine = regexp.MustCompile(`^#\s*[a-zA-Z]+\s*=\s*\S+$`)
+
+func (s *DeadStageStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	dead := pdf.DeadStages()
+	if len(dead) == 0 {
+		return ctx.CurrentContent, nil
+	}
+
+	directives := 0
+	for directives < len(lines) && isDirective(lines[directives]) {
+		directives++
+	}
+	// start returns the first line of stage i, including the comments
+	// directly above its FROM.
+	start := func(i int) int {
+		n := pdf.Stages[i].StartLine - 1
+		for n > directives && strings.HasPrefix(strings.TrimSpace(lines[n-1]), "#") {
+			n--
+		}
+		return n
+	}
+
+	edits := make(map[int]*lineEdit)
+	removed := make(map[int]bool)
+	for _, d := range dead {
+		end := len(lines)
+		if d.Index+1 < len(pdf.Stages) {
+			end = start(d.Index + 1)
+		}
+		edits[start(d.Index)] = &lineEdit{end: end}
+		removed[d.Index] = true
+	}
+
+	// Stages keep their relative order, so an index drops by the number of
+	// removed stages before it.
+	renumber := func(ref string) string {
+		m := stageIndexRef.FindStringSubmatch(ref)
+		n, _ := strconv.Atoi(m[2])
+		shift := 0
+		for i := range removed {
+			if i < n {
+				shift++
+			}
+		}
+		return m[1] + strconv.Itoa(n-shift)
+	}
+	for i, stage := range pdf.Stages {
+		if removed[i] {
+			continue
+		}
+		for _, inst := range stage.Instructions {
+			if inst.Command != "COPY" && inst.Command != "RUN" {
+				continue
+			}
+			first, last := span(inst)
+			for l := first; l < last; l++ {
+				lines[l] = stageIndexRef.ReplaceAllStringFunc(lines[l], renumber)
+			}
+		}
+	}
+	return strings.Join(applyEdits(lines, edits), "\n"), nil
+}
+
+// isDirective reports whether a line is a parser directive such as
+// "# syntax=docker/dockerfile:1".
+func isDirective(line string) bool {
+	return directiveLine.MatchString(strings.TrimSpace(line))
+}
@@ -2,9 +2,10 @@ package optimizer
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/config"
 	"github.com/maxlar/docker-image-optimizer/internal/models"
 )
 
@@ -15,10 +16,25 @@ type Strategy interface {
 	Apply(ctx *OptimizationContext) (string, error)
 }
 
-// --- BaseImageStrategy ---
-// Suggests switching to smaller base images.
+// Ordered is implemented by strategies that rewrite what other strategies
+// write and must be applied after them, wherever they are listed.
+type Ordered interface {
+	// After returns the names of the strategies to apply first.
+	After() []string
+}
 
-type BaseImageStrategy struct{}
+// --- BaseImageStrategy ---
+// Suggests switching to smaller base images or, with a golden image catalog
+// in .dio.yaml, the base image of the final stage to the golden image for
+// the application's runtime instead.
+
+type BaseImageStrategy struct {
+	// Golden is the golden image catalog of .dio.yaml.
+	Golden []config.GoldenImage
+	// Variant is the preferred variant of smaller base images: slim,
+	// alpine or distroless. Empty uses slimAlternatives.
+	Variant string
+}
 
 func (s *BaseImageStrategy) Name() string { return "base-image-optimization" }
 
@@ -44,19 +60,102 @@ var slimAlternatives = map[string]string{
 	"amazoncorretto": "amazoncorretto:21-alpine",
 }
 
-func (s *BaseImageStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
-	lines := ctx.Lines
-	for _, line := range lines {
+// variantAlternatives maps large base images to their smaller alternative
+// of each variant. Images missing from the preferred variant fall back to
+// slimAlternatives.
+var variantAlternatives = map[string]map[string]string{
+	config.VariantSlim: {
+		"node":    "node:lts-slim",
+		"python":  "python:3.12-slim",
+		"ruby":    "ruby:3.3-slim",
+		"java":    "eclipse-temurin:21-jre",
+		"openjdk": "eclipse-temurin:21-jre",
+		"debian":  "debian:bookworm-slim",
+		"centos":  "debian:bookworm-slim",
+		"fedora":  "debian:bookworm-slim",
+	},
+	config.VariantAlpine: {
+		"ubuntu":         "alpine:3.19",
+		"debian":         "alpine:3.19",
+		"node":           "node:lts-alpine",
+		"python":         "python:3.12-alpine",
+		"golang":         "golang:1.22-alpine",
+		"ruby":           "ruby:3.3-alpine",
+		"php":            "php:8.3-alpine",
+		"java":           "eclipse-temurin:21-jre-alpine",
+		"openjdk":        "eclipse-temurin:21-jre-alpine",
+		"nginx":          "nginx:alpine",
+		"httpd":          "httpd:alpine",
+		"postgres":       "postgres:16-alpine",
+		"redis":          "redis:alpine",
+		"centos":         "alpine:3.19",
+		"fedora":         "alpine:3.19",
+		"amazoncorretto": "amazoncorretto:21-alpine",
+	},
+	config.VariantDistroless: {
+		"ubuntu":         "gcr.io/distroless/base-debian12",
+		"debian":         "gcr.io/distroless/base-debian12",
+		"node":           "gcr.io/distroless/nodejs20-debian12",
+		"python":         "gcr.io/distroless/python3-debian12",
+		"java":           "gcr.io/distroless/java21-debian12",
+		"openjdk":        "gcr.io/distroless/java21-debian12",
+		"amazoncorretto": "gcr.io/distroless/java21-debian12",
+	},
+}
+
+// alternative returns the smaller base image to propose instead of the
+// image named name, of the preferred variant when it has one.
+func (s *BaseImageStrategy) alternative(name string) (string, bool) {
+	if alt, ok := variantAlternatives[s.Variant][name]; ok {
+		return alt, true
+	}
+	alt, ok := slimAlternatives[name]
+	return alt, ok
+}
+
+// windowsAlternatives maps Windows base images to smaller ones. These are
+// suggestions only: smaller Windows images drop APIs (PowerShell, .NET
+// Framework, GUI components) the application may depend on.
+var windowsAlternatives = map[string]string{
+	"mcr.microsoft.com/windows":            "mcr.microsoft.com/windows/servercore:ltsc2022",
+	"mcr.microsoft.com/windows/server":     "mcr.microsoft.com/windows/servercore:ltsc2022",
+	"mcr.microsoft.com/windows/servercore": "mcr.microsoft.com/windows/nanoserver:ltsc2022",
+	"microsoft/windowsservercore":          "mcr.microsoft.com/windows/servercore:ltsc2022",
+	"microsoft/nanoserver":                 "mcr.microsoft.com/windows/nanoserver:ltsc2022",
+}
+
+// baseSwap is a smaller image to replace the base image of a FROM with.
+type baseSwap struct {
+	// index is the index of the FROM line.
+	index int
+	// ref is the image reference as written, image the one its ARGs
+	// resolve to, name the image without its tag.
+	ref, image, name string
+	// alt is the smaller image; windows marks a smaller Windows image.
+	alt     string
+	windows bool
+}
+
+// swap returns the first FROM whose base image has a smaller alternative.
+// FROM lines naming an earlier stage are not images, so they are left
+// alone even when the stage is named like one (FROM node AS node).
+func (s *BaseImageStrategy) swap(lines []string, args map[string]string) *baseSwap {
+	stages := make(map[string]bool)
+	for i, line := range lines {
 		trimmed := strings.TrimSpace(line)
 		if !strings.HasPrefix(strings.ToUpper(trimmed), "FROM") {
 			continue
 		}
-
-		parts := strings.Fields(trimmed)
-		if len(parts) < 2 {
+		fields := strings.Fields(trimmed)
+		ref := fromImageRef(trimmed)
+		isStage := stages[strings.ToLower(ref)]
+		if n := len(fields); n >= 4 && strings.EqualFold(fields[n-2], "AS") {
+			stages[strings.ToLower(fields[n-1])] = true
+		}
+		if ref == "" || isStage {
 			continue
 		}
-		baseImage := strings.ToLower(parts[1])
+		baseImage := strings.ToLower(analyzer.ExpandArgs(ref, args))
 
 		// Extract image name without tag
 		imageName := baseImage
@@ -64,6 +163,10 @@ func (s *BaseImageStrategy) Analyze(ctx *OptimizationContext) *models.Optimizati
 			imageName = baseImage[:idx]
 		}
 
+		if alt, ok := windowsAlternatives[imageName]; ok {
+			return &baseSwap{index: i, ref: ref, image: baseImage, name: imageName, alt: alt, windows: true}
+		}
+
 		// Already using slim/alpine/distroless? Skip.
 		if strings.Contains(baseImage, "slim") ||
 			strings.Contains(baseImage, "alpine") ||
@@ -72,154 +175,164 @@ func (s *BaseImageStrategy) Analyze(ctx *OptimizationContext) *models.Optimizati
 			continue
 		}
 
-		if alt, ok := slimAlternatives[imageName]; ok {
-			return &models.Optimization{
-				ID:          "OPT-BASE",
-				Category:    "base-image",
-				Title:       "Use a smaller base image",
-				Description: fmt.Sprintf("Replace '%s' with '%s' for a significantly smaller image.", baseImage, alt),
-				Impact:      "50-80% size reduction",
-				Priority:    1,
-				AutoFixable: true,
-			}
+		if alt, ok := s.alternative(imageName); ok {
+			return &baseSwap{index: i, ref: ref, image: baseImage, name: imageName, alt: alt}
 		}
 	}
 	return nil
 }
 
-func (s *BaseImageStrategy) Apply(ctx *OptimizationContext) (string, error) {
-	content := ctx.CurrentContent
-	lines := strings.Split(content, "\n")
-	modified := false
-
-	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if !strings.HasPrefix(strings.ToUpper(trimmed), "FROM") {
-			continue
-		}
-
-		parts := strings.Fields(trimmed)
-		if len(parts) < 2 {
-			continue
-		}
-		baseImage := strings.ToLower(parts[1])
-		imageName := baseImage
-		if idx := strings.Index(baseImage, ":"); idx != -1 {
-			imageName = baseImage[:idx]
-		}
-
-		if strings.Contains(baseImage, "slim") ||
-			strings.Contains(baseImage, "alpine") ||
-			strings.Contains(baseImage, "distroless") ||
-			baseImage == "scratch" {
-			continue
+func (s *BaseImageStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	if len(s.Golden) > 0 {
+		return s.analyzeGolden(ctx)
+	}
+	swap := s.swap(ctx.Lines, ctx.Args)
+	if swap == nil {
+		return nil
+	}
+	if swap.windows {
+		return &models.Optimization{
+			ID:             "OPT-BASE",
+			Category:       "base-image",
+			Title:          "Use a smaller Windows base image",
+			Description:    fmt.Sprintf("Replace '%s' with '%s' if the application doesn't need the APIs it removes. Check PowerShell and .NET Framework usage before switching.", swap.image, swap.alt),
+			Impact:         "50-90% size reduction",
+			EstimatedBytes: 2 << 30,
+			// Smaller Windows images drop APIs the application may use
+			Confidence: models.ConfidenceLow,
+			Priority:   1,
 		}
+	}
 
-		if alt, ok := slimAlternatives[imageName]; ok {
-			parts[1] = alt
-			lines[i] = strings.Join(parts, " ")
-			modified = true
-			break // Only modify the first FROM for safety
-		}
+	// A base image chosen by a build arg can't be rewritten in place
+	fromArg := swap.image != strings.ToLower(swap.ref)
+	description := fmt.Sprintf("Replace '%s' with '%s' for a significantly smaller image.", swap.image, swap.alt)
+	if fromArg {
+		description = fmt.Sprintf("The ARG values resolve '%s' to '%s'. Change the ARG default or --build-arg to '%s' for a significantly smaller image.", swap.ref, swap.image, swap.alt)
+	}
+	// Without a shell, the RUN instructions of the stage fail
+	distroless := strings.Contains(swap.alt, "distroless")
+	if distroless {
+		description += " Distroless images have no shell or package manager: build in another stage and copy the result into the one that runs the application."
 	}
+	return &models.Optimization{
+		ID:             "OPT-BASE",
+		Category:       "base-image",
+		Title:          "Use a smaller base image",
+		Description:    description,
+		Impact:         "50-80% size reduction",
+		EstimatedBytes: 500 << 20,
+		Confidence:     baseSwapConfidence(swap.name, swap.alt),
+		Priority:       1,
+		AutoFixable:    !fromArg && !distroless,
+	}
+}
 
-	if !modified {
-		return content, fmt.Errorf("no applicable base image change")
+// baseSwapConfidence returns how likely replacing the image named name
+// with alt is to build unchanged. Alpine swaps musl for glibc and apk for
+// apt, moving to another distribution changes the package manager, and
+// distroless images have none: all often break the RUN instructions that
+// follow.
+func baseSwapConfidence(name, alt string) string {
+	repo, _, _ := strings.Cut(alt, ":")
+	if strings.Contains(alt, "alpine") || repo != name {
+		return models.ConfidenceLow
 	}
+	return models.ConfidenceMedium
+}
 
+// Apply replaces only the image of the FROM line, keeping its flags and
+// its stage name, which later FROM and COPY --from may reference.
+func (s *BaseImageStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	if len(s.Golden) > 0 {
+		return s.applyGolden(ctx)
+	}
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	swap := s.swap(lines, ctx.Args)
+	if swap == nil || swap.windows || strings.Contains(swap.ref, "$") || strings.Contains(swap.alt, "distroless") {
+		return ctx.CurrentContent, fmt.Errorf("no applicable base image change")
+	}
+	lines[swap.index] = strings.Replace(lines[swap.index], swap.ref, swap.alt, 1)
 	return strings.Join(lines, "\n"), nil
 }
 
-// --- CombineLayersStrategy ---
-
-type CombineLayersStrategy struct{}
-
-func (s *CombineLayersStrategy) Name() string { return "combine-layers" }
-
-func (s *CombineLayersStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
-	consecutiveRuns := 0
-	for _, line := range ctx.Lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(strings.ToUpper(trimmed), "RUN ") {
-			consecutiveRuns++
-		} else if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
-			consecutiveRuns = 0
-		}
+// goldenChange returns the change of the final stage to a golden image,
+// or nil when there is none to make.
+func (s *BaseImageStrategy) goldenChange(lines []string, ctx *OptimizationContext) *analyzer.GoldenChange {
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	change := pdf.GoldenChange(s.Golden)
+	if change == nil || change.To == "" {
+		return nil
 	}
+	return change
+}
 
-	if consecutiveRuns >= 2 {
-		return &models.Optimization{
-			ID:          "OPT-LAYERS",
-			Category:    "layer-optimization",
-			Title:       "Combine consecutive RUN commands",
-			Description: "Multiple consecutive RUN commands can be merged to reduce layers.",
-			Impact:      "10-20% size reduction",
-			Priority:    3,
-			AutoFixable: true,
-		}
+func (s *BaseImageStrategy) analyzeGolden(ctx *OptimizationContext) *models.Optimization {
+	change := s.goldenChange(ctx.Lines, ctx)
+	if change == nil {
+		return nil
+	}
+	ref := fromImageRef(ctx.Lines[change.Line-1])
+	fromArg := strings.Contains(ref, "$")
+	var description string
+	switch {
+	case change.Tag:
+		description = fmt.Sprintf("Replace '%s' with '%s', the tag the golden image catalog recommends.", change.From, change.To)
+	case change.Runtime != "":
+		description = fmt.Sprintf("Replace '%s' with '%s', the golden image for %s.", change.From, change.To, change.Runtime)
+	default:
+		description = fmt.Sprintf("Replace '%s' with the golden image '%s'.", change.From, change.To)
+	}
+	if fromArg {
+		description = fmt.Sprintf("The ARG values resolve '%s' to '%s'. Change the ARG default or --build-arg to '%s', the golden image for the application.", ref, change.From, change.To)
+	}
+	return &models.Optimization{
+		ID:              "OPT-BASE",
+		Category:        "base-image",
+		Title:           "Use the golden base image",
+		Description:     description,
+		Impact:          "Base image maintained and patched by the organization",
+		Confidence:      models.ConfidenceMedium,
+		Priority:        1,
+		AutoFixable:     !fromArg,
+		RelatedIssueIDs: reportedIssues(ctx.Analysis, "DIO035"),
 	}
-	return nil
 }
 
-func (s *CombineLayersStrategy) Apply(ctx *OptimizationContext) (string, error) {
+func (s *BaseImageStrategy) applyGolden(ctx *OptimizationContext) (string, error) {
 	lines := strings.Split(ctx.CurrentContent, "\n")
-	var result []string
-	var runBuffer []string
-	inRun := false
-
-	flushRuns := func() {
-		if len(runBuffer) == 0 {
-			return
-		}
-		if len(runBuffer) == 1 {
-			result = append(result, "RUN "+runBuffer[0])
-		} else {
-			combined := "RUN " + runBuffer[0]
-			for _, r := range runBuffer[1:] {
-				combined += " && \\\n    " + r
-			}
-			result = append(result, combined)
-		}
-		runBuffer = nil
+	change := s.goldenChange(lines, ctx)
+	if change == nil {
+		return ctx.CurrentContent, fmt.Errorf("no applicable base image change")
 	}
-
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-
-		if strings.HasPrefix(strings.ToUpper(trimmed), "RUN ") {
-			cmd := strings.TrimSpace(trimmed[4:])
-			// Remove trailing backslash continuation from individual commands
-			cmd = strings.TrimSuffix(cmd, "\\")
-			cmd = strings.TrimSpace(cmd)
-			runBuffer = append(runBuffer, cmd)
-			inRun = true
-			continue
-		}
-
-		if inRun && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
-			continue
-		}
-
-		if inRun {
-			flushRuns()
-			inRun = false
-		}
-
-		result = append(result, line)
+	line := lines[change.Line-1]
+	ref := fromImageRef(line)
+	if ref == "" || strings.Contains(ref, "$") {
+		return ctx.CurrentContent, fmt.Errorf("base image set by a build arg")
 	}
-
-	flushRuns()
-
-	return strings.Join(result, "\n"), nil
+	lines[change.Line-1] = strings.Replace(line, ref, change.To, 1)
+	return strings.Join(lines, "\n"), nil
 }
 
 // --- MultiStageStrategy ---
 
-type MultiStageStrategy struct{}
+type MultiStageStrategy struct {
+	// User and Workdir are the non-root user and working directory of the
+	// stage that runs the application, from .dio.yaml.
+	User    config.UserConfig
+	Workdir string
+}
 
 func (s *MultiStageStrategy) Name() string { return "multi-stage-build" }
 
 func (s *MultiStageStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	// The templates produce Linux runtime images, and a base image keeps
+	// its toolchain for the images built on it
+	if ctx.Windows || ctx.Analysis.ImageKind == analyzer.KindBaseImage {
+		return nil
+	}
+
 	// Check if already using multi-stage
 	fromCount := 0
 	for _, line := range ctx.Lines {
@@ -238,13 +351,16 @@ func (s *MultiStageStrategy) Analyze(ctx *OptimizationContext) *models.Optimizat
 		for _, indicator := range buildIndicators {
 			if strings.Contains(lower, indicator) {
 				return &models.Optimization{
-					ID:          "OPT-MULTISTAGE",
-					Category:    "multi-stage",
-					Title:       "Introduce multi-stage build",
-					Description: "Build commands detected. Use multi-stage builds to exclude build tools from the final image.",
-					Impact:      "40-70% size reduction",
-					Priority:    1,
-					AutoFixable: true,
+					ID:              "OPT-MULTISTAGE",
+					Category:        "multi-stage",
+					Title:           "Introduce multi-stage build",
+					Description:     "Build commands detected. Use multi-stage builds to exclude build tools from the final image.",
+					Impact:          "40-70% size reduction",
+					EstimatedBytes:  300 << 20,
+					Confidence:      models.ConfidenceLow,
+					Priority:        1,
+					AutoFixable:     true,
+					RelatedIssueIDs: reportedIssues(ctx.Analysis, "DIO008"),
 				}
 			}
 		}
@@ -264,14 +380,54 @@ func (s *MultiStageStrategy) Apply(ctx *OptimizationContext) (string, error) {
 		return content, fmt.Errorf("cannot determine project language for multi-stage optimization")
 	}
 
-	template := getMultiStageTemplate(lang, lines)
+	template := getMultiStageTemplate(lang, lines, templateOptions{user: s.User, workdir: s.Workdir})
 	if template == "" {
 		return content, fmt.Errorf("no multi-stage template available for %s", lang)
 	}
+	// docker build --target and the pipeline may build the stage by name
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	if final := pdf.FinalStage(); final >= 0 && pdf.Stages[final].Name != "" {
+		template = nameFinalStage(template, pdf.Stages[final].Name)
+	}
 
 	return template, nil
 }
 
+// nameFinalStage gives the final stage of a template the name of the stage
+// it replaces. A build stage of the template with that name is renamed
+// build, along with the COPY --from referencing it.
+func nameFinalStage(template, name string) string {
+	lines := strings.Split(template, "\n")
+	final := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "FROM ") {
+			final = i
+		}
+	}
+	renamed := ""
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		n := len(fields)
+		if n == 0 {
+			continue
+		}
+		aliased := n >= 4 && fields[0] == "FROM" && strings.EqualFold(fields[n-2], "AS")
+		switch {
+		case i == final:
+			if aliased {
+				fields = fields[:n-2]
+			}
+			lines[i] = strings.Join(append(fields, "AS", name), " ")
+		case aliased && strings.EqualFold(fields[n-1], name):
+			renamed = fields[n-1]
+			lines[i] = strings.Join(append(fields[:n-1], "build"), " ")
+		case renamed != "" && fields[0] == "COPY":
+			lines[i] = strings.Replace(line, "--from="+renamed+" ", "--from=build ", 1)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 // --- CacheOptStrategy ---
 
 type CacheOptStrategy struct{}
@@ -306,6 +462,7 @@ func (s *CacheOptStrategy) Analyze(ctx *OptimizationContext) *models.Optimizatio
 			Title:       "Reorder COPY for better cache utilization",
 			Description: "Copy dependency files (package.json, go.mod, etc.) before source code for better Docker layer caching.",
 			Impact:      "Faster rebuilds",
+			Confidence:  models.ConfidenceHigh,
 			Priority:    2,
 		}
 	}
@@ -319,21 +476,39 @@ func (s *CacheOptStrategy) Apply(ctx *OptimizationContext) (string, error) {
 
 // --- NonRootUserStrategy ---
 
-type NonRootUserStrategy struct{}
+type NonRootUserStrategy struct {
+	// User is the user to create, from .dio.yaml. The zero value creates
+	// appuser, 1001:1001.
+	User config.UserConfig
+}
 
 func (s *NonRootUserStrategy) Name() string { return "non-root-user" }
 
 func (s *NonRootUserStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	// Images built on a base image usually install packages as root before
+	// switching to their own user
+	if ctx.Analysis.ImageKind == analyzer.KindBaseImage {
+		return nil
+	}
+	// An earlier strategy may have replaced the final stage with one that
+	// runs as a user
+	pdf := analyzer.ParseDockerfile(ctx.Lines, ctx.Args)
+	pdf.Target = ctx.Target
+	if user, _ := pdf.EffectiveUser(); user != "" && !analyzer.IsRootUser(user) {
+		return nil
+	}
 	for _, issue := range ctx.Analysis.Issues {
 		if issue.ID == "DIO006" {
 			return &models.Optimization{
-				ID:          "OPT-USER",
-				Category:    "security",
-				Title:       "Add non-root user",
-				Description: "Container runs as root. Add a non-root user for improved security.",
-				Impact:      "Security improvement",
-				Priority:    2,
-				AutoFixable: true,
+				ID:              "OPT-USER",
+				Category:        "security",
+				Title:           "Add non-root user",
+				Description:     "Container runs as root. Add a non-root user for improved security.",
+				Impact:          "Security improvement",
+				Confidence:      models.ConfidenceMedium,
+				Priority:        2,
+				AutoFixable:     true,
+				RelatedIssueIDs: []string{"DIO006"},
 			}
 		}
 	}
@@ -343,9 +518,11 @@ func (s *NonRootUserStrategy) Analyze(ctx *OptimizationContext) *models.Optimiza
 func (s *NonRootUserStrategy) Apply(ctx *OptimizationContext) (string, error) {
 	lines := strings.Split(ctx.CurrentContent, "\n")
 
-	// Find the last CMD or ENTRYPOINT
-	insertIdx := len(lines) - 1
-	for i := len(lines) - 1; i >= 0; i-- {
+	// Find the final stage's last CMD or ENTRYPOINT
+	final, _ := finalFrom(lines, ctx.Args, ctx.Target)
+	end := stageEnd(lines, final)
+	insertIdx := end - 1
+	for i := end - 1; i > final; i-- {
 		trimmed := strings.TrimSpace(lines[i])
 		upper := strings.ToUpper(trimmed)
 		if strings.HasPrefix(upper, "CMD") || strings.HasPrefix(upper, "ENTRYPOINT") {
@@ -364,14 +541,16 @@ func (s *NonRootUserStrategy) Apply(ctx *OptimizationContext) (string, error) {
 	// Insert USER instruction before CMD/ENTRYPOINT
 	var result []string
 	for i, line := range lines {
-		if i == insertIdx {
+		if i == insertIdx && ctx.Windows {
 			result = append(result,
-				"# Run as non-root user for security",
-				"RUN addgroup --system --gid 1001 appgroup && \\",
-				"    adduser --system --uid 1001 --ingroup appgroup appuser",
-				"USER appuser",
+				"# Run without administrator rights",
+				"USER ContainerUser",
 				"",
 			)
+		} else if i == insertIdx {
+			result = append(result, "# Run as non-root user for security; a numeric USER lets runAsNonRoot verify it")
+			result = append(result, userLines(s.User)...)
+			result = append(result, "")
 		}
 		result = append(result, line)
 	}
@@ -379,51 +558,100 @@ func (s *NonRootUserStrategy) Apply(ctx *OptimizationContext) (string, error) {
 	return strings.Join(result, "\n"), nil
 }
 
+// userLines returns the instructions that create user and switch to it.
+func userLines(user config.UserConfig) []string {
+	user = user.WithDefaults()
+	return []string{
+		fmt.Sprintf("RUN addgroup --system --gid %d %s && \\", user.GID, user.Group),
+		fmt.Sprintf("    adduser --system --uid %d --ingroup %s %s", user.UID, user.Group, user.Name),
+		fmt.Sprintf("USER %d:%d", user.UID, user.GID),
+	}
+}
+
 // --- CleanupStrategy ---
 
 type CleanupStrategy struct{}
 
 func (s *CleanupStrategy) Name() string { return "cleanup" }
 
+// After has the caches cleaned at the end of the RUNs CombineLayersStrategy
+// merges, rather than in the middle of them.
+func (s *CleanupStrategy) After() []string { return []string{"combine-layers"} }
+
 func (s *CleanupStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
-	for _, issue := range ctx.Analysis.Issues {
-		if issue.ID == "DIO005" {
-			return &models.Optimization{
-				ID:          "OPT-CLEANUP",
-				Category:    "cleanup",
-				Title:       "Clean package manager caches",
-				Description: "Package manager caches are not cleaned, wasting space in the final image.",
-				Impact:      "10-30% size reduction",
-				Priority:    2,
-				AutoFixable: true,
-			}
-		}
+	related := reportedIssues(ctx.Analysis, "DIO004", "DIO005")
+	if len(related) == 0 {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-CLEANUP",
+		Category:        "cleanup",
+		Title:           "Clean package manager caches",
+		Description:     "Package manager caches are not cleaned, wasting space in the final image.",
+		Impact:          "10-30% size reduction",
+		EstimatedBytes:  50 << 20,
+		Confidence:      models.ConfidenceHigh,
+		Priority:        2,
+		AutoFixable:     true,
+		RelatedIssueIDs: related,
 	}
-	return nil
 }
 
 func (s *CleanupStrategy) Apply(ctx *OptimizationContext) (string, error) {
-	content := ctx.CurrentContent
-
-	// Add cleanup to apt-get commands
-	aptGetPattern := regexp.MustCompile(`(apt-get install[^\n]+)`)
-	content = aptGetPattern.ReplaceAllStringFunc(content, func(match string) string {
-		if strings.Contains(match, "rm -rf /var/lib/apt/lists") {
-			return match
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	edits := make(map[int]*lineEdit)
+	for _, inst := range pdf.Instructions {
+		if inst.Command != "RUN" {
+			continue
+		}
+		start, end := span(inst)
+		edited := append([]string(nil), lines[start:end]...)
+
+		// Clean the caches at the end of the RUN, or keep apk from caching.
+		// A cleanup can't go after a heredoc, and apt lists are left alone
+		// in RUNs that only update them for a later install. Nor can it
+		// follow a comment or an operator the script ends with.
+		var options []analyzer.InstallOption
+		for _, c := range pdf.UncleanedCaches(inst) {
+			switch {
+			case c.Option != nil:
+				options = append(options, *c.Option)
+			case len(inst.Heredocs) == 0 && analyzer.Appendable(inst.Args) && c.Install.MatchString(inst.Args):
+				edited[len(edited)-1] += " && " + string(ctx.Escape) + "\n    " + c.Clean
+			}
 		}
-		return match + " && \\\n    rm -rf /var/lib/apt/lists/*"
-	})
 
-	// Add --no-install-recommends
-	content = strings.ReplaceAll(content, "apt-get install ", "apt-get install --no-install-recommends ")
-	content = strings.ReplaceAll(content, "--no-install-recommends --no-install-recommends", "--no-install-recommends")
+		// Leave out recommended and weak dependencies
+		text := strings.Join(edited, "\n")
+		for _, opt := range append(options, analyzer.WeakDependencyOptions...) {
+			text = addInstallOption(text, opt)
+		}
+		if text != strings.Join(lines[start:end], "\n") {
+			edits[start] = &lineEdit{end: end, lines: []string{text}}
+		}
+	}
+	return strings.Join(applyEdits(lines, edits), "\n"), nil
+}
 
-	return content, nil
+// addInstallOption adds an option to the install commands of a script that
+// lack it.
+func addInstallOption(script string, opt analyzer.InstallOption) string {
+	missing := opt.Missing(script)
+	for i := len(missing) - 1; i >= 0; i-- {
+		at := missing[i]
+		script = script[:at] + " " + opt.Option + script[at:]
+	}
+	return script
 }
 
 // --- WorkdirStrategy ---
 
-type WorkdirStrategy struct{}
+type WorkdirStrategy struct {
+	// Path is the WORKDIR of Linux images, from .dio.yaml (default: /app).
+	Path string
+}
 
 func (s *WorkdirStrategy) Name() string { return "workdir" }
 
@@ -431,13 +659,15 @@ func (s *WorkdirStrategy) Analyze(ctx *OptimizationContext) *models.Optimization
 	for _, issue := range ctx.Analysis.Issues {
 		if issue.ID == "DIO011" {
 			return &models.Optimization{
-				ID:          "OPT-WORKDIR",
-				Category:    "best-practice",
-				Title:       "Set WORKDIR",
-				Description: "No WORKDIR set. Files are placed in / by default.",
-				Impact:      "Best practice",
-				Priority:    4,
-				AutoFixable: true,
+				ID:              "OPT-WORKDIR",
+				Category:        "best-practice",
+				Title:           "Set WORKDIR",
+				Description:     "No WORKDIR set. Files are placed in / by default.",
+				Impact:          "Best practice",
+				Confidence:      models.ConfidenceHigh,
+				Priority:        4,
+				AutoFixable:     true,
+				RelatedIssueIDs: []string{"DIO011"},
 			}
 		}
 	}
@@ -446,31 +676,260 @@ func (s *WorkdirStrategy) Analyze(ctx *OptimizationContext) *models.Optimization
 
 func (s *WorkdirStrategy) Apply(ctx *OptimizationContext) (string, error) {
 	lines := strings.Split(ctx.CurrentContent, "\n")
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	final := pdf.FinalStage()
+	if final < 0 {
+		return ctx.CurrentContent, fmt.Errorf("no final stage")
+	}
+	// A WORKDIR in the final stage, or a stage it inherits from, already
+	// applies; one in a builder stage doesn't
+	for _, stage := range pdf.StageChain(final) {
+		for _, inst := range stage.Instructions {
+			if inst.Command == "WORKDIR" {
+				return ctx.CurrentContent, fmt.Errorf("the final stage already sets WORKDIR")
+			}
+		}
+	}
 
-	// Check if WORKDIR already exists
-	for _, line := range lines {
-		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line)), "WORKDIR") {
-			return ctx.CurrentContent, nil
+	workdir := "WORKDIR " + config.DefaultWorkdir
+	if s.Path != "" {
+		workdir = "WORKDIR " + s.Path
+	}
+	if ctx.Windows {
+		workdir = `WORKDIR C:\app`
+	}
+	from := pdf.Stages[final].Instructions[0].EndLine
+	result := make([]string, 0, len(lines)+1)
+	result = append(result, lines[:from]...)
+	result = append(result, workdir)
+	result = append(result, lines[from:]...)
+	return strings.Join(result, "\n"), nil
+}
+
+// --- HealthcheckStrategy ---
+// Adds a HEALTHCHECK probing the exposed port with a tool the image has.
+
+type HealthcheckStrategy struct{}
+
+func (s *HealthcheckStrategy) Name() string { return "healthcheck" }
+
+func (s *HealthcheckStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	// What to probe is up to the images built on a base image
+	if ctx.Analysis.ImageKind == analyzer.KindBaseImage {
+		return nil
+	}
+	for _, issue := range ctx.Analysis.Issues {
+		if issue.ID != "DIO012" || !issue.AutoFixable {
+			continue
+		}
+		h := analyzer.SuggestHealthcheck(ctx.OriginalContent, ctx.Args, ctx.Target)
+		if h == nil {
+			return nil
+		}
+		return &models.Optimization{
+			ID:              "OPT-HEALTHCHECK",
+			Category:        "best-practice",
+			Title:           "Add HEALTHCHECK",
+			Description:     fmt.Sprintf("No HEALTHCHECK defined. Probe port %s over %s with %s.", h.Port, strings.ToUpper(h.Protocol), h.Probe),
+			Impact:          "Orchestrators can detect and restart unhealthy containers",
+			Confidence:      models.ConfidenceMedium,
+			Priority:        3,
+			AutoFixable:     true,
+			RelatedIssueIDs: []string{"DIO012"},
 		}
 	}
+	return nil
+}
 
-	var result []string
+func (s *HealthcheckStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	h := analyzer.SuggestHealthcheck(ctx.CurrentContent, ctx.Args, ctx.Target)
+	if h == nil {
+		return ctx.CurrentContent, nil
+	}
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	final, _ := finalFrom(lines, ctx.Args, ctx.Target)
+	if final < 0 {
+		return ctx.CurrentContent, nil
+	}
 
-	inserted := false
-	for _, line := range lines {
-		result = append(result, line)
-		trimmed := strings.TrimSpace(line)
-		if !inserted && strings.HasPrefix(strings.ToUpper(trimmed), "FROM") {
-			result = append(result, "WORKDIR /app")
-			inserted = true
+	// Insert before the final stage's CMD or ENTRYPOINT, or at its end
+	end := stageEnd(lines, final)
+	insertIdx := end
+	for insertIdx > final+1 && strings.TrimSpace(lines[insertIdx-1]) == "" {
+		insertIdx--
+	}
+	for i := final + 1; i < end; i++ {
+		upper := strings.ToUpper(strings.TrimSpace(lines[i]))
+		if strings.HasPrefix(upper, "CMD") || strings.HasPrefix(upper, "ENTRYPOINT") {
+			insertIdx = i
+			break
+		}
+	}
+
+	result := make([]string, 0, len(lines)+len(h.Instructions)+1)
+	result = append(result, lines[:insertIdx]...)
+	result = append(result, h.Instructions...)
+	result = append(result, lines[insertIdx:]...)
+	return strings.Join(result, "\n"), nil
+}
+
+// --- RuntimeDataStrategy ---
+// Adds the CA certificates and timezone data that the final base image
+// lacks (DIO015, DIO016).
+
+type RuntimeDataStrategy struct{}
+
+func (s *RuntimeDataStrategy) Name() string { return "runtime-data" }
+
+func (s *RuntimeDataStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	certs, tzdata := missingRuntimeData(ctx.Analysis)
+	var what []string
+	if certs {
+		what = append(what, "CA certificates")
+	}
+	if tzdata {
+		what = append(what, "timezone data")
+	}
+	if len(what) == 0 {
+		return nil
+	}
+	return &models.Optimization{
+		ID:              "OPT-RUNTIME-DATA",
+		Category:        "best-practice",
+		Title:           "Add " + strings.Join(what, " and "),
+		Description:     "The final base image has no " + strings.Join(what, " or ") + ", which the application needs at runtime.",
+		Impact:          "Fixes HTTPS and timezone handling at runtime",
+		Confidence:      models.ConfidenceHigh,
+		Priority:        2,
+		AutoFixable:     true,
+		RelatedIssueIDs: reportedIssues(ctx.Analysis, "DIO015", "DIO016"),
+	}
+}
+
+func (s *RuntimeDataStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	certs, tzdata := missingRuntimeData(ctx.Analysis)
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	idx, base := finalFrom(lines, ctx.Args, ctx.Target)
+	if idx < 0 {
+		return ctx.CurrentContent, nil
+	}
+
+	var add []string
+	switch {
+	case base == "scratch":
+		add = append(add, "# Runtime data that scratch doesn't have")
+		if certs {
+			add = append(add, "COPY --from="+analyzer.RuntimeDataImage+" /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/")
 		}
+		if tzdata {
+			add = append(add, "COPY --from="+analyzer.RuntimeDataImage+" /usr/share/zoneinfo /usr/share/zoneinfo")
+		}
+	case strings.Contains(base, "alpine"):
+		add = append(add, "RUN apk add --no-cache "+runtimePackages(certs, tzdata))
+	default:
+		add = append(add, "RUN apt-get update && apt-get install -y --no-install-recommends "+runtimePackages(certs, tzdata)+" && rm -rf /var/lib/apt/lists/*")
 	}
 
+	result := make([]string, 0, len(lines)+len(add))
+	result = append(result, lines[:idx+1]...)
+	result = append(result, add...)
+	result = append(result, lines[idx+1:]...)
 	return strings.Join(result, "\n"), nil
 }
 
+// missingRuntimeData reports which of the runtime data rules fired.
+func missingRuntimeData(analysis *models.AnalysisResult) (certs, tzdata bool) {
+	for _, issue := range analysis.Issues {
+		switch issue.ID {
+		case "DIO015":
+			certs = true
+		case "DIO016":
+			tzdata = true
+		}
+	}
+	return certs, tzdata
+}
+
+func runtimePackages(certs, tzdata bool) string {
+	var pkgs []string
+	if certs {
+		pkgs = append(pkgs, "ca-certificates")
+	}
+	if tzdata {
+		pkgs = append(pkgs, "tzdata")
+	}
+	return strings.Join(pkgs, " ")
+}
+
+// finalFrom returns the index of the FROM line of the final stage, the
+// target stage or the last one, and the external image it is built on,
+// following FROM <stage> references.
+func finalFrom(lines []string, args map[string]string, target string) (int, string) {
+	idx := -1
+	var image string
+	stages := make(map[string]string)
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		ref := strings.ToLower(analyzer.ExpandArgs(fromImageRef(line), args))
+		if parent, ok := stages[ref]; ok {
+			ref = parent
+		}
+		idx, image = i, ref
+		if n := len(fields); n >= 4 && strings.EqualFold(fields[n-2], "AS") {
+			stages[strings.ToLower(fields[n-1])] = ref
+			if target != "" && strings.EqualFold(fields[n-1], target) {
+				break
+			}
+		}
+	}
+	return idx, image
+}
+
 // --- Helpers ---
 
+// reportedIssues returns the IDs among ids that the analysis reported.
+func reportedIssues(analysis *models.AnalysisResult, ids ...string) []string {
+	var reported []string
+	for _, id := range ids {
+		for _, issue := range analysis.Issues {
+			if issue.ID == id {
+				reported = append(reported, id)
+				break
+			}
+		}
+	}
+	return reported
+}
+
+// fromImageRef returns the image reference of a FROM line, skipping flags
+// such as --platform.
+func fromImageRef(line string) string {
+	for _, f := range strings.Fields(line)[1:] {
+		if !strings.HasPrefix(f, "--") {
+			return f
+		}
+	}
+	return ""
+}
+
+// commandSeparator returns the operator used to chain commands in a combined
+// RUN. Windows PowerShell 5 has no &&, so PowerShell stages use ";".
+func commandSeparator(ctx *OptimizationContext) string {
+	if ctx.Windows {
+		for _, line := range ctx.Lines {
+			trimmed := strings.ToLower(strings.TrimSpace(line))
+			if strings.HasPrefix(trimmed, "shell") && strings.Contains(trimmed, "powershell") {
+				return ";"
+			}
+		}
+	}
+	return " &&"
+}
+
 func detectLanguage(lines []string) string {
 	for _, line := range lines {
 		lower := strings.ToLower(line)
@@ -0,0 +1,143 @@
+package optimizer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/config"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- StripDocsStrategy ---
+// Keeps documentation, man pages and translations out of the final image
+// of Debian and Ubuntu builds, configured under strip in .dio.yaml. Only
+// the files of packages the Dockerfile installs are affected: those of the
+// base image are in its layers already.
+
+type StripDocsStrategy struct {
+	Config config.StripConfig
+}
+
+func (s *StripDocsStrategy) Name() string { return "strip-docs" }
+
+// StrippedDirs are the directories the strategy empties, measured by dio
+// run in the baseline and optimized images.
+var StrippedDirs = []string{"/usr/share/doc", "/usr/share/man", "/usr/share/info", "/usr/share/locale"}
+
+// dpkgExcludesFile is the dpkg configuration the dpkg method writes.
+const dpkgExcludesFile = "/etc/dpkg/dpkg.cfg.d/01-dio-nodoc"
+
+func (s *StripDocsStrategy) Analyze(ctx *OptimizationContext) *models.Optimization {
+	if ctx.Windows || len(s.installs(ctx.Lines, ctx)) == 0 {
+		return nil
+	}
+	how := "Configure dpkg to skip them when packages are installed"
+	if s.Config.Method == "remove" {
+		how = "Remove them at the end of each RUN that installs packages"
+	}
+	return &models.Optimization{
+		ID:             "OPT-STRIP-DOCS",
+		Category:       "cleanup",
+		Title:          "Strip documentation, man pages and translations",
+		Description:    how + ". Aggressive: man and info stop working, programs only print messages in English (or the kept locales), and the documentation of packages is gone except their copyright notices, which licenses such as the GPL require to ship.",
+		Impact:         "Typically 5-50MB on Debian and Ubuntu images; dio run measures it",
+		EstimatedBytes: 20 << 20,
+		Confidence:     models.ConfidenceMedium,
+		Priority:       4,
+		AutoFixable:    true,
+	}
+}
+
+func (s *StripDocsStrategy) Apply(ctx *OptimizationContext) (string, error) {
+	lines := strings.Split(ctx.CurrentContent, "\n")
+	installs := s.installs(lines, ctx)
+	if len(installs) == 0 {
+		return ctx.CurrentContent, fmt.Errorf("no apt-get install to strip")
+	}
+	edits := make(map[int]*lineEdit)
+	if s.Config.Method == "remove" {
+		for _, inst := range installs {
+			if len(inst.Heredocs) > 0 || !analyzer.Appendable(inst.Args) || strings.Contains(inst.Args, "/usr/share/doc") {
+				continue
+			}
+			start, end := span(inst)
+			edited := append([]string(nil), lines[start:end]...)
+			for _, cmd := range s.removeCommands() {
+				edited[len(edited)-1] += " && " + string(ctx.Escape) + "\n    " + cmd
+			}
+			edits[start] = &lineEdit{end: end, lines: edited}
+		}
+	} else {
+		// Before the first install, so that every install after it skips
+		// the files
+		start, end := span(installs[0])
+		edits[start] = &lineEdit{end: end, lines: append(s.dpkgExcludes(string(ctx.Escape)), lines[start:end]...)}
+	}
+	return strings.Join(applyEdits(lines, edits), "\n"), nil
+}
+
+// installs returns the RUNs of the final image that install apt packages,
+// earliest first. Slim images and Dockerfiles that set up dpkg excludes
+// already have nothing to strip.
+func (s *StripDocsStrategy) installs(lines []string, ctx *OptimizationContext) []analyzer.Instruction {
+	pdf := analyzer.ParseDockerfile(lines, ctx.Args)
+	pdf.Target = ctx.Target
+	if pdf.FinalStage() < 0 {
+		return nil
+	}
+	chain := pdf.StageChain(pdf.FinalStage())
+	if strings.Contains(chain[len(chain)-1].BaseImage, "slim") {
+		return nil
+	}
+	var installs []analyzer.Instruction
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, inst := range chain[i].Instructions {
+			if inst.Command != "RUN" {
+				continue
+			}
+			if strings.Contains(inst.Args, "path-exclude") {
+				return nil
+			}
+			for _, install := range analyzer.PackageInstalls(inst.Args) {
+				if install.Manager == analyzer.ManagerApt {
+					installs = append(installs, inst)
+					break
+				}
+			}
+		}
+	}
+	return installs
+}
+
+// dpkgExcludes returns the RUN writing the dpkg path-excludes.
+func (s *StripDocsStrategy) dpkgExcludes(escape string) []string {
+	rules := []string{
+		"path-exclude=/usr/share/doc/*",
+		"path-include=/usr/share/doc/*/copyright",
+		"path-exclude=/usr/share/man/*",
+		"path-exclude=/usr/share/info/*",
+		"path-exclude=/usr/share/locale/*/LC_MESSAGES/*.mo",
+	}
+	for _, locale := range s.Config.KeepLocales {
+		rules = append(rules, "path-include=/usr/share/locale/"+locale+"/LC_MESSAGES/*.mo")
+	}
+	run := []string{"RUN printf '%s\\n' " + escape}
+	for _, rule := range rules {
+		run = append(run, "        '"+rule+"' "+escape)
+	}
+	return append(run, "        > "+dpkgExcludesFile)
+}
+
+// removeCommands returns the commands deleting what the RUN installed.
+func (s *StripDocsStrategy) removeCommands() []string {
+	locales := "find /usr/share/locale -name '*.mo'"
+	for _, locale := range s.Config.KeepLocales {
+		locales += " ! -path '/usr/share/locale/" + locale + "/*'"
+	}
+	return []string{
+		"find /usr/share/doc -type f ! -name copyright -delete",
+		"rm -rf /usr/share/man/* /usr/share/info/*",
+		locales + " -delete",
+	}
+}
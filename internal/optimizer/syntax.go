@@ -0,0 +1,28 @@
+package optimizer
+
+import (
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+)
+
+// syntaxSupported reports whether a strategy may write feature into
+// lines: their syntax directive selects a frontend that supports it, or
+// there is none and addSyntaxDirective adds one. Custom frontends and
+// releases that are too old are left alone.
+func syntaxSupported(lines []string, feature analyzer.SyntaxFeature) bool {
+	d := analyzer.ParseDirectives(lines)
+	if d.Syntax == "" {
+		return true
+	}
+	frontend, ok := analyzer.ParseFrontend(d.Syntax)
+	return ok && frontend.Supports(feature)
+}
+
+// addSyntaxDirective adds analyzer.SyntaxDirective at the top of lines
+// when they have no syntax directive, so that builders with an older
+// built-in frontend pull one that parses the syntax a strategy wrote.
+func addSyntaxDirective(lines []string) []string {
+	if analyzer.ParseDirectives(lines).Syntax != "" {
+		return lines
+	}
+	return append([]string{analyzer.SyntaxDirective}, lines...)
+}
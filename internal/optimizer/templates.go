@@ -1,29 +1,52 @@
 package optimizer
 
 import (
+	"path"
 	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/config"
 )
 
+// templateOptions are the house conventions of .dio.yaml the templates
+// follow in the stage that runs the application.
+type templateOptions struct {
+	user    config.UserConfig
+	workdir string
+}
+
+// userBlock returns the instructions that create the non-root user.
+func (o templateOptions) userBlock() string {
+	return strings.Join(userLines(o.user), "\n")
+}
+
+// dir returns the working directory of the production stage.
+func (o templateOptions) dir() string {
+	if o.workdir == "" {
+		return config.DefaultWorkdir
+	}
+	return o.workdir
+}
+
 // getMultiStageTemplate returns a multi-stage Dockerfile template for the given language.
 // It extracts relevant information from the original Dockerfile lines.
-func getMultiStageTemplate(lang string, originalLines []string) string {
+func getMultiStageTemplate(lang string, originalLines []string, opts templateOptions) string {
 	switch lang {
 	case "node":
-		return nodeTemplate(originalLines)
+		return nodeTemplate(originalLines, opts)
 	case "go":
-		return goTemplate(originalLines)
+		return goTemplate(originalLines, opts)
 	case "python":
-		return pythonTemplate(originalLines)
+		return pythonTemplate(originalLines, opts)
 	case "rust":
-		return rustTemplate(originalLines)
+		return rustTemplate(originalLines, opts)
 	case "java":
-		return javaTemplate(originalLines)
+		return javaTemplate(originalLines, opts)
 	default:
 		return ""
 	}
 }
 
-func nodeTemplate(lines []string) string {
+func nodeTemplate(lines []string, opts templateOptions) string {
 	nodeVersion := "20"
 	for _, line := range lines {
 		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line)), "FROM") {
@@ -54,7 +77,7 @@ RUN npm run build
 
 # Stage 2: Production
 FROM node:` + nodeVersion + `-alpine AS production
-WORKDIR /app
+WORKDIR ` + opts.dir() + `
 
 # Copy built artifacts
 COPY --from=builder /app/dist ./dist
@@ -62,16 +85,14 @@ COPY --from=builder /app/node_modules ./node_modules
 COPY --from=builder /app/package.json ./
 
 # Security: run as non-root
-RUN addgroup --system --gid 1001 nodejs && \
-    adduser --system --uid 1001 --ingroup nodejs nextjs
-USER nextjs
+` + opts.userBlock() + `
 
 EXPOSE 3000
 CMD ["node", "dist/index.js"]
 `
 }
 
-func goTemplate(lines []string) string {
+func goTemplate(lines []string, opts templateOptions) string {
 	goVersion := "1.22"
 	for _, line := range lines {
 		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line)), "FROM") {
@@ -105,17 +126,17 @@ RUN CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -ldflags="-w -s" -o /app/serv
 
 # Stage 2: Production (distroless for minimal attack surface)
 FROM gcr.io/distroless/static-debian12:nonroot
-WORKDIR /app
+WORKDIR ` + opts.dir() + `
 
 COPY --from=builder /app/server .
 
 USER nonroot:nonroot
 EXPOSE 8080
-ENTRYPOINT ["/app/server"]
+ENTRYPOINT ["` + path.Join(opts.dir(), "server") + `"]
 `
 }
 
-func pythonTemplate(lines []string) string {
+func pythonTemplate(lines []string, opts templateOptions) string {
 	pythonVersion := "3.12"
 	for _, line := range lines {
 		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line)), "FROM") {
@@ -147,7 +168,7 @@ RUN pip install --no-cache-dir --prefix=/install -r requirements.txt
 
 # Stage 2: Production
 FROM python:` + pythonVersion + `-slim AS production
-WORKDIR /app
+WORKDIR ` + opts.dir() + `
 
 # Copy installed packages from builder
 COPY --from=builder /install /usr/local
@@ -156,16 +177,14 @@ COPY --from=builder /install /usr/local
 COPY . .
 
 # Security: run as non-root
-RUN addgroup --system --gid 1001 appgroup && \
-    adduser --system --uid 1001 --ingroup appgroup appuser
-USER appuser
+` + opts.userBlock() + `
 
 EXPOSE 8000
 CMD ["python", "main.py"]
 `
 }
 
-func rustTemplate(lines []string) string {
+func rustTemplate(lines []string, opts templateOptions) string {
 	return `# Stage 1: Build
 FROM rust:1.77-alpine AS builder
 WORKDIR /app
@@ -184,17 +203,17 @@ RUN cargo build --release
 
 # Stage 2: Production
 FROM gcr.io/distroless/static-debian12:nonroot
-WORKDIR /app
+WORKDIR ` + opts.dir() + `
 
 COPY --from=builder /app/target/release/app .
 
 USER nonroot:nonroot
 EXPOSE 8080
-ENTRYPOINT ["/app/app"]
+ENTRYPOINT ["` + path.Join(opts.dir(), "app") + `"]
 `
 }
 
-func javaTemplate(lines []string) string {
+func javaTemplate(lines []string, opts templateOptions) string {
 	return `# Stage 1: Build
 FROM eclipse-temurin:21-jdk-alpine AS builder
 WORKDIR /app
@@ -207,14 +226,12 @@ RUN apk add --no-cache maven && \
 
 # Stage 2: Production
 FROM eclipse-temurin:21-jre-alpine AS production
-WORKDIR /app
+WORKDIR ` + opts.dir() + `
 
 COPY --from=builder /app/target/*.jar app.jar
 
 # Security: run as non-root
-RUN addgroup --system --gid 1001 appgroup && \
-    adduser --system --uid 1001 --ingroup appgroup appuser
-USER appuser
+` + opts.userBlock() + `
 
 EXPOSE 8080
 ENTRYPOINT ["java", "-jar", "app.jar"]
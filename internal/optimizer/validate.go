@@ -0,0 +1,249 @@
+package optimizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+)
+
+// dockerfileInstructions are the instructions a Dockerfile may use.
+var dockerfileInstructions = map[string]bool{
+	"FROM": true, "RUN": true, "CMD": true, "LABEL": true, "MAINTAINER": true, "EXPOSE": true,
+	"ENV": true, "ADD": true, "COPY": true, "ENTRYPOINT": true, "VOLUME": true, "USER": true,
+	"WORKDIR": true, "ARG": true, "ONBUILD": true, "STOPSIGNAL": true, "HEALTHCHECK": true, "SHELL": true,
+}
+
+// instructionFlags are the flags BuildKit accepts on each instruction.
+// Any other flag, or one on another instruction, fails the parse.
+var instructionFlags = map[string]map[string]bool{
+	"FROM":        {"platform": true},
+	"RUN":         {"mount": true, "network": true, "security": true, "device": true},
+	"COPY":        {"from": true, "chown": true, "chmod": true, "link": true, "parents": true, "exclude": true},
+	"ADD":         {"chown": true, "chmod": true, "link": true, "keep-git-dir": true, "checksum": true, "exclude": true, "unpack": true},
+	"HEALTHCHECK": {"interval": true, "timeout": true, "start-period": true, "start-interval": true, "retries": true},
+}
+
+// stageNameRegex matches the stage names BuildKit accepts, once lowercased.
+var stageNameRegex = regexp.MustCompile(`^[a-z][a-z0-9-_.]*$`)
+
+// outputProblem is what makes a Dockerfile fail to parse or a RUN script
+// fail to run. source is the text it is found in, which tells the same
+// problem apart from one in another instruction wherever the line moves.
+type outputProblem struct {
+	line    int
+	message string
+	source  string
+}
+
+// validateOutput checks the Dockerfile a strategy rewrote before into:
+// parsed again, it must have no problem that before didn't already have.
+// A fix that breaks the build is worse than none.
+func validateOutput(before, after string, args map[string]string) error {
+	if refs := danglingStageRefs(before, after, args); len(refs) > 0 {
+		return fmt.Errorf("it references stage %s, which is no longer defined ahead of it", strings.Join(refs, ", "))
+	}
+	existing := make(map[outputProblem]int)
+	for _, p := range dockerfileProblems(before, args) {
+		p.line = 0
+		existing[p]++
+	}
+	for _, p := range dockerfileProblems(after, args) {
+		line := p.line
+		p.line = 0
+		if existing[p] > 0 {
+			existing[p]--
+			continue
+		}
+		return fmt.Errorf("line %d: %s", line, p.message)
+	}
+	return nil
+}
+
+// dockerfileProblems returns the problems of a Dockerfile, following the
+// rules of the BuildKit parser: lines that are part of no instruction,
+// like a command left behind by a broken line continuation, unknown
+// instructions, flags and stage names, malformed arguments, a continuation
+// at the end of the file, and shell-form RUN scripts that don't parse.
+func dockerfileProblems(content string, args map[string]string) []outputProblem {
+	lines := strings.Split(content, "\n")
+	pdf := analyzer.ParseDockerfile(lines, args)
+	escape := string(pdf.Escape)
+
+	var problems []outputProblem
+	covered := make([]bool, len(lines))
+	stages := make(map[string]bool)
+	from := false
+	for _, inst := range pdf.Instructions {
+		for n := inst.Line; n <= inst.EndLine && n <= len(lines); n++ {
+			covered[n-1] = true
+		}
+		problem := func(format string, a ...any) {
+			problems = append(problems, outputProblem{inst.Line, fmt.Sprintf(format, a...), inst.Raw})
+		}
+		if !dockerfileInstructions[inst.Command] {
+			problem("unknown instruction %s", inst.Command)
+			continue
+		}
+		if len(inst.Heredocs) == 0 && strings.HasSuffix(inst.Raw, escape) {
+			problem("%s ends with a line continuation and no next line", inst.Command)
+		}
+		if !from && inst.Command != "FROM" && inst.Command != "ARG" {
+			problem("%s comes before the first FROM", inst.Command)
+		}
+		flags, rest := inst.Flags, inst.Args
+		if inst.Command != "RUN" {
+			flags, rest = leadingFlags(inst.Args)
+		}
+		for _, flag := range flags {
+			name, _, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+			if !instructionFlags[inst.Command][name] {
+				problem("unknown flag --%s for %s", name, inst.Command)
+			}
+		}
+		fields := strings.Fields(rest)
+		switch inst.Command {
+		case "FROM":
+			from = true
+			if len(fields) != 1 && (len(fields) != 3 || !strings.EqualFold(fields[1], "AS")) {
+				problem("FROM takes an image and an optional AS name")
+				continue
+			}
+			if len(fields) == 3 {
+				name := strings.ToLower(fields[2])
+				if !stageNameRegex.MatchString(name) {
+					problem("invalid stage name %q", fields[2])
+				} else if stages[name] {
+					problem("duplicate stage name %q", fields[2])
+				}
+				stages[name] = true
+			}
+		case "SHELL":
+			var argv []string
+			if err := json.Unmarshal([]byte(rest), &argv); err != nil || len(argv) == 0 {
+				problem("SHELL takes a JSON array")
+			}
+		case "ENV", "LABEL":
+			if len(fields) == 1 && !strings.Contains(fields[0], "=") {
+				problem("%s %s has no value", inst.Command, fields[0])
+			}
+		}
+	}
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if covered[i] || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if dockerfileInstructions[strings.ToUpper(trimmed)] {
+			problems = append(problems, outputProblem{i + 1, fmt.Sprintf("%s has no arguments", strings.ToUpper(trimmed)), trimmed})
+			continue
+		}
+		problems = append(problems, outputProblem{i + 1, fmt.Sprintf("%q is not part of an instruction", trimmed), trimmed})
+	}
+	for _, script := range analyzer.RunScripts(pdf, lines) {
+		if msg := shellSyntaxProblem(script.Script, len(script.Instruction.Heredocs) == 0); msg != "" {
+			problems = append(problems, outputProblem{script.Instruction.Line, "the RUN script " + msg, script.Script})
+		}
+	}
+	return problems
+}
+
+// leadingFlags splits the flags, like --from=build or --link, off the
+// arguments of an instruction.
+func leadingFlags(args string) ([]string, string) {
+	rest := strings.TrimLeft(args, " \t")
+	var flags []string
+	for strings.HasPrefix(rest, "--") {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		flags = append(flags, rest[:end])
+		rest = strings.TrimLeft(rest[end:], " \t")
+	}
+	return flags, rest
+}
+
+// shellSyntaxProblem returns what makes a shell script fail to parse, or
+// "": an unterminated quote, an operator with no command before it, or a
+// script ending with &&, || or |. In the command of a RUN, continued lines
+// join into one line for the shell, and a comment on a continued line
+// swallows the commands of the next ones. It doesn't parse the shell
+// grammar, only what rewriting the end of a script can break.
+func shellSyntaxProblem(script string, continued bool) string {
+	var (
+		quote byte
+		// empty is set when no command follows the last operator, and
+		// pending when that operator needs one
+		empty   = true
+		pending string
+	)
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+			continue
+		}
+		switch {
+		case c == '\\':
+			// A line continuation is blank, an escaped character a word
+			if i+1 < len(script) && script[i+1] != '\n' {
+				empty, pending = false, ""
+			}
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+			empty, pending = false, ""
+		case c == '#' && (i == 0 || strings.IndexByte(" \t\n;&|(", script[i-1]) >= 0):
+			for i+1 < len(script) && script[i+1] != '\n' {
+				i++
+			}
+			if continued && script[i] == '\\' && strings.TrimSpace(strings.ReplaceAll(script[i+1:], "\\\n", "")) != "" {
+				return "has commands after a comment, which is part of the same line"
+			}
+		case c == '\n':
+			if pending == "" {
+				empty = true
+			}
+		case c == ' ' || c == '\t':
+		case c == '&' || c == '|' || c == ';':
+			// Redirections like 2>&1, &>file, >|file and |&
+			if c != ';' && i > 0 && strings.IndexByte("<>|", script[i-1]) >= 0 ||
+				c == '&' && i+1 < len(script) && script[i+1] == '>' {
+				continue
+			}
+			op := string(c)
+			if i+1 < len(script) && script[i+1] == c {
+				op += op
+				i++
+			}
+			if op == ";;" {
+				// The end of a case branch
+				empty, pending = true, ""
+				continue
+			}
+			if empty {
+				return fmt.Sprintf("has %s with no command before it", op)
+			}
+			empty, pending = true, ""
+			if op != ";" && op != "&" {
+				pending = op
+			}
+		default:
+			empty, pending = false, ""
+		}
+	}
+	if quote != 0 {
+		return fmt.Sprintf("has an unterminated %c quote", quote)
+	}
+	if pending != "" {
+		return fmt.Sprintf("ends with %s", pending)
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// versionConstraintRegex splits a tag pattern such as ">=18,<23-alpine" into
+// its comma-separated version constraints and the remaining tag suffix.
+var versionConstraintRegex = regexp.MustCompile(`^((?:(?:>=|<=|>|<|=|~|\^)v?\d+(?:\.\d+){0,2},?)+)(.*)$`)
+
+// constraintRegex matches a single version constraint.
+var constraintRegex = regexp.MustCompile(`^(>=|<=|>|<|=|~|\^)v?(\d+(?:\.\d+){0,2})$`)
+
+// tagVersionRegex splits an image tag into its leading version and suffix,
+// e.g. "20.11-alpine3.19" into "20.11" and "-alpine3.19".
+var tagVersionRegex = regexp.MustCompile(`^v?(\d+(?:\.\d+){0,2})(.*)$`)
+
+// imagePattern is a compiled allowed_base_images entry. The repository is a
+// glob; the tag is either a glob or version constraints followed by a glob
+// for the tag suffix.
+type imagePattern struct {
+	repo        string
+	tag         string // glob, "" = any tag
+	constraints []string
+	suffix      string // glob for the tag suffix after the version
+}
+
+// parseImagePattern parses an allowed_base_images entry such as
+// "node:>=20-alpine" or "gcr.io/distroless/*".
+func parseImagePattern(pattern string) (*imagePattern, error) {
+	repo, tag := docker.SplitImageRef(pattern)
+	p := &imagePattern{repo: docker.NormalizeRepo(repo)}
+	if _, err := path.Match(p.repo, ""); err != nil {
+		return nil, fmt.Errorf("invalid image pattern %q: %w", pattern, err)
+	}
+
+	if m := versionConstraintRegex.FindStringSubmatch(tag); m != nil {
+		for _, c := range strings.Split(strings.TrimSuffix(m[1], ","), ",") {
+			if !constraintRegex.MatchString(c) {
+				return nil, fmt.Errorf("invalid version constraint %q in %q", c, pattern)
+			}
+			p.constraints = append(p.constraints, c)
+		}
+		p.suffix = m[2]
+	} else {
+		p.tag = tag
+	}
+	if _, err := path.Match(p.tag+p.suffix, ""); err != nil {
+		return nil, fmt.Errorf("invalid image pattern %q: %w", pattern, err)
+	}
+	return p, nil
+}
+
+// matches reports whether an image reference is allowed by the pattern.
+func (p *imagePattern) matches(image string) bool {
+	repo, tag := docker.SplitImageRef(image)
+	if ok, _ := path.Match(p.repo, docker.NormalizeRepo(repo)); !ok {
+		return false
+	}
+	if tag == "" {
+		tag = "latest"
+	}
+
+	if p.constraints == nil {
+		if p.tag == "" {
+			return true
+		}
+		ok, _ := path.Match(p.tag, tag)
+		return ok
+	}
+
+	m := tagVersionRegex.FindStringSubmatch(tag)
+	if m == nil {
+		return false
+	}
+	if ok, _ := path.Match(p.suffix, m[2]); !ok {
+		return false
+	}
+	version := parseVersion(m[1])
+	for _, c := range p.constraints {
+		if !satisfies(version, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseVersion parses up to three dot-separated numbers; missing parts are 0.
+func parseVersion(s string) [3]int {
+	var v [3]int
+	for i, part := range strings.SplitN(strings.TrimPrefix(s, "v"), ".", 3) {
+		v[i], _ = strconv.Atoi(part)
+	}
+	return v
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// satisfies reports whether a version meets a constraint. "~1.2" allows
+// patch updates (>=1.2.0 <1.3.0) and "^1.2" minor updates (>=1.2.0 <2.0.0).
+func satisfies(v [3]int, constraint string) bool {
+	m := constraintRegex.FindStringSubmatch(constraint)
+	if m == nil {
+		return false
+	}
+	want := parseVersion(m[2])
+	cmp := compareVersions(v, want)
+	switch m[1] {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "=":
+		return cmp == 0
+	case "~":
+		if !strings.Contains(m[2], ".") {
+			return v[0] == want[0]
+		}
+		return cmp >= 0 && v[0] == want[0] && v[1] == want[1]
+	case "^":
+		return cmp >= 0 && v[0] == want[0]
+	}
+	return false
+}
+
+// allowedImage reports whether any pattern allows the image.
+func allowedImage(patterns []*imagePattern, image string) bool {
+	for _, p := range patterns {
+		if p.matches(image) {
+			return true
+		}
+	}
+	return false
+}
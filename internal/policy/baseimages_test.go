@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func TestImagePattern_Matches(t *testing.T) {
+	tests := []struct {
+		pattern, image string
+		want           bool
+	}{
+		{"node:>=20-alpine", "node:20-alpine", true},
+		{"node:>=20-alpine", "node:22.3.0-alpine", true},
+		{"node:>=20-alpine", "docker.io/library/node:21-alpine", true},
+		{"node:>=20-alpine", "node:18-alpine", false},
+		{"node:>=20-alpine", "node:20", false},
+		{"node:>=20-alpine", "node:20-alpine3.19", false},
+		{"node:>=20-alpine*", "node:20-alpine3.19", true},
+		{"node:>=18,<21", "node:20.11", true},
+		{"node:>=18,<21", "node:21", false},
+		{"python:~3.12-slim", "python:3.12.4-slim", true},
+		{"python:~3.12-slim", "python:3.13-slim", false},
+		{"golang:^1.21", "golang:1.22.5", true},
+		{"golang:^1.21", "golang:1.20", false},
+		{"node:>=20", "node:latest", false},
+		{"node:>=20", "node:20@sha256:abc", true},
+		{"gcr.io/distroless/*", "gcr.io/distroless/static-debian12:nonroot", true},
+		{"gcr.io/distroless/*", "gcr.io/other/static", false},
+		{"alpine:3.19", "alpine:3.19", true},
+		{"alpine:3.19", "alpine:3.20", false},
+		{"registry.corp:5000/base/*:*-hardened", "registry.corp:5000/base/java:21-hardened", true},
+	}
+	for _, tt := range tests {
+		p, err := parseImagePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("parseImagePattern(%q): %v", tt.pattern, err)
+		}
+		if got := p.matches(tt.image); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluate_AllowedBaseImages(t *testing.T) {
+	config := DefaultConfig()
+	config.AllowedBaseImages = []string{"golang:>=1.22", "gcr.io/distroless/*"}
+
+	result := NewEnforcer(config).Evaluate(&models.PipelineResult{
+		Analysis: &models.AnalysisResult{
+			Score: 100,
+			ImageReferences: []models.ImageReference{
+				{Image: "golang:1.21", Line: 1, Source: models.ImageSourceFrom},
+				{Image: "gcr.io/distroless/static", Line: 5, Source: models.ImageSourceFrom},
+				{Image: "busybox:1.36", Line: 7, Source: models.ImageSourceCopyFrom},
+			},
+		},
+	})
+	for _, rule := range result.Rules {
+		if rule.Name != "allowed_base_images" {
+			continue
+		}
+		if rule.Passed || rule.Message != "Unapproved base images: golang:1.21 (line 1)" {
+			t.Errorf("unexpected result: passed=%v, %q", rule.Passed, rule.Message)
+		}
+		return
+	}
+	t.Error("expected allowed_base_images to be evaluated")
+}
@@ -0,0 +1,103 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// copyleftLicenses are the license globs "copyleft" expands to in
+// denied_licenses.
+var copyleftLicenses = []string{"GPL*", "AGPL*", "LGPL*", "SSPL*", "EUPL*", "OSL*", "CC-BY-SA*"}
+
+// maxListedPackages caps how many offending packages a rule message names.
+const maxListedPackages = 5
+
+// licensePatterns expands the "copyleft" keyword and upper-cases the globs
+// for case-insensitive matching.
+func licensePatterns(list []string) []string {
+	var patterns []string
+	for _, l := range list {
+		if strings.EqualFold(l, "copyleft") {
+			patterns = append(patterns, copyleftLicenses...)
+			continue
+		}
+		patterns = append(patterns, strings.ToUpper(l))
+	}
+	return patterns
+}
+
+// matchesLicense reports whether a single license ID matches any glob.
+func matchesLicense(patterns []string, license string) bool {
+	license = strings.ToUpper(strings.TrimSpace(license))
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, license); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// licenseAcceptable evaluates an SPDX expression: with OR, one acceptable
+// alternative is enough; with AND, every part must be acceptable.
+func licenseAcceptable(expression string, acceptable func(string) bool) bool {
+	expression = strings.NewReplacer("(", " ", ")", " ").Replace(expression)
+	for _, alternative := range splitExpression(expression, " OR ") {
+		ok := true
+		for _, part := range splitExpression(alternative, " AND ") {
+			if !acceptable(strings.TrimSpace(part)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitExpression splits an SPDX expression on an operator, ignoring case.
+func splitExpression(expression, op string) []string {
+	var parts []string
+	upper := strings.ToUpper(expression)
+	for {
+		idx := strings.Index(upper, op)
+		if idx == -1 {
+			return append(parts, expression)
+		}
+		parts = append(parts, expression[:idx])
+		expression, upper = expression[idx+len(op):], upper[idx+len(op):]
+	}
+}
+
+// licenseViolations returns the packages whose licenses aren't acceptable.
+// Packages without any license are reported when unknownFails is set.
+func licenseViolations(packages []models.Package, acceptable func(string) bool, unknownFails bool) []string {
+	var violations []string
+	for _, pkg := range packages {
+		if len(pkg.Licenses) == 0 {
+			if unknownFails {
+				violations = append(violations, pkg.Name+" (unknown)")
+			}
+			continue
+		}
+		for _, license := range pkg.Licenses {
+			if !licenseAcceptable(license, acceptable) {
+				violations = append(violations, fmt.Sprintf("%s (%s)", pkg.Name, license))
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// formatViolations lists the first offending packages and counts the rest.
+func formatViolations(violations []string) string {
+	if len(violations) <= maxListedPackages {
+		return strings.Join(violations, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(violations[:maxListedPackages], ", "), len(violations)-maxListedPackages)
+}
@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func licenseRules(config *Config, packages ...models.Package) map[string]models.PolicyRule {
+	rules := make(map[string]models.PolicyRule)
+	result := NewEnforcer(config).Evaluate(&models.PipelineResult{SBOM: &models.SBOM{Packages: packages}})
+	for _, rule := range result.Rules {
+		rules[rule.Name] = rule
+	}
+	return rules
+}
+
+func TestEvaluate_DeniedLicenses(t *testing.T) {
+	config := DefaultConfig()
+	config.DeniedLicenses = []string{"copyleft"}
+
+	rules := licenseRules(config,
+		models.Package{Name: "musl", Licenses: []string{"MIT"}},
+		models.Package{Name: "bash", Licenses: []string{"GPL-3.0-or-later"}},
+		models.Package{Name: "dual", Licenses: []string{"(GPL-2.0-only OR MIT)"}},
+		models.Package{Name: "unknown"},
+	)
+	rule := rules["denied_licenses"]
+	if rule.Passed || rule.Message != "1 package(s) with denied licenses: bash (GPL-3.0-or-later)" {
+		t.Errorf("unexpected denied_licenses result: passed=%v, %q", rule.Passed, rule.Message)
+	}
+}
+
+func TestEvaluate_AllowedLicenses(t *testing.T) {
+	config := DefaultConfig()
+	config.AllowedLicenses = []string{"MIT", "Apache-2.0", "BSD-*"}
+
+	rules := licenseRules(config,
+		models.Package{Name: "a", Licenses: []string{"mit"}},
+		models.Package{Name: "b", Licenses: []string{"BSD-3-Clause AND Apache-2.0"}},
+		models.Package{Name: "c", Licenses: []string{"MIT AND LGPL-2.1"}},
+		models.Package{Name: "d"},
+	)
+	rule := rules["allowed_licenses"]
+	if rule.Passed || rule.Message != "2 package(s) with unapproved or unknown licenses: c (MIT AND LGPL-2.1), d (unknown)" {
+		t.Errorf("unexpected allowed_licenses result: passed=%v, %q", rule.Passed, rule.Message)
+	}
+	if _, ok := rules["denied_licenses"]; ok {
+		t.Error("denied_licenses must not be evaluated when unset")
+	}
+}
+
+func TestEvaluate_LicensesWithoutSBOM(t *testing.T) {
+	config := DefaultConfig()
+	config.DeniedLicenses = []string{"AGPL*"}
+	config.AllowedLicenses = []string{"MIT"}
+
+	result := NewEnforcer(config).Evaluate(&models.PipelineResult{})
+	var names []string
+	for _, rule := range result.Rules {
+		if !rule.NotEvaluated {
+			continue
+		}
+		names = append(names, rule.Name)
+		if rule.Passed || rule.Enforcement != models.EnforcementWarn || rule.Message != "not evaluated: no SBOM of the image (needs a built image and trivy or syft)" {
+			t.Errorf("unexpected %s result: passed=%v, %s, %q", rule.Name, rule.Passed, rule.Enforcement, rule.Message)
+		}
+	}
+	if len(names) != 2 || names[0] != "denied_licenses" || names[1] != "allowed_licenses" {
+		t.Errorf("expected both license rules to be reported as not evaluated, got %v", names)
+	}
+	if result.Warnings < 2 {
+		t.Errorf("expected the rules to warn, got %d warnings", result.Warnings)
+	}
+	if !result.Passed {
+		t.Error("rules that weren't evaluated must not fail the policy")
+	}
+}
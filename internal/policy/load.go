@@ -0,0 +1,358 @@
+package policy
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/maxlar/docker-image-optimizer/internal/schema"
+)
+
+// maxExtendsDepth bounds extends chains so mistakes fail fast.
+const maxExtendsDepth = 10
+
+// policyFile holds the structural keys of a policy file. Rule settings are
+// decoded straight into Config.
+type policyFile struct {
+	Extends  string               `yaml:"extends"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// File is the complete layout of a policy file, for validation and the
+// published JSON Schema: the rule settings of Config, the file it extends
+// and profiles overriding the settings.
+type File struct {
+	Config   `yaml:",inline"`
+	Extends  string            `yaml:"extends"`
+	Profiles map[string]Config `yaml:"profiles"`
+}
+
+// layer is one file of an extends chain.
+type layer struct {
+	path string
+	doc  *yaml.Node
+	file policyFile
+}
+
+// renamedKeys maps policy keys, and the rule names enforcement lists,
+// that were renamed to their current name. Files using an old name keep
+// working with a deprecation notice.
+var renamedKeys = map[string]string{}
+
+// settingKeys are the keys of Config that configure the policy instead of
+// naming a rule, and so can't be listed in enforcement.
+var settingKeys = map[string]bool{"analysis": true, "default_enforcement": true, "enforcement": true, "override": true}
+
+// dockerfileRules are the rules a Dockerfile sets up for its own image,
+// in a dio:budget comment, rather than a key of Config.
+var dockerfileRules = []string{"budget_layers", "budget_size"}
+
+// FileError lists the unknown keys and mistyped values of a policy file,
+// with their positions. Unknown keys are errors rather than ignored: a
+// typo would leave the gate it was meant to set at its default.
+type FileError struct {
+	Path     string
+	Problems []schema.Error
+}
+
+func (e *FileError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Error()
+	}
+	return fmt.Sprintf("invalid policy file %s: %s", e.Path, strings.Join(msgs, "; "))
+}
+
+// PolicyError is a policy that could not be loaded, or that rejected a
+// break-glass override. The pipeline stops there: without the policy, its
+// gates can't be evaluated.
+type PolicyError struct {
+	Path    string
+	Profile string
+	Err     error
+}
+
+func (e *PolicyError) Error() string { return e.Err.Error() }
+
+func (e *PolicyError) Unwrap() error { return e.Err }
+
+// LoadConfigProfile reads a policy file, applying the files it extends and,
+// if profile is not empty, the named profile.
+//
+// Files are applied base first, so a file overrides what it extends. Profiles
+// are applied after all top-level settings, again base first, so a profile
+// can only be overridden by the same profile in a more specific file.
+func LoadConfigProfile(path, profile string) (*Config, error) {
+	return LoadConfigWithOptions(path, profile, RemoteOptions{})
+}
+
+// LoadConfigWithOptions is LoadConfigProfile with control over how remote
+// policies (https:// URLs and oci:// artifacts) are fetched. Errors are
+// *PolicyError.
+func LoadConfigWithOptions(path, profile string, opts RemoteOptions) (*Config, error) {
+	config, err := loadConfig(path, profile, opts)
+	if err != nil {
+		return nil, &PolicyError{Path: path, Profile: profile, Err: err}
+	}
+	return config, nil
+}
+
+func loadConfig(path, profile string, opts RemoteOptions) (*Config, error) {
+	chain, err := loadChain(path, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	config := DefaultConfig()
+	for _, l := range chain {
+		if err := decode(l.doc, config); err != nil {
+			return nil, fmt.Errorf("failed to parse policy file %s: %w", l.path, err)
+		}
+	}
+
+	if profile != "" {
+		found := false
+		for _, l := range chain {
+			node, ok := l.file.Profiles[profile]
+			if !ok {
+				continue
+			}
+			found = true
+			if err := node.Decode(config); err != nil {
+				return nil, fmt.Errorf("failed to parse profile %q in %s: %w", profile, l.path, err)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown policy profile %q (available: %s)", profile, strings.Join(profileNames(chain), ", "))
+		}
+		config.Profile = profile
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy file: %w", err)
+	}
+	return config, nil
+}
+
+// loadChain reads ref and the files it extends, returning them base first.
+// Relative extends paths are resolved against the extending file or URL.
+func loadChain(ref string, opts RemoteOptions, seen []string) ([]layer, error) {
+	key := ref
+	if !IsRemote(ref) {
+		abs, err := filepath.Abs(ref)
+		if err != nil {
+			return nil, err
+		}
+		key = abs
+	}
+	for _, s := range seen {
+		if s == key {
+			return nil, fmt.Errorf("policy extends cycle: %s", strings.Join(append(seen, key), " -> "))
+		}
+	}
+	if len(seen) >= maxExtendsDepth {
+		return nil, fmt.Errorf("policy extends chain deeper than %d files", maxExtendsDepth)
+	}
+
+	var data []byte
+	var err error
+	if IsRemote(ref) {
+		data, err = opts.fetch(ref)
+	} else {
+		data, err = os.ReadFile(ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %s: %w", ref, err)
+	}
+	renameKeys(&doc, ref, opts.Warn)
+	if problems := checkKeys(&doc); len(problems) > 0 {
+		return nil, &FileError{Path: ref, Problems: problems}
+	}
+	var file policyFile
+	if err := decode(&doc, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %s: %w", ref, err)
+	}
+
+	current := layer{path: ref, doc: &doc, file: file}
+	if file.Extends == "" {
+		return []layer{current}, nil
+	}
+
+	base, err := resolveExtends(ref, file.Extends)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := loadChain(base, opts, append(seen, key))
+	if err != nil {
+		return nil, err
+	}
+	return append(chain, current), nil
+}
+
+// resolveExtends resolves an extends value relative to the file declaring it.
+func resolveExtends(from, extends string) (string, error) {
+	if IsRemote(extends) || filepath.IsAbs(extends) {
+		return extends, nil
+	}
+	if strings.HasPrefix(from, "oci://") {
+		return "", fmt.Errorf("%s: relative extends %q is not supported for OCI policies", from, extends)
+	}
+	if IsRemote(from) {
+		base, err := url.Parse(from)
+		if err != nil {
+			return "", err
+		}
+		rel, err := url.Parse(extends)
+		if err != nil {
+			return "", err
+		}
+		return base.ResolveReference(rel).String(), nil
+	}
+	return filepath.Join(filepath.Dir(from), extends), nil
+}
+
+// profileNames lists the profiles defined anywhere in the chain.
+func profileNames(chain []layer) []string {
+	set := make(map[string]bool)
+	for _, l := range chain {
+		for name := range l.file.Profiles {
+			set[name] = true
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return []string{"none"}
+	}
+	return names
+}
+
+// decode decodes a policy document into v, leaving v alone for an empty
+// file.
+func decode(doc *yaml.Node, v interface{}) error {
+	if doc.Kind == 0 {
+		return nil
+	}
+	return doc.Decode(v)
+}
+
+// settingMap is a mapping of a policy document that holds settings, and
+// its path in the document.
+type settingMap struct {
+	path string
+	node *yaml.Node
+}
+
+// settingMaps returns the top level of a policy document and its
+// profiles.
+func settingMaps(doc *yaml.Node) []settingMap {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	maps := []settingMap{{node: doc.Content[0]}}
+	if profiles := mapValue(doc.Content[0], "profiles"); profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(profiles.Content); i += 2 {
+			if profile := profiles.Content[i+1]; profile.Kind == yaml.MappingNode {
+				maps = append(maps, settingMap{path: "profiles." + profiles.Content[i].Value + ".", node: profile})
+			}
+		}
+	}
+	return maps
+}
+
+// mapValue returns the value of key in a mapping node, or nil.
+func mapValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// renameKeys replaces the renamed keys of a policy document, and renamed
+// rules in its enforcement lists, with their current names, sending a
+// deprecation notice to warn for each.
+func renameKeys(doc *yaml.Node, path string, warn func(string)) {
+	rename := func(key *yaml.Node) {
+		current, ok := renamedKeys[key.Value]
+		if !ok {
+			return
+		}
+		if warn != nil {
+			warn(fmt.Sprintf("%s:%d: %s is deprecated, use %s", path, key.Line, key.Value, current))
+		}
+		key.Value = current
+	}
+	for _, m := range settingMaps(doc) {
+		for i := 0; i < len(m.node.Content); i += 2 {
+			rename(m.node.Content[i])
+		}
+		if enforcement := mapValue(m.node, "enforcement"); enforcement != nil && enforcement.Kind == yaml.MappingNode {
+			for i := 0; i < len(enforcement.Content); i += 2 {
+				rename(enforcement.Content[i])
+			}
+		}
+	}
+}
+
+// checkKeys returns the unknown keys and mistyped values of a policy
+// document, and the rules in its enforcement lists that don't exist.
+func checkKeys(doc *yaml.Node) []schema.Error {
+	problems := schema.ValidateNode(doc, reflect.TypeOf(File{}))
+	rules := ruleNames()
+	known := make(map[string]bool)
+	for _, rule := range rules {
+		known[rule] = true
+	}
+	for _, m := range settingMaps(doc) {
+		enforcement := mapValue(m.node, "enforcement")
+		if enforcement == nil || enforcement.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i < len(enforcement.Content); i += 2 {
+			key := enforcement.Content[i]
+			if known[key.Value] {
+				continue
+			}
+			message := "unknown rule"
+			if s := schema.Suggest(key.Value, rules); s != "" {
+				message += " (did you mean " + s + "?)"
+			}
+			problems = append(problems, schema.Error{Line: key.Line, Column: key.Column, Path: m.path + "enforcement." + key.Value, Message: message})
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Column < problems[j].Column
+	})
+	return problems
+}
+
+// ruleNames returns the names of the policy rules, sorted: the keys of
+// Config that set one, and the rules of Dockerfile budgets.
+func ruleNames() []string {
+	names := append([]string(nil), dockerfileRules...)
+	for key := range schema.Fields(reflect.TypeOf(Config{})) {
+		if !settingKeys[key] {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
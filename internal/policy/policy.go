@@ -3,56 +3,223 @@
 package policy
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
 	"github.com/maxlar/docker-image-optimizer/internal/models"
 	"github.com/maxlar/docker-image-optimizer/pkg/docker"
-	"gopkg.in/yaml.v3"
 )
 
 // Config represents the policy configuration file.
 type Config struct {
-	MaxImageSize    string `yaml:"max_image_size"`
-	ForbidLatestTag bool   `yaml:"forbid_latest_tag"`
-	RequireNonRoot  bool   `yaml:"require_non_root"`
-	MaxCriticalCVEs int    `yaml:"max_critical_cves"`
-	MaxHighCVEs     int    `yaml:"max_high_cves"`
-	RequireHealthcheck bool `yaml:"require_healthcheck"`
-	ForbidRootUser  bool   `yaml:"forbid_root_user"`
-	MaxLayers       int    `yaml:"max_layers"`
-	MinScore        int    `yaml:"min_score"` // minimum analyzer score
+	MaxImageSize       string `yaml:"max_image_size"`
+	ForbidLatestTag    bool   `yaml:"forbid_latest_tag"`
+	RequireNonRoot     bool   `yaml:"require_non_root"`
+	MaxCriticalCVEs    int    `yaml:"max_critical_cves"`
+	MaxHighCVEs        int    `yaml:"max_high_cves"`
+	RequireHealthcheck bool   `yaml:"require_healthcheck"`
+	ForbidRootUser     bool   `yaml:"forbid_root_user"`
+	ForbidDebugTools   bool   `yaml:"forbid_debug_tools"` // DIO019
+	MaxLayers          int    `yaml:"max_layers"`
+	MinScore           int    `yaml:"min_score"` // minimum analyzer score
+
+	// RequireReproducible rebuilds the final image twice without the build
+	// cache in dio run, and fails when the builds aren't byte-identical.
+	RequireReproducible bool `yaml:"require_reproducible"`
+
+	// RequireProvenance fails images dio run built without a SLSA
+	// provenance attestation, and RequireSBOMAttestation those without an
+	// SBOM attestation. Either has dio run generate the attestation.
+	RequireProvenance      bool `yaml:"require_provenance"`
+	RequireSBOMAttestation bool `yaml:"require_sbom_attestation"`
+
+	// RequireGoldenImages fails final images not built on a golden image of
+	// the golden_images catalog in .dio.yaml (DIO035).
+	RequireGoldenImages bool `yaml:"require_golden_images"`
+
+	// Threshold is the lowest CVE severity the policy limits. Critical and
+	// high CVEs are limited by max_critical_cves and max_high_cves; CVEs
+	// below high and at or above the threshold fail the policy outright.
+	// Empty means high.
+	Threshold string `yaml:"threshold"`
+
+	// Analysis selects the Dockerfile analysis that the Dockerfile rules
+	// check in autofix mode: "optimized" (default), the autofixed
+	// Dockerfile that is built and shipped, or "original".
+	Analysis string `yaml:"analysis"`
+
+	// MaxCompressedSize limits the registry size of the image layers.
+	MaxCompressedSize string `yaml:"max_compressed_size"`
+	// MaxSizeGrowth limits growth over the previous recorded run, either as
+	// a percentage ("10%") or an absolute size ("50MB").
+	MaxSizeGrowth string `yaml:"max_size_growth"`
+	// StageSizeBudgets limits the size of named build stages.
+	StageSizeBudgets map[string]string `yaml:"stage_size_budgets"`
+	// DeniedLicenses fails packages whose license matches one of these globs
+	// ("GPL-3.0*"); "copyleft" expands to the common copyleft families.
+	DeniedLicenses []string `yaml:"denied_licenses"`
+	// AllowedLicenses, when set, fails packages with any other license,
+	// including packages whose license is unknown.
+	AllowedLicenses []string `yaml:"allowed_licenses"`
+
+	// AllowedBaseImages lists the approved FROM images, e.g. "node:>=20-alpine"
+	// or "gcr.io/distroless/*". Empty allows any base image.
+	AllowedBaseImages []string `yaml:"allowed_base_images"`
+
+	// DefaultEnforcement applies to rules not listed in Enforcement:
+	// "deny" (default) fails the policy, "warn" only reports.
+	DefaultEnforcement string            `yaml:"default_enforcement"`
+	Enforcement        map[string]string `yaml:"enforcement"`
+	Override           OverrideConfig    `yaml:"override"`
+
+	// Profile is the profile selected when loading, if any.
+	Profile string `yaml:"-"`
+}
+
+// OverrideConfig controls break-glass overrides of failed policies.
+type OverrideConfig struct {
+	Allowed bool `yaml:"allowed"`
+	// TokenSHA256 is the hex SHA-256 of a shared break-glass token. When
+	// set, an override also requires DIO_OVERRIDE_TOKEN to match it.
+	TokenSHA256 string `yaml:"token_sha256"`
 }
 
+// OverrideTokenEnv is the environment variable holding the break-glass token.
+const OverrideTokenEnv = "DIO_OVERRIDE_TOKEN"
+
 // DefaultConfig returns the default policy configuration.
 func DefaultConfig() *Config {
 	return &Config{
-		MaxImageSize:    "500MB",
-		ForbidLatestTag: true,
-		RequireNonRoot:  true,
-		MaxCriticalCVEs: 0,
-		MaxHighCVEs:     5,
+		MaxImageSize:       "500MB",
+		ForbidLatestTag:    true,
+		RequireNonRoot:     true,
+		MaxCriticalCVEs:    0,
+		MaxHighCVEs:        5,
 		RequireHealthcheck: false,
-		ForbidRootUser:  true,
-		MaxLayers:       20,
-		MinScore:        50,
+		ForbidRootUser:     true,
+		MaxLayers:          20,
+		MinScore:           50,
+		DefaultEnforcement: models.EnforcementDeny,
+		Override:           OverrideConfig{Allowed: true},
 	}
 }
 
 // LoadConfig reads a policy configuration from a YAML file.
 func LoadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	return LoadConfigProfile(path, "")
+}
+
+// validate checks the enforcement levels and size limits in the configuration.
+func (c *Config) validate() error {
+	if c.Threshold != "" {
+		if _, err := models.ParseSeverity(c.Threshold); err != nil {
+			return fmt.Errorf("threshold: %w", err)
+		}
+	}
+	if c.MaxCompressedSize != "" {
+		if _, err := docker.ParseImageSize(c.MaxCompressedSize); err != nil {
+			return fmt.Errorf("max_compressed_size: %w", err)
+		}
+	}
+	if c.MaxSizeGrowth != "" {
+		if _, _, err := parseSizeGrowth(c.MaxSizeGrowth); err != nil {
+			return fmt.Errorf("max_size_growth: %w", err)
+		}
+	}
+	for _, license := range append(licensePatterns(c.DeniedLicenses), licensePatterns(c.AllowedLicenses)...) {
+		if _, err := path.Match(license, ""); err != nil {
+			return fmt.Errorf("invalid license pattern %q: %w", license, err)
+		}
+	}
+	for _, pattern := range c.AllowedBaseImages {
+		if _, err := parseImagePattern(pattern); err != nil {
+			return fmt.Errorf("allowed_base_images: %w", err)
+		}
+	}
+	for stage, budget := range c.StageSizeBudgets {
+		if _, err := docker.ParseImageSize(budget); err != nil {
+			return fmt.Errorf("stage_size_budgets for %s: %w", stage, err)
+		}
+	}
+	if c.Analysis != "" && c.Analysis != models.AnalysisOptimized && c.Analysis != models.AnalysisOriginal {
+		return fmt.Errorf("analysis must be %q or %q, got %q", models.AnalysisOptimized, models.AnalysisOriginal, c.Analysis)
+	}
+	if !validEnforcement(c.DefaultEnforcement) {
+		return fmt.Errorf("default_enforcement must be %q or %q, got %q", models.EnforcementDeny, models.EnforcementWarn, c.DefaultEnforcement)
+	}
+	for name, level := range c.Enforcement {
+		if !validEnforcement(level) {
+			return fmt.Errorf("enforcement for %s must be %q or %q, got %q", name, models.EnforcementDeny, models.EnforcementWarn, level)
+		}
+	}
+	return nil
+}
+
+func validEnforcement(level string) bool {
+	return level == models.EnforcementDeny || level == models.EnforcementWarn
+}
+
+// parseSizeGrowth parses max_size_growth into a limit that is either a
+// percentage of the previous size or an absolute size in bytes.
+func parseSizeGrowth(s string) (limit float64, percent bool, err error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "%") {
+		limit, err = strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid percentage: %s", s)
+		}
+		return limit, true, nil
+	}
+	size, err := docker.ParseImageSize(s)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read policy file: %w", err)
+		return 0, false, err
 	}
+	return float64(size), false, nil
+}
 
-	config := DefaultConfig()
-	if err := yaml.Unmarshal(data, config); err != nil {
-		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+// LicenseRules reports whether the policy checks package licenses, which
+// needs an SBOM of the image.
+func (c *Config) LicenseRules() bool {
+	return len(c.DeniedLicenses) > 0 || len(c.AllowedLicenses) > 0
+}
+
+// StageBudgets returns the stages with a size budget, sorted by name.
+func (c *Config) StageBudgets() []string {
+	stages := make([]string, 0, len(c.StageSizeBudgets))
+	for stage := range c.StageSizeBudgets {
+		stages = append(stages, stage)
 	}
+	sort.Strings(stages)
+	return stages
+}
 
-	return config, nil
+// threshold returns the lowest CVE severity the policy limits.
+func (c *Config) threshold() models.Severity {
+	if c.Threshold == "" {
+		return models.SeverityHigh
+	}
+	threshold, _ := models.ParseSeverity(c.Threshold)
+	return threshold
+}
+
+// enforcement returns the enforcement level of a rule.
+func (c *Config) enforcement(rule string) string {
+	if level, ok := c.Enforcement[rule]; ok {
+		return level
+	}
+	if c.DefaultEnforcement == "" {
+		return models.EnforcementDeny
+	}
+	return c.DefaultEnforcement
 }
 
 // Enforcer evaluates policy rules against pipeline results.
@@ -67,13 +234,22 @@ func NewEnforcer(config *Config) *Enforcer {
 
 // Evaluate checks all policy rules and returns the result.
 func (e *Enforcer) Evaluate(result *models.PipelineResult) *models.PolicyResult {
-	policyResult := &models.PolicyResult{Passed: true}
+	policyResult := &models.PolicyResult{Passed: true, Profile: e.config.Profile}
+	analysis := e.analysis(result)
+	switch {
+	case analysis == nil:
+	case analysis == result.OptimizedAnalysis:
+		policyResult.Analysis = models.AnalysisOptimized
+	default:
+		policyResult.Analysis = models.AnalysisOriginal
+	}
 
-	// Check image size
-	if result.OptimizedImage != nil && e.config.MaxImageSize != "" {
+	// Check image size, falling back to the baseline when nothing was optimized
+	img := result.FinalImage()
+	if img != nil && e.config.MaxImageSize != "" {
 		maxSize, err := docker.ParseImageSize(e.config.MaxImageSize)
 		if err == nil {
-			passed := result.OptimizedImage.Size <= maxSize
+			passed := img.Size <= maxSize
 			rule := models.PolicyRule{
 				Name:        "max_image_size",
 				Description: fmt.Sprintf("Image size must be <= %s", e.config.MaxImageSize),
@@ -82,34 +258,86 @@ func (e *Enforcer) Evaluate(result *models.PipelineResult) *models.PolicyResult
 			}
 			if !passed {
 				rule.Message = fmt.Sprintf("Image size %s exceeds maximum %s",
-					result.OptimizedImage.SizeHuman, e.config.MaxImageSize)
-				policyResult.Passed = false
+					img.SizeHuman, e.config.MaxImageSize)
 			}
-			policyResult.Rules = append(policyResult.Rules, rule)
+			e.record(policyResult, rule)
 		}
-	} else if result.BaselineImage != nil && e.config.MaxImageSize != "" {
-		maxSize, err := docker.ParseImageSize(e.config.MaxImageSize)
+	}
+
+	// Check compressed (registry) size, which can't always be measured
+	if img != nil && e.config.MaxCompressedSize != "" {
+		maxSize, err := docker.ParseImageSize(e.config.MaxCompressedSize)
+		rule := models.PolicyRule{
+			Name:        "max_compressed_size",
+			Description: fmt.Sprintf("Compressed image size must be <= %s", e.config.MaxCompressedSize),
+			Value:       e.config.MaxCompressedSize,
+		}
+		switch {
+		case err != nil:
+		case img.CompressedSize == 0:
+			e.recordNotEvaluated(policyResult, rule, "the compressed size of the image couldn't be measured")
+		default:
+			rule.Passed = img.CompressedSize <= maxSize
+			if !rule.Passed {
+				rule.Message = fmt.Sprintf("Compressed size %s exceeds maximum %s",
+					docker.HumanSize(img.CompressedSize), e.config.MaxCompressedSize)
+			}
+			e.record(policyResult, rule)
+		}
+	}
+
+	// Check size growth since the previous run
+	if prev := result.PreviousImage; img != nil && prev != nil && prev.Size > 0 && e.config.MaxSizeGrowth != "" {
+		limit, percent, err := parseSizeGrowth(e.config.MaxSizeGrowth)
 		if err == nil {
-			passed := result.BaselineImage.Size <= maxSize
+			growth := img.Size - prev.Size
+			growthPct := float64(growth) / float64(prev.Size) * 100
+			passed := float64(growth) <= limit
+			if percent {
+				passed = growthPct <= limit
+			}
 			rule := models.PolicyRule{
-				Name:        "max_image_size",
-				Description: fmt.Sprintf("Image size must be <= %s", e.config.MaxImageSize),
-				Value:       e.config.MaxImageSize,
+				Name:        "max_size_growth",
+				Description: fmt.Sprintf("Image size must not grow more than %s since the previous run", e.config.MaxSizeGrowth),
+				Value:       e.config.MaxSizeGrowth,
 				Passed:      passed,
 			}
 			if !passed {
-				rule.Message = fmt.Sprintf("Image size %s exceeds maximum %s",
-					result.BaselineImage.SizeHuman, e.config.MaxImageSize)
-				policyResult.Passed = false
+				rule.Message = fmt.Sprintf("Image grew %s (+%.1f%%) from %s",
+					docker.HumanSize(growth), growthPct, prev.SizeHuman)
 			}
-			policyResult.Rules = append(policyResult.Rules, rule)
+			e.record(policyResult, rule)
 		}
 	}
 
+	// Check per-stage size budgets
+	for _, stage := range e.config.StageBudgets() {
+		stageImg := result.StageImages[stage]
+		if stageImg == nil {
+			continue
+		}
+		budget := e.config.StageSizeBudgets[stage]
+		maxSize, err := docker.ParseImageSize(budget)
+		if err != nil {
+			continue
+		}
+		passed := stageImg.Size <= maxSize
+		rule := models.PolicyRule{
+			Name:        "stage_size_budgets",
+			Description: fmt.Sprintf("Stage %s must be <= %s", stage, budget),
+			Value:       budget,
+			Passed:      passed,
+		}
+		if !passed {
+			rule.Message = fmt.Sprintf("Stage size %s exceeds budget %s", stageImg.SizeHuman, budget)
+		}
+		e.record(policyResult, rule)
+	}
+
 	// Check latest tag
-	if e.config.ForbidLatestTag && result.Analysis != nil {
+	if e.config.ForbidLatestTag && analysis != nil {
 		passed := true
-		for _, issue := range result.Analysis.Issues {
+		for _, issue := range analysis.Issues {
 			if issue.ID == "DIO001" {
 				passed = false
 				break
@@ -123,15 +351,52 @@ func (e *Enforcer) Evaluate(result *models.PipelineResult) *models.PolicyResult
 		}
 		if !passed {
 			rule.Message = "Unpinned base image tags detected"
-			policyResult.Passed = false
 		}
-		policyResult.Rules = append(policyResult.Rules, rule)
+		e.record(policyResult, rule)
+	} else if e.config.ForbidLatestTag && result.Image != "" {
+		passed := !analyzer.IsUnpinnedTag(result.Image)
+		rule := models.PolicyRule{
+			Name:        "forbid_latest_tag",
+			Description: "Images must use pinned version tags",
+			Value:       true,
+			Passed:      passed,
+		}
+		if !passed {
+			rule.Message = fmt.Sprintf("Image %s is untagged or uses :latest", result.Image)
+		}
+		e.record(policyResult, rule)
+	}
+
+	// Check base images against the approved list
+	if len(e.config.AllowedBaseImages) > 0 && analysis != nil {
+		var patterns []*imagePattern
+		for _, pattern := range e.config.AllowedBaseImages {
+			if p, err := parseImagePattern(pattern); err == nil {
+				patterns = append(patterns, p)
+			}
+		}
+		var disallowed []string
+		for _, ref := range analysis.ImageReferences {
+			if ref.Source == models.ImageSourceFrom && !allowedImage(patterns, ref.Image) {
+				disallowed = append(disallowed, fmt.Sprintf("%s (line %d)", ref.Image, ref.Line))
+			}
+		}
+		rule := models.PolicyRule{
+			Name:        "allowed_base_images",
+			Description: "Base images must match the approved list",
+			Value:       e.config.AllowedBaseImages,
+			Passed:      len(disallowed) == 0,
+		}
+		if len(disallowed) > 0 {
+			rule.Message = fmt.Sprintf("Unapproved base images: %s", strings.Join(disallowed, ", "))
+		}
+		e.record(policyResult, rule)
 	}
 
 	// Check non-root user
-	if e.config.RequireNonRoot && result.Analysis != nil {
+	if e.config.RequireNonRoot && analysis != nil {
 		passed := true
-		for _, issue := range result.Analysis.Issues {
+		for _, issue := range analysis.Issues {
 			if issue.ID == "DIO006" {
 				passed = false
 				break
@@ -145,16 +410,168 @@ func (e *Enforcer) Evaluate(result *models.PipelineResult) *models.PolicyResult
 		}
 		if !passed {
 			rule.Message = "Container runs as root"
-			policyResult.Passed = false
 		}
-		policyResult.Rules = append(policyResult.Rules, rule)
+		e.record(policyResult, rule)
+	} else if img := result.BaselineImage; e.config.RequireNonRoot && result.Image != "" && img != nil {
+		// Without a Dockerfile, fall back to the USER in the image config
+		passed := img.User != "" && !analyzer.IsRootUser(img.User)
+		rule := models.PolicyRule{
+			Name:        "require_non_root",
+			Description: "Container must run as non-root user",
+			Value:       true,
+			Passed:      passed,
+		}
+		if !passed {
+			rule.Message = "Image config runs as root"
+		}
+		e.record(policyResult, rule)
 	}
 
-	// Check critical CVEs
-	scanResult := result.OptScanResult
-	if scanResult == nil {
-		scanResult = result.ScanResult
+	// Check for an explicit USER root. Unlike require_non_root, an image
+	// that keeps its base image's default user passes.
+	if e.config.ForbidRootUser {
+		user, evaluated := "", false
+		if analysis != nil {
+			user, evaluated = analysis.User, true
+		} else if img := result.BaselineImage; result.Image != "" && img != nil {
+			user, evaluated = img.User, true
+		}
+		if evaluated {
+			passed := user == "" || !analyzer.IsRootUser(user)
+			rule := models.PolicyRule{
+				Name:        "forbid_root_user",
+				Description: "USER must not be set to root",
+				Value:       true,
+				Passed:      passed,
+			}
+			if !passed {
+				rule.Message = fmt.Sprintf("Final USER is %s", user)
+			}
+			e.record(policyResult, rule)
+		}
+	}
+
+	// Check healthcheck
+	if e.config.RequireHealthcheck && analysis != nil {
+		passed := true
+		for _, issue := range analysis.Issues {
+			if issue.ID == "DIO012" {
+				passed = false
+				break
+			}
+		}
+		rule := models.PolicyRule{
+			Name:        "require_healthcheck",
+			Description: "Image must define a HEALTHCHECK",
+			Value:       true,
+			Passed:      passed,
+		}
+		if !passed {
+			rule.Message = "No HEALTHCHECK in the final stage"
+		}
+		e.recordIssueRule(policyResult, rule, analysis, "DIO012")
+	} else if img := result.BaselineImage; e.config.RequireHealthcheck && result.Image != "" && img != nil {
+		rule := models.PolicyRule{
+			Name:        "require_healthcheck",
+			Description: "Image must define a HEALTHCHECK",
+			Value:       true,
+			Passed:      img.Healthcheck,
+		}
+		if !img.Healthcheck {
+			rule.Message = "Image config has no HEALTHCHECK"
+		}
+		e.record(policyResult, rule)
+	}
+
+	// Check for debugging tools left in the final stage
+	if e.config.ForbidDebugTools && analysis != nil {
+		var lines []string
+		for _, issue := range analysis.Issues {
+			if issue.ID == "DIO019" {
+				lines = append(lines, strconv.Itoa(issue.Line))
+			}
+		}
+		rule := models.PolicyRule{
+			Name:        "forbid_debug_tools",
+			Description: "Final stage must not install debugging tools",
+			Value:       true,
+			Passed:      len(lines) == 0,
+		}
+		if len(lines) > 0 {
+			rule.Message = "Debugging tools installed on line " + strings.Join(lines, ", ")
+		}
+		e.recordIssueRule(policyResult, rule, analysis, "DIO019")
+	}
+
+	// Check the final stage is built on a golden image
+	if e.config.RequireGoldenImages && analysis != nil {
+		rule := models.PolicyRule{
+			Name:        "require_golden_images",
+			Description: "Final stage must be built on a golden image",
+			Value:       true,
+			Passed:      true,
+		}
+		for _, issue := range analysis.Issues {
+			if issue.ID == "DIO035" {
+				rule.Passed = false
+				rule.Message = issue.Description
+				if issue.Suggestion != "" {
+					rule.Message += " " + issue.Suggestion
+				}
+				break
+			}
+		}
+		e.recordIssueRule(policyResult, rule, analysis, "DIO035")
+	}
+
+	// Check the final image rebuilds byte for byte
+	if repro := result.Reproducibility; e.config.RequireReproducible && repro != nil {
+		rule := models.PolicyRule{
+			Name:        "require_reproducible",
+			Description: "Rebuilding the image must give the same digest",
+			Value:       true,
+			Passed:      repro.Reproducible,
+		}
+		if !repro.Reproducible {
+			rule.Message = reproducibilityDiff(repro)
+		}
+		e.record(policyResult, rule)
 	}
+
+	// Check the supply-chain attestations of the images dio run built
+	if len(result.Builds) > 0 {
+		att := result.Attestations
+		if e.config.RequireProvenance {
+			rule := models.PolicyRule{
+				Name:        "require_provenance",
+				Description: "The image must have a SLSA provenance attestation",
+				Value:       true,
+				Passed:      att != nil && strings.HasPrefix(att.PredicateType, "https://slsa.dev/provenance/"),
+			}
+			switch {
+			case att == nil || att.Provenance == "":
+				rule.Message = "No provenance attestation was generated (needs docker buildx)"
+			case !rule.Passed:
+				rule.Message = fmt.Sprintf("The provenance predicate %q is not SLSA provenance", att.PredicateType)
+			}
+			e.record(policyResult, rule)
+		}
+		if e.config.RequireSBOMAttestation {
+			rule := models.PolicyRule{
+				Name:        "require_sbom_attestation",
+				Description: "The image must have an SBOM attestation",
+				Value:       true,
+				Passed:      att != nil && len(att.SBOMs) > 0,
+			}
+			if !rule.Passed {
+				rule.Message = "No SBOM attestation was generated (needs docker buildx)"
+			}
+			e.record(policyResult, rule)
+		}
+	}
+
+	// Check critical CVEs
+	scanResult := result.FinalScan()
 	if scanResult != nil {
 		passed := scanResult.CriticalCount <= e.config.MaxCriticalCVEs
 		rule := models.PolicyRule{
@@ -166,29 +583,114 @@ func (e *Enforcer) Evaluate(result *models.PipelineResult) *models.PolicyResult
 		if !passed {
 			rule.Message = fmt.Sprintf("Found %d critical CVEs (max: %d)",
 				scanResult.CriticalCount, e.config.MaxCriticalCVEs)
-			policyResult.Passed = false
 		}
-		policyResult.Rules = append(policyResult.Rules, rule)
+		e.record(policyResult, rule)
 
 		// Check high CVEs
-		passedHigh := scanResult.HighCount <= e.config.MaxHighCVEs
-		ruleHigh := models.PolicyRule{
-			Name:        "max_high_cves",
-			Description: fmt.Sprintf("Maximum %d high CVEs allowed", e.config.MaxHighCVEs),
-			Value:       e.config.MaxHighCVEs,
-			Passed:      passedHigh,
+		threshold := e.config.threshold()
+		if models.SeverityHigh.AtLeast(threshold) {
+			passedHigh := scanResult.HighCount <= e.config.MaxHighCVEs
+			ruleHigh := models.PolicyRule{
+				Name:        "max_high_cves",
+				Description: fmt.Sprintf("Maximum %d high CVEs allowed", e.config.MaxHighCVEs),
+				Value:       e.config.MaxHighCVEs,
+				Passed:      passedHigh,
+			}
+			if !passedHigh {
+				ruleHigh.Message = fmt.Sprintf("Found %d high CVEs (max: %d)",
+					scanResult.HighCount, e.config.MaxHighCVEs)
+			}
+			e.record(policyResult, ruleHigh)
 		}
-		if !passedHigh {
-			ruleHigh.Message = fmt.Sprintf("Found %d high CVEs (max: %d)",
-				scanResult.HighCount, e.config.MaxHighCVEs)
-			policyResult.Passed = false
+
+		// Check CVEs below high down to the threshold, which have no limit
+		// of their own
+		if threshold.Rank() < models.SeverityHigh.Rank() {
+			var severities []string
+			counts := make(map[models.Severity]int)
+			for _, sev := range models.Severities {
+				if sev.Rank() < models.SeverityHigh.Rank() && sev.AtLeast(threshold) {
+					severities = append(severities, string(sev))
+				}
+			}
+			found := 0
+			for _, v := range scanResult.Vulnerabilities {
+				if v.Severity.Rank() < models.SeverityHigh.Rank() && v.Severity.AtLeast(threshold) {
+					counts[v.Severity]++
+					found++
+				}
+			}
+			rule := models.PolicyRule{
+				Name:        "threshold",
+				Description: fmt.Sprintf("No %s CVEs allowed", strings.Join(severities, " or ")),
+				Value:       string(threshold),
+				Passed:      found == 0,
+			}
+			if found > 0 {
+				var parts []string
+				for _, sev := range severities {
+					if n := counts[models.Severity(sev)]; n > 0 {
+						parts = append(parts, fmt.Sprintf("%d %s", n, sev))
+					}
+				}
+				rule.Message = fmt.Sprintf("Found %s CVEs (threshold: %s)", strings.Join(parts, ", "), threshold)
+			}
+			e.record(policyResult, rule)
 		}
-		policyResult.Rules = append(policyResult.Rules, ruleHigh)
+	}
+
+	// Check package licenses from the SBOM
+	const noSBOM = "no SBOM of the image (needs a built image and trivy or syft)"
+	if result.SBOM == nil && len(e.config.DeniedLicenses) > 0 {
+		e.recordNotEvaluated(policyResult, models.PolicyRule{
+			Name:        "denied_licenses",
+			Description: fmt.Sprintf("Packages must not use licenses: %s", strings.Join(e.config.DeniedLicenses, ", ")),
+			Value:       e.config.DeniedLicenses,
+		}, noSBOM)
+	}
+	if result.SBOM == nil && len(e.config.AllowedLicenses) > 0 {
+		e.recordNotEvaluated(policyResult, models.PolicyRule{
+			Name:        "allowed_licenses",
+			Description: "Packages must use approved licenses",
+			Value:       e.config.AllowedLicenses,
+		}, noSBOM)
+	}
+	if result.SBOM != nil && len(e.config.DeniedLicenses) > 0 {
+		denied := licensePatterns(e.config.DeniedLicenses)
+		violations := licenseViolations(result.SBOM.Packages, func(license string) bool {
+			return !matchesLicense(denied, license)
+		}, false)
+		rule := models.PolicyRule{
+			Name:        "denied_licenses",
+			Description: fmt.Sprintf("Packages must not use licenses: %s", strings.Join(e.config.DeniedLicenses, ", ")),
+			Value:       e.config.DeniedLicenses,
+			Passed:      len(violations) == 0,
+		}
+		if len(violations) > 0 {
+			rule.Message = fmt.Sprintf("%d package(s) with denied licenses: %s", len(violations), formatViolations(violations))
+		}
+		e.record(policyResult, rule)
+	}
+	if result.SBOM != nil && len(e.config.AllowedLicenses) > 0 {
+		allowed := licensePatterns(e.config.AllowedLicenses)
+		violations := licenseViolations(result.SBOM.Packages, func(license string) bool {
+			return matchesLicense(allowed, license)
+		}, true)
+		rule := models.PolicyRule{
+			Name:        "allowed_licenses",
+			Description: "Packages must use approved licenses",
+			Value:       e.config.AllowedLicenses,
+			Passed:      len(violations) == 0,
+		}
+		if len(violations) > 0 {
+			rule.Message = fmt.Sprintf("%d package(s) with unapproved or unknown licenses: %s", len(violations), formatViolations(violations))
+		}
+		e.record(policyResult, rule)
 	}
 
 	// Check analyzer score
-	if result.Analysis != nil && e.config.MinScore > 0 {
-		passed := result.Analysis.Score >= e.config.MinScore
+	if analysis != nil && e.config.MinScore > 0 {
+		passed := analysis.Score >= e.config.MinScore
 		rule := models.PolicyRule{
 			Name:        "min_score",
 			Description: fmt.Sprintf("Minimum analyzer score of %d required", e.config.MinScore),
@@ -197,55 +699,242 @@ func (e *Enforcer) Evaluate(result *models.PipelineResult) *models.PolicyResult
 		}
 		if !passed {
 			rule.Message = fmt.Sprintf("Score %d is below minimum %d",
-				result.Analysis.Score, e.config.MinScore)
-			policyResult.Passed = false
+				analysis.Score, e.config.MinScore)
 		}
-		policyResult.Rules = append(policyResult.Rules, rule)
+		e.record(policyResult, rule)
 	}
 
 	// Check max layers
-	if e.config.MaxLayers > 0 {
-		img := result.OptimizedImage
-		if img == nil {
-			img = result.BaselineImage
+	if e.config.MaxLayers > 0 && img != nil {
+		passed := img.Layers <= e.config.MaxLayers
+		rule := models.PolicyRule{
+			Name:        "max_layers",
+			Description: fmt.Sprintf("Maximum %d layers allowed", e.config.MaxLayers),
+			Value:       e.config.MaxLayers,
+			Passed:      passed,
 		}
-		if img != nil {
-			passed := img.Layers <= e.config.MaxLayers
+		if !passed {
+			rule.Message = fmt.Sprintf("Image has %d layers (max: %d)",
+				img.Layers, e.config.MaxLayers)
+		}
+		e.record(policyResult, rule)
+	}
+
+	// Check the budget the Dockerfile declares for its own image
+	if budget := declaredBudget(result); budget != nil && img != nil {
+		if maxSize, err := docker.ParseImageSize(budget.Size); budget.Size != "" && err == nil {
+			passed := img.Size <= maxSize
+			rule := models.PolicyRule{
+				Name:        "budget_size",
+				Description: fmt.Sprintf("Image size must be <= %s (dio:budget, line %d)", budget.Size, budget.Line),
+				Value:       budget.Size,
+				Passed:      passed,
+			}
+			if !passed {
+				rule.Message = fmt.Sprintf("Image size %s exceeds the Dockerfile's budget of %s",
+					img.SizeHuman, budget.Size)
+			}
+			e.record(policyResult, rule)
+		}
+		if budget.Layers > 0 {
+			passed := img.Layers <= budget.Layers
 			rule := models.PolicyRule{
-				Name:        "max_layers",
-				Description: fmt.Sprintf("Maximum %d layers allowed", e.config.MaxLayers),
-				Value:       e.config.MaxLayers,
+				Name:        "budget_layers",
+				Description: fmt.Sprintf("Maximum %d layers (dio:budget, line %d)", budget.Layers, budget.Line),
+				Value:       budget.Layers,
 				Passed:      passed,
 			}
 			if !passed {
-				rule.Message = fmt.Sprintf("Image has %d layers (max: %d)",
-					img.Layers, e.config.MaxLayers)
-				policyResult.Passed = false
+				rule.Message = fmt.Sprintf("Image has %d layers, over the Dockerfile's budget of %d",
+					img.Layers, budget.Layers)
 			}
-			policyResult.Rules = append(policyResult.Rules, rule)
+			e.record(policyResult, rule)
 		}
 	}
 
 	return policyResult
 }
 
+// declaredBudget returns the size budget declared in the Dockerfile as its
+// owners wrote it, which autofix may have rewritten.
+func declaredBudget(result *models.PipelineResult) *models.SizeBudget {
+	if result.Analysis != nil {
+		return result.Analysis.Budget
+	}
+	if analysis := result.FinalAnalysis(); analysis != nil {
+		return analysis.Budget
+	}
+	return nil
+}
+
+// reproducibilityDiff summarizes what differs between two rebuilds.
+func reproducibilityDiff(repro *models.ReproducibilityResult) string {
+	parts := []string{fmt.Sprintf("Rebuilds differ (%s)", strings.Join(repro.ImageIDs, " vs "))}
+	if len(repro.ConfigFields) > 0 {
+		fields := repro.ConfigFields
+		if len(fields) > 5 {
+			fields = append(fields[:5:5], "…")
+		}
+		parts = append(parts, "config: "+strings.Join(fields, ", "))
+	}
+	for _, layer := range repro.Layers {
+		part := fmt.Sprintf("layer %d: %d file(s)", layer.Layer, layer.Changed)
+		if len(layer.Files) > 0 {
+			part += " such as " + layer.Files[0]
+		}
+		parts = append(parts, part)
+	}
+	if repro.SourceDateEpoch == "" {
+		parts = append(parts, "set SOURCE_DATE_EPOCH (reproducible.source_date_epoch in .dio.yaml) to fix the timestamps")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// analysis returns the Dockerfile analysis the rules check.
+func (e *Enforcer) analysis(result *models.PipelineResult) *models.AnalysisResult {
+	if e.config.Analysis == models.AnalysisOriginal {
+		return result.Analysis
+	}
+	return result.FinalAnalysis()
+}
+
+// record adds a rule to the result, applying its enforcement level. Only
+// failed deny rules fail the policy; failed warn rules count as warnings.
+func (e *Enforcer) record(result *models.PolicyResult, rule models.PolicyRule) {
+	rule.Enforcement = e.config.enforcement(rule.Name)
+	if !rule.Passed {
+		if rule.Enforcement == models.EnforcementWarn {
+			result.Warnings++
+		} else {
+			result.Passed = false
+		}
+	}
+	result.Rules = append(result.Rules, rule)
+}
+
+// recordNotEvaluated records a rule that couldn't be checked, and why. It
+// warns rather than passing silently.
+func (e *Enforcer) recordNotEvaluated(result *models.PolicyResult, rule models.PolicyRule, reason string) {
+	rule.Passed = false
+	rule.NotEvaluated = true
+	rule.Enforcement = models.EnforcementWarn
+	rule.Message = "not evaluated: " + reason
+	result.Warnings++
+	result.Rules = append(result.Rules, rule)
+}
+
+// recordIssueRule records a rule that fails on the issues of the analyzer
+// rule id. When the image kind lowered all of them to info, such as a
+// missing HEALTHCHECK in a batch job, the rule only warns.
+func (e *Enforcer) recordIssueRule(result *models.PolicyResult, rule models.PolicyRule, analysis *models.AnalysisResult, id string) {
+	relaxed := !rule.Passed
+	for _, issue := range analysis.Issues {
+		if issue.ID == id && (issue.DefaultSeverity == "" || issue.Severity != models.SeverityInfo) {
+			relaxed = false
+		}
+	}
+	if !relaxed {
+		e.record(result, rule)
+		return
+	}
+	rule.Enforcement = models.EnforcementWarn
+	rule.Message += fmt.Sprintf(" (info for a %s image)", analysis.ImageKind)
+	result.Warnings++
+	result.Rules = append(result.Rules, rule)
+}
+
+// ApplyOverride lets a failed policy pass with a recorded reason, for urgent
+// builds that must ship despite failing checks. The override, the user and
+// the failed rules are kept in the result as an audit trail.
+func (e *Enforcer) ApplyOverride(result *models.PolicyResult, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return fmt.Errorf("override reason must not be empty")
+	}
+	if !e.config.Override.Allowed {
+		return fmt.Errorf("policy does not allow overrides")
+	}
+	tokenUsed := false
+	if want := e.config.Override.TokenSHA256; want != "" {
+		sum := sha256.Sum256([]byte(os.Getenv(OverrideTokenEnv)))
+		if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(want))) != 1 {
+			return fmt.Errorf("override requires a valid %s", OverrideTokenEnv)
+		}
+		tokenUsed = true
+	}
+	if result.Passed {
+		return nil
+	}
+
+	var failed []string
+	for _, rule := range result.Rules {
+		if !rule.Passed && rule.Enforcement != models.EnforcementWarn {
+			failed = append(failed, rule.Name)
+		}
+	}
+	result.Override = &models.PolicyOverride{
+		Reason:      reason,
+		User:        overrideUser(),
+		Timestamp:   time.Now().UTC(),
+		FailedRules: failed,
+		TokenUsed:   tokenUsed,
+	}
+	result.Passed = true
+	return nil
+}
+
+// overrideUser identifies who requested an override, preferring CI actors.
+func overrideUser() string {
+	for _, env := range []string{"GITHUB_ACTOR", "GITLAB_USER_LOGIN", "BUILD_REQUESTEDFOR", "USER", "USERNAME"} {
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 // FormatPolicyStatus returns a human-readable string of the policy result.
 func FormatPolicyStatus(result *models.PolicyResult) string {
 	var sb strings.Builder
-	if result.Passed {
+	switch {
+	case result.Override != nil:
+		sb.WriteString("⚠️  Policy checks FAILED — overridden\n")
+	case result.Passed && result.Warnings > 0:
+		sb.WriteString(fmt.Sprintf("✅ Policy checks passed with %d warning(s)\n", result.Warnings))
+	case result.Passed:
 		sb.WriteString("✅ All policy checks passed\n")
-	} else {
+	default:
 		sb.WriteString("❌ Policy checks FAILED\n")
 	}
+	if result.Profile != "" {
+		sb.WriteString(fmt.Sprintf("  Profile: %s\n", result.Profile))
+	}
 	sb.WriteString("\n")
 
 	for _, rule := range result.Rules {
-		if rule.Passed {
+		switch {
+		case rule.NotEvaluated:
+			sb.WriteString(fmt.Sprintf("  ⏭ %s: %s\n", rule.Description, rule.Message))
+		case rule.Passed:
 			sb.WriteString(fmt.Sprintf("  ✔ %s\n", rule.Description))
-		} else {
+		case rule.Enforcement == models.EnforcementWarn:
+			sb.WriteString(fmt.Sprintf("  ⚠ %s: %s (warn)\n", rule.Description, rule.Message))
+		default:
 			sb.WriteString(fmt.Sprintf("  ✘ %s: %s\n", rule.Description, rule.Message))
 		}
 	}
 
+	if o := result.Override; o != nil {
+		sb.WriteString(fmt.Sprintf("\n  Override by %s: %s\n", overrideWho(o), o.Reason))
+		sb.WriteString(fmt.Sprintf("  Overridden rules: %s\n", strings.Join(o.FailedRules, ", ")))
+	}
+
 	return sb.String()
 }
+
+func overrideWho(o *models.PolicyOverride) string {
+	if o.User == "" {
+		return "unknown user"
+	}
+	return o.User
+}
@@ -0,0 +1,641 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func rootAnalysis() *models.PipelineResult {
+	return &models.PipelineResult{
+		Analysis: &models.AnalysisResult{
+			Score:  90,
+			Issues: []models.Issue{{ID: "DIO006"}},
+		},
+	}
+}
+
+func TestEvaluate_WarnEnforcement(t *testing.T) {
+	config := DefaultConfig()
+	config.Enforcement = map[string]string{"require_non_root": models.EnforcementWarn}
+
+	result := NewEnforcer(config).Evaluate(rootAnalysis())
+	if !result.Passed {
+		t.Error("a failed warn rule must not fail the policy")
+	}
+	if result.Warnings != 1 {
+		t.Errorf("expected 1 warning, got %d", result.Warnings)
+	}
+
+	config.DefaultEnforcement = models.EnforcementWarn
+	config.Enforcement = nil
+	if result := NewEnforcer(config).Evaluate(rootAnalysis()); !result.Passed {
+		t.Error("default_enforcement: warn must apply to unlisted rules")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	config := DefaultConfig()
+	config.Enforcement = map[string]string{"min_score": "block"}
+	if err := config.validate(); err == nil {
+		t.Error("expected an error for an unknown enforcement level")
+	}
+}
+
+func TestApplyOverride(t *testing.T) {
+	config := DefaultConfig()
+	enforcer := NewEnforcer(config)
+	result := enforcer.Evaluate(rootAnalysis())
+	if result.Passed {
+		t.Fatal("expected the root container to fail the default policy")
+	}
+
+	if err := enforcer.ApplyOverride(result, "  "); err == nil {
+		t.Error("expected an empty reason to be rejected")
+	}
+	if err := enforcer.ApplyOverride(result, "INC-1234 hotfix"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Passed || result.Override == nil {
+		t.Fatal("expected the override to pass the policy and be recorded")
+	}
+	if len(result.Override.FailedRules) != 1 || result.Override.FailedRules[0] != "require_non_root" {
+		t.Errorf("expected overridden rules to be recorded, got %v", result.Override.FailedRules)
+	}
+
+	config.Override.Allowed = false
+	if err := NewEnforcer(config).ApplyOverride(NewEnforcer(config).Evaluate(rootAnalysis()), "hotfix"); err == nil {
+		t.Error("expected override to be rejected when not allowed")
+	}
+}
+
+func TestApplyOverride_Token(t *testing.T) {
+	sum := sha256.Sum256([]byte("s3cret"))
+	config := DefaultConfig()
+	config.Override.TokenSHA256 = hex.EncodeToString(sum[:])
+	enforcer := NewEnforcer(config)
+
+	t.Setenv(OverrideTokenEnv, "wrong")
+	if err := enforcer.ApplyOverride(enforcer.Evaluate(rootAnalysis()), "hotfix"); err == nil {
+		t.Error("expected a wrong token to be rejected")
+	}
+
+	t.Setenv(OverrideTokenEnv, "s3cret")
+	result := enforcer.Evaluate(rootAnalysis())
+	if err := enforcer.ApplyOverride(result, "hotfix"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Override.TokenUsed {
+		t.Error("expected the override to record that a token was used")
+	}
+}
+
+func writePolicy(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigProfile_ExtendsAndProfiles(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, "base.yaml", `
+max_image_size: "500MB"
+max_high_cves: 5
+enforcement:
+  min_score: warn
+profiles:
+  prod:
+    max_high_cves: 1
+`)
+	path := writePolicy(t, dir, "team.yaml", `
+extends: base.yaml
+max_high_cves: 3
+enforcement:
+  max_layers: warn
+profiles:
+  dev:
+    default_enforcement: warn
+  prod:
+    max_image_size: "200MB"
+`)
+
+	config, err := LoadConfigProfile(path, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.MaxHighCVEs != 3 || config.MaxImageSize != "500MB" {
+		t.Errorf("expected team.yaml to override base.yaml, got max_high_cves=%d max_image_size=%s", config.MaxHighCVEs, config.MaxImageSize)
+	}
+	if config.Enforcement["min_score"] != "warn" || config.Enforcement["max_layers"] != "warn" {
+		t.Errorf("expected enforcement maps to merge, got %v", config.Enforcement)
+	}
+
+	config, err = LoadConfigProfile(path, "prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.MaxHighCVEs != 1 || config.MaxImageSize != "200MB" || config.Profile != "prod" {
+		t.Errorf("expected prod profiles from both files to apply, got %+v", config)
+	}
+
+	if _, err := LoadConfigProfile(path, "qa"); err == nil || !strings.Contains(err.Error(), "dev, prod") {
+		t.Errorf("expected unknown profile error listing profiles, got %v", err)
+	}
+}
+
+func TestLoadConfigProfile_Cycle(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, "a.yaml", "extends: b.yaml\n")
+	path := writePolicy(t, dir, "b.yaml", "extends: a.yaml\n")
+	if _, err := LoadConfigProfile(path, ""); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+}
+
+func TestLoadConfigProfile_UnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	path := writePolicy(t, dir, "typo.yaml", `max_high_cve: 0
+enforcement:
+  min_scor: warn
+profiles:
+  prod:
+    require_healthcheck: yes please
+`)
+	_, err := LoadConfigProfile(path, "")
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || policyErr.Path != path {
+		t.Errorf("expected a PolicyError for %s, got %#v", path, err)
+	}
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("expected a FileError, got %v", err)
+	}
+	want := []string{
+		"1:1: max_high_cve: unknown key (did you mean max_high_cves?)",
+		"3:3: enforcement.min_scor: unknown rule (did you mean min_score?)",
+		`6:26: profiles.prod.require_healthcheck: expected true or false, got "yes please"`,
+	}
+	if len(fileErr.Problems) != len(want) {
+		t.Fatalf("expected %d problems, got %v", len(want), fileErr.Problems)
+	}
+	for i, p := range fileErr.Problems {
+		if p.Error() != want[i] {
+			t.Errorf("problem %d = %q, want %q", i, p.Error(), want[i])
+		}
+	}
+}
+
+func TestLoadConfigProfile_RenamedKeys(t *testing.T) {
+	renamedKeys["max_high_vulns"] = "max_high_cves"
+	defer delete(renamedKeys, "max_high_vulns")
+
+	dir := t.TempDir()
+	path := writePolicy(t, dir, "old.yaml", `max_high_vulns: 2
+enforcement:
+  max_high_vulns: warn
+`)
+	var notices []string
+	config, err := LoadConfigWithOptions(path, "", RemoteOptions{Warn: func(msg string) { notices = append(notices, msg) }})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.MaxHighCVEs != 2 || config.Enforcement["max_high_cves"] != "warn" {
+		t.Errorf("expected the old key to set max_high_cves, got %+v", config)
+	}
+	if len(notices) != 2 || notices[0] != path+":1: max_high_vulns is deprecated, use max_high_cves" {
+		t.Errorf("expected deprecation notices for both uses, got %q", notices)
+	}
+}
+
+func TestLoadConfigProfile_ShippedPolicies(t *testing.T) {
+	for _, profile := range []string{"dev", "staging", "prod"} {
+		if _, err := LoadConfigProfile("../../policies/environments.yaml", profile); err != nil {
+			t.Errorf("profile %s: %v", profile, err)
+		}
+	}
+}
+
+func TestEvaluate_ImageOnly(t *testing.T) {
+	result := NewEnforcer(DefaultConfig()).Evaluate(&models.PipelineResult{
+		Image: "nginx:latest",
+		BaselineImage: &models.ImageMetrics{
+			Size:   100 << 20,
+			Layers: 7,
+			User:   "",
+		},
+		ScanResult: &models.ScanResult{CriticalCount: 0, HighCount: 2},
+	})
+
+	got := make(map[string]bool)
+	for _, rule := range result.Rules {
+		got[rule.Name] = rule.Passed
+	}
+	want := map[string]bool{
+		"max_image_size":    true,
+		"forbid_latest_tag": false,
+		"require_non_root":  false,
+		"max_critical_cves": true,
+		"max_high_cves":     true,
+		"max_layers":        true,
+	}
+	for name, passed := range want {
+		if p, ok := got[name]; !ok || p != passed {
+			t.Errorf("rule %s: got passed=%v (evaluated=%v), want %v", name, p, ok, passed)
+		}
+	}
+	if _, ok := got["min_score"]; ok {
+		t.Error("min_score needs a Dockerfile analysis and must be skipped for images")
+	}
+}
+
+func TestEvaluate_Threshold(t *testing.T) {
+	scan := &models.ScanResult{
+		CriticalCount: 0,
+		HighCount:     7,
+		MediumCount:   2,
+		Vulnerabilities: []models.Vulnerability{
+			{ID: "CVE-1", Severity: models.SeverityMedium},
+			{ID: "CVE-2", Severity: models.SeverityMedium},
+			{ID: "CVE-3", Severity: models.SeverityLow},
+		},
+	}
+	tests := []struct {
+		threshold string
+		want      map[string]bool // rule name -> passed; missing = not evaluated
+	}{
+		{"", map[string]bool{"max_critical_cves": true, "max_high_cves": false}},
+		{"high", map[string]bool{"max_critical_cves": true, "max_high_cves": false}},
+		{"critical", map[string]bool{"max_critical_cves": true}},
+		{"medium", map[string]bool{"max_critical_cves": true, "max_high_cves": false, "threshold": false}},
+	}
+	for _, tt := range tests {
+		config := &Config{MaxHighCVEs: 5, Threshold: tt.threshold}
+		result := NewEnforcer(config).Evaluate(&models.PipelineResult{ScanResult: scan})
+		got := make(map[string]bool)
+		for _, rule := range result.Rules {
+			got[rule.Name] = rule.Passed
+			if rule.Name == "threshold" && rule.Message != "Found 2 medium CVEs (threshold: medium)" {
+				t.Errorf("unexpected threshold message %q", rule.Message)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("threshold %q: got rules %v, want %v", tt.threshold, got, tt.want)
+		}
+	}
+
+	config := DefaultConfig()
+	config.Threshold = "severe"
+	if err := config.validate(); err == nil {
+		t.Error("expected an error for an unknown threshold")
+	}
+}
+
+func TestEvaluate_OptimizedAnalysis(t *testing.T) {
+	result := &models.PipelineResult{
+		Analysis:          &models.AnalysisResult{Score: 40, Issues: []models.Issue{{ID: "DIO006"}}},
+		OptimizedAnalysis: &models.AnalysisResult{Score: 80, User: "app"},
+		BaselineImage:     &models.ImageMetrics{},
+		OptimizedImage:    &models.ImageMetrics{},
+	}
+	tests := []struct {
+		name      string
+		analysis  string
+		optimized *models.ImageMetrics
+		want      string
+		passed    bool
+	}{
+		{"default", "", result.OptimizedImage, models.AnalysisOptimized, true},
+		{"original", models.AnalysisOriginal, result.OptimizedImage, models.AnalysisOriginal, false},
+		{"optimized build failed", "", nil, models.AnalysisOriginal, false},
+	}
+	for _, tt := range tests {
+		config := &Config{MinScore: 50, RequireNonRoot: true, Analysis: tt.analysis}
+		r := *result
+		r.OptimizedImage = tt.optimized
+		got := NewEnforcer(config).Evaluate(&r)
+		if got.Analysis != tt.want || got.Passed != tt.passed {
+			t.Errorf("%s: got analysis %q passed %v, want %q %v", tt.name, got.Analysis, got.Passed, tt.want, tt.passed)
+		}
+	}
+
+	config := DefaultConfig()
+	config.Analysis = "shipped"
+	if err := config.validate(); err == nil {
+		t.Error("expected an error for an unknown analysis")
+	}
+}
+
+func TestEvaluate_SizeBudgets(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxCompressedSize = "50MB"
+	config.MaxSizeGrowth = "10%"
+	config.StageSizeBudgets = map[string]string{"builder": "1GB", "assets": "100MB"}
+
+	result := &models.PipelineResult{
+		BaselineImage: &models.ImageMetrics{Size: 120 << 20, SizeHuman: "120.0MB", CompressedSize: 60 << 20},
+		PreviousImage: &models.ImageMetrics{Size: 100 << 20, SizeHuman: "100.0MB"},
+		StageImages: map[string]*models.ImageMetrics{
+			"builder": {Size: 800 << 20, SizeHuman: "800.0MB"},
+			"assets":  {Size: 150 << 20, SizeHuman: "150.0MB"},
+		},
+	}
+
+	var got []string
+	for _, rule := range NewEnforcer(config).Evaluate(result).Rules {
+		got = append(got, fmt.Sprintf("%s=%v", rule.Description, rule.Passed))
+	}
+	want := []string{
+		"Image size must be <= 500MB=true",
+		"Compressed image size must be <= 50MB=false",
+		"Image size must not grow more than 10% since the previous run=false",
+		"Stage assets must be <= 100MB=false",
+		"Stage builder must be <= 1GB=true",
+	}
+	if strings.Join(got[:len(want)], "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected size rules:\n%s", strings.Join(got, "\n"))
+	}
+
+	config.MaxSizeGrowth = "50MB"
+	for _, rule := range NewEnforcer(config).Evaluate(result).Rules {
+		if rule.Name == "max_size_growth" && !rule.Passed {
+			t.Errorf("20MB growth must pass an absolute 50MB limit: %s", rule.Message)
+		}
+	}
+
+	// Without a registry the compressed size may not be measured
+	result.BaselineImage.CompressedSize = 0
+	var found bool
+	for _, rule := range NewEnforcer(config).Evaluate(result).Rules {
+		if rule.Name != "max_compressed_size" {
+			continue
+		}
+		found = true
+		if !rule.NotEvaluated || rule.Passed || rule.Enforcement != models.EnforcementWarn {
+			t.Errorf("expected an unmeasured compressed size to be reported as not evaluated, got %+v", rule)
+		}
+	}
+	if !found {
+		t.Error("expected max_compressed_size to be reported without a compressed size")
+	}
+
+	config.MaxSizeGrowth = "ten percent"
+	if err := config.validate(); err == nil {
+		t.Error("expected an error for an invalid max_size_growth")
+	}
+}
+
+func TestEvaluate_ForbidRootUserAndHealthcheck(t *testing.T) {
+	config := DefaultConfig()
+	config.RequireHealthcheck = true
+
+	tests := []struct {
+		name             string
+		result           *models.PipelineResult
+		rootPassed, hcOK bool
+	}{
+		{
+			name: "base image default user",
+			result: &models.PipelineResult{Analysis: &models.AnalysisResult{
+				Issues: []models.Issue{{ID: "DIO006"}, {ID: "DIO012"}},
+			}},
+			rootPassed: true,
+		},
+		{
+			name: "explicit USER root",
+			result: &models.PipelineResult{Analysis: &models.AnalysisResult{
+				User:   "root:root",
+				Issues: []models.Issue{{ID: "DIO006"}},
+			}},
+			hcOK: true,
+		},
+		{
+			name: "image config",
+			result: &models.PipelineResult{
+				Image:         "app:1.0",
+				BaselineImage: &models.ImageMetrics{User: "0", Healthcheck: true},
+			},
+			hcOK: true,
+		},
+	}
+	for _, tt := range tests {
+		got := make(map[string]bool)
+		for _, rule := range NewEnforcer(config).Evaluate(tt.result).Rules {
+			got[rule.Name] = rule.Passed
+		}
+		if passed, ok := got["forbid_root_user"]; !ok || passed != tt.rootPassed {
+			t.Errorf("%s: forbid_root_user passed=%v (evaluated=%v), want %v", tt.name, passed, ok, tt.rootPassed)
+		}
+		if passed, ok := got["require_healthcheck"]; !ok || passed != tt.hcOK {
+			t.Errorf("%s: require_healthcheck passed=%v (evaluated=%v), want %v", tt.name, passed, ok, tt.hcOK)
+		}
+	}
+}
+
+func TestEvaluate_ForbidDebugTools(t *testing.T) {
+	config := DefaultConfig()
+	config.ForbidDebugTools = true
+
+	result := &models.PipelineResult{Analysis: &models.AnalysisResult{
+		Issues: []models.Issue{{ID: "DIO019", Line: 4}, {ID: "DIO012"}, {ID: "DIO019", Line: 9}},
+	}}
+	var rule *models.PolicyRule
+	rules := NewEnforcer(config).Evaluate(result).Rules
+	for i := range rules {
+		if rules[i].Name == "forbid_debug_tools" {
+			rule = &rules[i]
+		}
+	}
+	if rule == nil {
+		t.Fatal("forbid_debug_tools was not evaluated")
+	}
+	if rule.Passed || rule.Message != "Debugging tools installed on line 4, 9" {
+		t.Errorf("unexpected rule: passed=%v message=%q", rule.Passed, rule.Message)
+	}
+
+	result.Analysis.Issues = []models.Issue{{ID: "DIO012"}}
+	for _, r := range NewEnforcer(config).Evaluate(result).Rules {
+		if r.Name == "forbid_debug_tools" && !r.Passed {
+			t.Errorf("forbid_debug_tools failed without DIO019 issues: %s", r.Message)
+		}
+	}
+}
+
+func TestEvaluate_ImageKindRelaxesIssueRules(t *testing.T) {
+	config := DefaultConfig()
+	config.RequireHealthcheck = true
+
+	// A job's missing HEALTHCHECK is info, so the rule only warns
+	result := &models.PipelineResult{Analysis: &models.AnalysisResult{
+		Score:     100,
+		User:      "app",
+		ImageKind: "job",
+		Issues:    []models.Issue{{ID: "DIO012", Severity: models.SeverityInfo, DefaultSeverity: models.SeverityHigh}},
+	}}
+	policyResult := NewEnforcer(config).Evaluate(result)
+	for _, rule := range policyResult.Rules {
+		if rule.Name != "require_healthcheck" {
+			continue
+		}
+		if rule.Passed || rule.Enforcement != models.EnforcementWarn || rule.Message != "No HEALTHCHECK in the final stage (info for a job image)" {
+			t.Errorf("expected a warning, got %+v", rule)
+		}
+	}
+	if !policyResult.Passed || policyResult.Warnings != 1 {
+		t.Errorf("expected the policy to pass with a warning, got passed=%v warnings=%d", policyResult.Passed, policyResult.Warnings)
+	}
+
+	// Raised or left at its own severity, it still fails
+	result.Analysis.ImageKind = "service"
+	result.Analysis.Issues = []models.Issue{{ID: "DIO012", Severity: models.SeverityHigh, DefaultSeverity: models.SeverityInfo}}
+	if NewEnforcer(config).Evaluate(result).Passed {
+		t.Error("expected a service without HEALTHCHECK to fail")
+	}
+}
+
+func TestEvaluate_RequireReproducible(t *testing.T) {
+	config := DefaultConfig()
+	config.RequireReproducible = true
+
+	result := &models.PipelineResult{Analysis: &models.AnalysisResult{Score: 100, User: "app"}}
+	for _, rule := range NewEnforcer(config).Evaluate(result).Rules {
+		if rule.Name == "require_reproducible" {
+			t.Error("expected the rule to be skipped without rebuilds")
+		}
+	}
+
+	result.Reproducibility = &models.ReproducibilityResult{
+		ImageIDs:     []string{"sha256:aaa", "sha256:bbb"},
+		ConfigFields: []string{"created"},
+		Layers:       []models.LayerDiff{{Layer: 3, Files: []string{"/app/build-info.txt"}, Changed: 1}},
+	}
+	policyResult := NewEnforcer(config).Evaluate(result)
+	if policyResult.Passed {
+		t.Error("expected differing rebuilds to fail")
+	}
+	for _, rule := range policyResult.Rules {
+		if rule.Name == "require_reproducible" && (!strings.Contains(rule.Message, "/app/build-info.txt") || !strings.Contains(rule.Message, "SOURCE_DATE_EPOCH")) {
+			t.Errorf("expected the differing file and a hint in the message, got %q", rule.Message)
+		}
+	}
+
+	result.Reproducibility = &models.ReproducibilityResult{ImageIDs: []string{"sha256:aaa", "sha256:aaa"}, Reproducible: true}
+	if policyResult := NewEnforcer(config).Evaluate(result); !policyResult.Passed {
+		t.Errorf("expected identical rebuilds to pass, got %+v", policyResult.Rules)
+	}
+}
+
+func TestEvaluate_RequireGoldenImages(t *testing.T) {
+	config := DefaultConfig()
+	config.RequireGoldenImages = true
+
+	result := &models.PipelineResult{Analysis: &models.AnalysisResult{
+		Score: 100,
+		User:  "app",
+		Issues: []models.Issue{{
+			ID:          "DIO035",
+			Severity:    models.SeverityMedium,
+			Description: "The final stage is built on 'node:20', which is not in the golden image catalog.",
+			Suggestion:  "Use 'registry.corp/golden/node:20', the golden image for node.",
+		}},
+	}}
+	policyResult := NewEnforcer(config).Evaluate(result)
+	if policyResult.Passed {
+		t.Error("expected a final stage on a public image to fail")
+	}
+	for _, rule := range policyResult.Rules {
+		if rule.Name == "require_golden_images" && !strings.Contains(rule.Message, "registry.corp/golden/node:20") {
+			t.Errorf("expected the golden image in the message, got %q", rule.Message)
+		}
+	}
+
+	result.Analysis.Issues = nil
+	if policyResult := NewEnforcer(config).Evaluate(result); !policyResult.Passed {
+		t.Errorf("expected a final stage on a golden image to pass, got %+v", policyResult.Rules)
+	}
+}
+
+func TestEvaluate_RequireProvenance(t *testing.T) {
+	config := DefaultConfig()
+	config.RequireProvenance = true
+	config.RequireSBOMAttestation = true
+
+	result := &models.PipelineResult{Analysis: &models.AnalysisResult{Score: 100, User: "app"}}
+	for _, rule := range NewEnforcer(config).Evaluate(result).Rules {
+		if rule.Name == "require_provenance" || rule.Name == "require_sbom_attestation" {
+			t.Errorf("expected %s to be skipped without builds", rule.Name)
+		}
+	}
+
+	result.Builds = []models.BuildLog{{Name: "baseline"}}
+	if NewEnforcer(config).Evaluate(result).Passed {
+		t.Error("expected a build without attestations to fail")
+	}
+
+	result.Attestations = &models.AttestationResult{
+		Provenance:    "reports/attestations/provenance.json",
+		PredicateType: "https://slsa.dev/provenance/v1",
+		SBOMs:         []string{"reports/attestations/sbom.spdx.json"},
+	}
+	if policyResult := NewEnforcer(config).Evaluate(result); !policyResult.Passed {
+		t.Errorf("expected SLSA provenance and an SBOM to pass, got %+v", policyResult.Rules)
+	}
+
+	result.Attestations.PredicateType = "https://example.com/provenance"
+	result.Attestations.SBOMs = nil
+	failed := 0
+	for _, rule := range NewEnforcer(config).Evaluate(result).Rules {
+		if (rule.Name == "require_provenance" || rule.Name == "require_sbom_attestation") && !rule.Passed {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Errorf("expected both rules to fail, %d did", failed)
+	}
+}
+
+func TestEvaluate_Budget(t *testing.T) {
+	result := &models.PipelineResult{
+		Analysis:      &models.AnalysisResult{Score: 100, Budget: &models.SizeBudget{Size: "150MB", Layers: 12, Line: 1}},
+		BaselineImage: &models.ImageMetrics{Size: 200 << 20, SizeHuman: "200.0MB", Layers: 8},
+	}
+	policyResult := NewEnforcer(&Config{}).Evaluate(result)
+	got := make(map[string]bool)
+	for _, rule := range policyResult.Rules {
+		got[rule.Name] = rule.Passed
+	}
+	if passed, ok := got["budget_size"]; !ok || passed {
+		t.Errorf("expected budget_size to fail, got %+v", policyResult.Rules)
+	}
+	if passed, ok := got["budget_layers"]; !ok || !passed {
+		t.Errorf("expected budget_layers to pass, got %+v", policyResult.Rules)
+	}
+	if policyResult.Passed {
+		t.Error("expected the policy to fail")
+	}
+
+	config, err := LoadConfig(writePolicy(t, t.TempDir(), "policy.yaml", "enforcement:\n  budget_size: warn\n"))
+	if err != nil {
+		t.Fatalf("expected budget_size to be a known rule: %v", err)
+	}
+	if policyResult := NewEnforcer(config).Evaluate(result); !policyResult.Passed || policyResult.Warnings != 1 {
+		t.Errorf("expected budget_size to only warn, got passed=%v warnings=%d", policyResult.Passed, policyResult.Warnings)
+	}
+
+	// Without an image, as in dio policy on a Dockerfile, there is nothing to check
+	result.BaselineImage = nil
+	for _, rule := range NewEnforcer(&Config{}).Evaluate(result).Rules {
+		if rule.Name == "budget_size" || rule.Name == "budget_layers" {
+			t.Errorf("expected %s to be skipped without an image", rule.Name)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package policy
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/registry"
+)
+
+// Media types of DIO policy OCI artifacts.
+const (
+	PolicyMediaType    = "application/vnd.dio.policy.v1+yaml"
+	SignatureMediaType = "application/vnd.dio.policy.signature.v1+base64"
+)
+
+// maxPolicySize bounds remote downloads.
+const maxPolicySize = 1 << 20
+
+// RemoteOptions controls fetching of policies given as https:// URLs or
+// oci:// artifact references.
+type RemoteOptions struct {
+	// CacheDir holds downloaded policies. Defaults to the user cache dir.
+	CacheDir string
+	// PublicKey, when set, requires every remote policy to carry a valid
+	// ed25519 signature: a detached "<url>.sig" file for URLs, or a
+	// signature layer for OCI artifacts.
+	PublicKey ed25519.PublicKey
+	// HTTPClient is used for all requests. Defaults to a client with a
+	// 30 second timeout.
+	HTTPClient *http.Client
+	// Keychain provides registry credentials for oci:// references, which
+	// are fetched anonymously without one.
+	Keychain registry.Keychain
+	// TLS configures registry connections when HTTPClient is not set.
+	TLS registry.TLSOptions
+	// Warn receives non-fatal problems, such as falling back to a cached
+	// copy when the server is unreachable.
+	Warn func(string)
+	// AllowHTTP permits plain http:// policy URLs without a PublicKey.
+	// They are rejected otherwise: anyone on the network path could
+	// replace the policy with one that passes everything.
+	AllowHTTP bool
+}
+
+// IsRemote reports whether a policy reference must be fetched. http://
+// references are only fetched with RemoteOptions.AllowHTTP or a PublicKey.
+func IsRemote(ref string) bool {
+	return strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "oci://")
+}
+
+// LoadPublicKey reads an ed25519 public key from a PEM (PKIX) file or a file
+// containing the base64-encoded raw key.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key is %T, expected ed25519", key)
+		}
+		return edKey, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be a PEM ed25519 key or %d base64-encoded bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// cacheMeta is stored next to each cached policy.
+type cacheMeta struct {
+	Ref          string    `json:"ref"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Signature    string    `json:"signature,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// fetch returns the content of a remote policy, revalidating the cached copy
+// with ETag/Last-Modified and falling back to it when the source is down.
+func (o RemoteOptions) fetch(ref string) ([]byte, error) {
+	if strings.HasPrefix(ref, "http://") && !o.AllowHTTP && o.PublicKey == nil {
+		return nil, fmt.Errorf("policy %s: plain http:// is not allowed without signature verification; use https://, set policy.public_key, or set policy.allow_http", ref)
+	}
+	dataPath, metaPath, err := o.cachePaths(ref)
+	if err != nil {
+		return nil, err
+	}
+	cached, cachedMeta := readCache(dataPath, metaPath)
+	meta := cachedMeta
+
+	var data []byte
+	var sig string
+	if strings.HasPrefix(ref, "oci://") {
+		data, sig, meta, err = o.fetchOCI(ref, cached, meta)
+	} else {
+		data, sig, meta, err = o.fetchHTTP(ref, cached, meta)
+	}
+	if err != nil {
+		if cached == nil {
+			return nil, err
+		}
+		o.warn(fmt.Sprintf("using cached policy for %s (fetched %s): %v", ref, cachedMeta.FetchedAt.Format(time.RFC3339), err))
+		data, sig = cached, cachedMeta.Signature
+	}
+
+	if o.PublicKey != nil {
+		if err := verifySignature(o.PublicKey, data, sig); err != nil {
+			return nil, fmt.Errorf("policy %s: %w", ref, err)
+		}
+	}
+
+	if err == nil {
+		meta.Ref = ref
+		meta.Signature = sig
+		writeCache(dataPath, metaPath, data, meta)
+	}
+	return data, nil
+}
+
+// fetchHTTP performs a conditional GET of a policy URL.
+func (o RemoteOptions) fetchHTTP(ref string, cached []byte, meta cacheMeta) ([]byte, string, cacheMeta, error) {
+	req, err := http.NewRequest(http.MethodGet, ref, nil)
+	if err != nil {
+		return nil, "", meta, err
+	}
+	if cached != nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return nil, "", meta, err
+	}
+	defer resp.Body.Close()
+
+	var data []byte
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		data = cached
+	case resp.StatusCode == http.StatusOK:
+		if data, err = readLimited(resp.Body); err != nil {
+			return nil, "", meta, err
+		}
+		meta.ETag = resp.Header.Get("ETag")
+		meta.LastModified = resp.Header.Get("Last-Modified")
+		meta.Signature = ""
+	default:
+		return nil, "", meta, fmt.Errorf("GET %s: %s", ref, resp.Status)
+	}
+	meta.FetchedAt = time.Now().UTC()
+
+	sig := meta.Signature
+	if o.PublicKey != nil && sig == "" {
+		body, err := o.get(ref+".sig", nil)
+		if err != nil {
+			return nil, "", meta, fmt.Errorf("failed to fetch signature: %w", err)
+		}
+		sig = strings.TrimSpace(string(body))
+	}
+	return data, sig, meta, nil
+}
+
+// ociManifest is the subset of an OCI image manifest DIO reads.
+type ociManifest struct {
+	Layers []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"layers"`
+}
+
+// fetchOCI downloads a policy pushed as an OCI artifact, e.g. with
+// `oras push ghcr.io/org/policies:prod policy.yaml:application/vnd.dio.policy.v1+yaml`.
+// The manifest ETag is used for revalidation.
+func (o RemoteOptions) fetchOCI(ref string, cached []byte, meta cacheMeta) ([]byte, string, cacheMeta, error) {
+	host, repo, reference, err := parseOCIRef(ref)
+	if err != nil {
+		return nil, "", meta, err
+	}
+	base := registry.BaseURL(host) + "/v2/" + repo
+
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.oci.image.manifest.v1+json")
+	if cached != nil && meta.ETag != "" {
+		header.Set("If-None-Match", meta.ETag)
+	}
+	resp, body, err := o.registry().Do(base+"/manifests/"+reference, header)
+	if err != nil {
+		return nil, "", meta, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		meta.FetchedAt = time.Now().UTC()
+		return cached, meta.Signature, meta, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", meta, fmt.Errorf("GET manifest %s: %s", ref, resp.Status)
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, "", meta, fmt.Errorf("invalid manifest for %s: %w", ref, err)
+	}
+	var policyDigest, sigDigest string
+	for _, layer := range manifest.Layers {
+		switch {
+		case layer.MediaType == SignatureMediaType:
+			sigDigest = layer.Digest
+		case policyDigest == "" && (layer.MediaType == PolicyMediaType || strings.Contains(layer.MediaType, "yaml")):
+			policyDigest = layer.Digest
+		}
+	}
+	if policyDigest == "" {
+		return nil, "", meta, fmt.Errorf("%s has no policy layer (%s)", ref, PolicyMediaType)
+	}
+
+	data, err := o.getBlob(base, policyDigest)
+	if err != nil {
+		return nil, "", meta, err
+	}
+	sig := ""
+	if sigDigest != "" {
+		sigData, err := o.getBlob(base, sigDigest)
+		if err != nil {
+			return nil, "", meta, err
+		}
+		sig = strings.TrimSpace(string(sigData))
+	}
+
+	meta.ETag = resp.Header.Get("ETag")
+	if meta.ETag == "" {
+		meta.ETag = resp.Header.Get("Docker-Content-Digest")
+	}
+	meta.FetchedAt = time.Now().UTC()
+	return data, sig, meta, nil
+}
+
+// getBlob downloads a blob and checks it against its digest.
+func (o RemoteOptions) getBlob(base, digest string) ([]byte, error) {
+	data, err := o.get(base+"/blobs/"+digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if want := "sha256:" + hex.EncodeToString(sum[:]); want != digest {
+		return nil, fmt.Errorf("blob digest mismatch: got %s, want %s", want, digest)
+	}
+	return data, nil
+}
+
+// get performs a GET that must succeed with 200.
+func (o RemoteOptions) get(rawURL string, header http.Header) ([]byte, error) {
+	return o.registry().Get(rawURL, header)
+}
+
+// registry returns a client that answers registry challenges with the
+// keychain's credential, or anonymously.
+func (o RemoteOptions) registry() *registry.Client {
+	return &registry.Client{HTTPClient: o.HTTPClient, Keychain: o.Keychain, TLS: o.TLS, MaxResponseSize: maxPolicySize}
+}
+
+// parseOCIRef splits oci://registry/repo:tag (or @digest).
+func parseOCIRef(ref string) (registry, repo, reference string, err error) {
+	rest := strings.TrimPrefix(ref, "oci://")
+	registry, path, ok := strings.Cut(rest, "/")
+	if !ok || path == "" {
+		return "", "", "", fmt.Errorf("invalid OCI reference %q, expected oci://registry/repository:tag", ref)
+	}
+	if repo, digest, ok := strings.Cut(path, "@"); ok {
+		return registry, repo, digest, nil
+	}
+	if idx := strings.LastIndex(path, ":"); idx > strings.LastIndex(path, "/") {
+		return registry, path[:idx], path[idx+1:], nil
+	}
+	return registry, path, "latest", nil
+}
+
+// verifySignature checks a base64 ed25519 signature over data.
+func verifySignature(key ed25519.PublicKey, data []byte, sig string) error {
+	if sig == "" {
+		return fmt.Errorf("signature required but none found")
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if !ed25519.Verify(key, data, raw) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
+
+func (o RemoteOptions) client() *http.Client {
+	if o.HTTPClient != nil {
+		return o.HTTPClient
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+func (o RemoteOptions) warn(msg string) {
+	if o.Warn != nil {
+		o.Warn(msg)
+	}
+}
+
+// cachePaths returns the cache files for a policy reference.
+func (o RemoteOptions) cachePaths(ref string) (string, string, error) {
+	dir := o.CacheDir
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return "", "", fmt.Errorf("no cache directory for remote policies: %w", err)
+		}
+		dir = filepath.Join(base, "dio", "policies")
+	}
+	sum := sha256.Sum256([]byte(ref))
+	name := hex.EncodeToString(sum[:8])
+	return filepath.Join(dir, name+".yaml"), filepath.Join(dir, name+".json"), nil
+}
+
+func readCache(dataPath, metaPath string) ([]byte, cacheMeta) {
+	var meta cacheMeta
+	data, err := os.ReadFile(dataPath)
+	if err != nil {
+		return nil, meta
+	}
+	if raw, err := os.ReadFile(metaPath); err == nil {
+		_ = json.Unmarshal(raw, &meta)
+	}
+	return data, meta
+}
+
+// writeCache stores a policy; failures only cost a re-download next time.
+func writeCache(dataPath, metaPath string, data []byte, meta cacheMeta) {
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0o755); err != nil {
+		return
+	}
+	raw, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(dataPath, data, 0o644)
+	_ = os.WriteFile(metaPath, raw, 0o644)
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxPolicySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPolicySize {
+		return nil, fmt.Errorf("response exceeds %d bytes", maxPolicySize)
+	}
+	return data, nil
+}
@@ -0,0 +1,159 @@
+package policy
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const remotePolicy = "max_image_size: \"300MB\"\nmax_high_cves: 0\n"
+
+func TestFetchHTTP_CacheAndRevalidate(t *testing.T) {
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, remotePolicy)
+	}))
+	opts := RemoteOptions{CacheDir: t.TempDir(), AllowHTTP: true}
+
+	for i := 0; i < 2; i++ {
+		config, err := LoadConfigWithOptions(srv.URL+"/prod.yaml", "", opts)
+		if err != nil {
+			t.Fatalf("fetch %d: %v", i, err)
+		}
+		if config.MaxImageSize != "300MB" {
+			t.Errorf("fetch %d: expected remote policy to load, got %s", i, config.MaxImageSize)
+		}
+	}
+	if requests != 2 || notModified != 1 {
+		t.Errorf("expected the second fetch to revalidate with ETag, got %d requests, %d not modified", requests, notModified)
+	}
+
+	// Fall back to the cached copy when the server goes away
+	srv.Close()
+	var warnings []string
+	opts.Warn = func(msg string) { warnings = append(warnings, msg) }
+	if _, err := LoadConfigWithOptions(srv.URL+"/prod.yaml", "", opts); err != nil {
+		t.Fatalf("expected cached fallback, got %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected a stale cache warning, got %v", warnings)
+	}
+}
+
+func TestFetchHTTP_Signature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(remotePolicy)))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/signed.yaml", "/tampered.yaml":
+			body := remotePolicy
+			if r.URL.Path == "/tampered.yaml" {
+				body = strings.Replace(body, "300MB", "9GB", 1)
+			}
+			fmt.Fprint(w, body)
+		case "/signed.yaml.sig", "/tampered.yaml.sig":
+			fmt.Fprint(w, sig)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	opts := RemoteOptions{CacheDir: t.TempDir(), PublicKey: pub}
+	if _, err := LoadConfigWithOptions(srv.URL+"/signed.yaml", "", opts); err != nil {
+		t.Errorf("expected a valid signature to verify, got %v", err)
+	}
+	if _, err := LoadConfigWithOptions(srv.URL+"/tampered.yaml", "", opts); err == nil {
+		t.Error("expected a tampered policy to be rejected")
+	}
+}
+
+func TestFetchHTTP_PlainHTTP(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, remotePolicy)
+	}))
+	defer srv.Close()
+
+	_, err := LoadConfigWithOptions(srv.URL+"/prod.yaml", "", RemoteOptions{CacheDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "plain http:// is not allowed") {
+		t.Errorf("expected an http:// policy to be rejected, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("expected no request to be made, got %d", requests)
+	}
+
+	if _, err := LoadConfigWithOptions(srv.URL+"/prod.yaml", "", RemoteOptions{CacheDir: t.TempDir(), AllowHTTP: true}); err != nil {
+		t.Errorf("expected an http:// policy to load when allowed, got %v", err)
+	}
+}
+
+func TestFetchOCI(t *testing.T) {
+	blob := []byte(remotePolicy)
+	sum := sha256.Sum256(blob)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"layers":[{"mediaType":%q,"digest":%q}]}`, PolicyMediaType, digest)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			fmt.Fprint(w, `{"token":"anon"}`)
+		case r.Header.Get("Authorization") != "Bearer anon":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="test",scope="repository:org/policies:pull"`, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/org/policies/manifests/prod":
+			fmt.Fprint(w, manifest)
+		case r.URL.Path == "/v2/org/policies/blobs/"+digest:
+			w.Write(blob)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	config, err := LoadConfigWithOptions("oci://"+host+"/org/policies:prod", "", RemoteOptions{CacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.MaxHighCVEs != 0 || config.MaxImageSize != "300MB" {
+		t.Errorf("expected OCI policy to load, got %+v", config)
+	}
+}
+
+func TestResolveExtends(t *testing.T) {
+	tests := []struct {
+		from, extends, want string
+	}{
+		{"policies/team.yaml", "base.yaml", "policies/base.yaml"},
+		{"https://policies.corp/dio/prod.yaml", "base.yaml", "https://policies.corp/dio/base.yaml"},
+		{"policies/team.yaml", "https://policies.corp/dio/base.yaml", "https://policies.corp/dio/base.yaml"},
+	}
+	for _, tt := range tests {
+		got, err := resolveExtends(tt.from, tt.extends)
+		if err != nil || got != tt.want {
+			t.Errorf("resolveExtends(%q, %q) = %q, %v; want %q", tt.from, tt.extends, got, err, tt.want)
+		}
+	}
+	if _, err := resolveExtends("oci://ghcr.io/org/p:prod", "base.yaml"); err == nil {
+		t.Error("expected relative extends from an OCI policy to be rejected")
+	}
+}
@@ -0,0 +1,195 @@
+// Package progress emits machine-readable pipeline progress as NDJSON, one
+// event per line, so CI wrappers and UIs can render live progress without
+// scraping the colored text output.
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	EventPipelineStarted  = "pipeline_started"
+	EventStepStarted      = "step_started"
+	EventLog              = "log"
+	EventStepFinished     = "step_finished"
+	EventPipelineFinished = "pipeline_finished"
+)
+
+// Step statuses reported by step_finished.
+const (
+	StatusOK      = "ok"
+	StatusWarning = "warning" // finished, but logged warnings
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// Pipeline statuses reported by pipeline_finished, besides StatusFailed.
+const (
+	StatusPassed     = "passed"
+	StatusOverridden = "overridden" // policy failed, break-glass override applied
+)
+
+// Log levels.
+const (
+	LevelInfo = "info"
+	LevelWarn = "warn"
+)
+
+// Event is a single progress record.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Step    string    `json:"step,omitempty"`
+	Title   string    `json:"title,omitempty"`
+	Index   int       `json:"index,omitempty"` // 1-based step number
+	Total   int       `json:"total,omitempty"`
+	Percent int       `json:"percent"`
+	Status  string    `json:"status,omitempty"`
+	Level   string    `json:"level,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Stream writes events for a pipeline of a fixed number of steps. All
+// methods are safe to call on a nil *Stream, which discards everything, so
+// callers don't need to check whether progress output was requested.
+type Stream struct {
+	mu       sync.Mutex
+	w        io.Writer
+	total    int
+	done     int
+	step     string
+	title    string
+	warnings bool
+	now      func() time.Time
+}
+
+// New returns a stream writing to w for a pipeline of total steps.
+func New(w io.Writer, total int) *Stream {
+	return &Stream{w: w, total: total, now: time.Now}
+}
+
+// Start announces the pipeline.
+func (s *Stream) Start(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emit(Event{Event: EventPipelineStarted, Total: s.total, Message: message})
+}
+
+// StartStep begins the next step.
+func (s *Stream) StartStep(step, title string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.step, s.title, s.warnings = step, title, false
+	s.emit(s.stepEvent(EventStepStarted))
+}
+
+// Log records a sub-step message for the current step.
+func (s *Stream) Log(level, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if level == LevelWarn {
+		s.warnings = true
+	}
+	e := s.stepEvent(EventLog)
+	e.Level, e.Message = level, message
+	s.emit(e)
+}
+
+// FinishStep completes the current step, with StatusWarning if it logged
+// any warnings.
+func (s *Stream) FinishStep() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := StatusOK
+	if s.warnings {
+		status = StatusWarning
+	}
+	s.finish(status, "")
+}
+
+// SkipStep records a step that didn't run.
+func (s *Stream) SkipStep(step, title string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.step, s.title = step, title
+	s.finish(StatusSkipped, "")
+}
+
+// Fail marks the current step and the pipeline as failed and returns err,
+// so it can wrap an error return.
+func (s *Stream) Fail(err error) error {
+	if s == nil || err == nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.step != "" {
+		s.finish(StatusFailed, err.Error())
+	}
+	s.emit(Event{Event: EventPipelineFinished, Total: s.total, Percent: s.percent(), Status: StatusFailed, Message: err.Error()})
+	return err
+}
+
+// Finish announces the end of the pipeline with its overall status.
+func (s *Stream) Finish(status, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emit(Event{Event: EventPipelineFinished, Total: s.total, Percent: 100, Status: status, Message: message})
+}
+
+// finish emits step_finished for the current step and advances the count.
+func (s *Stream) finish(status, message string) {
+	s.done++
+	e := s.stepEvent(EventStepFinished)
+	e.Status, e.Message = status, message
+	s.emit(e)
+	s.step, s.title = "", ""
+}
+
+func (s *Stream) stepEvent(event string) Event {
+	index := s.done + 1
+	if event == EventStepFinished {
+		index = s.done
+	}
+	return Event{Event: event, Step: s.step, Title: s.title, Index: index, Total: s.total, Percent: s.percent()}
+}
+
+func (s *Stream) percent() int {
+	if s.total == 0 {
+		return 0
+	}
+	return s.done * 100 / s.total
+}
+
+// emit writes one event as a JSON line. Write errors are ignored: progress
+// reporting must never break the pipeline.
+func (s *Stream) emit(e Event) {
+	e.Time = s.now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	_, _ = s.w.Write(append(data, '\n'))
+}
@@ -0,0 +1,95 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decode(t *testing.T, buf *bytes.Buffer) []Event {
+	t.Helper()
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestStream(t *testing.T) {
+	var buf bytes.Buffer
+	s := New(&buf, 3)
+	s.now = func() time.Time { return time.Unix(0, 0) }
+
+	s.Start("Dockerfile")
+	s.StartStep("analyze", "Analyzing")
+	s.Log(LevelInfo, "Score: 90/100")
+	s.FinishStep()
+	s.SkipStep("build", "Building")
+	s.StartStep("scan", "Scanning")
+	s.Log(LevelWarn, "Cannot scan")
+	s.FinishStep()
+	s.Finish(StatusPassed, "All checks passed")
+
+	events := decode(t, &buf)
+	want := []struct {
+		event, step, status string
+		index, percent      int
+	}{
+		{EventPipelineStarted, "", "", 0, 0},
+		{EventStepStarted, "analyze", "", 1, 0},
+		{EventLog, "analyze", "", 1, 0},
+		{EventStepFinished, "analyze", StatusOK, 1, 33},
+		{EventStepFinished, "build", StatusSkipped, 2, 66},
+		{EventStepStarted, "scan", "", 3, 66},
+		{EventLog, "scan", "", 3, 66},
+		{EventStepFinished, "scan", StatusWarning, 3, 100},
+		{EventPipelineFinished, "", StatusPassed, 0, 100},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d: %+v", len(want), len(events), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Event != w.event || e.Step != w.step || e.Status != w.status || e.Index != w.index || e.Percent != w.percent {
+			t.Errorf("event %d = %+v, want %+v", i, e, w)
+		}
+	}
+}
+
+func TestStream_Fail(t *testing.T) {
+	var buf bytes.Buffer
+	s := New(&buf, 2)
+	s.StartStep("analyze", "Analyzing")
+	err := errors.New("analysis failed")
+	if got := s.Fail(err); got != err {
+		t.Errorf("expected Fail to return the error, got %v", got)
+	}
+
+	events := decode(t, &buf)
+	last := events[len(events)-1]
+	if last.Event != EventPipelineFinished || last.Status != StatusFailed || last.Message != "analysis failed" {
+		t.Errorf("expected a failed pipeline_finished event, got %+v", last)
+	}
+	if events[1].Status != StatusFailed || events[1].Step != "analyze" {
+		t.Errorf("expected the analyze step to fail, got %+v", events[1])
+	}
+}
+
+func TestStream_Nil(t *testing.T) {
+	var s *Stream
+	s.Start("Dockerfile")
+	s.StartStep("analyze", "Analyzing")
+	s.Log(LevelWarn, "ignored")
+	s.FinishStep()
+	err := errors.New("boom")
+	if s.Fail(err) != err {
+		t.Error("expected a nil stream to pass errors through")
+	}
+}
@@ -0,0 +1,41 @@
+package pullrequest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/maxlar/docker-image-optimizer/internal/httpjson"
+)
+
+// GitHub opens pull requests in a GitHub repository.
+type GitHub struct {
+	Repo       string // owner/name
+	Token      string
+	APIURL     string // default httpjson.DefaultGitHubAPI, or a GitHub Enterprise API URL
+	HTTPClient *http.Client
+}
+
+// Open creates the pull request, then labels it: labels are set through
+// the issues API.
+func (g *GitHub) Open(r Request) (string, error) {
+	in := map[string]interface{}{"title": r.Title, "body": r.Body, "head": r.Head, "base": r.Base}
+	var pr struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := g.do(http.MethodPost, "/pulls", in, &pr); err != nil {
+		return "", err
+	}
+	if len(r.Labels) > 0 {
+		labels := map[string]interface{}{"labels": r.Labels}
+		if err := g.do(http.MethodPost, fmt.Sprintf("/issues/%d/labels", pr.Number), labels, nil); err != nil {
+			return pr.HTMLURL, fmt.Errorf("pull request opened, but labeling it failed: %w", err)
+		}
+	}
+	return pr.HTMLURL, nil
+}
+
+func (g *GitHub) do(method, path string, in, out interface{}) error {
+	api := &httpjson.GitHub{Repo: g.Repo, Token: g.Token, APIURL: g.APIURL, HTTPClient: g.HTTPClient}
+	return api.Do(method, path, in, out)
+}
@@ -0,0 +1,57 @@
+package pullrequest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/httpjson"
+)
+
+// DefaultGitLabAPI is the GitLab.com REST API endpoint.
+const DefaultGitLabAPI = "https://gitlab.com/api/v4"
+
+// GitLab opens merge requests in a GitLab project.
+type GitLab struct {
+	Project    string // group/name, or the numeric ID
+	Token      string
+	APIURL     string // default DefaultGitLabAPI, or a self-managed instance's /api/v4
+	HTTPClient *http.Client
+}
+
+// Open creates the merge request.
+func (g *GitLab) Open(r Request) (string, error) {
+	in := map[string]interface{}{
+		"title":         r.Title,
+		"description":   r.Body,
+		"source_branch": r.Head,
+		"target_branch": r.Base,
+	}
+	if len(r.Labels) > 0 {
+		in["labels"] = strings.Join(r.Labels, ",")
+	}
+	var mr struct {
+		WebURL string `json:"web_url"`
+	}
+	if err := g.do(http.MethodPost, "/merge_requests", in, &mr); err != nil {
+		return "", err
+	}
+	return mr.WebURL, nil
+}
+
+func (g *GitLab) do(method, path string, in, out interface{}) error {
+	api := g.APIURL
+	if api == "" {
+		api = DefaultGitLabAPI
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/projects/%s%s", strings.TrimSuffix(api, "/"), url.PathEscape(g.Project), path), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if g.Token != "" {
+		req.Header.Set("PRIVATE-TOKEN", g.Token)
+	}
+	return httpjson.Do(g.HTTPClient, req, in, out)
+}
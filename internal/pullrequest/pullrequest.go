@@ -0,0 +1,20 @@
+// Package pullrequest opens pull requests on GitHub and merge requests on
+// GitLab for changes dio pushed to a branch.
+package pullrequest
+
+// Request is a pull request to open.
+type Request struct {
+	Title string
+	Body  string // markdown
+	// Head is the pushed branch with the change, and Base the branch it
+	// should be merged into.
+	Head   string
+	Base   string
+	Labels []string
+}
+
+// Opener opens pull requests.
+type Opener interface {
+	// Open opens the pull request and returns its web URL.
+	Open(r Request) (string, error)
+}
@@ -0,0 +1,83 @@
+package pullrequest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGitHub_Open(t *testing.T) {
+	var labeled []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("expected the token to be sent, got %q", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Path {
+		case "/repos/acme/app/pulls":
+			var in map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&in)
+			if in["head"] != "dio/update" || in["base"] != "main" || in["title"] != "Bump node" {
+				t.Errorf("unexpected pull request %v", in)
+			}
+			_, _ = w.Write([]byte(`{"number": 7, "html_url": "https://github.com/acme/app/pull/7"}`))
+		case "/repos/acme/app/issues/7/labels":
+			var in struct {
+				Labels []string `json:"labels"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&in)
+			labeled = in.Labels
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	g := &GitHub{Repo: "acme/app", Token: "secret", APIURL: srv.URL}
+	url, err := g.Open(Request{Title: "Bump node", Body: "body", Head: "dio/update", Base: "main", Labels: []string{"dependencies"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://github.com/acme/app/pull/7" {
+		t.Errorf("Open = %s", url)
+	}
+	if len(labeled) != 1 || labeled[0] != "dependencies" {
+		t.Errorf("expected the pull request to be labeled, got %v", labeled)
+	}
+}
+
+func TestGitLab_Open(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawPath != "/projects/acme%2Fapp/merge_requests" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.RawPath)
+		}
+		if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+			t.Errorf("expected the token to be sent")
+		}
+		var in map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		if in["source_branch"] != "dio/update" || in["target_branch"] != "main" || in["labels"] != "dependencies,docker" {
+			t.Errorf("unexpected merge request %v", in)
+		}
+		_, _ = w.Write([]byte(`{"web_url": "https://gitlab.com/acme/app/-/merge_requests/3"}`))
+	}))
+	defer srv.Close()
+
+	g := &GitLab{Project: "acme/app", Token: "secret", APIURL: srv.URL}
+	url, err := g.Open(Request{Title: "Bump node", Head: "dio/update", Base: "main", Labels: []string{"dependencies", "docker"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://gitlab.com/acme/app/-/merge_requests/3" {
+		t.Errorf("Open = %s", url)
+	}
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Another open merge request already exists"}`, http.StatusConflict)
+	})
+	if _, err := g.Open(Request{Title: "Bump node", Head: "dio/update", Base: "main"}); err == nil {
+		t.Error("expected an error for a rejected merge request")
+	}
+}
@@ -0,0 +1,216 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// dockerHubServer is the key Docker uses for Docker Hub credentials.
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// Credential authenticates to a registry with a username and password, or
+// with the identity (refresh) token docker login stores for registries
+// that use OAuth2.
+type Credential struct {
+	Username      string
+	Password      string
+	IdentityToken string
+}
+
+// Empty reports whether the credential holds nothing to authenticate with.
+func (c Credential) Empty() bool {
+	return c.Username == "" && c.Password == "" && c.IdentityToken == ""
+}
+
+// Keychain finds the credential for a registry host such as ghcr.io or
+// localhost:5000. It returns an empty credential, not an error, when it
+// has none.
+type Keychain interface {
+	Get(registry string) (Credential, error)
+}
+
+// MultiKeychain asks each keychain in turn and returns the first credential
+// found.
+type MultiKeychain []Keychain
+
+// Get implements Keychain.
+func (m MultiKeychain) Get(registry string) (Credential, error) {
+	for _, k := range m {
+		cred, err := k.Get(registry)
+		if err != nil || !cred.Empty() {
+			return cred, err
+		}
+	}
+	return Credential{}, nil
+}
+
+// DefaultKeychain finds credentials the way docker does, from a docker
+// config file (empty for the default location) and its credential
+// helpers, falling back to the cloud provider CLIs for ECR, GCR/Artifact
+// Registry and ACR.
+func DefaultKeychain(dockerConfig string) Keychain {
+	return MultiKeychain{&DockerConfig{Path: dockerConfig}, CloudKeychain{}}
+}
+
+// DockerConfig reads credentials from a docker config.json: per-registry
+// credHelpers first, then the default credsStore, then inline auths.
+type DockerConfig struct {
+	// Path of config.json. Defaults to $DOCKER_CONFIG/config.json, or
+	// ~/.docker/config.json.
+	Path string
+}
+
+type dockerConfigFile struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredHelpers map[string]string `json:"credHelpers"`
+	CredsStore  string            `json:"credsStore"`
+}
+
+// Get implements Keychain. A missing config file yields no credential.
+func (d *DockerConfig) Get(registry string) (Credential, error) {
+	path := d.Path
+	if path == "" {
+		dir := os.Getenv("DOCKER_CONFIG")
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return Credential{}, nil
+			}
+			dir = filepath.Join(home, ".docker")
+		}
+		path = filepath.Join(dir, "config.json")
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Credential{}, nil
+	}
+	if err != nil {
+		return Credential{}, err
+	}
+	var cfg dockerConfigFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Credential{}, fmt.Errorf("invalid docker config %s: %w", path, err)
+	}
+
+	server := registry
+	if isDockerHub(registry) {
+		server = dockerHubServer
+	}
+	if helper := cfg.CredHelpers[registry]; helper != "" {
+		return credentialHelper(helper, server)
+	}
+	if cfg.CredsStore != "" {
+		cred, err := credentialHelper(cfg.CredsStore, server)
+		if err != nil || !cred.Empty() {
+			return cred, err
+		}
+	}
+	for key, auth := range cfg.Auths {
+		if authHost(key) != authHost(server) {
+			continue
+		}
+		cred := Credential{Username: auth.Username, Password: auth.Password, IdentityToken: auth.IdentityToken}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return Credential{}, fmt.Errorf("invalid auth for %s in %s: %w", key, path, err)
+			}
+			cred.Username, cred.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		return cred, nil
+	}
+	return Credential{}, nil
+}
+
+// isDockerHub reports whether a registry host is Docker Hub.
+func isDockerHub(registry string) bool {
+	switch registry {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return true
+	}
+	return false
+}
+
+// authHost normalizes an auths key, which may be a URL such as
+// https://index.docker.io/v1/, to its host.
+func authHost(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host, _, _ := strings.Cut(key, "/")
+	return host
+}
+
+// credentialHelper runs docker-credential-<helper> get for a server.
+func credentialHelper(helper, server string) (Credential, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// Helpers report unknown servers on stdout and exit 1
+		if strings.Contains(stdout.String()+stderr.String(), "credentials not found") {
+			return Credential{}, nil
+		}
+		return Credential{}, fmt.Errorf("docker-credential-%s failed: %w\n%s", helper, err, strings.TrimSpace(stderr.String()+stdout.String()))
+	}
+	var out struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return Credential{}, fmt.Errorf("invalid output from docker-credential-%s: %w", helper, err)
+	}
+	if out.Username == "<token>" {
+		return Credential{IdentityToken: out.Secret}, nil
+	}
+	return Credential{Username: out.Username, Password: out.Secret}, nil
+}
+
+var ecrHostRegex = regexp.MustCompile(`^\d{12}\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// CloudKeychain exchanges the ambient cloud login for a registry token
+// using the provider's CLI: aws for ECR, gcloud for GCR and Artifact
+// Registry, az for ACR. Other registries get no credential.
+type CloudKeychain struct{}
+
+// Get implements Keychain.
+func (CloudKeychain) Get(registry string) (Credential, error) {
+	var username, name string
+	var args []string
+	switch {
+	case ecrHostRegex.MatchString(registry):
+		region := ecrHostRegex.FindStringSubmatch(registry)[2]
+		username, name, args = "AWS", "aws", []string{"ecr", "get-login-password", "--region", region}
+	case registry == "gcr.io" || strings.HasSuffix(registry, ".gcr.io") || strings.HasSuffix(registry, "-docker.pkg.dev"):
+		username, name, args = "oauth2accesstoken", "gcloud", []string{"auth", "print-access-token"}
+	case strings.HasSuffix(registry, ".azurecr.io"):
+		// ACR access tokens are used with a null GUID as the username
+		username, name = "00000000-0000-0000-0000-000000000000", "az"
+		args = []string{"acr", "login", "--name", strings.TrimSuffix(registry, ".azurecr.io"),
+			"--expose-token", "--output", "tsv", "--query", "accessToken"}
+	default:
+		return Credential{}, nil
+	}
+
+	cmd := exec.Command(name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return Credential{}, fmt.Errorf("failed to get a token for %s with %s: %w\n%s", registry, name, err, strings.TrimSpace(stderr.String()))
+	}
+	return Credential{Username: username, Password: strings.TrimSpace(stdout.String())}, nil
+}
@@ -0,0 +1,335 @@
+// Package registry is a minimal client for the OCI distribution (Docker
+// registry v2) API, enough to list repositories and tags and fetch
+// manifests and blobs.
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/retry"
+)
+
+// defaultMaxResponseSize bounds responses when a Client sets no limit.
+const defaultMaxResponseSize = 4 << 20
+
+// pageSize is the number of entries requested per catalog or tags page.
+const pageSize = 100
+
+// linkRegex extracts the next page URL from a Link header such as
+// `</v2/_catalog?last=b&n=100>; rel="next"`.
+var linkRegex = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// Client talks to registries. Bearer challenges are answered with a token
+// from the registry's auth service, using the registry's credential if
+// there is one and anonymously otherwise; Basic challenges require a
+// credential.
+type Client struct {
+	// HTTPClient is used for all requests. Defaults to a client with a
+	// 30 second timeout and the TLS settings.
+	HTTPClient *http.Client
+	// Username and Password, when set, are used for every registry.
+	Username string
+	Password string
+	// Keychain finds credentials per registry when Username is not set.
+	Keychain Keychain
+	// TLS configures CAs, client certificates and unverified registries.
+	TLS TLSOptions
+	// MaxResponseSize bounds response bodies (default 4 MiB).
+	MaxResponseSize int64
+	// Retry retries requests that fail with network errors, 429 or 502-504
+	// (default: no retries).
+	Retry retry.Policy
+
+	mu         sync.Mutex
+	creds      map[string]Credential
+	httpClient *http.Client
+}
+
+// BaseURL returns the base URL of a registry. Local registries are assumed
+// to serve plain HTTP.
+func BaseURL(registry string) string {
+	host := registry
+	if h, _, ok := strings.Cut(registry, ":"); ok {
+		host = h
+	}
+	if host == "localhost" || host == "127.0.0.1" {
+		return "http://" + registry
+	}
+	return "https://" + registry
+}
+
+// Catalog lists the repositories of a registry.
+func (c *Client) Catalog(registry string) ([]string, error) {
+	var repos []string
+	next := fmt.Sprintf("%s/v2/_catalog?n=%d", BaseURL(registry), pageSize)
+	for next != "" {
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		var err error
+		if next, err = c.getPage(next, &page); err != nil {
+			return nil, fmt.Errorf("failed to list repositories of %s: %w", registry, err)
+		}
+		repos = append(repos, page.Repositories...)
+	}
+	return repos, nil
+}
+
+// Tags lists the tags of a repository.
+func (c *Client) Tags(registry, repo string) ([]string, error) {
+	var tags []string
+	next := fmt.Sprintf("%s/v2/%s/tags/list?n=%d", BaseURL(registry), repo, pageSize)
+	for next != "" {
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		var err error
+		if next, err = c.getPage(next, &page); err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s/%s: %w", registry, repo, err)
+		}
+		tags = append(tags, page.Tags...)
+	}
+	return tags, nil
+}
+
+// getPage fetches one page of a paginated listing into out and returns the
+// URL of the next page, or "" on the last page.
+func (c *Client) getPage(rawURL string, out interface{}) (string, error) {
+	resp, body, err := c.Do(rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return "", fmt.Errorf("invalid response from %s: %w", rawURL, err)
+	}
+
+	m := linkRegex.FindStringSubmatch(resp.Header.Get("Link"))
+	if m == nil {
+		return "", nil
+	}
+	base, _ := url.Parse(rawURL)
+	next, err := base.Parse(m[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid Link header %q: %w", resp.Header.Get("Link"), err)
+	}
+	return next.String(), nil
+}
+
+// Get performs a GET that must succeed with 200.
+func (c *Client) Get(rawURL string, header http.Header) ([]byte, error) {
+	resp, body, err := c.Do(rawURL, header)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	return body, nil
+}
+
+// Do performs a GET, answering an authentication challenge if needed. The
+// response is returned whatever its status.
+func (c *Client) Do(rawURL string, header http.Header) (*http.Response, []byte, error) {
+	resp, body, err := c.doRetry(rawURL, header)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, body, err
+	}
+
+	cred, err := c.credential(resp.Request.URL.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	authed := header.Clone()
+	if authed == nil {
+		authed = http.Header{}
+	}
+	switch {
+	case strings.HasPrefix(challenge, "Bearer "):
+		token, err := c.token(challenge, cred)
+		if err != nil {
+			return nil, nil, err
+		}
+		authed.Set("Authorization", "Bearer "+token)
+	case strings.HasPrefix(challenge, "Basic ") && cred.Username != "":
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(cred.Username, cred.Password)
+		authed.Set("Authorization", req.Header.Get("Authorization"))
+	default:
+		return nil, nil, fmt.Errorf("registry requires unsupported authentication: %q", challenge)
+	}
+	return c.doRetry(rawURL, authed)
+}
+
+// credential returns the credential for a registry host: the explicit
+// username and password, or what the keychain has. Keychain lookups may
+// run credential helpers, so their results are cached.
+func (c *Client) credential(host string) (Credential, error) {
+	if c.Username != "" {
+		return Credential{Username: c.Username, Password: c.Password}, nil
+	}
+	if c.Keychain == nil {
+		return Credential{}, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cred, ok := c.creds[host]; ok {
+		return cred, nil
+	}
+	cred, err := c.Keychain.Get(host)
+	if err != nil {
+		return Credential{}, fmt.Errorf("failed to get credentials for %s: %w", host, err)
+	}
+	if c.creds == nil {
+		c.creds = make(map[string]Credential)
+	}
+	c.creds[host] = cred
+	return cred, nil
+}
+
+// doRetry performs a GET, retrying network errors and responses that say
+// the registry is overloaded. The last response is returned once the
+// attempts run out.
+func (c *Client) doRetry(rawURL string, header http.Header) (*http.Response, []byte, error) {
+	var resp *http.Response
+	var body []byte
+	err := c.Retry.Do("GET "+rawURL, func() error {
+		var err error
+		resp, body, err = c.doOnce(rawURL, header)
+		if err != nil {
+			resp = nil
+			return err
+		}
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+		}
+		return nil
+	})
+	if resp != nil {
+		return resp, body, nil
+	}
+	return nil, nil, err
+}
+
+func (c *Client) doOnce(rawURL string, header http.Header) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := c.readLimited(resp.Body)
+	return resp, body, err
+}
+
+// token requests a token for a Bearer challenge such as
+// `Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:org/p:pull"`.
+// Identity tokens are exchanged with an OAuth2 refresh_token grant, other
+// credentials are sent as basic auth.
+func (c *Client) token(challenge string, cred Credential) (string, error) {
+	params := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			params[k] = strings.Trim(v, `"`)
+		}
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid bearer realm in %q", challenge)
+	}
+	q := realm.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			q.Set(k, params[k])
+		}
+	}
+
+	var resp *http.Response
+	var body []byte
+	if cred.IdentityToken != "" {
+		q.Set("grant_type", "refresh_token")
+		q.Set("refresh_token", cred.IdentityToken)
+		q.Set("client_id", "dio")
+		resp, body, err = c.postForm(realm.String(), q)
+	} else {
+		realm.RawQuery = q.Encode()
+		header := http.Header{}
+		if cred.Username != "" {
+			req := &http.Request{Header: header}
+			req.SetBasicAuth(cred.Username, cred.Password)
+		}
+		resp, body, err = c.doOnce(realm.String(), header)
+	}
+	if err == nil && resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("GET %s: %s", realm, resp.Status)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", fmt.Errorf("invalid registry token response: %w", err)
+	}
+	if tok.Token != "" {
+		return tok.Token, nil
+	}
+	return tok.AccessToken, nil
+}
+
+func (c *Client) postForm(rawURL string, form url.Values) (*http.Response, []byte, error) {
+	resp, err := c.client().PostForm(rawURL, form)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := c.readLimited(resp.Body)
+	return resp, body, err
+}
+
+func (c *Client) readLimited(r io.Reader) ([]byte, error) {
+	limit := c.MaxResponseSize
+	if limit == 0 {
+		limit = defaultMaxResponseSize
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("response exceeds %d bytes", limit)
+	}
+	return data, nil
+}
+
+func (c *Client) client() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: 30 * time.Second, Transport: &tlsTransport{opts: c.TLS}}
+	}
+	return c.httpClient
+}
@@ -0,0 +1,182 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/retry"
+)
+
+// fakeCommand puts an executable shell script named name on PATH.
+func fakeCommand(t *testing.T, name, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestDockerConfig(t *testing.T) {
+	fakeCommand(t, "docker-credential-corp", `read server
+case "$server" in
+  helper.corp) echo '{"ServerURL":"helper.corp","Username":"bot","Secret":"s3cret"}' ;;
+  https://index.docker.io/v1/) echo '{"ServerURL":"","Username":"<token>","Secret":"refresh"}' ;;
+  *) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`)
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := fmt.Sprintf(`{
+  "auths": {
+    "https://registry.corp/v1/": {"auth": %q},
+    "localhost:5000": {"username": "dev", "password": "pw"}
+  },
+  "credHelpers": {"helper.corp": "corp", "docker.io": "corp"}
+}`, base64.StdEncoding.EncodeToString([]byte("alice:pa:ss")))
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &DockerConfig{Path: path}
+	tests := []struct {
+		registry string
+		want     Credential
+	}{
+		{"registry.corp", Credential{Username: "alice", Password: "pa:ss"}},
+		{"localhost:5000", Credential{Username: "dev", Password: "pw"}},
+		{"helper.corp", Credential{Username: "bot", Password: "s3cret"}},
+		{"docker.io", Credential{IdentityToken: "refresh"}},
+		{"ghcr.io", Credential{}},
+	}
+	for _, tt := range tests {
+		got, err := d.Get(tt.registry)
+		if err != nil || got != tt.want {
+			t.Errorf("Get(%q) = %+v, %v; want %+v", tt.registry, got, err, tt.want)
+		}
+	}
+
+	// An unknown server in the credential store is not an error
+	if err := os.WriteFile(path, []byte(`{"credsStore": "corp"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.Get("ghcr.io"); err != nil || !got.Empty() {
+		t.Errorf("expected no credential from the store, got %+v, %v", got, err)
+	}
+	if got, err := (&DockerConfig{Path: filepath.Join(t.TempDir(), "missing.json")}).Get("ghcr.io"); err != nil || !got.Empty() {
+		t.Errorf("expected no credential without a config file, got %+v, %v", got, err)
+	}
+}
+
+func TestCloudKeychain(t *testing.T) {
+	fakeCommand(t, "aws", `echo "token-for-$4"`)
+	got, err := CloudKeychain{}.Get("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	if err != nil || got != (Credential{Username: "AWS", Password: "token-for-eu-west-1"}) {
+		t.Errorf("ECR credential = %+v, %v", got, err)
+	}
+	if got, err := (CloudKeychain{}).Get("ghcr.io"); err != nil || !got.Empty() {
+		t.Errorf("expected no credential for ghcr.io, got %+v, %v", got, err)
+	}
+}
+
+type staticKeychain map[string]Credential
+
+func (k staticKeychain) Get(registry string) (Credential, error) { return k[registry], nil }
+
+func TestClient_Keychain(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token" && r.Method == http.MethodPost:
+			// OAuth2 refresh token grant for identity tokens
+			if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh" || r.FormValue("scope") != "repository:team/api:pull" {
+				http.Error(w, "bad grant", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"t"}`)
+		case r.URL.Path == "/token":
+			if user, pass, _ := r.BasicAuth(); user != "bot" || pass != "s3cret" {
+				http.Error(w, "denied", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token":"t"}`)
+		case r.Header.Get("Authorization") != "Bearer t":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="test",scope="repository:team/api:pull"`, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			fmt.Fprint(w, `{"tags":["v1"]}`)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	for _, cred := range []Credential{{Username: "bot", Password: "s3cret"}, {IdentityToken: "refresh"}} {
+		c := &Client{Keychain: staticKeychain{host: cred}}
+		tags, err := c.Tags(host, "team/api")
+		if err != nil || len(tags) != 1 {
+			t.Errorf("Tags with %+v = %v, %v", cred, tags, err)
+		}
+	}
+	c := &Client{Keychain: staticKeychain{}}
+	if _, err := c.Tags(host, "team/api"); err == nil {
+		t.Error("expected anonymous access to be denied")
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"repositories":["team/api"]}`)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	certsDir := t.TempDir()
+	if _, err := (&Client{TLS: TLSOptions{CertsDir: certsDir}}).Get(srv.URL+"/v2/_catalog", nil); err == nil {
+		t.Fatal("expected the test server's certificate to be rejected")
+	}
+
+	// A CA in certs.d/<host>/ is trusted for that registry only
+	if err := os.MkdirAll(filepath.Join(certsDir, host), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(filepath.Join(certsDir, host, "ca.crt"), ca, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Client{TLS: TLSOptions{CertsDir: certsDir}}).Get(srv.URL+"/v2/_catalog", nil); err != nil {
+		t.Errorf("expected the certs.d CA to be trusted: %v", err)
+	}
+	if _, err := (&Client{TLS: TLSOptions{CertsDir: t.TempDir(), Insecure: []string{host}}}).Get(srv.URL+"/v2/_catalog", nil); err != nil {
+		t.Errorf("expected an insecure registry to skip verification: %v", err)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"tags":["v1"]}`)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	c := &Client{Retry: retry.Policy{Attempts: 3}}
+	if tags, err := c.Tags(host, "team/api"); err != nil || len(tags) != 1 || calls != 3 {
+		t.Errorf("Tags = %v, %v after %d calls", tags, err, calls)
+	}
+
+	// Without retries the rate limit is reported
+	calls = 0
+	if _, err := (&Client{}).Tags(host, "team/api"); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("expected the 429 to be reported, got %v", err)
+	}
+}
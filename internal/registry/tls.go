@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultCertsDir is where docker looks for per-registry certificates.
+const DefaultCertsDir = "/etc/docker/certs.d"
+
+// TLSOptions configures TLS for registry connections.
+type TLSOptions struct {
+	// CAFile is a PEM bundle of additional CAs trusted for every registry.
+	CAFile string
+	// CertsDir holds per-registry certificates laid out like docker's
+	// certs.d: in <dir>/<host[:port]>/, *.crt files are trusted CAs and
+	// *.cert/*.key pairs are client certificates. Defaults to
+	// DefaultCertsDir.
+	CertsDir string
+	// Insecure lists registries whose certificates are not verified.
+	Insecure []string
+}
+
+// Config returns the TLS configuration for a registry host.
+func (o TLSOptions) Config(host string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	for _, h := range o.Insecure {
+		if h == host {
+			cfg.InsecureSkipVerify = true
+			return cfg, nil
+		}
+	}
+
+	dir := o.CertsDir
+	if dir == "" {
+		dir = DefaultCertsDir
+	}
+	dir = filepath.Join(dir, host)
+	var cas []string
+	if o.CAFile != "" {
+		cas = append(cas, o.CAFile)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case strings.HasSuffix(name, ".crt"):
+			cas = append(cas, filepath.Join(dir, name))
+		case strings.HasSuffix(name, ".cert"):
+			keyFile := filepath.Join(dir, strings.TrimSuffix(name, ".cert")+".key")
+			cert, err := tls.LoadX509KeyPair(filepath.Join(dir, name), keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate for %s: %w", host, err)
+			}
+			cfg.Certificates = append(cfg.Certificates, cert)
+		}
+	}
+
+	if len(cas) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range cas {
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", path)
+			}
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// tlsTransport picks the TLS configuration per registry host, since CAs
+// and client certificates differ between registries.
+type tlsTransport struct {
+	opts  TLSOptions
+	mu    sync.Mutex
+	hosts map[string]http.RoundTripper
+}
+
+func (t *tlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt, err := t.forHost(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	return rt.RoundTrip(req)
+}
+
+func (t *tlsTransport) forHost(host string) (http.RoundTripper, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if rt, ok := t.hosts[host]; ok {
+		return rt, nil
+	}
+	cfg, err := t.opts.Config(host)
+	if err != nil {
+		return nil, err
+	}
+	rt := http.DefaultTransport.(*http.Transport).Clone()
+	rt.TLSClientConfig = cfg
+	if t.hosts == nil {
+		t.hosts = make(map[string]http.RoundTripper)
+	}
+	t.hosts[host] = rt
+	return rt, nil
+}
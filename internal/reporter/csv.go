@@ -0,0 +1,60 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// AnalysisCSV renders analysis issues as CSV, one row per issue.
+func AnalysisCSV(result *models.AnalysisResult) (string, error) {
+	rows := [][]string{{"dockerfile", "id", "severity", "category", "title", "description",
+		"line", "stage", "suggestion", "auto_fixable", "docs_url", "fingerprint", "fixed_by_optimization"}}
+	for _, issue := range result.Issues {
+		line := ""
+		if issue.Line > 0 {
+			line = strconv.Itoa(issue.Line)
+		}
+		rows = append(rows, []string{result.Dockerfile, issue.ID, string(issue.Severity), issue.Category,
+			issue.Title, issue.Description, line, issue.Stage, issue.Suggestion,
+			strconv.FormatBool(issue.AutoFixable), issue.DocsURL, issue.Fingerprint, issue.FixedByOptimization})
+	}
+	return writeCSV(rows)
+}
+
+// ScanCSV renders scan vulnerabilities as CSV, one row per vulnerability.
+func ScanCSV(result *models.ScanResult) (string, error) {
+	rows := [][]string{{"image", "scanner", "id", "severity", "package", "version", "fixed_version",
+		"title", "description", "data_source", "published_date", "fingerprint"}}
+	for _, v := range result.Vulnerabilities {
+		rows = append(rows, []string{result.ImageName, result.Scanner, v.ID, string(v.Severity), v.Package,
+			v.Version, v.FixedVersion, v.Title, v.Description, v.DataSource, v.PublishedDate, v.Fingerprint})
+	}
+	return writeCSV(rows)
+}
+
+func writeCSV(rows [][]string) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	for _, row := range rows {
+		for i := range row {
+			row[i] = csvCell(row[i])
+		}
+		if err := w.Write(row); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// csvCell neutralizes values a spreadsheet would evaluate as a formula.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+package reporter
+
+import (
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func TestAnalysisCSV(t *testing.T) {
+	result := &models.AnalysisResult{
+		Dockerfile: "api/Dockerfile",
+		Issues: []models.Issue{
+			{ID: "DIO001", Severity: models.SeverityHigh, Category: "security", Title: "Unpinned base image, tag latest",
+				Description: "The tag moves.\nBuilds are not reproducible.", Line: 1, Stage: "build",
+				Suggestion: `Pin "node" to a digest`, AutoFixable: true, Fingerprint: "abc123", FixedByOptimization: "OPT-PIN"},
+			{ID: "DIO002", Severity: models.SeverityMedium, Category: "best-practice", Title: "No .dockerignore",
+				Suggestion: "=HYPERLINK(\"http://evil\")"},
+		},
+	}
+	out, err := AnalysisCSV(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header, _, _ := strings.Cut(out, "\n"); header != "dockerfile,id,severity,category,title,description,line,stage,suggestion,auto_fixable,docs_url,fingerprint,fixed_by_optimization" {
+		t.Errorf("unexpected header row %q", header)
+	}
+	if !strings.Contains(out, `"Unpinned base image, tag latest","The tag moves.`+"\n"+`Builds are not reproducible.",1,build,"Pin ""node"" to a digest"`) {
+		t.Errorf("expected commas, newlines and quotes to be quoted, got:\n%s", out)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"api/Dockerfile", "DIO001", "high", "security", "Unpinned base image, tag latest", "The tag moves.\nBuilds are not reproducible.",
+			"1", "build", `Pin "node" to a digest`, "true", "", "abc123", "OPT-PIN"},
+		{"api/Dockerfile", "DIO002", "medium", "best-practice", "No .dockerignore", "",
+			"", "", "'=HYPERLINK(\"http://evil\")", "false", "", "", ""},
+	}
+	if len(rows) != 3 || !reflect.DeepEqual(rows[1:], want) {
+		t.Errorf("expected a header and one row per issue, got %q", rows)
+	}
+}
+
+func TestScanCSV(t *testing.T) {
+	result := &models.ScanResult{
+		ImageName: "app:dio",
+		Scanner:   "trivy",
+		Vulnerabilities: []models.Vulnerability{
+			{ID: "CVE-2024-1", Severity: models.SeverityCritical, Package: "openssl", Version: "3.0.1", FixedVersion: "3.0.2, 3.1.1",
+				Title: "Buffer overflow", Description: "A crafted certificate\noverflows a buffer.", DataSource: "debian", PublishedDate: "2024-01-02", Fingerprint: "f1"},
+			{ID: "CVE-2024-2", Severity: models.SeverityLow, Package: "zlib", Version: "1.2", Title: "-1 length"},
+		},
+	}
+	out, err := ScanCSV(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header, _, _ := strings.Cut(out, "\n"); header != "image,scanner,id,severity,package,version,fixed_version,title,description,data_source,published_date,fingerprint" {
+		t.Errorf("unexpected header row %q", header)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"app:dio", "trivy", "CVE-2024-1", "critical", "openssl", "3.0.1", "3.0.2, 3.1.1",
+			"Buffer overflow", "A crafted certificate\noverflows a buffer.", "debian", "2024-01-02", "f1"},
+		{"app:dio", "trivy", "CVE-2024-2", "low", "zlib", "1.2", "", "'-1 length", "", "", "", ""},
+	}
+	if len(rows) != 3 || !reflect.DeepEqual(rows[1:], want) {
+		t.Errorf("expected a header and one row per vulnerability, got %q", rows)
+	}
+
+	out, err = ScanCSV(&models.ScanResult{ImageName: "app:dio", Scanner: "grype"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out, "\n") != 1 {
+		t.Errorf("expected only the header without vulnerabilities, got:\n%s", out)
+	}
+}
@@ -0,0 +1,387 @@
+package reporter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/compliance"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// AnalysisMarkdown renders a standalone markdown report for a Dockerfile
+// analysis, without the build, scan and policy sections of the full report.
+func AnalysisMarkdown(result *models.AnalysisResult) string {
+	var sb strings.Builder
+	writeHeader(&sb, "🐳 DIO Analysis Report", "Dockerfile", result.Dockerfile)
+	writeAnalysisSection(&sb, result, nil)
+	writeFooter(&sb)
+	return sb.String()
+}
+
+// OptimizationMarkdown renders a standalone markdown report for the
+// optimizations suggested or applied to a Dockerfile.
+func OptimizationMarkdown(dockerfile string, result *models.OptimizationResult) string {
+	var sb strings.Builder
+	writeHeader(&sb, "🐳 DIO Optimization Report", "Dockerfile", dockerfile)
+	if len(result.Optimizations) == 0 {
+		sb.WriteString("No optimizations needed! 🎉\n\n")
+	} else {
+		writeOptimizationSection(&sb, result)
+	}
+	if result.OptimizedDockerfile != result.OriginalDockerfile {
+		sb.WriteString("### Optimized Dockerfile\n\n")
+		sb.WriteString("```dockerfile\n")
+		sb.WriteString(strings.TrimRight(result.OptimizedDockerfile, "\n"))
+		sb.WriteString("\n```\n\n")
+	}
+	writeFooter(&sb)
+	return sb.String()
+}
+
+// ScanMarkdown renders a standalone markdown report for a security scan,
+// listing every vulnerability rather than only the critical ones.
+func ScanMarkdown(result *models.ScanResult) string {
+	var sb strings.Builder
+	writeHeader(&sb, "🐳 DIO Scan Report", "Image", result.ImageName)
+	writeScanSection(&sb, result, true)
+	writeFooter(&sb)
+	return sb.String()
+}
+
+// SlimMarkdown renders a standalone markdown report for a minified image.
+func SlimMarkdown(result *models.SlimResult) string {
+	var sb strings.Builder
+	writeHeader(&sb, "🐳 DIO Slim Report", "Image", result.Source)
+	writeSlimSection(&sb, result)
+	writeFooter(&sb)
+	return sb.String()
+}
+
+// ComplianceMarkdown renders a standalone markdown report of the benchmark
+// controls a Dockerfile or image passes and fails.
+func ComplianceMarkdown(subjectLabel, subject string, result *models.ComplianceResult) string {
+	var sb strings.Builder
+	writeHeader(&sb, "🐳 DIO Compliance Report", subjectLabel, subject)
+	writeComplianceSection(&sb, result)
+	writeFooter(&sb)
+	return sb.String()
+}
+
+// ExplainMarkdown renders a standalone markdown report for a Dockerfile
+// reconstructed from an image's history: the Dockerfile, its largest
+// layers, and the analysis and optimizations of it.
+func ExplainMarkdown(result *models.ExplainResult) string {
+	var sb strings.Builder
+	writeHeader(&sb, "🐳 DIO Explain Report", "Image", result.Image)
+	sb.WriteString("## 🔎 Reconstructed Dockerfile\n\n")
+	if result.BaseImage == "" && result.BaseEntries > 0 {
+		sb.WriteString(fmt.Sprintf("The base image is not named in the history: %d entries, %s.\n\n",
+			result.BaseEntries, docker.HumanSize(result.BaseSize)))
+	}
+	sb.WriteString("```dockerfile\n")
+	sb.WriteString(strings.TrimRight(result.Dockerfile, "\n"))
+	sb.WriteString("\n```\n\n")
+	if len(result.Layers) > 0 {
+		layers := append([]models.ExplainedLayer(nil), result.Layers...)
+		sort.SliceStable(layers, func(i, j int) bool { return layers[i].Size > layers[j].Size })
+		sb.WriteString("| Line | Size | Instruction |\n")
+		sb.WriteString("|------|------|-------------|\n")
+		for _, l := range layers {
+			sb.WriteString(fmt.Sprintf("| %d | %s | `%s` |\n", l.Line, docker.HumanSize(l.Size), MarkdownCell(l.Instruction)))
+		}
+		sb.WriteString("\n")
+	}
+	if result.Analysis != nil {
+		writeAnalysisSection(&sb, result.Analysis, nil)
+	}
+	if result.Optimizations != nil && len(result.Optimizations.Optimizations) > 0 {
+		writeOptimizationSection(&sb, result.Optimizations)
+	}
+	writeFooter(&sb)
+	return sb.String()
+}
+
+func writeHeader(sb *strings.Builder, title, subjectLabel, subject string) {
+	sb.WriteString(fmt.Sprintf("# %s\n\n", title))
+	sb.WriteString(fmt.Sprintf("**Generated:** %s  \n", time.Now().Format(time.RFC1123)))
+	sb.WriteString(fmt.Sprintf("**%s:** `%s`\n\n", subjectLabel, subject))
+	sb.WriteString("---\n\n")
+}
+
+func writeFooter(sb *strings.Builder) {
+	sb.WriteString("---\n")
+	sb.WriteString("*Generated by [Docker Image Optimizer (DIO)](https://github.com/maxlar/docker-image-optimizer) by Moustafa Rakha (Maxlar)*\n")
+}
+
+// writeAnalysisSection writes the score, stages and issues. With the
+// optimization result, issues fixed by an optimization show whether it was
+// applied.
+func writeAnalysisSection(sb *strings.Builder, analysis *models.AnalysisResult, optimization *models.OptimizationResult) {
+	sb.WriteString("## 🔍 Dockerfile Analysis\n\n")
+	sb.WriteString(fmt.Sprintf("**Score:** %d/100\n\n", analysis.Score))
+	if analysis.ImageKind != "" {
+		adjusted := 0
+		for _, issue := range analysis.Issues {
+			if issue.DefaultSeverity != "" {
+				adjusted++
+			}
+		}
+		detected := ""
+		if len(analysis.ImageKindReasons) > 0 {
+			detected = fmt.Sprintf(", detected: %s", strings.Join(analysis.ImageKindReasons, ", "))
+		}
+		sb.WriteString(fmt.Sprintf("**Image kind:** %s (%d issue severities adjusted%s)\n\n", analysis.ImageKind, adjusted, detected))
+	}
+
+	if len(analysis.Stages) > 1 {
+		sb.WriteString("| Stage | Base Image | Line | Issues |\n")
+		sb.WriteString("|-------|------------|------|--------|\n")
+		for _, stage := range analysis.Stages {
+			name := stage.Name
+			if stage.Final && analysis.Target != "" {
+				name += " (target)"
+			} else if stage.Final {
+				name += " (final)"
+			}
+			sb.WriteString(fmt.Sprintf("| %s | `%s` | %d | %d |\n",
+				MarkdownCell(name), stage.BaseImage, stage.StartLine, stage.Issues))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(analysis.Artifacts) > 0 {
+		sb.WriteString("**Artifacts copied between stages:**\n\n")
+		sb.WriteString("| From | To | Sources | Destination | Line | In Final Image |\n")
+		sb.WriteString("|------|----|---------|-------------|------|----------------|\n")
+		for _, a := range analysis.Artifacts {
+			final := "✅"
+			if !a.ReachesFinal {
+				final = "❌ unused"
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | `%s` | `%s` | %d | %s |\n",
+				MarkdownCell(a.From), MarkdownCell(a.To), strings.Join(a.Sources, "`, `"), a.Dest, a.Line, final))
+		}
+		sb.WriteString("\n")
+	}
+
+	linked := false
+	for _, issue := range analysis.Issues {
+		linked = linked || issue.FixedByOptimization != ""
+	}
+	if len(analysis.Issues) > 0 {
+		if linked {
+			sb.WriteString("| Severity | ID | Line | Issue | Suggestion | Fixed By |\n")
+			sb.WriteString("|----------|----|------|-------|------------|----------|\n")
+		} else {
+			sb.WriteString("| Severity | ID | Line | Issue | Suggestion |\n")
+			sb.WriteString("|----------|----|------|-------|------------|\n")
+		}
+		for _, issue := range analysis.Issues {
+			line := ""
+			if issue.Line > 0 {
+				line = fmt.Sprintf("%d", issue.Line)
+			}
+			sev := string(issue.Severity)
+			if issue.DefaultSeverity != "" {
+				sev += fmt.Sprintf(" (was %s)", issue.DefaultSeverity)
+			}
+			sb.WriteString(fmt.Sprintf("| %s %s | %s | %s | %s | %s |",
+				severityIcon(issue.Severity), sev, issueLink(issue), line,
+				MarkdownCell(issue.Title), MarkdownCell(issue.Suggestion)))
+			if linked {
+				sb.WriteString(fmt.Sprintf(" %s |", fixedBy(issue, optimization)))
+			}
+			sb.WriteString("\n")
+		}
+	} else {
+		sb.WriteString("No issues found! 🎉\n")
+	}
+	sb.WriteString("\n")
+}
+
+// writeScanSection writes the CVE counts and a vulnerability table: every
+// vulnerability when detailed is set, otherwise only the critical ones.
+func writeScanSection(sb *strings.Builder, scan *models.ScanResult, detailed bool) {
+	sb.WriteString("## 🔒 Security Scan\n\n")
+	sb.WriteString(fmt.Sprintf("**Scanner:** %s\n\n", scan.Scanner))
+	sb.WriteString(fmt.Sprintf("- 🔴 Critical: %d\n", scan.CriticalCount))
+	sb.WriteString(fmt.Sprintf("- 🟠 High: %d\n", scan.HighCount))
+	sb.WriteString(fmt.Sprintf("- 🟡 Medium: %d\n", scan.MediumCount))
+	sb.WriteString(fmt.Sprintf("- 🔵 Low: %d\n", scan.LowCount))
+
+	if detailed && len(scan.Vulnerabilities) > 0 {
+		vulns := append([]models.Vulnerability(nil), scan.Vulnerabilities...)
+		sort.SliceStable(vulns, func(i, j int) bool {
+			return vulns[i].Severity.Rank() > vulns[j].Severity.Rank()
+		})
+		sb.WriteString("\n### Vulnerabilities\n\n")
+		sb.WriteString("| Severity | CVE | Package | Version | Fixed Version | Title |\n")
+		sb.WriteString("|----------|-----|---------|---------|---------------|-------|\n")
+		for _, v := range vulns {
+			sb.WriteString(fmt.Sprintf("| %s %s | %s | %s | %s | %s | %s |\n",
+				severityIcon(v.Severity), v.Severity, v.ID, v.Package, v.Version, v.FixedVersion, MarkdownCell(v.Title)))
+		}
+	} else if scan.CriticalCount > 0 {
+		sb.WriteString("\n### Critical Vulnerabilities\n\n")
+		sb.WriteString("| CVE | Package | Version | Fixed Version |\n")
+		sb.WriteString("|-----|---------|---------|---------------|\n")
+		for _, v := range scan.Vulnerabilities {
+			if v.Severity == models.SeverityCritical {
+				sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+					v.ID, v.Package, v.Version, v.FixedVersion))
+			}
+		}
+	}
+
+	if len(scan.SecretsFound) > 0 {
+		sb.WriteString("\n### Secrets\n\n")
+		sb.WriteString("| Severity | Type | Path |\n")
+		sb.WriteString("|----------|------|------|\n")
+		for _, s := range scan.SecretsFound {
+			sb.WriteString(fmt.Sprintf("| %s | %s | `%s` |\n", s.Severity, MarkdownCell(s.Type), s.Path))
+		}
+	}
+	sb.WriteString("\n")
+}
+
+// fixedBy describes the optimization that fixes an issue, e.g.
+// "OPT-CLEANUP (applied)". Without the optimization result, it only names
+// the optimization as an autofix.
+func fixedBy(issue models.Issue, optimization *models.OptimizationResult) string {
+	if issue.FixedByOptimization == "" {
+		return ""
+	}
+	status := "autofix"
+	if optimization != nil {
+		status = "not applied"
+		for _, opt := range optimization.Optimizations {
+			if opt.ID == issue.FixedByOptimization && opt.Applied {
+				status = "applied"
+				break
+			}
+		}
+	}
+	return fmt.Sprintf("%s (%s)", issue.FixedByOptimization, status)
+}
+
+func writeOptimizationSection(sb *strings.Builder, optimization *models.OptimizationResult) {
+	sb.WriteString("## ⚡ Optimizations\n\n")
+	for _, opt := range optimization.Optimizations {
+		status := "💡"
+		if opt.Applied {
+			status = "✅"
+		}
+		impact := opt.Impact
+		switch opt.Confidence {
+		case models.ConfidenceLow:
+			impact += "; ⚠️ low confidence, often needs changes to build"
+		case "":
+		default:
+			impact += "; " + opt.Confidence + " confidence"
+		}
+		if len(opt.RelatedIssueIDs) > 0 {
+			impact += "; fixes " + strings.Join(opt.RelatedIssueIDs, ", ")
+		}
+		if opt.Rejected != "" {
+			impact += "; ⚠️ not applied, the fix produced an invalid Dockerfile: " + opt.Rejected
+		}
+		sb.WriteString(fmt.Sprintf("- %s **%s** — %s (Impact: %s)\n",
+			status, opt.Title, opt.Description, impact))
+	}
+	sb.WriteString("\n")
+	if optimization.EstimatedReduction != "" {
+		sb.WriteString(fmt.Sprintf("**Estimated reduction:** %s\n\n", optimization.EstimatedReduction))
+	}
+}
+
+// writeAnalysisDiffSection writes the score before and after autofix and
+// the issues it resolved or introduced.
+func writeAnalysisDiffSection(sb *strings.Builder, diff *models.AnalysisDiff) {
+	sb.WriteString("## 🔁 After Autofix\n\n")
+	sb.WriteString(fmt.Sprintf("**Score:** %d/100 → %d/100 (%+d)\n\n",
+		diff.ScoreBefore, diff.ScoreAfter, diff.ScoreAfter-diff.ScoreBefore))
+	for _, issue := range diff.ResolvedIssues {
+		sb.WriteString(fmt.Sprintf("- ✅ Resolved %s: %s%s\n", issueLink(issue), issue.Title, lineSuffix(issue)))
+	}
+	for _, issue := range diff.NewIssues {
+		sb.WriteString(fmt.Sprintf("- ⚠️ New %s: %s%s\n", issueLink(issue), issue.Title, lineSuffix(issue)))
+	}
+	if len(diff.ResolvedIssues) == 0 && len(diff.NewIssues) == 0 {
+		sb.WriteString("Autofix didn't change which rules fire.\n")
+	}
+	sb.WriteString("\n")
+}
+
+// writeComplianceSection writes the controls by framework, with what
+// fails them or why they don't apply.
+func writeComplianceSection(sb *strings.Builder, result *models.ComplianceResult) {
+	sb.WriteString("## 🛡️ Compliance\n\n")
+	sb.WriteString(fmt.Sprintf("**%d passed, %d failed, %d not applicable**\n\n", result.Passed, result.Failed, result.NotApplicable))
+	framework := ""
+	for _, c := range result.Controls {
+		if c.Framework != framework {
+			if framework != "" {
+				sb.WriteString("\n")
+			}
+			framework = c.Framework
+			name := compliance.FrameworkNames[framework]
+			if name == "" {
+				name = framework
+			}
+			sb.WriteString(fmt.Sprintf("### %s\n\n", name))
+			sb.WriteString("| Control | Status | Title | Findings |\n")
+			sb.WriteString("|---------|--------|-------|----------|\n")
+		}
+		status := "✅ pass"
+		switch c.Status {
+		case models.ControlFail:
+			status = "❌ fail"
+		case models.ControlNotApplicable:
+			status = "➖ n/a"
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n", c.ID, status, c.Title, MarkdownCell(strings.Join(c.Findings, "; "))))
+	}
+	sb.WriteString("\n")
+}
+
+// lineSuffix returns " (line N)" for issues with a line number.
+func lineSuffix(issue models.Issue) string {
+	if issue.Line <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (line %d)", issue.Line)
+}
+
+func writeSlimSection(sb *strings.Builder, result *models.SlimResult) {
+	sb.WriteString("## 🪶 Slim\n\n")
+	sb.WriteString(fmt.Sprintf("`%s` was minified with %s into `%s`, keeping only the files used at runtime.\n\n",
+		result.Source, result.Tool, result.Image.ImageName))
+	sb.WriteString("| Metric | Original | Minified | Change |\n")
+	sb.WriteString("|--------|----------|----------|--------|\n")
+	sb.WriteString(fmt.Sprintf("| Size | %s | %s | %s |\n",
+		docker.HumanSize(result.Image.Size-result.SizeDiff), result.Image.SizeHuman, signedSize(result.SizeDiff)))
+	sb.WriteString(fmt.Sprintf("| Removed | | | %d files, %s |\n\n", result.RemovedFiles, docker.HumanSize(result.RemovedBytes)))
+	if scan := result.Scan; scan != nil {
+		sb.WriteString(fmt.Sprintf("**Minified image CVEs:** %d critical, %d high, %d medium, %d low\n\n",
+			scan.CriticalCount, scan.HighCount, scan.MediumCount, scan.LowCount))
+	}
+	if len(result.Removed) > 0 {
+		sb.WriteString("### Removed Content\n\n")
+		sb.WriteString("| Directory | Files | Size |\n")
+		sb.WriteString("|-----------|-------|------|\n")
+		for _, p := range result.Removed {
+			sb.WriteString(fmt.Sprintf("| `%s` | %d | %s |\n", MarkdownCell(p.Path), p.Files, docker.HumanSize(p.Bytes)))
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// MarkdownCell escapes text for use inside a markdown table cell, keeping
+// it on one row.
+func MarkdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
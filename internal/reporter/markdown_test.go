@@ -0,0 +1,118 @@
+package reporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// assertContains fails for each of want missing from the report.
+func assertContains(t *testing.T, report string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(report, w) {
+			t.Errorf("expected %q in the report, got:\n%s", w, report)
+		}
+	}
+}
+
+func TestAnalysisMarkdown(t *testing.T) {
+	result := &models.AnalysisResult{
+		Dockerfile: "services/api/Dockerfile",
+		Score:      64,
+		Stages: []models.StageResult{
+			{Name: "build", BaseImage: "golang:1.22", StartLine: 1, Issues: 1},
+			{Name: "stage 1", BaseImage: "debian:12", StartLine: 5, Final: true, Issues: 2},
+		},
+		Issues: []models.Issue{
+			{ID: "DIO001", Severity: models.SeverityHigh, Title: "Unpinned base image", Line: 5, Suggestion: "Pin debian:12 to a digest", DocsURL: "https://example.com/rules#dio001"},
+			{ID: "DIO002", Severity: models.SeverityMedium, Title: "No .dockerignore", Suggestion: "Add node_modules | .git to .dockerignore"},
+			{ID: "DIO006", Severity: models.SeverityLow, DefaultSeverity: models.SeverityHigh, Title: "Runs as root", Line: 8, Suggestion: "Add a USER\ninstruction"},
+		},
+	}
+	md := AnalysisMarkdown(result)
+	assertContains(t, md,
+		"# 🐳 DIO Analysis Report\n",
+		"**Dockerfile:** `services/api/Dockerfile`\n",
+		"**Score:** 64/100\n",
+		"| build | `golang:1.22` | 1 | 1 |\n",
+		"| stage 1 (final) | `debian:12` | 5 | 2 |\n",
+		"| 🟠 high | [DIO001](https://example.com/rules#dio001) | 5 | Unpinned base image | Pin debian:12 to a digest |\n",
+		"| 🟡 medium | DIO002 |  | No .dockerignore | Add node_modules \\| .git to .dockerignore |\n",
+		"| 🔵 low (was high) | DIO006 | 8 | Runs as root | Add a USER instruction |\n",
+	)
+	if strings.Contains(md, "Fixed By") {
+		t.Errorf("expected no Fixed By column without linked optimizations, got:\n%s", md)
+	}
+	if strings.Contains(md, "## 🔒") || strings.Contains(md, "## ⚡") {
+		t.Errorf("expected only the analysis section, got:\n%s", md)
+	}
+
+	md = AnalysisMarkdown(&models.AnalysisResult{Dockerfile: "Dockerfile", Score: 100})
+	assertContains(t, md, "No issues found! 🎉\n")
+	if strings.Contains(md, "| Stage |") {
+		t.Errorf("expected no stage table for a single stage, got:\n%s", md)
+	}
+}
+
+func TestOptimizationMarkdown(t *testing.T) {
+	result := &models.OptimizationResult{
+		OriginalDockerfile:  "FROM node:20\nRUN npm install\n",
+		OptimizedDockerfile: "FROM node:20-slim\nRUN npm ci\n",
+		Optimizations: []models.Optimization{
+			{ID: "OPT-BASE-IMAGE", Title: "Use a slim base image", Description: "node:20 ships build tools.", Impact: "-700MB", Confidence: models.ConfidenceHigh, RelatedIssueIDs: []string{"DIO003"}, Applied: true},
+			{ID: "OPT-MULTISTAGE", Title: "Use a multi-stage build", Description: "Build tools stay behind.", Impact: "-200MB", Confidence: models.ConfidenceLow},
+			{ID: "OPT-CLEANUP", Title: "Clean the npm cache", Description: "The cache is kept.", Impact: "-50MB", Rejected: "line 2: unterminated quote"},
+		},
+		EstimatedReduction: "40-60%",
+	}
+	md := OptimizationMarkdown("Dockerfile", result)
+	assertContains(t, md,
+		"# 🐳 DIO Optimization Report\n",
+		"- ✅ **Use a slim base image** — node:20 ships build tools. (Impact: -700MB; high confidence; fixes DIO003)\n",
+		"- 💡 **Use a multi-stage build** — Build tools stay behind. (Impact: -200MB; ⚠️ low confidence, often needs changes to build)\n",
+		"- 💡 **Clean the npm cache** — The cache is kept. (Impact: -50MB; ⚠️ not applied, the fix produced an invalid Dockerfile: line 2: unterminated quote)\n",
+		"**Estimated reduction:** 40-60%\n",
+		"### Optimized Dockerfile\n\n```dockerfile\nFROM node:20-slim\nRUN npm ci\n```\n",
+	)
+
+	md = OptimizationMarkdown("Dockerfile", &models.OptimizationResult{OriginalDockerfile: "FROM scratch\n", OptimizedDockerfile: "FROM scratch\n"})
+	assertContains(t, md, "No optimizations needed! 🎉\n")
+	if strings.Contains(md, "### Optimized Dockerfile") {
+		t.Errorf("expected no optimized Dockerfile when nothing changed, got:\n%s", md)
+	}
+}
+
+func TestScanMarkdown(t *testing.T) {
+	result := &models.ScanResult{
+		ImageName:     "app:dio",
+		Scanner:       "trivy",
+		CriticalCount: 1,
+		HighCount:     1,
+		LowCount:      1,
+		Vulnerabilities: []models.Vulnerability{
+			{ID: "CVE-2024-3", Package: "zlib", Version: "1.2", Severity: models.SeverityLow, Title: "Minor | issue"},
+			{ID: "CVE-2024-1", Package: "openssl", Version: "3.0.1", FixedVersion: "3.0.2", Severity: models.SeverityCritical, Title: "Buffer overflow"},
+			{ID: "CVE-2024-2", Package: "curl", Version: "8.0", FixedVersion: "8.1", Severity: models.SeverityHigh, Title: "Header\ninjection"},
+		},
+		SecretsFound: []models.Secret{{Severity: "HIGH", Type: "AWS access key", Path: "/app/.env"}},
+	}
+	md := ScanMarkdown(result)
+	assertContains(t, md,
+		"# 🐳 DIO Scan Report\n",
+		"**Image:** `app:dio`\n",
+		"**Scanner:** trivy\n",
+		"- 🔴 Critical: 1\n- 🟠 High: 1\n- 🟡 Medium: 0\n- 🔵 Low: 1\n",
+		"| Severity | CVE | Package | Version | Fixed Version | Title |\n",
+		"| HIGH | AWS access key | `/app/.env` |\n",
+	)
+	// Every vulnerability is listed, most severe first
+	want := "| 🔴 critical | CVE-2024-1 | openssl | 3.0.1 | 3.0.2 | Buffer overflow |\n" +
+		"| 🟠 high | CVE-2024-2 | curl | 8.0 | 8.1 | Header injection |\n" +
+		"| 🔵 low | CVE-2024-3 | zlib | 1.2 |  | Minor \\| issue |\n"
+	assertContains(t, md, want)
+	if strings.Contains(md, "### Critical Vulnerabilities") {
+		t.Errorf("expected the detailed table instead of the critical one, got:\n%s", md)
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
 )
 
 // Format represents the output format of a report.
@@ -51,6 +54,23 @@ func (r *Reporter) WriteReport(content string, filename string) error {
 	return os.WriteFile(path, []byte(content), 0o644)
 }
 
+// LoadResult reads a JSON report written by a previous run. It returns nil
+// without an error when the report doesn't exist.
+func LoadResult(path string) (*models.PipelineResult, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result models.PipelineResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid report %s: %w", path, err)
+	}
+	return &result, nil
+}
+
 // GenerateAll generates both markdown and JSON reports.
 func (r *Reporter) GenerateAll(result *models.PipelineResult) error {
 	md, err := r.generateMarkdown(result)
@@ -79,16 +99,45 @@ func (r *Reporter) generateMarkdown(result *models.PipelineResult) (string, erro
 
 	sb.WriteString("# 🐳 Docker Image Optimizer Report\n\n")
 	sb.WriteString(fmt.Sprintf("**Generated:** %s  \n", result.Timestamp.Format(time.RFC1123)))
-	sb.WriteString(fmt.Sprintf("**Dockerfile:** `%s`\n\n", result.Dockerfile))
+	if result.Image != "" {
+		sb.WriteString(fmt.Sprintf("**Image:** `%s`\n\n", result.Image))
+	} else {
+		sb.WriteString(fmt.Sprintf("**Dockerfile:** `%s`  \n", result.Dockerfile))
+		if g := result.Git; g != nil {
+			sb.WriteString(fmt.Sprintf("**Commit:** `%s`%s  \n", g.Commit, gitState(g)))
+			if g.DockerfileChanged != nil {
+				sb.WriteString(fmt.Sprintf("**Dockerfile last changed:** %s (oldest line: %s)  \n",
+					g.DockerfileChanged.Format("2006-01-02"), g.DockerfileOldestLine.Format("2006-01-02")))
+			}
+		}
+		sb.WriteString("\n")
+	}
 
 	// Summary
 	sb.WriteString("---\n\n")
-	if result.Policy != nil && result.Policy.Passed {
+	if result.Policy != nil && result.Policy.Override != nil {
+		sb.WriteString("## ⚠️ Result: OVERRIDDEN\n\n")
+		sb.WriteString(fmt.Sprintf("> **Break-glass override** by %s at %s: %s  \n> Overridden rules: %s\n\n",
+			overrideUser(result.Policy.Override), result.Policy.Override.Timestamp.Format(time.RFC3339),
+			result.Policy.Override.Reason, strings.Join(result.Policy.Override.FailedRules, ", ")))
+	} else if result.Policy != nil && result.Policy.Passed {
 		sb.WriteString("## ✅ Result: PASSED\n\n")
 	} else if result.Policy != nil {
 		sb.WriteString("## ❌ Result: FAILED\n\n")
 	}
 
+	// Steps that were skipped or failed
+	if len(result.Errors) > 0 {
+		sb.WriteString("## ⚠️ Partial Results\n\n")
+		sb.WriteString("The pipeline went on without these steps, so the sections below may be incomplete.\n\n")
+		sb.WriteString("| Step | Status | Error |\n")
+		sb.WriteString("|------|--------|-------|\n")
+		for _, e := range result.Errors {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s |\n", e.Step, e.Kind, MarkdownCell(e.Message)))
+		}
+		sb.WriteString("\n")
+	}
+
 	// Comparison
 	if result.Comparison != nil {
 		sb.WriteString("## 📊 Comparison\n\n")
@@ -106,6 +155,18 @@ func (r *Reporter) generateMarkdown(result *models.PipelineResult) (string, erro
 			sb.WriteString(fmt.Sprintf("| CVEs | - | - | -%d |\n", result.Comparison.CVEDiff))
 		}
 		sb.WriteString("\n")
+	} else if est := result.BaselineEstimate; est != nil {
+		sb.WriteString("## 📊 Comparison (estimated)\n\n")
+		sb.WriteString("The baseline image was not built; the comparison uses the registry (compressed) sizes of the final base images.\n\n")
+		sb.WriteString("| Metric | Baseline | Optimized | Change |\n")
+		sb.WriteString("|--------|----------|-----------|--------|\n")
+		sb.WriteString(fmt.Sprintf("| Base image | `%s` | `%s` | |\n", est.BaseImage, est.OptimizedBaseImage))
+		sb.WriteString(fmt.Sprintf("| Base image size | %s | %s | %s |\n",
+			docker.HumanSize(est.BaseImageSize), docker.HumanSize(est.OptimizedBaseImageSize), signedSize(-est.SizeDiff)))
+		if img := result.OptimizedImage; img != nil {
+			sb.WriteString(fmt.Sprintf("| Image size | - | %s | |\n", img.SizeHuman))
+		}
+		sb.WriteString("\n")
 	} else if result.BaselineImage != nil {
 		sb.WriteString("## 📊 Image Metrics\n\n")
 		sb.WriteString(fmt.Sprintf("- **Size:** %s\n", result.BaselineImage.SizeHuman))
@@ -114,84 +175,394 @@ func (r *Reporter) generateMarkdown(result *models.PipelineResult) (string, erro
 		sb.WriteString("\n")
 	}
 
-	// Analysis
-	if result.Analysis != nil {
-		sb.WriteString("## 🔍 Dockerfile Analysis\n\n")
-		sb.WriteString(fmt.Sprintf("**Score:** %d/100\n\n", result.Analysis.Score))
-
-		if len(result.Analysis.Issues) > 0 {
-			sb.WriteString("| Severity | ID | Issue | Suggestion |\n")
-			sb.WriteString("|----------|----|-------|------------|\n")
-			for _, issue := range result.Analysis.Issues {
-				icon := severityIcon(issue.Severity)
-				sb.WriteString(fmt.Sprintf("| %s %s | %s | %s | %s |\n",
-					icon, issue.Severity, issue.ID, issue.Title, issue.Suggestion))
+	if c := result.CostImpact; c != nil {
+		sb.WriteString("## 💰 Cost Impact\n\n")
+		sizes := "uncompressed sizes, which registries compress"
+		if c.Compressed {
+			sizes = "compressed sizes"
+		}
+		sb.WriteString(fmt.Sprintf("Monthly registry costs of a size change of %s (%s), pulled %s times a day.\n\n",
+			signedSize(-c.SizeDiff), sizes, strconv.FormatFloat(c.PullsPerDay, 'f', -1, 64)))
+		sb.WriteString("| Cost | Monthly savings |\n")
+		sb.WriteString("|------|-----------------|\n")
+		sb.WriteString(fmt.Sprintf("| Storage | %s |\n", money(c.Storage, c.Currency)))
+		sb.WriteString(fmt.Sprintf("| Egress | %s |\n", money(c.Egress, c.Currency)))
+		sb.WriteString(fmt.Sprintf("| **Total** | **%s** |\n", money(c.Total, c.Currency)))
+		sb.WriteString("\n")
+	}
+
+	if fp := result.Footprint; fp != nil {
+		sizes := "uncompressed sizes, which registries compress"
+		if fp.Compressed {
+			sizes = "compressed sizes"
+		}
+		sb.WriteString("## 🌱 Energy and Carbon Footprint\n\n")
+		sb.WriteString(fmt.Sprintf("Monthly registry energy of a size change of %s (%s), pulled %s times a day.\n\n",
+			signedSize(-fp.SizeDiff), sizes, strconv.FormatFloat(fp.PullsPerDay, 'f', -1, 64)))
+		sb.WriteString("| Source | Monthly savings |\n")
+		sb.WriteString("|--------|-----------------|\n")
+		sb.WriteString(fmt.Sprintf("| Transfers | %.2f kWh |\n", fp.TransferKWh))
+		sb.WriteString(fmt.Sprintf("| Storage | %.2f kWh |\n", fp.StorageKWh))
+		sb.WriteString(fmt.Sprintf("| **Total** | **%.2f kWh, %.2f kg CO2e** |\n\n", fp.TotalKWh, fp.CO2eKg))
+		sb.WriteString(fmt.Sprintf("_Coefficients: %s kWh per GB transferred, %s kWh per GB stored a month, %s gCO2e per kWh._\n\n",
+			strconv.FormatFloat(fp.TransferKWhPerGB, 'f', -1, 64), strconv.FormatFloat(fp.StorageKWhPerGB, 'f', -1, 64),
+			strconv.FormatFloat(fp.GridIntensity, 'f', -1, 64)))
+	}
+
+	// Size budgets
+	if img := result.FinalImage(); img != nil && (img.CompressedSize > 0 || result.PreviousImage != nil) {
+		if img.CompressedSize > 0 {
+			sb.WriteString(fmt.Sprintf("- **Compressed size:** %s\n", docker.HumanSize(img.CompressedSize)))
+		}
+		if prev := result.PreviousImage; prev != nil {
+			sb.WriteString(fmt.Sprintf("- **Previous run:** %s (%s)\n", prev.SizeHuman, signedSize(img.Size-prev.Size)))
+		}
+		sb.WriteString("\n")
+	}
+	if len(result.StageImages) > 0 {
+		stages := make([]string, 0, len(result.StageImages))
+		for stage := range result.StageImages {
+			stages = append(stages, stage)
+		}
+		sort.Strings(stages)
+		sb.WriteString("| Stage | Size | Layers |\n")
+		sb.WriteString("|-------|------|--------|\n")
+		for _, stage := range stages {
+			img := result.StageImages[stage]
+			sb.WriteString(fmt.Sprintf("| %s | %s | %d |\n", stage, img.SizeHuman, img.Layers))
+		}
+		sb.WriteString("\n")
+	}
+
+	// Build failures
+	for _, build := range result.Builds {
+		if !build.Failed {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("## 🧱 Build Failed: %s\n\n", build.Name))
+		for _, d := range build.Diagnoses {
+			if d.Line > 0 {
+				sb.WriteString(fmt.Sprintf("- **Line %d** `%s`: %s\n  → %s\n", d.Line, d.Instruction, d.Message, d.Hint))
+			} else {
+				sb.WriteString(fmt.Sprintf("- %s\n  → %s\n", d.Message, d.Hint))
 			}
-		} else {
-			sb.WriteString("No issues found! 🎉\n")
+		}
+		if len(build.Diagnoses) == 0 {
+			sb.WriteString("No known cause was recognized in the build output.\n")
+		}
+		lines := strings.Split(strings.TrimRight(build.Output, "\n"), "\n")
+		if len(lines) > 20 {
+			lines = lines[len(lines)-20:]
+		}
+		sb.WriteString("\n<details><summary>Build output (last lines)</summary>\n\n```\n")
+		sb.WriteString(strings.Join(lines, "\n"))
+		sb.WriteString("\n```\n</details>\n\n")
+	}
+
+	// Binaries
+	if len(result.Binaries) > 0 {
+		sb.WriteString("## 🔗 Binaries\n\n")
+		sb.WriteString("| Binary | Language | Linking | Loader |\n")
+		sb.WriteString("|--------|----------|---------|--------|\n")
+		for _, bin := range result.Binaries {
+			linking, loader := "static", "-"
+			if !bin.Static {
+				linking = "dynamic"
+				if len(bin.Libraries) > 0 {
+					linking += " (" + strings.Join(bin.Libraries, ", ") + ")"
+				}
+				loader = "`" + bin.Interpreter + "`"
+				if bin.MissingInterpreter {
+					loader += " ❌ missing"
+				}
+			}
+			sb.WriteString(fmt.Sprintf("| `%s` | %s | %s | %s |\n", bin.Path, bin.Language, linking, loader))
 		}
 		sb.WriteString("\n")
 	}
 
-	// Security Scan
-	if result.ScanResult != nil {
-		sb.WriteString("## 🔒 Security Scan\n\n")
-		sb.WriteString(fmt.Sprintf("**Scanner:** %s\n\n", result.ScanResult.Scanner))
-		sb.WriteString(fmt.Sprintf("- 🔴 Critical: %d\n", result.ScanResult.CriticalCount))
-		sb.WriteString(fmt.Sprintf("- 🟠 High: %d\n", result.ScanResult.HighCount))
-		sb.WriteString(fmt.Sprintf("- 🟡 Medium: %d\n", result.ScanResult.MediumCount))
-		sb.WriteString(fmt.Sprintf("- 🔵 Low: %d\n", result.ScanResult.LowCount))
-
-		if result.ScanResult.CriticalCount > 0 {
-			sb.WriteString("\n### Critical Vulnerabilities\n\n")
-			sb.WriteString("| CVE | Package | Version | Fixed Version |\n")
-			sb.WriteString("|-----|---------|---------|---------------|\n")
-			for _, v := range result.ScanResult.Vulnerabilities {
-				if v.Severity == models.SeverityCritical {
-					sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
-						v.ID, v.Package, v.Version, v.FixedVersion))
+	// Setuid and setgid files
+	if len(result.SetIDFiles) > 0 {
+		sb.WriteString("## 🔐 Setuid and Setgid Files\n\n")
+		sb.WriteString("A process running these files gains the privileges of their owner or group. Remove the bits that aren't needed (`chmod a-s`), or run the container with `allowPrivilegeEscalation: false` (`--security-opt no-new-privileges`).\n\n")
+		sb.WriteString("| File | Mode | Bits |\n")
+		sb.WriteString("|------|------|------|\n")
+		for _, f := range result.SetIDFiles {
+			var bits []string
+			if f.Setuid {
+				bits = append(bits, "setuid")
+			}
+			if f.Setgid {
+				bits = append(bits, "setgid")
+			}
+			sb.WriteString(fmt.Sprintf("| `%s` | %s | %s |\n", f.Path, f.Mode, strings.Join(bits, ", ")))
+		}
+		sb.WriteString("\n")
+	}
+
+	// Duplicated layer data
+	if len(result.LayerDuplicates) > 0 {
+		sb.WriteString("## 🪞 Duplicated Layer Data\n\n")
+		sb.WriteString("These layers store files an earlier layer holds already, as a `chown -R` or `chmod -R` of copied files does: changing a file's owner or mode writes all of it again. Set them while copying with `COPY --chown` or `--chmod` (DIO041).\n\n")
+		sb.WriteString("| Layer | Created by | Files | Size | Files first added by |\n")
+		sb.WriteString("|-------|------------|-------|------|----------------------|\n")
+		for _, dup := range result.LayerDuplicates {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %d | %s | %s |\n",
+				layerRef(dup.Layer, dup.Line), createdByCell(dup.CreatedBy), dup.Files, docker.HumanSize(dup.Bytes),
+				strings.TrimSpace(layerRef(dup.SourceLayer, dup.SourceLine)+" "+createdByCell(dup.SourceCreatedBy))))
+		}
+		sb.WriteString("\n")
+	}
+
+	// Reproducibility
+	if repro := result.Reproducibility; repro != nil {
+		sb.WriteString("## 🔁 Reproducibility\n\n")
+		epoch := "without `SOURCE_DATE_EPOCH`"
+		if repro.SourceDateEpoch != "" {
+			epoch = fmt.Sprintf("with `SOURCE_DATE_EPOCH=%s`", repro.SourceDateEpoch)
+		}
+		if repro.Reproducible {
+			sb.WriteString(fmt.Sprintf("Two rebuilds without the build cache, %s, gave the same image `%s`.\n\n", epoch, repro.ImageIDs[0]))
+		} else {
+			sb.WriteString(fmt.Sprintf("Two rebuilds without the build cache, %s, differ: `%s` and `%s`.\n\n", epoch, repro.ImageIDs[0], repro.ImageIDs[1]))
+			if len(repro.ConfigFields) > 0 {
+				fields := make([]string, len(repro.ConfigFields))
+				for i, f := range repro.ConfigFields {
+					fields[i] = "`" + f + "`"
+				}
+				sb.WriteString(fmt.Sprintf("**Config fields:** %s\n\n", strings.Join(fields, ", ")))
+			}
+			if len(repro.Layers) > 0 {
+				sb.WriteString("| Layer | Created by | Files | First files |\n")
+				sb.WriteString("|-------|------------|-------|-------------|\n")
+				for _, layer := range repro.Layers {
+					files := make([]string, len(layer.Files))
+					for i, f := range layer.Files {
+						files[i] = "`" + f + "`"
+					}
+					if len(files) > 5 {
+						files = append(files[:5], "…")
+					}
+					sb.WriteString(fmt.Sprintf("| %d | %s | %d | %s |\n", layer.Layer, createdByCell(layer.CreatedBy), layer.Changed, strings.Join(files, ", ")))
 				}
+				sb.WriteString("\n")
+			}
+		}
+	}
+
+	// Attestations
+	if att := result.Attestations; att != nil {
+		sb.WriteString("## 🔏 Attestations\n\n")
+		sb.WriteString("Stored next to this report, under `attestations/`.\n\n")
+		if att.Provenance != "" {
+			sb.WriteString(fmt.Sprintf("- **Provenance:** [%s](attestations/%s) (`%s`)\n", filepath.Base(att.Provenance), filepath.Base(att.Provenance), att.PredicateType))
+			if att.BuilderID != "" {
+				sb.WriteString(fmt.Sprintf("- **Builder:** `%s`\n", att.BuilderID))
+			}
+			for _, m := range att.Materials {
+				sb.WriteString(fmt.Sprintf("- **Material:** `%s`\n", m))
 			}
 		}
+		for _, sbom := range att.SBOMs {
+			sb.WriteString(fmt.Sprintf("- **SBOM:** [%s](attestations/%s)\n", filepath.Base(sbom), filepath.Base(sbom)))
+		}
 		sb.WriteString("\n")
 	}
 
-	// Optimizations
-	if result.Optimization != nil && len(result.Optimization.Optimizations) > 0 {
-		sb.WriteString("## ⚡ Optimizations\n\n")
-		for _, opt := range result.Optimization.Optimizations {
-			status := "💡"
-			if opt.Applied {
-				status = "✅"
+	// Stripped docs
+	if strip := result.StripDocs; strip != nil {
+		sb.WriteString("## 📚 Stripped Documentation\n\n")
+		dirs := make([]string, len(strip.Dirs))
+		for i, dir := range strip.Dirs {
+			dirs[i] = "`" + dir + "`"
+		}
+		sb.WriteString(fmt.Sprintf("%s hold %s in the baseline image and %s in the optimized image: %s saved.\n\n",
+			strings.Join(dirs, ", "), docker.HumanSize(strip.BaselineBytes), docker.HumanSize(strip.OptimizedBytes), docker.HumanSize(strip.Saved())))
+	}
+
+	// Squash
+	if sq := result.Squash; sq != nil {
+		sb.WriteString("## 🗜️ Squash\n\n")
+		if sq.Squashed {
+			sb.WriteString(fmt.Sprintf("`%s` was squashed into `%s`: %s.\n\n", sq.Source, sq.Image.ImageName, sq.Reason))
+			sb.WriteString("| Metric | Before | Squashed | Change |\n")
+			sb.WriteString("|--------|--------|----------|--------|\n")
+			sb.WriteString(fmt.Sprintf("| Size | %s | %s | %s |\n",
+				docker.HumanSize(sq.Image.Size-sq.SizeDiff), sq.Image.SizeHuman, signedSize(sq.SizeDiff)))
+			sb.WriteString(fmt.Sprintf("| Layers | %d | %d | -%d |\n", sq.Layers, sq.Image.Layers, sq.Layers-sq.Image.Layers))
+			sb.WriteString(fmt.Sprintf("| Wasted | %s | 0B | -%s |\n\n", docker.HumanSize(sq.WastedBytes), docker.HumanSize(sq.WastedBytes)))
+			sb.WriteString("**Trade-offs:**\n\n")
+			for _, tradeoff := range sq.Tradeoffs {
+				sb.WriteString(fmt.Sprintf("- %s\n", tradeoff))
 			}
-			sb.WriteString(fmt.Sprintf("- %s **%s** — %s (Impact: %s)\n",
-				status, opt.Title, opt.Description, opt.Impact))
+		} else {
+			sb.WriteString(fmt.Sprintf("Not squashed: %s.\n", sq.Reason))
 		}
 		sb.WriteString("\n")
-		if result.Optimization.EstimatedReduction != "" {
-			sb.WriteString(fmt.Sprintf("**Estimated reduction:** %s\n\n", result.Optimization.EstimatedReduction))
+	}
+
+	// Push
+	if push := result.Push; push != nil {
+		sb.WriteString("## 📦 Push\n\n")
+		switch {
+		case push.Pushed:
+			sb.WriteString(fmt.Sprintf("`%s` was pushed as `%s`.\n\n", push.Source, push.Digest))
+			sb.WriteString("| Label | Value |\n")
+			sb.WriteString("|-------|-------|\n")
+			keys := make([]string, 0, len(push.Labels))
+			for k := range push.Labels {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				sb.WriteString(fmt.Sprintf("| `%s` | `%s` |\n", k, push.Labels[k]))
+			}
+		case push.Error != "":
+			sb.WriteString(fmt.Sprintf("❌ Push to `%s` failed: %s\n", push.Ref, push.Error))
+		default:
+			sb.WriteString(fmt.Sprintf("Not pushed to `%s`: %s.\n", push.Ref, push.Reason))
 		}
+		sb.WriteString("\n")
+	}
+
+	// Slim
+	if result.Slim != nil {
+		writeSlimSection(&sb, result.Slim)
+		sb.WriteString("Policy checks apply to the minified image.\n\n")
+	}
+
+	// Analysis
+	if result.Analysis != nil {
+		writeAnalysisSection(&sb, result.Analysis, result.Optimization)
+	}
+
+	// Security Scan
+	if result.ScanResult != nil {
+		writeScanSection(&sb, result.ScanResult, false)
+	}
+
+	// Optimizations
+	if result.Optimization != nil && len(result.Optimization.Optimizations) > 0 {
+		writeOptimizationSection(&sb, result.Optimization)
+	}
+
+	// Re-analysis of the autofixed Dockerfile
+	if result.AnalysisDiff != nil {
+		writeAnalysisDiffSection(&sb, result.AnalysisDiff)
 	}
 
 	// Policy
 	if result.Policy != nil {
 		sb.WriteString("## 📋 Policy Checks\n\n")
+		if result.Policy.Profile != "" {
+			sb.WriteString(fmt.Sprintf("**Profile:** `%s`\n\n", result.Policy.Profile))
+		}
+		if result.Policy.Analysis == models.AnalysisOptimized {
+			sb.WriteString("Dockerfile checks apply to the autofixed Dockerfile.\n\n")
+		}
 		for _, rule := range result.Policy.Rules {
-			if rule.Passed {
+			switch {
+			case rule.NotEvaluated:
+				sb.WriteString(fmt.Sprintf("- ⏭️ %s: %s\n", rule.Description, rule.Message))
+			case rule.Passed:
 				sb.WriteString(fmt.Sprintf("- ✅ %s\n", rule.Description))
-			} else {
+			case rule.Enforcement == models.EnforcementWarn:
+				sb.WriteString(fmt.Sprintf("- ⚠️ %s: %s (warn)\n", rule.Description, rule.Message))
+			default:
 				sb.WriteString(fmt.Sprintf("- ❌ %s: %s\n", rule.Description, rule.Message))
 			}
 		}
 		sb.WriteString("\n")
 	}
 
-	sb.WriteString("---\n")
-	sb.WriteString("*Generated by [Docker Image Optimizer (DIO)](https://github.com/maxlar/docker-image-optimizer) by Moustafa Rakha (Maxlar)*\n")
+	// Compliance
+	if result.Compliance != nil {
+		writeComplianceSection(&sb, result.Compliance)
+	}
+
+	// Timing
+	if len(result.Timings) > 0 {
+		sb.WriteString("## ⏱️ Timing\n\n")
+		sb.WriteString("| Step | Duration |\n")
+		sb.WriteString("|------|----------|\n")
+		for _, t := range result.Timings {
+			sb.WriteString(fmt.Sprintf("| %s | %.1fs |\n", t.Step, t.Seconds))
+		}
+		sb.WriteString("\n")
+	}
+
+	writeFooter(&sb)
 
 	return sb.String(), nil
 }
 
+// gitState describes the branch and work tree of a revision, e.g.
+// " (main, uncommitted changes)".
+func gitState(g *models.GitInfo) string {
+	var parts []string
+	if g.Branch != "" {
+		parts = append(parts, "`"+g.Branch+"`")
+	}
+	if g.Dirty {
+		parts = append(parts, "uncommitted changes")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// overrideUser returns who requested a policy override.
+func overrideUser(o *models.PolicyOverride) string {
+	if o.User == "" {
+		return "unknown user"
+	}
+	return "`" + o.User + "`"
+}
+
+// layerRef names a layer by its index, and the Dockerfile line that
+// created it when known.
+func layerRef(layer, line int) string {
+	if line > 0 {
+		return fmt.Sprintf("%d (line %d)", layer, line)
+	}
+	return strconv.Itoa(layer)
+}
+
+// createdByCell formats the created_by of an image history entry for a
+// table cell, shortened.
+func createdByCell(createdBy string) string {
+	createdBy = strings.TrimSpace(strings.TrimSuffix(createdBy, "# buildkit"))
+	if createdBy == "" {
+		return ""
+	}
+	if len(createdBy) > 60 {
+		createdBy = createdBy[:57] + "..."
+	}
+	return "`" + strings.ReplaceAll(createdBy, "|", "\\|") + "`"
+}
+
+// signedSize formats a size difference with its sign.
+func signedSize(diff int64) string {
+	if diff < 0 {
+		return "-" + docker.HumanSize(-diff)
+	}
+	return "+" + docker.HumanSize(diff)
+}
+
+// money formats an amount with its currency; negative amounts are costs.
+func money(amount float64, currency string) string {
+	return fmt.Sprintf("%.2f %s", amount, currency)
+}
+
+// issueLink renders an issue ID as a link to its documentation, if any.
+func issueLink(issue models.Issue) string {
+	if issue.DocsURL == "" {
+		return issue.ID
+	}
+	return fmt.Sprintf("[%s](%s)", issue.ID, issue.DocsURL)
+}
+
 func severityIcon(s models.Severity) string {
 	switch s {
 	case models.SeverityCritical:
@@ -0,0 +1,93 @@
+package reporter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func TestGenerate_Timings(t *testing.T) {
+	result := &models.PipelineResult{
+		Timestamp:  time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Dockerfile: "Dockerfile",
+		Timings: []models.StepTiming{
+			{Step: "analyze", Seconds: 0.04},
+			{Step: "build baseline", Seconds: 61.3},
+			{Step: "policy", Seconds: 0.2},
+		},
+	}
+	r := New(t.TempDir())
+
+	md, err := r.Generate(result, FormatMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "## ⏱️ Timing\n\n| Step | Duration |\n|------|----------|\n" +
+		"| analyze | 0.0s |\n| build baseline | 61.3s |\n| policy | 0.2s |\n"
+	if !strings.Contains(md, want) {
+		t.Errorf("expected the timing table in step order, got:\n%s", md)
+	}
+
+	data, err := r.Generate(result, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Timings []models.StepTiming `json:"timings"`
+	}
+	if err := json.Unmarshal([]byte(data), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Timings) != 3 || report.Timings[1].Step != "build baseline" || report.Timings[1].Seconds != 61.3 {
+		t.Errorf("expected the timings in the JSON report, got %+v", report.Timings)
+	}
+}
+
+func TestGenerate_NoTimings(t *testing.T) {
+	md, err := New(t.TempDir()).Generate(&models.PipelineResult{Dockerfile: "Dockerfile"}, FormatMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(md, "Timing") {
+		t.Errorf("expected no timing table without timings, got:\n%s", md)
+	}
+}
+
+func TestGenerate_BaselineEstimate(t *testing.T) {
+	result := &models.PipelineResult{
+		Dockerfile: "Dockerfile",
+		BaselineEstimate: &models.BaselineEstimate{
+			BaseImage:              "node:20",
+			BaseImageSize:          400 * 1024 * 1024,
+			OptimizedBaseImage:     "node:20-alpine",
+			OptimizedBaseImageSize: 40 * 1024 * 1024,
+			SizeDiff:               360 * 1024 * 1024,
+		},
+		OptimizedImage: &models.ImageMetrics{SizeHuman: "180.0MB"},
+	}
+	md, err := New(t.TempDir()).Generate(result, FormatMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "## 📊 Comparison (estimated)\n\n" +
+		"The baseline image was not built; the comparison uses the registry (compressed) sizes of the final base images.\n\n" +
+		"| Metric | Baseline | Optimized | Change |\n|--------|----------|-----------|--------|\n" +
+		"| Base image | `node:20` | `node:20-alpine` | |\n" +
+		"| Base image size | 400.0MB | 40.0MB | -360.0MB |\n" +
+		"| Image size | - | 180.0MB | |\n"
+	if !strings.Contains(md, want) {
+		t.Errorf("expected the estimated comparison, got:\n%s", md)
+	}
+
+	// A built baseline takes precedence over the estimate
+	result.Comparison = &models.ComparisonMetrics{}
+	if md, err = New(t.TempDir()).Generate(result, FormatMarkdown); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(md, "(estimated)") {
+		t.Errorf("expected no estimate with a comparison, got:\n%s", md)
+	}
+}
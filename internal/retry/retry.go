@@ -0,0 +1,122 @@
+// Package retry retries operations that fail for transient reasons, such
+// as network timeouts or registry rate limits, with exponential backoff.
+package retry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// transientRegex matches errors and command output caused by momentary
+// network or registry problems rather than by the input.
+var transientRegex = regexp.MustCompile(`(?i)` + strings.Join([]string{
+	`i/o timeout`,
+	`TLS handshake timeout`,
+	`connection reset by peer`,
+	`connection refused`,
+	`broken pipe`,
+	`unexpected EOF`,
+	`temporary failure in name resolution`,
+	`no such host`,
+	`network is unreachable`,
+	`context deadline exceeded`,
+	`Client\.Timeout exceeded`,
+	`toomanyrequests`,
+	`too many requests`,
+	`rate limit`,
+	`\b(429 Too Many Requests|502 Bad Gateway|503 Service Unavailable|504 Gateway Time-?out)\b`,
+	`status( code)?:? (429|502|503|504)\b`,
+	`bad gateway`,
+	`service unavailable`,
+	`gateway time-?out`,
+	`failed to do request`,
+	`failed to download vulnerability DB`,
+	`DB download error`,
+	`failed to load vulnerability db`,
+	`temporary error`,
+}, "|"))
+
+// clientErrorRegex matches the lines of a build's output that are the
+// error of docker, BuildKit or podman itself rather than output of the
+// build steps, which BuildKit prefixes with the step number: "ERROR:
+// failed to solve: ..." but not "#8 0.503 ERROR: ...".
+var clientErrorRegex = regexp.MustCompile(`(?m)^(ERROR|Error|error)(:| response from daemon:) .*$`)
+
+// sleep is replaced in tests.
+var sleep = time.Sleep
+
+// Policy says how often and how long to retry.
+type Policy struct {
+	// Attempts is the total number of attempts; 0 or 1 disables retries.
+	Attempts int
+	// Delay is the wait before the first retry, doubled after each attempt.
+	Delay time.Duration
+	// MaxDelay caps the wait between attempts (0 = uncapped).
+	MaxDelay time.Duration
+	// Log, when set, is told about each retry.
+	Log func(format string, args ...interface{})
+}
+
+// Default is the policy used when .dio.yaml doesn't configure one: three
+// attempts, waiting 2s and then 4s.
+func Default() Policy {
+	return Policy{Attempts: 3, Delay: 2 * time.Second, MaxDelay: 30 * time.Second}
+}
+
+// Transient reports whether err looks like a momentary failure worth
+// retrying. Of the build output following "output:", only the errors of
+// the client count: what the build steps print, such as a test hitting a
+// refused connection, fails the same way on every attempt.
+func Transient(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg, output, found := strings.Cut(err.Error(), "\noutput: ")
+	if transientRegex.MatchString(msg) {
+		return true
+	}
+	if !found {
+		return false
+	}
+	for _, line := range clientErrorRegex.FindAllString(output, -1) {
+		if transientRegex.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// Do runs fn until it succeeds, fails with an error that isn't transient,
+// or runs out of attempts. what names the operation in the log.
+func (p Policy) Do(what string, fn func() error) error {
+	delay := p.Delay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil && attempt > 1 && p.Log != nil {
+			p.Log("%s succeeded on attempt %d/%d", what, attempt, p.Attempts)
+		}
+		if err == nil || attempt >= p.Attempts || !Transient(err) {
+			if err != nil && attempt > 1 {
+				return fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return err
+		}
+		if p.Log != nil {
+			p.Log("%s failed (attempt %d/%d), retrying in %s: %s", what, attempt, p.Attempts, delay, firstLine(err))
+		}
+		sleep(delay)
+		delay *= 2
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+}
+
+// firstLine returns the first line of an error, leaving out the command
+// output that usually follows.
+func firstLine(err error) string {
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	return msg
+}
@@ -0,0 +1,121 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		err  string
+		want bool
+	}{
+		{"docker pull failed: exit status 1\nstderr: Get \"https://registry-1.docker.io/v2/\": net/http: TLS handshake timeout", true},
+		{"toomanyrequests: You have reached your pull rate limit", true},
+		{"GET https://ghcr.io/v2/_catalog: 503 Service Unavailable", true},
+		{"FATAL\tinit error: DB error: failed to download vulnerability DB", true},
+		{"docker build failed: exit status 1\noutput: #3 [internal] load metadata for docker.io/library/node:20\n" +
+			"ERROR: failed to solve: node:20: failed to resolve source metadata for docker.io/library/node:20: " +
+			"failed to do request: Head \"https://registry-1.docker.io/v2/library/node/manifests/20\": dial tcp: lookup registry-1.docker.io: Temporary failure in name resolution", true},
+		{"docker build failed: exit status 1\noutput: Error response from daemon: toomanyrequests: You have reached your pull rate limit", true},
+		{"docker manifest inspect failed: exit status 1\nstderr: received unexpected HTTP status: 503 Service Unavailable", true},
+		{"GET https://ghcr.io/v2/_catalog: 404 Not Found", false},
+		{"docker build failed: exit status 1\noutput: #8 [3/4] RUN make test\n#8 0.503 ERROR: 503 tests passed, 2 failed", false},
+		{"docker build failed: exit status 1\noutput: \"/app.py\": not found", false},
+	}
+	for _, tt := range tests {
+		if got := Transient(errors.New(tt.err)); got != tt.want {
+			t.Errorf("Transient(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+	if Transient(nil) {
+		t.Error("nil is not transient")
+	}
+}
+
+func TestTransient_BuildLog(t *testing.T) {
+	// A RUN step that fails on its own: its output mentions refused
+	// connections and timings that look like status codes, but the build
+	// fails the same way on every attempt
+	log := `#7 [2/4] COPY . /app
+#7 DONE 0.1s
+
+#8 [3/4] RUN npm test
+#8 0.503 ERROR: connect ECONNREFUSED 127.0.0.1:5432 (connection refused)
+#8 0.504 Error: unexpected EOF while reading fixture
+#8 1.429 npm ERR! Test failed.  See above for more details.
+#8 ERROR: process "/bin/sh -c npm test" did not complete successfully: exit code: 1
+------
+ > [3/4] RUN npm test:
+0.503 ERROR: connect ECONNREFUSED 127.0.0.1:5432 (connection refused)
+------
+Dockerfile:4
+--------------------
+   3 |     COPY . /app
+   4 | >>> RUN npm test
+--------------------
+ERROR: failed to solve: process "/bin/sh -c npm test" did not complete successfully: exit code: 1`
+	err := fmt.Errorf("docker build failed: %w\noutput: %s", errors.New("exit status 1"), log)
+	if Transient(err) {
+		t.Error("expected a failing build step not to be transient")
+	}
+
+	calls := 0
+	_ = Policy{Attempts: 3}.Do("build", func() error { calls++; return err })
+	if calls != 1 {
+		t.Errorf("expected the failing build not to be retried, got %d attempts", calls)
+	}
+}
+
+func TestPolicy_Do(t *testing.T) {
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { sleep = time.Sleep }()
+
+	var logs []string
+	p := Policy{Attempts: 4, Delay: time.Second, MaxDelay: 3 * time.Second, Log: func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}}
+
+	calls := 0
+	err := p.Do("pull", func() error {
+		calls++
+		if calls < 4 {
+			return errors.New("i/o timeout\nmore output")
+		}
+		return nil
+	})
+	if err != nil || calls != 4 {
+		t.Fatalf("Do = %v after %d calls", err, calls)
+	}
+	if fmt.Sprint(waits) != "[1s 2s 3s]" {
+		t.Errorf("waits = %v", waits)
+	}
+	if len(logs) != 4 || logs[0] != "pull failed (attempt 1/4), retrying in 1s: i/o timeout" || logs[3] != "pull succeeded on attempt 4/4" {
+		t.Errorf("logs = %q", logs)
+	}
+
+	// Permanent errors are returned at once
+	calls = 0
+	err = p.Do("build", func() error { calls++; return errors.New("no such file") })
+	if calls != 1 || err == nil || err.Error() != "no such file" {
+		t.Errorf("expected one call for a permanent error, got %d: %v", calls, err)
+	}
+
+	// The last error is returned with the attempt count
+	calls = 0
+	err = p.Do("scan", func() error { calls++; return errors.New("connection reset by peer") })
+	if calls != 4 || err == nil || !strings.Contains(err.Error(), "after 4 attempts") {
+		t.Errorf("expected 4 attempts, got %d: %v", calls, err)
+	}
+
+	// The zero policy runs once
+	calls = 0
+	_ = Policy{}.Do("pull", func() error { calls++; return errors.New("i/o timeout") })
+	if calls != 1 {
+		t.Errorf("expected no retries without a policy, got %d calls", calls)
+	}
+}
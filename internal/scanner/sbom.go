@@ -0,0 +1,117 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// --- SBOM generation ---
+
+// cycloneDX is the subset of a CycloneDX JSON SBOM we care about.
+type cycloneDX struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Purl     string `json:"purl"`
+	Licenses []struct {
+		License *struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"license"`
+		Expression string `json:"expression"`
+	} `json:"licenses"`
+}
+
+// SBOM generates a software bill of materials for the image: every OS and
+// language package with its licenses. Trivy generates it directly; with
+// Grype, its companion tool Syft is used.
+func (s *Scanner) SBOM(imageRef string) (*models.SBOM, error) {
+	var bin, generator string
+	var args []string
+	switch s.scannerType {
+	case ScannerTrivy:
+		bin, generator = s.binaryPath, "trivy"
+		args = append([]string{"image", "--format", "cyclonedx", "--quiet"}, imageArgs("trivy", imageRef)...)
+	case ScannerGrype:
+		path, err := exec.LookPath("syft")
+		if err != nil {
+			return nil, fmt.Errorf("syft is required to generate an SBOM with grype: %w", err)
+		}
+		bin, generator = path, "syft"
+		args = append(imageArgs("syft", imageRef), "-o", "cyclonedx-json", "--quiet")
+	default:
+		return nil, fmt.Errorf("unsupported scanner type: %s", s.scannerType)
+	}
+
+	var stdout bytes.Buffer
+	err := s.retry.Do(generator+" SBOM of "+imageRef, func() error {
+		cmd := exec.Command(bin, args...)
+		var stderr bytes.Buffer
+		stdout.Reset()
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s SBOM generation failed: %w\nstderr: %s", generator, err, stderr.String())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sbom, err := parseCycloneDX(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s SBOM: %w", generator, err)
+	}
+	sbom.ImageName = imageRef
+	sbom.Generator = generator
+	return sbom, nil
+}
+
+// parseCycloneDX extracts the packages and their licenses from a CycloneDX
+// JSON document.
+func parseCycloneDX(data []byte) (*models.SBOM, error) {
+	var doc cycloneDX
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	sbom := &models.SBOM{}
+	for _, c := range doc.Components {
+		if c.Type != "library" && c.Type != "application" {
+			continue // skip the operating system and container components
+		}
+		pkg := models.Package{Name: c.Name, Version: c.Version, Type: purlType(c.Purl)}
+		for _, l := range c.Licenses {
+			switch {
+			case l.Expression != "":
+				pkg.Licenses = append(pkg.Licenses, l.Expression)
+			case l.License != nil && l.License.ID != "":
+				pkg.Licenses = append(pkg.Licenses, l.License.ID)
+			case l.License != nil && l.License.Name != "":
+				pkg.Licenses = append(pkg.Licenses, l.License.Name)
+			}
+		}
+		sbom.Packages = append(sbom.Packages, pkg)
+	}
+	return sbom, nil
+}
+
+// purlType returns the package ecosystem from a package URL, e.g. "deb" for
+// pkg:deb/debian/bash@5.2.
+func purlType(purl string) string {
+	purl = strings.TrimPrefix(purl, "pkg:")
+	if idx := strings.Index(purl, "/"); idx > 0 {
+		return purl[:idx]
+	}
+	return ""
+}
@@ -5,11 +5,14 @@ package scanner
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
 
 	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/retry"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
 )
 
 // ScannerType represents the type of security scanner to use.
@@ -24,8 +27,22 @@ const (
 type Scanner struct {
 	scannerType ScannerType
 	binaryPath  string
+	retry       retry.Policy
 }
 
+// ErrNotFound is returned by New when neither trivy nor grype is installed.
+var ErrNotFound = errors.New("no supported security scanner found (install trivy or grype)")
+
+// ScanError is a scan of an image that failed.
+type ScanError struct {
+	Image string
+	Err   error
+}
+
+func (e *ScanError) Error() string { return e.Err.Error() }
+
+func (e *ScanError) Unwrap() error { return e.Err }
+
 // New creates a new Scanner, auto-detecting available tools.
 func New() (*Scanner, error) {
 	// Try Trivy first, then Grype
@@ -35,7 +52,7 @@ func New() (*Scanner, error) {
 	if path, err := exec.LookPath("grype"); err == nil {
 		return &Scanner{scannerType: ScannerGrype, binaryPath: path}, nil
 	}
-	return nil, fmt.Errorf("no supported security scanner found (install trivy or grype)")
+	return nil, ErrNotFound
 }
 
 // NewWithScanner creates a Scanner using a specific tool.
@@ -48,16 +65,31 @@ func NewWithScanner(scannerType ScannerType) (*Scanner, error) {
 	return &Scanner{scannerType: scannerType, binaryPath: path}, nil
 }
 
+// SetRetry sets how scans that fail for transient reasons, such as a
+// failed vulnerability database download, are retried.
+func (s *Scanner) SetRetry(policy retry.Policy) {
+	s.retry = policy
+}
+
 // Scan performs a vulnerability scan on the given image.
 func (s *Scanner) Scan(imageRef string) (*models.ScanResult, error) {
-	switch s.scannerType {
-	case ScannerTrivy:
-		return s.scanWithTrivy(imageRef)
-	case ScannerGrype:
-		return s.scanWithGrype(imageRef)
-	default:
-		return nil, fmt.Errorf("unsupported scanner type: %s", s.scannerType)
+	var result *models.ScanResult
+	err := s.retry.Do(fmt.Sprintf("%s scan of %s", s.scannerType, imageRef), func() error {
+		var err error
+		switch s.scannerType {
+		case ScannerTrivy:
+			result, err = s.scanWithTrivy(imageRef)
+		case ScannerGrype:
+			result, err = s.scanWithGrype(imageRef)
+		default:
+			err = fmt.Errorf("unsupported scanner type: %s", s.scannerType)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, &ScanError{Image: imageRef, Err: err}
 	}
+	return result, nil
 }
 
 // --- Trivy integration ---
@@ -88,8 +120,8 @@ func (s *Scanner) scanWithTrivy(imageRef string) (*models.ScanResult, error) {
 		"--format", "json",
 		"--severity", "CRITICAL,HIGH,MEDIUM,LOW",
 		"--quiet",
-		imageRef,
 	}
+	args = append(args, imageArgs("trivy", imageRef)...)
 
 	cmd := exec.Command(s.binaryPath, args...)
 	var stdout, stderr bytes.Buffer
@@ -126,6 +158,7 @@ func (s *Scanner) scanWithTrivy(imageRef string) (*models.ScanResult, error) {
 				Description:   truncate(v.Description, 200),
 				DataSource:    "trivy",
 				PublishedDate: v.PublishedDate,
+				Fingerprint:   models.Fingerprint(v.VulnerabilityID, v.PkgName),
 			}
 			result.Vulnerabilities = append(result.Vulnerabilities, vuln)
 
@@ -172,11 +205,8 @@ type grypeArtifact struct {
 }
 
 func (s *Scanner) scanWithGrype(imageRef string) (*models.ScanResult, error) {
-	args := []string{
-		imageRef,
-		"-o", "json",
-		"--quiet",
-	}
+	args := imageArgs("grype", imageRef)
+	args = append(args, "-o", "json", "--quiet")
 
 	cmd := exec.Command(s.binaryPath, args...)
 	var stdout, stderr bytes.Buffer
@@ -214,6 +244,7 @@ func (s *Scanner) scanWithGrype(imageRef string) (*models.ScanResult, error) {
 			Severity:     severity,
 			Description:  truncate(m.Vulnerability.Description, 200),
 			DataSource:   "grype",
+			Fingerprint:  models.Fingerprint(m.Vulnerability.ID, m.Artifact.Name),
 		}
 		result.Vulnerabilities = append(result.Vulnerabilities, vuln)
 
@@ -234,6 +265,22 @@ func (s *Scanner) scanWithGrype(imageRef string) (*models.ScanResult, error) {
 
 // --- Helpers ---
 
+// imageArgs returns the arguments naming the image to trivy, grype or
+// syft. Archives (docker-archive:<file>, oci:<dir>) are read from disk:
+// trivy takes them with --input, grype and syft with their source schemes.
+func imageArgs(tool, imageRef string) []string {
+	archive, ok := docker.ParseArchive(imageRef)
+	switch {
+	case !ok:
+		return []string{imageRef}
+	case tool == "trivy":
+		return []string{"--input", archive.Path}
+	case archive.Kind == docker.ArchiveOCI:
+		return []string{"oci-dir:" + archive.Path}
+	}
+	return []string{"docker-archive:" + archive.Path}
+}
+
 func mapSeverity(s string) models.Severity {
 	switch strings.ToLower(s) {
 	case "critical":
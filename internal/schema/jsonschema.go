@@ -0,0 +1,58 @@
+package schema
+
+import "reflect"
+
+// Draft is the JSON Schema version of the generated schemas, the latest
+// one YAML editors widely support.
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema is a JSON Schema document, or a schema within one.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+}
+
+// Generate derives the JSON Schema of the YAML files decoded into the
+// struct type t. Structs allow only their keys, so editors flag the same
+// unknown keys Validate does.
+func Generate(t reflect.Type, id, title string) *JSONSchema {
+	s := generate(t)
+	s.Schema, s.ID, s.Title = Draft, id, title
+	return s
+}
+
+func generate(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nodeType {
+		return &JSONSchema{}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		s := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema), AdditionalProperties: false}
+		for key, f := range Fields(t) {
+			s.Properties[key] = generate(f.Type)
+		}
+		return s
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: generate(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: generate(t.Elem())}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	}
+	return &JSONSchema{}
+}
@@ -0,0 +1,225 @@
+// Package schema checks YAML files against the Go types they are decoded
+// into, reporting unknown keys and mistyped values with their position, and
+// derives JSON Schemas from the same types for editors. yaml.v3 ignores
+// keys no field matches, so a typo in a policy file otherwise silently
+// leaves a gate at its default.
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error is a problem at a position in a YAML file.
+type Error struct {
+	Line, Column int
+	// Path is the dotted path of the key, e.g. profiles.prod.max_layers.
+	Path    string
+	Message string
+}
+
+func (e Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", e.Line, e.Column, e.Path, e.Message)
+}
+
+// nodeType is the type of yaml.Node, which accepts anything.
+var nodeType = reflect.TypeOf(yaml.Node{})
+
+// Validate checks data against the type t, a struct decoded with yaml.v3,
+// and returns the problems found in file order. The error is for data that
+// isn't YAML.
+func Validate(data []byte, t reflect.Type) ([]Error, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return ValidateNode(&doc, t), nil
+}
+
+// ValidateNode is Validate for a parsed document.
+func ValidateNode(doc *yaml.Node, t reflect.Type) []Error {
+	if doc.Kind == yaml.DocumentNode {
+		if len(doc.Content) == 0 {
+			return nil
+		}
+		doc = doc.Content[0]
+	}
+	var errs []Error
+	validate(doc, t, "", &errs)
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		return errs[i].Column < errs[j].Column
+	})
+	return errs
+}
+
+func validate(node *yaml.Node, t reflect.Type, path string, errs *[]Error) {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.Tag == "!!null" || t == nodeType || t.Kind() == reflect.Interface {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, Error{Line: node.Line, Column: node.Column, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			fail("expected a mapping, got %s", describe(node))
+			return
+		}
+		fields := Fields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				continue
+			}
+			field, ok := fields[key.Value]
+			if !ok {
+				message := "unknown key"
+				if s := Suggest(key.Value, keys(fields)); s != "" {
+					message += " (did you mean " + s + "?)"
+				}
+				*errs = append(*errs, Error{Line: key.Line, Column: key.Column, Path: join(path, key.Value), Message: message})
+				continue
+			}
+			validate(value, field.Type, join(path, key.Value), errs)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			fail("expected a mapping, got %s", describe(node))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			validate(node.Content[i+1], t.Elem(), join(path, node.Content[i].Value), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			fail("expected a list, got %s", describe(node))
+			return
+		}
+		for i, item := range node.Content {
+			validate(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			fail("expected true or false, got %s", describe(node))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			fail("expected an integer, got %s", describe(node))
+		}
+	case reflect.Float32, reflect.Float64:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" && node.Tag != "!!float" {
+			fail("expected a number, got %s", describe(node))
+		}
+	case reflect.String:
+		// yaml.v3 decodes any scalar into a string
+		if node.Kind != yaml.ScalarNode {
+			fail("expected a string, got %s", describe(node))
+		}
+	}
+}
+
+// describe names what a node holds, for error messages.
+func describe(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	return fmt.Sprintf("%q", node.Value)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Fields returns the fields of a struct type by their YAML key, including
+// those of inlined structs. Fields tagged "-" are left out.
+func Fields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			for key, inlined := range Fields(f.Type) {
+				fields[key] = inlined
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func keys(fields map[string]reflect.StructField) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Suggest returns the candidate closest to name, for "did you mean"
+// hints, or "" when none is within a few typos.
+func Suggest(name string, candidates []string) string {
+	best, bestDist := "", 0
+	for _, c := range candidates {
+		d := distance(strings.ToLower(name), c)
+		if d <= max(2, len(c)/4) && (best == "" || d < bestDist) {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
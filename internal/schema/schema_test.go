@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testLimits struct {
+	MaxSize string `yaml:"max_size"`
+}
+
+type testConfig struct {
+	testLimits `yaml:",inline"`
+	Enabled    bool                   `yaml:"enabled"`
+	Layers     int                    `yaml:"layers"`
+	Ratio      float64                `yaml:"ratio"`
+	Images     []string               `yaml:"images"`
+	Profiles   map[string]testLimits  `yaml:"profiles"`
+	Options    map[string]interface{} `yaml:"options"`
+	Internal   string                 `yaml:"-"`
+}
+
+func TestValidate(t *testing.T) {
+	data := []byte(`max_size: 100MB
+enabled: yes please
+layers: 12
+ratio: 1
+images: node:20
+internal: x
+options: {anything: [1, 2]}
+profiles:
+  prod:
+    max_sise: 50MB
+`)
+	errs, err := Validate(data, reflect.TypeOf(testConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Error{
+		{Line: 2, Column: 10, Path: "enabled", Message: `expected true or false, got "yes please"`},
+		{Line: 5, Column: 9, Path: "images", Message: `expected a list, got "node:20"`},
+		{Line: 6, Column: 1, Path: "internal", Message: "unknown key"},
+		{Line: 10, Column: 5, Path: "profiles.prod.max_sise", Message: "unknown key (did you mean max_size?)"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("Validate = %+v, want %+v", errs, want)
+	}
+
+	if _, err := Validate([]byte("a: [b"), reflect.TypeOf(testConfig{})); err == nil {
+		t.Error("Validate accepted malformed YAML")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	s := Generate(reflect.TypeOf(testConfig{}), "https://example.com/test.json", "Test")
+	if s.Schema != Draft || s.AdditionalProperties != false || len(s.Properties) != 7 {
+		t.Fatalf("Generate = %+v, want a closed object with 7 properties", s)
+	}
+	if p := s.Properties["max_size"]; p == nil || p.Type != "string" {
+		t.Errorf("inlined max_size = %+v, want a string", p)
+	}
+	if p := s.Properties["images"]; p.Type != "array" || p.Items.Type != "string" {
+		t.Errorf("images = %+v, want an array of strings", p)
+	}
+	profile, ok := s.Properties["profiles"].AdditionalProperties.(*JSONSchema)
+	if !ok || profile.Properties["max_size"] == nil {
+		t.Errorf("profiles = %+v, want a map of limits", s.Properties["profiles"])
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"max_critical_cves", "max_high_cves", "max_image_size", "max_layers"}
+	for name, want := range map[string]string{
+		"max_high_cve":  "max_high_cves",
+		"MAX_LAYERS":    "max_layers",
+		"max_imagesize": "max_image_size",
+		"min_score":     "",
+		"maximum":       "",
+	} {
+		if got := Suggest(name, candidates); got != want {
+			t.Errorf("Suggest(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Package slim minifies images at runtime using mint (formerly
+// docker-slim): the image is run with instrumentation, the files it
+// actually uses are recorded, and an image with only those files is built.
+package slim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// Tool is a supported minifier binary.
+type Tool string
+
+const (
+	ToolMint       Tool = "mint"
+	ToolSlim       Tool = "slim"
+	ToolDockerSlim Tool = "docker-slim"
+)
+
+// maxRemovedPaths caps the directories listed in a SlimResult.
+const maxRemovedPaths = 20
+
+// removedPathDepth is how many path segments removed files are grouped by,
+// e.g. /usr/share/doc.
+const removedPathDepth = 3
+
+// Options controls how the image is exercised while it is observed.
+type Options struct {
+	// HTTPProbe sends HTTP requests to the exposed ports so that request
+	// handling code paths are recorded.
+	HTTPProbe bool
+	// ContinueAfter is when observation stops: "probe", "exec",
+	// "container.exit", or a number of seconds (default: "probe" with
+	// HTTPProbe, otherwise 10 seconds).
+	ContinueAfter string
+	// IncludePaths are kept even if they are not seen in use, e.g. files
+	// only read on rare code paths.
+	IncludePaths []string
+}
+
+// Slimmer wraps the minifier CLI.
+type Slimmer struct {
+	tool       Tool
+	binaryPath string
+}
+
+// ErrNotFound is returned by New when no minifier is installed.
+var ErrNotFound = errors.New("no image minifier found (install mint: https://github.com/mintoolkit/mint)")
+
+// New creates a Slimmer, auto-detecting mint, slim or docker-slim.
+func New() (*Slimmer, error) {
+	for _, tool := range []Tool{ToolMint, ToolSlim, ToolDockerSlim} {
+		if p, err := exec.LookPath(string(tool)); err == nil {
+			return &Slimmer{tool: tool, binaryPath: p}, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Tool returns the detected minifier.
+func (s *Slimmer) Tool() Tool {
+	return s.tool
+}
+
+// Minify builds a minified copy of image tagged tag and reports what was
+// removed.
+func (s *Slimmer) Minify(client *docker.Client, image, tag string, opts Options) (*models.SlimResult, error) {
+	source, err := client.Inspect(image)
+	if err != nil {
+		return nil, err
+	}
+	before, err := client.Files(image)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(s.binaryPath, s.args(image, tag, opts)...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w\noutput: %s", s.tool, err, docker.LastLines(output.String(), 20))
+	}
+
+	minified, err := client.Inspect(tag)
+	if err != nil {
+		return nil, err
+	}
+	after, err := client.Files(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.SlimResult{
+		Source:   image,
+		Tool:     string(s.tool),
+		Image:    minified,
+		SizeDiff: minified.Size - source.Size,
+	}
+	result.RemovedFiles, result.RemovedBytes, result.Removed = Removed(before, after)
+	return result, nil
+}
+
+// args returns the minifier command line. mint calls the command "slim",
+// docker-slim calls it "build"; both take the same flags.
+func (s *Slimmer) args(image, tag string, opts Options) []string {
+	command := "build"
+	if s.tool == ToolMint {
+		command = "slim"
+	}
+	continueAfter := opts.ContinueAfter
+	if continueAfter == "" {
+		continueAfter = "10"
+		if opts.HTTPProbe {
+			continueAfter = "probe"
+		}
+	}
+
+	args := []string{"--report", "off", command,
+		"--target", image,
+		"--tag", tag,
+		fmt.Sprintf("--http-probe=%t", opts.HTTPProbe),
+		"--continue-after", continueAfter,
+	}
+	for _, p := range opts.IncludePaths {
+		args = append(args, "--include-path", p)
+	}
+	return args
+}
+
+// Removed compares the files of an image before and after minification.
+// It returns the number and size of the removed files and the directories
+// they were removed from, largest first.
+func Removed(before, after map[string]int64) (int, int64, []models.RemovedPath) {
+	var (
+		files int
+		total int64
+	)
+	byDir := make(map[string]*models.RemovedPath)
+	for p, size := range before {
+		if _, kept := after[p]; kept {
+			continue
+		}
+		files++
+		total += size
+
+		dir := path.Dir(p)
+		if parts := strings.Split(strings.TrimPrefix(dir, "/"), "/"); len(parts) > removedPathDepth {
+			dir = "/" + strings.Join(parts[:removedPathDepth], "/")
+		}
+		group, ok := byDir[dir]
+		if !ok {
+			group = &models.RemovedPath{Path: dir}
+			byDir[dir] = group
+		}
+		group.Files++
+		group.Bytes += size
+	}
+
+	paths := make([]models.RemovedPath, 0, len(byDir))
+	for _, group := range byDir {
+		paths = append(paths, *group)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].Bytes != paths[j].Bytes {
+			return paths[i].Bytes > paths[j].Bytes
+		}
+		return paths[i].Path < paths[j].Path
+	})
+	if len(paths) > maxRemovedPaths {
+		paths = paths[:maxRemovedPaths]
+	}
+	return files, total, paths
+}
@@ -0,0 +1,49 @@
+package slim
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func TestRemoved(t *testing.T) {
+	before := map[string]int64{
+		"/app/server":                     500,
+		"/usr/share/doc/curl/README":      30,
+		"/usr/share/doc/curl/changes/old": 20,
+		"/usr/share/man/man1/curl.1":      10,
+		"/bin/sh":                         100,
+		"/etc/passwd":                     1,
+	}
+	after := map[string]int64{"/app/server": 500, "/etc/passwd": 1}
+
+	files, total, paths := Removed(before, after)
+	if files != 4 || total != 160 {
+		t.Errorf("expected 4 files and 160 bytes removed, got %d and %d", files, total)
+	}
+	want := []models.RemovedPath{
+		{Path: "/bin", Files: 1, Bytes: 100},
+		{Path: "/usr/share/doc", Files: 2, Bytes: 50},
+		{Path: "/usr/share/man", Files: 1, Bytes: 10},
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %+v, want %+v", paths, want)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	mint := &Slimmer{tool: ToolMint}
+	got := mint.args("app:1", "app:slim", Options{IncludePaths: []string{"/etc/ssl"}})
+	want := []string{"--report", "off", "slim", "--target", "app:1", "--tag", "app:slim",
+		"--http-probe=false", "--continue-after", "10", "--include-path", "/etc/ssl"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mint args = %q, want %q", got, want)
+	}
+
+	dockerSlim := &Slimmer{tool: ToolDockerSlim}
+	got = dockerSlim.args("app:1", "app:slim", Options{HTTPProbe: true})
+	if got[2] != "build" || got[8] != "--continue-after" || got[9] != "probe" {
+		t.Errorf("unexpected docker-slim args %q", got)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build ignore
+
+// hello is the application of the go strategy test fixture.
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func main() {
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	http.ListenAndServe(":8080", nil)
+}
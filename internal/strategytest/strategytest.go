@@ -0,0 +1,392 @@
+// Package strategytest builds a corpus of fixture Dockerfiles before and
+// after each optimizer strategy, in a temporary copy of the build context,
+// to find strategies that produce broken builds.
+package strategytest
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/diagnose"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/optimizer"
+	"github.com/maxlar/docker-image-optimizer/pkg/docker"
+)
+
+// Result statuses.
+const (
+	StatusPassed = "passed"
+	// StatusBroken means the fixture built before the strategy and not
+	// after, or the strategy produced a Dockerfile autofix rejected.
+	StatusBroken = "broken"
+	// StatusNotApplicable means the strategy didn't change the fixture.
+	StatusNotApplicable = "not-applicable"
+)
+
+//go:embed all:fixtures
+var builtin embed.FS
+
+// Fixture is a Dockerfile with its build context.
+type Fixture struct {
+	Name       string
+	Context    fs.FS
+	Dockerfile string // path of the Dockerfile in Context
+}
+
+// Builtin returns the built-in fixtures: small node, python, go and static
+// sites written the way optimizations are typically needed.
+func Builtin() []Fixture {
+	entries, _ := builtin.ReadDir("fixtures")
+	var fixtures []Fixture
+	for _, e := range entries {
+		sub, _ := fs.Sub(builtin, path.Join("fixtures", e.Name()))
+		fixtures = append(fixtures, Fixture{Name: e.Name(), Context: sub, Dockerfile: "Dockerfile"})
+	}
+	return fixtures
+}
+
+// Load returns the fixture at path: a Dockerfile, built in its directory,
+// or a directory with a Containerfile or Dockerfile.
+func Load(p string) (Fixture, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return Fixture{}, err
+	}
+	found, err := analyzer.FindDockerfile(p)
+	if err != nil {
+		return Fixture{}, err
+	}
+	dir, dockerfile := filepath.Dir(found), filepath.Base(found)
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return Fixture{}, err
+	}
+	name := filepath.Base(abs)
+	if !info.IsDir() && dockerfile != "Dockerfile" {
+		name += "/" + dockerfile
+	}
+	return Fixture{Name: name, Context: os.DirFS(abs), Dockerfile: dockerfile}, nil
+}
+
+// BuildFunc builds a Dockerfile into an image tagged tag.
+type BuildFunc func(dockerfile, contextDir, tag string) (*models.ImageMetrics, error)
+
+// Options configures a test run.
+type Options struct {
+	// Strategies limits the run to the strategies with these names. Empty
+	// runs every built-in strategy.
+	Strategies []string
+	// OnResult, if set, is called as each strategy finishes on a fixture.
+	OnResult func(fixture string, r Result)
+}
+
+// Result is one strategy applied to one fixture.
+type Result struct {
+	Strategy string `json:"strategy"`
+	Status   string `json:"status"`
+	// Optimization is the ID of what the strategy applied.
+	Optimization string `json:"optimization,omitempty"`
+	Image        string `json:"image,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	Error        string `json:"error,omitempty"`
+	// Diagnoses are the likely causes of a broken build.
+	Diagnoses []models.BuildDiagnosis `json:"diagnoses,omitempty"`
+	// Dockerfile is the Dockerfile the strategy produced, kept for broken
+	// builds.
+	Dockerfile string `json:"dockerfile,omitempty"`
+}
+
+// FixtureResult is every strategy tested on one fixture.
+type FixtureResult struct {
+	Name  string `json:"name"`
+	Image string `json:"image,omitempty"`
+	Size  int64  `json:"size,omitempty"`
+	// Error is set when the fixture doesn't build unchanged; its
+	// strategies are then not tested.
+	Error   string   `json:"error,omitempty"`
+	Results []Result `json:"results,omitempty"`
+}
+
+// Report is the result of a test run.
+type Report struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Fixtures  []FixtureResult `json:"fixtures"`
+}
+
+// Run tests the strategies on each fixture. The fixture is copied to a
+// temporary directory and built unchanged, then each strategy is applied
+// alone in autofix mode and the result built in the same context.
+func Run(fixtures []Fixture, build BuildFunc, opts Options) (*Report, error) {
+	if len(fixtures) == 0 {
+		return nil, fmt.Errorf("no fixtures to test")
+	}
+	strategies, err := selectStrategies(opts.Strategies)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Timestamp: time.Now()}
+	for i, f := range fixtures {
+		fr, err := runFixture(i, f, strategies, build, opts)
+		if err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", f.Name, err)
+		}
+		report.Fixtures = append(report.Fixtures, fr)
+	}
+	return report, nil
+}
+
+func runFixture(i int, f Fixture, strategies []optimizer.Strategy, build BuildFunc, opts Options) (FixtureResult, error) {
+	fr := FixtureResult{Name: f.Name, Image: Tag(i, f.Name, "before")}
+	content, err := fs.ReadFile(f.Context, f.Dockerfile)
+	if err != nil {
+		return fr, err
+	}
+	dir, err := os.MkdirTemp("", "dio-strategy-test-")
+	if err != nil {
+		return fr, err
+	}
+	defer os.RemoveAll(dir)
+	if err := copyContext(f.Context, dir); err != nil {
+		return fr, fmt.Errorf("failed to copy the build context: %w", err)
+	}
+
+	before, err := build(filepath.Join(dir, filepath.FromSlash(f.Dockerfile)), dir, fr.Image)
+	if err != nil {
+		fr.Error = err.Error()
+		return fr, nil
+	}
+	fr.Size = before.Size
+
+	for _, s := range strategies {
+		r := runStrategy(i, f, s, string(content), dir, build)
+		if opts.OnResult != nil {
+			opts.OnResult(f.Name, r)
+		}
+		fr.Results = append(fr.Results, r)
+	}
+	return fr, nil
+}
+
+func runStrategy(i int, f Fixture, s optimizer.Strategy, content, dir string, build BuildFunc) Result {
+	r := Result{Strategy: s.Name(), Status: StatusNotApplicable}
+	opt, err := optimizer.NewWithStrategies(optimizer.ModeAutoFix, s).OptimizeContent(content)
+	if err != nil {
+		r.Status, r.Error = StatusBroken, err.Error()
+		return r
+	}
+	for _, o := range opt.Optimizations {
+		if o.Rejected != "" {
+			r.Status, r.Optimization = StatusBroken, o.ID
+			r.Error = "invalid Dockerfile: " + o.Rejected
+			return r
+		}
+	}
+	if opt.OptimizedDockerfile == content {
+		return r
+	}
+	for _, o := range opt.Optimizations {
+		if o.Applied {
+			r.Optimization = o.ID
+		}
+	}
+
+	dockerfile := filepath.Join(dir, "Dockerfile.dio-"+s.Name())
+	if err := os.WriteFile(dockerfile, []byte(opt.OptimizedDockerfile), 0o644); err != nil {
+		r.Status, r.Error = StatusBroken, err.Error()
+		return r
+	}
+	defer os.Remove(dockerfile)
+
+	r.Image = Tag(i, f.Name, s.Name())
+	after, err := build(dockerfile, dir, r.Image)
+	if err != nil {
+		r.Status = StatusBroken
+		r.Error = err.Error()
+		r.Diagnoses = diagnose.Build(err.Error(), dockerfile, dir)
+		r.Dockerfile = opt.OptimizedDockerfile
+		return r
+	}
+	r.Status = StatusPassed
+	r.Size = after.Size
+	return r
+}
+
+// selectStrategies returns the built-in strategies with the given names,
+// or all of them.
+func selectStrategies(names []string) ([]optimizer.Strategy, error) {
+	all := optimizer.Strategies()
+	if len(names) == 0 {
+		return all, nil
+	}
+	byName := make(map[string]optimizer.Strategy, len(all))
+	var known []string
+	for _, s := range all {
+		byName[s.Name()] = s
+		known = append(known, s.Name())
+	}
+	var selected []optimizer.Strategy
+	for _, name := range names {
+		s, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown strategy %q (available: %s)", name, strings.Join(known, ", "))
+		}
+		selected = append(selected, s)
+	}
+	return selected, nil
+}
+
+// copyContext copies a build context into dir, leaving out .git.
+func copyContext(src fs.FS, dir string) error {
+	return fs.WalkDir(src, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(p))
+		switch {
+		case d.IsDir() && d.Name() == ".git":
+			return fs.SkipDir
+		case d.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case !d.Type().IsRegular():
+			return nil
+		}
+		data, err := fs.ReadFile(src, p)
+		if err != nil {
+			return err
+		}
+		mode := fs.FileMode(0o644)
+		if info, err := d.Info(); err == nil && info.Mode()&0o111 != 0 {
+			mode = 0o755
+		}
+		return os.WriteFile(target, data, mode)
+	})
+}
+
+var tagUnsafe = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// Tag returns the image tag of a fixture build, e.g.
+// dio-strategy-test:1-node-multi-stage-build.
+func Tag(i int, fixture, build string) string {
+	name := strings.Trim(tagUnsafe.ReplaceAllString(strings.ToLower(fixture+"-"+build), "-"), "-.")
+	tag := fmt.Sprintf("%d-%s", i+1, name)
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return "dio-strategy-test:" + tag
+}
+
+// Images returns the tags of every image the run built.
+func (r *Report) Images() []string {
+	var images []string
+	for _, f := range r.Fixtures {
+		if f.Error == "" {
+			images = append(images, f.Image)
+		}
+		for _, res := range f.Results {
+			if res.Status == StatusPassed {
+				images = append(images, res.Image)
+			}
+		}
+	}
+	return images
+}
+
+// Broken returns the names of the strategies that broke at least one
+// fixture, sorted.
+func (r *Report) Broken() []string {
+	seen := make(map[string]bool)
+	var broken []string
+	for _, f := range r.Fixtures {
+		for _, res := range f.Results {
+			if res.Status == StatusBroken && !seen[res.Strategy] {
+				seen[res.Strategy] = true
+				broken = append(broken, res.Strategy)
+			}
+		}
+	}
+	sort.Strings(broken)
+	return broken
+}
+
+// Markdown renders the report as a strategy × fixture matrix followed by
+// the details of each broken build.
+func (r *Report) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("# 🧪 DIO Strategy Test\n\n")
+
+	var strategies []string
+	seen := make(map[string]bool)
+	for _, f := range r.Fixtures {
+		for _, res := range f.Results {
+			if !seen[res.Strategy] {
+				seen[res.Strategy] = true
+				strategies = append(strategies, res.Strategy)
+			}
+		}
+	}
+
+	sb.WriteString("| Strategy |")
+	for _, f := range r.Fixtures {
+		sb.WriteString(fmt.Sprintf(" %s |", f.Name))
+	}
+	sb.WriteString("\n|----------|")
+	sb.WriteString(strings.Repeat("---|", len(r.Fixtures)))
+	sb.WriteString("\n")
+	for _, s := range strategies {
+		sb.WriteString(fmt.Sprintf("| %s |", s))
+		for _, f := range r.Fixtures {
+			sb.WriteString(" " + cell(f, s) + " |")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n✅ builds · ❌ broken · — not applicable · ⚠️ fixture doesn't build unchanged\n\n")
+
+	for _, f := range r.Fixtures {
+		if f.Error != "" {
+			sb.WriteString(fmt.Sprintf("## ⚠️ %s doesn't build\n\n```\n%s\n```\n\n", f.Name, docker.LastLines(f.Error, 20)))
+		}
+		for _, res := range f.Results {
+			if res.Status != StatusBroken {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("## ❌ %s on %s\n\n", res.Strategy, f.Name))
+			for _, d := range res.Diagnoses {
+				sb.WriteString(fmt.Sprintf("- %s\n  → %s\n", d.Message, d.Hint))
+			}
+			if res.Dockerfile != "" {
+				sb.WriteString(fmt.Sprintf("\n```dockerfile\n%s\n```\n", strings.TrimRight(res.Dockerfile, "\n")))
+			}
+			sb.WriteString(fmt.Sprintf("\n<details><summary>Build output (last lines)</summary>\n\n```\n%s\n```\n</details>\n\n", docker.LastLines(res.Error, 20)))
+		}
+	}
+	return sb.String()
+}
+
+// cell is the matrix entry of a strategy on a fixture.
+func cell(f FixtureResult, strategy string) string {
+	if f.Error != "" {
+		return "⚠️"
+	}
+	for _, res := range f.Results {
+		if res.Strategy != strategy {
+			continue
+		}
+		switch res.Status {
+		case StatusPassed:
+			return "✅"
+		case StatusBroken:
+			return "❌"
+		}
+	}
+	return "—"
+}
@@ -0,0 +1,125 @@
+package strategytest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func TestBuiltin(t *testing.T) {
+	fixtures := Builtin()
+	if len(fixtures) < 3 {
+		t.Fatalf("expected at least 3 built-in fixtures, got %d", len(fixtures))
+	}
+	for _, f := range fixtures {
+		if _, err := f.Context.Open(f.Dockerfile); err != nil {
+			t.Errorf("fixture %s has no Dockerfile: %v", f.Name, err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	fixture := Fixture{
+		Name: "app",
+		Context: fstest.MapFS{
+			"Dockerfile":   {Data: []byte("FROM python:3.12\nCOPY app.py /app/app.py\nCMD python /app/app.py\n")},
+			"app.py":       {Data: []byte("print('ok')\n")},
+			".git/HEAD":    {Data: []byte("ref: refs/heads/main\n")},
+			"scripts/x.sh": {Data: []byte("#!/bin/sh\n"), Mode: 0o755},
+		},
+		Dockerfile: "Dockerfile",
+	}
+
+	var tags []string
+	build := func(dockerfile, contextDir, tag string) (*models.ImageMetrics, error) {
+		tags = append(tags, tag)
+		if _, err := os.Stat(filepath.Join(contextDir, "app.py")); err != nil {
+			t.Errorf("context not copied: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(contextDir, ".git")); err == nil {
+			t.Error(".git should not be copied")
+		}
+		data, err := os.ReadFile(dockerfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Pretend the slim base lacks what the app needs
+		if strings.Contains(string(data), "-slim") {
+			return nil, errors.New("docker build failed: exit status 1\noutput: /bin/sh: 1: gcc: not found")
+		}
+		return &models.ImageMetrics{ImageName: tag, Size: 100}, nil
+	}
+
+	var seen []string
+	report, err := Run([]Fixture{fixture}, build, Options{
+		Strategies: []string{"base-image-optimization", "workdir", "cache-optimization"},
+		OnResult:   func(fixture string, r Result) { seen = append(seen, fixture+"/"+r.Strategy) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 3 {
+		t.Errorf("OnResult called for %v", seen)
+	}
+	results := report.Fixtures[0].Results
+	if results[0].Status != StatusBroken || len(results[0].Diagnoses) != 1 || !strings.Contains(results[0].Dockerfile, "-slim") {
+		t.Errorf("expected the base image switch to break the build, got %+v", results[0])
+	}
+	if results[1].Status != StatusPassed || results[1].Image != "dio-strategy-test:1-app-workdir" {
+		t.Errorf("expected workdir to pass, got %+v", results[1])
+	}
+	if results[2].Status != StatusNotApplicable {
+		t.Errorf("expected cache-optimization not to apply, got %+v", results[2])
+	}
+	if got := report.Broken(); len(got) != 1 || got[0] != "base-image-optimization" {
+		t.Errorf("Broken() = %v", got)
+	}
+	if got := report.Images(); len(got) != 2 || got[0] != "dio-strategy-test:1-app-before" {
+		t.Errorf("Images() = %v", got)
+	}
+	md := report.Markdown()
+	for _, want := range []string{"| base-image-optimization | ❌ |", "| workdir | ✅ |", "## ❌ base-image-optimization on app", "gcc is not installed"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown doesn't contain %q:\n%s", want, md)
+		}
+	}
+
+	if _, err := Run([]Fixture{fixture}, build, Options{Strategies: []string{"nope"}}); err == nil {
+		t.Error("expected an unknown strategy to be rejected")
+	}
+}
+
+func TestRun_FixtureBroken(t *testing.T) {
+	fixture := Fixture{Name: "bad", Context: fstest.MapFS{"Dockerfile": {Data: []byte("FROM scratch\n")}}, Dockerfile: "Dockerfile"}
+	calls := 0
+	build := func(dockerfile, contextDir, tag string) (*models.ImageMetrics, error) {
+		calls++
+		return nil, errors.New("docker build failed")
+	}
+	report, err := Run([]Fixture{fixture}, build, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 || report.Fixtures[0].Error == "" || len(report.Fixtures[0].Results) != 0 {
+		t.Errorf("expected strategies to be skipped on a fixture that doesn't build, got %+v", report.Fixtures[0])
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile.prod"), []byte("FROM alpine\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Load(filepath.Join(dir, "Dockerfile.prod"))
+	if err != nil || f.Dockerfile != "Dockerfile.prod" || !strings.HasSuffix(f.Name, "/Dockerfile.prod") {
+		t.Errorf("Load = %+v, %v", f, err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Error("expected a directory without a Dockerfile to be rejected")
+	}
+}
@@ -0,0 +1,226 @@
+// Package testutil checks analyzer rules and optimizer strategies against
+// golden files, so new rules and strategies can be tested table-driven the
+// way the built-in ones are.
+//
+// A test lists Dockerfiles and the rules or strategies to run on them; the
+// issues found or the optimized Dockerfile are compared with a golden file
+// under testdata/golden. Run the tests with -update to write the golden
+// files from the current output, then review the diff:
+//
+//	func TestMyRule(t *testing.T) {
+//		testutil.RunRules(t, []analyzer.Rule{&MyRule{}}, []testutil.Case{
+//			{Name: "latest", Dockerfile: "FROM alpine\n"},
+//			{Name: "pinned", Dockerfile: "FROM alpine:3.19\n"},
+//		})
+//	}
+//
+//	go test ./... -run TestMyRule -update
+package testutil
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/optimizer"
+)
+
+// GoldenDir is where golden files are kept, relative to the test's
+// package directory.
+const GoldenDir = "testdata/golden"
+
+var update = flag.Bool("update", false, "write golden files from the current output")
+
+// Case is a Dockerfile checked against a golden file.
+type Case struct {
+	// Name names the subtest and, unless Golden is set, the golden file.
+	Name       string
+	Dockerfile string
+	// BuildArgs resolve ARG references in FROM, like --build-arg.
+	BuildArgs map[string]string
+	// Golden overrides the golden file path.
+	Golden string
+}
+
+// RunRules analyzes each case with only the given rules and compares the
+// issues found with <GoldenDir>/<name>.issues.golden.
+func RunRules(t *testing.T, rules []analyzer.Rule, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			a := analyzer.NewWithRules(rules...)
+			a.SetBuildArgs(c.BuildArgs)
+			result, err := a.AnalyzeContent(c.Dockerfile)
+			if err != nil {
+				t.Fatalf("analysis failed: %v", err)
+			}
+			AssertIssues(t, goldenPath(c, ".issues.golden"), result)
+		})
+	}
+}
+
+// RunStrategies optimizes each case in autofix mode with only the given
+// strategies and compares the optimizations and optimized Dockerfile with
+// <GoldenDir>/<name>.optimized.golden.
+func RunStrategies(t *testing.T, strategies []optimizer.Strategy, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			o := optimizer.NewWithStrategies(optimizer.ModeAutoFix, strategies...)
+			o.SetBuildArgs(c.BuildArgs)
+			result, err := o.OptimizeContent(c.Dockerfile)
+			if err != nil {
+				t.Fatalf("optimization failed: %v", err)
+			}
+			AssertOptimized(t, goldenPath(c, ".optimized.golden"), result)
+		})
+	}
+}
+
+// Cases loads a case for each *.Dockerfile in dir, named after the file.
+func Cases(t testing.TB, dir string) []Case {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []Case
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cases = append(cases, Case{Name: strings.TrimSuffix(filepath.Base(p), ".Dockerfile"), Dockerfile: string(data)})
+	}
+	if len(cases) == 0 {
+		t.Fatalf("no *.Dockerfile cases in %s", dir)
+	}
+	return cases
+}
+
+// AssertIssues compares the issues of an analysis with a golden file.
+func AssertIssues(t testing.TB, golden string, result *models.AnalysisResult) {
+	t.Helper()
+	Golden(t, golden, []byte(FormatIssues(result.Issues)))
+}
+
+// AssertOptimized compares an optimization result with a golden file.
+func AssertOptimized(t testing.TB, golden string, result *models.OptimizationResult) {
+	t.Helper()
+	Golden(t, golden, []byte(FormatOptimization(result)))
+}
+
+// FormatIssues renders issues one per line, in the order found, as
+// "<line> <id> <severity> <category>: <title>". Descriptions and
+// suggestions are left out so that rewording them doesn't churn golden
+// files.
+func FormatIssues(issues []models.Issue) string {
+	if len(issues) == 0 {
+		return "no issues\n"
+	}
+	var sb strings.Builder
+	for _, issue := range issues {
+		fmt.Fprintf(&sb, "%d %s %s %s: %s\n", issue.Line, issue.ID, issue.Severity, issue.Category, issue.Title)
+	}
+	return sb.String()
+}
+
+// FormatOptimization renders the optimizations found, marking those
+// applied with "+", those of low confidence and those whose fix was
+// rejected, and listing the issues each fixes, followed by the optimized
+// Dockerfile.
+func FormatOptimization(result *models.OptimizationResult) string {
+	var sb strings.Builder
+	for _, opt := range result.Optimizations {
+		mark := "-"
+		if opt.Applied {
+			mark = "+"
+		}
+		fmt.Fprintf(&sb, "%s %s: %s", mark, opt.ID, opt.Title)
+		if opt.Confidence == models.ConfidenceLow {
+			sb.WriteString(" [low confidence]")
+		}
+		if len(opt.RelatedIssueIDs) > 0 {
+			fmt.Fprintf(&sb, " (fixes %s)", strings.Join(opt.RelatedIssueIDs, ", "))
+		}
+		if opt.Rejected != "" {
+			fmt.Fprintf(&sb, " [rejected: %s]", opt.Rejected)
+		}
+		sb.WriteString("\n")
+	}
+	if len(result.Optimizations) == 0 {
+		sb.WriteString("no optimizations\n")
+	}
+	sb.WriteString("---\n")
+	sb.WriteString(result.OptimizedDockerfile)
+	if !strings.HasSuffix(result.OptimizedDockerfile, "\n") {
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Golden compares got with the golden file at path. With -update, it
+// writes got to the file instead.
+func Golden(t testing.TB, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		t.Fatalf("golden file %s doesn't exist (run with -update to create it)", path)
+	case err != nil:
+		t.Fatal(err)
+	case !bytes.Equal(got, want):
+		t.Errorf("output differs from %s (run with -update to accept it):\n%s", path, diff(string(want), string(got)))
+	}
+}
+
+// diff shows the lines of want and got that differ, prefixed with - and +.
+func diff(want, got string) string {
+	wl := strings.Split(want, "\n")
+	gl := strings.Split(got, "\n")
+	var sb strings.Builder
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w == g {
+			continue
+		}
+		if i < len(wl) {
+			fmt.Fprintf(&sb, "%4d - %s\n", i+1, w)
+		}
+		if i < len(gl) {
+			fmt.Fprintf(&sb, "%4d + %s\n", i+1, g)
+		}
+	}
+	return sb.String()
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+func goldenPath(c Case, suffix string) string {
+	if c.Golden != "" {
+		return c.Golden
+	}
+	return filepath.Join(GoldenDir, unsafeName.ReplaceAllString(c.Name, "_")+suffix)
+}
@@ -0,0 +1,95 @@
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/analyzer"
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// maintainerRule is a custom rule as a rule author would write it.
+type maintainerRule struct{}
+
+func (r *maintainerRule) ID() string { return "X001" }
+
+func (r *maintainerRule) Check(ctx *analyzer.AnalysisContext) []models.Issue {
+	var issues []models.Issue
+	for _, inst := range ctx.ParsedFile.Instructions {
+		if inst.Command == "MAINTAINER" {
+			issues = append(issues, models.Issue{
+				ID:       r.ID(),
+				Severity: models.SeverityLow,
+				Category: "best-practice",
+				Title:    "MAINTAINER is deprecated",
+				Line:     inst.Line,
+			})
+		}
+	}
+	return issues
+}
+
+func TestRunRules(t *testing.T) {
+	RunRules(t, []analyzer.Rule{&maintainerRule{}}, []Case{
+		{Name: "maintainer", Dockerfile: "FROM alpine:3.19\nMAINTAINER dev@example.com\n"},
+		{Name: "label", Dockerfile: "FROM alpine:3.19\nLABEL maintainer=dev@example.com\n"},
+	})
+}
+
+// recorder captures the failures of a test.
+type recorder struct {
+	testing.TB
+	failure string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failure = fmt.Sprintf(format, args...)
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.failure = fmt.Sprintf(format, args...)
+}
+
+func TestGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.golden")
+	if err := os.WriteFile(path, []byte("a\nb\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &recorder{TB: t}
+	Golden(r, path, []byte("a\nb\nc\n"))
+	if r.failure != "" {
+		t.Errorf("expected a match, got %q", r.failure)
+	}
+
+	Golden(r, path, []byte("a\nB\nc\n"))
+	if !strings.Contains(r.failure, "   2 - b\n   2 + B\n") {
+		t.Errorf("expected a diff of line 2, got %q", r.failure)
+	}
+
+	r.failure = ""
+	Golden(r, filepath.Join(t.TempDir(), "missing.golden"), []byte("a\n"))
+	if !strings.Contains(r.failure, "-update") {
+		t.Errorf("expected a missing golden file to fail, got %q", r.failure)
+	}
+}
+
+func TestFormatOptimization(t *testing.T) {
+	got := FormatOptimization(&models.OptimizationResult{
+		OptimizedDockerfile: "FROM alpine:3.19",
+		Optimizations: []models.Optimization{
+			{ID: "OPT-BASE", Title: "Use a smaller base image", Applied: true},
+			{ID: "OPT-CACHE", Title: "Reorder COPY"},
+			{ID: "OPT-MULTISTAGE", Title: "Introduce multi-stage build", Confidence: models.ConfidenceLow},
+		},
+	})
+	want := "+ OPT-BASE: Use a smaller base image\n- OPT-CACHE: Reorder COPY\n- OPT-MULTISTAGE: Introduce multi-stage build [low confidence]\n---\nFROM alpine:3.19\n"
+	if got != want {
+		t.Errorf("FormatOptimization = %q, want %q", got, want)
+	}
+}
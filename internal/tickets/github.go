@@ -0,0 +1,105 @@
+package tickets
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/httpjson"
+)
+
+var fingerprintMarkerRegex = regexp.MustCompile(`<!-- dio-fingerprint: ([0-9a-f]+) -->`)
+
+// GitHub files findings as GitHub issues. The fingerprint is embedded in
+// the issue body as an HTML comment.
+type GitHub struct {
+	Repo       string // owner/name
+	Token      string
+	Labels     []string
+	APIURL     string // default httpjson.DefaultGitHubAPI, or a GitHub Enterprise API URL
+	HTTPClient *http.Client
+
+	open map[string]int // fingerprint → issue number, loaded on first Find
+}
+
+type githubIssue struct {
+	Number      int       `json:"number"`
+	Body        string    `json:"body"`
+	PullRequest *struct{} `json:"pull_request"`
+}
+
+// Find looks up the open issue for a fingerprint. Open issues carrying the
+// configured labels are listed once and indexed by fingerprint.
+func (g *GitHub) Find(fingerprint string) (string, bool, error) {
+	if g.open == nil {
+		if err := g.loadOpenIssues(); err != nil {
+			return "", false, err
+		}
+	}
+	number, ok := g.open[fingerprint]
+	if !ok {
+		return "", false, nil
+	}
+	return strconv.Itoa(number), true, nil
+}
+
+func (g *GitHub) loadOpenIssues() error {
+	open := make(map[string]int)
+	for page := 1; ; page++ {
+		query := url.Values{"state": {"open"}, "per_page": {"100"}, "page": {strconv.Itoa(page)}}
+		if len(g.Labels) > 0 {
+			query.Set("labels", strings.Join(g.Labels, ","))
+		}
+		var issues []githubIssue
+		if err := g.do(http.MethodGet, "/issues?"+query.Encode(), nil, &issues); err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			if issue.PullRequest != nil {
+				continue
+			}
+			if m := fingerprintMarkerRegex.FindStringSubmatch(issue.Body); m != nil {
+				open[m[1]] = issue.Number
+			}
+		}
+		if len(issues) < 100 {
+			break
+		}
+	}
+	g.open = open
+	return nil
+}
+
+// Create opens a new issue.
+func (g *GitHub) Create(f Finding) (string, error) {
+	in := map[string]interface{}{
+		"title":  f.Title,
+		"body":   githubBody(f),
+		"labels": append([]string{}, g.Labels...),
+	}
+	var issue githubIssue
+	if err := g.do(http.MethodPost, "/issues", in, &issue); err != nil {
+		return "", err
+	}
+	if g.open != nil {
+		g.open[f.Fingerprint] = issue.Number
+	}
+	return strconv.Itoa(issue.Number), nil
+}
+
+// Update refreshes the title and body of an issue.
+func (g *GitHub) Update(id string, f Finding) error {
+	in := map[string]interface{}{"title": f.Title, "body": githubBody(f)}
+	return g.do(http.MethodPatch, "/issues/"+id, in, nil)
+}
+
+func (g *GitHub) do(method, path string, in, out interface{}) error {
+	api := &httpjson.GitHub{Repo: g.Repo, Token: g.Token, APIURL: g.APIURL, HTTPClient: g.HTTPClient}
+	return api.Do(method, path, in, out)
+}
+
+func githubBody(f Finding) string {
+	return f.Body + "\n\n" + fingerprintMarker(f.Fingerprint)
+}
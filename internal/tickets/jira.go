@@ -0,0 +1,92 @@
+package tickets
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/httpjson"
+)
+
+// Jira files findings as Jira issues. The fingerprint is stored as a
+// "dio-<fingerprint>" label so it can be searched with JQL.
+type Jira struct {
+	URL        string // e.g. https://corp.atlassian.net
+	Project    string // project key
+	IssueType  string // default "Bug"
+	User       string // basic auth user (email for Jira Cloud)
+	Token      string // API token
+	Labels     []string
+	HTTPClient *http.Client
+}
+
+// Find searches for an unresolved issue with the fingerprint label.
+func (j *Jira) Find(fingerprint string) (string, bool, error) {
+	in := map[string]interface{}{
+		"jql":        fmt.Sprintf(`project = "%s" AND labels = "%s" AND resolution = Unresolved`, j.Project, jiraLabel(fingerprint)),
+		"fields":     []string{"summary"},
+		"maxResults": 1,
+	}
+	var out struct {
+		Issues []struct {
+			Key string `json:"key"`
+		} `json:"issues"`
+	}
+	if err := j.do(http.MethodPost, "/rest/api/2/search", in, &out); err != nil {
+		return "", false, err
+	}
+	if len(out.Issues) == 0 {
+		return "", false, nil
+	}
+	return out.Issues[0].Key, true, nil
+}
+
+// Create opens a new issue.
+func (j *Jira) Create(f Finding) (string, error) {
+	issueType := j.IssueType
+	if issueType == "" {
+		issueType = "Bug"
+	}
+	in := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": j.Project},
+			"issuetype":   map[string]string{"name": issueType},
+			"summary":     f.Title,
+			"description": f.Body,
+			"labels":      append(append([]string{}, j.Labels...), jiraLabel(f.Fingerprint)),
+		},
+	}
+	var out struct {
+		Key string `json:"key"`
+	}
+	if err := j.do(http.MethodPost, "/rest/api/2/issue", in, &out); err != nil {
+		return "", err
+	}
+	return out.Key, nil
+}
+
+// Update refreshes the summary and description of an issue.
+func (j *Jira) Update(id string, f Finding) error {
+	in := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"summary":     f.Title,
+			"description": f.Body,
+		},
+	}
+	return j.do(http.MethodPut, "/rest/api/2/issue/"+id, in, nil)
+}
+
+func (j *Jira) do(method, path string, in, out interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(j.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	if j.User != "" || j.Token != "" {
+		req.SetBasicAuth(j.User, j.Token)
+	}
+	return httpjson.Do(j.HTTPClient, req, in, out)
+}
+
+func jiraLabel(fingerprint string) string {
+	return "dio-" + fingerprint
+}
@@ -0,0 +1,139 @@
+// Package tickets turns pipeline findings — failed policy rules and severe
+// CVEs — into tracked issues in Jira or GitHub Issues. Each finding carries a
+// fingerprint so repeated runs update the existing ticket instead of filing
+// a duplicate.
+package tickets
+
+import (
+	"fmt"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Finding is a single problem to track as a ticket.
+type Finding struct {
+	Fingerprint string
+	Title       string
+	Body        string
+	Severity    models.Severity
+}
+
+// Tracker is an issue tracker that findings are exported to.
+type Tracker interface {
+	// Find returns the ID of the open ticket for a fingerprint, if any. A
+	// finding that recurs after its ticket was closed gets a new ticket.
+	Find(fingerprint string) (id string, found bool, err error)
+	// Create files a new ticket and returns its ID.
+	Create(f Finding) (string, error)
+	// Update refreshes the title and description of an open ticket.
+	Update(id string, f Finding) error
+}
+
+// Summary counts what an export did.
+type Summary struct {
+	Created []string
+	Updated []string
+}
+
+// Options selects which findings are exported.
+type Options struct {
+	// MinSeverity is the lowest CVE severity exported (default critical).
+	MinSeverity models.Severity
+}
+
+// Findings collects the failed policy rules and the CVEs at or above the
+// minimum severity from a pipeline result.
+func Findings(result *models.PipelineResult, opts Options) []Finding {
+	subject := result.Image
+	if subject == "" {
+		subject = result.Dockerfile
+	}
+	minSeverity := opts.MinSeverity
+	if minSeverity == "" {
+		minSeverity = models.SeverityCritical
+	}
+
+	var findings []Finding
+	if result.Policy != nil {
+		for _, rule := range result.Policy.Rules {
+			if rule.Passed || rule.NotEvaluated {
+				continue
+			}
+			severity := models.SeverityHigh
+			if rule.Enforcement == models.EnforcementWarn {
+				severity = models.SeverityMedium
+			}
+			findings = append(findings, Finding{
+				Fingerprint: models.Fingerprint("policy", rule.Name, subject),
+				Title:       fmt.Sprintf("[DIO] Policy %s failed for %s", rule.Name, subject),
+				Body: fmt.Sprintf("%s\n\n%s\n\nEnforcement: %s\nSubject: %s",
+					rule.Description, rule.Message, rule.Enforcement, subject),
+				Severity: severity,
+			})
+		}
+	}
+
+	// Export the final image's CVEs: the optimized image when one was
+	// built, otherwise the baseline
+	scan := result.FinalScan()
+	if scan == nil {
+		return findings
+	}
+	seen := make(map[string]bool)
+	for _, v := range scan.Vulnerabilities {
+		if !v.Severity.AtLeast(minSeverity) {
+			continue
+		}
+		id := v.Fingerprint
+		if id == "" {
+			id = models.Fingerprint(v.ID, v.Package)
+		}
+		fp := models.Fingerprint("cve", id, subject)
+		if seen[fp] {
+			continue
+		}
+		seen[fp] = true
+		fixed := "no fix available"
+		if v.FixedVersion != "" {
+			fixed = "fixed in " + v.FixedVersion
+		}
+		findings = append(findings, Finding{
+			Fingerprint: fp,
+			Title:       fmt.Sprintf("[DIO] %s in %s (%s)", v.ID, v.Package, subject),
+			Body: fmt.Sprintf("%s\n\n%s\n\nSeverity: %s\nPackage: %s %s (%s)\nImage: %s",
+				v.Title, v.Description, v.Severity, v.Package, v.Version, fixed, scan.ImageName),
+			Severity: v.Severity,
+		})
+	}
+	return findings
+}
+
+// Export creates a ticket for every new finding and updates the tickets of
+// findings that were already exported.
+func Export(tracker Tracker, findings []Finding) (*Summary, error) {
+	summary := &Summary{}
+	for _, f := range findings {
+		id, found, err := tracker.Find(f.Fingerprint)
+		if err != nil {
+			return summary, fmt.Errorf("looking up %s: %w", f.Title, err)
+		}
+		if found {
+			if err := tracker.Update(id, f); err != nil {
+				return summary, fmt.Errorf("updating %s: %w", id, err)
+			}
+			summary.Updated = append(summary.Updated, id)
+			continue
+		}
+		id, err = tracker.Create(f)
+		if err != nil {
+			return summary, fmt.Errorf("creating %s: %w", f.Title, err)
+		}
+		summary.Created = append(summary.Created, id)
+	}
+	return summary, nil
+}
+
+// fingerprintMarker embeds a fingerprint in a ticket body.
+func fingerprintMarker(fp string) string {
+	return fmt.Sprintf("<!-- dio-fingerprint: %s -->", fp)
+}
@@ -0,0 +1,90 @@
+package tickets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+func sampleResult() *models.PipelineResult {
+	return &models.PipelineResult{
+		Dockerfile: "Dockerfile",
+		Policy: &models.PolicyResult{Rules: []models.PolicyRule{
+			{Name: "max_image_size", Passed: true},
+			{Name: "max_critical_cves", Passed: false, Enforcement: models.EnforcementDeny, Message: "Found 1 critical CVEs (max: 0)"},
+		}},
+		ScanResult: &models.ScanResult{ImageName: "dio-app:baseline", Vulnerabilities: []models.Vulnerability{
+			{ID: "CVE-2024-0001", Package: "openssl", Severity: models.SeverityCritical},
+			{ID: "CVE-2024-0002", Package: "zlib", Severity: models.SeverityHigh},
+		}},
+	}
+}
+
+func TestFindings(t *testing.T) {
+	findings := Findings(sampleResult(), Options{})
+	if len(findings) != 2 {
+		t.Fatalf("expected the failed rule and the critical CVE, got %d findings", len(findings))
+	}
+	if len(Findings(sampleResult(), Options{MinSeverity: models.SeverityHigh})) != 3 {
+		t.Error("expected min_severity high to include the high CVE")
+	}
+
+	// Fingerprints don't depend on the scanned tag or line numbers
+	other := sampleResult()
+	other.ScanResult.ImageName = "dio-app:optimized"
+	if Findings(other, Options{})[1].Fingerprint != findings[1].Fingerprint {
+		t.Error("expected a stable CVE fingerprint across runs")
+	}
+}
+
+func TestExport_GitHubDedup(t *testing.T) {
+	var mu sync.Mutex
+	issues := map[int]string{} // number → body
+	created, updated := 0, 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var in struct {
+			Body string `json:"body"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/acme/app/issues":
+			if r.URL.Query().Get("labels") != "dio" {
+				t.Errorf("expected issues to be filtered by label, got %q", r.URL.RawQuery)
+			}
+			var list []map[string]interface{}
+			for n, body := range issues {
+				list = append(list, map[string]interface{}{"number": n, "body": body})
+			}
+			json.NewEncoder(w).Encode(list)
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/acme/app/issues":
+			created++
+			issues[created] = in.Body
+			json.NewEncoder(w).Encode(map[string]int{"number": created})
+		case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/repos/acme/app/issues/"):
+			updated++
+			w.Write([]byte("{}"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	findings := Findings(sampleResult(), Options{})
+	for run := 0; run < 2; run++ {
+		tracker := &GitHub{Repo: "acme/app", APIURL: srv.URL, Labels: []string{"dio"}}
+		if _, err := Export(tracker, findings); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+	if created != 2 || updated != 2 {
+		t.Errorf("expected 2 issues created then updated, got %d created, %d updated", created, updated)
+	}
+}
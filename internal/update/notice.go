@@ -0,0 +1,67 @@
+package update
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CheckInterval is how often the update notice contacts GitHub.
+const CheckInterval = 24 * time.Hour
+
+// noticeTimeout bounds the release lookup so a slow network never delays
+// the command that triggered it by more than a moment.
+const noticeTimeout = 2 * time.Second
+
+// checkState is remembered between runs so the network is hit at most once
+// per CheckInterval.
+type checkState struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Latest    string    `json:"latest"`
+}
+
+// DefaultStatePath returns ~/.dio/update-check.json.
+func DefaultStatePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".dio", "update-check.json"), nil
+}
+
+// Notice returns a one-line message when a release newer than current
+// exists, or "" otherwise. The latest version is looked up at most once per
+// CheckInterval and remembered in statePath; any failure yields "".
+func (c *Client) Notice(current, statePath string) string {
+	var state checkState
+	if data, err := os.ReadFile(statePath); err == nil {
+		_ = json.Unmarshal(data, &state)
+	}
+
+	if time.Since(state.CheckedAt) >= CheckInterval {
+		quick := *c
+		if quick.HTTPClient == nil {
+			quick.HTTPClient = &http.Client{Timeout: noticeTimeout}
+		}
+		rel, err := quick.Latest()
+		// Record failed checks too, so an offline machine doesn't retry on
+		// every run.
+		state = checkState{CheckedAt: time.Now()}
+		if err == nil {
+			state.Latest = rel.Version
+		}
+		if data, err := json.Marshal(state); err == nil {
+			if os.MkdirAll(filepath.Dir(statePath), 0o755) == nil {
+				_ = os.WriteFile(statePath, data, 0o644)
+			}
+		}
+	}
+
+	if state.Latest == "" || !Newer(state.Latest, current) {
+		return ""
+	}
+	return fmt.Sprintf("A new version of dio is available: %s → %s. Run `dio self-update` to upgrade.", current, state.Latest)
+}
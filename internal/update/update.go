@@ -0,0 +1,262 @@
+// Package update checks GitHub releases for newer versions of DIO and
+// replaces the running binary with a checksum-verified download.
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultAPIURL is the GitHub REST API endpoint.
+	DefaultAPIURL = "https://api.github.com"
+	// DefaultRepo is the repository DIO releases are published in.
+	DefaultRepo = "maxlar/docker-image-optimizer"
+	// ChecksumsAsset is the release asset listing the SHA-256 of every
+	// binary, in sha256sum format.
+	ChecksumsAsset = "checksums.txt"
+)
+
+// maxBinarySize bounds downloads so a bad release can't fill the disk.
+const maxBinarySize = 256 << 20
+
+// defaultHTTPClient is used when a Client has no HTTP client configured.
+var defaultHTTPClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Release is a published DIO release.
+type Release struct {
+	Version string // without the leading "v"
+	URL     string // release page
+	Assets  []Asset
+}
+
+// Asset is a file attached to a release.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+type githubRelease struct {
+	TagName string  `json:"tag_name"`
+	HTMLURL string  `json:"html_url"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Client looks up and installs releases.
+type Client struct {
+	Repo       string // owner/name, default DefaultRepo
+	APIURL     string // default DefaultAPIURL
+	HTTPClient *http.Client
+}
+
+// AssetName returns the release binary name for a platform, matching the
+// names produced by make build-all.
+func AssetName(goos, goarch string) string {
+	name := "dio-" + goos + "-" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Latest returns the latest published release.
+func (c *Client) Latest() (*Release, error) {
+	apiURL := c.APIURL
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	repo := c.Repo
+	if repo == "" {
+		repo = DefaultRepo
+	}
+
+	body, err := c.get(strings.TrimSuffix(apiURL, "/")+"/repos/"+repo+"/releases/latest", 1<<20)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the latest release: %w", err)
+	}
+	var gr githubRelease
+	if err := json.Unmarshal(body, &gr); err != nil {
+		return nil, fmt.Errorf("failed to parse the latest release: %w", err)
+	}
+	if gr.TagName == "" {
+		return nil, fmt.Errorf("latest release of %s has no tag", repo)
+	}
+	return &Release{
+		Version: strings.TrimPrefix(gr.TagName, "v"),
+		URL:     gr.HTMLURL,
+		Assets:  gr.Assets,
+	}, nil
+}
+
+// Apply downloads the release binary for this platform, verifies it against
+// the release's checksums.txt and replaces the executable at exePath.
+func (c *Client) Apply(rel *Release, exePath string) error {
+	name := AssetName(runtime.GOOS, runtime.GOARCH)
+	binary, ok := rel.asset(name)
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s/%s", rel.Version, runtime.GOOS, runtime.GOARCH)
+	}
+	sums, ok := rel.asset(ChecksumsAsset)
+	if !ok {
+		return fmt.Errorf("release %s has no %s; refusing to install an unverified binary", rel.Version, ChecksumsAsset)
+	}
+
+	data, err := c.get(sums.URL, 1<<20)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", ChecksumsAsset, err)
+	}
+	want, err := checksumFor(data, name)
+	if err != nil {
+		return err
+	}
+
+	data, err = c.get(binary.URL, maxBinarySize)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, want, got)
+	}
+	return replaceExecutable(exePath, data)
+}
+
+func (r *Release) asset(name string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// get fetches a URL, failing on non-2xx responses and bodies over limit.
+func (c *Client) get(url string, limit int64) ([]byte, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("GET %s: response exceeds %d bytes", url, limit)
+	}
+	return data, nil
+}
+
+// checksumFor finds the checksum of name in sha256sum output.
+func checksumFor(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// sha256sum marks binary mode with a leading '*'
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no checksum for %s", ChecksumsAsset, name)
+}
+
+// replaceExecutable atomically swaps the file at path for data. The old
+// binary is moved aside first because Windows cannot overwrite a running
+// executable, and moved back if the swap fails.
+func replaceExecutable(path string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	mode := os.FileMode(0o755)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".dio-update-*")
+	if err != nil {
+		return fmt.Errorf("cannot write next to %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	old := path + ".old"
+	os.Remove(old)
+	if err := os.Rename(path, old); err != nil {
+		return fmt.Errorf("cannot replace %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Rename(old, path)
+		return fmt.Errorf("cannot replace %s: %w", path, err)
+	}
+	// Fails on Windows while the old binary is still running; it is
+	// cleaned up by the next update instead.
+	os.Remove(old)
+	return nil
+}
+
+// Newer reports whether version latest is newer than current. Versions are
+// dotted numbers with an optional "v" prefix and pre-release suffix; a
+// pre-release sorts before its release. A current version that doesn't
+// parse, such as a development build, is never reported as outdated.
+func Newer(latest, current string) bool {
+	l, lpre, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	c, cpre, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return cpre != "" && (lpre == "" || lpre > cpre)
+}
+
+func parseVersion(s string) ([3]int, string, bool) {
+	var v [3]int
+	s, pre, _ := strings.Cut(strings.TrimPrefix(s, "v"), "-")
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, "", false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, "", false
+		}
+		v[i] = n
+	}
+	return v, pre, true
+}
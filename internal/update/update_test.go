@@ -0,0 +1,130 @@
+package update
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"0.2.0", "0.1.0", true},
+		{"v1.0.0", "0.9.9", true},
+		{"0.1.0", "0.1.0", false},
+		{"0.1.0", "0.2.0", false},
+		{"0.10.0", "0.9.0", true},
+		{"1.0.0", "1.0.0-rc1", true},
+		{"1.0.0-rc1", "1.0.0", false},
+		{"1.0.0", "dev", false},
+	}
+	for _, tt := range tests {
+		if got := Newer(tt.latest, tt.current); got != tt.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}
+
+// newReleaseServer serves a release whose binary is payload and whose
+// checksums.txt lists sum for it.
+func newReleaseServer(t *testing.T, payload []byte, sum string) *httptest.Server {
+	name := AssetName(runtime.GOOS, runtime.GOARCH)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/" + DefaultRepo + "/releases/latest":
+			fmt.Fprintf(w, `{"tag_name":"v9.9.9","html_url":"%[1]s/release","assets":[
+				{"name":%[2]q,"browser_download_url":"%[1]s/download/bin"},
+				{"name":"checksums.txt","browser_download_url":"%[1]s/download/sums"}]}`, srv.URL, name)
+		case "/download/bin":
+			w.Write(payload)
+		case "/download/sums":
+			fmt.Fprintf(w, "%s  dio-other-arch\n%s  %s\n", strings.Repeat("0", 64), sum, name)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestApply(t *testing.T) {
+	payload := []byte("new dio binary")
+	hash := sha256.Sum256(payload)
+	srv := newReleaseServer(t, payload, hex.EncodeToString(hash[:]))
+
+	client := &Client{APIURL: srv.URL}
+	rel, err := client.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version != "9.9.9" {
+		t.Errorf("expected version 9.9.9, got %s", rel.Version)
+	}
+
+	exe := filepath.Join(t.TempDir(), "dio")
+	if err := os.WriteFile(exe, []byte("old dio binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Apply(rel, exe); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != string(payload) {
+		t.Errorf("expected the binary to be replaced, got %q", data)
+	}
+	if info, _ := os.Stat(exe); info.Mode().Perm() != 0o755 {
+		t.Errorf("expected mode 0755, got %v", info.Mode().Perm())
+	}
+}
+
+func TestApply_ChecksumMismatch(t *testing.T) {
+	srv := newReleaseServer(t, []byte("tampered"), strings.Repeat("a", 64))
+	client := &Client{APIURL: srv.URL}
+	rel, err := client.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exe := filepath.Join(t.TempDir(), "dio")
+	if err := os.WriteFile(exe, []byte("old dio binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Apply(rel, exe); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "old dio binary" {
+		t.Errorf("expected the binary to be left alone, got %q", data)
+	}
+}
+
+func TestNotice_ChecksOncePerInterval(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"tag_name":"v0.2.0"}`)
+	}))
+	defer srv.Close()
+
+	client := &Client{APIURL: srv.URL}
+	statePath := filepath.Join(t.TempDir(), "update-check.json")
+	for i := 0; i < 2; i++ {
+		if notice := client.Notice("0.1.0", statePath); !strings.Contains(notice, "0.2.0") {
+			t.Errorf("run %d: expected a notice for 0.2.0, got %q", i, notice)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected one release lookup, got %d", requests)
+	}
+	if notice := client.Notice("0.2.0", statePath); notice != "" {
+		t.Errorf("expected no notice when up to date, got %q", notice)
+	}
+}
@@ -0,0 +1,61 @@
+package upgrade
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Title returns the title of the change applying updates to the
+// Dockerfile at path, e.g. "Bump node from 20.11-alpine to 20.12-alpine in
+// api/Dockerfile".
+func Title(path string, updates []Update) string {
+	if len(updates) == 1 {
+		_, repo, from := SplitRef(updates[0].From)
+		_, _, to := SplitRef(updates[0].To)
+		return fmt.Sprintf("Bump %s from %s to %s in %s", strings.TrimPrefix(repo, "library/"), from, to, path)
+	}
+	return fmt.Sprintf("Update %d base images in %s", len(updates), path)
+}
+
+// Description returns the markdown description of the change applying
+// updates to the Dockerfile at path. With scans of the images before and
+// after, keyed by reference, it lists how the vulnerability counts change.
+func Description(path string, updates []Update, scans map[string]*models.ScanResult) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Updates the base images of `%s` to their newest patch or minor versions.\n\n", path))
+	sb.WriteString("| Line | From | To | Update |\n")
+	sb.WriteString("|------|------|----|--------|\n")
+	for _, u := range updates {
+		sb.WriteString(fmt.Sprintf("| %d | `%s` | `%s` | %s |\n", u.Line, u.From, u.To, u.Level))
+	}
+
+	var rows []string
+	for _, u := range updates {
+		before, after := scans[u.From], scans[u.To]
+		if before == nil || after == nil {
+			continue
+		}
+		rows = append(rows, fmt.Sprintf("| `%s` | %s | %s | %s | %s |", u.To,
+			delta(before.CriticalCount, after.CriticalCount), delta(before.HighCount, after.HighCount),
+			delta(before.MediumCount, after.MediumCount), delta(before.LowCount, after.LowCount)))
+	}
+	if len(rows) > 0 {
+		sb.WriteString("\n### Vulnerabilities\n\n")
+		sb.WriteString("| Image | Critical | High | Medium | Low |\n")
+		sb.WriteString("|-------|----------|------|--------|-----|\n")
+		sb.WriteString(strings.Join(rows, "\n"))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n---\n*Opened by [Docker Image Optimizer (DIO)](https://github.com/maxlar/docker-image-optimizer) `dio update`.*\n")
+	return sb.String()
+}
+
+// delta formats a count before and after, e.g. "3 → 1 (-2)".
+func delta(before, after int) string {
+	if before == after {
+		return fmt.Sprintf("%d", after)
+	}
+	return fmt.Sprintf("%d → %d (%+d)", before, after, after-before)
+}
@@ -0,0 +1,216 @@
+// Package upgrade finds newer patch and minor versions of the base images
+// of a Dockerfile in their registries and rewrites the FROM instructions to
+// them, the way Dependabot does for its docker ecosystem. Major versions
+// are never proposed: they tend to break builds.
+package upgrade
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Update levels: how far a tag may move.
+const (
+	// LevelPatch allows 1.2.3 → 1.2.4.
+	LevelPatch = "patch"
+	// LevelMinor allows 1.2.3 → 1.3.0 as well.
+	LevelMinor = "minor"
+)
+
+// fromRegex matches a FROM instruction: its flags, image and stage name.
+var fromRegex = regexp.MustCompile(`(?i)^\s*FROM\s+((?:--\S+\s+)*)(\S+)(?:\s+AS\s+(\S+))?`)
+
+// tagRegex splits a tag into its prefix, version and suffix, e.g.
+// "v20.11-alpine3.19" into "v", "20.11" and "-alpine3.19".
+var tagRegex = regexp.MustCompile(`^(v?)(\d+(?:\.\d+){0,2})(.*)$`)
+
+// BaseImage is an image a FROM instruction pulls.
+type BaseImage struct {
+	Line int    // 1-based
+	Ref  string // as written, e.g. node:20.11-alpine
+}
+
+// Update is a base image with a newer tag.
+type Update struct {
+	Line  int    `json:"line"`
+	From  string `json:"from"` // the current reference
+	To    string `json:"to"`
+	Level string `json:"level"` // LevelPatch or LevelMinor
+}
+
+// TagLister lists the tags of a repository; *registry.Client is one.
+type TagLister interface {
+	Tags(registry, repo string) ([]string, error)
+}
+
+// BaseImages returns the images the FROM instructions of a Dockerfile
+// pull. FROM of an earlier stage, scratch, references with variables and
+// references pinned by digest are left out.
+func BaseImages(content string) []BaseImage {
+	var images []BaseImage
+	stages := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		m := fromRegex.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		ref, stage := m[2], strings.ToLower(m[3])
+		skip := stages[strings.ToLower(ref)] || strings.EqualFold(ref, "scratch") || strings.Contains(ref, "$") || strings.Contains(ref, "@")
+		if stage != "" {
+			stages[stage] = true
+		}
+		if skip {
+			continue
+		}
+		images = append(images, BaseImage{Line: line, Ref: ref})
+	}
+	return images
+}
+
+// Find looks up newer tags of the base images of a Dockerfile, up to
+// level. Images whose tags can't be listed are reported in the error,
+// joined, while the updates of the others are still returned.
+func Find(content string, tags TagLister, level string) ([]Update, error) {
+	if level != LevelPatch && level != LevelMinor {
+		return nil, fmt.Errorf("unknown update level %q (use patch or minor)", level)
+	}
+	var (
+		updates []Update
+		errs    []error
+		listed  = make(map[string][]string)
+	)
+	for _, img := range BaseImages(content) {
+		registry, repo, tag := SplitRef(img.Ref)
+		if !tagRegex.MatchString(tag) {
+			continue
+		}
+		key := registry + "/" + repo
+		available, ok := listed[key]
+		if !ok {
+			var err error
+			if available, err = tags.Tags(registry, repo); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", img.Ref, err))
+			}
+			listed[key] = available
+		}
+		newer, lvl := Newest(tag, available, level)
+		if newer == "" {
+			continue
+		}
+		updates = append(updates, Update{
+			Line:  img.Line,
+			From:  img.Ref,
+			To:    strings.TrimSuffix(img.Ref, tag) + newer,
+			Level: lvl,
+		})
+	}
+	return updates, errors.Join(errs...)
+}
+
+// Newest returns the newest of tags that is a patch or, with LevelMinor, a
+// minor update of current, and its level. Candidates keep the prefix, the
+// suffix and the number of version components of current, so 20.11-alpine
+// moves to 20.12-alpine but not to 20.12.1-alpine or 20.12-bookworm. It
+// returns "" when there is none.
+func Newest(current string, tags []string, level string) (string, string) {
+	m := tagRegex.FindStringSubmatch(current)
+	if m == nil {
+		return "", ""
+	}
+	prefix, suffix := m[1], m[3]
+	cur := parseVersion(m[2])
+	if len(cur) < 2 || (level == LevelPatch && len(cur) < 3) {
+		return "", ""
+	}
+
+	best, bestLevel := "", ""
+	var bestVersion []int
+	for _, tag := range tags {
+		t := tagRegex.FindStringSubmatch(tag)
+		if t == nil || t[1] != prefix || t[3] != suffix {
+			continue
+		}
+		v := parseVersion(t[2])
+		if len(v) != len(cur) || v[0] != cur[0] || compare(v, cur) <= 0 {
+			continue
+		}
+		lvl := LevelMinor
+		if len(v) == 3 && v[1] == cur[1] {
+			lvl = LevelPatch
+		}
+		if level == LevelPatch && lvl != LevelPatch {
+			continue
+		}
+		if bestVersion == nil || compare(v, bestVersion) > 0 {
+			best, bestLevel, bestVersion = tag, lvl, v
+		}
+	}
+	return best, bestLevel
+}
+
+// Apply rewrites the FROM instructions of a Dockerfile to the updated
+// images.
+func Apply(content string, updates []Update) string {
+	lines := strings.SplitAfter(content, "\n")
+	for _, u := range updates {
+		if u.Line < 1 || u.Line > len(lines) {
+			continue
+		}
+		line := lines[u.Line-1]
+		m := fromRegex.FindStringSubmatchIndex(line)
+		if m == nil || line[m[4]:m[5]] != u.From {
+			continue
+		}
+		lines[u.Line-1] = line[:m[4]] + u.To + line[m[5]:]
+	}
+	return strings.Join(lines, "")
+}
+
+// SplitRef splits an image reference into the registry host its tags are
+// listed from, the repository and the tag. Docker Hub images are listed
+// from registry-1.docker.io, official ones in the library namespace.
+func SplitRef(ref string) (registry, repo, tag string) {
+	registry, repo = "docker.io", ref
+	if host, rest, ok := strings.Cut(ref, "/"); ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		registry, repo = host, rest
+	}
+	tag = "latest"
+	if i := strings.LastIndex(repo, ":"); i >= 0 {
+		repo, tag = repo[:i], repo[i+1:]
+	}
+	switch registry {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		registry = "registry-1.docker.io"
+		if !strings.Contains(repo, "/") {
+			repo = "library/" + repo
+		}
+	}
+	return registry, repo, tag
+}
+
+func parseVersion(s string) []int {
+	parts := strings.Split(s, ".")
+	v := make([]int, len(parts))
+	for i, p := range parts {
+		v[i], _ = strconv.Atoi(p)
+	}
+	return v
+}
+
+// compare compares versions with the same number of components.
+func compare(a, b []int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,139 @@
+package upgrade
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// fakeTags lists tags from a map keyed by registry/repo.
+type fakeTags map[string][]string
+
+func (f fakeTags) Tags(registry, repo string) ([]string, error) {
+	tags, ok := f[registry+"/"+repo]
+	if !ok {
+		return nil, errors.New("unauthorized")
+	}
+	return tags, nil
+}
+
+const dockerfile = `FROM --platform=$BUILDPLATFORM golang:1.22.3-alpine AS build
+RUN go build -o /app .
+
+FROM build AS test
+FROM ghcr.io/acme/base:v2.1
+FROM private.corp/app:1.0
+FROM scratch
+FROM node:${NODE_VERSION}
+FROM alpine@sha256:0123
+FROM debian:12.5-slim
+COPY --from=build /app /app
+`
+
+func TestBaseImages(t *testing.T) {
+	var refs []string
+	for _, img := range BaseImages(dockerfile) {
+		refs = append(refs, img.Ref)
+	}
+	want := "golang:1.22.3-alpine ghcr.io/acme/base:v2.1 private.corp/app:1.0 debian:12.5-slim"
+	if got := strings.Join(refs, " "); got != want {
+		t.Errorf("BaseImages = %s, want %s", got, want)
+	}
+}
+
+func TestNewest(t *testing.T) {
+	tags := []string{"1.22.3-alpine", "1.22.5-alpine", "1.23.1-alpine", "1.23-alpine", "2.0.0-alpine", "1.23.2-bookworm", "1.24.0rc1-alpine"}
+	for _, c := range []struct {
+		current, level, want, wantLevel string
+	}{
+		{"1.22.3-alpine", LevelPatch, "1.22.5-alpine", LevelPatch},
+		{"1.22.3-alpine", LevelMinor, "1.23.1-alpine", LevelMinor},
+		{"1.22-alpine", LevelMinor, "1.23-alpine", LevelMinor},
+		{"1.22-alpine", LevelPatch, "", ""},  // no patch component to move
+		{"1-alpine", LevelMinor, "", ""},     // only majors at this precision
+		{"2.0.0-alpine", LevelMinor, "", ""}, // already the newest
+		{"latest", LevelMinor, "", ""},
+	} {
+		got, lvl := Newest(c.current, tags, c.level)
+		if got != c.want || lvl != c.wantLevel {
+			t.Errorf("Newest(%s, %s) = %s, %s; want %s, %s", c.current, c.level, got, lvl, c.want, c.wantLevel)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	tags := fakeTags{
+		"registry-1.docker.io/library/golang": {"1.22.3-alpine", "1.22.4-alpine", "1.23.0-alpine"},
+		"ghcr.io/acme/base":                   {"v2.1", "v2.3", "v3.0"},
+		"registry-1.docker.io/library/debian": {"12.5-slim", "12.7-slim", "12.7"},
+	}
+	updates, err := Find(dockerfile, tags, LevelMinor)
+	if err == nil || !strings.Contains(err.Error(), "private.corp/app:1.0: unauthorized") {
+		t.Errorf("expected the failed lookup to be reported, got %v", err)
+	}
+	want := []Update{
+		{Line: 1, From: "golang:1.22.3-alpine", To: "golang:1.23.0-alpine", Level: LevelMinor},
+		{Line: 5, From: "ghcr.io/acme/base:v2.1", To: "ghcr.io/acme/base:v2.3", Level: LevelMinor},
+		{Line: 10, From: "debian:12.5-slim", To: "debian:12.7-slim", Level: LevelMinor},
+	}
+	if len(updates) != len(want) {
+		t.Fatalf("Find = %+v, want %+v", updates, want)
+	}
+	for i := range want {
+		if updates[i] != want[i] {
+			t.Errorf("update %d = %+v, want %+v", i, updates[i], want[i])
+		}
+	}
+
+	out := Apply(dockerfile, updates)
+	for _, line := range []string{
+		"FROM --platform=$BUILDPLATFORM golang:1.23.0-alpine AS build\n",
+		"FROM ghcr.io/acme/base:v2.3\n",
+		"FROM debian:12.7-slim\n",
+		"COPY --from=build /app /app\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected %q in the updated Dockerfile:\n%s", line, out)
+		}
+	}
+
+	if _, err := Find(dockerfile, tags, "major"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestSplitRef(t *testing.T) {
+	for ref, want := range map[string][3]string{
+		"node:20":                  {"registry-1.docker.io", "library/node", "20"},
+		"bitnami/redis:7.2":        {"registry-1.docker.io", "bitnami/redis", "7.2"},
+		"localhost:5000/app:1.0":   {"localhost:5000", "app", "1.0"},
+		"gcr.io/distroless/static": {"gcr.io", "distroless/static", "latest"},
+	} {
+		r, repo, tag := SplitRef(ref)
+		if [3]string{r, repo, tag} != want {
+			t.Errorf("SplitRef(%s) = %s %s %s, want %v", ref, r, repo, tag, want)
+		}
+	}
+}
+
+func TestDescription(t *testing.T) {
+	updates := []Update{{Line: 1, From: "node:20.11-alpine", To: "node:20.12-alpine", Level: LevelMinor}}
+	if got := Title("api/Dockerfile", updates); got != "Bump node from 20.11-alpine to 20.12-alpine in api/Dockerfile" {
+		t.Errorf("Title = %q", got)
+	}
+	scans := map[string]*models.ScanResult{
+		"node:20.11-alpine": {CriticalCount: 1, HighCount: 4},
+		"node:20.12-alpine": {HighCount: 1},
+	}
+	body := Description("api/Dockerfile", updates, scans)
+	for _, want := range []string{"| 1 | `node:20.11-alpine` | `node:20.12-alpine` | minor |", "| `node:20.12-alpine` | 1 → 0 (-1) | 4 → 1 (-3) | 0 | 0 |"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the description:\n%s", want, body)
+		}
+	}
+	if strings.Contains(Description("api/Dockerfile", updates, nil), "Vulnerabilities") {
+		t.Error("expected no vulnerability table without scans")
+	}
+}
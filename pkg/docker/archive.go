@@ -0,0 +1,308 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Kinds of image archives.
+const (
+	// ArchiveDocker is a docker save tarball.
+	ArchiveDocker = "docker-archive"
+	// ArchiveOCI is an OCI image layout directory.
+	ArchiveOCI = "oci"
+)
+
+// Archive is an image read from disk rather than from the daemon or a
+// registry, for air-gapped pipelines: a docker save tarball or an OCI image
+// layout directory.
+type Archive struct {
+	// Ref is the reference the archive was named with, like
+	// docker-archive:app.tar.
+	Ref  string
+	Kind string
+	Path string
+}
+
+// ParseArchive returns the archive named by ref, docker-archive:<file> or
+// oci:<dir>, or false when ref is an image reference.
+func ParseArchive(ref string) (*Archive, bool) {
+	kind, path, ok := strings.Cut(ref, ":")
+	if !ok || path == "" || strings.HasPrefix(path, "//") {
+		return nil, false
+	}
+	if kind != ArchiveDocker && kind != ArchiveOCI {
+		return nil, false
+	}
+	return &Archive{Ref: ref, Kind: kind, Path: path}, true
+}
+
+// archiveConfig is the subset of an image config we care about.
+type archiveConfig struct {
+	Created      time.Time `json:"created"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Config       struct {
+		User        string   `json:"User"`
+		Env         []string `json:"Env"`
+		Cmd         []string `json:"Cmd"`
+		Entrypoint  []string `json:"Entrypoint"`
+		WorkingDir  string   `json:"WorkingDir"`
+		Healthcheck *struct {
+			Test []string `json:"Test"`
+		} `json:"Healthcheck"`
+	} `json:"config"`
+	History []historyEntry `json:"history"`
+}
+
+// Inspect returns the metrics of the image in the archive. Its size is that
+// of the files its layers add.
+func (a *Archive) Inspect() (*models.ImageMetrics, error) {
+	img, cfg, err := a.read()
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, layer := range img.layers {
+		size += layer.size
+	}
+	hc := cfg.Config.Healthcheck
+	digest := sha256.Sum256(img.config)
+	return &models.ImageMetrics{
+		ImageName:    a.Ref,
+		ImageID:      "sha256:" + hex.EncodeToString(digest[:]),
+		Size:         size,
+		SizeHuman:    HumanSize(size),
+		Layers:       len(img.layers),
+		CreatedAt:    cfg.Created,
+		Architecture: cfg.Architecture,
+		OS:           cfg.OS,
+		User:         cfg.Config.User,
+		Healthcheck:  hc != nil && len(hc.Test) > 0 && hc.Test[0] != "NONE",
+	}, nil
+}
+
+// CompressedSize returns the size of the image as a registry would store
+// it: the sizes in the manifest of an OCI layout, or the gzipped layers of
+// a docker save tarball.
+func (a *Archive) CompressedSize() (int64, error) {
+	if a.Kind == ArchiveOCI {
+		manifest, err := a.ociManifest()
+		if err != nil {
+			return 0, err
+		}
+		size := manifest.Config.Size
+		for _, layer := range manifest.Layers {
+			size += layer.Size
+		}
+		return size, nil
+	}
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	sizes, layers, err := gzipLayerSizes(f)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", a.Path, err)
+	}
+	if layers == nil {
+		return 0, fmt.Errorf("%s has no manifest", a.Path)
+	}
+	var size int64
+	for _, layer := range layers {
+		size += sizes[layer]
+	}
+	return size, nil
+}
+
+// History returns the history of the image in the archive, oldest entry
+// first, like Client.History.
+func (a *Archive) History() ([]models.HistoryEntry, error) {
+	img, cfg, err := a.read()
+	if err != nil {
+		return nil, err
+	}
+	layered := 0
+	for _, h := range cfg.History {
+		if !h.EmptyLayer {
+			layered++
+		}
+	}
+	entries := make([]models.HistoryEntry, 0, len(cfg.History))
+	layer := 0
+	for _, h := range cfg.History {
+		entry := models.HistoryEntry{CreatedBy: h.CreatedBy}
+		if !h.EmptyLayer {
+			// Sizes are only known when the history lines up with the layers
+			if layered == len(img.layers) {
+				entry.Size = img.layers[layer].size
+			}
+			layer++
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// RuntimeConfig returns what the image in the archive runs with, like
+// Client.RuntimeConfig, with the mode of the working directory as the last
+// layer holding it sets it.
+func (a *Archive) RuntimeConfig() (*models.RuntimeConfig, error) {
+	img, cfg, err := a.read()
+	if err != nil {
+		return nil, err
+	}
+	rc := &models.RuntimeConfig{
+		Image:      a.Ref,
+		Entrypoint: cfg.Config.Entrypoint,
+		Cmd:        cfg.Config.Cmd,
+		Env:        cfg.Config.Env,
+		WorkingDir: cfg.Config.WorkingDir,
+	}
+	if rc.WorkingDir != "" {
+		dir := path.Clean("/" + rc.WorkingDir)
+		for _, layer := range img.layers {
+			if mode, ok := layer.dirs[dir]; ok {
+				rc.WorkingDirMode = fmt.Sprintf("%04o", mode&0o7777)
+			}
+		}
+	}
+	return rc, nil
+}
+
+// read reads the layers and config of the image in the archive.
+func (a *Archive) read() (*savedImage, *archiveConfig, error) {
+	var (
+		img *savedImage
+		err error
+	)
+	if a.Kind == ArchiveOCI {
+		if img, err = a.readOCI(); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		f, err := os.Open(a.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		if img, err = readSavedImage(f, false); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", a.Path, err)
+		}
+	}
+	cfg := &archiveConfig{}
+	if err := json.Unmarshal(img.config, cfg); err != nil {
+		return nil, nil, fmt.Errorf("%s: invalid image config: %w", a.Path, err)
+	}
+	return img, cfg, nil
+}
+
+// ociDescriptor points to a blob of an OCI layout.
+type ociDescriptor struct {
+	Digest   string `json:"digest"`
+	Size     int64  `json:"size"`
+	Platform *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform"`
+}
+
+// ociManifestJSON is an OCI image manifest or index: an index lists
+// manifests, a manifest the config and layers.
+type ociManifestJSON struct {
+	Manifests []ociDescriptor `json:"manifests"`
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// readOCI reads the image of an OCI layout directory.
+func (a *Archive) readOCI() (*savedImage, error) {
+	manifest, err := a.ociManifest()
+	if err != nil {
+		return nil, err
+	}
+	img := &savedImage{}
+	if img.config, err = a.blob(manifest.Config.Digest); err != nil {
+		return nil, err
+	}
+	for _, layer := range manifest.Layers {
+		f, err := os.Open(a.blobPath(layer.Digest))
+		if err != nil {
+			return nil, err
+		}
+		files, err := readLayer(f, false)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: layer %s: %w", a.Path, layer.Digest, err)
+		}
+		img.layers = append(img.layers, files)
+	}
+	return img, nil
+}
+
+// ociManifest returns the image manifest of an OCI layout, following
+// indexes to the manifest of the platform this runs on, or the first one.
+func (a *Archive) ociManifest() (*ociManifestJSON, error) {
+	data, err := os.ReadFile(filepath.Join(a.Path, "index.json"))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an OCI image layout: %w", a.Path, err)
+	}
+	for depth := 0; depth < 4; depth++ {
+		var m ociManifestJSON
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("%s: invalid manifest: %w", a.Path, err)
+		}
+		if len(m.Manifests) == 0 {
+			if m.Config.Digest == "" {
+				return nil, fmt.Errorf("%s: manifest has no config", a.Path)
+			}
+			return &m, nil
+		}
+		if data, err = a.blob(pickManifest(m.Manifests).Digest); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%s: too many nested indexes", a.Path)
+}
+
+// pickManifest picks the manifest of the platform this runs on from an
+// index, skipping the attestation manifests BuildKit adds with an unknown
+// platform.
+func pickManifest(manifests []ociDescriptor) ociDescriptor {
+	var candidates []ociDescriptor
+	for _, m := range manifests {
+		if m.Platform != nil && m.Platform.OS == "unknown" {
+			continue
+		}
+		if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == runtime.GOARCH {
+			return m
+		}
+		candidates = append(candidates, m)
+	}
+	if len(candidates) == 0 {
+		return manifests[0]
+	}
+	return candidates[0]
+}
+
+// blob reads a blob of an OCI layout.
+func (a *Archive) blob(digest string) ([]byte, error) {
+	return os.ReadFile(a.blobPath(digest))
+}
+
+// blobPath returns where an OCI layout stores the blob with a digest.
+func (a *Archive) blobPath(digest string) string {
+	alg, encoded, _ := strings.Cut(digest, ":")
+	return filepath.Join(a.Path, "blobs", alg, encoded)
+}
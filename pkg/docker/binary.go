@@ -0,0 +1,176 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// ErrIsDir is returned when a file is read from an image but the path is a
+// directory.
+var ErrIsDir = errors.New("is a directory")
+
+// ReadFile returns the content of a file in an image, following symlinks.
+func (c *Client) ReadFile(imageRef, path string) ([]byte, error) {
+	container, err := c.createContainer(imageRef)
+	if err != nil {
+		return nil, err
+	}
+	defer c.removeContainer(container)
+	return c.copyOut(container, path)
+}
+
+// Linkage reads how a binary in an image is linked from its ELF headers.
+// For dynamically linked binaries it also checks that the loader the
+// binary requests exists in the image; without it the binary can't start.
+func (c *Client) Linkage(imageRef, path string) (*models.BinaryLinkage, error) {
+	container, err := c.createContainer(imageRef)
+	if err != nil {
+		return nil, err
+	}
+	defer c.removeContainer(container)
+
+	data, err := c.copyOut(container, path)
+	if err != nil {
+		return nil, err
+	}
+	linkage, err := elfLinkage(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	linkage.Path = path
+	if linkage.Interpreter != "" {
+		if _, err := c.copyOut(container, linkage.Interpreter); errors.Is(err, fs.ErrNotExist) {
+			linkage.MissingInterpreter = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return linkage, nil
+}
+
+// elfLinkage reads the loader and shared libraries an ELF binary requests.
+// Static binaries, including static-pie ones, request neither.
+func elfLinkage(data []byte) (*models.BinaryLinkage, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("not an ELF binary: %w", err)
+	}
+	defer f.Close()
+
+	linkage := &models.BinaryLinkage{}
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		interp, err := io.ReadAll(prog.Open())
+		if err != nil {
+			return nil, err
+		}
+		linkage.Interpreter = strings.TrimRight(string(interp), "\x00")
+	}
+	if linkage.Libraries, err = f.ImportedLibraries(); err != nil {
+		return nil, err
+	}
+	linkage.Static = linkage.Interpreter == "" && len(linkage.Libraries) == 0
+	return linkage, nil
+}
+
+// copyOut reads a file from a container, following symlinks.
+func (c *Client) copyOut(container, p string) ([]byte, error) {
+	// Like the kernel's limit on nested symlinks
+	for i := 0; i < 40; i++ {
+		data, err := c.copyFile(container, p)
+		var link *symlinkError
+		if !errors.As(err, &link) {
+			return data, err
+		}
+		if path.IsAbs(link.target) {
+			p = link.target
+		} else {
+			p = path.Join(path.Dir(p), link.target)
+		}
+	}
+	return nil, fmt.Errorf("%s: too many levels of symbolic links", p)
+}
+
+// copyFile reads a file from a container. docker cp streams it as a tar
+// archive; podman cp has no -L, so it archives symlinks as they are.
+func (c *Client) copyFile(container, path string) ([]byte, error) {
+	args := []string{"cp", "-L", container + ":" + path, "-"}
+	if c.podman {
+		args = []string{"cp", container + ":" + path, "-"}
+	}
+	cmd := exec.Command(c.dockerBin, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("docker cp failed: %w", err)
+	}
+
+	data, readErr := readTarFile(stdout)
+	if readErr != nil {
+		// Stop streaming directories; a missing file has already exited
+		_ = cmd.Process.Kill()
+	} else {
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+	waitErr := cmd.Wait()
+	var link *symlinkError
+	switch {
+	case errors.Is(readErr, ErrIsDir):
+		return nil, fmt.Errorf("%s: %w", path, ErrIsDir)
+	case errors.As(readErr, &link):
+		return nil, link
+	case waitErr != nil && strings.Contains(strings.ToLower(stderr.String()), "could not find"):
+		return nil, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+	case readErr != nil && waitErr == nil:
+		return nil, fmt.Errorf("failed to read docker cp output: %w", readErr)
+	case waitErr != nil:
+		return nil, fmt.Errorf("docker cp failed: %w\nstderr: %s", waitErr, stderr.String())
+	}
+	return data, nil
+}
+
+// symlinkError is returned by readTarFile when the entry is a symlink.
+type symlinkError struct {
+	target string
+}
+
+func (e *symlinkError) Error() string { return "symlink to " + e.target }
+
+// readTarFile returns the content of the first entry of a tar archive,
+// which must be a regular file.
+func readTarFile(r io.Reader) ([]byte, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty archive")
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return nil, ErrIsDir
+	case tar.TypeSymlink:
+		return nil, &symlinkError{target: hdr.Linkname}
+	case tar.TypeReg:
+	default:
+		return nil, fmt.Errorf("%s is not a regular file", hdr.Name)
+	}
+	return io.ReadAll(tr)
+}
@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrNoBuildCheck is returned by BuildCheck when the CLI has no build
+// checks: podman, or docker with buildx older than 0.15.
+var ErrNoBuildCheck = errors.New("docker build --check is not supported (needs buildx 0.15 or later)")
+
+// BuildCheck runs docker build --check on the Dockerfile content, with
+// contextDir as the build context: BuildKit parses the Dockerfile and
+// evaluates its build checks without building it. It returns an error when
+// the Dockerfile doesn't parse or its build can't be resolved; the
+// warnings of the checks are not errors.
+func (c *Client) BuildCheck(dockerfile, contextDir string) error {
+	if c.podman {
+		return ErrNoBuildCheck
+	}
+	cmd := exec.Command(c.dockerBin, "build", "--check", "-f", "-", contextDir)
+	cmd.Stdin = strings.NewReader(dockerfile)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) {
+			return fmt.Errorf("docker build --check failed: %w", err)
+		}
+		return buildCheckError(output.String())
+	}
+	return nil
+}
+
+// buildCheckError returns the error of the output of a docker build
+// --check that exited with an error, or nil when it only reports the
+// warnings of the checks, which fail it too.
+func buildCheckError(output string) error {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "unknown flag: --check") {
+			return ErrNoBuildCheck
+		}
+		if msg, ok := strings.CutPrefix(line, "ERROR:"); ok {
+			msg = strings.TrimSpace(msg)
+			return errors.New(strings.TrimPrefix(msg, "failed to solve: "))
+		}
+	}
+	return nil
+}
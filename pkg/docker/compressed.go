@@ -0,0 +1,262 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// manifestJSON is the subset of docker manifest inspect -v output we care
+// about. Manifest lists produce an array of these, one per platform.
+type manifestJSON struct {
+	Descriptor struct {
+		Platform *struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"Descriptor"`
+	SchemaV2Manifest *imageManifest `json:"SchemaV2Manifest"`
+	OCIManifest      *imageManifest `json:"OCIManifest"`
+}
+
+type imageManifest struct {
+	Config struct {
+		Size int64 `json:"size"`
+	} `json:"config"`
+	Layers []struct {
+		Size int64 `json:"size"`
+	} `json:"layers"`
+}
+
+// CompressedSize returns the size of an image as a registry stores it: the
+// compressed layers and config listed in its manifest. Images that were never
+// pushed or pulled have no manifest, so their size is estimated by gzipping
+// the layers exported by docker save.
+func (c *Client) CompressedSize(imageRef string) (int64, error) {
+	img, err := c.inspect(imageRef)
+	if err != nil {
+		return 0, err
+	}
+	for _, digest := range img.RepoDigests {
+		if size, err := c.manifestSize(digest, img.Os, img.Architecture); err == nil {
+			return size, nil
+		}
+	}
+	return c.savedSize(imageRef)
+}
+
+// RegistrySize returns the compressed size of ref as listed in its registry
+// manifest, for the os/arch platform, without pulling it.
+func (c *Client) RegistrySize(ref, os, arch string) (int64, error) {
+	return c.manifestSize(ref, os, arch)
+}
+
+// manifestSize sums the config and layer sizes in the registry manifest of
+// ref, picking the platform matching os/arch from manifest lists.
+func (c *Client) manifestSize(ref, os, arch string) (int64, error) {
+	if c.podman {
+		return c.rawManifestSize(ref, os, arch)
+	}
+	cmd := exec.Command(c.dockerBin, "manifest", "inspect", "-v", ref)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("docker manifest inspect failed: %w\nstderr: %s", err, stderr.String())
+	}
+
+	var manifests []manifestJSON
+	out := bytes.TrimSpace(stdout.Bytes())
+	if bytes.HasPrefix(out, []byte("[")) {
+		if err := json.Unmarshal(out, &manifests); err != nil {
+			return 0, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+	} else {
+		var m manifestJSON
+		if err := json.Unmarshal(out, &m); err != nil {
+			return 0, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		manifests = append(manifests, m)
+	}
+
+	for _, m := range manifests {
+		p := m.Descriptor.Platform
+		if len(manifests) > 1 && (p == nil || p.OS != os || p.Architecture != arch) {
+			continue
+		}
+		manifest := m.SchemaV2Manifest
+		if manifest == nil {
+			manifest = m.OCIManifest
+		}
+		if manifest == nil {
+			break
+		}
+		size := manifest.Config.Size
+		for _, layer := range manifest.Layers {
+			size += layer.Size
+		}
+		return size, nil
+	}
+	return 0, fmt.Errorf("no %s/%s manifest found for %s", os, arch, ref)
+}
+
+// rawManifest is a registry manifest or manifest list, as podman manifest
+// inspect prints it.
+type rawManifest struct {
+	imageManifest
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// rawManifestSize is manifestSize for podman, which has no verbose
+// manifest inspect: a manifest list is followed to the os/arch manifest.
+func (c *Client) rawManifestSize(ref, os, arch string) (int64, error) {
+	for {
+		cmd := exec.Command(c.dockerBin, "manifest", "inspect", ref)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return 0, fmt.Errorf("podman manifest inspect failed: %w\nstderr: %s", err, stderr.String())
+		}
+		size, digest, err := parseRawManifest(stdout.Bytes(), os, arch)
+		if err != nil || digest == "" {
+			return size, err
+		}
+		if strings.Contains(ref, "@") && strings.HasSuffix(ref, digest) {
+			return 0, fmt.Errorf("manifest list %s lists itself", ref)
+		}
+		ref = repository(ref) + "@" + digest
+	}
+}
+
+// parseRawManifest returns the compressed size of the image a registry
+// manifest describes or, for a manifest list, the digest of its os/arch
+// manifest.
+func parseRawManifest(data []byte, os, arch string) (int64, string, error) {
+	var m rawManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return 0, "", fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if m.Manifests == nil {
+		size := m.Config.Size
+		for _, layer := range m.Layers {
+			size += layer.Size
+		}
+		return size, "", nil
+	}
+	for _, entry := range m.Manifests {
+		if entry.Platform.OS == os && entry.Platform.Architecture == arch {
+			return 0, entry.Digest, nil
+		}
+	}
+	return 0, "", fmt.Errorf("no %s/%s manifest found", os, arch)
+}
+
+// repository strips the tag or digest from an image reference.
+func repository(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		return ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i]
+	}
+	return ref
+}
+
+// savedSize estimates the compressed size of a local image by gzipping each
+// layer from docker save, the way they would be pushed.
+func (c *Client) savedSize(imageRef string) (int64, error) {
+	cmd := exec.Command(c.dockerBin, "save", imageRef)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("docker save failed: %w", err)
+	}
+
+	sizes, layers, err := gzipLayerSizes(stdout)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return 0, fmt.Errorf("failed to read docker save output: %w", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return 0, fmt.Errorf("docker save failed: %w\nstderr: %s", err, stderr.String())
+	}
+	if layers == nil {
+		return 0, fmt.Errorf("docker save output for %s has no manifest", imageRef)
+	}
+
+	var size int64
+	for _, layer := range layers {
+		size += sizes[layer]
+	}
+	return size, nil
+}
+
+// gzipLayerSizes reads a docker save archive and returns the gzipped size of
+// every file in it along with the layer paths listed in manifest.json.
+func gzipLayerSizes(r io.Reader) (map[string]int64, []string, error) {
+	sizes := make(map[string]int64)
+	var layers []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Name == "manifest.json" {
+			var manifest []struct {
+				Layers []string `json:"Layers"`
+			}
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return nil, nil, fmt.Errorf("invalid manifest.json: %w", err)
+			}
+			if len(manifest) > 0 {
+				layers = append([]string{}, manifest[0].Layers...)
+			}
+			continue
+		}
+		if strings.HasSuffix(hdr.Name, ".json") {
+			continue
+		}
+		var counter byteCounter
+		zw := gzip.NewWriter(&counter)
+		if _, err := io.Copy(zw, tr); err != nil {
+			return nil, nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, nil, err
+		}
+		sizes[hdr.Name] = int64(counter)
+	}
+	return sizes, layers, nil
+}
+
+// byteCounter is an io.Writer that only counts what is written to it.
+type byteCounter int64
+
+func (b *byteCounter) Write(p []byte) (int, error) {
+	*b += byteCounter(len(p))
+	return len(p), nil
+}
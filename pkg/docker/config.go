@@ -0,0 +1,69 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// RuntimeConfig returns what an image runs with: its entrypoint, command,
+// environment and working directory, with the mode of the directory in
+// the image when it can be read.
+func (c *Client) RuntimeConfig(imageRef string) (*models.RuntimeConfig, error) {
+	img, err := c.inspect(imageRef)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &models.RuntimeConfig{
+		Image:      imageRef,
+		Entrypoint: img.Config.Entrypoint,
+		Cmd:        img.Config.Cmd,
+		Env:        img.Config.Env,
+		WorkingDir: img.Config.WorkingDir,
+	}
+	if cfg.WorkingDir != "" && img.Os != "windows" {
+		container, err := c.createContainer(imageRef)
+		if err != nil {
+			return nil, err
+		}
+		defer c.removeContainer(container)
+		mode, err := c.pathMode(container, cfg.WorkingDir)
+		if err != nil {
+			return nil, err
+		}
+		cfg.WorkingDirMode = fmt.Sprintf("%04o", mode&0o7777)
+	}
+	return cfg, nil
+}
+
+// pathMode returns the mode of a path in a container, from the header of
+// the archive docker cp streams, which is stopped there.
+func (c *Client) pathMode(container, path string) (int64, error) {
+	cmd := exec.Command(c.dockerBin, "cp", container+":"+path, "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("docker cp failed: %w", err)
+	}
+	hdr, readErr := tar.NewReader(stdout).Next()
+	_ = cmd.Process.Kill()
+	waitErr := cmd.Wait()
+	switch {
+	case readErr == nil:
+		return hdr.Mode, nil
+	case strings.Contains(strings.ToLower(stderr.String()), "could not find"):
+		return 0, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+	case waitErr != nil && stderr.Len() > 0:
+		return 0, fmt.Errorf("docker cp failed: %w\nstderr: %s", waitErr, stderr.String())
+	}
+	return 0, fmt.Errorf("failed to read docker cp output: %w", readErr)
+}
@@ -0,0 +1,118 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// maxDiffFiles is how many differing files DiffImages lists per layer.
+const maxDiffFiles = 20
+
+// DiffImages compares two images file by file: the fields of their configs
+// that differ, such as created, and the layers whose entries differ in
+// content, metadata or presence.
+func (c *Client) DiffImages(refA, refB string) ([]string, []models.LayerDiff, error) {
+	var images [2]*savedImage
+	for i, ref := range []string{refA, refB} {
+		err := c.readSave(ref, func(r io.Reader) (err error) {
+			images[i], err = readSavedImage(r, true)
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return diffConfigs(images[0].config, images[1].config), diffLayers(images[0], images[1]), nil
+}
+
+// diffConfigs returns the paths of the fields that differ between two image
+// configs, like created or history[3].created. The layer digests under
+// rootfs are left out: diffLayers tells what differs in them.
+func diffConfigs(a, b []byte) []string {
+	var va, vb interface{}
+	_ = json.Unmarshal(a, &va)
+	_ = json.Unmarshal(b, &vb)
+	fa, fb := make(map[string]string), make(map[string]string)
+	flattenJSON("", va, fa)
+	flattenJSON("", vb, fb)
+	var fields []string
+	for k, v := range fa {
+		if fb[k] != v {
+			fields = append(fields, k)
+		}
+	}
+	for k := range fb {
+		if _, ok := fa[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// flattenJSON records the leaves of a decoded JSON value by path.
+func flattenJSON(prefix string, v interface{}, leaves map[string]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if prefix == "" && k == "rootfs" {
+				continue
+			}
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			flattenJSON(p, child, leaves)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenJSON(fmt.Sprintf("%s[%d]", prefix, i), child, leaves)
+		}
+	default:
+		leaves[prefix] = fmt.Sprint(v)
+	}
+}
+
+// diffLayers returns the layers whose entries differ between two images,
+// compared by position. Layers only one image has differ entirely.
+func diffLayers(a, b *savedImage) []models.LayerDiff {
+	createdBy := layerHistory(a)
+	var diffs []models.LayerDiff
+	for i := 0; i < len(a.layers) || i < len(b.layers); i++ {
+		var da, db map[string]string
+		if i < len(a.layers) {
+			da = a.layers[i].digests
+		}
+		if i < len(b.layers) {
+			db = b.layers[i].digests
+		}
+		var changed []string
+		for p, digest := range da {
+			if db[p] != digest {
+				changed = append(changed, p)
+			}
+		}
+		for p := range db {
+			if _, ok := da[p]; !ok {
+				changed = append(changed, p)
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		sort.Strings(changed)
+		diff := models.LayerDiff{Layer: i, Changed: len(changed), Files: changed}
+		if len(changed) > maxDiffFiles {
+			diff.Files = changed[:maxDiffFiles]
+		}
+		if i < len(createdBy) {
+			diff.CreatedBy = createdBy[i]
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
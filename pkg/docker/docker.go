@@ -5,41 +5,127 @@ package docker
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os/exec"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/maxlar/docker-image-optimizer/internal/models"
+	"github.com/maxlar/docker-image-optimizer/internal/retry"
 )
 
 // Client wraps Docker CLI operations.
 type Client struct {
 	dockerBin string
+	retry     retry.Policy
+	// podman is set when the CLI is podman, possibly behind a docker
+	// command from the podman-docker package.
+	podman bool
 }
 
-// NewClient creates a new Docker client, locating the docker binary.
+// ErrNotFound is returned by NewClient when neither docker nor podman is
+// installed.
+var ErrNotFound = errors.New("docker not found in PATH")
+
+// NewClient creates a new Docker client, locating the docker binary, or
+// podman when there is no docker.
 func NewClient() (*Client, error) {
 	bin, err := exec.LookPath("docker")
 	if err != nil {
-		return nil, fmt.Errorf("docker not found in PATH: %w", err)
+		var perr error
+		if bin, perr = exec.LookPath("podman"); perr != nil {
+			return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
 	}
-	return &Client{dockerBin: bin}, nil
+	out, _ := exec.Command(bin, "--version").Output()
+	return &Client{dockerBin: bin, podman: isPodman(string(out))}, nil
+}
+
+// isPodman reports whether the --version output of the CLI is podman's.
+// The docker command of podman-docker prints it too.
+func isPodman(version string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(version)), "podman")
+}
+
+// Podman reports whether the CLI is podman.
+func (c *Client) Podman() bool {
+	return c.podman
+}
+
+// SetRetry sets how pulls that fail for transient reasons, such as
+// registry timeouts or rate limits, are retried.
+func (c *Client) SetRetry(policy retry.Policy) {
+	c.retry = policy
 }
 
 // Build builds a Docker image from a Dockerfile and returns metrics.
 func (c *Client) Build(dockerfilePath, contextDir, tag string) (*models.ImageMetrics, error) {
+	return c.BuildTarget(dockerfilePath, contextDir, tag, "")
+}
+
+// BuildTarget builds a Docker image up to the named stage (docker build
+// --target) and returns metrics. An empty target builds the final stage.
+func (c *Client) BuildTarget(dockerfilePath, contextDir, tag, target string) (*models.ImageMetrics, error) {
+	return c.BuildWith(dockerfilePath, contextDir, tag, BuildOptions{Target: target})
+}
+
+// BuildOptions are the docker build options DIO uses.
+type BuildOptions struct {
+	Target  string // stage to build up to; empty builds the final stage
+	NoCache bool   // build without the build cache, for cold build times
+	Labels  map[string]string
+	// Args are the --build-arg values.
+	Args map[string]string
+	// Platform is the platform to build for, e.g. linux/arm64; empty builds
+	// for the host.
+	Platform string
+	// Output, when set, receives the build output as it is written.
+	Output io.Writer
+	// SourceDateEpoch, a Unix timestamp, dates the image config and
+	// history for reproducible builds. RewriteTimestamps also clamps the
+	// timestamps of the files in the layers to it, which needs BuildKit
+	// 0.13; Podman always does.
+	SourceDateEpoch   string
+	RewriteTimestamps bool
+}
+
+// BuildWith builds a Docker image with the given options and returns
+// metrics.
+func (c *Client) BuildWith(dockerfilePath, contextDir, tag string, opts BuildOptions) (*models.ImageMetrics, error) {
 	start := time.Now()
 
-	args := []string{"build", "-f", dockerfilePath, "-t", tag, contextDir}
+	args := []string{"build", "-f", dockerfilePath, "-t", tag}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	if opts.Platform != "" {
+		args = append(args, "--platform", opts.Platform)
+	}
+	args = append(args, keyValueArgs("--build-arg", opts.Args)...)
+	args = append(args, c.sourceDateArgs(opts)...)
+	args = append(args, c.formatArgs()...)
+	args = append(args, keyValueArgs("--label", opts.Labels)...)
+	args = append(args, contextDir)
 	cmd := exec.Command(c.dockerBin, args...)
 
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	// BuildKit writes its progress to stderr and the legacy builder to
+	// stdout, so both are kept for diagnosing failures
+	var output bytes.Buffer
+	var w io.Writer = &output
+	if opts.Output != nil {
+		w = io.MultiWriter(&output, opts.Output)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
 
 	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("docker build failed: %w\nstderr: %s", err, stderr.String())
+		return nil, fmt.Errorf("docker build failed: %w\noutput: %s", err, output.String())
 	}
 
 	elapsed := time.Since(start).Seconds()
@@ -53,9 +139,36 @@ func (c *Client) Build(dockerfilePath, contextDir, tag string) (*models.ImageMet
 	return metrics, nil
 }
 
+// sourceDateArgs returns the build flags dating a reproducible build.
+// BuildKit reads SOURCE_DATE_EPOCH as a build arg; Podman sets it with
+// --timestamp, which also clamps the file timestamps.
+func (c *Client) sourceDateArgs(opts BuildOptions) []string {
+	switch {
+	case opts.SourceDateEpoch == "":
+		return nil
+	case c.podman:
+		return []string{"--timestamp", opts.SourceDateEpoch}
+	case opts.RewriteTimestamps:
+		return []string{"--build-arg", "SOURCE_DATE_EPOCH=" + opts.SourceDateEpoch, "--output", "type=image,rewrite-timestamp=true"}
+	default:
+		return []string{"--build-arg", "SOURCE_DATE_EPOCH=" + opts.SourceDateEpoch}
+	}
+}
+
+// formatArgs returns the build flags selecting the image format. Podman
+// builds OCI images by default, which drop HEALTHCHECK, SHELL and
+// STOPSIGNAL, so it is asked for the docker format that docker builds.
+func (c *Client) formatArgs() []string {
+	if c.podman {
+		return []string{"--format", "docker"}
+	}
+	return nil
+}
+
 // dockerInspectJSON is the subset of docker inspect output we care about.
 type dockerInspectJSON struct {
 	ID           string    `json:"Id"`
+	RepoDigests  []string  `json:"RepoDigests"`
 	Created      time.Time `json:"Created"`
 	Size         int64     `json:"Size"`
 	Architecture string    `json:"Architecture"`
@@ -66,11 +179,53 @@ type dockerInspectJSON struct {
 	Config struct {
 		Image  string   `json:"Image"`
 		Labels map[string]string `json:"Labels"`
+		User   string            `json:"User"`
+		Healthcheck *struct {
+			Test []string `json:"Test"`
+		} `json:"Healthcheck"`
+		Env          []string            `json:"Env"`
+		Cmd          []string            `json:"Cmd"`
+		Entrypoint   []string            `json:"Entrypoint"`
+		WorkingDir   string              `json:"WorkingDir"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+		Volumes      map[string]struct{} `json:"Volumes"`
 	} `json:"Config"`
+	// Healthcheck is where podman reports the HEALTHCHECK.
+	Healthcheck *struct {
+		Test []string `json:"Test"`
+	} `json:"Healthcheck"`
 }
 
 // Inspect returns metrics for an existing Docker image.
 func (c *Client) Inspect(imageRef string) (*models.ImageMetrics, error) {
+	img, err := c.inspect(imageRef)
+	if err != nil {
+		return nil, err
+	}
+	hc := img.Config.Healthcheck
+	if hc == nil {
+		hc = img.Healthcheck
+	}
+	id := img.ID
+	if !strings.Contains(id, ":") && id != "" {
+		id = "sha256:" + id // podman omits the algorithm
+	}
+	return &models.ImageMetrics{
+		ImageName:    imageRef,
+		ImageID:      id,
+		Size:         img.Size,
+		SizeHuman:    HumanSize(img.Size),
+		Layers:       len(img.RootFS.Layers),
+		CreatedAt:    img.Created,
+		Architecture: img.Architecture,
+		OS:           img.Os,
+		User:         img.Config.User,
+		Healthcheck:  hc != nil && len(hc.Test) > 0 && hc.Test[0] != "NONE",
+	}, nil
+}
+
+// inspect runs docker inspect on an image.
+func (c *Client) inspect(imageRef string) (*dockerInspectJSON, error) {
 	cmd := exec.Command(c.dockerBin, "inspect", "--type=image", imageRef)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -89,17 +244,20 @@ func (c *Client) Inspect(imageRef string) (*models.ImageMetrics, error) {
 		return nil, fmt.Errorf("no image found for %s", imageRef)
 	}
 
-	img := results[0]
-	return &models.ImageMetrics{
-		ImageName:    imageRef,
-		ImageID:      img.ID,
-		Size:         img.Size,
-		SizeHuman:    humanSize(img.Size),
-		Layers:       len(img.RootFS.Layers),
-		CreatedAt:    img.Created,
-		Architecture: img.Architecture,
-		OS:           img.Os,
-	}, nil
+	return &results[0], nil
+}
+
+// Pull pulls an image from its registry.
+func (c *Client) Pull(imageRef string) error {
+	return c.retry.Do("pull of "+imageRef, func() error {
+		cmd := exec.Command(c.dockerBin, "pull", "--quiet", imageRef)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("docker pull failed: %w\nstderr: %s", err, stderr.String())
+		}
+		return nil
+	})
 }
 
 // ImageExists checks if a Docker image exists locally.
@@ -125,8 +283,44 @@ func (c *Client) GetHistory(imageRef string) (string, error) {
 	return stdout.String(), nil
 }
 
-// humanSize converts bytes to a human-readable string.
-func humanSize(bytes int64) string {
+// History returns the entries of an image's history, oldest first: the
+// instruction that created each one and the size of its layer.
+func (c *Client) History(imageRef string) ([]models.HistoryEntry, error) {
+	cmd := exec.Command(c.dockerBin, "history", "--no-trunc", "--human=false", "--format", "{{.Size}}\t{{json .CreatedBy}}", imageRef)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("docker history failed: %w\nstderr: %s", err, stderr.String())
+	}
+	return parseHistory(stdout.String())
+}
+
+// parseHistory parses docker history output in the format History asks
+// for, newest entry first, and returns the entries oldest first.
+func parseHistory(output string) ([]models.HistoryEntry, error) {
+	var entries []models.HistoryEntry
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line == "" {
+			continue
+		}
+		size, createdBy, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, fmt.Errorf("unexpected docker history line %q", line)
+		}
+		entry := models.HistoryEntry{}
+		if err := json.Unmarshal([]byte(createdBy), &entry.CreatedBy); err != nil {
+			return nil, fmt.Errorf("unexpected docker history line %q: %w", line, err)
+		}
+		// Sizes are in bytes with --human=false; podman may still add a unit
+		entry.Size, _ = ParseImageSize(size)
+		entries = append([]models.HistoryEntry{entry}, entries...)
+	}
+	return entries, nil
+}
+
+// HumanSize converts bytes to a human-readable string.
+func HumanSize(bytes int64) string {
 	const (
 		KB = 1024
 		MB = KB * 1024
@@ -144,6 +338,16 @@ func humanSize(bytes int64) string {
 	}
 }
 
+// LastLines keeps the last n lines of the output of a build or tool,
+// where errors are reported.
+func LastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
 // ParseImageSize parses a human-readable size string into bytes.
 func ParseImageSize(size string) (int64, error) {
 	size = strings.TrimSpace(strings.ToUpper(size))
@@ -0,0 +1,605 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// tarball builds a tar archive of regular files.
+func tarball(t *testing.T, files map[string][]byte, order ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range order {
+		data := files[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReplayLayers(t *testing.T) {
+	base := map[string][]byte{
+		"usr/bin/tool":        make([]byte, 100),
+		"var/cache/apt/a.deb": make([]byte, 40),
+		"var/cache/apt/b.deb": make([]byte, 60),
+		"etc/config":          make([]byte, 10),
+	}
+	update := map[string][]byte{
+		"usr/bin/tool":               make([]byte, 120), // overwrites 100
+		"var/cache/apt/.wh..wh..opq": nil,               // hides a.deb and b.deb
+		"etc/.wh.config":             nil,               // deletes etc/config
+	}
+	manifest, _ := json.Marshal([]map[string][]string{{"Layers": {"base/layer.tar", "update/layer.tar"}}})
+
+	// manifest.json comes last, as in the OCI layout
+	archive := tarball(t, map[string][]byte{
+		"update/layer.tar": tarball(t, update, "usr/bin/tool", "var/cache/apt/.wh..wh..opq", "etc/.wh.config"),
+		"base/layer.tar":   tarball(t, base, "usr/bin/tool", "var/cache/apt/a.deb", "var/cache/apt/b.deb", "etc/config"),
+		"config":           []byte(`{"architecture":"amd64"}`),
+		"manifest.json":    manifest,
+	}, "update/layer.tar", "base/layer.tar", "config", "manifest.json")
+
+	files, _, wasted, err := replayLayers(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wasted != 210 {
+		t.Errorf("wasted = %d, want 210", wasted)
+	}
+	if want := map[string]int64{"/usr/bin/tool": 120}; !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+}
+
+func TestLayerDuplicates(t *testing.T) {
+	base := map[string][]byte{"bin/sh": make([]byte, 50)}
+	copied := map[string][]byte{"app/main.js": make([]byte, 300), "app/lib.js": make([]byte, 200)}
+	// chown -R rewrites both files, and an edit changes main.js
+	chowned := map[string][]byte{"app/main.js": make([]byte, 300), "app/lib.js": make([]byte, 200)}
+	edited := map[string][]byte{"app/main.js": make([]byte, 310)}
+	manifest, _ := json.Marshal([]map[string]interface{}{{
+		"Config": "abc.json",
+		"Layers": []string{"1/layer.tar", "2/layer.tar", "3/layer.tar", "4/layer.tar"},
+	}})
+	config := []byte(`{"history":[
+		{"created_by":"/bin/sh -c #(nop) ADD file:1 in /"},
+		{"created_by":"/bin/sh -c #(nop)  CMD [\"sh\"]","empty_layer":true},
+		{"created_by":"COPY . /app # buildkit"},
+		{"created_by":"RUN /bin/sh -c chown -R node:node /app # buildkit"},
+		{"created_by":"RUN /bin/sh -c sed -i s/a/b/ /app/main.js # buildkit"}]}`)
+	archive := tarball(t, map[string][]byte{
+		"1/layer.tar":   tarball(t, base, "bin/sh"),
+		"2/layer.tar":   tarball(t, copied, "app/main.js", "app/lib.js"),
+		"3/layer.tar":   tarball(t, chowned, "app/main.js", "app/lib.js"),
+		"4/layer.tar":   tarball(t, edited, "app/main.js"),
+		"abc.json":      config,
+		"manifest.json": manifest,
+	}, "manifest.json", "abc.json", "1/layer.tar", "2/layer.tar", "3/layer.tar", "4/layer.tar")
+
+	img, err := readSavedImage(bytes.NewReader(archive), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dups := img.duplicates()
+	if len(dups) != 1 {
+		t.Fatalf("expected one duplicating layer, got %+v", dups)
+	}
+	d := dups[0]
+	if d.Layer != 2 || d.Files != 2 || d.Bytes != 500 || d.SourceLayer != 1 {
+		t.Errorf("unexpected duplication: %+v", d)
+	}
+	if d.CreatedBy != "RUN /bin/sh -c chown -R node:node /app # buildkit" || d.SourceCreatedBy != "COPY . /app # buildkit" {
+		t.Errorf("unexpected history: %q from %q", d.CreatedBy, d.SourceCreatedBy)
+	}
+}
+
+func TestDiffImages(t *testing.T) {
+	save := func(created string, build []byte) *savedImage {
+		t.Helper()
+		manifest, _ := json.Marshal([]map[string]interface{}{{"Config": "c.json", "Layers": []string{"1.tar", "2.tar"}}})
+		config := []byte(`{"created":"` + created + `","rootfs":{"diff_ids":["` + created + `"]},"history":[
+			{"created_by":"/bin/sh -c #(nop) ADD file:1 in /"},
+			{"created_by":"RUN /bin/sh -c make # buildkit"}]}`)
+		archive := tarball(t, map[string][]byte{
+			"1.tar":         tarball(t, map[string][]byte{"bin/sh": []byte("sh")}, "bin/sh"),
+			"2.tar":         tarball(t, map[string][]byte{"app/bin": build, "app/VERSION": []byte("1")}, "app/bin", "app/VERSION"),
+			"c.json":        config,
+			"manifest.json": manifest,
+		}, "manifest.json", "c.json", "1.tar", "2.tar")
+		img, err := readSavedImage(bytes.NewReader(archive), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+	a := save("2024-01-01T00:00:00Z", []byte("build 1"))
+	b := save("2024-01-02T00:00:00Z", []byte("build 2"))
+
+	if fields := diffConfigs(a.config, b.config); !reflect.DeepEqual(fields, []string{"created"}) {
+		t.Errorf("config fields = %v, want [created]", fields)
+	}
+	layers := diffLayers(a, b)
+	if len(layers) != 1 {
+		t.Fatalf("expected one differing layer, got %+v", layers)
+	}
+	if l := layers[0]; l.Layer != 1 || l.Changed != 1 || !reflect.DeepEqual(l.Files, []string{"/app/bin"}) || l.CreatedBy != "RUN /bin/sh -c make # buildkit" {
+		t.Errorf("unexpected layer diff: %+v", l)
+	}
+	if layers := diffLayers(a, save("2024-01-01T00:00:00Z", []byte("build 1"))); len(layers) != 0 {
+		t.Errorf("identical builds differ: %+v", layers)
+	}
+}
+
+func TestReplayLayers_SetID(t *testing.T) {
+	layer := func(modes map[string]int64, order ...string) []byte {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, name := range order {
+			if err := tw.WriteHeader(&tar.Header{Name: name, Mode: modes[name], Typeflag: tar.TypeReg}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tw.Close()
+		return buf.Bytes()
+	}
+	base := layer(map[string]int64{"usr/bin/passwd": 0o4755, "usr/bin/wall": 0o2755, "usr/bin/su": 0o4755},
+		"usr/bin/passwd", "usr/bin/wall", "usr/bin/su")
+	// chmod u-s on su, and a new setuid binary
+	update := layer(map[string]int64{"usr/bin/su": 0o755, "usr/local/bin/app": 0o6750},
+		"usr/bin/su", "usr/local/bin/app")
+	manifest, _ := json.Marshal([]map[string][]string{{"Layers": {"base.tar", "update.tar"}}})
+	archive := tarball(t, map[string][]byte{"base.tar": base, "update.tar": update, "manifest.json": manifest},
+		"base.tar", "update.tar", "manifest.json")
+
+	_, setid, _, err := replayLayers(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"/usr/bin/passwd": 0o4755, "/usr/bin/wall": 0o2755, "/usr/local/bin/app": 0o6750}
+	if !reflect.DeepEqual(setid, want) {
+		t.Errorf("setid = %v, want %v", setid, want)
+	}
+}
+
+func TestImportChanges(t *testing.T) {
+	var img dockerInspectJSON
+	img.Config.Env = []string{"PATH=/usr/bin", "GREETING=hello $USER"}
+	img.Config.WorkingDir = "/app"
+	img.Config.User = "app"
+	img.Config.ExposedPorts = map[string]struct{}{"8080/tcp": {}}
+	img.Config.Labels = map[string]string{"version": "1.0"}
+	img.Config.Entrypoint = []string{"/app/server"}
+	img.Config.Cmd = []string{"--port", "8080"}
+
+	want := []string{
+		`ENV PATH="/usr/bin"`,
+		`ENV GREETING="hello \$USER"`,
+		"WORKDIR /app",
+		"USER app",
+		"EXPOSE 8080/tcp",
+		`LABEL "version"="1.0"`,
+		`ENTRYPOINT ["/app/server"]`,
+		`CMD ["--port","8080"]`,
+	}
+	if got := importChanges(&img); !reflect.DeepEqual(got, want) {
+		t.Errorf("importChanges = %q, want %q", got, want)
+	}
+}
+
+func TestReadTarFile(t *testing.T) {
+	data, err := readTarFile(bytes.NewReader(tarball(t, map[string][]byte{"app": []byte("binary")}, "app")))
+	if err != nil || string(data) != "binary" {
+		t.Errorf("readTarFile = %q, %v; want the file content", data, err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "bin/", Mode: 0o755, Typeflag: tar.TypeDir}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	if _, err := readTarFile(&buf); !errors.Is(err, ErrIsDir) {
+		t.Errorf("readTarFile of a directory = %v, want ErrIsDir", err)
+	}
+}
+
+func TestReadTarFile_Symlink(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "ld-linux.so", Linkname: "../lib/ld-2.36.so", Typeflag: tar.TypeSymlink}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	var link *symlinkError
+	if _, err := readTarFile(&buf); !errors.As(err, &link) || link.target != "../lib/ld-2.36.so" {
+		t.Errorf("readTarFile of a symlink = %v, want its target", err)
+	}
+}
+
+func TestIsPodman(t *testing.T) {
+	for version, want := range map[string]bool{
+		"podman version 4.9.3\n":                 true,
+		"Docker version 25.0.3, build 4debf41\n": false,
+	} {
+		if got := isPodman(version); got != want {
+			t.Errorf("isPodman(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestParseRawManifest(t *testing.T) {
+	list := []byte(`{"schemaVersion":2,"manifests":[
+		{"digest":"sha256:aaa","platform":{"architecture":"arm64","os":"linux"}},
+		{"digest":"sha256:bbb","platform":{"architecture":"amd64","os":"linux"}}]}`)
+	if _, digest, err := parseRawManifest(list, "linux", "amd64"); err != nil || digest != "sha256:bbb" {
+		t.Errorf("manifest list: digest = %q, %v; want sha256:bbb", digest, err)
+	}
+	if _, _, err := parseRawManifest(list, "windows", "amd64"); err == nil {
+		t.Error("expected an error for a platform missing from the list")
+	}
+
+	image := []byte(`{"schemaVersion":2,"config":{"size":100},"layers":[{"size":1000},{"size":24}]}`)
+	if size, digest, err := parseRawManifest(image, "linux", "amd64"); err != nil || size != 1124 || digest != "" {
+		t.Errorf("image manifest: size = %d, digest = %q, %v; want 1124", size, digest, err)
+	}
+
+	for ref, want := range map[string]string{
+		"registry:5000/app:1.0":         "registry:5000/app",
+		"app@sha256:abc":                "app",
+		"registry:5000/team/app":        "registry:5000/team/app",
+		"docker.io/library/node:20-alp": "docker.io/library/node",
+	} {
+		if got := repository(ref); got != want {
+			t.Errorf("repository(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestElfLinkage(t *testing.T) {
+	if _, err := elfLinkage([]byte("#!/bin/sh\necho hi\n")); err == nil {
+		t.Error("expected an error for a script")
+	}
+
+	// The test binary itself: static or not depends on how it was built,
+	// but the result must be consistent
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Skip(err)
+	}
+	linkage, err := elfLinkage(data)
+	if err != nil {
+		t.Skipf("test binary is not ELF: %v", err)
+	}
+	if linkage.Static != (linkage.Interpreter == "" && len(linkage.Libraries) == 0) {
+		t.Errorf("inconsistent linkage %+v", linkage)
+	}
+	if linkage.Interpreter != "" && !strings.HasPrefix(linkage.Interpreter, "/") {
+		t.Errorf("interpreter = %q, want an absolute path", linkage.Interpreter)
+	}
+}
+
+func TestParseProvenance(t *testing.T) {
+	statement := `{
+  "_type": "https://in-toto.io/Statement/v0.1",
+  "predicateType": "https://slsa.dev/provenance/v1",
+  "predicate": {
+    "buildDefinition": {
+      "buildType": "https://mobyproject.org/buildkit@v1",
+      "resolvedDependencies": [
+        {"uri": "pkg:docker/debian@bookworm-slim?platform=linux%2Famd64", "digest": {"sha256": "abc123"}},
+        {"uri": ""}
+      ]
+    },
+    "runDetails": {"builder": {"id": "https://github.com/example/actions/runs/1"}}
+  }
+}`
+	result := &models.AttestationResult{}
+	if err := parseProvenance([]byte(statement), result); err != nil {
+		t.Fatal(err)
+	}
+	if result.PredicateType != "https://slsa.dev/provenance/v1" || result.BuildType != "https://mobyproject.org/buildkit@v1" {
+		t.Errorf("unexpected predicate %q, build type %q", result.PredicateType, result.BuildType)
+	}
+	if result.BuilderID != "https://github.com/example/actions/runs/1" {
+		t.Errorf("unexpected builder %q", result.BuilderID)
+	}
+	want := []string{"pkg:docker/debian@bookworm-slim?platform=linux%2Famd64 sha256:abc123"}
+	if !reflect.DeepEqual(result.Materials, want) {
+		t.Errorf("expected materials %v, got %v", want, result.Materials)
+	}
+}
+
+func TestParseHistory(t *testing.T) {
+	output := "0\t\"CMD [\\\"node\\\" \\\"index.js\\\"]\"\n" +
+		"52428800\t\"RUN /bin/sh -c npm ci # buildkit\"\n" +
+		"<missing>\t\"/bin/sh -c #(nop)  CMD [\\\"bash\\\"]\"\n"
+	entries, err := parseHistory(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.HistoryEntry{
+		{CreatedBy: `/bin/sh -c #(nop)  CMD ["bash"]`},
+		{CreatedBy: "RUN /bin/sh -c npm ci # buildkit", Size: 52428800},
+		{CreatedBy: `CMD ["node" "index.js"]`},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("expected %+v, got %+v", want, entries)
+	}
+	if _, err := parseHistory("12\tnot json\n"); err == nil {
+		t.Error("expected an error for a malformed line")
+	}
+}
+
+func TestBuildCheckError(t *testing.T) {
+	warnings := "WARNING: JSONArgsRecommended - https://docs.docker.com/go/dockerfile/rule/json-args-recommended/\n" +
+		"JSON arguments recommended for CMD to prevent unintended behavior related to OS signals\n" +
+		"Check complete, 1 warning has been found!\n"
+	if err := buildCheckError(warnings); err != nil {
+		t.Errorf("expected warnings not to be an error, got %v", err)
+	}
+	failed := "#1 [internal] load build definition from Dockerfile\n" +
+		"ERROR: failed to solve: dockerfile parse error on line 3: unknown instruction: rm\n"
+	if err := buildCheckError(failed); err == nil || err.Error() != "dockerfile parse error on line 3: unknown instruction: rm" {
+		t.Errorf("expected the parse error, got %v", err)
+	}
+	if err := buildCheckError("unknown flag: --check\nSee 'docker build --help'.\n"); !errors.Is(err, ErrNoBuildCheck) {
+		t.Errorf("expected ErrNoBuildCheck, got %v", err)
+	}
+}
+
+func TestParseArchive(t *testing.T) {
+	tests := []struct {
+		ref, kind, path string
+	}{
+		{"docker-archive:app.tar", ArchiveDocker, "app.tar"},
+		{"oci:./image-dir", ArchiveOCI, "./image-dir"},
+		{"oci://registry.example.com/policy", "", ""},
+		{"nginx:1.25", "", ""},
+		{"oci:", "", ""},
+	}
+	for _, tt := range tests {
+		archive, ok := ParseArchive(tt.ref)
+		if ok != (tt.kind != "") {
+			t.Errorf("ParseArchive(%q) ok = %v", tt.ref, ok)
+			continue
+		}
+		if ok && (archive.Kind != tt.kind || archive.Path != tt.path) {
+			t.Errorf("ParseArchive(%q) = %+v", tt.ref, archive)
+		}
+	}
+}
+
+// archiveConfigJSON is the config of the images of the archive tests.
+const archiveConfigJSON = `{"architecture":"amd64","os":"linux","config":{"User":"app","Cmd":["node","index.js"],"WorkingDir":"/app"},` +
+	`"history":[{"created_by":"ADD rootfs.tar /"},{"created_by":"WORKDIR /app","empty_layer":true},{"created_by":"COPY . . # buildkit"}]}`
+
+// archiveLayers returns the layers of the archive tests: a base and a layer
+// adding a world-writable /app.
+func archiveLayers(t *testing.T) [][]byte {
+	t.Helper()
+	base := tarball(t, map[string][]byte{"bin/sh": make([]byte, 100)}, "bin/sh")
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	_ = tw.WriteHeader(&tar.Header{Name: "app/", Mode: 0o777, Typeflag: tar.TypeDir})
+	_ = tw.WriteHeader(&tar.Header{Name: "app/index.js", Mode: 0o644, Size: 20, Typeflag: tar.TypeReg})
+	_, _ = tw.Write(make([]byte, 20))
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return [][]byte{base, buf.Bytes()}
+}
+
+// checkArchive checks what is read from the image of the archive tests.
+func checkArchive(t *testing.T, archive *Archive) {
+	t.Helper()
+	metrics, err := archive.Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Size != 120 || metrics.Layers != 2 || metrics.User != "app" || metrics.ImageName != archive.Ref {
+		t.Errorf("unexpected metrics %+v", metrics)
+	}
+	history, err := archive.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.HistoryEntry{
+		{CreatedBy: "ADD rootfs.tar /", Size: 100},
+		{CreatedBy: "WORKDIR /app"},
+		{CreatedBy: "COPY . . # buildkit", Size: 20},
+	}
+	if !reflect.DeepEqual(history, want) {
+		t.Errorf("expected history %+v, got %+v", want, history)
+	}
+	cfg, err := archive.RuntimeConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.WorkingDirMode != "0777" || !reflect.DeepEqual(cfg.Cmd, []string{"node", "index.js"}) {
+		t.Errorf("unexpected runtime config %+v", cfg)
+	}
+}
+
+func TestArchive_Docker(t *testing.T) {
+	layers := archiveLayers(t)
+	manifest, _ := json.Marshal([]map[string]interface{}{{"Config": "config.json", "Layers": []string{"a/layer.tar", "b/layer.tar"}}})
+	path := filepath.Join(t.TempDir(), "app.tar")
+	data := tarball(t, map[string][]byte{
+		"manifest.json": manifest,
+		"config.json":   []byte(archiveConfigJSON),
+		"a/layer.tar":   layers[0],
+		"b/layer.tar":   layers[1],
+	}, "manifest.json", "config.json", "a/layer.tar", "b/layer.tar")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	archive, _ := ParseArchive("docker-archive:" + path)
+	checkArchive(t, archive)
+}
+
+func TestArchive_OCI(t *testing.T) {
+	dir := t.TempDir()
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobs, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Blobs are named by their digests; any unique name does for reading
+	blob := func(name string, data []byte) map[string]interface{} {
+		if err := os.WriteFile(filepath.Join(blobs, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return map[string]interface{}{"digest": "sha256:" + name, "size": len(data)}
+	}
+	layers := archiveLayers(t)
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"config": blob("config", []byte(archiveConfigJSON)),
+		"layers": []interface{}{blob("base", layers[0]), blob("app", layers[1])},
+	})
+	attestation, _ := json.Marshal(map[string]interface{}{"config": blob("empty", []byte("{}"))})
+	m := blob("manifest", manifest)
+	m["platform"] = map[string]string{"os": "linux", "architecture": "amd64"}
+	a := blob("attestation", attestation)
+	a["platform"] = map[string]string{"os": "unknown", "architecture": "unknown"}
+	index, _ := json.Marshal(map[string]interface{}{"manifests": []interface{}{a, m}})
+	outer, _ := json.Marshal(map[string]interface{}{"manifests": []interface{}{blob("index", index)}})
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), outer, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, _ := ParseArchive("oci:" + dir)
+	checkArchive(t, archive)
+	size, err := archive.CompressedSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len(archiveConfigJSON) + len(layers[0]) + len(layers[1])); size != want {
+		t.Errorf("compressed size = %d, want %d", size, want)
+	}
+}
+
+func TestSplitImageRef(t *testing.T) {
+	for ref, want := range map[string][2]string{
+		"node":                                  {"node", ""},
+		"node:20-alpine":                        {"node", "20-alpine"},
+		"registry:5000/team/app":                {"registry:5000/team/app", ""},
+		"registry:5000/team/app:1.2@sha256:abc": {"registry:5000/team/app", "1.2"},
+	} {
+		if repo, tag := SplitImageRef(ref); repo != want[0] || tag != want[1] {
+			t.Errorf("SplitImageRef(%q) = %q, %q, want %q, %q", ref, repo, tag, want[0], want[1])
+		}
+	}
+}
+
+func TestNormalizeRepo(t *testing.T) {
+	for repo, want := range map[string]string{
+		"docker.io/library/node":       "node",
+		"index.docker.io/library/node": "node",
+		"library/node":                 "node",
+		"bitnami/node":                 "bitnami/node",
+		"ghcr.io/acme/node":            "ghcr.io/acme/node",
+	} {
+		if got := NormalizeRepo(repo); got != want {
+			t.Errorf("NormalizeRepo(%q) = %q, want %q", repo, got, want)
+		}
+	}
+}
+
+func TestKeyValueArgs(t *testing.T) {
+	got := keyValueArgs("--label", map[string]string{"dio.version": "1.4.0", "dio.dockerfile": "api/Dockerfile", "dio.policy": "passed"})
+	want := []string{"--label", "dio.dockerfile=api/Dockerfile", "--label", "dio.policy=passed", "--label", "dio.version=1.4.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keyValueArgs() = %v, want %v", got, want)
+	}
+	if got := keyValueArgs("--build-arg", nil); got != nil {
+		t.Errorf("expected no flags without values, got %v", got)
+	}
+}
+
+// fakeClient returns a Client running a docker shell script.
+func fakeClient(t *testing.T, script string) *Client {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "docker")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return &Client{dockerBin: bin}
+}
+
+func TestShortRepo(t *testing.T) {
+	for repo, want := range map[string]string{
+		"docker.io/library/node": "node",
+		"library/node":           "node",
+		"docker.io/acme/app":     "acme/app",
+		"registry.corp/app":      "registry.corp/app",
+		"node":                   "node",
+	} {
+		if got := shortRepo(repo); got != want {
+			t.Errorf("shortRepo(%q) = %q, want %q", repo, got, want)
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	c := fakeClient(t, `case "$1" in
+  inspect) echo '[{"Id": "sha256:abc", "RepoDigests": ["registry.corp/app@sha256:111", "app@sha256:222"]}]' ;;
+esac
+`)
+	digest, err := c.Push("app:dio", "docker.io/library/app:1.0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "app@sha256:222" {
+		t.Errorf("expected the digest of the Docker Hub repository, got %q", digest)
+	}
+
+	digest, err = c.Push("app:dio", "registry.corp/app:1.0", nil)
+	if err != nil || digest != "registry.corp/app@sha256:111" {
+		t.Errorf("expected the digest of the registry repository, got %q, %v", digest, err)
+	}
+
+	if _, err := c.Push("app:dio", "ghcr.io/acme/app:1.0", nil); err == nil || !strings.Contains(err.Error(), "no digest recorded for ghcr.io/acme/app:1.0") {
+		t.Errorf("expected an error without a digest for the repository, got %v", err)
+	}
+}
+
+func TestPush_Error(t *testing.T) {
+	c := fakeClient(t, `case "$1" in
+  push) echo "denied: requested access to the resource is denied" >&2; exit 1 ;;
+esac
+`)
+	_, err := c.Push("app:dio", "registry.corp/app:1.0", nil)
+	if err == nil || !strings.Contains(err.Error(), "docker push failed") || !strings.Contains(err.Error(), "requested access to the resource is denied") {
+		t.Errorf("expected the push error with its output, got %v", err)
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	output := "#1 load build definition\n#2 RUN npm ci\nnpm ERR! missing script\nerror: exit code 1\n\n"
+	if got, want := LastLines(output, 2), "npm ERR! missing script\nerror: exit code 1"; got != want {
+		t.Errorf("LastLines() = %q, want %q", got, want)
+	}
+	if got, want := LastLines("one line\n", 20), "one line"; got != want {
+		t.Errorf("LastLines() = %q, want %q", got, want)
+	}
+}
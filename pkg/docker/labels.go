@@ -0,0 +1,51 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Label adds labels to the config of a local image and tags the result as
+// tag, which may be the image's own name. Only metadata changes: the
+// layers are shared with the source image.
+func (c *Client) Label(imageRef, tag string, labels map[string]string) error {
+	args := append(append([]string{"build", "-t", tag}, c.formatArgs()...), keyValueArgs("--label", labels)...)
+	// A Dockerfile on stdin builds without a context. Podman needs one,
+	// so it gets an empty directory.
+	args = append(args, "-")
+	if c.podman {
+		dir, err := os.MkdirTemp("", "dio-label-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		args = append(args[:len(args)-1], "-f", "-", dir)
+	}
+	cmd := exec.Command(c.dockerBin, args...)
+	cmd.Stdin = strings.NewReader("FROM " + imageRef + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to label image: %w\nstderr: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// keyValueArgs returns a flag, such as --label or --build-arg, for each
+// KEY=VALUE pair of m, sorted by key.
+func keyValueArgs(flag string, m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var args []string
+	for _, k := range keys {
+		args = append(args, flag, k+"="+m[k])
+	}
+	return args
+}
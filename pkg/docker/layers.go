@@ -0,0 +1,395 @@
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// WastedBytes returns the bytes an image spends on files that a later layer
+// overwrites or deletes. They are still pulled and stored, but invisible in
+// the final filesystem, and squashing the image removes them.
+func (c *Client) WastedBytes(imageRef string) (int64, error) {
+	var wasted int64
+	err := c.readSave(imageRef, func(r io.Reader) (err error) {
+		_, _, wasted, err = replayLayers(r)
+		return err
+	})
+	return wasted, err
+}
+
+// Files returns the size of every regular file in an image's final
+// filesystem, keyed by absolute path.
+func (c *Client) Files(imageRef string) (map[string]int64, error) {
+	var files map[string]int64
+	err := c.readSave(imageRef, func(r io.Reader) (err error) {
+		files, _, _, err = replayLayers(r)
+		return err
+	})
+	return files, err
+}
+
+// SetIDFiles returns the setuid and setgid files in an image's final
+// filesystem, sorted by path.
+func (c *Client) SetIDFiles(imageRef string) ([]models.SetIDFile, error) {
+	var modes map[string]int64
+	err := c.readSave(imageRef, func(r io.Reader) (err error) {
+		_, modes, _, err = replayLayers(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	files := make([]models.SetIDFile, 0, len(modes))
+	for p, mode := range modes {
+		files = append(files, models.SetIDFile{
+			Path:   p,
+			Mode:   fmt.Sprintf("%04o", mode&0o7777),
+			Setuid: mode&cISUID != 0,
+			Setgid: mode&cISGID != 0,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// LayerDuplicates returns the layers of an image that add files an earlier
+// layer already holds, with the same size: a chown or chmod of copied
+// files, which rewrites every file in full. The image stores them twice.
+func (c *Client) LayerDuplicates(imageRef string) ([]models.LayerDuplication, error) {
+	var dups []models.LayerDuplication
+	err := c.readSave(imageRef, func(r io.Reader) error {
+		img, err := readSavedImage(r, false)
+		if err != nil {
+			return err
+		}
+		dups = img.duplicates()
+		return nil
+	})
+	return dups, err
+}
+
+// duplicates finds the files each layer adds again with the same size,
+// grouped by layer.
+func (img *savedImage) duplicates() []models.LayerDuplication {
+	createdBy := layerHistory(img)
+	describe := func(layer int) string {
+		if createdBy == nil {
+			return ""
+		}
+		return createdBy[layer]
+	}
+
+	type origin struct {
+		layer int
+		size  int64
+	}
+	present := make(map[string]origin)
+	var dups []models.LayerDuplication
+	for i, files := range img.layers {
+		for _, dir := range files.opaque {
+			for p := range present {
+				if strings.HasPrefix(p, dir+"/") {
+					delete(present, p)
+				}
+			}
+		}
+		for _, p := range files.whiteouts {
+			delete(present, p)
+		}
+		dup := models.LayerDuplication{Layer: i, CreatedBy: describe(i)}
+		sources := make(map[int]int64)
+		for p, size := range files.files {
+			if prev, ok := present[p]; ok && prev.size == size {
+				dup.Files++
+				dup.Bytes += size
+				sources[prev.layer] += size
+			}
+			present[p] = origin{layer: i, size: size}
+		}
+		if dup.Files == 0 {
+			continue
+		}
+		// Credit the layer most of the bytes come from
+		dup.SourceLayer = -1
+		for layer, size := range sources {
+			if dup.SourceLayer < 0 || size > sources[dup.SourceLayer] || (size == sources[dup.SourceLayer] && layer < dup.SourceLayer) {
+				dup.SourceLayer = layer
+			}
+		}
+		dup.SourceCreatedBy = describe(dup.SourceLayer)
+		dups = append(dups, dup)
+	}
+	return dups
+}
+
+// layerHistory returns the created_by of the history entry of each layer,
+// or nil when the history doesn't line up with the layers.
+func layerHistory(img *savedImage) []string {
+	var createdBy []string
+	for _, h := range img.history {
+		if !h.EmptyLayer {
+			createdBy = append(createdBy, strings.TrimSpace(h.CreatedBy))
+		}
+	}
+	if len(createdBy) != len(img.layers) {
+		return nil
+	}
+	return createdBy
+}
+
+// readSave streams the docker save archive of an image to read.
+func (c *Client) readSave(imageRef string, read func(io.Reader) error) error {
+	cmd := exec.Command(c.dockerBin, "save", imageRef)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("docker save failed: %w", err)
+	}
+
+	if err := read(stdout); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("failed to read docker save output: %w", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("docker save failed: %w\nstderr: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// Permission bits of tar headers.
+const (
+	cISUID = 0o4000
+	cISGID = 0o2000
+)
+
+// layerFiles is what a layer adds and removes.
+type layerFiles struct {
+	files     map[string]int64
+	setid     map[string]int64 // modes of the setuid and setgid files
+	dirs      map[string]int64 // modes of the directories
+	size      int64            // of the files
+	whiteouts []string         // deleted paths
+	opaque    []string         // directories whose lower contents are hidden
+	// digests hash the header and content of every entry, when asked for.
+	digests map[string]string
+}
+
+// savedImage is what a docker save archive holds: the layers, in order, and
+// the history of the image config.
+type savedImage struct {
+	layers  []*layerFiles
+	history []historyEntry
+	config  []byte
+}
+
+// historyEntry is an entry of the history of an image config. Entries of
+// instructions that only change the config, like ENV, have no layer.
+type historyEntry struct {
+	CreatedBy  string `json:"created_by"`
+	EmptyLayer bool   `json:"empty_layer"`
+}
+
+// readSavedImage reads a docker save archive, hashing every entry of the
+// layers with digests. The archive lists its layers and config in
+// manifest.json, which may come after the layers themselves, so every layer
+// is read before they are ordered.
+func readSavedImage(r io.Reader, digests bool) (*savedImage, error) {
+	parsed := make(map[string]*layerFiles)
+	configs := make(map[string][]byte)
+	var (
+		layers []string
+		config string
+	)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Name == "manifest.json" {
+			var manifest []struct {
+				Config string   `json:"Config"`
+				Layers []string `json:"Layers"`
+			}
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest.json: %w", err)
+			}
+			if len(manifest) > 0 {
+				layers, config = manifest[0].Layers, manifest[0].Config
+			}
+			continue
+		}
+		// Configs are JSON: <id>.json in the docker layout, a blob in the
+		// OCI layout, next to indexes that aren't tar archives either
+		br := bufio.NewReader(tr)
+		if strings.HasSuffix(hdr.Name, ".json") || isJSON(br) {
+			if data, err := io.ReadAll(br); err == nil {
+				configs[hdr.Name] = data
+			}
+			continue
+		}
+		if files, err := readLayer(br, digests); err == nil {
+			parsed[hdr.Name] = files
+		}
+	}
+	if layers == nil {
+		return nil, fmt.Errorf("docker save output has no manifest")
+	}
+
+	img := &savedImage{config: configs[config]}
+	for _, layer := range layers {
+		files, ok := parsed[layer]
+		if !ok {
+			return nil, fmt.Errorf("layer %s not found in docker save output", layer)
+		}
+		img.layers = append(img.layers, files)
+	}
+	var cfg struct {
+		History []historyEntry `json:"history"`
+	}
+	if err := json.Unmarshal(img.config, &cfg); err == nil {
+		img.history = cfg.History
+	}
+	return img, nil
+}
+
+// isJSON reports whether the content br reads starts like a JSON object.
+func isJSON(br *bufio.Reader) bool {
+	b, _ := br.Peek(1)
+	return len(b) == 1 && b[0] == '{'
+}
+
+// replayLayers reads a docker save archive and replays its layers in
+// order. It returns the files of the resulting filesystem, the modes of its
+// setuid and setgid files, and the size of files replaced or deleted by a
+// later layer.
+func replayLayers(r io.Reader) (map[string]int64, map[string]int64, int64, error) {
+	img, err := readSavedImage(r, false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	present := make(map[string]int64)
+	setid := make(map[string]int64)
+	removeTree := func(dir string) int64 {
+		var size int64
+		for p, s := range present {
+			if strings.HasPrefix(p, dir+"/") {
+				size += s
+				delete(present, p)
+				delete(setid, p)
+			}
+		}
+		return size
+	}
+	var wasted int64
+	for _, files := range img.layers {
+		for _, dir := range files.opaque {
+			wasted += removeTree(dir)
+		}
+		for _, p := range files.whiteouts {
+			wasted += present[p] + removeTree(p)
+			delete(present, p)
+			delete(setid, p)
+		}
+		for p, size := range files.files {
+			wasted += present[p]
+			present[p] = size
+			if mode, ok := files.setid[p]; ok {
+				setid[p] = mode
+			} else {
+				delete(setid, p)
+			}
+		}
+	}
+	return present, setid, wasted, nil
+}
+
+// readLayer lists the files of a layer tarball, which may be gzipped, and
+// hashes its entries with digests.
+func readLayer(r io.Reader, digests bool) (*layerFiles, error) {
+	br := bufio.NewReader(r)
+	var layer io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		layer = zr
+	}
+
+	files := &layerFiles{files: make(map[string]int64), setid: make(map[string]int64), dirs: make(map[string]int64)}
+	if digests {
+		files.digests = make(map[string]string)
+	}
+	tr := tar.NewReader(layer)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(path.Clean("/"+hdr.Name), "/")
+		if files.digests != nil {
+			digest, err := entryDigest(hdr, tr)
+			if err != nil {
+				return nil, err
+			}
+			files.digests[name] = digest
+		}
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+		switch {
+		case base == ".wh..wh..opq":
+			files.opaque = append(files.opaque, dir)
+		case strings.HasPrefix(base, ".wh."):
+			files.whiteouts = append(files.whiteouts, dir+"/"+strings.TrimPrefix(base, ".wh."))
+		case hdr.Typeflag == tar.TypeDir:
+			files.dirs[name] = hdr.Mode
+		case hdr.Typeflag == tar.TypeReg:
+			files.files[name] = hdr.Size
+			files.size += hdr.Size
+			if hdr.Mode&(cISUID|cISGID) != 0 {
+				files.setid[name] = hdr.Mode
+			}
+		}
+	}
+}
+
+// entryDigest hashes what reproducible builds must keep identical in a
+// layer entry: its metadata, timestamps included, and its content.
+func entryDigest(hdr *tar.Header, content io.Reader) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%c %o %d:%d %d %s %s\n", hdr.Typeflag, hdr.Mode, hdr.Uid, hdr.Gid, hdr.ModTime.Unix(), hdr.Linkname, hdr.PAXRecords)
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Push tags a local image as ref and pushes it, returning the pushed
+// reference with its digest (repo@sha256:...). Labels, when given, are
+// added to the image config first.
+func (c *Client) Push(imageRef, ref string, labels map[string]string) (string, error) {
+	if len(labels) > 0 {
+		if err := c.Label(imageRef, ref, labels); err != nil {
+			return "", err
+		}
+	} else if err := c.run("tag", imageRef, ref); err != nil {
+		return "", err
+	}
+
+	if c.podman {
+		return c.podmanPush(ref)
+	}
+	if err := c.run("push", ref); err != nil {
+		return "", err
+	}
+	img, err := c.inspect(ref)
+	if err != nil {
+		return "", err
+	}
+	repo := repository(ref)
+	for _, digest := range img.RepoDigests {
+		if name, _, ok := strings.Cut(digest, "@"); ok && shortRepo(name) == shortRepo(repo) {
+			return digest, nil
+		}
+	}
+	return "", fmt.Errorf("no digest recorded for %s after push", ref)
+}
+
+// podmanPush pushes ref with podman, which doesn't record the digest in
+// RepoDigests but can write it to a file.
+func (c *Client) podmanPush(ref string) (string, error) {
+	f, err := os.CreateTemp("", "dio-digest-")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	if err := c.run("push", "--digestfile", f.Name(), ref); err != nil {
+		return "", err
+	}
+	digest, err := os.ReadFile(f.Name())
+	if err != nil || len(bytes.TrimSpace(digest)) == 0 {
+		return "", fmt.Errorf("no digest recorded for %s after push", ref)
+	}
+	return repository(ref) + "@" + string(bytes.TrimSpace(digest)), nil
+}
+
+// shortRepo drops the parts of a Docker Hub repository name that docker
+// leaves out of RepoDigests.
+func shortRepo(repo string) string {
+	repo = strings.TrimPrefix(repo, "docker.io/")
+	return strings.TrimPrefix(repo, "library/")
+}
+
+// run runs a docker command whose output isn't needed.
+func (c *Client) run(args ...string) error {
+	cmd := exec.Command(c.dockerBin, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker %s failed: %w\nstderr: %s", args[0], err, stderr.String())
+	}
+	return nil
+}
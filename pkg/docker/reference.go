@@ -0,0 +1,21 @@
+package docker
+
+import "strings"
+
+// SplitImageRef splits an image reference into repository and tag,
+// dropping any digest. The tag is "" when the reference has none.
+func SplitImageRef(ref string) (string, string) {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// NormalizeRepo strips the implicit Docker Hub registry and library
+// namespace, so "docker.io/library/node" and "node" compare equal.
+func NormalizeRepo(repo string) string {
+	repo = strings.TrimPrefix(repo, "docker.io/")
+	repo = strings.TrimPrefix(repo, "index.docker.io/")
+	return strings.TrimPrefix(repo, "library/")
+}
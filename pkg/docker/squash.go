@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/maxlar/docker-image-optimizer/internal/models"
+)
+
+// Squash flattens an image into a single layer tagged tag, by exporting
+// the filesystem of a container created from it and importing that again.
+// The run configuration (CMD, ENTRYPOINT, ENV, WORKDIR, USER, EXPOSE,
+// VOLUME, LABEL) is carried over; HEALTHCHECK and the image history are not.
+func (c *Client) Squash(imageRef, tag string) (*models.ImageMetrics, error) {
+	img, err := c.inspect(imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	container, err := c.createContainer(imageRef)
+	if err != nil {
+		return nil, err
+	}
+	defer c.removeContainer(container)
+
+	args := []string{"import"}
+	for _, change := range importChanges(img) {
+		args = append(args, "--change", change)
+	}
+	args = append(args, "-", tag)
+	export := exec.Command(c.dockerBin, "export", container)
+	imp := exec.Command(c.dockerBin, args...)
+	var exportErr, importErr bytes.Buffer
+	export.Stderr = &exportErr
+	imp.Stderr = &importErr
+	pipe, err := export.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	imp.Stdin = pipe
+	if err := export.Start(); err != nil {
+		return nil, fmt.Errorf("docker export failed: %w", err)
+	}
+	if err := imp.Run(); err != nil {
+		_ = export.Process.Kill()
+		_ = export.Wait()
+		return nil, fmt.Errorf("docker import failed: %w\nstderr: %s", err, importErr.String())
+	}
+	if err := export.Wait(); err != nil {
+		return nil, fmt.Errorf("docker export failed: %w\nstderr: %s", err, exportErr.String())
+	}
+
+	return c.Inspect(tag)
+}
+
+// createContainer creates a container from an image to read its
+// filesystem. The container is never started; the command only satisfies
+// images without a CMD.
+func (c *Client) createContainer(imageRef string) (string, error) {
+	create := exec.Command(c.dockerBin, "create", imageRef, "true")
+	var stdout, stderr bytes.Buffer
+	create.Stdout = &stdout
+	create.Stderr = &stderr
+	if err := create.Run(); err != nil {
+		return "", fmt.Errorf("docker create failed: %w\nstderr: %s", err, stderr.String())
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (c *Client) removeContainer(container string) {
+	_ = exec.Command(c.dockerBin, "rm", "-f", container).Run()
+}
+
+// importChanges returns the Dockerfile instructions passed to docker
+// import --change to restore an image's configuration.
+func importChanges(img *dockerInspectJSON) []string {
+	cfg := img.Config
+	var changes []string
+	for _, env := range cfg.Env {
+		key, value, _ := strings.Cut(env, "=")
+		changes = append(changes, "ENV "+key+"="+dockerfileQuote(value))
+	}
+	if cfg.WorkingDir != "" {
+		changes = append(changes, "WORKDIR "+cfg.WorkingDir)
+	}
+	if cfg.User != "" {
+		changes = append(changes, "USER "+cfg.User)
+	}
+	for _, port := range sortedKeys(cfg.ExposedPorts) {
+		changes = append(changes, "EXPOSE "+port)
+	}
+	if volumes := sortedKeys(cfg.Volumes); len(volumes) > 0 {
+		data, _ := json.Marshal(volumes)
+		changes = append(changes, "VOLUME "+string(data))
+	}
+	labels := make([]string, 0, len(cfg.Labels))
+	for key := range cfg.Labels {
+		labels = append(labels, key)
+	}
+	sort.Strings(labels)
+	for _, key := range labels {
+		changes = append(changes, "LABEL "+dockerfileQuote(key)+"="+dockerfileQuote(cfg.Labels[key]))
+	}
+	if len(cfg.Entrypoint) > 0 {
+		data, _ := json.Marshal(cfg.Entrypoint)
+		changes = append(changes, "ENTRYPOINT "+string(data))
+	}
+	if len(cfg.Cmd) > 0 {
+		data, _ := json.Marshal(cfg.Cmd)
+		changes = append(changes, "CMD "+string(data))
+	}
+	return changes
+}
+
+// dockerfileQuote quotes a value so the Dockerfile parser reads it back
+// verbatim, without expanding variables.
+func dockerfileQuote(s string) string {
+	return strings.ReplaceAll(strconv.Quote(s), "$", `\$`)
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}